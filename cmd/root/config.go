@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// configValidate loads a configuration file, applying environment overrides
+// as the server would, and prints every problem Validate finds
+func configValidate(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("config validate", stderr)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(stderr, "config validate takes at most one path")
+		return exitUsage
+	}
+
+	path := cmp.Or(fs.Arg(0), os.Getenv("CONFIG_PATH"), config.DefaultPath)
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "load config: %v\n", err)
+		return exitFailure
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "%s is invalid:\n", path)
+		var invalid validation.Errors
+		if !errors.As(err, &invalid) {
+			fmt.Fprintf(stderr, "  %v\n", err)
+			return exitFailure
+		}
+		for _, fe := range invalid {
+			fmt.Fprintf(stderr, "  %s: %s\n", fe.Field, fe.Message)
+		}
+		return exitFailure
+	}
+
+	fmt.Fprintf(stdout, "%s is valid\n", path)
+	return exitOK
+}
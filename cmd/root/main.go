@@ -1,5 +1,103 @@
 package main
 
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+// Exit codes shared by every command
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2 // bad arguments, matching the flag package
+)
+
+// command is a subcommand of the root binary, selected by one or more words
+type command struct {
+	path    []string
+	args    string // argument synopsis for the help text
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{path: []string{"serve"}, args: "[--config path] [--dev] [--print-config]", summary: "start the server (the default); --dev runs a throwaway local instance, --print-config prints the redacted configuration instead", run: serve},
+	{path: []string{"config", "validate"}, args: "[path]", summary: "check a configuration file and list every problem", run: configValidate},
+	{path: []string{"migrate"}, args: "[--dry-run] [--config path]", summary: "apply the pending PostgreSQL migrations; --dry-run only lists them", run: migrate},
+	{path: []string{"token", "issue"}, args: "--subject S [--roles R,...] [--tenant T] [--ttl D]", summary: "sign an access token with the configured JWT secret", run: tokenIssue},
+	{path: []string{"registry", "list"}, args: "[--addr URL] --token T", summary: "print the registered services of a running server", run: registryList},
+	{path: []string{"registry", "replay"}, args: "[--addr URL] --token T <file>", summary: "repeat the mutations of a registry journal against a running server", run: registryReplay},
+}
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run dispatches to the command selected by args and returns its exit code.
+// Without arguments the server is started.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return serve(nil, stdout, stderr)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if len(args) >= len(cmd.path) && slices.Equal(args[:len(cmd.path)], cmd.path) {
+			return cmd.run(args[len(cmd.path):], stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "unknown command %q\n\n", strings.Join(args, " "))
+	printUsage(stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: root <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\n", strings.Join(cmd.path, " "), cmd.args)
+		fmt.Fprintf(w, "      %s\n", cmd.summary)
+	}
+}
+
+// newFlagSet returns a flag set that reports errors to stderr instead of exiting
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags parses args. When parsing stops the command, ok is false and
+// code is the exit code: success for -h, a usage error otherwise.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	err := fs.Parse(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK, false
+	case err != nil:
+		return exitUsage, false
+	}
+	return exitOK, true
+}
 
+// loadConfig loads the configuration file at path, or the one config.Load
+// picks when path is empty
+func loadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		return config.Load()
+	}
+	return config.LoadFile(path)
 }
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/bootstrap"
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/pkg/jwt"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/rootclient"
+)
+
+// writeConfig writes a configuration file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+const validConfig = `{"server": {"addr": ":8080"}, "jwt": {"secret": "test-secret", "access_token_ttl": 15}}`
+
+func TestRun(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	valid := writeConfig(t, validConfig)
+	unreachable := writeConfig(t, `{"storage": {"postgres": {"host": "127.0.0.1", "port": 1, "user": "root", "database": "root"}}}`)
+	invalid := writeConfig(t, `{"jwt": {"access_token_ttl": -1}, "storage": {"type": "mongo"}, "log": {"level": "loud"}}`)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr []string
+	}{
+		{name: "help", args: []string{"help"}, wantCode: exitOK, wantStdout: "token issue"},
+		{name: "unknown command", args: []string{"frobnicate"}, wantCode: exitUsage, wantStderr: []string{`unknown command "frobnicate"`}},
+		{name: "incomplete command", args: []string{"token"}, wantCode: exitUsage, wantStderr: []string{`unknown command "token"`}},
+		{name: "valid config", args: []string{"config", "validate", valid}, wantCode: exitOK, wantStdout: "is valid"},
+		{
+			name:     "invalid config lists every problem",
+			args:     []string{"config", "validate", invalid},
+			wantCode: exitFailure,
+			wantStderr: []string{
+				"server.addr: is required",
+				"jwt.secret: is required",
+				"jwt.access_token_ttl: must not be negative",
+				"storage.type: must be one of memory, redis, postgres",
+				"log.level: must be one of debug, info, warn, error",
+			},
+		},
+		{name: "missing config", args: []string{"config", "validate", filepath.Join(t.TempDir(), "missing.json")}, wantCode: exitFailure, wantStderr: []string{"load config"}},
+		{name: "too many paths", args: []string{"config", "validate", valid, invalid}, wantCode: exitUsage},
+		{name: "token without subject", args: []string{"token", "issue", "--config", valid}, wantCode: exitUsage},
+		{name: "unknown flag", args: []string{"token", "issue", "--subject", "ops", "--scope", "all"}, wantCode: exitUsage, wantStderr: []string{"flag provided but not defined"}},
+		{name: "flag help", args: []string{"registry", "list", "-h"}, wantCode: exitOK, wantStderr: []string{"-token"}},
+		{name: "registry without token", args: []string{"registry", "list", "--token", ""}, wantCode: exitUsage},
+		{name: "migrate with arguments", args: []string{"migrate", "up"}, wantCode: exitUsage},
+		{name: "migrate without database", args: []string{"migrate", "--dry-run", "--config", unreachable, "--timeout", "2s"}, wantCode: exitFailure, wantStderr: []string{"connect postgres"}},
+		{name: "replay without journal", args: []string{"registry", "replay", "--token", "rk_test"}, wantCode: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d\nstdout: %s\nstderr: %s", tt.wantCode, code, &stdout, &stderr)
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("expected stdout to contain %q, got %q", tt.wantStdout, &stdout)
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("expected stderr to contain %q, got %q", want, &stderr)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenIssue(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	path := writeConfig(t, validConfig)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantTTL time.Duration
+	}{
+		{name: "configured ttl", args: []string{"--subject", "ops", "--roles", "admin"}, wantTTL: 15 * time.Minute},
+		{name: "explicit ttl", args: []string{"--subject", "ops", "--roles", "admin", "--ttl", "2h"}, wantTTL: 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"token", "issue", "--config", path}, tt.args...)
+			if code := run(args, &stdout, &stderr); code != exitOK {
+				t.Fatalf("expected success, got exit code %d: %s", code, &stderr)
+			}
+
+			manager := jwt.New(jwt.Config{Secret: "test-secret", Issuer: bootstrap.TokenIssuer})
+			claims, err := manager.Validate(strings.TrimSpace(stdout.String()))
+			if err != nil {
+				t.Fatalf("expected a valid token, got %v", err)
+			}
+			if claims.Subject != "ops" || claims.Type != token.TypeAccess || !claims.HasRole(token.RoleAdmin) {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+			if got := claims.ExpiresAt.Sub(claims.IssuedAt); got != tt.wantTTL {
+				t.Errorf("expected a lifetime of %v, got %v", tt.wantTTL, got)
+			}
+			if issuedBy, _ := claims.GetString(token.MetadataIssuedBy); issuedBy != cliIssuer {
+				t.Errorf("expected issued_by %q, got %q", cliIssuer, issuedBy)
+			}
+		})
+	}
+
+	t.Run("roles and tenant", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		run([]string{"token", "issue", "--config", path, "--subject", "ops", "--roles", "admin, issuer,", "--tenant", "acme"}, &stdout, &stderr)
+
+		claims, err := jwt.New(jwt.Config{Secret: "test-secret"}).Validate(strings.TrimSpace(stdout.String()))
+		if err != nil {
+			t.Fatalf("expected a valid token, got %v", err)
+		}
+		if !slices.Equal(claims.Roles, []string{token.RoleAdmin, token.RoleIssuer}) || claims.TenantID != "acme" {
+			t.Errorf("expected roles [admin issuer] in tenant acme, got %v in %q", claims.Roles, claims.TenantID)
+		}
+	})
+
+	t.Run("secret is required", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		noSecret := writeConfig(t, `{"server": {"addr": ":8080"}}`)
+		if code := run([]string{"token", "issue", "--config", noSecret, "--subject", "ops"}, &stdout, &stderr); code != exitFailure {
+			t.Errorf("expected exit code %d, got %d", exitFailure, code)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("expected no token, got %q", &stdout)
+		}
+	})
+}
+
+func TestRegistryList(t *testing.T) {
+	var gotAuth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("offset") == "" {
+			w.Write([]byte(`{"items":[{"id":"payment-1","name":"payment","version":"1.2.0","status":"healthy","capabilities":["payments","refunds"]}],"total":2,"next_offset":1}`))
+			return
+		}
+		w.Write([]byte(`{"items":[{"id":"search-1","name":"search","status":"draining","tenant_id":"acme"}],"total":2,"next_offset":null}`))
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"registry", "list", "--addr", srv.URL, "--token", "rk_test"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected success, got exit code %d: %s", code, &stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") {
+		t.Fatalf("expected a header and two rows, got:\n%s", &stdout)
+	}
+	if fields := strings.Fields(lines[1]); !slices.Equal(fields, []string{"payment-1", "payment", "1.2.0", "healthy", "-", "payments,refunds", "-"}) {
+		t.Errorf("unexpected first row %v", fields)
+	}
+	if fields := strings.Fields(lines[2]); fields[0] != "search-1" || fields[3] != "draining" || fields[4] != "acme" {
+		t.Errorf("unexpected second row %v", fields)
+	}
+	if len(gotAuth) != 2 || gotAuth[0] != "Bearer rk_test" {
+		t.Errorf("expected two authenticated requests, got %v", gotAuth)
+	}
+
+	srv.Close()
+	stdout.Reset()
+	if code := run([]string{"registry", "list", "--addr", srv.URL, "--token", "rk_test", "--timeout", "1s"}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("expected exit code %d when the server is down, got %d", exitFailure, code)
+	}
+}
+
+func TestServeDevModeGuards(t *testing.T) {
+	t.Setenv("ROOT_DEV", "")
+
+	tests := []struct {
+		name       string
+		args       []string
+		env        string
+		config     string
+		wantStderr []string
+	}{
+		{
+			name:       "postgres storage",
+			args:       []string{"--dev"},
+			config:     `{"server": {"addr": "127.0.0.1:0"}, "storage": {"type": "postgres"}}`,
+			wantStderr: []string{"dev mode refused: storage.type is postgres"},
+		},
+		{
+			name:       "redis for one component",
+			args:       []string{"--dev"},
+			config:     `{"server": {"addr": "127.0.0.1:0"}, "storage": {"type": "memory", "sessions": {"type": "redis"}}}`,
+			wantStderr: []string{"dev mode refused: storage.sessions.type is redis"},
+		},
+		{
+			name:       "tls",
+			args:       []string{"--dev"},
+			config:     `{"server": {"addr": "127.0.0.1:0", "tls": {"enabled": true}}, "storage": {"type": "redis"}}`,
+			wantStderr: []string{"storage.type is redis", "server.tls is enabled"},
+		},
+		{
+			name:       "enabled from the environment",
+			env:        "1",
+			config:     `{"server": {"addr": "127.0.0.1:0"}, "storage": {"type": "postgres"}}`,
+			wantStderr: []string{"dev mode refused"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ROOT_DEV", tt.env)
+			args := append([]string{"serve", "--config", writeConfig(t, tt.config)}, tt.args...)
+
+			var stdout, stderr bytes.Buffer
+			if code := run(args, &stdout, &stderr); code != exitFailure {
+				t.Fatalf("expected exit code %d, got %d: %s", exitFailure, code, &stderr)
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("expected stderr to contain %q, got %q", want, &stderr)
+				}
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("expected no token, got %q", &stdout)
+			}
+		})
+	}
+}
+
+func TestServePrintConfig(t *testing.T) {
+	// The configured address is taken, so serving would fail to listen
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	t.Setenv("ROOT_DEV", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("REDIS_PASSWORD", "password-from-env")
+	path := writeConfig(t, `{"server": {"addr": "`+ln.Addr().String()+`"}, "jwt": {"secret": "print-config-jwt-secret"}, "storage": {"type": "redis", "redis": {"addr": "127.0.0.1:1"}}}`)
+
+	var stdout, stderr bytes.Buffer
+	done := make(chan int, 1)
+	go func() {
+		done <- run([]string{"serve", "--config", path, "--print-config"}, &stdout, &stderr)
+	}()
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, &stderr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected --print-config to exit without serving")
+	}
+
+	var printed config.Config
+	if err := json.Unmarshal(stdout.Bytes(), &printed); err != nil {
+		t.Fatalf("expected the configuration as JSON, got %v:\n%s", err, &stdout)
+	}
+	if printed.Server.Addr != ln.Addr().String() || printed.Storage.Type != config.StorageRedis {
+		t.Errorf("expected the loaded configuration, got %+v", printed)
+	}
+	for _, secret := range []string{"print-config-jwt-secret", "password-from-env"} {
+		if strings.Contains(stdout.String(), secret) {
+			t.Errorf("expected %q redacted, got:\n%s", secret, &stdout)
+		}
+	}
+	if !strings.HasPrefix(printed.Storage.Redis.Password, config.RedactedPrefix) {
+		t.Errorf("expected the environment override redacted, got %q", printed.Storage.Redis.Password)
+	}
+}
+
+func TestServeDevModeToken(t *testing.T) {
+	cfg := bootstrap.DevConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.JWT.Secret = "configured-secret"
+	if err := bootstrap.ApplyDevMode(cfg); err != nil {
+		t.Fatalf("apply dev mode: %v", err)
+	}
+	if cfg.JWT.Secret == "configured-secret" || len(cfg.JWT.Secret) < 32 {
+		t.Errorf("expected a generated JWT secret, got %q", cfg.JWT.Secret)
+	}
+	if !apikey.IsAPIKey(cfg.Auth.BootstrapAPIKey) || len(cfg.Auth.BootstrapAPIKey) < 32 || cfg.Auth.BootstrapAPIKeyTTL == 0 {
+		t.Errorf("expected a generated, expiring bootstrap api key, got %q for %d hours", cfg.Auth.BootstrapAPIKey, cfg.Auth.BootstrapAPIKeyTTL)
+	}
+
+	ctx := context.Background()
+	app, err := bootstrap.NewApplication(ctx, cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(ctx)
+	go app.Start()
+	<-app.Ready()
+
+	var printed bytes.Buffer
+	if err := startDevMode(ctx, app, true, &printed, logger.NewNop()); err != nil {
+		t.Fatalf("start dev mode: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"registry", "list", "--addr", "http://" + app.Addr(), "--token", strings.TrimSpace(printed.String())}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected the printed token to be accepted, got exit code %d: %s", code, &stderr)
+	}
+	for _, id := range []string{"payment-dev-1", "notification-dev-1"} {
+		if !strings.Contains(stdout.String(), id) {
+			t.Errorf("expected seeded service %s, got:\n%s", id, &stdout)
+		}
+	}
+
+	args = []string{"registry", "list", "--addr", "http://" + app.Addr(), "--token", cfg.Auth.BootstrapAPIKey}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Errorf("expected the generated bootstrap api key to be accepted, got exit code %d: %s", code, &stderr)
+	}
+}
+
+func TestRegistryReplay(t *testing.T) {
+	ctx := context.Background()
+	journalPath := filepath.Join(t.TempDir(), "registry.log")
+
+	newApp := func(journal string) (*bootstrap.Application, string) {
+		t.Helper()
+		cfg := &config.Config{
+			Server: config.ServerConfig{Addr: "127.0.0.1:0"},
+			JWT:    config.JWTConfig{Secret: "main-test-jwt-secret-0123456789abcdef"},
+			Auth:   config.AuthConfig{BootstrapAPIKey: "rk_test_admin"},
+		}
+		cfg.Registry.Journal = config.JournalConfig{Path: journal, HeartbeatSampling: 1}
+		app, err := bootstrap.NewApplication(ctx, cfg, logger.NewNop())
+		if err != nil {
+			t.Fatalf("new application: %v", err)
+		}
+		srv := httptest.NewServer(app.Handler())
+		t.Cleanup(srv.Close)
+		return app, srv.URL
+	}
+	list := func(addr string) []string {
+		t.Helper()
+		client := rootclient.New(rootclient.Config{BaseURL: addr, APIKey: "rk_test_admin"})
+		page, err := client.Registry().ListServices(ctx, rootclient.ListOptions{})
+		if err != nil {
+			t.Fatalf("list services: %v", err)
+		}
+		var got []string
+		for _, svc := range page.Items {
+			got = append(got, svc.ID+" "+svc.Name+" "+svc.Status+" "+strings.Join(svc.Capabilities, ","))
+		}
+		slices.Sort(got)
+		return got
+	}
+
+	source, sourceAddr := newApp(journalPath)
+	registry := rootclient.New(rootclient.Config{BaseURL: sourceAddr, APIKey: "rk_test_admin"}).Registry()
+	for _, req := range []rootclient.RegisterRequest{
+		{ID: "payment-1", Name: "payment", Endpoints: []rootclient.Endpoint{{URL: "http://payment:8080"}}, Capabilities: []string{"payments"}},
+		{ID: "search-1", Name: "search", Endpoints: []rootclient.Endpoint{{URL: "http://search:8080"}}, Capabilities: []string{"search"}},
+		{ID: "mail-1", Name: "mail", Endpoints: []rootclient.Endpoint{{URL: "http://mail:8080"}}},
+	} {
+		if _, err := registry.Register(ctx, req); err != nil {
+			t.Fatalf("register %s: %v", req.ID, err)
+		}
+	}
+	if err := registry.Heartbeat(ctx, "payment-1"); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if _, err := registry.SetStatus(ctx, "search-1", rootclient.StatusDraining); err != nil {
+		t.Fatalf("set status: %v", err)
+	}
+	if err := registry.Deregister(ctx, "mail-1"); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+	want := list(sourceAddr)
+	if err := source.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	target, targetAddr := newApp("")
+	defer target.Stop(ctx)
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"registry", "replay", "--addr", targetAddr, "--token", "rk_test_admin", journalPath}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected success, got exit code %d: %s", code, &stderr)
+	}
+	if !strings.Contains(stdout.String(), "applied 6, skipped 0, failed 0") {
+		t.Errorf("unexpected summary %q", &stdout)
+	}
+	if got := list(targetAddr); !slices.Equal(got, want) {
+		t.Errorf("expected replayed services %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aq189/bin/internal/bootstrap"
+)
+
+// migrate applies the pending PostgreSQL migrations, or with --dry-run lists
+// them, against the database of storage.postgres. The server applies them
+// itself at startup; this lets operators see or apply them ahead of a rollout.
+func migrate(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("migrate", stderr)
+	configPath := fs.String("config", "", "configuration file holding storage.postgres")
+	dryRun := fs.Bool("dry-run", false, "list the pending migrations without applying them")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time allowed for connecting and migrating")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "usage: root migrate [--dry-run] [--config path]")
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "load config: %v\n", err)
+		return exitFailure
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	migrations, err := bootstrap.MigratePostgres(ctx, cfg, *dryRun)
+	verb := "applied"
+	if *dryRun {
+		verb = "pending"
+	}
+	for _, m := range migrations {
+		fmt.Fprintf(stdout, "%s %s\n", verb, m)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "migrate: %v\n", err)
+		return exitFailure
+	}
+	if len(migrations) == 0 {
+		fmt.Fprintln(stdout, "schema is up to date")
+	}
+	return exitOK
+}
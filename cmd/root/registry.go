@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/pkg/rootclient"
+)
+
+// registryPageSize is the page size registry list requests, the server's maximum
+const registryPageSize = 500
+
+// registryList prints every service registered with a running server as a table
+func registryList(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("registry list", stderr)
+	addr := fs.String("addr", cmp.Or(os.Getenv("ROOT_ADDR"), "http://localhost:8080"), "server base URL; defaults to $ROOT_ADDR")
+	authToken := fs.String("token", os.Getenv("ROOT_TOKEN"), "bearer token or API key; defaults to $ROOT_TOKEN")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of each request")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *authToken == "" || fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "usage: root registry list [--addr URL] --token T")
+		return exitUsage
+	}
+
+	client := rootclient.New(rootclient.Config{BaseURL: *addr, APIKey: *authToken, Timeout: *timeout},
+		rootclient.WithUserAgent("root-cli"))
+
+	var services []*rootclient.Service
+	opts := rootclient.ListOptions{Limit: registryPageSize}
+	for {
+		page, err := client.Registry().ListServices(context.Background(), opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "list services: %v\n", err)
+			return exitFailure
+		}
+		services = append(services, page.Items...)
+		if page.NextOffset == nil {
+			break
+		}
+		opts.Offset = *page.NextOffset
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tVERSION\tSTATUS\tTENANT\tCAPABILITIES\tLAST HEARTBEAT")
+	for _, svc := range services {
+		heartbeat := "-"
+		if !svc.LastHeartbeat.IsZero() {
+			heartbeat = svc.LastHeartbeat.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", svc.ID, svc.Name, cmp.Or(svc.Version, "-"), svc.Status,
+			cmp.Or(svc.TenantID, "-"), cmp.Or(strings.Join(svc.Capabilities, ","), "-"), heartbeat)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "write table: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// maxJournalLine bounds a journal line, which carries a whole registration
+// for registers and imports
+const maxJournalLine = 1 << 20
+
+// replayEntry is a journal entry whose service decodes as a registration
+type replayEntry struct {
+	journal.Entry
+	Service *rootclient.RegisterRequest `json:"service"`
+}
+
+// registryReplay repeats the mutations of a registry journal against a
+// running server, in order. Failed entries are reported and skipped; health
+// changes are left to the target's own health checks.
+func registryReplay(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("registry replay", stderr)
+	addr := fs.String("addr", cmp.Or(os.Getenv("ROOT_ADDR"), "http://localhost:8080"), "server base URL; defaults to $ROOT_ADDR")
+	authToken := fs.String("token", os.Getenv("ROOT_TOKEN"), "bearer token or API key; defaults to $ROOT_TOKEN")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of each request")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *authToken == "" || fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: root registry replay [--addr URL] --token T <file>")
+		return exitUsage
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "open journal: %v\n", err)
+		return exitFailure
+	}
+	defer file.Close()
+
+	client := rootclient.New(rootclient.Config{BaseURL: *addr, APIKey: *authToken, Timeout: *timeout},
+		rootclient.WithUserAgent("root-cli"))
+	registry := client.Registry()
+
+	var applied, skipped, failed int
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJournalLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e replayEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			fmt.Fprintf(stderr, "line %d: decode entry: %v\n", line, err)
+			failed++
+			continue
+		}
+
+		ok, err := replayEntryTo(context.Background(), registry, e)
+		switch {
+		case err != nil:
+			fmt.Fprintf(stderr, "line %d: %s %s: %v\n", line, e.Op, e.ServiceID, err)
+			failed++
+		case ok:
+			applied++
+		default:
+			skipped++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(stderr, "read journal: %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Fprintf(stdout, "applied %d, skipped %d, failed %d\n", applied, skipped, failed)
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// replayEntryTo applies one journal entry through the client. It reports
+// false for entries that are not replayed.
+func replayEntryTo(ctx context.Context, registry *rootclient.RegistryClient, e replayEntry) (bool, error) {
+	var err error
+	switch e.Op {
+	case journal.OpRegister, journal.OpImport:
+		if e.Service == nil {
+			return false, errors.New("entry has no service")
+		}
+		_, err = registry.Register(ctx, *e.Service)
+	case journal.OpDeregister:
+		err = registry.Deregister(ctx, e.ServiceID)
+	case journal.OpRestore:
+		_, err = registry.Restore(ctx, e.ServiceID)
+	case journal.OpSetStatus:
+		_, err = registry.SetStatus(ctx, e.ServiceID, string(e.AfterStatus))
+	case journal.OpHeartbeat:
+		err = registry.Heartbeat(ctx, e.ServiceID)
+	default:
+		return false, nil
+	}
+	return err == nil, err
+}
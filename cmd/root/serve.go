@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/aq189/bin/internal/bootstrap"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// serve runs the server until SIGINT or SIGTERM, then shuts it down gracefully:
+// requests in flight get server.shutdown_grace to finish before their
+// connections are closed. SIGHUP reloads the JWT secrets from the
+// configuration; other settings need a restart.
+// With --dev or ROOT_DEV=1 it runs in dev mode; see bootstrap.ApplyDevMode.
+// With --print-config it prints the configuration it would run with, secrets
+// redacted, and exits without connecting to storage or listening.
+func serve(args []string, stdout, stderr io.Writer) int {
+	devDefault, _ := strconv.ParseBool(os.Getenv("ROOT_DEV"))
+
+	flags := newFlagSet("serve", stderr)
+	configPath := flags.String("config", "", "configuration file; defaults to $CONFIG_PATH or "+config.DefaultPath)
+	dev := flags.Bool("dev", devDefault, "dev mode: generated JWT secret, memory storage, admin token printed to stdout; defaults to $ROOT_DEV")
+	devSeed := flags.Bool("dev-seed", true, "in dev mode, load example services and a session")
+	printConfig := flags.Bool("print-config", false, "print the effective configuration as JSON, secrets redacted, and exit")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if *dev && *configPath == "" && errors.Is(err, fs.ErrNotExist) {
+		cfg, err = bootstrap.DevConfig(), nil
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "load config: %v\n", err)
+		return exitFailure
+	}
+	if *dev {
+		if err := bootstrap.ApplyDevMode(cfg); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return exitFailure
+		}
+	}
+	if *printConfig {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cfg.Redacted()); err != nil {
+			fmt.Fprintf(stderr, "print config: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	var log logger.ILogger = logger.NewLogger(logger.Config{
+		Level:          cfg.Log.Level,
+		Format:         cfg.Log.Format,
+		SensitiveKeys:  cfg.Log.RedactKeys,
+		MaxValueLength: cfg.Log.MaxFieldLength,
+	})
+	if *dev {
+		log = log.With("mode", "dev")
+		log.Warn("DEV MODE: not for production; storage is in memory and the JWT secret and bootstrap api key are generated for this run",
+			"jwt_secret", cfg.JWT.Secret, "bootstrap_api_key", cfg.Auth.BootstrapAPIKey)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := bootstrap.NewApplication(ctx, cfg, log)
+	if err != nil {
+		log.Error("failed to initialize application", "error", err)
+		return exitFailure
+	}
+
+	if *dev {
+		if err := startDevMode(ctx, app, *devSeed, stdout, log); err != nil {
+			log.Error("failed to start dev mode", "error", err)
+			app.Stop(context.Background())
+			return exitFailure
+		}
+	}
+
+	// Dev mode generated its secret; the configuration has nothing to reload
+	if !*dev {
+		go reloadOnHangup(ctx, app, *configPath, log)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- app.Start()
+	}()
+
+	exitCode := exitOK
+	select {
+	case err := <-errChan:
+		if err != nil {
+			log.Error("server error", "error", err)
+			exitCode = exitFailure
+		}
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		log.Error("shutdown incomplete", "error", err)
+		exitCode = exitFailure
+	}
+	log.Info("server stopped")
+
+	return exitCode
+}
+
+// reloadOnHangup reloads the configuration on every SIGHUP until ctx is done
+// and switches to its JWT secrets. A configuration that fails to load or
+// whose secrets are refused is logged and the secrets in use are kept.
+func reloadOnHangup(ctx context.Context, app *bootstrap.Application, configPath string, log logger.ILogger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			log.Error("reload config failed", "error", err)
+			continue
+		}
+		if err := app.ReloadJWTSecrets(cfg.JWT); err != nil {
+			log.Error("reload jwt secrets failed", "error", err)
+		}
+	}
+}
+
+// startDevMode optionally seeds example data and prints an admin token to stdout
+func startDevMode(ctx context.Context, app *bootstrap.Application, seed bool, stdout io.Writer, log logger.ILogger) error {
+	if seed {
+		if err := app.SeedDevData(ctx); err != nil {
+			return err
+		}
+	}
+
+	resp, err := app.IssueDevToken(ctx)
+	if err != nil {
+		return fmt.Errorf("issue dev token: %w", err)
+	}
+	fmt.Fprintln(stdout, resp.Token)
+	log.Warn("DEV MODE: admin token printed to stdout", "expires_at", resp.ExpiresAt.UTC().Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/internal/bootstrap"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// defaultCLITokenTTL is used when neither --ttl nor jwt.access_token_ttl is set
+const defaultCLITokenTTL = 15 * time.Minute
+
+// cliIssuer is recorded as issued_by in the metadata of tokens signed locally
+const cliIssuer = "root-cli"
+
+// tokenIssue signs an access token with the configured JWT secret and prints
+// it, so operators can mint the first admin token without a running server
+func tokenIssue(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("token issue", stderr)
+	configPath := fs.String("config", "", "configuration file holding the JWT secret")
+	subject := fs.String("subject", "", "token subject (required)")
+	roles := fs.String("roles", "", "comma-separated roles, e.g. admin")
+	tenantID := fs.String("tenant", "", "tenant the token is confined to")
+	ttl := fs.Duration("ttl", 0, "token lifetime; defaults to jwt.access_token_ttl")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *subject == "" || fs.NArg() > 0 || *ttl < 0 {
+		fmt.Fprintln(stderr, "usage: root token issue --subject S [--roles R,...] [--tenant T] [--ttl D] [--config path]")
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "load config: %v\n", err)
+		return exitFailure
+	}
+	if secret := cfg.JWT.Secret; len(cfg.JWT.Secrets) == 0 && (secret == "" || strings.HasPrefix(secret, "${")) {
+		fmt.Fprintln(stderr, "jwt.secret is not set; set it in the configuration or with JWT_SECRET")
+		return exitFailure
+	}
+	if *ttl == 0 {
+		*ttl = time.Duration(cfg.JWT.AccessTokenTTL) * time.Minute
+	}
+	if *ttl == 0 {
+		*ttl = defaultCLITokenTTL
+	}
+
+	manager, err := bootstrap.NewJWTManager(cfg.JWT, nil)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	issuer := auth.NewService(manager, nil, auth.Config{AccessTokenTTL: *ttl, RefreshTokenTTL: *ttl}, logger.NewNop())
+
+	// Without caller claims in the context the auth service applies no issuance policy
+	resp, err := issuer.IssueToken(context.Background(), auth.IssueTokenRequest{
+		Subject:  *subject,
+		Roles:    splitList(*roles),
+		Tenant:   *tenantID,
+		Metadata: map[string]any{token.MetadataIssuedBy: cliIssuer},
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "issue token: %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Fprintln(stdout, resp.Token)
+	fmt.Fprintf(stderr, "token for %s expires at %s\n", *subject, resp.ExpiresAt.UTC().Format(time.RFC3339))
+	return exitOK
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -3,16 +3,18 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 
 	"github.com/aq189/bin/pkg/rootclient"
 )
 
 func main() {
-	// Initialize Root Server client
+	// Initialize Root Server client with an admin API key, such as the
+	// bootstrap key logged by serve --dev
 	client := rootclient.New(rootclient.Config{
 		BaseURL: "http://localhost:8080",
-		APIKey:  "development-api-key",
+		APIKey:  os.Getenv("ROOT_API_KEY"),
 		Timeout: 10 * time.Second,
 	})
 
@@ -24,7 +26,7 @@ func main() {
 		ID:           "example-svc-1",
 		Name:         "example-service",
 		Version:      "1.0.0",
-		Endpoints:    []string{"http://localhost:9090"},
+		Endpoints:    []rootclient.Endpoint{{URL: "http://localhost:9090", Weight: 1}},
 		Capabilities: []string{"example", "demo"},
 		Metadata: map[string]string{
 			"environment": "development",
@@ -75,6 +77,9 @@ func main() {
 	log.Printf("Found %d services with 'example' capability\n", len(services))
 	for _, svc := range services {
 		log.Printf("  - %s v%s (%s)\n", svc.Name, svc.Version, svc.Status)
+		if endpoint, ok := svc.PickEndpoint(); ok {
+			log.Printf("    picked endpoint %s (weight %d)\n", endpoint.URL, endpoint.Weight)
+		}
 	}
 
 	// Example 5: Send heartbeat
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aq189/bin/pkg/rootclient"
+	"github.com/aq189/bin/pkg/roottest"
+)
+
+// Example_fakeServer runs the client calls from main against an in-process
+// fake server instead of a real deployment
+func Example_fakeServer() {
+	fake := roottest.NewFakeServer()
+	defer fake.Close()
+
+	client := fake.Client()
+	ctx := context.Background()
+
+	service, err := client.Registry().Register(ctx, rootclient.RegisterRequest{
+		ID:           "example-svc-1",
+		Name:         "example-service",
+		Version:      "1.0.0",
+		Endpoints:    []rootclient.Endpoint{{URL: "http://localhost:9090", Weight: 1}},
+		Capabilities: []string{"example", "demo"},
+	})
+	if err != nil {
+		fmt.Println("register:", err)
+		return
+	}
+	fmt.Println("registered", service.ID)
+
+	session, err := client.Session().Create(ctx, rootclient.CreateSessionRequest{
+		UserID:    "user-123",
+		ServiceID: service.ID,
+		Data:      map[string]any{"theme": "dark"},
+		TTL:       60,
+	})
+	if err != nil {
+		fmt.Println("create session:", err)
+		return
+	}
+
+	// Move the fake's clock past the TTL rather than waiting an hour
+	fake.Clock.Advance(time.Hour)
+	valid, _, err := client.Session().Validate(ctx, session.ID)
+	if err != nil {
+		fmt.Println("validate session:", err)
+		return
+	}
+	fmt.Println("session valid after an hour:", valid)
+
+	fmt.Println("services in the fake:", len(fake.Services()))
+
+	// Output:
+	// registered example-svc-1
+	// session valid after an hour: false
+	// services in the fake: 1
+}
+
+// Example_failNext shows how client code can be tested against server errors
+func Example_failNext() {
+	fake := roottest.NewFakeServer()
+	defer fake.Close()
+
+	fake.FailNext("PUT /registry/heartbeat/", http.StatusServiceUnavailable)
+
+	err := fake.Client().Registry().Heartbeat(context.Background(), "example-svc-1")
+	var retryable *rootclient.RetryableError
+	fmt.Println("retryable:", errors.As(err, &retryable))
+
+	// Output:
+	// retryable: true
+}
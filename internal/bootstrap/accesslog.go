@@ -0,0 +1,33 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// openAccessLog opens the writer configured as the access log output: stdout,
+// stderr or a file appended to, which is closed on Stop. It returns nil when
+// no output is configured.
+func (a *Application) openAccessLog() (io.Writer, error) {
+	switch output := a.config.Log.HTTP.Output; output {
+	case "":
+		return nil, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+			return nil, fmt.Errorf("create access log directory: %w", err)
+		}
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("open access log: %w", err)
+		}
+		a.addCleanup("access log", func(context.Context) error { return file.Close() })
+		return file, nil
+	}
+}
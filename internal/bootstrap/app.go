@@ -1 +1,252 @@
 package bootstrap
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/audit"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/idempotency"
+	"github.com/aq189/bin/internal/domain/quota"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/server"
+	auditsvc "github.com/aq189/bin/internal/service/audit"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/dns"
+	"github.com/aq189/bin/internal/service/maintenance"
+	"github.com/aq189/bin/internal/service/registry"
+	sessionsvc "github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/internal/service/webhook"
+	"github.com/aq189/bin/pkg/buildinfo"
+	"github.com/aq189/bin/pkg/logger"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Application wires together configuration, storage, services and the HTTP server
+type Application struct {
+	config    *config.Config
+	logger    logger.ILogger
+	startedAt time.Time   // reported as uptime by the health endpoints
+	clock     clock.Clock // nil uses the system clock
+
+	sessionRepo  session.SessionRepository
+	registryRepo service.RegistryRepository
+	configRepo   config.ConfigRepository
+	apiKeyRepo   apikey.APIKeyRepository
+	quotaStore   quota.QuotaStore      // nil when token issuance isn't capped
+	auditRepo    audit.AuditRepository // nil when auditing is disabled
+
+	idempotencyStore idempotency.IdempotencyStore
+	eventBus         event.Bus // shares registry events with other instances
+
+	authService     *auth.Service
+	registryService *registry.Service
+	sessionService  *sessionsvc.Service
+	webhookService  *webhook.Service // nil when webhooks are disabled
+	// sessionCallbacks is nil when session callbacks are disabled
+	sessionCallbacks *webhook.Callbacks
+	dnsServer        *dns.Server       // nil when the DNS server is disabled
+	auditService     *auditsvc.Service // nil when auditing is disabled
+	// maintenanceService rejects writes while the server is read-only
+	maintenanceService *maintenance.Service
+
+	server         *server.Server
+	tracerProvider trace.TracerProvider // nil when tracing is disabled
+	meterProvider  metric.MeterProvider // nil when metrics are disabled
+
+	backends   map[string]string // storage backend in use, by component
+	middleware []string          // global middleware names, outermost first
+
+	// streams and eventStream are shared by every streaming route
+	streams     *middleware.StreamLimiter
+	eventStream server.EventStreamConfig
+	inFlight    *middleware.InFlight // requests being served, reported on Stop
+
+	connections    *connections
+	cleanup        []cleanupStep
+	cleanupTimeout time.Duration // per cleanup step, 0 uses defaultCleanupTimeout
+}
+
+// Option customizes an Application beyond what configuration covers
+type Option func(*Application)
+
+// WithClock makes the services read the time from c instead of the system clock
+func WithClock(c clock.Clock) Option {
+	return func(a *Application) {
+		a.clock = c
+	}
+}
+
+// NewApplication builds the application from configuration
+func NewApplication(ctx context.Context, cfg *config.Config, log logger.ILogger, opts ...Option) (*Application, error) {
+	app := &Application{
+		config:    cfg,
+		logger:    log,
+		startedAt: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+
+	if err := app.preflight(); err != nil {
+		return nil, err
+	}
+
+	if err := app.initTracing(ctx); err != nil {
+		app.Stop(ctx)
+		return nil, fmt.Errorf("init tracing: %w", err)
+	}
+
+	if err := app.initMetrics(ctx); err != nil {
+		app.Stop(ctx)
+		return nil, fmt.Errorf("init metrics: %w", err)
+	}
+
+	if err := app.initRepositories(ctx); err != nil {
+		app.Stop(ctx)
+		return nil, fmt.Errorf("init repositories: %w", err)
+	}
+
+	if err := app.initServices(ctx); err != nil {
+		app.Stop(ctx)
+		return nil, fmt.Errorf("init services: %w", err)
+	}
+
+	if err := app.initServer(); err != nil {
+		app.Stop(ctx)
+		return nil, fmt.Errorf("init server: %w", err)
+	}
+
+	return app, nil
+}
+
+// Start serves HTTP requests until Stop is called.
+// It returns nil after a graceful shutdown. Once the server is bound, the
+// startup summary is logged.
+func (a *Application) Start() error {
+	info := buildinfo.Get()
+	a.logger.Info("starting server", "addr", a.config.Server.Addr, "listener", cmp.Or(a.config.Server.Listener.Mode, config.ListenerTCP),
+		"tls", a.config.Server.TLS.Enabled,
+		"version", info.Version, "commit", info.Commit, "build_date", info.Date)
+
+	returned := make(chan struct{})
+	defer close(returned)
+	go func() {
+		select {
+		case <-a.server.Ready():
+			if a.server.ListenErr() == nil {
+				a.logStartupSummary()
+			}
+		case <-returned:
+		}
+	}()
+	return a.server.Start()
+}
+
+// Ready returns a channel that is closed once the server accepts connections,
+// or failed to bind; ListenErr reports which
+func (a *Application) Ready() <-chan struct{} {
+	return a.server.Ready()
+}
+
+// ListenErr returns the error the server failed to bind with, if any
+func (a *Application) ListenErr() error {
+	return a.server.ListenErr()
+}
+
+// Addr returns the address the server is bound to
+func (a *Application) Addr() string {
+	return a.server.Addr()
+}
+
+// Handler returns the handler serving every route with its middleware, so the
+// application can be served in-process without Start
+func (a *Application) Handler() http.Handler {
+	return a.server.Handler()
+}
+
+// RegistryService returns the service registry
+func (a *Application) RegistryService() *registry.Service {
+	return a.registryService
+}
+
+// SessionService returns the session service
+func (a *Application) SessionService() *sessionsvc.Service {
+	return a.sessionService
+}
+
+// SessionRepository returns the repository sessions are stored in
+func (a *Application) SessionRepository() session.SessionRepository {
+	return a.sessionRepo
+}
+
+// Stop shuts down the HTTP server, giving requests in flight until ctx is
+// done, or server.shutdown_grace when ctx has no deadline, to finish, then
+// releases all other resources in reverse order of acquisition. Each cleanup
+// step is bounded by the cleanup timeout and by ctx; steps run even when
+// earlier ones fail or time out. Stop returns every failure joined into one
+// error.
+func (a *Application) Stop(ctx context.Context) error {
+	start := time.Now()
+	var errs []error
+	durations := make(map[string]string, len(a.cleanup)+1)
+
+	if a.server != nil {
+		stepStart := time.Now()
+		if err := a.shutdownServer(ctx); err != nil {
+			a.logger.Error("server shutdown failed", "error", err)
+			errs = append(errs, fmt.Errorf("http server: %w", err))
+		}
+		durations["http server"] = time.Since(stepStart).String()
+	}
+
+	timeout := a.cleanupTimeout
+	if timeout <= 0 {
+		timeout = defaultCleanupTimeout
+	}
+	for i := len(a.cleanup) - 1; i >= 0; i-- {
+		step := a.cleanup[i]
+		stepStart := time.Now()
+		if err := runStep(ctx, timeout, step.name, step.fn); err != nil {
+			a.logger.Error("cleanup failed", "component", step.name, "error", err)
+			errs = append(errs, err)
+		}
+		durations[step.name] = time.Since(stepStart).String()
+	}
+	a.cleanup = nil
+
+	a.logger.Info("shutdown complete", "duration", time.Since(start).String(), "failures", len(errs), "components", durations)
+	return errors.Join(errs...)
+}
+
+// shutdownServer drains the HTTP server: requests arriving from now on are
+// told to close their connection, and those in flight get until the server's
+// Shutdown gives up to finish. Connections still busy then are dropped.
+func (a *Application) shutdownServer(ctx context.Context) error {
+	a.inFlight.Drain()
+	if n := a.inFlight.Count(); n > 0 {
+		a.logger.Info("waiting for in-flight requests", "in_flight", n, "routes", a.inFlight.Routes())
+	}
+
+	err := a.server.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+	a.logger.Warn("shutdown grace expired, closing connections", "in_flight", a.inFlight.Count(), "routes", a.inFlight.Routes())
+	return errors.Join(err, a.server.Close())
+}
+
+// addCleanup registers a named function to run on Stop
+func (a *Application) addCleanup(name string, fn func(ctx context.Context) error) {
+	a.cleanup = append(a.cleanup, cleanupStep{name: name, fn: fn})
+}
@@ -0,0 +1,2346 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/eventbus"
+	"github.com/aq189/bin/internal/handler"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/registry"
+	sessionsvc "github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/internal/service/webhook"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/rootclient"
+)
+
+// recordingLogger captures log entries so tests can assert on warnings
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields []any
+}
+
+func (l *recordingLogger) log(level, msg string, fields []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...any) { l.log("debug", msg, fields) }
+func (l *recordingLogger) Info(msg string, fields ...any)  { l.log("info", msg, fields) }
+func (l *recordingLogger) Warn(msg string, fields ...any)  { l.log("warn", msg, fields) }
+func (l *recordingLogger) Error(msg string, fields ...any) { l.log("error", msg, fields) }
+func (l *recordingLogger) With(fields ...any) logger.ILogger {
+	return l
+}
+
+func (l *recordingLogger) count(level string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, e := range l.entries {
+		if e.level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// testJWTSecret is long enough to pass preflight
+const testJWTSecret = "bootstrap-test-jwt-secret-0123456789"
+
+func loadFixture(t *testing.T, name string) *config.Config {
+	t.Helper()
+
+	cfg, err := config.LoadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("load fixture %s: %v", name, err)
+	}
+	// The fixtures only describe storage; fill in what preflight requires
+	cfg.JWT.Secret = testJWTSecret
+	if cfg.Server.Addr == "" {
+		cfg.Server.Addr = "127.0.0.1:0"
+	}
+	return cfg
+}
+
+// unwrapSessions returns the session repository the application
+// instruments, failing the test when repo isn't instrumented
+func unwrapSessions(t *testing.T, repo session.SessionRepository) session.SessionRepository {
+	t.Helper()
+	instrumented, ok := repo.(interface {
+		Unwrap() session.SessionRepository
+	})
+	if !ok {
+		t.Fatalf("expected an instrumented session repository, got %T", repo)
+	}
+	return instrumented.Unwrap()
+}
+
+// unwrapRegistry returns the registry repository the application
+// instruments, failing the test when repo isn't instrumented
+func unwrapRegistry(t *testing.T, repo service.RegistryRepository) service.RegistryRepository {
+	t.Helper()
+	instrumented, ok := repo.(interface {
+		Unwrap() service.RegistryRepository
+	})
+	if !ok {
+		t.Fatalf("expected an instrumented registry repository, got %T", repo)
+	}
+	return instrumented.Unwrap()
+}
+
+func TestInitRepositories(t *testing.T) {
+	tests := []struct {
+		name      string
+		fixture   string
+		wantErr   error
+		wantWarns int
+	}{
+		{name: "explicit memory per component", fixture: "storage_memory.json"},
+		{name: "shared type inherited by every component", fixture: "storage_shared_type.json"},
+		{name: "nothing configured falls back to memory", fixture: "storage_unset.json", wantWarns: 6},
+		{name: "unset components fall back to memory", fixture: "storage_partial.json", wantWarns: 5},
+		{name: "config on postgres is not supported", fixture: "storage_config_postgres.json", wantErr: ErrUnsupportedBackend},
+		{name: "config on redis is not supported", fixture: "storage_config_redis.json", wantErr: ErrUnsupportedBackend},
+		{name: "api keys on redis are not supported", fixture: "storage_apikeys_redis.json", wantErr: ErrUnsupportedBackend},
+		{name: "unknown backend type", fixture: "storage_unknown.json", wantErr: ErrUnknownBackend},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &recordingLogger{}
+			app := &Application{config: loadFixture(t, tt.fixture), logger: log}
+
+			err := app.initRepositories(context.Background())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if _, ok := unwrapSessions(t, app.sessionRepo).(*memory.SessionRepository); !ok {
+				t.Errorf("expected memory session repository, got %T", unwrapSessions(t, app.sessionRepo))
+			}
+			if _, ok := unwrapRegistry(t, app.registryRepo).(*memory.RegistryRepository); !ok {
+				t.Errorf("expected memory registry repository, got %T", unwrapRegistry(t, app.registryRepo))
+			}
+			if _, ok := app.configRepo.(*memory.ConfigRepository); !ok {
+				t.Errorf("expected memory config repository, got %T", app.configRepo)
+			}
+			if _, ok := app.apiKeyRepo.(*memory.APIKeyRepository); !ok {
+				t.Errorf("expected memory api key repository, got %T", app.apiKeyRepo)
+			}
+			if _, ok := app.idempotencyStore.(*memory.IdempotencyStore); !ok {
+				t.Errorf("expected memory idempotency store, got %T", app.idempotencyStore)
+			}
+			if _, ok := app.eventBus.(*eventbus.Local); !ok {
+				t.Errorf("expected the in-process event bus, got %T", app.eventBus)
+			}
+
+			if got := log.count("warn"); got != tt.wantWarns {
+				t.Errorf("expected %d warnings, got %d", tt.wantWarns, got)
+			}
+		})
+	}
+}
+
+func TestNewApplication_FailsFastOnUnsupportedBackend(t *testing.T) {
+	cfg := loadFixture(t, "storage_config_redis.json")
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if app != nil {
+		t.Error("expected no application on error")
+	}
+	if !errors.Is(err, ErrUnsupportedBackend) {
+		t.Errorf("expected ErrUnsupportedBackend, got %v", err)
+	}
+}
+
+func TestApplication_StartAndStop(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+
+	log := &recordingLogger{}
+	app, err := NewApplication(context.Background(), cfg, log)
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- app.Start()
+	}()
+
+	select {
+	case <-app.Ready():
+		if err := app.ListenErr(); err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+	case err := <-errChan:
+		t.Fatalf("start failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("application did not become ready")
+	}
+
+	resp, err := http.Get("http://" + app.Addr() + "/health")
+	if err != nil {
+		t.Fatalf("health request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected health 200, got %d", resp.StatusCode)
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+
+	if n := log.count("error"); n != 0 {
+		t.Errorf("expected no error logs on clean shutdown, got %d", n)
+	}
+}
+
+func TestApplication_StartupSummary(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.JWT.Secret = testJWTSecret
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Server.UI.Enabled = true
+
+	log := &recordingLogger{}
+	app, err := NewApplication(context.Background(), cfg, log)
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+	go app.Start()
+	<-app.Ready()
+
+	var summaries []logEntry
+	deadline := time.Now().Add(5 * time.Second)
+	for len(summaries) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		log.mu.Lock()
+		for _, e := range log.entries {
+			if e.msg == "startup summary" {
+				summaries = append(summaries, e)
+			}
+		}
+		log.mu.Unlock()
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("expected one startup summary, got %d", len(summaries))
+	}
+
+	fields := make(map[string]any)
+	for i := 0; i+1 < len(summaries[0].fields); i += 2 {
+		fields[summaries[0].fields[i].(string)] = summaries[0].fields[i+1]
+	}
+	if fields["addr"] != app.Addr() {
+		t.Errorf("expected the bound address %s, got %v", app.Addr(), fields["addr"])
+	}
+	if backends := fields["storage"].(map[string]string); backends["sessions"] != config.StorageMemory || backends["events"] != config.StorageMemory {
+		t.Errorf("expected the storage backends, got %v", backends)
+	}
+	if middlewares := fields["middleware"].([]string); !slices.Contains(middlewares, "request_id") {
+		t.Errorf("expected the middleware names, got %v", middlewares)
+	}
+	if features := fields["features"].([]string); !slices.Contains(features, "dashboard") {
+		t.Errorf("expected the dashboard among the features, got %v", features)
+	}
+	logged := fields["config"].(*config.Config)
+	if logged.JWT.Secret == testJWTSecret || logged.Auth.BootstrapAPIKey == "rk_test_admin" {
+		t.Errorf("expected secrets redacted, got %q and %q", logged.JWT.Secret, logged.Auth.BootstrapAPIKey)
+	}
+}
+
+func TestApplication_StopDrainsInFlight(t *testing.T) {
+	tests := []struct {
+		name          string
+		grace         int    // server.shutdown_grace in seconds
+		wait          string // how long the long poll in flight is held
+		wantForced    bool
+		wantPollError bool
+	}{
+		{name: "long poll ends within the grace", grace: 5, wait: "500ms"},
+		{name: "grace expires", grace: 1, wait: "30s", wantForced: true, wantPollError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadFixture(t, "storage_memory.json")
+			cfg.Server.Addr = "127.0.0.1:0"
+			cfg.Server.ShutdownGrace = tt.grace
+			cfg.JWT.Secret = testJWTSecret
+			cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+			log := &recordingLogger{}
+			app, err := NewApplication(context.Background(), cfg, log)
+			if err != nil {
+				t.Fatalf("new application: %v", err)
+			}
+			go app.Start()
+			<-app.Ready()
+
+			revision, err := app.registryService.Revision(context.Background())
+			if err != nil {
+				t.Fatalf("revision: %v", err)
+			}
+			pollErr := make(chan error, 1)
+			go func() {
+				target := fmt.Sprintf("http://%s/v1/registry/discover?wait=%s&revision=%d", app.Addr(), tt.wait, revision)
+				req, _ := http.NewRequest(http.MethodGet, target, nil)
+				req.Header.Set("Authorization", "Bearer rk_test_admin")
+				resp, err := http.DefaultClient.Do(req)
+				if err == nil {
+					if resp.StatusCode != http.StatusNotModified {
+						err = fmt.Errorf("status %d", resp.StatusCode)
+					}
+					resp.Body.Close()
+				}
+				pollErr <- err
+			}()
+			deadline := time.Now().Add(5 * time.Second)
+			for app.inFlight.Count() == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			stopErr := app.Stop(context.Background())
+			if tt.wantForced != (stopErr != nil) {
+				t.Errorf("expected a forced close %v, got %v", tt.wantForced, stopErr)
+			}
+			if err := <-pollErr; tt.wantPollError != (err != nil) {
+				t.Errorf("expected the long poll to fail %v, got %v", tt.wantPollError, err)
+			}
+
+			var waiting, forced *logEntry
+			log.mu.Lock()
+			for i, e := range log.entries {
+				switch e.msg {
+				case "waiting for in-flight requests":
+					waiting = &log.entries[i]
+				case "shutdown grace expired, closing connections":
+					forced = &log.entries[i]
+				}
+			}
+			log.mu.Unlock()
+			if waiting == nil || waiting.fields[1] != 1 {
+				t.Fatalf("expected one request waited for, got %v", waiting)
+			}
+			if tt.wantForced != (forced != nil) {
+				t.Fatalf("expected the grace to expire %v, got %v", tt.wantForced, forced)
+			}
+			if forced != nil {
+				if routes := forced.fields[3].(map[string]int); routes["GET /v1/registry/discover"] != 1 {
+					t.Errorf("expected the long poll among the routes, got %v", routes)
+				}
+			}
+		})
+	}
+}
+
+func TestApplication_StopAggregatesCleanupErrors(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+
+	log := &recordingLogger{}
+	app, err := NewApplication(context.Background(), cfg, log)
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	app.cleanupTimeout = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	var ran []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, name)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	errClose := errors.New("close failed")
+
+	app.addCleanup("first", func(context.Context) error {
+		record("first")
+		return nil
+	})
+	app.addCleanup("hung", func(context.Context) error {
+		record("hung")
+		<-release // ignores its context like a pool waiting on a checkout
+		return nil
+	})
+	app.addCleanup("broken", func(context.Context) error {
+		record("broken")
+		return errClose
+	})
+
+	start := time.Now()
+	err = app.Stop(context.Background())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected a hung cleanup to be abandoned, stop took %v", elapsed)
+	}
+
+	if !errors.Is(err, errClose) {
+		t.Errorf("expected the failed cleanup in the error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "hung") {
+		t.Errorf("expected the hung cleanup to time out, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"broken", "hung", "first"}; !slices.Equal(ran, want) {
+		t.Errorf("expected cleanups in reverse order %v, got %v", want, ran)
+	}
+	if n := log.count("error"); n != 2 {
+		t.Errorf("expected one error log per failed cleanup, got %d", n)
+	}
+}
+
+func TestApplication_MemorySnapshotSurvivesRestart(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Storage.Memory.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+
+	do := func(app *Application, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	first, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	rec := do(first, http.MethodPost, "/session", `{"user_id":"user-1","service_id":"web"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if err := first.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	second, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	defer second.Stop(context.Background())
+
+	if rec := do(second, http.MethodGet, "/session/"+created.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected session to survive the restart, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestApplication_HealthReportsBuildInfo(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	get := func(t *testing.T, path string) map[string]any {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", path, rec.Code, rec.Body)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode: %v", path, err)
+		}
+		return body
+	}
+
+	for path, status := range map[string]string{"/health": "ok", "/ready": "ready"} {
+		t.Run(path, func(t *testing.T) {
+			first := get(t, path)
+			if first["status"] != status || first["version"] != "dev" || first["commit"] != "unknown" {
+				t.Errorf("expected status %q with default build info, got %v", status, first)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			second := get(t, path)
+			before, _ := first["uptime_seconds"].(float64)
+			after, _ := second["uptime_seconds"].(float64)
+			if after <= before {
+				t.Errorf("expected uptime to increase, got %v then %v", before, after)
+			}
+		})
+	}
+
+	t.Run("version is public", func(t *testing.T) {
+		body := get(t, "/version")
+		for _, field := range []string{"version", "commit", "build_date"} {
+			if _, ok := body[field]; !ok {
+				t.Errorf("expected field %q, got %v", field, body)
+			}
+		}
+	})
+}
+
+func TestApplication_AccessLogFile(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Log.HTTP = config.HTTPLogConfig{Format: config.AccessLogCombined, Output: filepath.Join(t.TempDir(), "logs", "access.log")}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set("User-Agent", "probe/1.0")
+	app.server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.Log.HTTP.Output)
+	if err != nil {
+		t.Fatalf("read access log: %v", err)
+	}
+	want := regexp.MustCompile(`^192\.0\.2\.0 - - \[[^]]+\] "GET /version HTTP/1\.1" 200 \d+ "-" "probe/1\.0"\n$`)
+	if !want.Match(data) {
+		t.Errorf("unexpected access log %q", data)
+	}
+}
+
+func TestApplication_ReadyReportsTokenCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheSize int
+		wantCache bool
+	}{
+		{name: "enabled", cacheSize: 100, wantCache: true},
+		{name: "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadFixture(t, "storage_memory.json")
+			cfg.Server.Addr = "127.0.0.1:0"
+			cfg.JWT.Secret = testJWTSecret
+			cfg.JWT.AccessTokenTTL = 15
+			cfg.Auth.TokenCacheSize = tt.cacheSize
+
+			app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+			if err != nil {
+				t.Fatalf("new application: %v", err)
+			}
+			defer app.Stop(context.Background())
+
+			resp, _ := app.authService.IssueToken(context.Background(), auth.IssueTokenRequest{Subject: "user-1"})
+			for range 2 {
+				app.authService.ValidateToken(context.Background(), resp.Token)
+			}
+
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			var body struct {
+				TokenCache *auth.CacheStats `json:"token_cache"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+
+			if !tt.wantCache {
+				if body.TokenCache != nil {
+					t.Errorf("expected no token cache stats, got %+v", body.TokenCache)
+				}
+				return
+			}
+			if body.TokenCache == nil || *body.TokenCache != (auth.CacheStats{Entries: 1, Capacity: 100, Hits: 1, Misses: 1}) {
+				t.Errorf("unexpected token cache stats %+v", body.TokenCache)
+			}
+		})
+	}
+}
+
+func TestApplication_SessionCleanupEndpoint(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	reader, err := app.authService.CreateAPIKey(context.Background(), auth.CreateAPIKeyRequest{Name: "reader", Roles: []string{"reader"}})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+	}{
+		{name: "unauthenticated", wantStatus: http.StatusUnauthorized},
+		{name: "non-admin key", key: reader.Key, wantStatus: http.StatusForbidden},
+		{name: "admin key", key: "rk_test_admin", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/sessions/cleanup", nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus == http.StatusOK && strings.TrimSpace(rec.Body.String()) != `{"deleted":0}` {
+				t.Errorf("expected deleted count, got %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestApplication_StatsEndpoint(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, apiPrefix+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s: expected success, got %d: %s", method, path, rec.Code, rec.Body)
+		}
+		return rec
+	}
+	serve(http.MethodPost, "/session", `{"user_id":"user-1","service_id":"web"}`)
+	serve(http.MethodPost, "/session", `{"user_id":"user-2","service_id":"web"}`)
+	serve(http.MethodPost, "/auth/token", `{"subject":"user-1"}`)
+	serve(http.MethodPost, "/registry/register", `{"id":"payment-1","name":"payment","endpoints":[{"url":"http://payment-1:8080"}]}`)
+
+	rec := serve(http.MethodGet, "/admin/stats", "")
+	var body struct {
+		UptimeSeconds float64 `json:"uptime_seconds"`
+		Sessions      struct {
+			Active          *int  `json:"active"`
+			CreatedLastHour int64 `json:"created_last_hour"`
+		} `json:"sessions"`
+		Services struct {
+			Total              int            `json:"total"`
+			ByStatus           map[string]int `json:"by_status"`
+			RegisteredLastHour int64          `json:"registered_last_hour"`
+		} `json:"services"`
+		Tokens struct {
+			IssuedLastHour int64 `json:"issued_last_hour"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Sessions.Active == nil || *body.Sessions.Active != 2 || body.Sessions.CreatedLastHour != 2 {
+		t.Errorf("expected 2 active and created sessions, got %s", rec.Body)
+	}
+	if body.Services.Total != 1 || body.Services.ByStatus["healthy"] != 1 || body.Services.RegisteredLastHour != 1 {
+		t.Errorf("expected 1 healthy registered service, got %s", rec.Body)
+	}
+	if body.Tokens.IssuedLastHour != 1 {
+		t.Errorf("expected 1 issued token, got %s", rec.Body)
+	}
+	if body.UptimeSeconds <= 0 {
+		t.Errorf("expected a positive uptime, got %s", rec.Body)
+	}
+}
+
+func TestApplication_RoutesRequireAuthentication(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	routes := []struct{ method, path string }{
+		{http.MethodPost, "/auth/token"},
+		{http.MethodPost, "/auth/validate"},
+		{http.MethodPost, "/auth/revoke"},
+		{http.MethodGet, "/auth/quota"},
+		{http.MethodPost, "/auth/apikeys"},
+		{http.MethodDelete, "/auth/apikeys/key-1"},
+		{http.MethodPost, "/session"},
+		{http.MethodPost, "/session/get-or-create"},
+		{http.MethodGet, "/session"},
+		{http.MethodGet, "/session/sess-1"},
+		{http.MethodHead, "/session/sess-1"},
+		{http.MethodPut, "/session/sess-1"},
+		{http.MethodDelete, "/session/sess-1"},
+		{http.MethodPost, "/admin/sessions/cleanup"},
+		{http.MethodPost, "/registry/register"},
+		{http.MethodDelete, "/registry/deregister/svc-1"},
+		{http.MethodGet, "/registry/services"},
+		{http.MethodGet, "/registry/services/svc-1"},
+		{http.MethodGet, "/registry/discover"},
+		{http.MethodGet, "/registry/graph"},
+		{http.MethodGet, "/registry/impact/svc-1"},
+		{http.MethodPut, "/registry/heartbeat/svc-1"},
+		{http.MethodPut, "/registry/services/svc-1/status"},
+		{http.MethodPost, "/registry/services/svc-1/restore"},
+		{http.MethodGet, "/admin/registry/export"},
+		{http.MethodPost, "/admin/registry/import"},
+		{http.MethodGet, "/admin/registry/schemas"},
+		{http.MethodPut, "/admin/registry/schemas/payment"},
+		{http.MethodDelete, "/admin/registry/schemas/payment"},
+		{http.MethodGet, "/admin/maintenance"},
+		{http.MethodPost, "/admin/maintenance"},
+		{http.MethodGet, "/admin/stats"},
+	}
+
+	for _, prefix := range []string{apiPrefix, ""} {
+		for _, route := range routes {
+			t.Run(route.method+" "+prefix+route.path, func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				app.server.Handler().ServeHTTP(rec, httptest.NewRequest(route.method, prefix+route.path, nil))
+
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("expected status 401, got %d", rec.Code)
+				}
+			})
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, apiPrefix+"/auth/refresh", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected refresh to reach its handler without credentials, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestApplication_Dashboard(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	t.Run("disabled", func(t *testing.T) {
+		app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+		if err != nil {
+			t.Fatalf("new application: %v", err)
+		}
+		defer app.Stop(context.Background())
+
+		for _, route := range []struct{ method, path string }{
+			{http.MethodGet, "/ui"},
+			{http.MethodGet, "/ui/"},
+			{http.MethodGet, "/ui/login"},
+			{http.MethodPost, "/ui/login"},
+			{http.MethodGet, "/ui/style.css"},
+			{http.MethodGet, "/ui/services/payment-1"},
+		} {
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, httptest.NewRequest(route.method, route.path, nil))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s %s: expected 404, got %d", route.method, route.path, rec.Code)
+			}
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Server.UI.Enabled = true
+		app, err := NewApplication(context.Background(), &cfg, logger.NewNop())
+		if err != nil {
+			t.Fatalf("new application: %v", err)
+		}
+		defer app.Stop(context.Background())
+
+		req := httptest.NewRequest(http.MethodPost, apiPrefix+"/registry/register", strings.NewReader(`{"id":"payment-1","name":"payment","endpoints":[{"url":"http://payment-1:8080"}]}`))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		app.server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/ui/login" {
+			t.Fatalf("expected a redirect to the login form, got %d %q", rec.Code, rec.Header().Get("Location"))
+		}
+
+		req = httptest.NewRequest(http.MethodPost, "/ui/login", strings.NewReader("token=rk_test_admin"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec = httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		cookies := rec.Result().Cookies()
+		if rec.Code != http.StatusSeeOther || len(cookies) != 1 {
+			t.Fatalf("expected a cookie and a redirect, got %d %+v: %s", rec.Code, cookies, rec.Body)
+		}
+
+		for _, path := range []string{"/ui/", "/ui/services/payment-1"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.AddCookie(cookies[0])
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "payment-1") {
+				t.Errorf("%s: expected the page listing payment-1, got %d: %s", path, rec.Code, rec.Body)
+			}
+		}
+
+		for _, path := range []string{apiPrefix + "/ui/", "/ui/style.css"} {
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			want := http.StatusOK
+			if strings.HasPrefix(path, apiPrefix) {
+				want = http.StatusNotFound
+			}
+			if rec.Code != want {
+				t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+			}
+		}
+	})
+}
+
+func TestApplication_SetServiceStatusEndpoint(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	ctx := context.Background()
+	if _, _, err := app.registryService.Register(ctx, registry.RegisterRequest{
+		ID:        "payment-1",
+		Name:      "payment-service",
+		Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}},
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	reader, err := app.authService.CreateAPIKey(ctx, auth.CreateAPIKeyRequest{Name: "reader", Roles: []string{"reader"}})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "non-admin key", key: reader.Key, path: "/registry/services/payment-1/status", body: `{"status":"draining"}`, wantStatus: http.StatusForbidden},
+		{name: "invalid status", key: "rk_test_admin", path: "/registry/services/payment-1/status", body: `{"status":"unhealthy"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown service", key: "rk_test_admin", path: "/registry/services/missing/status", body: `{"status":"draining"}`, wantStatus: http.StatusNotFound},
+		{name: "unknown sub-resource", key: "rk_test_admin", path: "/registry/services/payment-1/other", body: `{"status":"draining"}`, wantStatus: http.StatusNotFound},
+		{name: "drain", key: "rk_test_admin", path: "/v1/registry/services/payment-1/status", body: `{"status":"draining"}`, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	discovered, _ := app.registryService.Discover(ctx, registry.DiscoverOptions{})
+	if len(discovered) != 0 {
+		t.Errorf("expected drained service to be hidden from discovery, got %d", len(discovered))
+	}
+}
+
+func TestApplication_DeregisterAndRestoreEndpoints(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	ctx := context.Background()
+	if _, _, err := app.registryService.Register(ctx, registry.RegisterRequest{
+		ID:        "payment-1",
+		Name:      "payment-service",
+		Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}},
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	reader, err := app.authService.CreateAPIKey(ctx, auth.CreateAPIKeyRequest{Name: "reader", Roles: []string{"reader"}})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	// Steps run in order, each against the state the previous ones left
+	steps := []struct {
+		name       string
+		key        string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "deregister", key: "rk_test_admin", method: http.MethodDelete, path: "/v1/registry/deregister/payment-1", wantStatus: http.StatusNoContent},
+		{name: "get deregistered", key: "rk_test_admin", method: http.MethodGet, path: "/v1/registry/services/payment-1", wantStatus: http.StatusNotFound},
+		{name: "heartbeat deregistered", key: "rk_test_admin", method: http.MethodPut, path: "/v1/registry/heartbeat/payment-1", wantStatus: http.StatusGone},
+		{name: "restore with non-admin key", key: reader.Key, method: http.MethodPost, path: "/v1/registry/services/payment-1/restore", wantStatus: http.StatusForbidden},
+		{name: "restore", key: "rk_test_admin", method: http.MethodPost, path: "/v1/registry/services/payment-1/restore", wantStatus: http.StatusOK},
+		{name: "restore registered", key: "rk_test_admin", method: http.MethodPost, path: "/v1/registry/services/payment-1/restore", wantStatus: http.StatusConflict},
+		{name: "heartbeat restored", key: "rk_test_admin", method: http.MethodPut, path: "/v1/registry/heartbeat/payment-1", wantStatus: http.StatusNoContent},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, nil)
+		req.Header.Set("Authorization", "Bearer "+step.key)
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.wantStatus, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestApplication_ScopedTokens(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.JWT.Secret = testJWTSecret
+	cfg.JWT.AccessTokenTTL = 15
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	ctx := context.Background()
+	for _, id := range []string{"payment-1", "payment-2"} {
+		if _, _, err := app.registryService.Register(ctx, registry.RegisterRequest{
+			ID:        id,
+			Name:      "payment-service",
+			Endpoints: []service.Endpoint{{URL: "http://" + id + ":8080"}},
+		}); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+	}
+	issue := func(req auth.IssueTokenRequest) string {
+		t.Helper()
+		resp, err := app.authService.IssueToken(ctx, req)
+		if err != nil {
+			t.Fatalf("issue token: %v", err)
+		}
+		return resp.Token
+	}
+	heartbeat := issue(auth.IssueTokenRequest{Subject: "payment-1", Scopes: []string{"registry:heartbeat:payment-1"}})
+	scopedAdmin := issue(auth.IssueTokenRequest{Subject: "ops", Roles: []string{token.RoleAdmin}, Scopes: []string{"session:read:*", "registry:heartbeat:*"}})
+	unscoped := issue(auth.IssueTokenRequest{Subject: "user-1"})
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "own heartbeat", token: heartbeat, method: http.MethodPut, path: "/v1/registry/heartbeat/payment-1", wantStatus: http.StatusNoContent},
+		{name: "own heartbeat at the root", token: heartbeat, method: http.MethodPut, path: "/registry/heartbeat/payment-1", wantStatus: http.StatusNoContent},
+		{name: "other heartbeat", token: heartbeat, method: http.MethodPut, path: "/v1/registry/heartbeat/payment-2", wantStatus: http.StatusForbidden},
+		{name: "heartbeat through a nested path", token: heartbeat, method: http.MethodPut, path: "/v1/registry/heartbeat/payment-1/payment-2", wantStatus: http.StatusNotFound},
+		{name: "route without scopes", token: heartbeat, method: http.MethodGet, path: "/v1/registry/services", wantStatus: http.StatusForbidden},
+		{name: "wildcard heartbeat", token: scopedAdmin, method: http.MethodPut, path: "/v1/registry/heartbeat/payment-2", wantStatus: http.StatusNoContent},
+		{name: "wildcard session read", token: scopedAdmin, method: http.MethodGet, path: "/v1/session/missing", wantStatus: http.StatusNotFound},
+		{name: "session write beyond scopes", token: scopedAdmin, method: http.MethodDelete, path: "/v1/session/missing", wantStatus: http.StatusForbidden},
+		{name: "session list beyond scopes", token: scopedAdmin, method: http.MethodGet, path: "/v1/session", wantStatus: http.StatusForbidden},
+		{name: "admin role limited by scopes", token: scopedAdmin, method: http.MethodPost, path: "/v1/registry/services/payment-1/restore", wantStatus: http.StatusForbidden},
+		{name: "unscoped token", token: unscoped, method: http.MethodPut, path: "/v1/registry/heartbeat/payment-2", wantStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestApplication_ListServicesPagination(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	ctx := context.Background()
+	for i := range 60 {
+		id := fmt.Sprintf("svc-%02d", i)
+		if _, _, err := app.registryService.Register(ctx, registry.RegisterRequest{
+			ID:        id,
+			Name:      "service",
+			Endpoints: []service.Endpoint{{URL: "http://" + id + ":8080"}},
+		}); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+	}
+
+	get := func(t *testing.T, path string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	type envelope struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+		Total      int  `json:"total"`
+		NextOffset *int `json:"next_offset"`
+	}
+
+	t.Run("defaults to 50 items", func(t *testing.T) {
+		rec := get(t, "/registry/services", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+
+		var page envelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(page.Items) != 50 || page.Total != 60 || page.NextOffset == nil || *page.NextOffset != 50 {
+			t.Errorf("unexpected page: %d items, total %d, next %v", len(page.Items), page.Total, page.NextOffset)
+		}
+		if page.Items[0].ID != "svc-00" || page.Items[49].ID != "svc-49" {
+			t.Errorf("expected stable ID order, got %s..%s", page.Items[0].ID, page.Items[49].ID)
+		}
+	})
+
+	t.Run("last page has null next_offset", func(t *testing.T) {
+		rec := get(t, "/registry/services?limit=20&offset=40", nil)
+		if !strings.Contains(rec.Body.String(), `"next_offset":null`) {
+			t.Errorf("expected null next_offset, got %s", rec.Body)
+		}
+
+		var page envelope
+		json.Unmarshal(rec.Body.Bytes(), &page)
+		if len(page.Items) != 20 || page.Items[0].ID != "svc-40" {
+			t.Errorf("unexpected last page %+v", page.Items)
+		}
+	})
+
+	t.Run("rejects out of range parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=501", "limit=abc", "offset=-1", "sort_by=version"} {
+			if rec := get(t, "/registry/services?"+query, nil); rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", query, rec.Code)
+			}
+		}
+		if rec := get(t, "/registry/services?limit=500", nil); rec.Code != http.StatusOK {
+			t.Errorf("expected limit=500 to be accepted, got %d", rec.Code)
+		}
+	})
+
+	t.Run("version 1 returns a plain array", func(t *testing.T) {
+		for name, rec := range map[string]*httptest.ResponseRecorder{
+			"header": get(t, "/registry/services", http.Header{"X-Api-Version": {"1"}}),
+			"query":  get(t, "/registry/services?version=1", nil),
+		} {
+			var services []map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &services); err != nil {
+				t.Errorf("%s: expected plain array, got %s", name, rec.Body)
+				continue
+			}
+			if len(services) != 60 {
+				t.Errorf("%s: expected all 60 services, got %d", name, len(services))
+			}
+		}
+	})
+}
+
+func TestApplication_ConditionalListServices(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	srv := httptest.NewServer(app.server.Handler())
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var statuses []int
+	client := rootclient.New(rootclient.Config{BaseURL: srv.URL, APIKey: "rk_test_admin"},
+		rootclient.WithResponseHook(func(resp *http.Response, err error) {
+			if resp != nil {
+				mu.Lock()
+				statuses = append(statuses, resp.StatusCode)
+				mu.Unlock()
+			}
+		}))
+	ctx := context.Background()
+
+	register := func(id string) {
+		t.Helper()
+		if _, err := client.Registry().Register(ctx, rootclient.RegisterRequest{
+			ID:        id,
+			Name:      "service",
+			Endpoints: []rootclient.Endpoint{{URL: "http://" + id + ":8080"}},
+		}); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+	}
+	list := func() ([]string, int) {
+		t.Helper()
+		page, err := client.Registry().ListServices(ctx, rootclient.ListOptions{})
+		if err != nil {
+			t.Fatalf("list services: %v", err)
+		}
+		ids := make([]string, len(page.Items))
+		for i, item := range page.Items {
+			ids[i] = item.ID
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return ids, statuses[len(statuses)-1]
+	}
+
+	register("svc-1")
+	steps := []struct {
+		name       string
+		change     func()
+		wantIDs    []string
+		wantStatus int
+	}{
+		{name: "first listing", change: func() {}, wantIDs: []string{"svc-1"}, wantStatus: http.StatusOK},
+		{name: "unchanged", change: func() {}, wantIDs: []string{"svc-1"}, wantStatus: http.StatusNotModified},
+		{name: "heartbeat", change: func() {
+			if err := client.Registry().Heartbeat(ctx, "svc-1"); err != nil {
+				t.Fatalf("heartbeat: %v", err)
+			}
+		}, wantIDs: []string{"svc-1"}, wantStatus: http.StatusNotModified},
+		{name: "register", change: func() { register("svc-2") }, wantIDs: []string{"svc-1", "svc-2"}, wantStatus: http.StatusOK},
+		{name: "status change", change: func() {
+			if _, err := client.Registry().SetStatus(ctx, "svc-2", rootclient.StatusDraining); err != nil {
+				t.Fatalf("set status: %v", err)
+			}
+		}, wantIDs: []string{"svc-1", "svc-2"}, wantStatus: http.StatusOK},
+		{name: "deregister", change: func() {
+			if err := client.Registry().Deregister(ctx, "svc-1"); err != nil {
+				t.Fatalf("deregister: %v", err)
+			}
+		}, wantIDs: []string{"svc-2"}, wantStatus: http.StatusOK},
+		{name: "unchanged again", change: func() {}, wantIDs: []string{"svc-2"}, wantStatus: http.StatusNotModified},
+	}
+	for _, step := range steps {
+		step.change()
+		ids, status := list()
+		if status != step.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", step.name, step.wantStatus, status)
+		}
+		if !slices.Equal(ids, step.wantIDs) {
+			t.Errorf("%s: expected services %v, got %v", step.name, step.wantIDs, ids)
+		}
+	}
+}
+
+func TestApplication_ListSessions(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	ctx := context.Background()
+	for range 3 {
+		app.sessionService.Create(ctx, sessionsvc.CreateRequest{UserID: "user-1", ServiceID: "web"})
+	}
+	app.sessionService.Create(ctx, sessionsvc.CreateRequest{UserID: "user-2", ServiceID: "web"})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTotal  int
+	}{
+		{name: "user sessions", query: "user_id=user-1&limit=2", wantStatus: http.StatusOK, wantTotal: 3},
+		{name: "missing user", query: "limit=2", wantStatus: http.StatusBadRequest},
+		{name: "limit too large", query: "user_id=user-1&limit=1000", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/session?"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer rk_test_admin")
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var page struct {
+				Items []map[string]any `json:"items"`
+				Total int              `json:"total"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &page)
+			if page.Total != tt.wantTotal || len(page.Items) != 2 {
+				t.Errorf("expected 2 of %d sessions, got %d of %d", tt.wantTotal, len(page.Items), page.Total)
+			}
+		})
+	}
+}
+
+func TestApplication_CreateSessionValidation(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Session.MaxTTL = 120
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []string
+	}{
+		{name: "valid", body: `{"user_id":"user-1","service_id":"web","ttl":120}`, wantStatus: http.StatusCreated},
+		{name: "invalid fields", body: `{"user_id":"","service_id":"web","ttl":-5}`, wantStatus: http.StatusBadRequest, wantFields: []string{"user_id", "ttl"}},
+		{name: "ttl over configured max", body: `{"user_id":"user-1","service_id":"web","ttl":121}`, wantStatus: http.StatusBadRequest, wantFields: []string{"ttl"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer rk_test_admin")
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+
+			var resp struct {
+				Fields []struct {
+					Field string `json:"field"`
+				} `json:"fields"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			var fields []string
+			for _, f := range resp.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestApplication_RecoveryLogsRequestID(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+
+	log := &recordingLogger{}
+	app, err := NewApplication(context.Background(), cfg, log)
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	app.server.GET("/test/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test/panic", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-panic")
+	rec := httptest.NewRecorder()
+	app.server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	for _, e := range log.entries {
+		if e.msg != "panic recovered" {
+			continue
+		}
+		for i := 0; i+1 < len(e.fields); i += 2 {
+			if e.fields[i] == "request_id" && e.fields[i+1] == "req-panic" {
+				return
+			}
+		}
+		t.Fatalf("expected the recovery log to carry the request ID, got %v", e.fields)
+	}
+	t.Fatal("expected the panic to be logged")
+}
+
+func TestApplication_GetMissingSession(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	req := httptest.NewRequest(http.MethodGet, "/session/does-not-exist", nil)
+	req.Header.Set("Authorization", "Bearer rk_test_admin")
+	rec := httptest.NewRecorder()
+	app.server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Code != handler.CodeNotFound {
+		t.Errorf("expected code %s, got %q", handler.CodeNotFound, resp.Code)
+	}
+}
+
+func TestApplication_ValidateSession(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	sess, err := app.sessionService.Create(context.Background(), sessionsvc.CreateRequest{UserID: "user-1", ServiceID: "web"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	head := serve(http.MethodHead, "/v1/session/"+sess.ID)
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("expected an empty 200, got %d: %q", head.Code, head.Body)
+	}
+	if head.Header().Get(handler.SessionExpiresAtHeader) == "" {
+		t.Error("expected the expiry header on a valid session")
+	}
+	if missing := serve(http.MethodHead, "/v1/session/does-not-exist"); missing.Code != http.StatusNotFound || missing.Body.Len() != 0 {
+		t.Errorf("expected an empty 404, got %d: %q", missing.Code, missing.Body)
+	}
+
+	validate := serve(http.MethodGet, "/v1/session/"+sess.ID+"/validate")
+	var resp struct {
+		Valid bool `json:"valid"`
+	}
+	json.Unmarshal(validate.Body.Bytes(), &resp)
+	if validate.Code != http.StatusOK || !resp.Valid {
+		t.Errorf("expected a valid session, got %d: %s", validate.Code, validate.Body)
+	}
+}
+
+func TestApplication_VersionedRoutes(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	sess, err := app.sessionService.Create(context.Background(), sessionsvc.CreateRequest{UserID: "user-1", ServiceID: "web"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	versioned := get("/v1/session/" + sess.ID)
+	legacy := get("/session/" + sess.ID)
+
+	if versioned.Code != http.StatusOK || legacy.Code != http.StatusOK {
+		t.Fatalf("expected both routes to succeed, got %d and %d", versioned.Code, legacy.Code)
+	}
+	if versioned.Body.String() != legacy.Body.String() {
+		t.Errorf("expected identical bodies, got %s and %s", versioned.Body, legacy.Body)
+	}
+	if versioned.Header().Get("Deprecation") != "" {
+		t.Error("expected no Deprecation header on the versioned route")
+	}
+	if legacy.Header().Get("Deprecation") != "true" {
+		t.Error("expected Deprecation header on the legacy route")
+	}
+	if want := "</v1/session/" + sess.ID + `>; rel="successor-version"`; legacy.Header().Get("Link") != want {
+		t.Errorf("expected Link %q, got %q", want, legacy.Header().Get("Link"))
+	}
+
+	for _, path := range []string{"/health", "/version"} {
+		if rec := get(path); rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+			t.Errorf("expected %s to stay unversioned, got %d with Deprecation %q", path, rec.Code, rec.Header().Get("Deprecation"))
+		}
+	}
+}
+
+func TestApplication_HeadAndOptions(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.CORS = config.CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example"}, AllowedMethods: []string{"GET", "POST"}}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{name: "HEAD health probe", method: http.MethodHead, path: "/health", wantStatus: http.StatusOK},
+		{name: "OPTIONS without CORS", method: http.MethodOptions, path: "/v1/session", wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS, POST"}},
+		{name: "CORS preflight", method: http.MethodOptions, path: "/v1/session",
+			header:     map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "POST"},
+			wantStatus: http.StatusNoContent, wantHeader: map[string]string{"Access-Control-Allow-Methods": "GET, POST", "Allow": ""}},
+		{name: "CORS preflight for an unknown path", method: http.MethodOptions, path: "/v1/nowhere",
+			header:     map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "POST"},
+			wantStatus: http.StatusNotFound, wantHeader: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""}},
+		{name: "unregistered method", method: http.MethodPatch, path: "/v1/session", wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS, POST"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			app.server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus < http.StatusBadRequest && rec.Body.Len() != 0 {
+				t.Errorf("expected no body, got %s", rec.Body)
+			}
+			for key, want := range tt.wantHeader {
+				if got := rec.Header().Get(key); got != want {
+					t.Errorf("expected %s %q, got %q", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestApplication_RegisterAndDiscoverEndpoints(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Clients that predate weighted endpoints register plain URLs
+	rec := do(http.MethodPost, "/v1/registry/register",
+		`{"id":"payment-1","name":"payment","endpoints":["http://payment-1:8080",{"url":"http://payment-2:8080","weight":3}],"capabilities":["payment"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var registered service.Service
+	json.NewDecoder(rec.Body).Decode(&registered)
+	want := []service.Endpoint{{URL: "http://payment-1:8080", Weight: 1, Healthy: true}, {URL: "http://payment-2:8080", Weight: 3, Healthy: true}}
+	if !slices.Equal(registered.Endpoints, want) {
+		t.Errorf("expected endpoints %+v, got %+v", want, registered.Endpoints)
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantCount  int
+	}{
+		{query: "?capability=payment", wantStatus: http.StatusOK, wantCount: 1},
+		{query: "?capability=payment&healthy_endpoints=true", wantStatus: http.StatusOK, wantCount: 1},
+		{query: "?healthy_endpoints=maybe", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := do(http.MethodGet, "/v1/registry/discover"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var services []service.Service
+			json.NewDecoder(rec.Body).Decode(&services)
+			if len(services) != tt.wantCount {
+				t.Errorf("expected %d services, got %d", tt.wantCount, len(services))
+			}
+		})
+	}
+}
+
+func TestApplication_RegistryExportImportEndpoints(t *testing.T) {
+	newApp := func() *Application {
+		cfg := loadFixture(t, "storage_memory.json")
+		cfg.Server.Addr = "127.0.0.1:0"
+		cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+		app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+		if err != nil {
+			t.Fatalf("new application: %v", err)
+		}
+		t.Cleanup(func() { app.Stop(context.Background()) })
+		return app
+	}
+	serve := func(app *Application, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	ctx := context.Background()
+	source := newApp()
+	for _, id := range []string{"payment-1", "search-1"} {
+		source.registryService.Register(ctx, registry.RegisterRequest{ID: id, Name: id, Endpoints: []service.Endpoint{{URL: "http://" + id + ":8080"}}})
+	}
+
+	export := serve(source, http.MethodGet, "/admin/registry/export", "")
+	if export.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", export.Code, export.Body)
+	}
+
+	target := newApp()
+	imported := serve(target, http.MethodPost, "/admin/registry/import?mode=replace", export.Body.String())
+	if imported.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", imported.Code, imported.Body)
+	}
+
+	var report registry.ImportReport
+	json.Unmarshal(imported.Body.Bytes(), &report)
+	if report.Mode != registry.ImportReplace || len(report.Results) != 2 {
+		t.Errorf("expected 2 results in replace mode, got %+v", report)
+	}
+	if services, _ := target.registryService.List(ctx); len(services) != 2 {
+		t.Errorf("expected 2 imported services, got %d", len(services))
+	}
+
+	t.Run("rejects other schema versions", func(t *testing.T) {
+		rec := serve(target, http.MethodPost, "/admin/registry/import", `{"schema_version":99,"services":[]}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestApplication_TenantIsolation(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.JWT.Secret = testJWTSecret
+	cfg.JWT.AccessTokenTTL = 15
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	serve := func(credential, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+credential)
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	issue := func(credential, tenant string) string {
+		t.Helper()
+		rec := serve(credential, http.MethodPost, "/auth/token", fmt.Sprintf(`{"subject":"svc-%s","tenant":%q}`, tenant, tenant))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("issue token for %q: status %d: %s", tenant, rec.Code, rec.Body)
+		}
+		var resp auth.TokenResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Token
+	}
+
+	tenantA := issue("rk_test_admin", "acme")
+	tenantB := issue("rk_test_admin", "globex")
+
+	created := serve(tenantA, http.MethodPost, "/session", `{"user_id":"user-1","service_id":"web","data":{"plan":"gold"}}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("create session: status %d: %s", created.Code, created.Body)
+	}
+	var sess struct {
+		ID       string `json:"id"`
+		TenantID string `json:"tenant_id"`
+	}
+	json.Unmarshal(created.Body.Bytes(), &sess)
+	if sess.TenantID != "acme" {
+		t.Errorf("expected session stamped with tenant acme, got %q", sess.TenantID)
+	}
+
+	registered := serve(tenantA, http.MethodPost, "/registry/register", `{"id":"billing-1","name":"billing","endpoints":["http://billing-1:8080"],"capabilities":["billing"]}`)
+	if registered.Code != http.StatusCreated {
+		t.Fatalf("register service: status %d: %s", registered.Code, registered.Body)
+	}
+
+	tests := []struct {
+		name       string
+		credential string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string // substring of the response body
+		denyBody   string // must not appear in the response body
+	}{
+		{name: "owner reads session", credential: tenantA, method: http.MethodGet, path: "/session/" + sess.ID, wantStatus: http.StatusOK, wantBody: "gold"},
+		{name: "other tenant reads session", credential: tenantB, method: http.MethodGet, path: "/session/" + sess.ID, wantStatus: http.StatusNotFound},
+		{name: "other tenant updates session", credential: tenantB, method: http.MethodPut, path: "/session/" + sess.ID, body: `{"data":{}}`, wantStatus: http.StatusNotFound},
+		{name: "other tenant lists user", credential: tenantB, method: http.MethodGet, path: "/session?user_id=user-1", wantStatus: http.StatusOK, wantBody: `"total":0`},
+		{name: "owner lists user", credential: tenantA, method: http.MethodGet, path: "/session?user_id=user-1", wantStatus: http.StatusOK, wantBody: `"total":1`},
+		{name: "other tenant deletes session", credential: tenantB, method: http.MethodDelete, path: "/session/" + sess.ID, wantStatus: http.StatusNoContent},
+		{name: "session survives foreign delete", credential: tenantA, method: http.MethodGet, path: "/session/" + sess.ID, wantStatus: http.StatusOK},
+		{name: "other tenant discovers", credential: tenantB, method: http.MethodGet, path: "/registry/discover?capability=billing", wantStatus: http.StatusOK, denyBody: "billing-1"},
+		{name: "other tenant lists services", credential: tenantB, method: http.MethodGet, path: "/registry/services", wantStatus: http.StatusOK, denyBody: "billing-1"},
+		{name: "other tenant heartbeats", credential: tenantB, method: http.MethodPut, path: "/registry/heartbeat/billing-1", wantStatus: http.StatusNotFound},
+		{name: "other tenant takes the id", credential: tenantB, method: http.MethodPost, path: "/registry/register", body: `{"id":"billing-1","name":"billing","endpoints":["http://evil:8080"]}`, wantStatus: http.StatusConflict, denyBody: "acme"},
+		{name: "owner discovers", credential: tenantA, method: http.MethodGet, path: "/registry/discover?capability=billing", wantStatus: http.StatusOK, wantBody: "billing-1"},
+		{name: "owner heartbeats", credential: tenantA, method: http.MethodPut, path: "/registry/heartbeat/billing-1", wantStatus: http.StatusNoContent},
+		{name: "admin without tenant reads session", credential: "rk_test_admin", method: http.MethodGet, path: "/session/" + sess.ID, wantStatus: http.StatusOK},
+		{name: "admin without tenant discovers", credential: "rk_test_admin", method: http.MethodGet, path: "/registry/discover?capability=billing", wantStatus: http.StatusOK, wantBody: "billing-1"},
+		{name: "token for another tenant", credential: tenantB, method: http.MethodPost, path: "/auth/token", body: `{"subject":"svc-globex","tenant":"acme"}`, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.credential, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantBody != "" && !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("expected body to contain %s, got %s", tt.wantBody, rec.Body)
+			}
+			if tt.denyBody != "" && strings.Contains(rec.Body.String(), tt.denyBody) {
+				t.Errorf("expected body not to contain %s, got %s", tt.denyBody, rec.Body)
+			}
+		})
+	}
+
+	t.Run("tokens inherit the caller's tenant", func(t *testing.T) {
+		inherited := serve(tenantB, http.MethodPost, "/auth/token", `{"subject":"svc-globex"}`)
+		var resp auth.TokenResponse
+		json.Unmarshal(inherited.Body.Bytes(), &resp)
+
+		rec := serve(resp.Token, http.MethodGet, "/session/"+sess.ID, "")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected inherited tenant globex to be isolated, got %d", rec.Code)
+		}
+	})
+}
+
+func TestApplication_IssueTokenPolicy(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.JWT.Secret = testJWTSecret
+	cfg.JWT.AccessTokenTTL = 15
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	issue := func(credential, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+credential)
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := issue("rk_test_admin", `{"subject":"user-1","roles":["user"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin issue: status %d: %s", rec.Code, rec.Body)
+	}
+	var user auth.TokenResponse
+	json.Unmarshal(rec.Body.Bytes(), &user)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "own subject and roles", body: `{"subject":"user-1","roles":["user"]}`, wantStatus: http.StatusOK},
+		{name: "admin role", body: `{"subject":"user-1","roles":["admin"]}`, wantStatus: http.StatusForbidden},
+		{name: "other subject", body: `{"subject":"user-2","roles":["user"]}`, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := issue(user.Token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(rec.Body.String(), handler.CodeForbidden) {
+				t.Errorf("expected code %s, got %s", handler.CodeForbidden, rec.Body)
+			}
+		})
+	}
+}
+
+func TestApplication_TokenAudience(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Auth.UnknownAudience = config.AudienceReject
+	cfg.JWT.Secret = testJWTSecret
+	cfg.JWT.AccessTokenTTL = 15
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/v1/registry/register", `{"id":"billing-1","name":"billing","endpoints":[{"url":"http://billing-1:8080"}]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/v1/auth/token", `{"subject":"gateway","audience":"missing-1"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown audience refused, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := post("/v1/auth/token", `{"subject":"gateway","audience":"billing-1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("issue: status %d: %s", rec.Code, rec.Body)
+	}
+	var issued auth.TokenResponse
+	json.Unmarshal(rec.Body.Bytes(), &issued)
+
+	tests := []struct {
+		name       string
+		audience   string
+		wantStatus int
+	}{
+		{name: "intended audience", audience: "billing-1", wantStatus: http.StatusOK},
+		{name: "other audience", audience: "search-1", wantStatus: http.StatusUnauthorized},
+		{name: "no audience", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"token": issued.Token, "audience": tt.audience})
+			if rec := post("/v1/auth/validate", string(body)); rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestApplication_SessionLimits(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Storage.Memory.MaxSessions = 2
+	cfg.Session.MaxPerUser = 1
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	create := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(fmt.Sprintf(`{"user_id":%q,"service_id":"web"}`, userID)))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := create("user-1"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := create("user-1")
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), handler.CodeTooManySessions) {
+		t.Errorf("expected 409 %s for a second session, got %d: %s", handler.CodeTooManySessions, rec.Code, rec.Body)
+	}
+	for _, userID := range []string{"user-2", "user-3"} {
+		if rec := create(userID); rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var ready struct {
+		Sessions session.Stats `json:"sessions"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &ready)
+	if want := (session.Stats{Sessions: 2, MaxSessions: 2, Evicted: 1}); ready.Sessions != want {
+		t.Errorf("expected readiness to report %+v, got %+v", want, ready.Sessions)
+	}
+}
+
+func TestApplication_Webhooks(t *testing.T) {
+	deliveries := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Webhooks = config.WebhooksConfig{
+		Enabled: true,
+		Targets: []config.WebhookTarget{{ID: "cmdb", URL: receiver.URL, Events: []string{event.ServiceDeregistered}, Secret: "cmdb-secret"}},
+	}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	ctx := context.Background()
+	app.registryService.Register(ctx, registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}})
+	if rec := do(http.MethodDelete, "/v1/registry/deregister/payment-1", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("deregister: expected 204, got %d", rec.Code)
+	}
+
+	select {
+	case req := <-deliveries:
+		body := <-bodies
+		if req.Header.Get(webhook.EventHeader) != event.ServiceDeregistered {
+			t.Errorf("expected only the deregistration to be delivered, got %s", req.Header.Get(webhook.EventHeader))
+		}
+		if req.Header.Get(webhook.SignatureHeader) != webhook.Signature("cmdb-secret", body) {
+			t.Error("expected a valid signature")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "add", method: http.MethodPost, path: "/v1/admin/webhooks", body: `{"id":"alerts","url":"https://alerts.example.com","secret":"s"}`, wantStatus: http.StatusCreated},
+		{name: "add duplicate", method: http.MethodPost, path: "/v1/admin/webhooks", body: `{"id":"alerts","url":"https://alerts.example.com","secret":"s"}`, wantStatus: http.StatusConflict},
+		{name: "add invalid", method: http.MethodPost, path: "/v1/admin/webhooks", body: `{"id":"x","url":"nope"}`, wantStatus: http.StatusBadRequest},
+		{name: "remove seeded", method: http.MethodDelete, path: "/v1/admin/webhooks/cmdb", wantStatus: http.StatusNoContent},
+		{name: "remove unknown", method: http.MethodDelete, path: "/v1/admin/webhooks/cmdb", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(tt.method, tt.path, tt.body); rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	rec := do(http.MethodGet, "/v1/admin/webhooks", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"secret"`) {
+		t.Errorf("expected targets without secrets, got %d: %s", rec.Code, rec.Body)
+	}
+	var targets []webhook.Target
+	json.Unmarshal(rec.Body.Bytes(), &targets)
+	if len(targets) != 1 || targets[0].ID != "alerts" {
+		t.Errorf("expected only the alerts target, got %+v", targets)
+	}
+
+	rec = do(http.MethodGet, "/ready", "")
+	var ready struct {
+		Webhooks *webhook.Stats `json:"webhooks"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &ready)
+	if ready.Webhooks == nil || ready.Webhooks.Capacity != 1000 {
+		t.Errorf("expected webhook stats in readiness, got %+v", ready.Webhooks)
+	}
+}
+
+func TestApplication_SessionCallbacks(t *testing.T) {
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Session.Callbacks.Enabled = true
+	cfg.Registry.HealthCheck.AllowedCIDRs = []string{"127.0.0.0/8"} // where the receiver listens
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/registry/register",
+		`{"id":"web-1","name":"web","endpoints":[{"url":"http://web-1:8080"}],"metadata":{"callback_url":"`+receiver.URL+`"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(http.MethodPost, "/v1/session", `{"user_id":"user-1","service_id":"web-1"}`)
+	var sess session.Session
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &sess) != nil {
+		t.Fatalf("create session: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/v1/session/"+sess.ID, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete session: expected 204, got %d", rec.Code)
+	}
+
+	select {
+	case body := <-bodies:
+		var delivered struct {
+			Type string        `json:"type"`
+			Data session.Ended `json:"data"`
+		}
+		json.Unmarshal(body, &delivered)
+		want := session.Ended{SessionID: sess.ID, UserID: "user-1", ServiceID: "web-1", Reason: session.EndedDeleted}
+		if delivered.Type != event.SessionEnded || delivered.Data != want {
+			t.Errorf("expected %s with %+v, got %s", event.SessionEnded, want, body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the session callback")
+	}
+
+	rec = do(http.MethodGet, "/ready", "")
+	var ready struct {
+		Callbacks *webhook.Stats `json:"session_callbacks"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &ready)
+	if ready.Callbacks == nil || ready.Callbacks.Capacity != 1000 {
+		t.Errorf("expected session callback stats in readiness, got %+v", ready.Callbacks)
+	}
+}
+
+func TestApplication_DNS(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Registry.DNS = config.DNSConfig{Enabled: true, Addr: "127.0.0.1:0"}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	ctx := context.Background()
+	app.registryService.Register(ctx, registry.RegisterRequest{
+		ID:           "payment-1",
+		Name:         "payment",
+		Endpoints:    []service.Endpoint{{URL: "http://10.0.0.1:8080"}},
+		Capabilities: []string{"payment"},
+	})
+
+	addr := app.DNSAddr()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	ips, err := resolver.LookupNetIP(ctx, "ip4", "payment.service.root.")
+	if err != nil || len(ips) != 1 || ips[0].String() != "10.0.0.1" {
+		t.Fatalf("expected payment at 10.0.0.1, got %v %v", ips, err)
+	}
+
+	if err := app.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("expected the dns server closed on stop")
+	}
+}
+
+func TestApplication_Audit(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Audit = config.AuditConfig{Enabled: true, MaxEvents: 100}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	do := func(method, path, accept, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/v1/registry/register", "", `{"id":"billing-1","name":"billing","endpoints":[{"url":"http://billing-1:8080"}]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Events are stored in the background
+	var page struct {
+		Items []struct {
+			Actor    string `json:"actor"`
+			Action   string `json:"action"`
+			Resource string `json:"resource"`
+		} `json:"items"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(page.Items) == 0 && time.Now().Before(deadline) {
+		json.Unmarshal(do(http.MethodGet, "/v1/audit/events?action=registry.register", "", "").Body.Bytes(), &page)
+		time.Sleep(time.Millisecond)
+	}
+	if len(page.Items) != 1 || page.Items[0].Actor != "apikey:bootstrap" || page.Items[0].Resource != "service/billing-1" {
+		t.Fatalf("expected the registration by the bootstrap key, got %+v", page.Items)
+	}
+
+	rec := do(http.MethodGet, "/v1/audit/events", "application/x-ndjson", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("expected a one line export, got %d %q", rec.Code, rec.Body)
+	}
+
+	if got := app.backends["audit"]; got != config.StorageMemory {
+		t.Errorf("expected the memory audit backend, got %q", got)
+	}
+}
+
+func TestApplication_Maintenance(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if rec := do(http.MethodPost, "/v1/admin/maintenance", `{"enabled":true,"message":"migrating storage","until":"`+until+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := do(http.MethodPost, "/v1/registry/register", `{"id":"billing-1","name":"billing","endpoints":[{"url":"http://billing-1:8080"}]}`)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "migrating storage") || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("register: expected 503 with the message and Retry-After, got %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+	if rec := do(http.MethodGet, "/v1/registry/services", ""); rec.Code != http.StatusOK {
+		t.Errorf("list: expected reads served, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("health: expected 200, got %d", rec.Code)
+	}
+	for _, path := range []string{"/v1/auth/validate", "/auth/validate"} {
+		if rec := do(http.MethodPost, path, `{"token":"invalid"}`); rec.Code == http.StatusServiceUnavailable {
+			t.Errorf("%s: expected token validation served, got %d", path, rec.Code)
+		}
+	}
+
+	if rec := do(http.MethodPost, "/admin/maintenance", `{"enabled":false}`); rec.Code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/v1/registry/register", `{"id":"billing-1","name":"billing","endpoints":[{"url":"http://billing-1:8080"}]}`); rec.Code != http.StatusCreated {
+		t.Errorf("register: expected 201 once maintenance is over, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestApplication_IssuanceQuota(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+	cfg.Auth.IssuanceQuota = config.IssuanceQuotaConfig{Limit: 2, Window: 60, Exempt: []string{"apikey:bootstrap"}}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	gateway, err := app.authService.CreateAPIKey(context.Background(), auth.CreateAPIKeyRequest{Name: "gateway", Roles: []string{token.RoleIssuer}})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 2 {
+		if rec := do(http.MethodPost, "/v1/auth/token", gateway.Key, `{"subject":"user-1"}`); rec.Code != http.StatusOK {
+			t.Fatalf("issue %d: expected 200, got %d: %s", i+1, rec.Code, rec.Body)
+		}
+	}
+
+	rec := do(http.MethodPost, "/v1/auth/token", gateway.Key, `{"subject":"user-1"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the quota is used up, got %d: %s", rec.Code, rec.Body)
+	}
+	var exceeded struct {
+		Code    string    `json:"code"`
+		ResetAt time.Time `json:"reset_at"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &exceeded)
+	if exceeded.Code != "QUOTA_EXCEEDED" || exceeded.ResetAt.IsZero() {
+		t.Errorf("expected QUOTA_EXCEEDED with a reset time, got %s", rec.Body)
+	}
+	if retryAfter, _ := strconv.Atoi(rec.Header().Get("Retry-After")); retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("expected Retry-After within the window, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	rec = do(http.MethodGet, "/v1/auth/quota", gateway.Key, "")
+	var status auth.QuotaStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	if rec.Code != http.StatusOK || status.Subject != "apikey:gateway" || status.Used != 2 || status.Remaining != 0 || status.Limit != 2 {
+		t.Errorf("unexpected quota %d: %s", rec.Code, rec.Body)
+	}
+
+	for range 3 {
+		if rec := do(http.MethodPost, "/v1/auth/token", "rk_test_admin", `{"subject":"user-1"}`); rec.Code != http.StatusOK {
+			t.Fatalf("expected the exempt bootstrap key to be unlimited, got %d", rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var ready struct {
+		Quota *auth.QuotaStats `json:"issuance_quota"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &ready)
+	if ready.Quota == nil || *ready.Quota != (auth.QuotaStats{Limit: 2, WindowSeconds: 60, Granted: 2, Rejected: 1, Exempted: 3}) {
+		t.Errorf("unexpected issuance quota stats %+v", ready.Quota)
+	}
+}
+
+func TestApplication_IdempotentCreate(t *testing.T) {
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Auth.BootstrapAPIKey = "rk_test_admin"
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	do := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer rk_test_admin")
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do("/v1/session", "create-1", `{"user_id":"user-1","service_id":"web"}`)
+	second := do("/v1/session", "create-1", `{"user_id":"user-1","service_id":"web"}`)
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated || first.Body.String() != second.Body.String() {
+		t.Fatalf("expected the session creation replayed, got %d %s and %d %s", first.Code, first.Body, second.Code, second.Body)
+	}
+	if second.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Error("expected the replay marked")
+	}
+	if sessions, _ := app.sessionService.ListByUser(context.Background(), "user-1", pagination.ListOptions{}); sessions.Total != 1 {
+		t.Errorf("expected a single session created, got %d", sessions.Total)
+	}
+	if rec := do("/v1/session", "create-1", `{"user_id":"user-2","service_id":"web"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected the key refused for another session, got %d", rec.Code)
+	}
+
+	register := `{"id":"payment-1","name":"payment","endpoints":[{"url":"http://payment-1:8080"}]}`
+	if rec := do("/v1/registry/register", "register-1", register); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the service registered, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("/v1/registry/register", "register-1", register); rec.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the registration replayed, got %d", rec.Code)
+	}
+}
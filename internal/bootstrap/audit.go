@@ -0,0 +1,28 @@
+package bootstrap
+
+import (
+	"time"
+
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/middleware"
+	auditsvc "github.com/aq189/bin/internal/service/audit"
+)
+
+// initAudit creates the audit service when auditing is enabled and starts
+// storing and pruning its events. It returns the recorder the registry hands
+// its mutations to, or nil when auditing is disabled.
+func (a *Application) initAudit() journal.Recorder {
+	if a.auditRepo == nil {
+		return nil
+	}
+
+	a.auditService = auditsvc.NewService(a.auditRepo, auditsvc.Config{
+		Retention: time.Duration(a.config.Audit.Retention) * time.Hour,
+		RequestID: middleware.RequestIDFromContext,
+		Clock:     a.clock,
+	}, a.logger.With("component", "audit"))
+
+	// Started before the registry recording into it, so it stops after it
+	a.startBackground("audit", a.auditService.Start)
+	return a.auditService
+}
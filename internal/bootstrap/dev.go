@@ -0,0 +1,171 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/registry"
+	sessionsvc "github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// ErrDevModeRefused is returned by ApplyDevMode when the configuration looks
+// like a deployment rather than a developer machine
+var ErrDevModeRefused = errors.New("dev mode refused")
+
+// DevTokenTTL is the lifetime of the admin token minted in dev mode
+const DevTokenTTL = 30 * 24 * time.Hour
+
+// devAdminSubject is the subject of the admin token minted in dev mode
+const devAdminSubject = "dev-admin"
+
+// devIssuer is recorded as issued_by in the metadata of the dev admin token
+const devIssuer = "root-dev"
+
+// devOrigins are the origins CORS allows in dev mode: local front ends on any port
+var devOrigins = []string{
+	"http://localhost", "http://localhost:*",
+	"https://localhost", "https://localhost:*",
+	"http://127.0.0.1", "http://127.0.0.1:*",
+	"http://[::1]", "http://[::1]:*",
+}
+
+// devHealthCheckCIDRs are the internal ranges health checks may reach in dev
+// mode besides the configured ones: services on the machine or a local network
+var devHealthCheckCIDRs = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+}
+
+//go:embed devdata/seed.json
+var devSeed []byte
+
+// devSeedData is the example data SeedDevData loads
+type devSeedData struct {
+	Services []registry.RegisterRequest `json:"services"`
+	Sessions []sessionsvc.CreateRequest `json:"sessions"`
+}
+
+// DevConfig is the configuration dev mode starts from when there is no
+// configuration file
+func DevConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{Addr: "127.0.0.1:8080"},
+		Log:    config.LogConfig{Level: "debug", Format: "text"},
+	}
+}
+
+// ApplyDevMode rewrites cfg for local development: a random JWT secret and
+// bootstrap API key, the key expiring with the dev token, memory storage
+// without snapshots, CORS open to localhost origins and health checks
+// allowed to reach loopback and private addresses. It refuses
+// with ErrDevModeRefused when cfg selects redis or postgres storage or enables
+// TLS, so a production configuration can't be started in dev mode by accident.
+func ApplyDevMode(cfg *config.Config) error {
+	var errs []error
+	storage := cfg.Storage
+	for _, backend := range []struct{ field, typ string }{
+		{"storage.type", storage.Type},
+		{"storage.sessions.type", storage.Sessions.Type},
+		{"storage.registry.type", storage.Registry.Type},
+		{"storage.config.type", storage.Config.Type},
+		{"storage.api_keys.type", storage.APIKeys.Type},
+		{"storage.quotas.type", storage.Quotas.Type},
+		{"storage.idempotency.type", storage.Idempotency.Type},
+		{"storage.events.type", storage.Events.Type},
+	} {
+		if backend.typ == config.StorageRedis || backend.typ == config.StoragePostgres {
+			errs = append(errs, fmt.Errorf("%w: %s is %s", ErrDevModeRefused, backend.field, backend.typ))
+		}
+	}
+	if cfg.Server.TLS.Enabled {
+		errs = append(errs, fmt.Errorf("%w: server.tls is enabled", ErrDevModeRefused))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("generate jwt secret: %w", err)
+	}
+	cfg.JWT.Secret = hex.EncodeToString(secret)
+	cfg.JWT.Secrets = nil
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("generate bootstrap api key: %w", err)
+	}
+	cfg.Auth.BootstrapAPIKey = apikey.Prefix + hex.EncodeToString(key)
+	cfg.Auth.BootstrapAPIKeyTTL = int(DevTokenTTL / time.Hour)
+
+	cfg.Storage = config.StorageConfig{
+		Type: config.StorageMemory,
+		Memory: config.MemoryConfig{
+			MaxSessions:   storage.Memory.MaxSessions,
+			SessionShards: storage.Memory.SessionShards,
+		},
+	}
+
+	cfg.Server.CORS = config.CORSConfig{
+		Enabled:        true,
+		AllowedOrigins: devOrigins,
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID", "X-Tenant-ID", "X-API-Version", "If-None-Match"},
+		ExposedHeaders: []string{"X-Request-ID", "X-Session-Expires-At", "ETag"},
+	}
+	cfg.Registry.HealthCheck.AllowedCIDRs = slices.Concat(cfg.Registry.HealthCheck.AllowedCIDRs, devHealthCheckCIDRs)
+	return nil
+}
+
+// IssueDevToken mints an admin token valid for DevTokenTTL, signed with the
+// application's JWT secret
+func (a *Application) IssueDevToken(ctx context.Context) (*auth.TokenResponse, error) {
+	manager, err := NewJWTManager(a.config.JWT, a.clock)
+	if err != nil {
+		return nil, err
+	}
+	issuer := auth.NewService(manager, nil, auth.Config{AccessTokenTTL: DevTokenTTL, RefreshTokenTTL: DevTokenTTL, Clock: a.clock}, logger.NewNop())
+
+	// Without caller claims in the context the auth service applies no issuance policy
+	return issuer.IssueToken(ctx, auth.IssueTokenRequest{
+		Subject:  devAdminSubject,
+		Roles:    []string{token.RoleAdmin},
+		Metadata: map[string]any{token.MetadataIssuedBy: devIssuer},
+	})
+}
+
+// SeedDevData registers the example services and creates the example sessions
+// embedded in devdata/seed.json. The services send no heartbeats, so they turn
+// unhealthy once registry.heartbeat_timeout passes.
+func (a *Application) SeedDevData(ctx context.Context) error {
+	var seed devSeedData
+	if err := json.Unmarshal(devSeed, &seed); err != nil {
+		return fmt.Errorf("parse seed data: %w", err)
+	}
+
+	for _, req := range seed.Services {
+		if _, _, err := a.registryService.Register(ctx, req); err != nil {
+			return fmt.Errorf("seed service %s: %w", req.ID, err)
+		}
+	}
+	for _, req := range seed.Sessions {
+		if _, err := a.sessionService.Create(ctx, req); err != nil {
+			return fmt.Errorf("seed session for %s: %w", req.UserID, err)
+		}
+	}
+
+	a.logger.Info("dev seed data loaded", "services", len(seed.Services), "sessions", len(seed.Sessions))
+	return nil
+}
@@ -0,0 +1,39 @@
+package bootstrap
+
+import (
+	"time"
+
+	"github.com/aq189/bin/internal/service/dns"
+)
+
+// initDNS binds the DNS server answering from the registry when it is
+// enabled and starts serving, so an address that can't be bound fails
+// startup rather than the first query
+func (a *Application) initDNS() error {
+	cfg := a.config.Registry.DNS
+	if !cfg.Enabled {
+		return nil
+	}
+
+	server := dns.NewServer(a.registryService, dns.Config{
+		Addr:   cfg.Addr,
+		Domain: cfg.Domain,
+		TTL:    time.Duration(cfg.TTL) * time.Second,
+	}, a.logger.With("component", "dns"))
+	if err := server.Listen(); err != nil {
+		return err
+	}
+	a.dnsServer = server
+	a.logger.Info("dns server listening", "addr", server.Addr())
+	a.startBackground("dns server", server.Serve)
+	return nil
+}
+
+// DNSAddr returns the address the DNS server is bound to, or "" when it is
+// disabled
+func (a *Application) DNSAddr() string {
+	if a.dnsServer == nil {
+		return ""
+	}
+	return a.dnsServer.Addr()
+}
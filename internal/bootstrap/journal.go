@@ -0,0 +1,33 @@
+package bootstrap
+
+import (
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/middleware"
+	journalsvc "github.com/aq189/bin/internal/service/journal"
+)
+
+// initJournal opens the registry journal when a path is configured and
+// starts its writer. It returns the recorder the registry hands its
+// mutations to, or nil when the journal is disabled.
+func (a *Application) initJournal() (journal.Recorder, error) {
+	cfg := a.config.Registry.Journal
+	if cfg.Path == "" {
+		return nil, nil
+	}
+
+	writer, err := journalsvc.NewWriter(journalsvc.Config{
+		Path:              cfg.Path,
+		MaxBytes:          int64(cfg.MaxSizeMB) << 20,
+		MaxFiles:          cfg.MaxFiles,
+		BufferSize:        cfg.BufferSize,
+		HeartbeatSampling: cfg.HeartbeatSampling,
+		RequestID:         middleware.RequestIDFromContext,
+	}, a.logger.With("component", "journal"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Started before the registry recording into it, so it stops after it
+	a.startBackground("registry journal", writer.Start)
+	return writer, nil
+}
@@ -0,0 +1,28 @@
+package bootstrap
+
+import (
+	"github.com/aq189/bin/internal/service/maintenance"
+)
+
+// initMaintenance creates the maintenance mode, restoring it from the config
+// repository, and starts following the changes other servers store there
+func (a *Application) initMaintenance() error {
+	service, err := maintenance.NewService(a.configRepo, maintenance.Config{Clock: a.clock}, a.logger.With("component", "maintenance"))
+	if err != nil {
+		return err
+	}
+	a.maintenanceService = service
+	a.startBackground("maintenance refresh", service.Start)
+	return nil
+}
+
+// maintenanceExemptRoutes returns the patterns of the write routes served
+// during maintenance: token validation and the dashboard login and logout,
+// which only read, and the endpoint turning the mode off
+func maintenanceExemptRoutes() []string {
+	routes := []string{"/ui/login", "/ui/logout"}
+	for _, route := range []string{"/auth/validate", "/admin/maintenance"} {
+		routes = append(routes, apiPrefix+route, route)
+	}
+	return routes
+}
@@ -0,0 +1,61 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// defaultMetricsInterval is how often metrics are exported when the
+// configuration leaves it unset
+const defaultMetricsInterval = time.Minute
+
+// initMetrics installs an OTLP meter provider when metrics are enabled.
+// Otherwise meterProvider stays nil and nothing is recorded.
+func (a *Application) initMetrics(ctx context.Context) error {
+	cfg := a.config.Observability.Metrics
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var opts []otlpmetrichttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("create otlp exporter: %w", err)
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = defaultTracingServiceName
+	}
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultMetricsInterval
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+		sdkmetric.WithResource(resource.NewSchemaless(semconv.ServiceName(name))),
+	)
+	a.meterProvider = provider
+	// Shutting down exports what was recorded since the last interval
+	a.addCleanup("metrics", func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, tracingShutdownTimeout)
+		defer cancel()
+		return provider.Shutdown(ctx)
+	})
+
+	a.logger.Info("metrics enabled", "endpoint", cfg.Endpoint, "interval", interval.String())
+	return nil
+}
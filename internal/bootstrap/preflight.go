@@ -0,0 +1,208 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+// ErrPreflight is returned by NewApplication when the configuration can't
+// work on this machine: a weak JWT secret, an unusable TLS certificate, an
+// unparseable listen address or a file that can't be written
+var ErrPreflight = errors.New("preflight failed")
+
+// minJWTSecretBytes is the shortest JWT secret accepted unless
+// jwt.allow_weak_secret is set
+const minJWTSecretBytes = 32
+
+// certExpiryWarning is how close to its expiry the TLS certificate gets
+// before preflight warns about it
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// geteuid returns the effective user id the privileged port check uses
+var geteuid = os.Geteuid
+
+// preflightReport collects what the preflight checks found: errors stop the
+// application from starting, warnings are logged
+type preflightReport struct {
+	errors   []string
+	warnings []string
+}
+
+func (r *preflightReport) fail(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *preflightReport) warn(format string, args ...any) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+// preflight checks what the configuration needs from the machine before
+// anything is started, so that a bad secret, certificate or path is reported
+// at once rather than on the first request or snapshot. Warnings are logged
+// together; errors are returned together as ErrPreflight.
+func (a *Application) preflight() error {
+	var report preflightReport
+	checkJWTSecret(&report, a.config.JWT)
+	checkTLS(&report, a.config.Server.TLS, clock.OrReal(a.clock).Now())
+	checkListener(&report, a.config.Server)
+	checkWritable(&report, "storage.memory.snapshot_path", a.config.Storage.Memory.SnapshotPath, false)
+	checkWritable(&report, "registry.journal.path", a.config.Registry.Journal.Path, true)
+
+	if len(report.warnings) > 0 {
+		a.logger.Warn("preflight found problems", "warnings", report.warnings)
+	}
+	if len(report.errors) > 0 {
+		return fmt.Errorf("%w: %s", ErrPreflight, strings.Join(report.errors, "; "))
+	}
+	return nil
+}
+
+// checkJWTSecret refuses a missing secret and, unless AllowWeakSecret is set,
+// one shorter than minJWTSecretBytes, checking every secret of jwt.secrets
+func checkJWTSecret(report *preflightReport, cfg config.JWTConfig) {
+	for i, secret := range cfg.SigningSecrets() {
+		field, required, placeholder := "jwt.secret", "; set it in the file or with JWT_SECRET", "; set JWT_SECRET"
+		if len(cfg.Secrets) > 0 {
+			field, required, placeholder = fmt.Sprintf("jwt.secrets[%d].value", i), "", ""
+		}
+		switch {
+		case secret.Value == "":
+			report.fail("%s: is required%s", field, required)
+		case strings.HasPrefix(secret.Value, "${"):
+			report.fail("%s: is an unexpanded placeholder%s", field, placeholder)
+		case len(secret.Value) >= minJWTSecretBytes:
+		case cfg.AllowWeakSecret:
+			report.warn("%s: is %d bytes, shorter than %d; allowed by jwt.allow_weak_secret", field, len(secret.Value), minJWTSecretBytes)
+		default:
+			report.fail("%s: is %d bytes, must be at least %d", field, len(secret.Value), minJWTSecretBytes)
+		}
+	}
+}
+
+// checkTLS loads the certificate and key when TLS is enabled, refusing a pair
+// that doesn't load or match and a certificate outside its validity period,
+// and warning when it expires within certExpiryWarning
+func checkTLS(report *preflightReport, cfg config.TLSConfig, now time.Time) {
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		report.fail("server.tls: cert_file and key_file are required when TLS is enabled")
+		return
+	}
+
+	pair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		report.fail("server.tls: load certificate: %v", err)
+		return
+	}
+	leaf := pair.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			report.fail("server.tls: parse certificate: %v", err)
+			return
+		}
+	}
+
+	const day = 24 * time.Hour
+	switch {
+	case now.After(leaf.NotAfter):
+		report.fail("server.tls: certificate %s expired on %s", cfg.CertFile, leaf.NotAfter.UTC().Format(time.DateOnly))
+	case now.Before(leaf.NotBefore):
+		report.fail("server.tls: certificate %s is not valid before %s", cfg.CertFile, leaf.NotBefore.UTC().Format(time.RFC3339))
+	case leaf.NotAfter.Sub(now) < certExpiryWarning:
+		report.warn("server.tls: certificate %s expires on %s, in %d days", cfg.CertFile,
+			leaf.NotAfter.UTC().Format(time.DateOnly), int(leaf.NotAfter.Sub(now)/day))
+	}
+}
+
+// checkListener checks what the listener mode needs: a valid addr for tcp,
+// an existing directory for the unix socket, and the variables systemd sets
+// for socket activation
+func checkListener(report *preflightReport, cfg config.ServerConfig) {
+	switch cfg.Listener.Mode {
+	case config.ListenerUnix:
+		dir := filepath.Dir(cfg.Listener.SocketPath)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			report.fail("server.listener.socket_path: directory %s does not exist", dir)
+		}
+	case config.ListenerActivation:
+		if os.Getenv("LISTEN_FDS") == "" {
+			report.fail("server.listener.mode: activation needs a socket passed by systemd, but LISTEN_FDS is not set")
+		}
+	default:
+		checkListenAddr(report, cfg.Addr)
+	}
+}
+
+// checkListenAddr refuses an address that isn't host:port and warns when a
+// process not running as root would listen on a privileged port, which only
+// works with the CAP_NET_BIND_SERVICE capability
+func checkListenAddr(report *preflightReport, addr string) {
+	_, portName, err := net.SplitHostPort(addr)
+	if err != nil {
+		report.fail("server.addr: %q is not host:port: %v", addr, err)
+		return
+	}
+	port, err := net.LookupPort("tcp", portName)
+	if err != nil {
+		report.fail("server.addr: %q has an invalid port: %v", addr, err)
+		return
+	}
+	if port != 0 && port < 1024 && geteuid() > 0 {
+		report.warn("server.addr: port %d is privileged and the process is not running as root", port)
+	}
+}
+
+// checkWritable checks that the file at path can be written the way the
+// server writes it: replaced through a temporary file in its directory, and
+// appended to when appends is set. The directory of an appended file is
+// created when missing, so its nearest existing parent is checked instead.
+func checkWritable(report *preflightReport, field, path string, appends bool) {
+	if path == "" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		report.fail("%s: %s is a directory", field, path)
+		return
+	case err == nil && appends:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			report.fail("%s: %v", field, err)
+			return
+		}
+		file.Close()
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		report.fail("%s: %v", field, err)
+		return
+	}
+
+	dir := filepath.Dir(path)
+	for appends {
+		if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	probe, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		report.fail("%s: directory %s is not writable: %v", field, dir, errors.Unwrap(err))
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+}
@@ -0,0 +1,279 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+// writeTestCert writes a self-signed certificate valid from notBefore to
+// notAfter and its key to dir, returning their paths
+func writeTestCert(t *testing.T, dir, name string, notBefore, notAfter time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certPath, keyPath
+}
+
+// assertFindings checks that report holds one error containing wantErr, or
+// none when it is empty, and likewise one warning containing wantWarn
+func assertFindings(t *testing.T, report preflightReport, wantErr, wantWarn string) {
+	t.Helper()
+	check := func(kind string, found []string, want string) {
+		if want == "" {
+			if len(found) != 0 {
+				t.Errorf("expected no %s, got %q", kind, found)
+			}
+			return
+		}
+		if len(found) != 1 || !strings.Contains(found[0], want) {
+			t.Errorf("expected one %s containing %q, got %q", kind, want, found)
+		}
+	}
+	check("error", report.errors, wantErr)
+	check("warning", report.warnings, wantWarn)
+}
+
+func TestCheckJWTSecret(t *testing.T) {
+	tests := []struct {
+		name     string
+		jwt      config.JWTConfig
+		wantErr  string
+		wantWarn string
+	}{
+		{name: "strong", jwt: config.JWTConfig{Secret: strings.Repeat("k", minJWTSecretBytes)}},
+		{name: "missing", jwt: config.JWTConfig{}, wantErr: "is required"},
+		{name: "missing with override", jwt: config.JWTConfig{AllowWeakSecret: true}, wantErr: "is required"},
+		{name: "placeholder", jwt: config.JWTConfig{Secret: "${JWT_SECRET}"}, wantErr: "unexpanded placeholder"},
+		{name: "short", jwt: config.JWTConfig{Secret: "test-secret"}, wantErr: "is 11 bytes, must be at least 32"},
+		{name: "one byte short", jwt: config.JWTConfig{Secret: strings.Repeat("k", minJWTSecretBytes-1)}, wantErr: "is 31 bytes"},
+		{name: "short with override", jwt: config.JWTConfig{Secret: "test-secret", AllowWeakSecret: true}, wantWarn: "allowed by jwt.allow_weak_secret"},
+		{
+			name: "short previous secret",
+			jwt: config.JWTConfig{Secrets: []config.JWTSecret{
+				{ID: "2026-10", Value: strings.Repeat("k", minJWTSecretBytes), Primary: true},
+				{ID: "2026-04", Value: "test-secret"},
+			}},
+			wantErr: "jwt.secrets[1].value: is 11 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report preflightReport
+			checkJWTSecret(&report, tt.jwt)
+			assertFindings(t, report, tt.wantErr, tt.wantWarn)
+		})
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	validCert, validKey := writeTestCert(t, dir, "valid", now.AddDate(0, -1, 0), now.AddDate(1, 0, 0))
+	expiringCert, expiringKey := writeTestCert(t, dir, "expiring", now.AddDate(0, -1, 0), now.AddDate(0, 0, 10))
+	expiredCert, expiredKey := writeTestCert(t, dir, "expired", now.AddDate(-1, 0, 0), now.AddDate(0, 0, -1))
+	futureCert, futureKey := writeTestCert(t, dir, "future", now.AddDate(0, 0, 1), now.AddDate(1, 0, 0))
+
+	tests := []struct {
+		name     string
+		tls      config.TLSConfig
+		wantErr  string
+		wantWarn string
+	}{
+		{name: "disabled", tls: config.TLSConfig{CertFile: filepath.Join(dir, "missing.crt")}},
+		{name: "valid", tls: config.TLSConfig{Enabled: true, CertFile: validCert, KeyFile: validKey}},
+		{name: "expiring soon", tls: config.TLSConfig{Enabled: true, CertFile: expiringCert, KeyFile: expiringKey}, wantWarn: "expires on 2026-03-11, in 10 days"},
+		{name: "expired", tls: config.TLSConfig{Enabled: true, CertFile: expiredCert, KeyFile: expiredKey}, wantErr: "expired on 2026-02-28"},
+		{name: "not yet valid", tls: config.TLSConfig{Enabled: true, CertFile: futureCert, KeyFile: futureKey}, wantErr: "is not valid before"},
+		{name: "mismatched key", tls: config.TLSConfig{Enabled: true, CertFile: validCert, KeyFile: expiredKey}, wantErr: "private key does not match public key"},
+		{name: "missing file", tls: config.TLSConfig{Enabled: true, CertFile: filepath.Join(dir, "missing.crt"), KeyFile: validKey}, wantErr: "load certificate"},
+		{name: "not a certificate", tls: config.TLSConfig{Enabled: true, CertFile: validKey, KeyFile: validKey}, wantErr: "load certificate"},
+		{name: "key file unset", tls: config.TLSConfig{Enabled: true, CertFile: validCert}, wantErr: "cert_file and key_file are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report preflightReport
+			checkTLS(&report, tt.tls, now)
+			assertFindings(t, report, tt.wantErr, tt.wantWarn)
+		})
+	}
+}
+
+func TestCheckListenAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		euid     int
+		wantErr  string
+		wantWarn string
+	}{
+		{name: "host and port", addr: "127.0.0.1:8080", euid: 1000},
+		{name: "port only", addr: ":8443", euid: 1000},
+		{name: "ipv6", addr: "[::1]:8080", euid: 1000},
+		{name: "any port", addr: "127.0.0.1:0", euid: 1000},
+		{name: "privileged port as root", addr: ":443", euid: 0},
+		{name: "privileged port as user", addr: ":443", euid: 1000, wantWarn: "port 443 is privileged"},
+		{name: "named privileged port", addr: ":http", euid: 1000, wantWarn: "port 80 is privileged"},
+		{name: "empty", addr: "", euid: 1000, wantErr: "is not host:port"},
+		{name: "no port", addr: "localhost", euid: 1000, wantErr: "is not host:port"},
+		{name: "port out of range", addr: ":70000", euid: 1000, wantErr: "invalid port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(orig func() int) { geteuid = orig }(geteuid)
+			geteuid = func() int { return tt.euid }
+
+			var report preflightReport
+			checkListenAddr(&report, tt.addr)
+			assertFindings(t, report, tt.wantErr, tt.wantWarn)
+		})
+	}
+}
+
+func TestCheckListener(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		cfg       config.ServerConfig
+		listenFDs string
+		wantErr   string
+	}{
+		{name: "tcp", cfg: config.ServerConfig{Addr: "127.0.0.1:8080"}},
+		{name: "tcp with a bad addr", cfg: config.ServerConfig{Addr: "localhost"}, wantErr: "is not host:port"},
+		{name: "unix ignores addr", cfg: config.ServerConfig{Listener: config.ListenerConfig{Mode: config.ListenerUnix, SocketPath: filepath.Join(dir, "root.sock")}}},
+		{name: "unix in a missing directory", cfg: config.ServerConfig{Listener: config.ListenerConfig{Mode: config.ListenerUnix, SocketPath: filepath.Join(dir, "missing", "root.sock")}}, wantErr: "does not exist"},
+		{name: "activated", cfg: config.ServerConfig{Listener: config.ListenerConfig{Mode: config.ListenerActivation}}, listenFDs: "1"},
+		{name: "not activated", cfg: config.ServerConfig{Listener: config.ListenerConfig{Mode: config.ListenerActivation}}, wantErr: "LISTEN_FDS is not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_FDS", tt.listenFDs)
+
+			var report preflightReport
+			checkListener(&report, tt.cfg)
+			assertFindings(t, report, tt.wantErr, "")
+		})
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "registry.journal")
+	if err := os.WriteFile(existing, []byte("{}\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		appends bool
+		wantErr string
+	}{
+		{name: "unset", path: ""},
+		{name: "new file", path: filepath.Join(dir, "snapshot.json")},
+		{name: "existing file", path: existing, appends: true},
+		{name: "missing directory", path: filepath.Join(dir, "missing", "snapshot.json"), wantErr: "is not writable"},
+		{name: "missing directory created on append", path: filepath.Join(dir, "logs", "2026", "registry.journal"), appends: true},
+		{name: "directory", path: dir, wantErr: "is a directory"},
+		{name: "under a file", path: filepath.Join(existing, "snapshot.json"), wantErr: "not a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report preflightReport
+			checkWritable(&report, "path", tt.path, tt.appends)
+			assertFindings(t, report, tt.wantErr, "")
+		})
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".preflight-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("expected probe files removed, got %v", leftovers)
+	}
+}
+
+func TestNewApplication_PreflightAggregatesFindings(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "expiring", time.Now().AddDate(0, -1, 0), time.Now().AddDate(0, 0, 5))
+
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.JWT = config.JWTConfig{Secret: "short", AllowWeakSecret: true}
+	cfg.Server.TLS = config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile}
+	cfg.Storage.Memory.SnapshotPath = filepath.Join(dir, "missing", "snapshot.json")
+	cfg.Server.Addr = "not-an-address"
+
+	log := &recordingLogger{}
+	app, err := NewApplication(context.Background(), cfg, log)
+	if !errors.Is(err, ErrPreflight) {
+		t.Fatalf("expected ErrPreflight, got %v", err)
+	}
+	if app != nil {
+		t.Error("expected no application on error")
+	}
+	for _, want := range []string{"server.addr", "storage.memory.snapshot_path"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to name %s, got %v", want, err)
+		}
+	}
+	if got := log.count("warn"); got != 1 {
+		t.Fatalf("expected the warnings in one log entry, got %d", got)
+	}
+	warnings, _ := log.entries[0].fields[1].([]string)
+	if len(warnings) != 2 {
+		t.Errorf("expected the weak secret and expiring certificate warnings, got %q", warnings)
+	}
+
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Storage.Memory.SnapshotPath = ""
+	app, err = NewApplication(context.Background(), cfg, log)
+	if err != nil {
+		t.Fatalf("expected warnings only to let the application start, got %v", err)
+	}
+	app.Stop(context.Background())
+}
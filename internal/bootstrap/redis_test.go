@@ -0,0 +1,147 @@
+//go:build integration
+
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/eventbus"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/repository/redis"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestInitRepositories_Redis(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{IssuanceQuota: config.IssuanceQuotaConfig{Limit: 100}},
+		Storage: config.StorageConfig{
+			Type:    config.StorageRedis,
+			Config:  config.BackendConfig{Type: config.StorageMemory},
+			APIKeys: config.BackendConfig{Type: config.StorageMemory},
+			Redis:   config.RedisConfig{Addr: mr.Addr()},
+		},
+	}
+	app := &Application{config: cfg, logger: &recordingLogger{}}
+
+	if err := app.initRepositories(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	if _, ok := unwrapSessions(t, app.sessionRepo).(*redis.Repository); !ok {
+		t.Errorf("expected redis session repository, got %T", unwrapSessions(t, app.sessionRepo))
+	}
+	if _, ok := unwrapRegistry(t, app.registryRepo).(*redis.RegistryRepository); !ok {
+		t.Errorf("expected redis registry repository, got %T", unwrapRegistry(t, app.registryRepo))
+	}
+	if _, ok := app.configRepo.(*memory.ConfigRepository); !ok {
+		t.Errorf("expected memory config repository, got %T", app.configRepo)
+	}
+	if _, ok := app.quotaStore.(*redis.QuotaStore); !ok {
+		t.Errorf("expected redis quota store, got %T", app.quotaStore)
+	}
+	if _, ok := app.idempotencyStore.(*redis.IdempotencyStore); !ok {
+		t.Errorf("expected redis idempotency store, got %T", app.idempotencyStore)
+	}
+	if _, ok := app.eventBus.(*eventbus.Shared); !ok {
+		t.Errorf("expected the shared event bus, got %T", app.eventBus)
+	}
+
+	if len(app.cleanup) != 2 {
+		t.Errorf("expected one shared redis connection and the event bus, got %d cleanup funcs", len(app.cleanup))
+	}
+}
+
+func TestApplication_RegistryEventsReachOtherInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	newInstance := func() *Application {
+		cfg := loadFixture(t, "storage_memory.json")
+		cfg.Server.Addr = "127.0.0.1:0"
+		cfg.Storage.Registry.Type = config.StorageRedis
+		cfg.Storage.Events.Type = config.StorageRedis
+		cfg.Storage.Redis = config.RedisConfig{Addr: mr.Addr()}
+		app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+		if err != nil {
+			t.Fatalf("new application: %v", err)
+		}
+		t.Cleanup(func() { app.Stop(context.Background()) })
+		return app
+	}
+	first, second := newInstance(), newInstance()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, app := range []*Application{first, second} {
+		for !app.eventBus.(*eventbus.Shared).Connected() {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the event buses to subscribe")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	ctx := context.Background()
+	revision, _ := second.registryService.Revision(ctx)
+	done := make(chan error, 1)
+	go func() {
+		// Shorter than the recheck, so only the bus can wake it in time
+		waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		_, err := second.registryService.WaitForChange(waitCtx, revision)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if _, _, err := first.registryService.Register(ctx, registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected the other instance's waiter woken by the registration, got %v", err)
+	}
+}
+
+func TestApplication_ReadyPingsRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	cfg := loadFixture(t, "storage_memory.json")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Storage.Sessions.Type = config.StorageRedis
+	cfg.Storage.Redis = config.RedisConfig{Mode: config.RedisModeSingle, Addr: mr.Addr(), PoolSize: 4, DialTimeout: 1}
+
+	app, err := NewApplication(context.Background(), cfg, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new application: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	ready := func() (int, string) {
+		rec := httptest.NewRecorder()
+		app.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		var resp struct {
+			Redis struct {
+				Status string `json:"status"`
+			} `json:"redis"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Redis.Status
+	}
+
+	if code, status := ready(); code != http.StatusOK || status != "up" {
+		t.Errorf("expected ready with redis up, got %d and %q", code, status)
+	}
+
+	mr.Close()
+	if code, status := ready(); code != http.StatusServiceUnavailable || status != "down" {
+		t.Errorf("expected unavailable with redis down, got %d and %q", code, status)
+	}
+}
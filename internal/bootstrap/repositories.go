@@ -0,0 +1,370 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/audit"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/idempotency"
+	"github.com/aq189/bin/internal/domain/quota"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/eventbus"
+	"github.com/aq189/bin/internal/repository/instrument"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/repository/postgres"
+	"github.com/aq189/bin/internal/repository/redis"
+)
+
+var (
+	// ErrUnknownBackend is returned when a storage type is not recognized
+	ErrUnknownBackend = errors.New("unknown storage backend")
+	// ErrUnsupportedBackend is returned when a backend exists but doesn't implement a component
+	ErrUnsupportedBackend = errors.New("storage backend not supported for component")
+)
+
+// connections holds backend connections shared between components.
+// They are opened lazily the first time a component selects the backend.
+type connections struct {
+	redis    *redis.Repository
+	postgres *postgres.Repository
+}
+
+// initRepositories builds the session, registry, config and API key
+// repositories, the idempotency store, the event bus and, when token issuance
+// is capped, the quota store and, when auditing is enabled, the audit
+// repository independently, then restores memory repositories
+// from their snapshot and instruments the session and registry repositories
+func (a *Application) initRepositories(ctx context.Context) error {
+	a.connections = &connections{}
+	a.backends = make(map[string]string)
+	storage := a.config.Storage
+
+	sessionRepo, err := a.newSessionRepository(ctx, a.backendType("sessions", storage.Sessions))
+	if err != nil {
+		return fmt.Errorf("sessions: %w", err)
+	}
+	a.sessionRepo = sessionRepo
+
+	registryRepo, err := a.newRegistryRepository(ctx, a.backendType("registry", storage.Registry))
+	if err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	a.registryRepo = registryRepo
+
+	configRepo, err := a.newConfigRepository(a.backendType("config", storage.Config))
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	a.configRepo = configRepo
+
+	apiKeyRepo, err := a.newAPIKeyRepository(ctx, a.backendType("api_keys", storage.APIKeys))
+	if err != nil {
+		return fmt.Errorf("api keys: %w", err)
+	}
+	a.apiKeyRepo = apiKeyRepo
+
+	if a.config.Auth.IssuanceQuota.Limit > 0 {
+		quotaStore, err := a.newQuotaStore(ctx, a.backendType("quotas", storage.Quotas))
+		if err != nil {
+			return fmt.Errorf("quotas: %w", err)
+		}
+		a.quotaStore = quotaStore
+	}
+
+	idempotencyStore, err := a.newIdempotencyStore(ctx, a.backendTypeBesides("idempotency", storage.Idempotency, config.StoragePostgres))
+	if err != nil {
+		return fmt.Errorf("idempotency: %w", err)
+	}
+	a.idempotencyStore = idempotencyStore
+
+	if a.config.Audit.Enabled {
+		auditRepo, err := a.newAuditRepository(ctx, a.backendTypeBesides("audit", storage.Audit, config.StorageRedis))
+		if err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+		a.auditRepo = auditRepo
+	}
+
+	eventBus, err := a.newEventBus(ctx, a.backendTypeBesides("events", storage.Events, config.StoragePostgres))
+	if err != nil {
+		return fmt.Errorf("events: %w", err)
+	}
+	a.eventBus = eventBus
+
+	if err := a.initSnapshots(); err != nil {
+		return err
+	}
+	a.instrumentRepositories()
+	return nil
+}
+
+// instrumentRepositories wraps the session and registry repositories to
+// record how long their calls take and log slow ones. It runs after the
+// snapshots are set up, which need the memory repositories themselves.
+func (a *Application) instrumentRepositories() {
+	cfg := instrument.Config{
+		MeterProvider: a.meterProvider,
+		SlowThreshold: time.Duration(a.config.Storage.SlowThreshold) * time.Millisecond,
+	}
+	log := a.logger.With("component", "repository")
+	a.sessionRepo = instrument.NewSessionRepository(a.sessionRepo, cfg, log)
+	a.registryRepo = instrument.NewRegistryRepository(a.registryRepo, cfg, log)
+}
+
+// backendType resolves the backend for a component, defaulting to memory
+func (a *Application) backendType(component string, backend config.BackendConfig) string {
+	backendType := a.config.Storage.BackendType(backend)
+	if backendType == "" {
+		a.logger.Warn("no storage backend configured, falling back to memory", "component", component)
+		backendType = config.StorageMemory
+	} else {
+		a.logger.Info("storage backend selected", "component", component, "type", backendType)
+	}
+
+	a.backends[component] = backendType
+	return backendType
+}
+
+// backendTypeBesides is backendType for components the missing backend
+// doesn't implement: when they only inherit it from storage.type they fall
+// back to memory, so such a deployment keeps starting. Set explicitly, the
+// missing backend is returned and refused by the component.
+func (a *Application) backendTypeBesides(component string, backend config.BackendConfig, missing string) string {
+	backendType := a.backendType(component, backend)
+	if backendType == missing && backend.Type == "" {
+		a.logger.Warn("storage backend doesn't implement component, falling back to memory", "component", component, "type", missing)
+		a.backends[component] = config.StorageMemory
+		return config.StorageMemory
+	}
+	return backendType
+}
+
+func (a *Application) newSessionRepository(ctx context.Context, backendType string) (session.SessionRepository, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewSessionRepositoryWithConfig(memory.SessionConfig{
+			MaxSessions: a.config.Storage.Memory.MaxSessions,
+			Shards:      a.config.Storage.Memory.SessionShards,
+			Clock:       a.clock,
+		}), nil
+	case config.StorageRedis:
+		repo, err := a.redisRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	case config.StoragePostgres:
+		repo, err := a.postgresRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.NewSessionRepository(repo), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+func (a *Application) newRegistryRepository(ctx context.Context, backendType string) (service.RegistryRepository, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewRegistryRepository(), nil
+	case config.StoragePostgres:
+		repo, err := a.postgresRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	case config.StorageRedis:
+		repo, err := a.redisRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewRegistryRepository(repo), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+func (a *Application) newConfigRepository(backendType string) (config.ConfigRepository, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewConfigRepository(), nil
+	case config.StorageRedis, config.StoragePostgres:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBackend, backendType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+func (a *Application) newAPIKeyRepository(ctx context.Context, backendType string) (apikey.APIKeyRepository, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewAPIKeyRepository(), nil
+	case config.StoragePostgres:
+		repo, err := a.postgresRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.NewAPIKeyRepository(repo), nil
+	case config.StorageRedis:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBackend, backendType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+func (a *Application) newQuotaStore(ctx context.Context, backendType string) (quota.QuotaStore, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewQuotaStore(), nil
+	case config.StorageRedis:
+		repo, err := a.redisRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewQuotaStore(repo), nil
+	case config.StoragePostgres:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBackend, backendType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+func (a *Application) newIdempotencyStore(ctx context.Context, backendType string) (idempotency.IdempotencyStore, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewIdempotencyStore(), nil
+	case config.StorageRedis:
+		repo, err := a.redisRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewIdempotencyStore(repo), nil
+	case config.StoragePostgres:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBackend, backendType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+func (a *Application) newAuditRepository(ctx context.Context, backendType string) (audit.AuditRepository, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return memory.NewAuditRepository(a.config.Audit.MaxEvents), nil
+	case config.StoragePostgres:
+		repo, err := a.postgresRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.NewAuditRepository(repo), nil
+	case config.StorageRedis:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBackend, backendType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+// newEventBus returns the bus registry events travel on. The redis bus runs
+// until the application stops, and stops before the Redis connection closes.
+func (a *Application) newEventBus(ctx context.Context, backendType string) (event.Bus, error) {
+	switch backendType {
+	case config.StorageMemory:
+		return eventbus.NewLocal(), nil
+	case config.StorageRedis:
+		repo, err := a.redisRepository(ctx)
+		if err != nil {
+			return nil, err
+		}
+		bus := eventbus.NewShared(redis.NewEventTransport(repo), eventbus.Config{}, a.logger.With("component", "events"))
+		a.startBackground("event bus", bus.Start)
+		return bus, nil
+	case config.StoragePostgres:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedBackend, backendType)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backendType)
+	}
+}
+
+// redisRepository returns the shared Redis connection, opening it on first use
+func (a *Application) redisRepository(ctx context.Context) (*redis.Repository, error) {
+	if a.connections.redis != nil {
+		return a.connections.redis, nil
+	}
+
+	cfg := a.config.Storage.Redis
+	repo, err := redis.NewRepository(ctx, redis.Config{
+		Mode:         cfg.Mode,
+		Addr:         cfg.Addr,
+		Addrs:        cfg.Addrs,
+		MasterName:   cfg.MasterName,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  time.Duration(cfg.DialTimeout) * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect redis: %w", err)
+	}
+
+	a.connections.redis = repo
+	a.addCleanup("redis", ignoreContext(repo.Close))
+	return repo, nil
+}
+
+// postgresRepository returns the shared PostgreSQL connection, opening it and
+// applying pending migrations on first use
+func (a *Application) postgresRepository(ctx context.Context) (*postgres.Repository, error) {
+	if a.connections.postgres != nil {
+		return a.connections.postgres, nil
+	}
+
+	repo, err := postgres.NewRepository(ctx, postgresConfig(a.config.Storage.Postgres))
+	if err != nil {
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+	applied, err := repo.Migrate(ctx)
+	for _, m := range applied {
+		a.logger.Info("postgres migration applied", "migration", m.String())
+	}
+	if err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("migrate postgres: %w", err)
+	}
+
+	a.connections.postgres = repo
+	a.addCleanup("postgres", ignoreContext(repo.Close))
+	return repo, nil
+}
+
+// postgresConfig converts the storage.postgres settings
+func postgresConfig(cfg config.PostgresConfig) postgres.Config {
+	return postgres.Config{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Database: cfg.Database,
+	}
+}
+
+// MigratePostgres applies the pending migrations to the database of
+// cfg.Storage.Postgres, or with dryRun only lists them
+func MigratePostgres(ctx context.Context, cfg *config.Config, dryRun bool) ([]postgres.Migration, error) {
+	repo, err := postgres.NewRepository(ctx, postgresConfig(cfg.Storage.Postgres))
+	if err != nil {
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+	defer repo.Close()
+
+	if dryRun {
+		return repo.PendingMigrations(ctx)
+	}
+	return repo.Migrate(ctx)
+}
@@ -0,0 +1,61 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/pkg/jwt"
+)
+
+// NewJWTManager returns the manager signing tokens with the primary secret
+// of cfg and validating them with any of its secrets, up to the size cap of
+// cfg; nil c uses the system clock
+func NewJWTManager(cfg config.JWTConfig, c clock.Clock) (*jwt.Manager, error) {
+	ids, err := idgen.New(cfg.IDFormat, c)
+	if err != nil {
+		return nil, fmt.Errorf("jwt.id_format: %w", err)
+	}
+	return jwt.New(jwt.Config{Secrets: jwtSecrets(cfg), Issuer: TokenIssuer, MaxTokenBytes: cfg.MaxTokenBytes, IDs: ids, Clock: c}), nil
+}
+
+// ReloadJWTSecrets switches to the signing secrets of cfg without a restart,
+// typically on SIGHUP: new tokens are signed with its primary secret and
+// tokens signed with a secret it no longer lists are refused. Secrets
+// preflight would refuse at startup are refused, keeping those in use.
+func (a *Application) ReloadJWTSecrets(cfg config.JWTConfig) error {
+	var report preflightReport
+	checkJWTSecret(&report, cfg)
+	if len(report.errors) > 0 {
+		return fmt.Errorf("%w: %s", ErrPreflight, strings.Join(report.errors, "; "))
+	}
+	if err := a.authService.SetSigningSecrets(jwtSecrets(cfg)); err != nil {
+		return fmt.Errorf("set jwt secrets: %w", err)
+	}
+
+	ids := make([]string, 0, len(cfg.Secrets))
+	primary := ""
+	for _, secret := range cfg.Secrets {
+		ids = append(ids, secret.ID)
+		if secret.Primary {
+			primary = secret.ID
+		}
+	}
+	if len(report.warnings) > 0 {
+		a.logger.Warn("reloaded jwt secrets have problems", "warnings", report.warnings)
+	}
+	a.logger.Info("jwt secrets reloaded", "secret_ids", ids, "primary", primary)
+	return nil
+}
+
+// jwtSecrets converts the configured secrets for jwt.Config
+func jwtSecrets(cfg config.JWTConfig) []jwt.SecretVersion {
+	configured := cfg.SigningSecrets()
+	secrets := make([]jwt.SecretVersion, len(configured))
+	for i, secret := range configured {
+		secrets[i] = jwt.SecretVersion{ID: secret.ID, Value: secret.Value, Primary: secret.Primary}
+	}
+	return secrets
+}
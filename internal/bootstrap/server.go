@@ -0,0 +1,275 @@
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/handler"
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/server"
+)
+
+const (
+	// adminRequestTimeout replaces the default request timeout on slow admin operations
+	adminRequestTimeout = time.Minute
+	// adminConnTimeout replaces the server's read and write timeouts on slow
+	// admin operations; it outlasts adminRequestTimeout so the timeout
+	// response can still be written
+	adminConnTimeout = adminRequestTimeout + 10*time.Second
+	// apiPrefix is the path prefix of the current API version
+	apiPrefix = "/v1"
+	// defaultIdempotencyTTL is how long responses are replayed for their
+	// idempotency key when server.idempotency.ttl is unset
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// initServer creates the HTTP server with the global middleware chain and routes
+func (a *Application) initServer() error {
+	cfg := a.config.Server
+
+	accessLog, err := a.openAccessLog()
+	if err != nil {
+		return err
+	}
+
+	// Recovery must sit inside Logger so recovered panics reach the access log,
+	// and Compression between them so the log sees compressed sizes and
+	// recovered panics are answered through the compressor. BodyLog sits
+	// inside Compression to see response bodies before they are gzipped.
+	requestIDs, err := idgen.New(cfg.RequestIDFormat, a.clock)
+	if err != nil {
+		return fmt.Errorf("server.request_id_format: %w", err)
+	}
+	a.inFlight = middleware.NewInFlight()
+	chain := middleware.NewChain().
+		Use(middleware.Identity, "request_id", middleware.RequestID(requestIDs)).
+		Use(middleware.Identity, "client_certificate", middleware.ClientCertificate()).
+		Use(middleware.Observability, "in_flight", middleware.TrackInFlight(a.inFlight))
+	if a.tracerProvider != nil {
+		chain.Use(middleware.Observability, "tracing", middleware.Tracing(a.tracerProvider))
+	}
+	chain.
+		Use(middleware.Observability, "logger", middleware.Logger(a.logger, a.config.Log.HTTP, accessLog)).
+		Use(middleware.Observability, "compression", middleware.Compression(cfg.Compression)).
+		Use(middleware.Observability, "body_log", middleware.BodyLog(a.logger, a.config.Log)).
+		Use(middleware.Protection, "security_headers", middleware.SecurityHeaders(cfg.SecurityHeaders)).
+		Use(middleware.Protection, "recovery", middleware.Recovery(a.logger)).
+		Use(middleware.Protection, "cors", middleware.CORS(cfg.CORS)).
+		Use(middleware.Custom, "maintenance", middleware.Maintenance(a.maintenanceService, a.clock, maintenanceExemptRoutes()...))
+
+	middlewares, err := chain.Build()
+	if err != nil {
+		return fmt.Errorf("build middleware chain: %w", err)
+	}
+	a.middleware = chain.Names()
+
+	socketMode, err := cfg.Listener.FileMode()
+	if err != nil {
+		return fmt.Errorf("listener: %w", err)
+	}
+	srv, err := server.New(server.Config{
+		Addr:          cfg.Addr,
+		ReadTimeout:   time.Duration(cfg.ReadTimeout) * time.Second,
+		WriteTimeout:  time.Duration(cfg.WriteTimeout) * time.Second,
+		IdleTimeout:   time.Duration(cfg.IdleTimeout) * time.Second,
+		ShutdownGrace: time.Duration(cfg.ShutdownGrace) * time.Second,
+		// Caps the read and write timeouts slow routes extend theirs to
+		MaxRouteTimeout: time.Duration(cfg.MaxRouteTimeout) * time.Second,
+		Listener: server.ListenerConfig{
+			Mode:        server.ListenerMode(cfg.Listener.Mode),
+			SocketPath:  cfg.Listener.SocketPath,
+			SocketMode:  socketMode,
+			SocketOwner: cfg.Listener.SocketOwner,
+			SocketGroup: cfg.Listener.SocketGroup,
+		},
+		TLS: server.TLSConfig{
+			Enabled:      cfg.TLS.Enabled,
+			CertFile:     cfg.TLS.CertFile,
+			KeyFile:      cfg.TLS.KeyFile,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+			ClientAuth:   server.ClientAuth(cfg.TLS.ClientAuth),
+		},
+		Middlewares: middlewares,
+	})
+	if err != nil {
+		return fmt.Errorf("create server: %w", err)
+	}
+
+	a.server = srv
+	a.streams = middleware.NewStreamLimiter(cfg.Streams.MaxConcurrent)
+	a.eventStream = server.EventStreamConfig{
+		KeepAlive:   time.Duration(cfg.Streams.KeepAlive) * time.Second,
+		IdleTimeout: time.Duration(cfg.Streams.IdleTimeout) * time.Second,
+	}
+	a.registerRoutes()
+
+	return nil
+}
+
+// registerRoutes mounts all HTTP handlers. Probes live at the root; the API
+// is mounted under apiPrefix and again at the root as deprecated aliases.
+// Every route carries the default request timeout and the server's read and
+// write timeouts; routes needing longer ones are registered on a group with
+// its own middleware.Timeout and route timeouts instead. Streaming
+// routes leave it out, pass server.NoWriteTimeout() and
+// middleware.Streams(a.streams), and serve their responses with
+// server.ServeEvents(w, r, events, a.eventStream).
+func (a *Application) registerRoutes() {
+	timeout := middleware.Timeout(time.Duration(a.config.Server.RequestTimeout) * time.Second)
+
+	sessionStats, _ := a.sessionRepo.(session.StatsReporter)
+	var tokenCache handler.TokenCacheReporter
+	if a.config.Auth.TokenCacheSize > 0 {
+		tokenCache = a.authService
+	}
+	var webhooks handler.WebhookReporter
+	if a.webhookService != nil {
+		webhooks = a.webhookService
+	}
+	var callbacks handler.WebhookReporter
+	if a.sessionCallbacks != nil {
+		callbacks = a.sessionCallbacks
+	}
+	var quota handler.IssuanceQuotaReporter
+	if a.config.Auth.IssuanceQuota.Limit > 0 {
+		quota = a.authService
+	}
+	var redis handler.Pinger
+	if a.connections.redis != nil {
+		redis = a.connections.redis
+	}
+	health := handler.NewHealthHandler(a.startedAt, sessionStats, tokenCache, webhooks, callbacks, quota, redis)
+	probes := a.server.Group("", timeout)
+	probes.GET("/health", health.Health)
+	probes.GET("/ready", health.Ready)
+	probes.GET("/version", health.Version)
+
+	a.registerAPI(a.server.Group(apiPrefix), timeout)
+	a.registerAPI(a.server.Group("", middleware.Deprecated(a.logger, apiPrefix)), timeout)
+
+	if a.config.Server.UI.Enabled {
+		a.registerDashboard(timeout)
+	}
+}
+
+// registerDashboard mounts the web dashboard under /ui, at the root only. The
+// login form and stylesheet are public; the pages authenticate with the
+// cookie the login form sets and, like admin routes, refuse scoped tokens and
+// callers without the admin role.
+func (a *Application) registerDashboard(timeout server.Middleware) {
+	dashboard := handler.NewDashboardHandler(a.authService, a.registryService, a.sessionService, time.Duration(a.config.Server.UI.RefreshInterval)*time.Second)
+
+	ui := a.server.Group("/ui", timeout)
+	ui.GET("/login", dashboard.LoginForm)
+	ui.POST("/login", dashboard.Login, server.Sensitive())
+	ui.POST("/logout", dashboard.Logout)
+	ui.GET("/style.css", dashboard.Stylesheet)
+
+	pages := ui.Group("",
+		middleware.AuthenticateCookie(a.authService, handler.DashboardCookie, handler.DashboardLoginPath),
+		middleware.RejectScoped(),
+		middleware.RequireRole(token.RoleAdmin))
+	pages.GET("/", dashboard.Services)
+	pages.GET("/services/", dashboard.Service)
+}
+
+// registerAPI mounts the API handlers on api. Each route is registered on the
+// group for who may call it, so it can't be left unauthenticated by
+// forgetting its middleware:
+//   - public routes need no credentials;
+//   - scoped routes authenticate and each passes middleware.RequireScope;
+//   - authenticated routes authenticate and refuse scoped tokens;
+//   - admin routes also require the admin role.
+//
+// Creating routes clients retry take middleware.Idempotency, so a retried
+// request carrying an Idempotency-Key gets the first response back. Routes
+// whose bodies carry tokens or secrets pass server.Sensitive, so they are
+// never logged.
+//
+// Group middleware runs before route middleware, so the timeout is group
+// middleware too and also bounds authentication. Routes with another timeout
+// are registered on groups of their own, which also extend the server's read
+// and write timeouts with server.WithReadTimeout and server.WithWriteTimeout
+// when the request timeout outlasts them.
+func (a *Application) registerAPI(api *server.Group, timeout server.Middleware) {
+	authenticate := middleware.Authenticate(a.authService)
+	rejectScoped := middleware.RejectScoped()
+	requireAdmin := middleware.RequireRole(token.RoleAdmin)
+
+	public := api.Group("", timeout)
+	scoped := public.Group("", authenticate)
+	authenticated := scoped.Group("", rejectScoped)
+	admin := authenticated.Group("", requireAdmin)
+	slowAdmin := api.Group("", server.WithReadTimeout(adminConnTimeout), server.WithWriteTimeout(adminConnTimeout),
+		middleware.Timeout(adminRequestTimeout), authenticate, rejectScoped, requireAdmin)
+	idempotent := middleware.Idempotency(a.idempotencyStore, a.idempotencyTTL(), a.clock)
+
+	authHandler := handler.NewAuthHandler(a.authService)
+	sensitive := server.Sensitive()
+	public.POST("/auth/refresh", authHandler.RefreshToken, sensitive)
+	authenticated.POST("/auth/token", authHandler.IssueToken, sensitive)
+	authenticated.POST("/auth/validate", authHandler.ValidateToken, sensitive)
+	authenticated.POST("/auth/revoke", authHandler.RevokeToken, sensitive)
+	authenticated.GET("/auth/quota", authHandler.Quota)
+	admin.POST("/auth/apikeys", authHandler.CreateAPIKey)
+	admin.DELETE("/auth/apikeys/", authHandler.RevokeAPIKey)
+
+	sessionHandler := handler.NewSessionHandler(a.sessionService)
+	scoped.POST("/session", sessionHandler.Create, middleware.RequireScope("session:write"), idempotent)
+	scoped.POST("/session/get-or-create", sessionHandler.GetOrCreate, middleware.RequireScope("session:write"))
+	scoped.GET("/session", sessionHandler.List, middleware.RequireScope("session:read"))
+	scoped.GET("/session/", sessionHandler.Get, middleware.RequireScope("session:read:{id}"))
+	scoped.HEAD("/session/", sessionHandler.Head, middleware.RequireScope("session:read:{id}"))
+	scoped.PUT("/session/", sessionHandler.Update, middleware.RequireScope("session:write:{id}"))
+	scoped.DELETE("/session/", sessionHandler.Delete, middleware.RequireScope("session:write:{id}"))
+	slowAdmin.POST("/admin/sessions/cleanup", sessionHandler.Cleanup)
+
+	registryHandler := handler.NewRegistryHandler(a.registryService)
+	longPoll := api.Group("", middleware.LongPoll(time.Duration(a.config.Server.RequestTimeout)*time.Second, a.registryService.MaxDiscoverWait()), authenticate, rejectScoped)
+	authenticated.POST("/registry/register", registryHandler.Register, idempotent)
+	authenticated.DELETE("/registry/deregister/", registryHandler.Deregister)
+	authenticated.GET("/registry/services", registryHandler.List)
+	authenticated.GET("/registry/services/", registryHandler.Get)
+	longPoll.GET("/registry/discover", registryHandler.Discover)
+	authenticated.GET("/registry/graph", registryHandler.Graph)
+	authenticated.GET("/registry/impact/", registryHandler.Impact)
+	scoped.PUT("/registry/heartbeat/", registryHandler.Heartbeat, middleware.RequireScope("registry:heartbeat:{id}"))
+	admin.PUT("/registry/services/", registryHandler.SetStatus)
+	admin.POST("/registry/services/", registryHandler.Restore)
+	slowAdmin.GET("/admin/registry/export", registryHandler.Export)
+	slowAdmin.POST("/admin/registry/import", registryHandler.Import)
+	admin.GET("/admin/registry/schemas", registryHandler.ListSchemas)
+	admin.GET("/admin/registry/schemas/", registryHandler.GetSchema)
+	admin.PUT("/admin/registry/schemas/", registryHandler.PutSchema)
+	admin.DELETE("/admin/registry/schemas/", registryHandler.DeleteSchema)
+
+	maintenanceHandler := handler.NewMaintenanceHandler(a.maintenanceService)
+	admin.GET("/admin/maintenance", maintenanceHandler.Get)
+	admin.POST("/admin/maintenance", maintenanceHandler.Set)
+
+	statsHandler := handler.NewStatsHandler(a.startedAt, a.sessionService, a.authService, a.registryService)
+	admin.GET("/admin/stats", statsHandler.Stats)
+
+	if a.webhookService != nil {
+		webhookHandler := handler.NewWebhookHandler(a.webhookService)
+		admin.GET("/admin/webhooks", webhookHandler.List)
+		admin.POST("/admin/webhooks", webhookHandler.Create, sensitive)
+		admin.DELETE("/admin/webhooks/", webhookHandler.Delete)
+	}
+
+	if a.auditService != nil {
+		auditHandler := handler.NewAuditHandler(a.auditService)
+		slowAdmin.GET("/audit/events", auditHandler.Events)
+	}
+}
+
+// idempotencyTTL returns how long responses are replayed for their idempotency key
+func (a *Application) idempotencyTTL() time.Duration {
+	if ttl := a.config.Server.Idempotency.TTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultIdempotencyTTL
+}
@@ -0,0 +1,189 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/encryption"
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/registry"
+	sessionsvc "github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/internal/stats"
+	"github.com/aq189/bin/pkg/tracing"
+)
+
+// TokenIssuer is the iss claim of every token minted by the root server,
+// whether issued over the API or locally with "root token issue"
+const TokenIssuer = "root-server"
+
+// bootstrapKeyName names the API key seeded from configuration
+const bootstrapKeyName = "bootstrap"
+
+// initServices builds the application services on top of the repositories
+func (a *Application) initServices(ctx context.Context) error {
+	if err := a.initMaintenance(); err != nil {
+		return fmt.Errorf("maintenance mode: %w", err)
+	}
+
+	events, err := a.initWebhooks()
+	if err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+
+	recorder, err := a.initJournal()
+	if err != nil {
+		return fmt.Errorf("registry journal: %w", err)
+	}
+	if auditor := a.initAudit(); auditor != nil {
+		if recorder != nil {
+			recorder = journal.Recorders{recorder, auditor}
+		} else {
+			recorder = auditor
+		}
+	}
+
+	targets, err := registry.NewTargetPolicy(a.config.Registry.HealthCheck.AllowedCIDRs)
+	if err != nil {
+		return fmt.Errorf("registry health check policy: %w", err)
+	}
+	registryConfig := registry.Config{
+		HealthCheckInterval: time.Duration(a.config.Registry.HealthCheckInterval) * time.Second,
+		HealthCheckTimeout:  time.Duration(a.config.Registry.HealthCheckTimeout) * time.Second,
+		MinCheckInterval:    time.Duration(a.config.Registry.MinCheckInterval) * time.Second,
+		MaxCheckInterval:    time.Duration(a.config.Registry.MaxCheckInterval) * time.Second,
+		HealthCheckWorkers:  a.config.Registry.HealthCheckWorkers,
+		HeartbeatTimeout:    time.Duration(a.config.Registry.HeartbeatTimeout) * time.Second,
+		DeletedRetention:    time.Duration(a.config.Registry.DeletedRetention) * time.Second,
+		MaxDiscoverWait:     time.Duration(a.config.Registry.MaxDiscoverWait) * time.Second,
+		HealthHistorySize:   a.config.Registry.HealthHistorySize,
+		TargetPolicy:        targets,
+		HealthWriteRate:     a.config.Registry.HealthCheck.MaxWritesPerSecond,
+		HealthWriteBatch:    a.config.Registry.HealthCheck.WriteBatchSize,
+		HealthWriteDelay:    time.Duration(a.config.Registry.HealthCheck.WriteBatchDelay) * time.Millisecond,
+		Events:              events,
+		Bus:                 a.eventBus,
+		Journal:             recorder,
+		Registered:          new(stats.Counter),
+		Schemas:             a.configRepo,
+		MeterProvider:       a.meterProvider,
+		Clock:               a.clock,
+	}
+	if a.tracerProvider != nil {
+		registryConfig.HealthCheckTransport = tracing.Transport(targets.Transport(), a.tracerProvider)
+	}
+	a.registryService = registry.NewService(a.registryRepo, registryConfig, a.logger.With("component", "registry"))
+	a.startBackground("registry health checks", a.registryService.StartHealthChecks)
+	a.startBackground("registry purge", a.registryService.StartPurge)
+	if err := a.initDNS(); err != nil {
+		return fmt.Errorf("dns server: %w", err)
+	}
+
+	// Built after the registry, which it checks token audiences against
+	jwtManager, err := NewJWTManager(a.config.JWT, a.clock)
+	if err != nil {
+		return err
+	}
+
+	a.authService = auth.NewService(jwtManager, a.apiKeyRepo, auth.Config{
+		AccessTokenTTL:      time.Duration(a.config.JWT.AccessTokenTTL) * time.Minute,
+		RefreshTokenTTL:     time.Duration(a.config.JWT.RefreshTokenTTL) * time.Hour,
+		ValidationCacheSize: a.config.Auth.TokenCacheSize,
+		Quota: auth.IssuanceQuota{
+			Limit:  a.config.Auth.IssuanceQuota.Limit,
+			Window: time.Duration(a.config.Auth.IssuanceQuota.Window) * time.Second,
+			Exempt: a.config.Auth.IssuanceQuota.Exempt,
+			Store:  a.quotaStore,
+		},
+		Issued:                 new(stats.Counter),
+		Services:               a.registryService,
+		RejectUnknownAudiences: a.config.Auth.UnknownAudience == config.AudienceReject,
+		Clock:                  a.clock,
+	}, a.logger.With("component", "auth"))
+
+	if key := a.config.Auth.BootstrapAPIKey; key != "" {
+		ttl := time.Duration(a.config.Auth.BootstrapAPIKeyTTL) * time.Hour
+		if err := a.authService.EnsureAPIKey(ctx, bootstrapKeyName, key, []string{token.RoleAdmin}, ttl); err != nil {
+			return fmt.Errorf("seed bootstrap api key: %w", err)
+		}
+	}
+
+	keyring, err := sessionKeyring(a.config.Session.Encryption)
+	if err != nil {
+		return fmt.Errorf("session encryption: %w", err)
+	}
+	sessionIDs, err := idgen.New(a.config.Session.IDFormat, a.clock)
+	if err != nil {
+		return fmt.Errorf("session.id_format: %w", err)
+	}
+	sessionConfig := sessionsvc.Config{
+		DefaultTTL:         time.Duration(a.config.Session.DefaultTTL) * time.Minute,
+		CleanupPeriod:      time.Duration(a.config.Session.CleanupPeriod) * time.Minute,
+		MaxTTL:             time.Duration(a.config.Session.MaxTTL) * time.Minute,
+		MaxDataBytes:       a.config.Session.MaxDataBytes,
+		Keyring:            keyring,
+		MaxSessionsPerUser: a.config.Session.MaxPerUser,
+		IDs:                sessionIDs,
+		Created:            new(stats.Counter),
+		Expired:            new(stats.Counter),
+		Clock:              a.clock,
+	}
+	var sessionEvents event.Publishers
+	if a.config.Webhooks.SessionEvents && events != nil {
+		sessionEvents = append(sessionEvents, events)
+	}
+	if callbacks := a.initSessionCallbacks(targets); callbacks != nil {
+		sessionEvents = append(sessionEvents, callbacks)
+	}
+	if len(sessionEvents) > 0 {
+		sessionConfig.Events = sessionEvents
+	}
+	a.sessionService = sessionsvc.NewService(a.sessionRepo, sessionConfig, a.logger.With("component", "session"))
+	a.startBackground("session cleanup", a.sessionService.StartCleanup)
+
+	return nil
+}
+
+// sessionKeyring builds the keyring for session data encryption, or returns
+// nil when encryption is disabled
+func sessionKeyring(cfg config.SessionEncryptionConfig) (*encryption.Keyring, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	primary, err := encryption.ParseKey(cfg.KeyID, cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	previous := make([]encryption.Key, 0, len(cfg.PreviousKeys))
+	for _, k := range cfg.PreviousKeys {
+		key, err := encryption.ParseKey(k.KeyID, k.Key)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	return encryption.NewKeyring(primary, previous...)
+}
+
+// startBackground runs fn until Stop cancels its context, then waits for it to return
+func (a *Application) startBackground(name string, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+
+	a.addCleanup(name, func(context.Context) error {
+		cancel()
+		<-done
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultCleanupTimeout bounds each cleanup step on Stop
+const defaultCleanupTimeout = 10 * time.Second
+
+// cleanupStep releases one resource on Stop
+type cleanupStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// runStep runs fn with a timeout derived from ctx. A step that does not return
+// in time is abandoned so one hung resource cannot block the rest of shutdown.
+func runStep(ctx context.Context, timeout time.Duration, name string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", name, ctx.Err())
+	}
+}
+
+// ignoreContext adapts a close function that takes no context to a cleanup step
+func ignoreContext(fn func() error) func(ctx context.Context) error {
+	return func(context.Context) error {
+		return fn()
+	}
+}
@@ -0,0 +1,62 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/repository/memory"
+)
+
+// defaultSnapshotInterval is used when storage.memory.snapshot_interval is unset
+const defaultSnapshotInterval = time.Minute
+
+// initSnapshots restores the memory repositories from the configured snapshot
+// file and saves them periodically and once more on Stop. Components stored
+// in other backends are not part of the snapshot.
+func (a *Application) initSnapshots() error {
+	cfg := a.config.Storage.Memory
+	if cfg.SnapshotPath == "" {
+		return nil
+	}
+
+	sessions, _ := a.sessionRepo.(*memory.SessionRepository)
+	registry, _ := a.registryRepo.(*memory.RegistryRepository)
+	configs, _ := a.configRepo.(*memory.ConfigRepository)
+	if sessions == nil && registry == nil && configs == nil {
+		a.logger.Warn("memory snapshots configured but no component uses the memory backend", "path", cfg.SnapshotPath)
+		return nil
+	}
+
+	snapshots := memory.NewSnapshotter(cfg.SnapshotPath, sessions, registry, configs)
+	stats, err := snapshots.Load()
+	if err != nil {
+		return fmt.Errorf("load snapshot: %w", err)
+	}
+	a.logger.Info("memory snapshot restored", "path", cfg.SnapshotPath,
+		"sessions", stats.Sessions, "expired_sessions", stats.Expired, "services", stats.Services, "configs", stats.Configs)
+
+	interval := time.Duration(cfg.SnapshotInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+
+	// Registered before the periodic job so it runs after the job has stopped
+	a.addCleanup("memory snapshot", ignoreContext(snapshots.Save))
+	a.startBackground("memory snapshots", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := snapshots.Save(); err != nil {
+					a.logger.Error("memory snapshot failed", "path", cfg.SnapshotPath, "error", err)
+				}
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,49 @@
+package bootstrap
+
+// logStartupSummary logs, in one entry, the bound address, the storage
+// backend of each component, the global middleware, the optional features in
+// use and the configuration with its secrets redacted, so the settings a
+// running server picked up can be read from a single line
+func (a *Application) logStartupSummary() {
+	a.logger.Info("startup summary",
+		"addr", a.Addr(),
+		"tls", a.config.Server.TLS.Enabled,
+		"storage", a.backends,
+		"middleware", a.middleware,
+		"features", a.features(),
+		"config", a.config.Redacted(),
+	)
+}
+
+// features names the optional features the configuration enables
+func (a *Application) features() []string {
+	cfg := a.config
+	enabled := []struct {
+		name string
+		on   bool
+	}{
+		{"security_headers", cfg.Server.SecurityHeaders.Enabled},
+		{"compression", cfg.Server.Compression.Enabled},
+		{"cors", cfg.Server.CORS.Enabled},
+		{"dashboard", cfg.Server.UI.Enabled},
+		{"tracing", a.tracerProvider != nil},
+		{"metrics", a.meterProvider != nil},
+		{"token_cache", cfg.Auth.TokenCacheSize > 0},
+		{"issuance_quota", cfg.Auth.IssuanceQuota.Limit > 0},
+		{"session_encryption", cfg.Session.Encryption.Enabled},
+		{"registry_journal", cfg.Registry.Journal.Path != ""},
+		{"dns", a.dnsServer != nil},
+		{"audit", a.auditService != nil},
+		{"webhooks", a.webhookService != nil},
+		{"session_callbacks", a.sessionCallbacks != nil},
+		{"memory_snapshots", cfg.Storage.Memory.SnapshotPath != ""},
+	}
+
+	var names []string
+	for _, f := range enabled {
+		if f.on {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
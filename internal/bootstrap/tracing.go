@@ -0,0 +1,59 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// defaultTracingServiceName is reported on spans when the configuration leaves it unset
+const defaultTracingServiceName = "root-server"
+
+// tracingShutdownTimeout bounds the final span flush on Stop
+const tracingShutdownTimeout = 5 * time.Second
+
+// initTracing installs an OTLP tracer provider when tracing is enabled.
+// Otherwise tracerProvider stays nil and no tracing middleware is mounted.
+func (a *Application) initTracing(ctx context.Context) error {
+	cfg := a.config.Observability.Tracing
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("create otlp exporter: %w", err)
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = defaultTracingServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(name))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	a.tracerProvider = provider
+	a.addCleanup("tracing", func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, tracingShutdownTimeout)
+		defer cancel()
+		return provider.Shutdown(ctx)
+	})
+
+	a.logger.Info("tracing enabled", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return nil
+}
@@ -0,0 +1,76 @@
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/internal/service/webhook"
+	"github.com/aq189/bin/pkg/tracing"
+)
+
+// initWebhooks creates the webhook service when webhooks are enabled, seeds
+// the configured targets and starts the delivery workers. It returns the
+// publisher services send their events to, or nil when webhooks are disabled.
+func (a *Application) initWebhooks() (event.Publisher, error) {
+	cfg := a.config.Webhooks
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	webhookConfig := webhook.Config{
+		QueueSize:   cfg.QueueSize,
+		Workers:     cfg.Workers,
+		MaxAttempts: cfg.MaxAttempts,
+		Timeout:     time.Duration(cfg.Timeout) * time.Second,
+	}
+	if a.tracerProvider != nil {
+		webhookConfig.Transport = tracing.Transport(nil, a.tracerProvider)
+	}
+	a.webhookService = webhook.NewService(a.configRepo, webhookConfig, a.logger.With("component", "webhooks"))
+
+	for _, target := range cfg.Targets {
+		err := a.webhookService.EnsureTarget(webhook.Target{
+			ID:     target.ID,
+			URL:    target.URL,
+			Events: target.Events,
+			Secret: target.Secret,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("seed webhook target %s: %w", target.ID, err)
+		}
+	}
+
+	// Started before the services publishing into it, so it stops after them
+	a.startBackground("webhook delivery", a.webhookService.Start)
+	return a.webhookService, nil
+}
+
+// initSessionCallbacks creates the dispatcher POSTing session.ended events to
+// the callback URLs services register when session callbacks are enabled,
+// and starts its workers. Callbacks go through the registry's health check
+// target policy, so registrants can't make the server reach addresses its
+// health checks may not. It returns nil when session callbacks are disabled.
+func (a *Application) initSessionCallbacks(targets *registry.TargetPolicy) event.Publisher {
+	cfg := a.config.Session.Callbacks
+	if !cfg.Enabled {
+		return nil
+	}
+
+	callbackConfig := webhook.Config{
+		QueueSize:   cfg.QueueSize,
+		Workers:     cfg.Workers,
+		MaxAttempts: cfg.MaxAttempts,
+		Timeout:     time.Duration(cfg.Timeout) * time.Second,
+		Transport:   targets.Transport(),
+	}
+	if a.tracerProvider != nil {
+		callbackConfig.Transport = tracing.Transport(callbackConfig.Transport, a.tracerProvider)
+	}
+	a.sessionCallbacks = webhook.NewCallbacks(a.registryService, callbackConfig, a.logger.With("component", "session-callbacks"))
+
+	// Started before the session service publishing into it, so it stops after it
+	a.startBackground("session callbacks", a.sessionCallbacks.Start)
+	return a.sessionCallbacks
+}
@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrReal(t *testing.T) {
+	if _, ok := OrReal(nil).(Real); !ok {
+		t.Error("OrReal(nil) is not Real")
+	}
+	fake := NewFake(time.Unix(0, 0))
+	if OrReal(fake) != fake {
+		t.Error("OrReal(fake) did not return fake")
+	}
+}
+
+func TestFake_Now(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+
+	fake.Advance(time.Minute)
+	if got, want := fake.Now(), start.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("Now() after Advance = %v, want %v", got, want)
+	}
+
+	fake.Set(start)
+	if got := fake.Now(); !got.Equal(start) {
+		t.Errorf("Now() after Set = %v, want %v", got, start)
+	}
+}
+
+func TestFake_NewTicker(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		advance   []time.Duration
+		wantTicks int
+	}{
+		{name: "before the interval", advance: []time.Duration{9 * time.Second}, wantTicks: 0},
+		{name: "at the interval", advance: []time.Duration{10 * time.Second}, wantTicks: 1},
+		{name: "in steps", advance: []time.Duration{6 * time.Second, 6 * time.Second}, wantTicks: 1},
+		{name: "several intervals at once drop ticks", advance: []time.Duration{35 * time.Second}, wantTicks: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFake(start)
+			ticker := fake.NewTicker(10 * time.Second)
+			defer ticker.Stop()
+
+			for _, d := range tt.advance {
+				fake.Advance(d)
+			}
+
+			ticks := 0
+			for len(ticker.C()) > 0 {
+				<-ticker.C()
+				ticks++
+			}
+			if ticks != tt.wantTicks {
+				t.Errorf("got %d ticks, want %d", ticks, tt.wantTicks)
+			}
+		})
+	}
+}
+
+func TestFake_TickerScheduleAfterSkip(t *testing.T) {
+	fake := NewFake(time.Unix(0, 0))
+	ticker := fake.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	fake.Advance(25 * time.Second)
+	<-ticker.C()
+
+	fake.Advance(4 * time.Second)
+	if len(ticker.C()) != 0 {
+		t.Fatal("ticked before the next interval at 30s")
+	}
+	fake.Advance(time.Second)
+	if len(ticker.C()) != 1 {
+		t.Error("did not tick at 30s")
+	}
+}
+
+func TestFake_TickerStop(t *testing.T) {
+	fake := NewFake(time.Unix(0, 0))
+	ticker := fake.NewTicker(time.Second)
+	ticker.Stop()
+
+	fake.Advance(time.Minute)
+	if len(ticker.C()) != 0 {
+		t.Error("stopped ticker fired")
+	}
+}
@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/internal/repository"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when no API key matches an ID or hash
+	ErrAPIKeyNotFound = fmt.Errorf("api key %w", repository.ErrNotFound)
+	// ErrAPIKeyExists is returned by repositories when a key's ID or hash is already stored
+	ErrAPIKeyExists = fmt.Errorf("api key %w", repository.ErrDuplicate)
+)
+
+// Prefix marks a bearer credential as an API key rather than a JWT
+const Prefix = "rk_"
+
+// APIKey represents a long-lived credential for service-to-service calls.
+// Only the SHA-256 hash of the key is stored; the plaintext is shown once at creation.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"-"`
+	Roles     []string   `json:"roles"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsExpired checks if the key has passed its expiry by now
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && now.After(*k.ExpiresAt)
+}
+
+// IsRevoked checks if the key has been revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// IsActive checks if the key can be used at now
+func (k *APIKey) IsActive(now time.Time) bool {
+	return !k.IsExpired(now) && !k.IsRevoked()
+}
+
+// IsAPIKey reports whether a bearer credential looks like an API key
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+// Generate returns a new random plaintext API key
+func Generate() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return Prefix + hex.EncodeToString(b)
+}
+
+// Hash returns the storage hash of a plaintext key.
+// Keys carry 256 bits of entropy, so a fast unsalted hash is sufficient.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyRepository defines the interface for API key storage
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *APIKey) error
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	Revoke(ctx context.Context, id string, at time.Time) error
+}
@@ -0,0 +1,33 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	key := Generate()
+
+	if Hash(key) != Hash(key) {
+		t.Error("expected hash to be deterministic")
+	}
+	if Hash(key) == Hash(Generate()) {
+		t.Error("expected different keys to hash differently")
+	}
+	if strings.Contains(Hash(key), strings.TrimPrefix(key, Prefix)) {
+		t.Error("expected hash not to contain the plaintext")
+	}
+	if len(Hash(key)) != 64 {
+		t.Errorf("expected 64 hex characters, got %d", len(Hash(key)))
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	key := Generate()
+	if !IsAPIKey(key) {
+		t.Errorf("expected %q prefix, got %q", Prefix, key)
+	}
+	if key == Generate() {
+		t.Error("expected unique keys")
+	}
+}
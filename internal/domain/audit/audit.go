@@ -0,0 +1,61 @@
+// Package audit keeps a queryable record of who changed what, kept for a
+// retention period rather than only in logs
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Event is one recorded change
+type Event struct {
+	// ID is assigned by the repository and increases in the order events
+	// are appended, so it pages stably while new events arrive
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is the subject of the caller's token; empty for changes the
+	// server made on its own, such as health checks
+	Actor     string `json:"actor,omitempty"`
+	Action    string `json:"action"`   // e.g. "registry.deregister"
+	Resource  string `json:"resource"` // e.g. "service/payment-1"
+	RequestID string `json:"request_id,omitempty"`
+	// Details holds what else the action recorded, like the status before
+	// and after a status change
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Filter selects events. Zero fields match every event; the others must all
+// match.
+type Filter struct {
+	Since    time.Time // events at or after Since
+	Until    time.Time // events before Until
+	Actor    string
+	Action   string
+	Resource string
+}
+
+// Matches reports whether e is selected by the filter
+func (f Filter) Matches(e *Event) bool {
+	return (f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until)) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Resource == "" || e.Resource == f.Resource)
+}
+
+// AuditRepository stores events. Events are appended in time order and read
+// newest first.
+type AuditRepository interface {
+	// Append stores e and sets its ID
+	Append(ctx context.Context, e *Event) error
+	// List returns up to limit events matching filter with an ID below
+	// before, newest first; before 0 starts from the newest event
+	List(ctx context.Context, filter Filter, before int64, limit int) ([]*Event, error)
+	// Each calls fn with every event matching filter, newest first, reading
+	// them as it goes rather than all at once. It stops at the first error
+	// fn returns and returns it.
+	Each(ctx context.Context, filter Filter, fn func(*Event) error) error
+	// Prune removes the events older than before and returns how many were
+	// removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
@@ -3,75 +3,441 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aq189/bin/internal/repository"
 )
 
 // Config holds the root server configuration
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	JWT      JWTConfig      `json:"jwt"`
-	Session  SessionConfig  `json:"session"`
-	Registry RegistryConfig `json:"registry"`
-	Storage  StorageConfig  `json:"storage"`
-	Log      LogConfig      `json:"log"`
+	Server        ServerConfig        `json:"server"`
+	JWT           JWTConfig           `json:"jwt"`
+	Auth          AuthConfig          `json:"auth"`
+	Session       SessionConfig       `json:"session"`
+	Registry      RegistryConfig      `json:"registry"`
+	Webhooks      WebhooksConfig      `json:"webhooks"`
+	Audit         AuditConfig         `json:"audit"`
+	Storage       StorageConfig       `json:"storage"`
+	Log           LogConfig           `json:"log"`
+	Observability ObservabilityConfig `json:"observability"`
 }
 
 // ServerConfig holds HTTP server settings
 type ServerConfig struct {
-	Addr         string    `json:"addr"`
-	ReadTimeout  int       `json:"read_timeout"`
-	WriteTimeout int       `json:"write_timeout"`
-	IdleTimeout  int       `json:"idle_timeout"`
-	TLS          TLSConfig `json:"tls"`
-	CORS         CORSConfig `json:"cors"`
+	Addr           string            `json:"addr"` // listened on in the tcp listener mode
+	ReadTimeout    int               `json:"read_timeout"`
+	WriteTimeout   int               `json:"write_timeout"`
+	IdleTimeout    int               `json:"idle_timeout"`
+	RequestTimeout int               `json:"request_timeout"` // seconds per request, 0 disables
+	ShutdownGrace  int               `json:"shutdown_grace"`  // seconds requests in flight may finish on shutdown, 0 uses 30
+	TLS            TLSConfig         `json:"tls"`
+	CORS           CORSConfig        `json:"cors"`
+	Streams        StreamsConfig     `json:"streams"`
+	Compression    CompressionConfig `json:"compression"`
+	// SecurityHeaders adds hardening headers to every response
+	SecurityHeaders SecurityHeadersConfig `json:"security_headers"`
+	UI              UIConfig              `json:"ui"`
+	Idempotency     IdempotencyConfig     `json:"idempotency"`
+	// MaxRouteTimeout caps in seconds the read and write timeouts slow
+	// routes, like registry export and import, extend theirs to; 0 uses 300
+	MaxRouteTimeout int            `json:"max_route_timeout"`
+	Listener        ListenerConfig `json:"listener"`
+	// RequestIDFormat is the format of the IDs given to requests arriving
+	// without one: hex (default), uuidv4, uuidv7 or ulid
+	RequestIDFormat string `json:"request_id_format"`
+}
+
+// Listener modes
+const (
+	ListenerTCP        = "tcp"
+	ListenerUnix       = "unix"
+	ListenerActivation = "activation"
+)
+
+// ListenerConfig selects where the server accepts connections: on addr over
+// TCP, on a unix domain socket, or on the socket systemd passes under socket
+// activation. TLS applies in every mode.
+type ListenerConfig struct {
+	Mode       string `json:"mode"`        // tcp, unix or activation; empty means tcp
+	SocketPath string `json:"socket_path"` // required in unix mode; a stale socket file is replaced
+	// SocketMode is the octal permissions of the socket file, such as "0660";
+	// empty keeps those the umask leaves
+	SocketMode string `json:"socket_mode"`
+	// SocketOwner and SocketGroup hand the socket file to a user and group,
+	// by name or numeric ID; empty keeps the server's
+	SocketOwner string `json:"socket_owner"`
+	SocketGroup string `json:"socket_group"`
+}
+
+// FileMode parses SocketMode, returning 0 when it is empty
+func (l ListenerConfig) FileMode() (fs.FileMode, error) {
+	if l.SocketMode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q", l.SocketMode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// UIConfig controls the built-in web dashboard served under /ui
+type UIConfig struct {
+	Enabled bool `json:"enabled"` // off adds no routes
+	// RefreshInterval is how often, in seconds, dashboard pages reload
+	// themselves; 0 uses 10
+	RefreshInterval int `json:"refresh_interval"`
+}
+
+// IdempotencyConfig controls how POST requests carrying an Idempotency-Key
+// are replayed
+type IdempotencyConfig struct {
+	// TTL is how long, in seconds, a response is replayed for its key; 0 uses 86400
+	TTL int `json:"ttl"`
+}
+
+// SecurityHeaderNames are the headers SecurityHeadersConfig controls
+var SecurityHeaderNames = []string{
+	"X-Content-Type-Options",
+	"X-Frame-Options",
+	"Referrer-Policy",
+	"Content-Security-Policy",
+	"Strict-Transport-Security",
+}
+
+// SecurityHeadersConfig controls the hardening headers added to responses.
+// Empty values use the defaults; headers listed in Disabled are left out.
+type SecurityHeadersConfig struct {
+	Enabled               bool   `json:"enabled"`
+	ContentTypeOptions    string `json:"content_type_options"`    // X-Content-Type-Options, default nosniff
+	FrameOptions          string `json:"frame_options"`           // X-Frame-Options, default DENY
+	ReferrerPolicy        string `json:"referrer_policy"`         // Referrer-Policy, default no-referrer
+	ContentSecurityPolicy string `json:"content_security_policy"` // Content-Security-Policy, default default-src 'none'; frame-ancestors 'none'
+	// HSTSMaxAge is the max-age in seconds of Strict-Transport-Security,
+	// which is only sent on requests served over TLS; 0 uses one year
+	HSTSMaxAge            int      `json:"hsts_max_age"`
+	HSTSIncludeSubdomains bool     `json:"hsts_include_subdomains"`
+	Disabled              []string `json:"disabled"` // header names, e.g. ["Content-Security-Policy"]
+}
+
+// CompressionConfig controls gzip compression of responses
+type CompressionConfig struct {
+	Enabled bool `json:"enabled"`
+	MinSize int  `json:"min_size"` // bytes; smaller responses are sent uncompressed, 0 uses 1024
+}
+
+// StreamsConfig limits long-lived streaming responses such as server-sent events
+type StreamsConfig struct {
+	MaxConcurrent int `json:"max_concurrent"` // open streams before new ones get 503, 0 uses 1000
+	KeepAlive     int `json:"keep_alive"`     // seconds between keepalive comments, 0 uses 15
+	IdleTimeout   int `json:"idle_timeout"`   // seconds without events before a stream is closed, 0 disables
 }
 
 // TLSConfig holds TLS settings
 type TLSConfig struct {
-	Enabled  bool   `json:"enabled"`
-	CertFile string `json:"cert_file"`
-	KeyFile  string `json:"key_file"`
+	Enabled      bool   `json:"enabled"`
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"`
+	ClientAuth   string `json:"client_auth"` // none, request, verify_if_given or require; empty means none
 }
 
 // CORSConfig holds CORS settings
 type CORSConfig struct {
-	Enabled        bool     `json:"enabled"`
-	AllowedOrigins []string `json:"allowed_origins"`
-	AllowedMethods []string `json:"allowed_methods"`
-	AllowedHeaders []string `json:"allowed_headers"`
+	Enabled          bool     `json:"enabled"`
+	AllowedOrigins   []string `json:"allowed_origins"` // exact origins, "*", wildcard subdomains like https://*.example.com, or any port like http://localhost:*
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"` // refused with "*" in AllowedOrigins
 }
 
 // JWTConfig holds JWT settings
 type JWTConfig struct {
-	Secret          string `json:"secret"`
-	AccessTokenTTL  int    `json:"access_token_ttl"`  // minutes
-	RefreshTokenTTL int    `json:"refresh_token_ttl"` // hours
+	// Secret signs and validates tokens; it is shorthand for Secrets holding
+	// only it as the primary secret. Set one or the other.
+	Secret string `json:"secret"`
+	// Secrets rotate the signing secret without invalidating tokens signed
+	// with the previous one: the primary signs, the others only validate.
+	// A SIGHUP reloads them from the configuration file.
+	Secrets         []JWTSecret `json:"secrets"`
+	AccessTokenTTL  int         `json:"access_token_ttl"`  // minutes
+	RefreshTokenTTL int         `json:"refresh_token_ttl"` // hours
+	AllowWeakSecret bool        `json:"allow_weak_secret"` // accept a secret shorter than 32 bytes at startup; for development only
+	// MaxTokenBytes is the longest token accepted, or issued: longer tokens
+	// are refused before they are decoded. 0 uses 8192.
+	MaxTokenBytes int `json:"max_token_bytes"`
+	// IDFormat is the format of token IDs (jti): hex (default), uuidv4,
+	// uuidv7 or ulid
+	IDFormat string `json:"id_format"`
+}
+
+// JWTSecret is one of the secrets tokens are accepted under
+type JWTSecret struct {
+	ID      string `json:"id"` // sent in the kid header of the tokens it signs
+	Value   string `json:"value"`
+	Primary bool   `json:"primary"` // signs new tokens; exactly one secret is primary
+}
+
+// SigningSecrets returns Secrets, or Secret as the only, primary secret
+// when Secrets is empty
+func (c JWTConfig) SigningSecrets() []JWTSecret {
+	if len(c.Secrets) > 0 {
+		return c.Secrets
+	}
+	return []JWTSecret{{Value: c.Secret, Primary: true}}
+}
+
+// AuthConfig holds API key and token issuance settings
+type AuthConfig struct {
+	// BootstrapAPIKey is seeded with the admin role at startup so the first
+	// tokens and keys can be minted. Empty, the default, disables seeding.
+	BootstrapAPIKey string `json:"bootstrap_api_key"`
+	// BootstrapAPIKeyTTL is how long the seeded key is valid from when it is
+	// first stored, 0 never expires
+	BootstrapAPIKeyTTL int `json:"bootstrap_api_key_ttl"` // hours
+	// TokenCacheSize is how many validated tokens are cached in memory, 0 disables the cache
+	TokenCacheSize int `json:"token_cache_size"`
+	// IssuanceQuota caps the tokens each caller issues
+	IssuanceQuota IssuanceQuotaConfig `json:"issuance_quota"`
+	// UnknownAudience is what issuing a token for an audience that names no
+	// registered service does: AudienceWarn (the default) logs a warning,
+	// AudienceReject refuses the token
+	UnknownAudience string `json:"unknown_audience"`
+}
+
+// Handling of token audiences that name no registered service
+const (
+	AudienceWarn   = "warn"
+	AudienceReject = "reject"
+)
+
+// IssuanceQuotaConfig caps token issuance per caller over a sliding window
+type IssuanceQuotaConfig struct {
+	Limit  int      `json:"limit"`  // tokens per caller within the window, 0 disables the quota
+	Window int      `json:"window"` // seconds, 0 uses 3600
+	Exempt []string `json:"exempt"` // caller subjects without a quota, such as apikey:bootstrap
 }
 
 // SessionConfig holds session management settings
 type SessionConfig struct {
 	DefaultTTL    int `json:"default_ttl"`    // minutes
 	CleanupPeriod int `json:"cleanup_period"` // minutes
+	MaxTTL        int `json:"max_ttl"`        // minutes, 0 uses 24 hours
+	MaxDataBytes  int `json:"max_data_bytes"` // session data as JSON, 0 uses 64 KiB
+	MaxPerUser    int `json:"max_per_user"`   // active sessions per user and tenant, 0 disables the cap
+	// IDFormat is the format of session IDs after their sess_ prefix: hex
+	// (default), uuidv4, uuidv7 or ulid
+	IDFormat string `json:"id_format"`
+
+	Encryption SessionEncryptionConfig `json:"encryption"`
+	Callbacks  SessionCallbacksConfig  `json:"callbacks"`
+}
+
+// SessionCallbacksConfig controls the session.ended events POSTed to the
+// callback_url services register in their metadata when one of their
+// sessions expires or is deleted
+type SessionCallbacksConfig struct {
+	Enabled     bool `json:"enabled"`
+	QueueSize   int  `json:"queue_size"`   // events waiting for a worker before new ones are dropped, 0 uses 1000
+	Workers     int  `json:"workers"`      // concurrent deliveries, 0 uses 2
+	MaxAttempts int  `json:"max_attempts"` // attempts per event before it is given up, 0 uses 3
+	Timeout     int  `json:"timeout"`      // seconds per attempt, 0 uses 5
+}
+
+// SessionEncryptionConfig controls AES-256-GCM encryption of session data at rest
+type SessionEncryptionConfig struct {
+	Enabled bool   `json:"enabled"`
+	Key     string `json:"key"`    // base64 32-byte key new data is encrypted with
+	KeyID   string `json:"key_id"` // stored with each session to select the key on read
+	// PreviousKeys still decrypt sessions written before a key rotation
+	PreviousKeys []EncryptionKey `json:"previous_keys"`
+}
+
+// EncryptionKey is a base64 32-byte key and its ID
+type EncryptionKey struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"`
 }
 
 // RegistryConfig holds service registry settings
 type RegistryConfig struct {
 	HealthCheckInterval int `json:"health_check_interval"` // seconds
 	HealthCheckTimeout  int `json:"health_check_timeout"`  // seconds
+	// MinCheckInterval and MaxCheckInterval bound in seconds the
+	// check_interval_seconds a registration may ask for; 0 uses 5 and 3600
+	MinCheckInterval int `json:"min_check_interval"`
+	MaxCheckInterval int `json:"max_check_interval"`
+	// HealthCheckWorkers is how many services are health checked at once; 0 uses 8
+	HealthCheckWorkers int `json:"health_check_workers"`
+	// HeartbeatTimeout is the age in seconds after which the last heartbeat of
+	// a service without a health check URL marks it unhealthy; 0 disables it
+	HeartbeatTimeout int `json:"heartbeat_timeout"`
+	// DeletedRetention is how long in seconds a deregistered service can be
+	// restored before it is purged; 0 keeps it for 24 hours
+	DeletedRetention int `json:"deleted_retention"`
+	// MaxDiscoverWait caps in seconds how long a discovery long poll may wait
+	// for a change; 0 uses 60
+	MaxDiscoverWait int `json:"max_discover_wait"`
+	// HealthHistorySize is how many health check results are kept in memory
+	// per service; 0 uses 50
+	HealthHistorySize int `json:"health_history_size"`
+	// Journal appends every registry mutation to a file for debugging and
+	// replay with "root registry replay"
+	Journal JournalConfig `json:"journal"`
+	// HealthCheck restricts the addresses health checks may reach and paces
+	// the writes of their results
+	HealthCheck HealthCheckConfig `json:"health_check"`
+	// DNS answers SRV and A/AAAA queries for registered capabilities
+	DNS DNSConfig `json:"dns"`
 }
 
-// StorageConfig holds storage backend settings
+// DNSConfig controls the DNS server answering queries for
+// <capability>.<domain> with the healthy instances of the capability, for
+// consumers that can't use the HTTP API
+type DNSConfig struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`   // UDP and TCP address, "" uses ":8600"
+	Domain  string `json:"domain"` // "" uses "service.root"
+	TTL     int    `json:"ttl"`    // seconds answers may be cached, 0 uses 5
+}
+
+// HealthCheckConfig restricts the addresses health checks may reach.
+// Loopback, private, link-local, shared and unspecified addresses are refused
+// unless they are within AllowedCIDRs.
+//
+// The status changes a health check pass finds are stored in chunks of
+// WriteBatchSize, WriteBatchDelay apart, at most MaxWritesPerSecond; those
+// over the rate wait for the next pass. Registrations and heartbeats are
+// stored directly and never wait for them.
+type HealthCheckConfig struct {
+	AllowedCIDRs       []string `json:"allowed_cidrs"`         // e.g. "10.0.0.0/8"; "0.0.0.0/0" and "::/0" allow everything
+	MaxWritesPerSecond float64  `json:"max_writes_per_second"` // 0 stores every change of a pass
+	WriteBatchSize     int      `json:"write_batch_size"`      // 0 uses 100
+	WriteBatchDelay    int      `json:"write_batch_delay"`     // milliseconds between chunks, 0 uses 50
+}
+
+// JournalConfig controls the registry mutation journal
+type JournalConfig struct {
+	Path       string `json:"path"`        // file entries are appended to; empty disables the journal
+	MaxSizeMB  int    `json:"max_size_mb"` // size a file may grow to before it is rotated, 0 uses 10
+	MaxFiles   int    `json:"max_files"`   // rotated files kept, 0 uses 5
+	BufferSize int    `json:"buffer_size"` // entries waiting to be written before new ones are dropped, 0 uses 1000
+	// HeartbeatSampling records one heartbeat in every HeartbeatSampling, 0 uses 10
+	HeartbeatSampling int `json:"heartbeat_sampling"`
+}
+
+// WebhooksConfig controls HTTP notifications of registry and session events
+type WebhooksConfig struct {
+	Enabled       bool `json:"enabled"`
+	SessionEvents bool `json:"session_events"` // also deliver session.created, session.deleted and session.ended
+	QueueSize     int  `json:"queue_size"`     // deliveries waiting for a worker before new ones are dropped, 0 uses 1000
+	Workers       int  `json:"workers"`        // concurrent deliveries, 0 uses 4
+	MaxAttempts   int  `json:"max_attempts"`   // attempts per delivery before it is given up, 0 uses 5
+	Timeout       int  `json:"timeout"`        // seconds per attempt, 0 uses 5
+	// Targets are stored at startup unless a target with the same ID exists;
+	// more can be added and removed at runtime under /admin/webhooks
+	Targets []WebhookTarget `json:"targets"`
+}
+
+// AuditConfig controls the audit events recorded for registry mutations,
+// served under /audit/events
+type AuditConfig struct {
+	Enabled   bool `json:"enabled"`
+	Retention int  `json:"retention"` // hours events are kept before they are pruned, 0 uses 720
+	// MaxEvents caps the events kept by the memory backend, which drops the
+	// oldest beyond it; 0 uses 10000
+	MaxEvents int `json:"max_events"`
+}
+
+// WebhookTarget is an endpoint events are delivered to
+type WebhookTarget struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // event types delivered; empty delivers every type
+	Secret string   `json:"secret"` // key of the HMAC-SHA256 signature of every delivery
+}
+
+// Storage backend types
+const (
+	StorageMemory   = "memory"
+	StorageRedis    = "redis"
+	StoragePostgres = "postgres"
+)
+
+// StorageConfig holds storage backend settings.
+// Each component selects its own backend; connection settings are shared.
 type StorageConfig struct {
-	Type     string         `json:"type"` // redis, postgres, memory
+	Type     string         `json:"type"` // default backend for components without their own type
+	Sessions BackendConfig  `json:"sessions"`
+	Registry BackendConfig  `json:"registry"`
+	Config   BackendConfig  `json:"config"`
+	APIKeys  BackendConfig  `json:"api_keys"`
+	Quotas   BackendConfig  `json:"quotas"` // only used when auth.issuance_quota is set
+	Memory   MemoryConfig   `json:"memory"`
 	Redis    RedisConfig    `json:"redis"`
 	Postgres PostgresConfig `json:"postgres"`
+	// Idempotency stores the responses replayed for idempotency keys; with
+	// storage.type postgres, which doesn't store them, it defaults to memory
+	Idempotency BackendConfig `json:"idempotency"`
+	// Events carries registry events between instances: redis shares them
+	// over pub/sub, memory keeps them within the instance. With storage.type
+	// postgres, which can't carry them, it defaults to memory.
+	Events BackendConfig `json:"events"`
+	// Audit stores audit events when audit.enabled is set; with storage.type
+	// redis, which doesn't store them, it defaults to memory
+	Audit BackendConfig `json:"audit"`
+	// SlowThreshold is in milliseconds; slower session and registry
+	// repository calls are logged, 0 disables
+	SlowThreshold int `json:"slow_threshold"`
 }
 
+// BackendConfig selects the storage backend for a single component
+type BackendConfig struct {
+	Type string `json:"type"` // redis, postgres, memory; empty inherits StorageConfig.Type
+}
+
+// BackendType returns the effective backend type for a component,
+// falling back to the shared storage type when the component doesn't set one.
+// An empty result means no backend was configured at all.
+func (s StorageConfig) BackendType(component BackendConfig) string {
+	if component.Type != "" {
+		return component.Type
+	}
+	return s.Type
+}
+
+// MemoryConfig holds settings for the in-memory backend
+type MemoryConfig struct {
+	SnapshotPath     string `json:"snapshot_path"`     // file sessions, services and configs are saved to and restored from; empty disables snapshots
+	SnapshotInterval int    `json:"snapshot_interval"` // seconds between snapshots, 0 uses 60
+	MaxSessions      int    `json:"max_sessions"`      // sessions kept before the ones closest to expiry are evicted, 0 disables the limit
+	SessionShards    int    `json:"session_shards"`    // independently locked partitions of the session store, 0 uses 32
+}
+
+// Redis connection modes
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
 // RedisConfig holds Redis connection settings
 type RedisConfig struct {
-	Addr     string `json:"addr"`
-	Password string `json:"password"`
-	DB       int    `json:"db"`
+	Mode       string   `json:"mode"`        // single (default), sentinel or cluster
+	Addr       string   `json:"addr"`        // single mode
+	Addrs      []string `json:"addrs"`       // sentinel addresses, or cluster seed nodes
+	MasterName string   `json:"master_name"` // sentinel mode
+	Password   string   `json:"password"`
+	DB         int      `json:"db"` // ignored in cluster mode
+
+	// Pool tuning; zero keeps the client defaults
+	PoolSize     int `json:"pool_size"`
+	MinIdleConns int `json:"min_idle_conns"`
+	DialTimeout  int `json:"dial_timeout"` // seconds
 }
 
 // PostgresConfig holds PostgreSQL connection settings
@@ -85,17 +451,79 @@ type PostgresConfig struct {
 
 // LogConfig holds logging settings
 type LogConfig struct {
-	Level  string `json:"level"`  // debug, info, warn, error
-	Format string `json:"format"` // json, text
+	Level  string        `json:"level"`  // debug, info, warn, error
+	Format string        `json:"format"` // json, text
+	HTTP   HTTPLogConfig `json:"http"`
+	// RedactKeys are field keys masked in addition to token, authorization,
+	// password and secret
+	RedactKeys     []string `json:"redact_keys"`
+	MaxFieldLength int      `json:"max_field_length"` // bytes; longer fields are truncated, 0 uses 8192
+}
+
+// Access log formats
+const (
+	AccessLogJSON     = "json"
+	AccessLogText     = "text"
+	AccessLogCLF      = "clf"      // Common Log Format
+	AccessLogCombined = "combined" // Combined Log Format
+)
+
+// HTTPLogConfig controls the access log
+type HTTPLogConfig struct {
+	SkipPaths     []string `json:"skip_paths"`     // successful requests to these paths are not logged; unset uses /health, /ready, /metrics
+	SampleRate    int      `json:"sample_rate"`    // log 1 in N 2xx responses; 0 or 1 logs all
+	SlowThreshold int      `json:"slow_threshold"` // milliseconds; slower requests are always logged, 0 disables
+	Format        string   `json:"format"`         // json (default), text, clf or combined
+	// Output is where entries are written: stdout, stderr or a file path.
+	// Empty sends json and text entries to the application log and clf and
+	// combined entries to stdout.
+	Output string `json:"output"`
+	// LogBodies logs the start of JSON and form request bodies, and of the
+	// response, for 4xx responses when log.level is debug. Routes carrying
+	// credentials are never logged.
+	LogBodies    bool `json:"log_bodies"`
+	MaxBodyBytes int  `json:"max_body_bytes"` // bytes of each body logged; 0 uses 4096
+}
+
+// ObservabilityConfig holds telemetry settings
+type ObservabilityConfig struct {
+	Tracing TracingConfig `json:"tracing"`
+	Metrics MetricsConfig `json:"metrics"`
+}
+
+// TracingConfig controls OpenTelemetry tracing. Spans are exported over OTLP/HTTP.
+type TracingConfig struct {
+	Enabled     bool    `json:"enabled"`
+	Endpoint    string  `json:"endpoint"`     // collector host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318
+	Insecure    bool    `json:"insecure"`     // send to the collector over plain HTTP
+	SampleRatio float64 `json:"sample_ratio"` // fraction of new traces recorded, 0 to 1; traces sampled by the caller are always kept
+	ServiceName string  `json:"service_name"` // empty uses root-server
+}
+
+// MetricsConfig controls OpenTelemetry metrics. They are exported over OTLP/HTTP.
+type MetricsConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Endpoint    string `json:"endpoint"`     // collector host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318
+	Insecure    bool   `json:"insecure"`     // send to the collector over plain HTTP
+	Interval    int    `json:"interval"`     // seconds between exports, 0 uses 60
+	ServiceName string `json:"service_name"` // empty uses root-server
 }
 
+// DefaultPath is the configuration file Load reads when CONFIG_PATH is unset
+const DefaultPath = "config/development/config.json"
+
 // Load loads configuration from environment and files
 func Load() (*Config, error) {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
-		configPath = "config/development/config.json"
+		configPath = DefaultPath
 	}
 
+	return LoadFile(configPath)
+}
+
+// LoadFile loads configuration from the given file and applies environment overrides
+func LoadFile(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("read config file: %w", err)
@@ -110,9 +538,24 @@ func Load() (*Config, error) {
 	if secret := os.Getenv("JWT_SECRET"); secret != "" {
 		cfg.JWT.Secret = secret
 	}
+	if key := os.Getenv("ROOT_BOOTSTRAP_API_KEY"); key != "" {
+		cfg.Auth.BootstrapAPIKey = key
+	}
+	if key := os.Getenv("SESSION_ENCRYPTION_KEY"); key != "" {
+		cfg.Session.Encryption.Key = key
+	}
+	if mode := os.Getenv("REDIS_MODE"); mode != "" {
+		cfg.Storage.Redis.Mode = mode
+	}
 	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
 		cfg.Storage.Redis.Addr = addr
 	}
+	if addrs := os.Getenv("REDIS_ADDRS"); addrs != "" {
+		cfg.Storage.Redis.Addrs = strings.Split(addrs, ",")
+	}
+	if name := os.Getenv("REDIS_MASTER_NAME"); name != "" {
+		cfg.Storage.Redis.MasterName = name
+	}
 	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
 		cfg.Storage.Redis.Password = password
 	}
@@ -120,6 +563,10 @@ func Load() (*Config, error) {
 	return &cfg, nil
 }
 
+// ErrConfigNotFound is returned by repositories when no configuration is
+// stored for a service and version
+var ErrConfigNotFound = fmt.Errorf("config %w", repository.ErrNotFound)
+
 // ConfigRepository defines the interface for configuration storage
 type ConfigRepository interface {
 	Get(serviceID, version string) (map[string]any, error)
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+)
+
+// RedactedPrefix starts every secret in a Redacted configuration
+const RedactedPrefix = "***"
+
+// fingerprintBytes is how much of a secret's SHA-256 a redacted value keeps
+const fingerprintBytes = 4
+
+// Redacted returns a copy of the configuration that is safe to print: every
+// secret is replaced by RedactedPrefix and a short fingerprint of its SHA-256,
+// so operators can tell which value was loaded without seeing it. Unset
+// secrets stay empty. New secret settings must be redacted here; the
+// configuration is only ever printed or logged through this method.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.JWT.Secret = redact(c.JWT.Secret)
+	r.JWT.Secrets = slices.Clone(c.JWT.Secrets)
+	for i := range r.JWT.Secrets {
+		r.JWT.Secrets[i].Value = redact(c.JWT.Secrets[i].Value)
+	}
+	r.Auth.BootstrapAPIKey = redact(c.Auth.BootstrapAPIKey)
+	r.Session.Encryption.Key = redact(c.Session.Encryption.Key)
+	r.Session.Encryption.PreviousKeys = slices.Clone(c.Session.Encryption.PreviousKeys)
+	for i := range r.Session.Encryption.PreviousKeys {
+		r.Session.Encryption.PreviousKeys[i].Key = redact(c.Session.Encryption.PreviousKeys[i].Key)
+	}
+	r.Webhooks.Targets = slices.Clone(c.Webhooks.Targets)
+	for i := range r.Webhooks.Targets {
+		r.Webhooks.Targets[i].Secret = redact(c.Webhooks.Targets[i].Secret)
+	}
+	r.Storage.Redis.Password = redact(c.Storage.Redis.Password)
+	r.Storage.Postgres.Password = redact(c.Storage.Postgres.Password)
+	return &r
+}
+
+// redact replaces a secret by RedactedPrefix and its fingerprint, e.g.
+// "*** sha256:9f86d081"
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return RedactedPrefix + " sha256:" + hex.EncodeToString(sum[:fingerprintBytes])
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// secretSuffixes are the last segments of JSON keys holding secrets
+var secretSuffixes = []string{"secret", "password", "key", "token"}
+
+// fillSecrets sets every string field under v whose JSON key ends in a secret
+// suffix to a distinct value naming its path, adding one element to slices of
+// structs on the way, and returns the paths set
+func fillSecrets(v reflect.Value, path string) []string {
+	var paths []string
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			field := v.Field(i)
+			fieldPath := strings.TrimPrefix(path+"."+name, ".")
+			segments := strings.Split(name, "_")
+			if field.Kind() == reflect.String && slices.Contains(secretSuffixes, segments[len(segments)-1]) {
+				field.SetString("plaintext-" + fieldPath)
+				paths = append(paths, fieldPath)
+				continue
+			}
+			paths = append(paths, fillSecrets(field, fieldPath)...)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+			paths = append(paths, fillSecrets(v.Index(0), path+"[0]")...)
+		}
+	}
+	return paths
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	var cfg Config
+	paths := fillSecrets(reflect.ValueOf(&cfg).Elem(), "")
+	wantPaths := []string{
+		"jwt.secret",
+		"auth.bootstrap_api_key",
+		"session.encryption.key",
+		"session.encryption.previous_keys[0].key",
+		"webhooks.targets[0].secret",
+		"storage.redis.password",
+		"storage.postgres.password",
+	}
+	if !slices.Equal(paths, wantPaths) {
+		t.Fatalf("expected secret fields %v, got %v", wantPaths, paths)
+	}
+
+	redacted := cfg.Redacted()
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, path := range paths {
+		if strings.Contains(string(data), "plaintext-"+path) {
+			t.Errorf("expected %s redacted, got %s", path, data)
+		}
+	}
+
+	if redacted.JWT.Secret != redact("plaintext-jwt.secret") || !strings.HasPrefix(redacted.JWT.Secret, RedactedPrefix+" sha256:") {
+		t.Errorf("expected a redacted secret with its fingerprint, got %q", redacted.JWT.Secret)
+	}
+	if redacted.Storage.Redis.Password == redacted.Storage.Postgres.Password {
+		t.Error("expected different secrets to keep different fingerprints")
+	}
+	if cfg.JWT.Secret != "plaintext-jwt.secret" || cfg.Webhooks.Targets[0].Secret != "plaintext-webhooks.targets[0].secret" {
+		t.Error("expected the original configuration left untouched")
+	}
+	if (&Config{}).Redacted().JWT.Secret != "" {
+		t.Error("expected unset secrets to stay empty")
+	}
+}
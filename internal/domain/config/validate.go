@@ -0,0 +1,310 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// Accepted values of the enumerated settings; empty selects the default
+var (
+	clientAuthModes  = []string{"", "none", "request", "verify_if_given", "require"}
+	listenerModes    = []string{"", ListenerTCP, ListenerUnix, ListenerActivation}
+	storageTypes     = []string{"", StorageMemory, StorageRedis, StoragePostgres}
+	logLevels        = []string{"", "debug", "info", "warn", "error"}
+	logFormats       = []string{"", "json", "text"}
+	accessLogFormats = []string{"", AccessLogJSON, AccessLogText, AccessLogCLF, AccessLogCombined}
+	redisModes       = []string{"", RedisModeSingle, RedisModeSentinel, RedisModeCluster}
+	audienceModes    = []string{"", AudienceWarn, AudienceReject}
+	idFormats        = append([]string{""}, idgen.Formats...)
+)
+
+// Validate checks the configuration for settings the server cannot start
+// with or would silently misuse, and returns every problem found as
+// validation.Errors. It does not connect to storage backends.
+func (c *Config) Validate() error {
+	var errs validation.Errors
+
+	listener := c.Server.Listener
+	if c.Server.Addr == "" && (listener.Mode == "" || listener.Mode == ListenerTCP) {
+		errs.Add("server.addr", "is required")
+	}
+	oneOf(&errs, "server.listener.mode", listener.Mode, listenerModes)
+	if listener.Mode == ListenerUnix && listener.SocketPath == "" {
+		errs.Add("server.listener.socket_path", "is required in unix mode")
+	}
+	if _, err := listener.FileMode(); err != nil {
+		errs.Add("server.listener.socket_mode", "must be octal permissions such as 0660")
+	}
+	nonNegative(&errs, "server.request_timeout", c.Server.RequestTimeout)
+	nonNegative(&errs, "server.shutdown_grace", c.Server.ShutdownGrace)
+	nonNegative(&errs, "server.max_route_timeout", c.Server.MaxRouteTimeout)
+	if tls := c.Server.TLS; tls.Enabled {
+		if tls.CertFile == "" || tls.KeyFile == "" {
+			errs.Add("server.tls", "cert_file and key_file are required when TLS is enabled")
+		}
+		if (tls.ClientAuth == "verify_if_given" || tls.ClientAuth == "require") && tls.ClientCAFile == "" {
+			errs.Add("server.tls.client_ca_file", fmt.Sprintf("is required with client_auth %q", tls.ClientAuth))
+		}
+	}
+	oneOf(&errs, "server.tls.client_auth", c.Server.TLS.ClientAuth, clientAuthModes)
+	if cors := c.Server.CORS; cors.Enabled && cors.AllowCredentials &&
+		slices.ContainsFunc(cors.AllowedOrigins, func(origin string) bool { return strings.TrimSpace(origin) == "*" }) {
+		errs.Add("server.cors.allowed_origins", `must not contain "*" when allow_credentials is set`)
+	}
+	nonNegative(&errs, "server.compression.min_size", c.Server.Compression.MinSize)
+	nonNegative(&errs, "server.security_headers.hsts_max_age", c.Server.SecurityHeaders.HSTSMaxAge)
+	nonNegative(&errs, "server.ui.refresh_interval", c.Server.UI.RefreshInterval)
+	nonNegative(&errs, "server.idempotency.ttl", c.Server.Idempotency.TTL)
+	oneOf(&errs, "server.request_id_format", c.Server.RequestIDFormat, idFormats)
+	for i, name := range c.Server.SecurityHeaders.Disabled {
+		if !slices.ContainsFunc(SecurityHeaderNames, func(known string) bool { return strings.EqualFold(known, name) }) {
+			errs.Add(fmt.Sprintf("server.security_headers.disabled[%d]", i), fmt.Sprintf("must be one of %s", strings.Join(SecurityHeaderNames, ", ")))
+		}
+	}
+
+	c.JWT.validate(&errs)
+	nonNegative(&errs, "jwt.access_token_ttl", c.JWT.AccessTokenTTL)
+	nonNegative(&errs, "jwt.refresh_token_ttl", c.JWT.RefreshTokenTTL)
+
+	nonNegative(&errs, "auth.bootstrap_api_key_ttl", c.Auth.BootstrapAPIKeyTTL)
+	nonNegative(&errs, "auth.token_cache_size", c.Auth.TokenCacheSize)
+	nonNegative(&errs, "auth.issuance_quota.limit", c.Auth.IssuanceQuota.Limit)
+	nonNegative(&errs, "auth.issuance_quota.window", c.Auth.IssuanceQuota.Window)
+	oneOf(&errs, "auth.unknown_audience", c.Auth.UnknownAudience, audienceModes)
+
+	nonNegative(&errs, "session.max_ttl", c.Session.MaxTTL)
+	nonNegative(&errs, "session.max_data_bytes", c.Session.MaxDataBytes)
+	nonNegative(&errs, "session.max_per_user", c.Session.MaxPerUser)
+	oneOf(&errs, "session.id_format", c.Session.IDFormat, idFormats)
+	nonNegative(&errs, "session.callbacks.queue_size", c.Session.Callbacks.QueueSize)
+	nonNegative(&errs, "session.callbacks.workers", c.Session.Callbacks.Workers)
+	nonNegative(&errs, "session.callbacks.max_attempts", c.Session.Callbacks.MaxAttempts)
+	nonNegative(&errs, "session.callbacks.timeout", c.Session.Callbacks.Timeout)
+	if c.Session.Encryption.Enabled && c.Session.Encryption.Key == "" {
+		errs.Add("session.encryption.key", "is required when encryption is enabled")
+	}
+
+	nonNegative(&errs, "registry.min_check_interval", c.Registry.MinCheckInterval)
+	nonNegative(&errs, "registry.max_check_interval", c.Registry.MaxCheckInterval)
+	if c.Registry.MinCheckInterval > 0 && c.Registry.MaxCheckInterval > 0 && c.Registry.MinCheckInterval > c.Registry.MaxCheckInterval {
+		errs.Add("registry.max_check_interval", "must not be less than registry.min_check_interval")
+	}
+	nonNegative(&errs, "registry.health_check_workers", c.Registry.HealthCheckWorkers)
+	nonNegative(&errs, "registry.heartbeat_timeout", c.Registry.HeartbeatTimeout)
+	nonNegative(&errs, "registry.deleted_retention", c.Registry.DeletedRetention)
+	nonNegative(&errs, "registry.max_discover_wait", c.Registry.MaxDiscoverWait)
+	nonNegative(&errs, "registry.health_history_size", c.Registry.HealthHistorySize)
+	nonNegative(&errs, "registry.journal.max_size_mb", c.Registry.Journal.MaxSizeMB)
+	nonNegative(&errs, "registry.journal.max_files", c.Registry.Journal.MaxFiles)
+	nonNegative(&errs, "registry.journal.buffer_size", c.Registry.Journal.BufferSize)
+	nonNegative(&errs, "registry.journal.heartbeat_sampling", c.Registry.Journal.HeartbeatSampling)
+	for i, cidr := range c.Registry.HealthCheck.AllowedCIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			errs.Add(fmt.Sprintf("registry.health_check.allowed_cidrs[%d]", i), "must be an address range such as 10.0.0.0/8")
+		}
+	}
+	if c.Registry.HealthCheck.MaxWritesPerSecond < 0 {
+		errs.Add("registry.health_check.max_writes_per_second", "must not be negative")
+	}
+	nonNegative(&errs, "registry.health_check.write_batch_size", c.Registry.HealthCheck.WriteBatchSize)
+	nonNegative(&errs, "registry.health_check.write_batch_delay", c.Registry.HealthCheck.WriteBatchDelay)
+	c.Registry.DNS.validate(&errs)
+
+	c.Webhooks.validate(&errs)
+
+	nonNegative(&errs, "audit.retention", c.Audit.Retention)
+	nonNegative(&errs, "audit.max_events", c.Audit.MaxEvents)
+
+	c.Storage.validate(&errs)
+
+	oneOf(&errs, "log.level", c.Log.Level, logLevels)
+	oneOf(&errs, "log.format", c.Log.Format, logFormats)
+	oneOf(&errs, "log.http.format", c.Log.HTTP.Format, accessLogFormats)
+	nonNegative(&errs, "log.http.max_body_bytes", c.Log.HTTP.MaxBodyBytes)
+	nonNegative(&errs, "log.max_field_length", c.Log.MaxFieldLength)
+	nonNegative(&errs, "observability.metrics.interval", c.Observability.Metrics.Interval)
+
+	return errs.Err()
+}
+
+// validate checks the delivery settings and, when webhooks are enabled, the
+// configured targets
+func (w WebhooksConfig) validate(errs *validation.Errors) {
+	nonNegative(errs, "webhooks.queue_size", w.QueueSize)
+	nonNegative(errs, "webhooks.workers", w.Workers)
+	nonNegative(errs, "webhooks.max_attempts", w.MaxAttempts)
+	nonNegative(errs, "webhooks.timeout", w.Timeout)
+	if !w.Enabled {
+		return
+	}
+
+	ids := make(map[string]bool, len(w.Targets))
+	for i, target := range w.Targets {
+		field := fmt.Sprintf("webhooks.targets[%d]", i)
+		if target.ID == "" {
+			errs.Add(field+".id", "is required")
+		} else if ids[target.ID] {
+			errs.Add(field+".id", fmt.Sprintf("duplicates %q", target.ID))
+		}
+		ids[target.ID] = true
+		if !validation.IsHTTPURL(target.URL) {
+			errs.Add(field+".url", "must be an absolute http or https URL")
+		}
+		for j, eventType := range target.Events {
+			if !slices.Contains(event.Types, eventType) {
+				errs.Add(fmt.Sprintf("%s.events[%d]", field, j), "must be one of "+strings.Join(event.Types, ", "))
+			}
+		}
+		switch {
+		case target.Secret == "":
+			errs.Add(field+".secret", "is required")
+		case strings.HasPrefix(target.Secret, "${"):
+			errs.Add(field+".secret", "is an unexpanded placeholder")
+		}
+	}
+}
+
+// validate checks the cache lifetime and, when the DNS server is enabled, its
+// address and domain
+func (d DNSConfig) validate(errs *validation.Errors) {
+	nonNegative(errs, "registry.dns.ttl", d.TTL)
+	if !d.Enabled {
+		return
+	}
+
+	if d.Addr != "" {
+		if _, _, err := net.SplitHostPort(d.Addr); err != nil {
+			errs.Add("registry.dns.addr", "must be a host:port address such as :8600")
+		}
+	}
+	if domain := strings.Trim(d.Domain, "."); domain != "" {
+		labels := strings.Split(domain, ".")
+		if len(domain) > 200 || slices.ContainsFunc(labels, func(l string) bool { return l == "" || len(l) > 63 }) {
+			errs.Add("registry.dns.domain", "must be a domain name such as service.root")
+		}
+	}
+}
+
+// validate checks the backend types and the connection settings of the
+// backends components use
+func (s StorageConfig) validate(errs *validation.Errors) {
+	oneOf(errs, "storage.type", s.Type, storageTypes)
+
+	components := []struct {
+		name    string
+		backend BackendConfig
+	}{
+		{"sessions", s.Sessions},
+		{"registry", s.Registry},
+		{"config", s.Config},
+		{"api_keys", s.APIKeys},
+		{"quotas", s.Quotas},
+		{"idempotency", s.Idempotency},
+		{"events", s.Events},
+		{"audit", s.Audit},
+	}
+	used := make(map[string]bool)
+	for _, c := range components {
+		oneOf(errs, "storage."+c.name+".type", c.backend.Type, storageTypes)
+		used[s.BackendType(c.backend)] = true
+	}
+
+	if used[StorageRedis] {
+		s.Redis.validate(errs)
+	}
+	if used[StoragePostgres] && (s.Postgres.Host == "" || s.Postgres.Database == "") {
+		errs.Add("storage.postgres", "host and database are required when a component uses postgres")
+	}
+	nonNegative(errs, "storage.memory.max_sessions", s.Memory.MaxSessions)
+	nonNegative(errs, "storage.memory.session_shards", s.Memory.SessionShards)
+	nonNegative(errs, "storage.slow_threshold", s.SlowThreshold)
+}
+
+// validate checks the settings the connection mode needs
+func (r RedisConfig) validate(errs *validation.Errors) {
+	oneOf(errs, "storage.redis.mode", r.Mode, redisModes)
+	switch r.Mode {
+	case "", RedisModeSingle:
+		if r.Addr == "" {
+			errs.Add("storage.redis.addr", "is required when a component uses redis")
+		}
+	case RedisModeSentinel:
+		if r.MasterName == "" {
+			errs.Add("storage.redis.master_name", "is required in sentinel mode")
+		}
+		if len(r.Addrs) == 0 {
+			errs.Add("storage.redis.addrs", "is required in sentinel mode")
+		}
+	case RedisModeCluster:
+		if len(r.Addrs) == 0 {
+			errs.Add("storage.redis.addrs", "is required in cluster mode")
+		}
+	}
+	nonNegative(errs, "storage.redis.pool_size", r.PoolSize)
+	nonNegative(errs, "storage.redis.min_idle_conns", r.MinIdleConns)
+	nonNegative(errs, "storage.redis.dial_timeout", r.DialTimeout)
+}
+
+// validate checks the token size cap, the ID format and the signing
+// secrets: Secret, or else every secret of Secrets, which then need unique
+// IDs and exactly one primary
+func (c JWTConfig) validate(errs *validation.Errors) {
+	nonNegative(errs, "jwt.max_token_bytes", c.MaxTokenBytes)
+	oneOf(errs, "jwt.id_format", c.IDFormat, idFormats)
+	if len(c.Secrets) == 0 {
+		switch {
+		case c.Secret == "":
+			errs.Add("jwt.secret", "is required; set it in the file or with JWT_SECRET")
+		case strings.HasPrefix(c.Secret, "${"):
+			errs.Add("jwt.secret", "is an unexpanded placeholder; set JWT_SECRET")
+		}
+		return
+	}
+
+	if c.Secret != "" {
+		errs.Add("jwt.secret", "must be empty when jwt.secrets is set")
+	}
+	primaries := 0
+	ids := make(map[string]bool, len(c.Secrets))
+	for i, secret := range c.Secrets {
+		field := fmt.Sprintf("jwt.secrets[%d]", i)
+		switch {
+		case secret.ID == "":
+			errs.Add(field+".id", "is required")
+		case ids[secret.ID]:
+			errs.Add(field+".id", fmt.Sprintf("duplicates %q", secret.ID))
+		}
+		ids[secret.ID] = true
+		switch {
+		case secret.Value == "":
+			errs.Add(field+".value", "is required")
+		case strings.HasPrefix(secret.Value, "${"):
+			errs.Add(field+".value", "is an unexpanded placeholder")
+		}
+		if secret.Primary {
+			primaries++
+		}
+	}
+	if primaries != 1 {
+		errs.Add("jwt.secrets", "must have exactly one primary secret")
+	}
+}
+
+func nonNegative(errs *validation.Errors, field string, value int) {
+	if value < 0 {
+		errs.Add(field, "must not be negative")
+	}
+}
+
+func oneOf(errs *validation.Errors, field, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		errs.Add(field, fmt.Sprintf("must be one of %s", strings.Join(allowed[1:], ", ")))
+	}
+}
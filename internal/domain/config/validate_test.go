@@ -0,0 +1,338 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			Server: ServerConfig{Addr: ":8080"},
+			JWT:    JWTConfig{Secret: "secret"},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(c *Config)
+		wantFields []string
+	}{
+		{name: "valid", modify: func(c *Config) {}},
+		{name: "placeholder secret", modify: func(c *Config) { c.JWT.Secret = "${JWT_SECRET}" }, wantFields: []string{"jwt.secret"}},
+		{name: "negative token size cap", modify: func(c *Config) { c.JWT.MaxTokenBytes = -1 }, wantFields: []string{"jwt.max_token_bytes"}},
+		{
+			name: "id formats",
+			modify: func(c *Config) {
+				c.JWT.IDFormat = "uuidv7"
+				c.Session.IDFormat = "uuid"
+				c.Server.RequestIDFormat = "snowflake"
+			},
+			wantFields: []string{"server.request_id_format", "session.id_format"},
+		},
+		{
+			name: "secret list",
+			modify: func(c *Config) {
+				c.JWT.Secret = ""
+				c.JWT.Secrets = []JWTSecret{{ID: "2026-10", Value: "new-secret", Primary: true}, {ID: "2026-04", Value: "old-secret"}}
+			},
+		},
+		{
+			name: "invalid secret list",
+			modify: func(c *Config) {
+				c.JWT.Secrets = []JWTSecret{{ID: "2026-10", Value: "new-secret"}, {ID: "2026-10"}, {Value: "${JWT_SECRET}"}}
+			},
+			wantFields: []string{"jwt.secret", "jwt.secrets[1].id", "jwt.secrets[1].value", "jwt.secrets[2].id", "jwt.secrets[2].value", "jwt.secrets"},
+		},
+		{
+			name: "tls without files",
+			modify: func(c *Config) {
+				c.Server.TLS = TLSConfig{Enabled: true, ClientAuth: "require"}
+			},
+			wantFields: []string{"server.tls", "server.tls.client_ca_file"},
+		},
+		{
+			name: "backend settings of used backends",
+			modify: func(c *Config) {
+				c.Storage.Type = StorageRedis
+				c.Storage.APIKeys.Type = StoragePostgres
+				c.Storage.Sessions.Type = "mongo"
+			},
+			wantFields: []string{"storage.sessions.type", "storage.redis.addr", "storage.postgres"},
+		},
+		{name: "unused backend settings", modify: func(c *Config) { c.Storage.Type = StorageMemory }},
+		{
+			name: "redis sentinel",
+			modify: func(c *Config) {
+				c.Storage.Type = StorageRedis
+				c.Storage.Redis = RedisConfig{Mode: RedisModeSentinel, MasterName: "mymaster", Addrs: []string{"sentinel-1:26379"}, PoolSize: 20}
+			},
+		},
+		{
+			name: "redis settings of the mode",
+			modify: func(c *Config) {
+				c.Storage.Type = StorageRedis
+				c.Storage.Redis = RedisConfig{Mode: RedisModeSentinel, Addr: "redis:6379", PoolSize: -1, DialTimeout: -1}
+			},
+			wantFields: []string{"storage.redis.master_name", "storage.redis.addrs", "storage.redis.pool_size", "storage.redis.dial_timeout"},
+		},
+		{
+			name: "redis cluster without seeds",
+			modify: func(c *Config) {
+				c.Storage.Type = StorageRedis
+				c.Storage.Redis = RedisConfig{Mode: RedisModeCluster}
+			},
+			wantFields: []string{"storage.redis.addrs"},
+		},
+		{
+			name: "unknown redis mode",
+			modify: func(c *Config) {
+				c.Storage.Type = StorageRedis
+				c.Storage.Redis = RedisConfig{Mode: "replica"}
+			},
+			wantFields: []string{"storage.redis.mode"},
+		},
+		{
+			name: "security headers",
+			modify: func(c *Config) {
+				c.Server.SecurityHeaders = SecurityHeadersConfig{Enabled: true, HSTSMaxAge: -1, Disabled: []string{"content-security-policy", "X-XSS-Protection"}}
+			},
+			wantFields: []string{"server.security_headers.hsts_max_age", "server.security_headers.disabled[1]"},
+		},
+		{
+			name: "unix listener without addr",
+			modify: func(c *Config) {
+				c.Server.Addr = ""
+				c.Server.Listener = ListenerConfig{Mode: ListenerUnix, SocketPath: "/run/root/root.sock", SocketMode: "0660"}
+			},
+		},
+		{
+			name:   "activation listener without addr",
+			modify: func(c *Config) { c.Server.Addr = ""; c.Server.Listener.Mode = ListenerActivation },
+		},
+		{
+			name: "listener settings",
+			modify: func(c *Config) {
+				c.Server.Addr = ""
+				c.Server.Listener = ListenerConfig{Mode: ListenerUnix, SocketMode: "rw-rw----"}
+			},
+			wantFields: []string{"server.listener.socket_path", "server.listener.socket_mode"},
+		},
+		{
+			name:       "unknown listener mode",
+			modify:     func(c *Config) { c.Server.Listener.Mode = "udp" },
+			wantFields: []string{"server.listener.mode"},
+		},
+		{
+			name:       "tcp listener without addr",
+			modify:     func(c *Config) { c.Server.Addr = ""; c.Server.Listener.Mode = ListenerTCP },
+			wantFields: []string{"server.addr"},
+		},
+		{
+			name:       "negative shutdown grace",
+			modify:     func(c *Config) { c.Server.ShutdownGrace = -1 },
+			wantFields: []string{"server.shutdown_grace"},
+		},
+		{
+			name:       "negative route timeout cap",
+			modify:     func(c *Config) { c.Server.MaxRouteTimeout = -300 },
+			wantFields: []string{"server.max_route_timeout"},
+		},
+		{
+			name:       "negative dashboard refresh interval",
+			modify:     func(c *Config) { c.Server.UI = UIConfig{Enabled: true, RefreshInterval: -1} },
+			wantFields: []string{"server.ui.refresh_interval"},
+		},
+		{
+			name:       "negative idempotency ttl",
+			modify:     func(c *Config) { c.Server.Idempotency.TTL = -1 },
+			wantFields: []string{"server.idempotency.ttl"},
+		},
+		{
+			name:       "check interval bounds reversed",
+			modify:     func(c *Config) { c.Registry.MinCheckInterval = 60; c.Registry.MaxCheckInterval = 30 },
+			wantFields: []string{"registry.max_check_interval"},
+		},
+		{
+			name:       "negative health check workers",
+			modify:     func(c *Config) { c.Registry.HealthCheckWorkers = -1 },
+			wantFields: []string{"registry.health_check_workers"},
+		},
+		{
+			name: "negative health check write settings",
+			modify: func(c *Config) {
+				c.Registry.HealthCheck.MaxWritesPerSecond = -1
+				c.Registry.HealthCheck.WriteBatchSize = -1
+				c.Registry.HealthCheck.WriteBatchDelay = -1
+			},
+			wantFields: []string{"registry.health_check.max_writes_per_second", "registry.health_check.write_batch_size", "registry.health_check.write_batch_delay"},
+		},
+		{
+			name:       "negative heartbeat timeout",
+			modify:     func(c *Config) { c.Registry.HeartbeatTimeout = -1 },
+			wantFields: []string{"registry.heartbeat_timeout"},
+		},
+		{
+			name:       "negative deleted retention",
+			modify:     func(c *Config) { c.Registry.DeletedRetention = -1 },
+			wantFields: []string{"registry.deleted_retention"},
+		},
+		{
+			name:       "negative discover wait and history size",
+			modify:     func(c *Config) { c.Registry.MaxDiscoverWait = -1; c.Registry.HealthHistorySize = -1 },
+			wantFields: []string{"registry.max_discover_wait", "registry.health_history_size"},
+		},
+		{
+			name: "negative journal settings",
+			modify: func(c *Config) {
+				c.Registry.Journal = JournalConfig{Path: "journal.log", MaxSizeMB: -1, HeartbeatSampling: -1}
+			},
+			wantFields: []string{"registry.journal.max_size_mb", "registry.journal.heartbeat_sampling"},
+		},
+		{
+			name:       "invalid health check cidrs",
+			modify:     func(c *Config) { c.Registry.HealthCheck.AllowedCIDRs = []string{"10.0.0.0/8", "10.0.0.1", "fd00::/8"} },
+			wantFields: []string{"registry.health_check.allowed_cidrs[1]"},
+		},
+		{
+			name: "dns server",
+			modify: func(c *Config) {
+				c.Registry.DNS = DNSConfig{Enabled: true, Addr: "8600", Domain: "service..root", TTL: -1}
+			},
+			wantFields: []string{"registry.dns.ttl", "registry.dns.addr", "registry.dns.domain"},
+		},
+		{
+			name: "negative audit settings",
+			modify: func(c *Config) {
+				c.Audit = AuditConfig{Enabled: true, Retention: -1, MaxEvents: -1}
+				c.Storage.Audit.Type = "sqlite"
+			},
+			wantFields: []string{"audit.retention", "audit.max_events", "storage.audit.type"},
+		},
+		{
+			name:       "negative session shards",
+			modify:     func(c *Config) { c.Storage.Memory.SessionShards = -1 },
+			wantFields: []string{"storage.memory.session_shards"},
+		},
+		{
+			name:       "negative slow repository call threshold",
+			modify:     func(c *Config) { c.Storage.SlowThreshold = -1 },
+			wantFields: []string{"storage.slow_threshold"},
+		},
+		{
+			name:       "unknown access log format",
+			modify:     func(c *Config) { c.Log.HTTP.Format = "apache" },
+			wantFields: []string{"log.http.format"},
+		},
+		{
+			name:       "negative logged body size",
+			modify:     func(c *Config) { c.Log.HTTP.MaxBodyBytes = -1 },
+			wantFields: []string{"log.http.max_body_bytes"},
+		},
+		{
+			name:       "negative log field length",
+			modify:     func(c *Config) { c.Log.MaxFieldLength = -1 },
+			wantFields: []string{"log.max_field_length"},
+		},
+		{
+			name:       "negative metrics interval",
+			modify:     func(c *Config) { c.Observability.Metrics.Interval = -60 },
+			wantFields: []string{"observability.metrics.interval"},
+		},
+		{
+			name: "negative issuance quota",
+			modify: func(c *Config) {
+				c.Auth.IssuanceQuota.Limit = -1
+				c.Auth.IssuanceQuota.Window = -1
+			},
+			wantFields: []string{"auth.issuance_quota.limit", "auth.issuance_quota.window"},
+		},
+		{
+			name: "any origin with credentials",
+			modify: func(c *Config) {
+				c.Server.CORS = CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example", "*"}, AllowCredentials: true}
+			},
+			wantFields: []string{"server.cors.allowed_origins"},
+		},
+		{
+			name:       "unknown audience handling",
+			modify:     func(c *Config) { c.Auth.UnknownAudience = "ignore" },
+			wantFields: []string{"auth.unknown_audience"},
+		},
+		{
+			name:       "encryption without key",
+			modify:     func(c *Config) { c.Session.Encryption.Enabled = true },
+			wantFields: []string{"session.encryption.key"},
+		},
+		{
+			name: "negative session callback settings",
+			modify: func(c *Config) {
+				c.Session.Callbacks = SessionCallbacksConfig{Enabled: true, MaxAttempts: -1, Timeout: -5}
+			},
+			wantFields: []string{"session.callbacks.max_attempts", "session.callbacks.timeout"},
+		},
+		{
+			name: "webhook targets",
+			modify: func(c *Config) {
+				c.Webhooks = WebhooksConfig{Enabled: true, Workers: -1, Targets: []WebhookTarget{
+					{ID: "cmdb", URL: "https://cmdb.example.com/hooks", Events: []string{"service.deregistered"}, Secret: "s"},
+					{ID: "cmdb", URL: "cmdb.example.com", Events: []string{"service.exploded"}, Secret: "${WEBHOOK_SECRET}"},
+				}}
+			},
+			wantFields: []string{
+				"webhooks.workers",
+				"webhooks.targets[1].id",
+				"webhooks.targets[1].url",
+				"webhooks.targets[1].events[0]",
+				"webhooks.targets[1].secret",
+			},
+		},
+		{
+			name: "targets of disabled webhooks",
+			modify: func(c *Config) {
+				c.Webhooks.Targets = []WebhookTarget{{ID: "cmdb"}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			err := cfg.Validate()
+
+			var invalid validation.Errors
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &invalid) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			fields := make([]string, 0, len(invalid))
+			for _, fe := range invalid {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateDevelopmentConfig(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	cfg, err := LoadFile(filepath.Join("..", "..", "..", DefaultPath))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected the development config to be valid, got %v", err)
+	}
+}
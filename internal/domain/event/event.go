@@ -0,0 +1,71 @@
+package event
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Types of events published by the registry and session services
+const (
+	ServiceRegistered    = "service.registered"     // a service registered, re-registered or was restored
+	ServiceDeregistered  = "service.deregistered"   // a service was removed from the registry
+	ServiceStatusChanged = "service.status_changed" // a health check or an operator changed a service's status
+	SessionCreated       = "session.created"
+	SessionDeleted       = "session.deleted"
+	SessionEnded         = "session.ended" // a session expired or was deleted; see session.Ended
+)
+
+// Types lists every event type
+var Types = []string{ServiceRegistered, ServiceDeregistered, ServiceStatusChanged, SessionCreated, SessionDeleted, SessionEnded}
+
+// Event is a change in the registry or the session store
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	Data       any       `json:"data"` // the service or session the event is about
+}
+
+// New returns an event of the given type with a random ID, occurring now
+func New(eventType, tenantID string, data any) Event {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return Event{
+		ID:         "evt_" + hex.EncodeToString(b),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		TenantID:   tenantID,
+		Data:       data,
+	}
+}
+
+// Publisher receives the events services publish. Publish must not block on
+// delivery: it hands the event off and returns, so a slow subscriber never
+// holds up the request that caused the event.
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+// Publishers hands every event to each of its publishers in turn
+type Publishers []Publisher
+
+// Publish implements Publisher
+func (p Publishers) Publish(ctx context.Context, e Event) {
+	for _, publisher := range p {
+		publisher.Publish(ctx, e)
+	}
+}
+
+// Bus fans events out to subscribers on every root-server instance sharing
+// it. Publish hands the event to the local subscribers before returning and,
+// like any Publisher, doesn't wait for other instances to receive it.
+type Bus interface {
+	Publisher
+	// Subscribe calls handle with every event published from now on, by this
+	// instance or another, until the returned function is called. Local events
+	// are handled on the publishing goroutine, so handle must not block.
+	Subscribe(handle func(Event)) (unsubscribe func())
+}
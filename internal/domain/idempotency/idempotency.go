@@ -0,0 +1,34 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+)
+
+// Response is what a store keeps under an idempotency key: the hash of the
+// request that claimed it and, once that request completed, its response
+type Response struct {
+	RequestHash string `json:"request_hash"`
+	// Done is false while the claiming request is still being processed
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore records the responses of requests by idempotency key so
+// repeated requests are answered without being processed again. Records
+// expire ttl after they were written; an expired key can be claimed again.
+type IdempotencyStore interface {
+	// Begin claims key for a request hashing to requestHash at now, pending
+	// until Complete or Release. It returns nil when the key was claimed, or
+	// the record already stored under it without claiming it. Checking and
+	// claiming are atomic, so of concurrent callers only one claims a key.
+	Begin(ctx context.Context, key, requestHash string, ttl time.Duration, now time.Time) (*Response, error)
+	// Complete stores the response of the request that claimed key, kept
+	// until ttl after now
+	Complete(ctx context.Context, key string, resp Response, ttl time.Duration, now time.Time) error
+	// Release drops key, so a request that failed without a response worth
+	// replaying can be retried under it
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,52 @@
+package journal
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+)
+
+// Operations recorded in the journal
+const (
+	OpRegister   = "register"   // a service registered, re-registered or replaced a deregistered one
+	OpImport     = "import"     // a service was created or replaced by a registry import
+	OpDeregister = "deregister" // a service was soft-deleted
+	OpRestore    = "restore"    // a deregistered service was brought back
+	OpSetStatus  = "set_status" // an operator set or cleared a status override
+	OpHeartbeat  = "heartbeat"  // a heartbeat was received; only a sample is recorded
+	OpHealth     = "health"     // a health check or heartbeat expiry changed a service's status
+)
+
+// Entry is one registry mutation, written to the journal as a JSON line
+type Entry struct {
+	Time      time.Time `json:"ts"`
+	Op        string    `json:"op"`
+	ServiceID string    `json:"service_id"`
+	// Actor is the subject of the caller's token; empty for changes the
+	// server made on its own, such as health checks
+	Actor        string         `json:"actor,omitempty"`
+	RequestID    string         `json:"request_id,omitempty"`
+	BeforeStatus service.Status `json:"before_status,omitempty"`
+	AfterStatus  service.Status `json:"after_status,omitempty"`
+	// Service is the stored registration for OpRegister and OpImport, so a
+	// replay can repeat them
+	Service *service.Service `json:"service,omitempty"`
+}
+
+// Recorder receives the registry's mutations. Record must not block: it
+// hands the entry off and returns, so journaling never holds up the request
+// that caused the mutation.
+type Recorder interface {
+	Record(ctx context.Context, e Entry)
+}
+
+// Recorders hands every entry to each of its recorders in turn
+type Recorders []Recorder
+
+// Record implements Recorder
+func (r Recorders) Record(ctx context.Context, e Entry) {
+	for _, recorder := range r {
+		recorder.Record(ctx, e)
+	}
+}
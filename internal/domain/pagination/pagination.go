@@ -0,0 +1,54 @@
+package pagination
+
+// Limits applied to list endpoints
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// ListOptions selects one page of a listing
+type ListOptions struct {
+	Limit  int
+	Offset int
+	// SortBy names the field to order by; each repository documents the fields
+	// it supports and falls back to its default order for anything else.
+	// Ties are always broken by ID so pages are stable.
+	SortBy string
+	// Descending reverses the order, ID tie-breaker included, in repositories
+	// that document support for it
+	Descending bool
+}
+
+// Window returns the [start, end) bounds of the page within n items, for
+// stores that page in memory. A non-positive Limit selects DefaultLimit.
+func (o ListOptions) Window(n int) (start, end int) {
+	limit := o.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	start = min(max(o.Offset, 0), n)
+	end = min(start+limit, n)
+	return start, end
+}
+
+// Page is the response envelope of paginated list endpoints
+type Page[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"`
+	// NextOffset is the offset of the following page, nil on the last page
+	NextOffset *int `json:"next_offset"`
+}
+
+// NewPage wraps one page of items, setting NextOffset when more remain
+func NewPage[T any](items []T, total int, opts ListOptions) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	page := Page[T]{Items: items, Total: total}
+	if next := max(opts.Offset, 0) + len(items); len(items) > 0 && next < total {
+		page.NextOffset = &next
+	}
+	return page
+}
@@ -0,0 +1,51 @@
+package pagination
+
+import "testing"
+
+func TestListOptions_Window(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		n         int
+		wantStart int
+		wantEnd   int
+	}{
+		{name: "first page", opts: ListOptions{Limit: 10}, n: 25, wantStart: 0, wantEnd: 10},
+		{name: "last partial page", opts: ListOptions{Limit: 10, Offset: 20}, n: 25, wantStart: 20, wantEnd: 25},
+		{name: "offset past the end", opts: ListOptions{Limit: 10, Offset: 40}, n: 25, wantStart: 25, wantEnd: 25},
+		{name: "default limit", opts: ListOptions{}, n: 80, wantStart: 0, wantEnd: DefaultLimit},
+		{name: "negative offset", opts: ListOptions{Limit: 5, Offset: -3}, n: 8, wantStart: 0, wantEnd: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.opts.Window(tt.n)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("expected [%d, %d), got [%d, %d)", tt.wantStart, tt.wantEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	t.Run("more items remain", func(t *testing.T) {
+		page := NewPage([]string{"c", "d"}, 5, ListOptions{Limit: 2, Offset: 2})
+		if page.Total != 5 || page.NextOffset == nil || *page.NextOffset != 4 {
+			t.Errorf("expected next offset 4 of 5, got %+v", page)
+		}
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		page := NewPage([]string{"e"}, 5, ListOptions{Limit: 2, Offset: 4})
+		if page.NextOffset != nil {
+			t.Errorf("expected no next offset, got %d", *page.NextOffset)
+		}
+	})
+
+	t.Run("empty page has empty items", func(t *testing.T) {
+		page := NewPage[string](nil, 0, ListOptions{})
+		if page.Items == nil || page.NextOffset != nil {
+			t.Errorf("expected empty items and no next offset, got %+v", page)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package quota
+
+import (
+	"context"
+	"time"
+)
+
+// Usage is what a subject has used of its quota within the window ending at
+// the time it was read
+type Usage struct {
+	Count int
+	// Oldest is the earliest use still within the window, zero when Count is 0.
+	// A slot frees up once it is a window old.
+	Oldest time.Time
+}
+
+// ResetAt returns when the next slot frees up, or now when none is used
+func (u Usage) ResetAt(window time.Duration, now time.Time) time.Time {
+	if u.Count == 0 {
+		return now
+	}
+	return u.Oldest.Add(window)
+}
+
+// QuotaStore counts uses per subject over a sliding window
+type QuotaStore interface {
+	// Acquire records a use by subject at now unless limit uses already fall
+	// within the window before now. It returns the usage, including the new
+	// use when acquired, and whether it was. Checking and recording are
+	// atomic, so concurrent callers never exceed limit between them.
+	Acquire(ctx context.Context, subject string, limit int, window time.Duration, now time.Time) (Usage, bool, error)
+	// Usage returns the uses by subject within the window before now
+	Usage(ctx context.Context, subject string, window time.Duration, now time.Time) (Usage, error)
+}
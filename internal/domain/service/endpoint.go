@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EndpointPlaceholder in the URL of a service's http health check is replaced
+// by each endpoint's URL, so every endpoint is checked on its own
+const EndpointPlaceholder = "{endpoint}"
+
+// Endpoint is an address a service is reachable at
+type Endpoint struct {
+	URL string `json:"url" validate:"url"`
+	// Weight is the endpoint's relative share of traffic; 0 is stored as 1
+	Weight int `json:"weight" validate:"min=0"`
+	// Healthy and LastCheckedAt are maintained by per-endpoint health checks,
+	// which store them on the first check and when the health changes;
+	// endpoints that were never checked are assumed healthy
+	Healthy       bool      `json:"healthy"`
+	LastCheckedAt time.Time `json:"last_checked_at,omitzero"`
+}
+
+// UnmarshalJSON accepts the object form as well as a plain URL string, the
+// format endpoints were registered and stored in before they carried weights.
+// A string becomes a healthy endpoint of weight 1, and an object without
+// "healthy" is healthy.
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*e = Endpoint{URL: url, Weight: 1, Healthy: true}
+		return nil
+	}
+
+	var aux struct {
+		URL           string    `json:"url"`
+		Weight        int       `json:"weight"`
+		Healthy       *bool     `json:"healthy"`
+		LastCheckedAt time.Time `json:"last_checked_at"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*e = Endpoint{URL: aux.URL, Weight: aux.Weight, Healthy: aux.Healthy == nil || *aux.Healthy, LastCheckedAt: aux.LastCheckedAt}
+	return nil
+}
+
+// HealthCheckURL returns the health check URL of the endpoint by substituting
+// its URL, without a trailing slash, for EndpointPlaceholder in template
+func (e Endpoint) HealthCheckURL(template string) string {
+	return strings.ReplaceAll(template, EndpointPlaceholder, strings.TrimSuffix(e.URL, "/"))
+}
+
+// ChecksEndpoints reports whether the service has an http health check whose
+// URL is templated with EndpointPlaceholder and so probes each endpoint
+// rather than the service
+func (s *Service) ChecksEndpoints() bool {
+	check := s.EffectiveHealthCheck()
+	return check != nil && check.Type == HealthCheckHTTP && strings.Contains(check.URL, EndpointPlaceholder)
+}
+
+// HasHealthyEndpoint reports whether at least one endpoint is healthy. A
+// service without endpoints has none.
+func (s *Service) HasHealthyEndpoint() bool {
+	return slices.ContainsFunc(s.Endpoints, func(e Endpoint) bool { return e.Healthy })
+}
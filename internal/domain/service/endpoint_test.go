@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEndpoint_UnmarshalJSON(t *testing.T) {
+	checked := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		json    string
+		want    []Endpoint
+		wantErr bool
+	}{
+		{
+			name: "plain strings",
+			json: `["http://10.0.0.1:8080","http://10.0.0.2:8080"]`,
+			want: []Endpoint{{URL: "http://10.0.0.1:8080", Weight: 1, Healthy: true}, {URL: "http://10.0.0.2:8080", Weight: 1, Healthy: true}},
+		},
+		{
+			name: "objects",
+			json: `[{"url":"http://10.0.0.1:8080","weight":3,"healthy":false,"last_checked_at":"2025-03-01T12:00:00Z"}]`,
+			want: []Endpoint{{URL: "http://10.0.0.1:8080", Weight: 3, LastCheckedAt: checked}},
+		},
+		{
+			name: "object without health",
+			json: `[{"url":"http://10.0.0.1:8080"}]`,
+			want: []Endpoint{{URL: "http://10.0.0.1:8080", Healthy: true}},
+		},
+		{
+			name: "mixed",
+			json: `["http://10.0.0.1:8080",{"url":"http://10.0.0.2:8080","weight":2}]`,
+			want: []Endpoint{{URL: "http://10.0.0.1:8080", Weight: 1, Healthy: true}, {URL: "http://10.0.0.2:8080", Weight: 2, Healthy: true}},
+		},
+		{name: "number", json: `[8080]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Endpoint
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpoint_JSONRoundTrip(t *testing.T) {
+	in := Service{ID: "payment-1", Endpoints: []Endpoint{
+		{URL: "http://10.0.0.1:8080", Weight: 2, Healthy: false, LastCheckedAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{URL: "http://10.0.0.2:8080", Weight: 1, Healthy: true},
+	}}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out Service
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !slices.Equal(out.Endpoints, in.Endpoints) {
+		t.Errorf("expected endpoints %+v to survive a round trip, got %+v", in.Endpoints, out.Endpoints)
+	}
+}
+
+func TestEndpoint_HealthCheckURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		template string
+		want     string
+	}{
+		{endpoint: "http://10.0.0.1:8080", template: "{endpoint}/health", want: "http://10.0.0.1:8080/health"},
+		{endpoint: "http://10.0.0.1:8080/", template: "{endpoint}/health", want: "http://10.0.0.1:8080/health"},
+		{endpoint: "http://10.0.0.1:8080", template: "http://prober/check?target={endpoint}", want: "http://prober/check?target=http://10.0.0.1:8080"},
+		{endpoint: "http://10.0.0.1:8080", template: "http://payment/health", want: "http://payment/health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if got := (Endpoint{URL: tt.endpoint}).HealthCheckURL(tt.template); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
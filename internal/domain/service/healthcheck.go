@@ -0,0 +1,53 @@
+package service
+
+// Health check probe types
+const (
+	HealthCheckHTTP = "http" // GET the URL and check the response
+	HealthCheckTCP  = "tcp"  // open a TCP connection to a host:port
+)
+
+// HealthCheckTypes lists the accepted values of HealthCheck.Type
+var HealthCheckTypes = []string{HealthCheckHTTP, HealthCheckTCP}
+
+// HealthCheck describes how the registry probes a service
+type HealthCheck struct {
+	// Type selects the probe, one of HealthCheckTypes; empty is HealthCheckHTTP
+	Type string `json:"type" validate:"omitempty,oneof=http tcp"`
+	// URL is the http(s) URL an http probe GETs, which may be templated with
+	// EndpointPlaceholder, or the host:port a tcp probe dials
+	URL string `json:"url"`
+	// ExpectedStatusCodes are the response codes an http probe accepts; empty
+	// accepts any 2xx
+	ExpectedStatusCodes []int `json:"expected_status_codes,omitempty" validate:"dive,min=100,max=599"`
+	// ExpectedBodySubstring, when set, must appear in an http probe's response body
+	ExpectedBodySubstring string `json:"expected_body_substring,omitempty"`
+	// TimeoutSeconds bounds each probe; 0, or more than the registry's health
+	// check timeout, uses the registry's
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" validate:"min=0"`
+}
+
+// AcceptsStatus reports whether an http probe passes with the response code
+func (c *HealthCheck) AcceptsStatus(code int) bool {
+	if len(c.ExpectedStatusCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, expected := range c.ExpectedStatusCodes {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveHealthCheck returns the health check probing the service:
+// HealthCheck when set, an http check expecting a 2xx from HealthCheckURL for
+// services stored with only that field, or nil when the service isn't probed
+func (s *Service) EffectiveHealthCheck() *HealthCheck {
+	if s.HealthCheck != nil {
+		return s.HealthCheck
+	}
+	if s.HealthCheckURL != "" {
+		return &HealthCheck{Type: HealthCheckHTTP, URL: s.HealthCheckURL}
+	}
+	return nil
+}
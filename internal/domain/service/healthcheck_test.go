@@ -0,0 +1,41 @@
+package service
+
+import "testing"
+
+func TestHealthCheck_AcceptsStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []int
+		code     int
+		want     bool
+	}{
+		{name: "2xx by default", code: 204, want: true},
+		{name: "3xx not by default", code: 302, want: false},
+		{name: "in the expected set", expected: []int{200, 302}, code: 302, want: true},
+		{name: "2xx outside the expected set", expected: []int{200}, code: 204, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &HealthCheck{ExpectedStatusCodes: tt.expected}
+			if got := check.AcceptsStatus(tt.code); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestService_EffectiveHealthCheck(t *testing.T) {
+	tcp := &HealthCheck{Type: HealthCheckTCP, URL: "payment-1:9090"}
+
+	if got := (&Service{}).EffectiveHealthCheck(); got != nil {
+		t.Errorf("expected no health check, got %+v", got)
+	}
+	if got := (&Service{HealthCheck: tcp, HealthCheckURL: "http://ignored/health"}).EffectiveHealthCheck(); got != tcp {
+		t.Errorf("expected the typed health check, got %+v", got)
+	}
+	got := (&Service{HealthCheckURL: "http://payment-1:8080/health"}).EffectiveHealthCheck()
+	if got == nil || got.Type != HealthCheckHTTP || got.URL != "http://payment-1:8080/health" || len(got.ExpectedStatusCodes) != 0 {
+		t.Errorf("expected an http check of the legacy URL, got %+v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"slices"
+	"strings"
+)
+
+// GroupKey returns the logical service s is an instance of: Name for
+// registrations carrying an InstanceID, or the ID of a registration without
+// one, which predates instances and is a single-instance service of its own
+func (s *Service) GroupKey() string {
+	if s.InstanceID != "" {
+		return s.Name
+	}
+	return s.ID
+}
+
+// Group is a logical service: the registrations sharing a GroupKey
+type Group struct {
+	Key       string
+	Instances []*Service // ordered by ID
+}
+
+// GroupInstances collects services into groups ordered by key
+func GroupInstances(services []*Service) []*Group {
+	byKey := make(map[string]*Group)
+	var groups []*Group
+	for _, svc := range services {
+		key := svc.GroupKey()
+		g, ok := byKey[key]
+		if !ok {
+			g = &Group{Key: key}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.Instances = append(g.Instances, svc)
+	}
+
+	for _, g := range groups {
+		slices.SortFunc(g.Instances, CompareBy(SortByID))
+	}
+	slices.SortFunc(groups, func(a, b *Group) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return groups
+}
+
+// AggregateStatus returns the status of a logical service whose instances
+// have the given statuses: healthy when at least one instance is, draining
+// when every instance is, unhealthy when any instance is and unknown
+// otherwise, including for no instances at all
+func AggregateStatus(statuses ...Status) Status {
+	switch {
+	case slices.Contains(statuses, StatusHealthy):
+		return StatusHealthy
+	case len(statuses) > 0 && !slices.ContainsFunc(statuses, func(s Status) bool { return s != StatusDraining }):
+		return StatusDraining
+	case slices.Contains(statuses, StatusUnhealthy):
+		return StatusUnhealthy
+	default:
+		return StatusUnknown
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupInstances(t *testing.T) {
+	services := []*Service{
+		{ID: "pay-2", Name: "payments", InstanceID: "b"},
+		{ID: "auth", Name: "auth"},
+		{ID: "pay-1", Name: "payments", InstanceID: "a"},
+		{ID: "auth-eu", Name: "auth"}, // legacy registrations sharing a name stay apart
+		{ID: "search-1", Name: "search", InstanceID: "a"},
+	}
+
+	groups := GroupInstances(services)
+	got := make(map[string][]string)
+	var keys []string
+	for _, g := range groups {
+		keys = append(keys, g.Key)
+		for _, svc := range g.Instances {
+			got[g.Key] = append(got[g.Key], svc.ID)
+		}
+	}
+
+	if want := []string{"auth", "auth-eu", "payments", "search"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected groups %v, got %v", want, keys)
+	}
+	want := map[string][]string{
+		"auth":     {"auth"},
+		"auth-eu":  {"auth-eu"},
+		"payments": {"pay-1", "pay-2"},
+		"search":   {"search-1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected instances %v, got %v", want, got)
+	}
+
+	if groups := GroupInstances(nil); len(groups) != 0 {
+		t.Errorf("expected no groups, got %d", len(groups))
+	}
+}
+
+func TestAggregateStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []Status
+		want     Status
+	}{
+		{name: "no instances", want: StatusUnknown},
+		{name: "one healthy", statuses: []Status{StatusHealthy}, want: StatusHealthy},
+		{name: "one healthy among unhealthy", statuses: []Status{StatusUnhealthy, StatusHealthy, StatusUnhealthy}, want: StatusHealthy},
+		{name: "healthy among draining", statuses: []Status{StatusDraining, StatusHealthy}, want: StatusHealthy},
+		{name: "last healthy instance lost", statuses: []Status{StatusUnhealthy, StatusUnhealthy}, want: StatusUnhealthy},
+		{name: "unhealthy among draining", statuses: []Status{StatusDraining, StatusUnhealthy}, want: StatusUnhealthy},
+		{name: "unhealthy among unknown", statuses: []Status{StatusUnknown, StatusUnhealthy}, want: StatusUnhealthy},
+		{name: "all draining", statuses: []Status{StatusDraining, StatusDraining}, want: StatusDraining},
+		{name: "unknown among draining", statuses: []Status{StatusDraining, StatusUnknown}, want: StatusUnknown},
+		{name: "not checked yet", statuses: []Status{StatusUnknown}, want: StatusUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AggregateStatus(tt.statuses...); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,9 +1,26 @@
 package service
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
 )
 
+// ErrServiceNotFound is returned by repositories when no service is stored under an ID
+var ErrServiceNotFound = fmt.Errorf("service %w", repository.ErrNotFound)
+
+// ErrServiceDeleted is returned by HeartbeatUpdater implementations when the
+// service has been soft-deleted
+var ErrServiceDeleted = errors.New("service deleted")
+
 // Status represents the health status of a service
 type Status string
 
@@ -11,37 +28,177 @@ const (
 	StatusHealthy   Status = "healthy"
 	StatusUnhealthy Status = "unhealthy"
 	StatusUnknown   Status = "unknown"
+	StatusDraining  Status = "draining" // registered but excluded from discovery
 )
 
+// MetadataCallbackURL is the metadata key under which a service registers the
+// URL its sessions' session.ended events are POSTed to
+const MetadataCallbackURL = "callback_url"
+
+// Fields services can be listed by; SortByID is the default
+const (
+	SortByID            = "id"
+	SortByName          = "name"
+	SortByRegisteredAt  = "registered_at"
+	SortByLastHeartbeat = "last_heartbeat"
+)
+
+// SortFields lists the accepted values of pagination.ListOptions.SortBy
+var SortFields = []string{SortByID, SortByName, SortByRegisteredAt, SortByLastHeartbeat}
+
+// Statuses lists every status a service can be stored with
+var Statuses = []Status{StatusHealthy, StatusUnhealthy, StatusUnknown, StatusDraining}
+
+// CompareBy returns a comparison function ordering services by the given sort
+// field, then by ID. Unknown fields order by ID alone.
+func CompareBy(sortBy string) func(a, b *Service) int {
+	return func(a, b *Service) int {
+		var c int
+		switch sortBy {
+		case SortByName:
+			c = strings.Compare(a.Name, b.Name)
+		case SortByRegisteredAt:
+			c = a.RegisteredAt.Compare(b.RegisteredAt)
+		case SortByLastHeartbeat:
+			c = a.LastHeartbeat.Compare(b.LastHeartbeat)
+		}
+		return cmp.Or(c, strings.Compare(a.ID, b.ID))
+	}
+}
+
 // Service represents a registered project server
 type Service struct {
-	ID           string            `json:"id"`
-	Name         string            `json:"name"`
-	Version      string            `json:"version"`
-	Endpoints    []string          `json:"endpoints"`
-	Capabilities []string          `json:"capabilities"`
-	Metadata     map[string]string `json:"metadata,omitempty"`
-	Status       Status            `json:"status"`
-	RegisteredAt time.Time         `json:"registered_at"`
-	LastHeartbeat time.Time        `json:"last_heartbeat"`
-	HealthCheckURL string          `json:"health_check_url,omitempty"`
-}
-
-// IsHealthy checks if the service is healthy based on heartbeat
-func (s *Service) IsHealthy(timeout time.Duration) bool {
+	ID             string            `json:"id"`
+	TenantID       string            `json:"tenant_id,omitempty"`
+	Name           string            `json:"name"`
+	InstanceID     string            `json:"instance_id,omitempty"` // one of the instances of service Name; see GroupKey
+	Version        string            `json:"version"`
+	Endpoints      []Endpoint        `json:"endpoints"`
+	Capabilities   []string          `json:"capabilities"`
+	DependsOn      []string          `json:"depends_on,omitempty"` // capabilities the service needs from others
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Status         Status            `json:"status"`
+	OverrideStatus bool              `json:"override_status,omitempty"` // set by an operator; health checks leave Status alone
+	RegisteredAt   time.Time         `json:"registered_at"`
+	LastHeartbeat  time.Time         `json:"last_heartbeat"`
+	// HealthCheckURL is the URL of an http HealthCheck, kept for clients and
+	// records that predate HealthCheck
+	HealthCheckURL string       `json:"health_check_url,omitempty"`
+	HealthCheck    *HealthCheck `json:"health_check,omitempty"`
+	// CheckIntervalSeconds is how often the registry checks the service; 0
+	// uses the registry's health check interval
+	CheckIntervalSeconds int `json:"check_interval_seconds,omitempty"`
+	// DeletedAt is set when the service was deregistered; it can be restored
+	// until the registry purges it
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+}
+
+// IsHealthy checks if the service is healthy at now based on heartbeat
+func (s *Service) IsHealthy(timeout time.Duration, now time.Time) bool {
 	if s.Status == StatusUnhealthy {
 		return false
 	}
-	return time.Since(s.LastHeartbeat) < timeout
+	return now.Sub(s.LastHeartbeat) < timeout
+}
+
+// UpdateHeartbeat records a heartbeat received at now and, unless an
+// operator has overridden it, marks the service healthy
+func (s *Service) UpdateHeartbeat(now time.Time) {
+	s.LastHeartbeat = now
+	if !s.OverrideStatus {
+		s.Status = StatusHealthy
+	}
 }
 
-// UpdateHeartbeat updates the last heartbeat timestamp
-func (s *Service) UpdateHeartbeat() {
-	s.LastHeartbeat = time.Now()
-	s.Status = StatusHealthy
+// IsDiscoverable reports whether the service should be returned by discovery
+func (s *Service) IsDiscoverable() bool {
+	return s.Status != StatusDraining && !s.IsDeleted()
+}
+
+// IsDeleted reports whether the service has been soft-deleted
+func (s *Service) IsDeleted() bool {
+	return !s.DeletedAt.IsZero()
 }
 
 // MarkUnhealthy marks the service as unhealthy
 func (s *Service) MarkUnhealthy() {
 	s.Status = StatusUnhealthy
 }
+
+// ListFilter selects the services ListPaged returns. Statuses,
+// RegisteredSince and NamePrefix only narrow the selection when set.
+type ListFilter struct {
+	Scope          tenant.Scope
+	IncludeDeleted bool // also return soft-deleted services
+	// Statuses selects services stored with any of them; the health loop
+	// keeps the stored status in step with heartbeats and checks
+	Statuses []Status
+	// RegisteredSince selects services registered at or after it
+	RegisteredSince time.Time
+	NamePrefix      string
+}
+
+// Matches reports whether svc is selected by the filter, for repositories
+// that filter in memory
+func (f ListFilter) Matches(svc *Service) bool {
+	return f.Scope.Allows(svc.TenantID) &&
+		(f.IncludeDeleted || !svc.IsDeleted()) &&
+		(len(f.Statuses) == 0 || slices.Contains(f.Statuses, svc.Status)) &&
+		!svc.RegisteredAt.Before(f.RegisteredSince) &&
+		strings.HasPrefix(svc.Name, f.NamePrefix)
+}
+
+// SelectsByField reports whether the filter looks at more than the tenant
+// and deletion, which repositories may answer from their indexes alone
+func (f ListFilter) SelectsByField() bool {
+	return len(f.Statuses) > 0 || !f.RegisteredSince.IsZero() || f.NamePrefix != ""
+}
+
+// RegistryRepository defines the interface for service registry storage.
+// Soft-deleted services, those with DeletedAt set, are returned by Get but
+// left out of List, FindByCapability and, unless asked for, ListPaged.
+type RegistryRepository interface {
+	Register(ctx context.Context, svc *Service) error
+	// CreateIfAbsent stores svc unless a service with the same ID exists, in which
+	// case nothing is written and the existing record is returned instead
+	CreateIfAbsent(ctx context.Context, svc *Service) (*Service, error)
+	// Deregister removes a service permanently; soft deletes go through Update
+	Deregister(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*Service, error)
+	List(ctx context.Context) ([]*Service, error)
+	// ListPaged returns one page of the services matching filter ordered by
+	// opts.SortBy, reversed when opts.Descending is set, plus the total count
+	ListPaged(ctx context.Context, filter ListFilter, opts pagination.ListOptions) ([]*Service, int, error)
+	Update(ctx context.Context, svc *Service) error
+	// Purge permanently removes the services soft-deleted before the given
+	// time and returns how many were removed
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// GetRevision returns the registry revision, which BumpRevision moves
+	// forward after every change to the stored services, so equal revisions
+	// mean nothing changed in between.
+	GetRevision(ctx context.Context) (int64, error)
+	BumpRevision(ctx context.Context) (int64, error)
+}
+
+// CapabilityFinder is implemented by registry repositories that index services
+// by capability, so discovery does not have to scan every service
+type CapabilityFinder interface {
+	FindByCapability(ctx context.Context, capability string) ([]*Service, error)
+}
+
+// HeartbeatUpdater is implemented by registry repositories that can record a
+// heartbeat in place, without reading and rewriting the whole service. Like
+// Service.UpdateHeartbeat it marks the service healthy unless its status is
+// overridden. It returns ErrServiceNotFound for unknown IDs and
+// ErrServiceDeleted for soft-deleted services, which it leaves untouched. A
+// heartbeat that changes the status moves the registry revision forward.
+type HeartbeatUpdater interface {
+	UpdateHeartbeat(ctx context.Context, id string, at time.Time) error
+}
+
+// BatchUpdater is implemented by registry repositories that can store several
+// services in one round trip. The updates are stored together or not at all;
+// services no longer stored are skipped rather than failing the batch.
+type BatchUpdater interface {
+	BatchUpdate(ctx context.Context, services []*Service) error
+}
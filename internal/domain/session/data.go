@@ -0,0 +1,51 @@
+package session
+
+import (
+	"math"
+	"time"
+)
+
+// GetString returns a string Data value
+func (s *Session) GetString(key string) (string, bool) {
+	v, ok := s.Data[key].(string)
+	return v, ok
+}
+
+// GetInt returns an integral Data value. Numbers decoded from JSON are
+// float64, so they count only when they have no fractional part and fit in
+// an int.
+func (s *Session) GetInt(key string) (int, bool) {
+	switch v := s.Data[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		if v < math.MinInt || v > math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt || v >= math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// GetBool returns a boolean Data value
+func (s *Session) GetBool(key string) (bool, bool) {
+	v, ok := s.Data[key].(bool)
+	return v, ok
+}
+
+// GetTime returns a Data value holding a time formatted with layout. Clients
+// store times as RFC 3339 strings, read with time.RFC3339Nano.
+func (s *Session) GetTime(key, layout string) (time.Time, bool) {
+	v, ok := s.Data[key].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, v)
+	return t, err == nil
+}
@@ -0,0 +1,43 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSession_TypedData(t *testing.T) {
+	var sess Session
+	body := `{"data":{"theme":"dark","mfa":true,"cart_items":3,"ratio":0.5,"huge":1e300,"logged_in_at":"2024-05-01T08:00:00.123456789Z"}}`
+	if err := json.Unmarshal([]byte(body), &sess); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if v, ok := sess.GetString("theme"); !ok || v != "dark" {
+		t.Errorf("expected theme dark, got %q, %v", v, ok)
+	}
+	if v, ok := sess.GetBool("mfa"); !ok || !v {
+		t.Errorf("expected mfa true, got %v, %v", v, ok)
+	}
+	if v, ok := sess.GetInt("cart_items"); !ok || v != 3 {
+		t.Errorf("expected cart_items 3, got %d, %v", v, ok)
+	}
+	want := time.Date(2024, 5, 1, 8, 0, 0, 123456789, time.UTC)
+	if v, ok := sess.GetTime("logged_in_at", time.RFC3339Nano); !ok || !v.Equal(want) {
+		t.Errorf("expected logged_in_at %v, got %v, %v", want, v, ok)
+	}
+
+	for _, key := range []string{"ratio", "huge", "theme", "missing"} {
+		t.Run(key, func(t *testing.T) {
+			if v, ok := sess.GetInt(key); ok {
+				t.Errorf("expected %s not to read as an int, got %d", key, v)
+			}
+		})
+	}
+	if _, ok := sess.GetString("missing"); ok {
+		t.Error("expected a missing key not to read as a string")
+	}
+	if _, ok := sess.GetTime("theme", time.RFC3339Nano); ok {
+		t.Error("expected a non-time string not to read as a time")
+	}
+}
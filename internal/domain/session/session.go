@@ -1,31 +1,144 @@
 package session
 
 import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+)
+
+var (
+	// ErrSessionNotFound is returned by repositories when no session is stored under an ID
+	ErrSessionNotFound = fmt.Errorf("session %w", repository.ErrNotFound)
+	// ErrSessionExists is returned by repositories when a session ID is already taken
+	ErrSessionExists = fmt.Errorf("session %w", repository.ErrDuplicate)
 )
 
+// Fields sessions can be listed by; SortByCreatedAt is the default
+const (
+	SortByCreatedAt = "created_at"
+	SortByExpiresAt = "expires_at"
+	SortByID        = "id"
+)
+
+// SortFields lists the accepted values of pagination.ListOptions.SortBy
+var SortFields = []string{SortByCreatedAt, SortByExpiresAt, SortByID}
+
+// CompareBy returns a comparison function ordering sessions by the given sort
+// field, then by ID. Unknown fields order by creation time.
+func CompareBy(sortBy string) func(a, b *Session) int {
+	return func(a, b *Session) int {
+		var c int
+		switch sortBy {
+		case SortByID:
+		case SortByExpiresAt:
+			c = a.ExpiresAt.Compare(b.ExpiresAt)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		return cmp.Or(c, strings.Compare(a.ID, b.ID))
+	}
+}
+
 // Session represents a user session
 type Session struct {
 	ID        string         `json:"id"`
 	UserID    string         `json:"user_id"`
 	ServiceID string         `json:"service_id"`
+	TenantID  string         `json:"tenant_id,omitempty"`
 	Data      map[string]any `json:"data"`
 	CreatedAt time.Time      `json:"created_at"`
 	ExpiresAt time.Time      `json:"expires_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 }
 
-// IsExpired checks if the session has expired
-func (s *Session) IsExpired() bool {
-	return time.Now().After(s.ExpiresAt)
+// IsExpired checks if the session has expired by now
+func (s *Session) IsExpired(now time.Time) bool {
+	return Expired(s.ExpiresAt, now)
+}
+
+// Expired reports whether a session expiring at expiresAt has expired by now.
+// A session is expired from its expiry on, the same for every store.
+func Expired(expiresAt, now time.Time) bool {
+	return !now.Before(expiresAt)
+}
+
+// IsActive checks if the session is active at now
+func (s *Session) IsActive(now time.Time) bool {
+	return !s.IsExpired(now)
+}
+
+// Touch sets the session's UpdatedAt timestamp to now
+func (s *Session) Touch(now time.Time) {
+	s.UpdatedAt = now
+}
+
+// SessionRepository defines the interface for session storage
+type SessionRepository interface {
+	Create(ctx context.Context, sess *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	Update(ctx context.Context, sess *Session) error
+	Delete(ctx context.Context, id string) error
+	// ListByUser returns one page of a user's unexpired sessions within scope
+	// ordered by opts.SortBy, plus the total count
+	ListByUser(ctx context.Context, scope tenant.Scope, userID string, opts pagination.ListOptions) ([]*Session, int, error)
+	// GetByUserService returns the newest unexpired session within scope that
+	// userID holds on serviceID, or ErrSessionNotFound
+	GetByUserService(ctx context.Context, scope tenant.Scope, userID, serviceID string) (*Session, error)
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// Stats reports how full a session store is
+type Stats struct {
+	Sessions    int   `json:"sessions"`               // stored sessions, including expired ones not yet cleaned up
+	MaxSessions int   `json:"max_sessions,omitempty"` // 0 when the store is unbounded
+	Evicted     int64 `json:"evicted"`                // sessions dropped to make room since startup
+}
+
+// StatsReporter is implemented by session repositories that can report their
+// size without scanning storage
+type StatsReporter interface {
+	Stats() Stats
 }
 
-// IsActive checks if the session is currently active
-func (s *Session) IsActive() bool {
-	return !s.IsExpired()
+// ActiveCounter is implemented by session repositories that can count the
+// sessions of every tenant still active at now
+type ActiveCounter interface {
+	CountActive(ctx context.Context, now time.Time) (int, error)
+}
+
+// ExpiredRemover is implemented by session repositories that can return the
+// expired sessions they delete, so their owners can be told
+type ExpiredRemover interface {
+	// RemoveExpired deletes the sessions of every tenant expired by now and
+	// returns them
+	RemoveExpired(ctx context.Context, now time.Time) ([]*Session, error)
+}
+
+// Reasons a session ended
+const (
+	EndedExpired = "expired" // removed by a cleanup pass
+	EndedDeleted = "deleted" // removed over the API
+)
+
+// Ended is the data of a session.ended event. Like every session event it
+// leaves out the session's data.
+type Ended struct {
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	ServiceID string `json:"service_id"`
+	Reason    string `json:"reason"` // EndedExpired or EndedDeleted
 }
 
-// Touch updates the session's UpdatedAt timestamp
-func (s *Session) Touch() {
-	s.UpdatedAt = time.Now()
+// ExpiryReader is implemented by session repositories that can tell when a
+// session expires without loading and decoding it
+type ExpiryReader interface {
+	// Expiry returns when the session stored under id expires, or
+	// ErrSessionNotFound. It doesn't know the session's tenant.
+	Expiry(ctx context.Context, id string) (time.Time, error)
 }
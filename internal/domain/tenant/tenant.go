@@ -0,0 +1,44 @@
+// Package tenant confines stored sessions and services to the organization
+// that created them
+package tenant
+
+import (
+	"context"
+
+	"github.com/aq189/bin/internal/domain/token"
+)
+
+// Scope selects the tenants whose records a caller may see
+type Scope struct {
+	ID  string // the only tenant visible when All is false; "" is the default tenant
+	All bool
+}
+
+// Unrestricted sees every tenant's records
+var Unrestricted = Scope{All: true}
+
+// Only returns a scope confined to one tenant
+func Only(id string) Scope {
+	return Scope{ID: id}
+}
+
+// Allows reports whether a record owned by the given tenant is visible
+func (s Scope) Allows(id string) bool {
+	return s.All || s.ID == id
+}
+
+// FromContext returns the scope of the caller whose claims ctx carries.
+// Admins without a tenant are unrestricted, as are calls without claims,
+// which come from inside the server rather than over HTTP.
+func FromContext(ctx context.Context) Scope {
+	claims, ok := token.FromContext(ctx)
+	if !ok {
+		return Unrestricted
+	}
+
+	id := claims.Tenant()
+	if id == "" && claims.HasRole(token.RoleAdmin) {
+		return Unrestricted
+	}
+	return Only(id)
+}
@@ -0,0 +1,48 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/token"
+)
+
+func TestFromContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *token.Claims
+		want   Scope
+	}{
+		{name: "no claims", want: Unrestricted},
+		{name: "admin without tenant", claims: &token.Claims{Roles: []string{token.RoleAdmin}}, want: Unrestricted},
+		{name: "admin with tenant", claims: &token.Claims{Roles: []string{token.RoleAdmin}, TenantID: "acme"}, want: Only("acme")},
+		{name: "tenant claim", claims: &token.Claims{TenantID: "acme"}, want: Only("acme")},
+		{name: "tenant metadata is ignored", claims: &token.Claims{Metadata: map[string]any{token.MetadataTenant: "acme"}}, want: Only("")},
+		{name: "admin with tenant metadata", claims: &token.Claims{Roles: []string{token.RoleAdmin}, Metadata: map[string]any{token.MetadataTenant: "acme"}}, want: Unrestricted},
+		{name: "no tenant", claims: &token.Claims{Roles: []string{"reader"}}, want: Only("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = token.NewContext(ctx, tt.claims)
+			}
+			if got := FromContext(ctx); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestScope_Allows(t *testing.T) {
+	if !Unrestricted.Allows("acme") || !Unrestricted.Allows("") {
+		t.Error("expected the unrestricted scope to allow every tenant")
+	}
+	if !Only("acme").Allows("acme") || Only("acme").Allows("globex") || Only("acme").Allows("") {
+		t.Error("expected a tenant scope to allow only its tenant")
+	}
+	if Only("").Allows("acme") {
+		t.Error("expected the default tenant not to see other tenants")
+	}
+}
@@ -1 +1,249 @@
 package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Type distinguishes access tokens from refresh tokens
+type Type string
+
+const (
+	TypeAccess  Type = "access"
+	TypeRefresh Type = "refresh"
+)
+
+// MetadataTenant is the metadata key tokens issued before claims carried a
+// tenant of their own named it with. It is reserved: Tenant doesn't read it,
+// as callers choose their tokens' metadata, and the auth service drops it
+// from the metadata of the tokens it issues.
+const MetadataTenant = "tenant"
+
+// RoleAdmin is granted access to admin endpoints and, without a tenant, to every tenant's records
+const RoleAdmin = "admin"
+
+// RoleIssuer may issue tokens for any subject and roles, for services that
+// mint tokens on behalf of others
+const RoleIssuer = "issuer"
+
+// MetadataIssuedBy is the metadata key recording the subject that issued a token
+const MetadataIssuedBy = "issued_by"
+
+// ScopeWildcard matches any one segment of a scope, or every remaining
+// segment when it is the last one, e.g. "registry:heartbeat:*"
+const ScopeWildcard = "*"
+
+// Claims represents the claims carried by a root server token
+type Claims struct {
+	ID        string         `json:"jti"`
+	Subject   string         `json:"sub"`
+	Issuer    string         `json:"iss"`
+	Audience  string         `json:"aud,omitempty"`
+	ExpiresAt time.Time      `json:"exp"`
+	IssuedAt  time.Time      `json:"iat"`
+	Type      Type           `json:"typ"`
+	Roles     []string       `json:"roles,omitempty"`
+	Scopes    []string       `json:"scopes,omitempty"` // limit the token to the actions they name; none leaves it to its roles
+	TenantID  string         `json:"tenant,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated caller's claims
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims stored by NewContext
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// IsExpired checks if the claims have expired by now.
+// Claims without an expiry never expire.
+func (c *Claims) IsExpired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
+
+// HasRole reports whether the claims carry the given role
+func (c *Claims) HasRole(role string) bool {
+	return c != nil && slices.Contains(c.Roles, role)
+}
+
+// HasScope reports whether one of the claims' scopes covers the required one
+func (c *Claims) HasScope(required string) bool {
+	return c != nil && slices.ContainsFunc(c.Scopes, func(granted string) bool {
+		return MatchScope(granted, required)
+	})
+}
+
+// Scoped reports whether the claims carry scopes, limiting the token to them
+func (c *Claims) Scoped() bool {
+	return c != nil && len(c.Scopes) > 0
+}
+
+// MatchScope reports whether the granted scope covers the required one.
+// Scopes are colon-separated segments compared one by one; ScopeWildcard
+// matches any one segment, or all remaining ones when it ends the granted
+// scope. "session:read" does not cover "session:read:abc", "session:read:*"
+// and "session:*" do.
+func MatchScope(granted, required string) bool {
+	grantedSegments := strings.Split(granted, ":")
+	requiredSegments := strings.Split(required, ":")
+	for i, segment := range grantedSegments {
+		if i == len(requiredSegments) {
+			return false
+		}
+		if segment == ScopeWildcard {
+			if i == len(grantedSegments)-1 {
+				return true
+			}
+			continue
+		}
+		if segment != requiredSegments[i] {
+			return false
+		}
+	}
+	return len(grantedSegments) == len(requiredSegments)
+}
+
+// ValidScope reports whether scope is made of non-empty segments without spaces
+func ValidScope(scope string) bool {
+	for segment := range strings.SplitSeq(scope, ":") {
+		if segment == "" || strings.ContainsFunc(segment, unicode.IsSpace) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetString returns a string metadata value
+func (c *Claims) GetString(key string) (string, bool) {
+	v, ok := c.metadata(key).(string)
+	return v, ok
+}
+
+// GetStringSlice returns a metadata value holding only strings
+func (c *Claims) GetStringSlice(key string) ([]string, bool) {
+	switch v := c.metadata(key).(type) {
+	case []string:
+		return v, true
+	case []any:
+		out := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out[i] = s
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+// GetInt returns an integral metadata value. Floats count only when they
+// have no fractional part and fit in an int.
+func (c *Claims) GetInt(key string) (int, bool) {
+	switch v := c.metadata(key).(type) {
+	case int:
+		return v, true
+	case int64:
+		if v < math.MinInt || v > math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt || v >= math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// Tenant returns the tenant the claims belong to, or "" when none is set.
+// Only the tenant claim counts, never metadata.
+func (c *Claims) Tenant() string {
+	if c == nil {
+		return ""
+	}
+	return c.TenantID
+}
+
+// metadata returns the raw metadata value, tolerating nil claims and maps
+func (c *Claims) metadata(key string) any {
+	if c == nil {
+		return nil
+	}
+	return c.Metadata[key]
+}
+
+// UnmarshalJSON decodes claims, turning metadata numbers into int64 when they
+// are integral and float64 otherwise, so large IDs survive the round trip
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	aux := struct {
+		*plain
+		Metadata json.RawMessage `json:"metadata,omitempty"`
+	}{plain: (*plain)(c)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	c.Metadata = nil
+	if len(aux.Metadata) == 0 || bytes.Equal(aux.Metadata, []byte("null")) {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(aux.Metadata))
+	dec.UseNumber()
+	var metadata map[string]any
+	if err := dec.Decode(&metadata); err != nil {
+		return fmt.Errorf("decode metadata: %w", err)
+	}
+
+	for key, value := range metadata {
+		metadata[key] = normalize(value)
+	}
+	c.Metadata = metadata
+	return nil
+}
+
+// normalize replaces json.Number values, including nested ones, with int64 or float64
+func normalize(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalize(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,298 @@
+package token
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClaims_IsExpired(t *testing.T) {
+	expiresAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		claims Claims
+		now    time.Time
+		want   bool
+	}{
+		{name: "before expiry", claims: Claims{ExpiresAt: expiresAt}, now: expiresAt.Add(-time.Second), want: false},
+		{name: "at expiry", claims: Claims{ExpiresAt: expiresAt}, now: expiresAt, want: false},
+		{name: "after expiry", claims: Claims{ExpiresAt: expiresAt}, now: expiresAt.Add(time.Second), want: true},
+		{name: "no expiry", claims: Claims{}, now: expiresAt, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.IsExpired(tt.now); got != tt.want {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaims_HasRole(t *testing.T) {
+	claims := &Claims{Roles: []string{"reader", "admin"}}
+
+	if !claims.HasRole("admin") {
+		t.Error("expected admin role")
+	}
+	if claims.HasRole("writer") {
+		t.Error("expected no writer role")
+	}
+	if (&Claims{}).HasRole("admin") {
+		t.Error("expected claims without roles to have none")
+	}
+
+	var none *Claims
+	if none.HasRole("admin") {
+		t.Error("expected nil claims to have no roles")
+	}
+}
+
+func TestMatchScope(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required string
+		want     bool
+	}{
+		{granted: "session:read", required: "session:read", want: true},
+		{granted: "session:read", required: "session:write", want: false},
+		{granted: "session:read", required: "session:read:abc", want: false},
+		{granted: "session:read:abc", required: "session:read", want: false},
+		{granted: "registry:heartbeat:svc-123", required: "registry:heartbeat:svc-123", want: true},
+		{granted: "registry:heartbeat:svc-123", required: "registry:heartbeat:svc-456", want: false},
+		{granted: "registry:heartbeat:*", required: "registry:heartbeat:svc-456", want: true},
+		{granted: "registry:heartbeat:*", required: "registry:heartbeat", want: false},
+		{granted: "session:*", required: "session:read:abc", want: true},
+		{granted: "session:*:abc", required: "session:write:abc", want: true},
+		{granted: "session:*:abc", required: "session:write:def", want: false},
+		{granted: "session:*:abc", required: "session:write", want: false},
+		{granted: "*", required: "registry:heartbeat:svc-123", want: true},
+		{granted: "registry:heartbeat:svc-123", required: "registry:heartbeat:svc-123:extra", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.granted+" "+tt.required, func(t *testing.T) {
+			if got := MatchScope(tt.granted, tt.required); got != tt.want {
+				t.Errorf("MatchScope(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaims_HasScope(t *testing.T) {
+	claims := &Claims{Roles: []string{"reader"}, Scopes: []string{"session:read:*", "registry:heartbeat:svc-123"}}
+
+	if !claims.Scoped() || !claims.HasScope("session:read:abc") || !claims.HasScope("registry:heartbeat:svc-123") {
+		t.Error("expected the granted scopes to be covered")
+	}
+	if claims.HasScope("session:write:abc") || claims.HasScope("registry:heartbeat:svc-456") {
+		t.Error("expected other scopes not to be covered")
+	}
+
+	var none *Claims
+	if (&Claims{Roles: []string{RoleAdmin}}).Scoped() || none.Scoped() || none.HasScope("session:read") {
+		t.Error("expected claims without scopes to be unscoped")
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for scope, want := range map[string]bool{
+		"session:read":       true,
+		"registry:*":         true,
+		"":                   false,
+		"session::read":      false,
+		"session:":           false,
+		"session:read all":   false,
+		"registry:heartbeat": true,
+	} {
+		if got := ValidScope(scope); got != want {
+			t.Errorf("ValidScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
+
+func TestClaims_MetadataAccessors(t *testing.T) {
+	var claims Claims
+	err := json.Unmarshal([]byte(`{
+		"sub": "user-1",
+		"metadata": {
+			"tenant": "acme",
+			"region": 7,
+			"ratio": 0.5,
+			"whole": 3.0,
+			"big": 9007199254740993,
+			"huge": 1e30,
+			"scopes": ["read", "write"],
+			"mixed": ["read", 1],
+			"nested": {"depth": 2, "inner": [1.5, {"n": 4}]},
+			"nothing": null
+		}
+	}`), &claims)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	t.Run("GetString", func(t *testing.T) {
+		if v, ok := claims.GetString("tenant"); !ok || v != "acme" {
+			t.Errorf("expected acme, got %q, %v", v, ok)
+		}
+		for _, key := range []string{"region", "nothing", "missing", "scopes"} {
+			if v, ok := claims.GetString(key); ok {
+				t.Errorf("expected %s not to be a string, got %q", key, v)
+			}
+		}
+	})
+
+	t.Run("GetInt", func(t *testing.T) {
+		tests := []struct {
+			key    string
+			want   int
+			wantOK bool
+		}{
+			{key: "region", want: 7, wantOK: true},
+			{key: "whole", want: 3, wantOK: true},
+			{key: "big", want: 9007199254740993, wantOK: true},
+			{key: "ratio"},
+			{key: "huge"},
+			{key: "tenant"},
+			{key: "nothing"},
+			{key: "missing"},
+		}
+		for _, tt := range tests {
+			got, ok := claims.GetInt(tt.key)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("GetInt(%q) = %d, %v; want %d, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		}
+	})
+
+	t.Run("GetStringSlice", func(t *testing.T) {
+		if v, ok := claims.GetStringSlice("scopes"); !ok || !slices.Equal(v, []string{"read", "write"}) {
+			t.Errorf("expected [read write], got %v, %v", v, ok)
+		}
+		for _, key := range []string{"mixed", "tenant", "nothing", "missing"} {
+			if v, ok := claims.GetStringSlice(key); ok {
+				t.Errorf("expected %s not to be a string slice, got %v", key, v)
+			}
+		}
+	})
+
+	t.Run("nested numbers are normalized", func(t *testing.T) {
+		nested, ok := claims.Metadata["nested"].(map[string]any)
+		if !ok {
+			t.Fatalf("expected nested map, got %T", claims.Metadata["nested"])
+		}
+		if _, ok := nested["depth"].(int64); !ok {
+			t.Errorf("expected nested int64, got %T", nested["depth"])
+		}
+		inner := nested["inner"].([]any)
+		if _, ok := inner[0].(float64); !ok {
+			t.Errorf("expected nested float64, got %T", inner[0])
+		}
+		if _, ok := inner[1].(map[string]any)["n"].(int64); !ok {
+			t.Errorf("expected deeply nested int64, got %T", inner[1].(map[string]any)["n"])
+		}
+	})
+
+	t.Run("Tenant", func(t *testing.T) {
+		if claims.Tenant() != "" {
+			t.Errorf("expected the tenant metadata ignored, got %q", claims.Tenant())
+		}
+		if (&Claims{}).Tenant() != "" {
+			t.Error("expected empty tenant without a tenant claim")
+		}
+		if (&Claims{TenantID: "globex", Metadata: claims.Metadata}).Tenant() != "globex" {
+			t.Error("expected the tenant claim")
+		}
+	})
+}
+
+func TestClaims_AccessorsWithoutMetadata(t *testing.T) {
+	for name, claims := range map[string]*Claims{"nil claims": nil, "nil metadata": {}} {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := claims.GetString("tenant"); ok {
+				t.Error("expected GetString to report missing")
+			}
+			if _, ok := claims.GetInt("tenant"); ok {
+				t.Error("expected GetInt to report missing")
+			}
+			if _, ok := claims.GetStringSlice("tenant"); ok {
+				t.Error("expected GetStringSlice to report missing")
+			}
+			if claims.Tenant() != "" {
+				t.Error("expected empty tenant")
+			}
+		})
+	}
+}
+
+func TestClaims_UnmarshalRoundTrip(t *testing.T) {
+	original := &Claims{
+		ID:       "abc",
+		Subject:  "user-1",
+		Type:     TypeAccess,
+		Roles:    []string{"admin"},
+		Metadata: map[string]any{"tenant": "acme", "count": 2},
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded Claims
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if decoded.ID != "abc" || decoded.Subject != "user-1" || decoded.Type != TypeAccess || !decoded.HasRole("admin") {
+		t.Errorf("unexpected claims %+v", decoded)
+	}
+	if n, ok := decoded.GetInt("count"); !ok || n != 2 {
+		t.Errorf("expected count 2, got %d, %v", n, ok)
+	}
+
+	t.Run("null metadata", func(t *testing.T) {
+		var claims Claims
+		if err := json.Unmarshal([]byte(`{"sub":"x","metadata":null}`), &claims); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if claims.Metadata != nil {
+			t.Errorf("expected nil metadata, got %v", claims.Metadata)
+		}
+	})
+
+	t.Run("non-object metadata is rejected", func(t *testing.T) {
+		var claims Claims
+		if err := json.Unmarshal([]byte(`{"sub":"x","metadata":[1,2]}`), &claims); err == nil {
+			t.Error("expected error for array metadata")
+		}
+	})
+}
+
+func FuzzClaimsUnmarshal(f *testing.F) {
+	f.Add([]byte(`{"sub":"user-1","metadata":{"tenant":"acme","n":1,"f":1.5}}`))
+	f.Add([]byte(`{"metadata":{"nested":{"a":[1,{"b":null}]}}}`))
+	f.Add([]byte(`{"metadata":{"n":1e400,"m":-9223372036854775809}}`))
+	f.Add([]byte(`{"metadata":null}`))
+	f.Add([]byte(`{"metadata":"oops"}`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var claims Claims
+		if err := json.Unmarshal(data, &claims); err != nil {
+			return
+		}
+
+		for key := range claims.Metadata {
+			claims.GetString(key)
+			claims.GetInt(key)
+			claims.GetStringSlice(key)
+		}
+		claims.Tenant()
+		claims.HasRole("admin")
+		claims.IsExpired(time.Now())
+	})
+}
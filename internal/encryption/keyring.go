@@ -0,0 +1,106 @@
+// Package encryption seals data at rest with AES-256-GCM under a set of
+// identified keys, so keys can be rotated without losing older records.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the length of an AES-256 key in bytes
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when data was sealed under a key the keyring does not hold
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrDecrypt is returned when data cannot be authenticated with its key
+	ErrDecrypt = errors.New("decryption failed")
+)
+
+// Key is an AES-256 key and the ID recorded with data sealed under it
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKey decodes a base64 (standard or URL alphabet, padded or not) 32-byte key
+func ParseKey(id, encoded string) (Key, error) {
+	if id == "" {
+		return Key{}, errors.New("key id is required")
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if secret, err := enc.DecodeString(encoded); err == nil {
+			if len(secret) != KeySize {
+				return Key{}, fmt.Errorf("key %s: must be %d bytes, got %d", id, KeySize, len(secret))
+			}
+			return Key{ID: id, Secret: secret}, nil
+		}
+	}
+	return Key{}, fmt.Errorf("key %s: not valid base64", id)
+}
+
+// Keyring seals with its primary key and opens data sealed under any of its keys
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring sealing with primary. Previous keys are only
+// used to open data sealed before a rotation.
+func NewKeyring(primary Key, previous ...Key) (*Keyring, error) {
+	k := &Keyring{primary: primary.ID, aeads: make(map[string]cipher.AEAD, 1+len(previous))}
+	for _, key := range append([]Key{primary}, previous...) {
+		if key.ID == "" {
+			return nil, errors.New("key id is required")
+		}
+		if _, exists := k.aeads[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		if len(key.Secret) != KeySize {
+			return nil, fmt.Errorf("key %s: must be %d bytes, got %d", key.ID, KeySize, len(key.Secret))
+		}
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+		k.aeads[key.ID] = aead
+	}
+	return k, nil
+}
+
+// Seal encrypts plaintext under the primary key with a random nonce. The
+// additional data is authenticated but not stored; Open must be given the
+// same value. The result is the nonce followed by the ciphertext.
+func (k *Keyring) Seal(plaintext, additionalData []byte) (keyID string, sealed []byte, err error) {
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return k.primary, aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts data produced by Seal under the named key
+func (k *Keyring) Open(keyID string, sealed, additionalData []byte) ([]byte, error) {
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
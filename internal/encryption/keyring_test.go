@@ -0,0 +1,106 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(id string, fill byte) Key {
+	return Key{ID: id, Secret: bytes.Repeat([]byte{fill}, KeySize)}
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	keyring, err := NewKeyring(testKey("k1", 1))
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+
+	keyID, sealed, err := keyring.Seal([]byte("secret"), []byte("sess-1"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if keyID != "k1" || bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("expected ciphertext under k1, got %s %q", keyID, sealed)
+	}
+
+	_, again, _ := keyring.Seal([]byte("secret"), []byte("sess-1"))
+	if bytes.Equal(sealed, again) {
+		t.Error("expected a fresh nonce per seal")
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		keyID   string
+		sealed  []byte
+		aad     string
+		wantErr error
+	}{
+		{name: "round trip", keyring: keyring, keyID: "k1", sealed: sealed, aad: "sess-1"},
+		{name: "other additional data", keyring: keyring, keyID: "k1", sealed: sealed, aad: "sess-2", wantErr: ErrDecrypt},
+		{name: "truncated", keyring: keyring, keyID: "k1", sealed: sealed[:4], aad: "sess-1", wantErr: ErrDecrypt},
+		{name: "unknown key", keyring: keyring, keyID: "k0", sealed: sealed, aad: "sess-1", wantErr: ErrUnknownKey},
+		{name: "wrong key under the same id", keyring: must(NewKeyring(testKey("k1", 2))), keyID: "k1", sealed: sealed, aad: "sess-1", wantErr: ErrDecrypt},
+		{name: "rotated key still opens", keyring: must(NewKeyring(testKey("k2", 2), testKey("k1", 1))), keyID: "k1", sealed: sealed, aad: "sess-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plaintext, err := tt.keyring.Open(tt.keyID, tt.sealed, []byte(tt.aad))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || string(plaintext) != "secret" {
+				t.Errorf("expected plaintext, got %q (%v)", plaintext, err)
+			}
+		})
+	}
+}
+
+func TestNewKeyring_Rejects(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []Key
+	}{
+		{name: "short key", keys: []Key{{ID: "k1", Secret: []byte("short")}}},
+		{name: "missing id", keys: []Key{testKey("", 1)}},
+		{name: "duplicate id", keys: []Key{testKey("k1", 1), testKey("k1", 2)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.keys[0], tt.keys[1:]...); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	secret := bytes.Repeat([]byte{0xfb}, KeySize)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawURLEncoding} {
+		key, err := ParseKey("k1", enc.EncodeToString(secret))
+		if err != nil || !bytes.Equal(key.Secret, secret) {
+			t.Errorf("expected key to decode, got %v", err)
+		}
+	}
+
+	if _, err := ParseKey("k1", base64.StdEncoding.EncodeToString(secret[:16])); err == nil {
+		t.Error("expected a 16-byte key to be rejected")
+	}
+	if _, err := ParseKey("k1", "not base64!"); err == nil {
+		t.Error("expected invalid base64 to be rejected")
+	}
+}
+
+func must(k *Keyring, err error) *Keyring {
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
@@ -0,0 +1,48 @@
+// Package eventbus implements event.Bus: Local fans events out within one
+// root-server instance, and Shared also carries them to every other instance
+// over a Transport such as Redis pub/sub.
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aq189/bin/internal/domain/event"
+)
+
+// Local is the in-process event.Bus: every subscriber is called with each
+// published event on the publishing goroutine
+type Local struct {
+	mu       sync.RWMutex
+	handlers map[int]func(event.Event)
+	next     int
+}
+
+// NewLocal creates an in-process bus without subscribers
+func NewLocal() *Local {
+	return &Local{handlers: make(map[int]func(event.Event))}
+}
+
+// Publish calls every subscriber with e
+func (b *Local) Publish(ctx context.Context, e event.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handle := range b.handlers {
+		handle(e)
+	}
+}
+
+// Subscribe calls handle with every event published until unsubscribed
+func (b *Local) Subscribe(handle func(event.Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handle
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
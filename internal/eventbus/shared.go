@@ -0,0 +1,195 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// Defaults applied when Config leaves them unset
+const (
+	defaultQueueSize  = 256
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// Transport carries encoded events between the instances sharing a bus
+type Transport interface {
+	// Publish sends payload to every subscribed instance, this one included
+	Publish(ctx context.Context, payload []byte) error
+	// Subscribe calls subscribed once it receives, then receive with every
+	// payload published until ctx is done or the connection fails, and
+	// returns why it stopped
+	Subscribe(ctx context.Context, subscribed func(), receive func(payload []byte)) error
+}
+
+// Config holds shared bus settings
+type Config struct {
+	// Origin identifies this instance in the events it sends; empty
+	// generates a random ID
+	Origin string
+	// QueueSize is how many events may wait to be sent before further ones
+	// reach local subscribers only; 0 uses 256
+	QueueSize int
+	// MinBackoff is the delay before resubscribing after the connection
+	// failed, doubled for every further failure up to MaxBackoff; zero
+	// values use 1 and 30 seconds
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// envelope is an event as sent over the transport
+type envelope struct {
+	Origin string      `json:"origin"`
+	Event  event.Event `json:"event"`
+}
+
+// Shared is an event.Bus spanning every instance connected to the same
+// Transport. Each instance sends the events published on it to the others
+// and hands theirs to its local subscribers, skipping the ones it sent
+// itself, which its subscribers already had. Received events carry their
+// data decoded from JSON rather than its original type.
+//
+// While the subscription is down the bus is local only: events are neither
+// sent nor received until Start has resubscribed.
+type Shared struct {
+	local     *Local
+	transport Transport
+	config    Config
+	logger    logger.ILogger
+	queue     chan event.Event
+	connected atomic.Bool
+}
+
+// NewShared creates a bus carrying events over transport once Start runs
+func NewShared(transport Transport, cfg Config, log logger.ILogger) *Shared {
+	if cfg.Origin == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		cfg.Origin = hex.EncodeToString(b)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	cfg.MaxBackoff = max(cfg.MaxBackoff, cfg.MinBackoff)
+
+	return &Shared{
+		local:     NewLocal(),
+		transport: transport,
+		config:    cfg,
+		logger:    log,
+		queue:     make(chan event.Event, cfg.QueueSize),
+	}
+}
+
+// Publish hands e to the local subscribers and queues it for the other
+// instances. It never blocks: while disconnected or when the queue is full,
+// e stays local.
+func (b *Shared) Publish(ctx context.Context, e event.Event) {
+	b.local.Publish(ctx, e)
+	if !b.connected.Load() {
+		return
+	}
+
+	select {
+	case b.queue <- e:
+	default:
+		b.logger.Warn("event bus queue full, event not sent to other instances", "event_id", e.ID, "event", e.Type)
+	}
+}
+
+// Subscribe calls handle with every event published on any instance until unsubscribed
+func (b *Shared) Subscribe(handle func(event.Event)) func() {
+	return b.local.Subscribe(handle)
+}
+
+// Connected reports whether events currently reach the other instances
+func (b *Shared) Connected() bool {
+	return b.connected.Load()
+}
+
+// Start subscribes to the transport and sends queued events until ctx is
+// done, resubscribing with backoff whenever the connection fails
+func (b *Shared) Start(ctx context.Context) {
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		b.send(ctx)
+	}()
+
+	b.subscribe(ctx)
+	<-sent
+}
+
+// subscribe keeps a subscription to the transport until ctx is done
+func (b *Shared) subscribe(ctx context.Context) {
+	backoff := b.config.MinBackoff
+	failed := false
+	for {
+		err := b.transport.Subscribe(ctx, func() {
+			if failed {
+				b.logger.Info("event bus reconnected, sharing events with other instances again")
+			}
+			failed = false
+			backoff = b.config.MinBackoff
+			b.connected.Store(true)
+		}, b.receive)
+		b.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.logger.Warn("event bus connection failed, delivering events locally only", "error", err, "retry_in", backoff)
+		failed = true
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, b.config.MaxBackoff)
+	}
+}
+
+// send sends queued events to the other instances until ctx is done
+func (b *Shared) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-b.queue:
+			payload, err := json.Marshal(envelope{Origin: b.config.Origin, Event: e})
+			if err != nil {
+				b.logger.Error("encode event failed", "event_id", e.ID, "event", e.Type, "error", err)
+				continue
+			}
+			if err := b.transport.Publish(ctx, payload); err != nil && ctx.Err() == nil {
+				b.logger.Warn("send event to other instances failed", "event_id", e.ID, "event", e.Type, "error", err)
+			}
+		}
+	}
+}
+
+// receive hands an event sent by another instance to the local subscribers
+func (b *Shared) receive(payload []byte) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		b.logger.Warn("ignoring malformed event from the bus", "error", err)
+		return
+	}
+	if env.Origin == b.config.Origin {
+		return
+	}
+	b.local.Publish(context.Background(), env.Event)
+}
@@ -0,0 +1,203 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+var errHubDown = errors.New("hub down")
+
+// hub is an in-memory Transport shared by the buses of a test. Taking it down
+// drops every subscription and fails new ones until it is back up.
+type hub struct {
+	mu    sync.Mutex
+	conns map[*hubConn]bool
+	down  bool
+}
+
+type hubConn struct {
+	payloads chan []byte
+	dropped  chan struct{}
+}
+
+func newHub() *hub {
+	return &hub{conns: make(map[*hubConn]bool)}
+}
+
+func (h *hub) Publish(ctx context.Context, payload []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.down {
+		return errHubDown
+	}
+	for conn := range h.conns {
+		conn.payloads <- payload
+	}
+	return nil
+}
+
+func (h *hub) Subscribe(ctx context.Context, subscribed func(), receive func(payload []byte)) error {
+	h.mu.Lock()
+	if h.down {
+		h.mu.Unlock()
+		return errHubDown
+	}
+	conn := &hubConn{payloads: make(chan []byte, 16), dropped: make(chan struct{})}
+	h.conns[conn] = true
+	h.mu.Unlock()
+
+	subscribed()
+	for {
+		select {
+		case <-ctx.Done():
+			h.mu.Lock()
+			delete(h.conns, conn)
+			h.mu.Unlock()
+			return ctx.Err()
+		case <-conn.dropped:
+			return errHubDown
+		case payload := <-conn.payloads:
+			receive(payload)
+		}
+	}
+}
+
+func (h *hub) setDown(down bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down = down
+	if down {
+		for conn := range h.conns {
+			close(conn.dropped)
+		}
+		clear(h.conns)
+	}
+}
+
+// startShared starts a bus over transport and returns it with the channel
+// its subscriber receives events on
+func startShared(t *testing.T, transport Transport, origin string) (*Shared, <-chan event.Event) {
+	t.Helper()
+	bus := NewShared(transport, Config{Origin: origin, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}, logger.NewNop())
+	received := make(chan event.Event, 16)
+	bus.Subscribe(func(e event.Event) { received <- e })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return bus, received
+}
+
+// eventually fails the test unless cond holds within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectEvent fails the test unless received delivers the event with id
+func expectEvent(t *testing.T, received <-chan event.Event, id string) {
+	t.Helper()
+	select {
+	case e := <-received:
+		if e.ID != id {
+			t.Fatalf("expected event %s, got %s", id, e.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected event %s", id)
+	}
+}
+
+// expectNoEvent fails the test if received delivers an event shortly
+func expectNoEvent(t *testing.T, received <-chan event.Event) {
+	t.Helper()
+	select {
+	case e := <-received:
+		t.Fatalf("expected no event, got %s", e.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLocal(t *testing.T) {
+	bus := NewLocal()
+	var first, second []string
+	unsubscribe := bus.Subscribe(func(e event.Event) { first = append(first, e.ID) })
+	bus.Subscribe(func(e event.Event) { second = append(second, e.ID) })
+
+	bus.Publish(context.Background(), event.Event{ID: "evt-1"})
+	unsubscribe()
+	bus.Publish(context.Background(), event.Event{ID: "evt-2"})
+
+	if len(first) != 1 || len(second) != 2 {
+		t.Errorf("expected every subscriber called until unsubscribed, got %v and %v", first, second)
+	}
+}
+
+func TestShared_CrossInstanceDelivery(t *testing.T) {
+	h := newHub()
+	a, fromA := startShared(t, h, "instance-a")
+	b, fromB := startShared(t, h, "instance-b")
+	eventually(t, "both instances subscribed", func() bool { return a.Connected() && b.Connected() })
+
+	a.Publish(context.Background(), event.New(event.ServiceRegistered, "acme", map[string]string{"id": "payment-1"}))
+	local := <-fromA
+	expectEvent(t, fromB, local.ID)
+	// a's own event comes back over the hub and is dropped
+	expectNoEvent(t, fromA)
+
+	b.Publish(context.Background(), event.Event{ID: "evt-b", Type: event.ServiceDeregistered})
+	expectEvent(t, fromB, "evt-b")
+	expectEvent(t, fromA, "evt-b")
+	expectNoEvent(t, fromB)
+}
+
+func TestShared_DegradesAndReconnects(t *testing.T) {
+	h := newHub()
+	a, fromA := startShared(t, h, "instance-a")
+	b, fromB := startShared(t, h, "instance-b")
+	eventually(t, "both instances subscribed", func() bool { return a.Connected() && b.Connected() })
+
+	h.setDown(true)
+	eventually(t, "the instances to notice the lost connection", func() bool { return !a.Connected() && !b.Connected() })
+	a.Publish(context.Background(), event.Event{ID: "evt-1"})
+	expectEvent(t, fromA, "evt-1")
+	expectNoEvent(t, fromB)
+
+	h.setDown(false)
+	eventually(t, "both instances resubscribed", func() bool { return a.Connected() && b.Connected() })
+	a.Publish(context.Background(), event.Event{ID: "evt-2"})
+	expectEvent(t, fromA, "evt-2")
+	expectEvent(t, fromB, "evt-2")
+}
+
+func TestShared_IgnoresMalformedPayloads(t *testing.T) {
+	bus := NewShared(newHub(), Config{}, logger.NewNop())
+	var received []event.Event
+	bus.Subscribe(func(e event.Event) { received = append(received, e) })
+
+	bus.receive([]byte("not json"))
+	bus.receive([]byte(`{"origin":"` + bus.config.Origin + `","event":{"id":"evt-1"}}`))
+	bus.receive([]byte(`{"origin":"other","event":{"id":"evt-2"}}`))
+
+	if len(received) != 1 || received[0].ID != "evt-2" {
+		t.Errorf("expected only the other instance's event, got %+v", received)
+	}
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	domainaudit "github.com/aq189/bin/internal/domain/audit"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/service/audit"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// Export formats of GET /audit/events, besides the paginated JSON default
+const (
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+// auditCSVHeader is the first row of a CSV export
+var auditCSVHeader = []string{"id", "time", "actor", "action", "resource", "request_id", "details"}
+
+// AuditHandler serves the audit events
+type AuditHandler struct {
+	service *audit.Service
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(service *audit.Service) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// Events handles GET /audit/events, filtered by the since and until
+// (RFC 3339) and actor, action and resource query parameters.
+// It answers a page of up to limit events, newest first, continued by
+// passing its next_cursor as cursor. With ?format=ndjson or csv, or an Accept
+// header of application/x-ndjson or text/csv, every matching event is
+// streamed instead, one flushed row at a time.
+func (h *AuditHandler) Events(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var errs validation.Errors
+	filter := domainaudit.Filter{
+		Since:    queryTime(query.Get("since"), "since", &errs),
+		Until:    queryTime(query.Get("until"), "until", &errs),
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Resource: query.Get("resource"),
+	}
+	format := auditFormat(r)
+	if format != "" && format != formatNDJSON && format != formatCSV {
+		errs.Add("format", "must be one of json, ndjson, csv")
+	}
+	limit := pagination.DefaultLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > pagination.MaxLimit {
+			errs.Add("limit", fmt.Sprintf("must be an integer from 1 to %d", pagination.MaxLimit))
+		}
+		limit = n
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	if format == formatNDJSON || format == formatCSV {
+		h.export(w, r, filter, format)
+		return
+	}
+
+	page, err := h.service.List(r.Context(), filter, query.Get("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, audit.ErrInvalidCursor) {
+			errs.Add("cursor", "must be a next_cursor returned by a previous page")
+			writeValidationError(w, r, errs)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list audit events")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// export streams the events matching filter in format, flushing each row so
+// neither side holds the whole set. Once the first row is out a failure can
+// only cut the response short.
+func (h *AuditHandler) export(w http.ResponseWriter, r *http.Request, filter domainaudit.Filter, format string) {
+	rc := http.NewResponseController(w)
+	started := false
+	begin := func() {
+		if started {
+			return
+		}
+		started = true
+		if format == formatCSV {
+			w.Header().Set("Content-Type", "text/csv")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	var write func(*domainaudit.Event) error
+	if format == formatCSV {
+		cw := csv.NewWriter(w)
+		write = func(e *domainaudit.Event) error {
+			details := ""
+			if len(e.Details) > 0 {
+				b, _ := json.Marshal(e.Details)
+				details = string(b)
+			}
+			cw.Write([]string{strconv.FormatInt(e.ID, 10), e.Time.Format(time.RFC3339Nano), e.Actor, e.Action, e.Resource, e.RequestID, details})
+			cw.Flush()
+			return cw.Error()
+		}
+		begin()
+		cw.Write(auditCSVHeader)
+		cw.Flush()
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(e *domainaudit.Event) error { return enc.Encode(e) }
+	}
+
+	err := h.service.Export(r.Context(), filter, func(e *domainaudit.Event) error {
+		begin()
+		if err := write(e); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil && !started {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to export audit events")
+		return
+	}
+	// An export matching nothing is an empty body
+	begin()
+}
+
+// auditFormat returns the export format asked for by the format query
+// parameter or, failing that, the Accept header; empty for paginated JSON
+func auditFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format == "json" {
+			return ""
+		}
+		return format
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return formatNDJSON
+	case strings.Contains(accept, "text/csv"):
+		return formatCSV
+	}
+	return ""
+}
+
+// queryTime parses an optional RFC 3339 query parameter, adding an error for
+// field to errs when it is malformed
+func queryTime(raw, field string, errs *validation.Errors) time.Time {
+	if raw == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		errs.Add(field, "must be an RFC 3339 time")
+	}
+	return t
+}
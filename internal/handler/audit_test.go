@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	domainaudit "github.com/aq189/bin/internal/domain/audit"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/audit"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+var auditStart = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// flushCounter is a response recorder counting flushes
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushCounter) Flush() {
+	f.flushes++
+	f.ResponseRecorder.Flush()
+}
+
+func newAuditHandler(t *testing.T, n int) *AuditHandler {
+	t.Helper()
+	repo := memory.NewAuditRepository(0)
+	for i := range n {
+		repo.Append(context.Background(), &domainaudit.Event{
+			Time:     auditStart.Add(time.Duration(i) * time.Second),
+			Actor:    []string{"alice", "bob"}[i%2],
+			Action:   "registry.set_status",
+			Resource: fmt.Sprintf("service/payment-%d", i),
+			Details:  map[string]string{"after_status": "draining"},
+		})
+	}
+	return NewAuditHandler(audit.NewService(repo, audit.Config{}, logger.NewNop()))
+}
+
+func TestAuditHandler_Events(t *testing.T) {
+	h := newAuditHandler(t, 5)
+
+	var ids []int64
+	cursor := ""
+	for range 10 {
+		rec := httptest.NewRecorder()
+		h.Events(rec, httptest.NewRequest(http.MethodGet, "/audit/events?limit=2&cursor="+cursor, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var page audit.Page
+		json.NewDecoder(rec.Body).Decode(&page)
+		for _, e := range page.Items {
+			ids = append(ids, e.ID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = *page.NextCursor
+	}
+	if fmt.Sprint(ids) != "[5 4 3 2 1]" {
+		t.Errorf("expected every event newest first, got %v", ids)
+	}
+
+	since := auditStart.Add(time.Second).Format(time.RFC3339)
+	until := auditStart.Add(4 * time.Second).Format(time.RFC3339)
+	rec := httptest.NewRecorder()
+	h.Events(rec, httptest.NewRequest(http.MethodGet, "/audit/events?actor=bob&since="+since+"&until="+until, nil))
+	var page audit.Page
+	json.NewDecoder(rec.Body).Decode(&page)
+	if len(page.Items) != 2 || page.Items[0].Resource != "service/payment-3" || page.Items[1].Resource != "service/payment-1" {
+		t.Errorf("expected bob's events 3 and 1, got %+v", page.Items)
+	}
+}
+
+func TestAuditHandler_EventsInvalid(t *testing.T) {
+	h := newAuditHandler(t, 1)
+
+	tests := []struct {
+		query string
+		field string
+	}{
+		{query: "since=yesterday", field: "since"},
+		{query: "until=2026-10-01", field: "until"},
+		{query: "limit=0", field: "limit"},
+		{query: "format=xml", field: "format"},
+		{query: "cursor=abc", field: "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.Events(rec, httptest.NewRequest(http.MethodGet, "/audit/events?"+tt.query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", rec.Code)
+			}
+			var resp ErrorResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if len(resp.Fields) != 1 || resp.Fields[0].Field != tt.field {
+				t.Errorf("expected %s reported, got %+v", tt.field, resp.Fields)
+			}
+		})
+	}
+}
+
+func TestAuditHandler_ExportNDJSON(t *testing.T) {
+	const n = 3000
+	h := newAuditHandler(t, n)
+
+	rec := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodGet, "/audit/events", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	h.Events(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected an NDJSON stream, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.flushes != n {
+		t.Errorf("expected a flush per row, got %d for %d rows", rec.flushes, n)
+	}
+
+	lines := 0
+	want := int64(n)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var e domainaudit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %d: %v", lines, err)
+		}
+		if e.ID != want {
+			t.Fatalf("line %d: expected event %d, got %d", lines, want, e.ID)
+		}
+		want--
+		lines++
+	}
+	if lines != n {
+		t.Errorf("expected %d lines, got %d", n, lines)
+	}
+}
+
+func TestAuditHandler_ExportCSV(t *testing.T) {
+	h := newAuditHandler(t, 4)
+
+	rec := httptest.NewRecorder()
+	h.Events(rec, httptest.NewRequest(http.MethodGet, "/audit/events?format=csv&actor=alice", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected a CSV stream, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(auditCSVHeader, ",") {
+		t.Fatalf("expected a header and alice's 2 events, got %v", rows)
+	}
+	if got := rows[1]; got[0] != "3" || got[2] != "alice" || got[4] != "service/payment-2" || got[6] != `{"after_status":"draining"}` {
+		t.Errorf("expected event 3, got %v", got)
+	}
+}
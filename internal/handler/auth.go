@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/pkg/jwt"
+)
+
+// AuthHandler serves token and API key endpoints
+type AuthHandler struct {
+	service *auth.Service
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(service *auth.Service) *AuthHandler {
+	return &AuthHandler{service: service}
+}
+
+// tokenRequest carries a token for validation or revocation
+type tokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// validateRequest is the body of POST /auth/validate
+type validateRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Audience string `json:"audience,omitempty"` // the service the token must be issued for
+}
+
+// refreshRequest carries a refresh token
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// createAPIKeyRequest is the body of POST /auth/apikeys
+type createAPIKeyRequest struct {
+	Name  string   `json:"name" validate:"required"`
+	Roles []string `json:"roles"`
+	TTL   int      `json:"ttl,omitempty" validate:"min=0"` // hours, 0 means the key never expires
+}
+
+// quotaExceededResponse is the 429 body of POST /auth/token; ResetAt is
+// also sent in seconds as the Retry-After header
+type quotaExceededResponse struct {
+	ErrorResponse
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// IssueToken handles POST /auth/token
+func (h *AuthHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	var req auth.IssueTokenRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	resp, err := h.service.IssueToken(r.Context(), req)
+	if err != nil {
+		var exceeded *auth.QuotaExceededError
+		if errors.As(err, &exceeded) {
+			writeQuotaExceeded(w, r, exceeded)
+			return
+		}
+		if errors.Is(err, auth.ErrInvalidScope) || errors.Is(err, auth.ErrUnknownAudience) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if errors.Is(err, jwt.ErrTokenTooLarge) {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "claims make the token too large; send less metadata")
+			return
+		}
+		if errors.Is(err, auth.ErrForeignTenant) || errors.Is(err, auth.ErrForbidden) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to issue token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// writeQuotaExceeded writes a 429 telling the caller when it may issue again
+func writeQuotaExceeded(w http.ResponseWriter, r *http.Request, err *auth.QuotaExceededError) {
+	retryAfter := max(int(math.Ceil(time.Until(err.ResetAt).Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeJSON(w, http.StatusTooManyRequests, quotaExceededResponse{
+		ErrorResponse: ErrorResponse{
+			Error:     err.Error(),
+			Code:      CodeQuotaExceeded,
+			RequestID: middleware.RequestIDFromContext(r.Context()),
+		},
+		ResetAt: err.ResetAt,
+	})
+}
+
+// Quota handles GET /auth/quota, reporting the caller's own issuance quota
+func (h *AuthHandler) Quota(w http.ResponseWriter, r *http.Request) {
+	caller, ok := token.FromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "authentication required")
+		return
+	}
+
+	status, err := h.service.Quota(r.Context(), caller.Subject)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to get quota")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// ValidateToken handles POST /auth/validate. With an audience, tokens issued
+// for another one or for none are rejected as well.
+func (h *AuthHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
+	var req validateRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	claims, err := h.service.ValidateTokenFor(r.Context(), req.Token, req.Audience)
+	if err != nil {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// RefreshToken handles POST /auth/refresh
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	resp, err := h.service.RefreshToken(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RevokeToken handles POST /auth/revoke
+func (h *AuthHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if err := h.service.RevokeToken(r.Context(), req.Token); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateAPIKey handles POST /auth/apikeys.
+// The plaintext key is only ever returned in this response.
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), auth.CreateAPIKeyRequest{
+		Name:  req.Name,
+		Roles: req.Roles,
+		TTL:   time.Duration(req.TTL) * time.Hour,
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to create api key")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// RevokeAPIKey handles DELETE /auth/apikeys/{id}
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/auth/apikeys/", "", "api key")
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeAPIKey(r.Context(), id); err != nil {
+		if errors.Is(err, apikey.ErrAPIKeyNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "api key not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to revoke api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
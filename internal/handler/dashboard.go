@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/internal/service/session"
+)
+
+// Paths of the dashboard, which is served at the root only, not under the
+// API version prefix
+const (
+	DashboardPath      = "/ui/"
+	DashboardLoginPath = "/ui/login"
+)
+
+// DashboardCookie is the cookie the dashboard keeps the operator's credential in
+const DashboardCookie = "dashboard_token"
+
+// defaultDashboardRefresh is how often dashboard pages reload themselves when
+// the configuration leaves it unset
+const defaultDashboardRefresh = 10 * time.Second
+
+// maxLoginBytes bounds the body of a login form
+const maxLoginBytes = 16 << 10
+
+// dashboardCSP replaces the API's Content-Security-Policy on dashboard pages,
+// which load their stylesheet and submit forms to the server itself
+const dashboardCSP = "default-src 'none'; style-src 'self'; form-action 'self'; frame-ancestors 'none'"
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardTemplates holds every page parsed with the layout, by file name
+var dashboardTemplates = func() map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, page := range []string{"login.html", "services.html", "service.html"} {
+		pages[page] = template.Must(template.ParseFS(dashboardFiles, "dashboard/layout.html", "dashboard/"+page))
+	}
+	return pages
+}()
+
+// DashboardHandler serves the built-in web dashboard: server-rendered pages
+// listing the registered services with their health, the details and recent
+// health checks of one service, and the active session count. Pages reload
+// themselves every refresh interval. Operators log in with an admin token,
+// which is kept in DashboardCookie and checked by middleware.AuthenticateCookie.
+type DashboardHandler struct {
+	auth     middleware.Authenticator
+	registry *registry.Service
+	sessions *session.Service
+	refresh  time.Duration
+	now      func() time.Time // clock heartbeat ages are relative to
+}
+
+// NewDashboardHandler creates a new dashboard handler whose pages reload every
+// refresh, or every 10 seconds when refresh is 0
+func NewDashboardHandler(auth middleware.Authenticator, registry *registry.Service, sessions *session.Service, refresh time.Duration) *DashboardHandler {
+	if refresh <= 0 {
+		refresh = defaultDashboardRefresh
+	}
+	return &DashboardHandler{auth: auth, registry: registry, sessions: sessions, refresh: refresh, now: time.Now}
+}
+
+// dashboardPage is what the layout renders around a page's content
+type dashboardPage struct {
+	Title   string
+	Refresh int    // seconds between reloads, 0 for pages that don't reload
+	Subject string // the logged in caller, empty on the login page
+	Content any
+}
+
+// dashboardService is a service with the fields the pages show computed
+type dashboardService struct {
+	*service.Service
+	EffectiveStatus service.Status
+	HeartbeatAge    string
+}
+
+// servicesPage is the content of the service list
+type servicesPage struct {
+	Counts   registry.Counts
+	Sessions session.Activity
+	Services []dashboardService
+}
+
+// servicePage is the content of a service's detail page
+type servicePage struct {
+	Service        dashboardService
+	Summary        registry.HealthSummary
+	SuccessPercent float64
+	Results        []registry.HealthCheckResult // newest first
+}
+
+// loginPage is the content of the login form
+type loginPage struct {
+	Error string
+}
+
+// LoginForm handles GET /ui/login
+func (h *DashboardHandler) LoginForm(w http.ResponseWriter, r *http.Request) {
+	h.render(w, http.StatusOK, "login.html", dashboardPage{Title: "Log in", Content: loginPage{}})
+}
+
+// Login handles POST /ui/login. It checks the submitted token the way
+// /auth/validate and the API's authentication do and, for an unscoped admin
+// token, stores it in DashboardCookie until the token expires.
+func (h *DashboardHandler) Login(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLoginBytes)
+	credential := strings.TrimSpace(r.PostFormValue("token"))
+	if credential == "" {
+		h.loginFailed(w, http.StatusBadRequest, "A token is required.")
+		return
+	}
+
+	claims, err := middleware.ValidateCredential(r.Context(), h.auth, credential)
+	if err != nil {
+		h.loginFailed(w, http.StatusUnauthorized, "The token is invalid or expired.")
+		return
+	}
+	if !claims.HasRole(token.RoleAdmin) || claims.Scoped() {
+		h.loginFailed(w, http.StatusForbidden, "The dashboard requires an admin token without scopes.")
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     DashboardCookie,
+		Value:    credential,
+		Path:     "/ui",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if !claims.ExpiresAt.IsZero() {
+		cookie.Expires = claims.ExpiresAt
+	}
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, DashboardPath, http.StatusSeeOther)
+}
+
+// loginFailed renders the login form again with the reason
+func (h *DashboardHandler) loginFailed(w http.ResponseWriter, status int, reason string) {
+	h.render(w, status, "login.html", dashboardPage{Title: "Log in", Content: loginPage{Error: reason}})
+}
+
+// Logout handles POST /ui/logout, dropping the cookie
+func (h *DashboardHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: DashboardCookie, Path: "/ui", MaxAge: -1, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteStrictMode})
+	http.Redirect(w, r, DashboardLoginPath, http.StatusSeeOther)
+}
+
+// Stylesheet handles GET /ui/style.css
+func (h *DashboardHandler) Stylesheet(w http.ResponseWriter, r *http.Request) {
+	css, _ := dashboardFiles.ReadFile("dashboard/style.css")
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(css)
+}
+
+// Services handles GET /ui/, the list of services within the caller's tenant
+// and the counts of services and active sessions across every tenant
+func (h *DashboardHandler) Services(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != DashboardPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	services, err := h.registry.List(r.Context())
+	if err != nil {
+		http.Error(w, "failed to list services", http.StatusInternalServerError)
+		return
+	}
+	counts, err := h.registry.Counts(r.Context())
+	if err != nil {
+		http.Error(w, "failed to count services", http.StatusInternalServerError)
+		return
+	}
+	activity, err := h.sessions.Activity(r.Context())
+	if err != nil {
+		http.Error(w, "failed to count sessions", http.StatusInternalServerError)
+		return
+	}
+
+	slices.SortFunc(services, service.CompareBy(service.SortByID))
+	page := servicesPage{Counts: counts, Sessions: activity, Services: make([]dashboardService, len(services))}
+	for i, svc := range services {
+		page.Services[i] = h.view(svc)
+	}
+	h.render(w, http.StatusOK, "services.html", h.page(r, "Services", page))
+}
+
+// Service handles GET /ui/services/{id}, a service with its recent health checks
+func (h *DashboardHandler) Service(w http.ResponseWriter, r *http.Request) {
+	// Pages answer a missing or invalid ID like an unknown one
+	id, rest, err := server.PathParam(r, "/ui/services/")
+	if pathStatus(rest, "", err) != 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	svc, err := h.registry.Get(r.Context(), id)
+	if errors.Is(err, registry.ErrServiceNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to get service", http.StatusInternalServerError)
+		return
+	}
+	history, err := h.registry.HealthHistory(r.Context(), id)
+	if err != nil {
+		http.Error(w, "failed to get health history", http.StatusInternalServerError)
+		return
+	}
+
+	results := slices.Clone(history.Results)
+	slices.Reverse(results)
+	h.render(w, http.StatusOK, "service.html", h.page(r, svc.Name, servicePage{
+		Service:        h.view(svc),
+		Summary:        history.Summary,
+		SuccessPercent: history.Summary.SuccessRate * 100,
+		Results:        results,
+	}))
+}
+
+// page wraps the content of a page behind the login
+func (h *DashboardHandler) page(r *http.Request, title string, content any) dashboardPage {
+	page := dashboardPage{Title: title, Refresh: int(h.refresh.Seconds()), Content: content}
+	if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+		page.Subject = claims.Subject
+	}
+	return page
+}
+
+// view computes the fields the pages show for svc
+func (h *DashboardHandler) view(svc *service.Service) dashboardService {
+	return dashboardService{
+		Service:         svc,
+		EffectiveStatus: registry.EffectiveStatus(svc, h.registry.HeartbeatTimeout(), h.now()),
+		HeartbeatAge:    heartbeatAge(svc.LastHeartbeat, h.now()),
+	}
+}
+
+// heartbeatAge describes how long ago a heartbeat was received in its
+// largest whole unit, e.g. "12s ago" or "3h ago"
+func heartbeatAge(at, now time.Time) string {
+	if at.IsZero() {
+		return "never"
+	}
+
+	age := max(now.Sub(at), 0)
+	switch {
+	case age < time.Minute:
+		return strconv.Itoa(int(age.Seconds())) + "s ago"
+	case age < time.Hour:
+		return strconv.Itoa(int(age.Minutes())) + "m ago"
+	case age < 24*time.Hour:
+		return strconv.Itoa(int(age.Hours())) + "h ago"
+	default:
+		return strconv.Itoa(int(age.Hours()/24)) + "d ago"
+	}
+}
+
+// render executes a page into a buffer first, so a template error doesn't
+// leave a half-written page
+func (h *DashboardHandler) render(w http.ResponseWriter, status int, name string, page dashboardPage) {
+	var buf bytes.Buffer
+	if err := dashboardTemplates[name].ExecuteTemplate(&buf, "layout", page); err != nil {
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", dashboardCSP)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
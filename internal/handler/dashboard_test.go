@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	domainsession "github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// dashboardAuth accepts the fixed credentials of the dashboard tests
+type dashboardAuth map[string]*token.Claims
+
+func (a dashboardAuth) ValidateToken(ctx context.Context, tokenString string) (*token.Claims, error) {
+	if claims, ok := a[tokenString]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func (a dashboardAuth) ValidateAPIKey(ctx context.Context, key string) (*token.Claims, error) {
+	return a.ValidateToken(ctx, key)
+}
+
+// newDashboardHandler returns a dashboard over seeded memory repositories
+func newDashboardHandler(t *testing.T, now time.Time) (*DashboardHandler, *registry.Service) {
+	t.Helper()
+	ctx := context.Background()
+
+	registryRepo := memory.NewRegistryRepository()
+	for _, svc := range []*service.Service{
+		{ID: "payment-1", Name: "payment", Version: "1.4.0", Status: service.StatusHealthy, LastHeartbeat: now.Add(-12 * time.Second), Endpoints: []service.Endpoint{{URL: "http://payment-1:8080", Weight: 1, Healthy: true}}},
+		{ID: "search-1", Name: "search", Version: "2.0.1", Status: service.StatusHealthy, LastHeartbeat: now.Add(-5 * time.Minute)},
+		{ID: "mail-1", Name: "mail", Version: "0.9.0", TenantID: "acme", Status: service.StatusDraining, OverrideStatus: true},
+		{ID: "old-1", Name: "old", Status: service.StatusHealthy, DeletedAt: now},
+	} {
+		registryRepo.Register(ctx, svc)
+	}
+	registrySvc := registry.NewService(registryRepo, registry.Config{HeartbeatTimeout: time.Minute, HealthCheckInterval: 10 * time.Millisecond}, logger.NewNop())
+
+	sessionRepo := memory.NewSessionRepository()
+	sessionRepo.Create(ctx, &domainsession.Session{ID: "sess-1", UserID: "user-1", ExpiresAt: now.Add(time.Hour)})
+	sessionRepo.Create(ctx, &domainsession.Session{ID: "sess-2", UserID: "user-2", ExpiresAt: now.Add(time.Hour)})
+	sessionRepo.Create(ctx, &domainsession.Session{ID: "sess-3", UserID: "user-3", ExpiresAt: now.Add(-time.Minute)})
+	sessionSvc := session.NewService(sessionRepo, session.Config{}, logger.NewNop())
+
+	auth := dashboardAuth{
+		"admin-token":  {Subject: "ops", Roles: []string{token.RoleAdmin}, ExpiresAt: now.Add(time.Hour)},
+		"user-token":   {Subject: "user-1", Roles: []string{"user"}},
+		"scoped-token": {Subject: "ops", Roles: []string{token.RoleAdmin}, Scopes: []string{"session:read"}},
+	}
+	h := NewDashboardHandler(auth, registrySvc, sessionSvc, 0)
+	h.now = func() time.Time { return now }
+	return h, registrySvc
+}
+
+// asAdmin returns a dashboard request made by the logged in admin
+func asAdmin(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	return req.WithContext(middleware.WithClaims(req.Context(), &token.Claims{Subject: "ops", Roles: []string{token.RoleAdmin}}))
+}
+
+// assertPage checks that rec holds an HTML page with status and every snippet
+func assertPage(t *testing.T, rec *httptest.ResponseRecorder, status int, snippets ...string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("expected an HTML page, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Security-Policy"); got != dashboardCSP {
+		t.Errorf("expected the dashboard CSP, got %q", got)
+	}
+	body := rec.Body.String()
+	for _, snippet := range snippets {
+		if !strings.Contains(body, snippet) {
+			t.Errorf("expected the page to contain %q:\n%s", snippet, body)
+		}
+	}
+}
+
+func TestDashboardHandler_Services(t *testing.T) {
+	now := time.Now()
+	h, _ := newDashboardHandler(t, now)
+
+	rec := httptest.NewRecorder()
+	h.Services(rec, asAdmin("/ui/"))
+	assertPage(t, rec, http.StatusOK,
+		`<meta http-equiv="refresh" content="10">`,
+		`<span>ops</span>`,
+		`<a href="/ui/services/payment-1">payment-1</a>`,
+		`<td>12s ago</td>`,
+		`<td>5m ago</td>`,
+		`<span class="badge badge-unhealthy">unhealthy</span>`,
+		`<span class="badge badge-draining">draining</span>`,
+		`<td>never</td>`,
+		`<span class="value">2</span><span class="label">active sessions</span>`,
+	)
+	if strings.Contains(rec.Body.String(), "old-1") {
+		t.Error("expected deregistered services left out")
+	}
+	if strings.Index(rec.Body.String(), "mail-1") > strings.Index(rec.Body.String(), "payment-1") {
+		t.Error("expected services ordered by ID")
+	}
+
+	rec = httptest.NewRecorder()
+	h.Services(rec, asAdmin("/ui/missing"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown pages, got %d", rec.Code)
+	}
+}
+
+func TestDashboardHandler_Service(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer target.Close()
+
+	now := time.Now()
+	h, registrySvc := newDashboardHandler(t, now)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, _, err := registrySvc.Register(ctx, registry.RegisterRequest{ID: "probed-1", Name: "probed", Endpoints: []service.Endpoint{{URL: target.URL}}, HealthCheckURL: target.URL + "/health"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Service(rec, asAdmin("/ui/services/payment-1"))
+	assertPage(t, rec, http.StatusOK,
+		`<h1>payment <span class="badge badge-healthy">healthy</span></h1>`,
+		`<dt>Last heartbeat</dt><dd>12s ago</dd>`,
+		`<td>http://payment-1:8080</td>`,
+		"No health checks recorded by this server.",
+	)
+
+	// Run health checks until the probed service has a failed one recorded
+	go registrySvc.StartHealthChecks(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		history, _ := registrySvc.HealthHistory(ctx, "probed-1")
+		if history != nil && len(history.Results) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected a health check to be recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	h.Service(rec, asAdmin("/ui/services/probed-1"))
+	assertPage(t, rec, http.StatusOK, "checks, 0% passed", `<span class="badge badge-unhealthy">failed</span>`, "<td>"+target.URL+"/health</td>")
+
+	for _, path := range []string{"/ui/services/missing", "/ui/services/", "/ui/services/a/b", "/ui/services/a%2Fb", "/ui/services/bad%20id", "/ui/services/old-1"} {
+		rec := httptest.NewRecorder()
+		h.Service(rec, asAdmin(path))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestDashboardHandler_Login(t *testing.T) {
+	h, _ := newDashboardHandler(t, time.Now())
+
+	rec := httptest.NewRecorder()
+	h.LoginForm(rec, httptest.NewRequest(http.MethodGet, "/ui/login", nil))
+	assertPage(t, rec, http.StatusOK, `<form class="login" method="post" action="/ui/login">`)
+	if strings.Contains(rec.Body.String(), `http-equiv="refresh"`) {
+		t.Error("expected the login page not to reload itself")
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "admin", token: "admin-token", wantStatus: http.StatusSeeOther},
+		{name: "missing", wantStatus: http.StatusBadRequest, wantError: "A token is required."},
+		{name: "invalid", token: "other-token", wantStatus: http.StatusUnauthorized, wantError: "The token is invalid or expired."},
+		{name: "not an admin", token: "user-token", wantStatus: http.StatusForbidden, wantError: "requires an admin token"},
+		{name: "scoped", token: "scoped-token", wantStatus: http.StatusForbidden, wantError: "requires an admin token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/ui/login", strings.NewReader(url.Values{"token": {tt.token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			h.Login(rec, req)
+
+			if tt.wantError != "" {
+				assertPage(t, rec, tt.wantStatus, tt.wantError)
+				if len(rec.Result().Cookies()) != 0 {
+					t.Error("expected no cookie on a failed login")
+				}
+				return
+			}
+			if rec.Code != tt.wantStatus || rec.Header().Get("Location") != DashboardPath {
+				t.Fatalf("expected a redirect to the dashboard, got %d %q", rec.Code, rec.Header().Get("Location"))
+			}
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != DashboardCookie || cookies[0].Value != tt.token || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode || cookies[0].Expires.IsZero() {
+				t.Errorf("expected an HttpOnly strict cookie expiring with the token, got %+v", cookies)
+			}
+		})
+	}
+
+	rec = httptest.NewRecorder()
+	h.Logout(rec, httptest.NewRequest(http.MethodPost, "/ui/logout", nil))
+	cookies := rec.Result().Cookies()
+	if rec.Header().Get("Location") != DashboardLoginPath || len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the cookie dropped and a redirect to login, got %q %+v", rec.Header().Get("Location"), cookies)
+	}
+}
+
+func TestHeartbeatAge(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{at: time.Time{}, want: "never"},
+		{at: now.Add(time.Second), want: "0s ago"},
+		{at: now.Add(-59 * time.Second), want: "59s ago"},
+		{at: now.Add(-90 * time.Second), want: "1m ago"},
+		{at: now.Add(-3 * time.Hour), want: "3h ago"},
+		{at: now.Add(-50 * time.Hour), want: "2d ago"},
+	}
+
+	for _, tt := range tests {
+		if got := heartbeatAge(tt.at, now); got != tt.want {
+			t.Errorf("heartbeatAge(%v): expected %q, got %q", now.Sub(tt.at), tt.want, got)
+		}
+	}
+}
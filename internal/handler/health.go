@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/webhook"
+	"github.com/aq189/bin/pkg/buildinfo"
+)
+
+// TokenCacheReporter reports the statistics of the token validation cache
+type TokenCacheReporter interface {
+	CacheStats() auth.CacheStats
+}
+
+// IssuanceQuotaReporter reports the decisions of the token issuance quota
+type IssuanceQuotaReporter interface {
+	QuotaStats() auth.QuotaStats
+}
+
+// WebhookReporter reports the delivery statistics of the webhook or session
+// callback dispatcher
+type WebhookReporter interface {
+	Stats() webhook.Stats
+}
+
+// Pinger checks that a storage backend is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthHandler serves liveness and readiness probes and build information
+type HealthHandler struct {
+	startedAt  time.Time
+	sessions   session.StatsReporter // nil when the session store can't report its size
+	tokenCache TokenCacheReporter    // nil when token validations aren't cached
+	webhooks   WebhookReporter       // nil when webhooks are disabled
+	callbacks  WebhookReporter       // nil when session callbacks are disabled
+	quota      IssuanceQuotaReporter // nil when token issuance isn't capped
+	redis      Pinger                // nil when no component uses redis
+}
+
+// NewHealthHandler creates a new health handler reporting uptime since
+// startedAt. Readiness also reports the session store's size, the token
+// validation cache's hit counts, the webhook and session callback delivery
+// counts and the token issuance quota decisions when sessions, tokenCache,
+// webhooks, callbacks and quota are not nil. When redis is not nil, readiness pings it and fails while it is
+// unreachable.
+func NewHealthHandler(startedAt time.Time, sessions session.StatsReporter, tokenCache TokenCacheReporter, webhooks, callbacks WebhookReporter, quota IssuanceQuotaReporter, redis Pinger) *HealthHandler {
+	return &HealthHandler{startedAt: startedAt, sessions: sessions, tokenCache: tokenCache, webhooks: webhooks, callbacks: callbacks, quota: quota, redis: redis}
+}
+
+// healthResponse is the body of the liveness and readiness probes
+type healthResponse struct {
+	Status        string  `json:"status"`
+	Version       string  `json:"version"`
+	Commit        string  `json:"commit"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+
+	Sessions   *session.Stats   `json:"sessions,omitempty"`          // readiness only
+	TokenCache *auth.CacheStats `json:"token_cache,omitempty"`       // readiness only
+	Webhooks   *webhook.Stats   `json:"webhooks,omitempty"`          // readiness only
+	Callbacks  *webhook.Stats   `json:"session_callbacks,omitempty"` // readiness only
+	Quota      *auth.QuotaStats `json:"issuance_quota,omitempty"`    // readiness only
+	Redis      *backendStatus   `json:"redis,omitempty"`             // readiness only
+}
+
+// backendStatus reports whether a storage backend answered its ping
+type backendStatus struct {
+	Status string `json:"status"` // up or down
+	Error  string `json:"error,omitempty"`
+}
+
+// Health handles GET /health
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.status("ok"))
+}
+
+// Ready handles GET /ready, answering 503 while a storage backend is unreachable
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	resp := h.status("ready")
+	code := http.StatusOK
+	if h.redis != nil {
+		resp.Redis = &backendStatus{Status: "up"}
+		if err := h.redis.Ping(r.Context()); err != nil {
+			resp.Redis = &backendStatus{Status: "down", Error: err.Error()}
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	if h.sessions != nil {
+		stats := h.sessions.Stats()
+		resp.Sessions = &stats
+	}
+	if h.tokenCache != nil {
+		stats := h.tokenCache.CacheStats()
+		resp.TokenCache = &stats
+	}
+	if h.webhooks != nil {
+		stats := h.webhooks.Stats()
+		resp.Webhooks = &stats
+	}
+	if h.callbacks != nil {
+		stats := h.callbacks.Stats()
+		resp.Callbacks = &stats
+	}
+	if h.quota != nil {
+		stats := h.quota.QuotaStats()
+		resp.Quota = &stats
+	}
+	writeJSON(w, code, resp)
+}
+
+// Version handles GET /version
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildinfo.Get())
+}
+
+func (h *HealthHandler) status(status string) healthResponse {
+	info := buildinfo.Get()
+	return healthResponse{
+		Status:        status,
+		Version:       info.Version,
+		Commit:        info.Commit,
+		UptimeSeconds: time.Since(h.startedAt).Seconds(),
+	}
+}
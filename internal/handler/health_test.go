@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// pingFunc adapts a function to Pinger
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestHealthHandler_ReadyPingsRedis(t *testing.T) {
+	tests := []struct {
+		name        string
+		redis       Pinger
+		wantCode    int
+		wantStatus  string
+		wantBackend string // empty when redis isn't reported
+	}{
+		{name: "no redis", wantCode: http.StatusOK, wantStatus: "ready"},
+		{name: "redis up", redis: pingFunc(func(context.Context) error { return nil }), wantCode: http.StatusOK, wantStatus: "ready", wantBackend: "up"},
+		{
+			name:     "redis down",
+			redis:    pingFunc(func(context.Context) error { return errors.New("dial tcp: connection refused") }),
+			wantCode: http.StatusServiceUnavailable, wantStatus: "unavailable", wantBackend: "down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(time.Now(), nil, nil, nil, nil, nil, tt.redis)
+			rec := httptest.NewRecorder()
+			h.Ready(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d", tt.wantCode, rec.Code)
+			}
+			var resp healthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, resp.Status)
+			}
+			switch {
+			case tt.wantBackend == "" && resp.Redis != nil:
+				t.Errorf("expected no redis status, got %+v", resp.Redis)
+			case tt.wantBackend != "" && (resp.Redis == nil || resp.Redis.Status != tt.wantBackend):
+				t.Errorf("expected redis %s, got %+v", tt.wantBackend, resp.Redis)
+			case tt.wantBackend == "down" && resp.Redis.Error == "":
+				t.Error("expected the ping error to be reported")
+			}
+		})
+	}
+}
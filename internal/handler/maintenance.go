@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aq189/bin/internal/service/maintenance"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// MaintenanceHandler serves the admin endpoints of the maintenance mode
+type MaintenanceHandler struct {
+	service *maintenance.Service
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(service *maintenance.Service) *MaintenanceHandler {
+	return &MaintenanceHandler{service: service}
+}
+
+// setMaintenanceRequest enables the maintenance mode until a time or disables it
+type setMaintenanceRequest struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message"`
+	Until   time.Time `json:"until"`
+}
+
+// Get handles GET /admin/maintenance
+func (h *MaintenanceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.Current())
+}
+
+// Set handles POST /admin/maintenance. It answers 200 with the new mode and
+// 400 listing invalid fields, such as an until that has passed.
+func (h *MaintenanceHandler) Set(w http.ResponseWriter, r *http.Request) {
+	var req setMaintenanceRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	state, err := h.service.Set(req.Enabled, req.Message, req.Until)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to set maintenance mode")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,745 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// RevisionHeader carries the registry revision a listing was read at, the
+// value a discovery long poll passes as revision
+const RevisionHeader = "X-Registry-Revision"
+
+// RegistryHandler serves service registry endpoints
+type RegistryHandler struct {
+	service *registry.Service
+	now     func() time.Time // clock the computed response fields are relative to
+}
+
+// NewRegistryHandler creates a new registry handler
+func NewRegistryHandler(service *registry.Service) *RegistryHandler {
+	return &RegistryHandler{service: service, now: time.Now}
+}
+
+// serviceResponse is a service as the registry endpoints return it: the
+// stored fields plus ones computed with the server's clock when the response
+// is written, so clients don't have to trust their own
+type serviceResponse struct {
+	*service.Service
+	// ServiceName is the logical service the registration is an instance of
+	ServiceName string `json:"service_name"`
+	// HeartbeatAgeSeconds is nil for services that never sent a heartbeat
+	HeartbeatAgeSeconds *float64       `json:"heartbeat_age_seconds,omitempty"`
+	EffectiveStatus     service.Status `json:"effective_status"`
+}
+
+// serviceDetailResponse is a single service with the summary of its recent
+// health checks
+type serviceDetailResponse struct {
+	serviceResponse
+	HealthSummary registry.HealthSummary `json:"health_summary"`
+}
+
+// respond wraps a service with its computed fields
+func (h *RegistryHandler) respond(svc *service.Service) serviceResponse {
+	now := h.now()
+	resp := serviceResponse{
+		Service:         svc,
+		ServiceName:     svc.GroupKey(),
+		EffectiveStatus: registry.EffectiveStatus(svc, h.service.HeartbeatTimeout(), now),
+	}
+	if !svc.LastHeartbeat.IsZero() {
+		age := max(now.Sub(svc.LastHeartbeat), 0).Seconds()
+		resp.HeartbeatAgeSeconds = &age
+	}
+	return resp
+}
+
+// respondAll wraps every service with its computed fields
+func (h *RegistryHandler) respondAll(services []*service.Service) []serviceResponse {
+	resp := make([]serviceResponse, len(services))
+	for i, svc := range services {
+		resp[i] = h.respond(svc)
+	}
+	return resp
+}
+
+// groupResponse is a logical service as the grouped listing returns it
+type groupResponse struct {
+	Name string `json:"name"`
+	// Status aggregates the effective statuses of the instances
+	Status    service.Status    `json:"status"`
+	Instances []serviceResponse `json:"instances"`
+}
+
+// respondGroup wraps a logical service and its instances with their
+// computed fields
+func (h *RegistryHandler) respondGroup(g *service.Group) groupResponse {
+	instances := h.respondAll(g.Instances)
+	statuses := make([]service.Status, len(instances))
+	for i, instance := range instances {
+		statuses[i] = instance.EffectiveStatus
+	}
+	return groupResponse{Name: g.Key, Status: service.AggregateStatus(statuses...), Instances: instances}
+}
+
+// Register handles POST /registry/register.
+// It answers 201 for a new registration, 200 for a re-registration, 400 listing
+// invalid fields and 409 when the ID already belongs to a differently named service.
+func (h *RegistryHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req registry.RegisterRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	svc, created, err := h.service.Register(r.Context(), req)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, registry.ErrServiceConflict) {
+			writeError(w, r, http.StatusConflict, CodeConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to register service")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, h.respond(svc))
+}
+
+// Deregister handles DELETE /registry/deregister/{id}
+func (h *RegistryHandler) Deregister(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/registry/deregister/", "", "service")
+	if !ok {
+		return
+	}
+
+	if err := h.service.Deregister(r.Context(), id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to deregister service")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List handles GET /registry/services?limit=&offset=&sort_by=&order=&include_deleted=&status=&registered_since=&name_prefix=&grouped=.
+// It answers with a pagination.Page envelope, or with the full plain array
+// for version 1 callers. include_deleted=true adds deregistered services not
+// yet purged to the page; status, which may repeat, registered_since and
+// name_prefix narrow it. grouped=true pages logical services instead, each
+// with its instances and their aggregate status. The response is tagged with
+// the registry revision and answers 304 to an If-None-Match naming it, unless
+// the listing can change without the revision moving.
+func (h *RegistryHandler) List(w http.ResponseWriter, r *http.Request) {
+	if tracksRevision(r) && h.notModified(w, r) {
+		return
+	}
+
+	if raw := r.URL.Query().Get("grouped"); raw != "" {
+		grouped, err := strconv.ParseBool(raw)
+		if err != nil {
+			var invalid validation.Errors
+			invalid.Add("grouped", "must be true or false")
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if grouped {
+			h.listGroups(w, r)
+			return
+		}
+	}
+
+	if wantsPlainList(r) {
+		services, err := h.service.List(r.Context())
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list services")
+			return
+		}
+		writeJSON(w, http.StatusOK, h.respondAll(services))
+		return
+	}
+
+	opts, invalid := listOptions(r, service.SortFields)
+	switch order := r.URL.Query().Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		invalid.Add("order", "must be asc or desc")
+	}
+	filter := h.listFilter(r, &invalid)
+	if invalid != nil {
+		writeValidationError(w, r, invalid)
+		return
+	}
+
+	page, err := h.service.ListPaged(r.Context(), filter, opts)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list services")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pagination.Page[serviceResponse]{
+		Items:      h.respondAll(page.Items),
+		Total:      page.Total,
+		NextOffset: page.NextOffset,
+	})
+}
+
+// listFilter reads the include_deleted, status, registered_since and
+// name_prefix query parameters of List, adding any problems to invalid.
+// registered_since is an RFC 3339 time or a duration, such as 10m, counted
+// back from now.
+func (h *RegistryHandler) listFilter(r *http.Request, invalid *validation.Errors) service.ListFilter {
+	query := r.URL.Query()
+	filter := service.ListFilter{NamePrefix: query.Get("name_prefix")}
+
+	if raw := query.Get("include_deleted"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			invalid.Add("include_deleted", "must be true or false")
+		}
+		filter.IncludeDeleted = parsed
+	}
+	for _, raw := range query["status"] {
+		status := service.Status(raw)
+		if !slices.Contains(service.Statuses, status) {
+			invalid.Add("status", "must be one of healthy, unhealthy, unknown, draining")
+			break
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	if raw := query.Get("registered_since"); raw != "" {
+		if since, err := time.Parse(time.RFC3339, raw); err == nil {
+			filter.RegisteredSince = since
+		} else if age, err := time.ParseDuration(raw); err == nil && age > 0 {
+			filter.RegisteredSince = h.now().Add(-age)
+		} else {
+			invalid.Add("registered_since", "must be an RFC 3339 time or a positive duration such as 10m")
+		}
+	}
+	return filter
+}
+
+// tracksRevision reports whether the listing r asks for only changes along
+// with the registry revision. Heartbeats that keep a service's status leave
+// the revision alone, and a relative registered_since moves with the clock,
+// so listings ordered by last_heartbeat or filtered by a duration are sent in
+// full every time.
+func tracksRevision(r *http.Request) bool {
+	query := r.URL.Query()
+	if query.Get("sort_by") == service.SortByLastHeartbeat {
+		return false
+	}
+	_, err := time.ParseDuration(query.Get("registered_since"))
+	return err != nil
+}
+
+// listGroups answers List for grouped=true. Groups are ordered by name, the
+// only sort_by accepted, and leave out deregistered instances. The filters
+// and order of service listings are not accepted.
+func (h *RegistryHandler) listGroups(w http.ResponseWriter, r *http.Request) {
+	opts, invalid := listOptions(r, []string{service.SortByName})
+	for _, param := range []string{"include_deleted", "status", "registered_since", "name_prefix", "order"} {
+		if r.URL.Query().Has(param) {
+			invalid.Add(param, "is not supported with grouped=true")
+		}
+	}
+	if invalid != nil {
+		writeValidationError(w, r, invalid)
+		return
+	}
+
+	page, err := h.service.ListGroups(r.Context(), opts)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list services")
+		return
+	}
+
+	groups := make([]groupResponse, len(page.Items))
+	for i, g := range page.Items {
+		groups[i] = h.respondGroup(g)
+	}
+	writeJSON(w, http.StatusOK, pagination.Page[groupResponse]{
+		Items:      groups,
+		Total:      page.Total,
+		NextOffset: page.NextOffset,
+	})
+}
+
+// Get handles GET /registry/services/{id}, adding the summary of the
+// service's recent health checks, and GET /registry/services/{id}/health-history
+func (h *RegistryHandler) Get(w http.ResponseWriter, r *http.Request) {
+	suffix := ""
+	if _, rest, _ := server.PathParam(r, "/registry/services/"); rest == "health-history" {
+		suffix = rest
+	}
+	id, ok := pathID(w, r, "/registry/services/", suffix, "service")
+	if !ok {
+		return
+	}
+	if suffix != "" {
+		h.healthHistory(w, r, id)
+		return
+	}
+
+	svc, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, registry.ErrServiceNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "service not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to get service")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, serviceDetailResponse{serviceResponse: h.respond(svc), HealthSummary: h.service.HealthSummary(id)})
+}
+
+// healthHistory handles GET /registry/services/{id}/health-history
+func (h *RegistryHandler) healthHistory(w http.ResponseWriter, r *http.Request, id string) {
+	history, err := h.service.HealthHistory(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, registry.ErrServiceNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "service not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to get health history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// Discover handles GET /registry/discover?capability=&healthy_endpoints=&healthy=.
+// healthy_endpoints=true leaves out services whose endpoints all failed their
+// last health check, and healthy=true instances whose effective status is not
+// healthy. Each instance names its logical service in service_name. Like List it is tagged with the registry revision and
+// answers 304 to an If-None-Match naming it.
+//
+// With select=one it answers a single instance instead of an array, picked
+// by strategy (random, the default, round_robin or least_recently_returned),
+// and 404 when none matches. The pick changes from call to call, so it is
+// never answered 304.
+//
+// With wait=30s&revision=N it long polls: the request is held until the
+// registry revision exceeds N, then answered as usual, or answers 304 with
+// revision N once the wait, capped by the server, elapses unchanged.
+func (h *RegistryHandler) Discover(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := registry.DiscoverOptions{Capability: query.Get("capability")}
+	var errs validation.Errors
+	if raw := query.Get("healthy_endpoints"); raw != "" {
+		healthyOnly, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs.Add("healthy_endpoints", "must be true or false")
+		}
+		opts.HealthyEndpointsOnly = healthyOnly
+	}
+	if raw := query.Get("healthy"); raw != "" {
+		healthyOnly, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs.Add("healthy", "must be true or false")
+		}
+		opts.HealthyOnly = healthyOnly
+	}
+	one := false
+	switch query.Get("select") {
+	case "", "all":
+	case "one":
+		one = true
+	default:
+		errs.Add("select", "must be all or one")
+	}
+	strategy := cmp.Or(query.Get("strategy"), registry.SelectRandom)
+	switch {
+	case query.Has("strategy") && !one:
+		errs.Add("strategy", "is only supported with select=one")
+	case !slices.Contains(registry.SelectStrategies, strategy):
+		errs.Add("strategy", "must be one of "+strings.Join(registry.SelectStrategies, ", "))
+	}
+	var wait time.Duration
+	var after int64
+	if query.Has("wait") {
+		var err error
+		if wait, err = time.ParseDuration(query.Get("wait")); err != nil || wait <= 0 {
+			errs.Add("wait", "must be a positive duration such as 30s")
+		}
+		if after, err = strconv.ParseInt(query.Get("revision"), 10, 64); err != nil {
+			errs.Add("revision", "is required with wait and must be an integer")
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	if wait > 0 && !h.waitForChange(w, r, after, wait) {
+		return
+	}
+	if one {
+		h.discoverOne(w, r, opts, strategy)
+		return
+	}
+	if h.notModified(w, r) {
+		return
+	}
+
+	services, err := h.service.Discover(r.Context(), opts)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to discover services")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.respondAll(services))
+}
+
+// discoverOne answers the instance DiscoverOne picks for a select=one discovery
+func (h *RegistryHandler) discoverOne(w http.ResponseWriter, r *http.Request, opts registry.DiscoverOptions, strategy string) {
+	svc, err := h.service.DiscoverOne(r.Context(), opts, strategy)
+	if errors.Is(err, registry.ErrNoInstance) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "no matching instance")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to discover services")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.respond(svc))
+}
+
+// waitForChange holds a long poll until the registry revision exceeds after
+// or wait, capped by the registry, elapses. It answers 304 when nothing
+// changed and writes nothing when the client went away; it reports whether
+// the caller should go on to answer the request.
+func (h *RegistryHandler) waitForChange(w http.ResponseWriter, r *http.Request, after int64, wait time.Duration) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), min(wait, h.service.MaxDiscoverWait()))
+	defer cancel()
+
+	revision, err := h.service.WaitForChange(ctx, after)
+	switch {
+	case r.Context().Err() != nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		setRevision(w, revision)
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to read registry revision")
+		return false
+	}
+	return true
+}
+
+// setRevision tags a listing with the registry revision it was read at
+func setRevision(w http.ResponseWriter, revision int64) {
+	w.Header().Set("ETag", `"rev-`+strconv.FormatInt(revision, 10)+`"`)
+	w.Header().Set(RevisionHeader, strconv.FormatInt(revision, 10))
+}
+
+// notModified tags a listing with the registry revision and answers
+// 304 when the request's If-None-Match names it. The revision is read before
+// the listing, so a change made in between only makes the next request
+// fetch the listing again. It reports whether the response was written.
+func (h *RegistryHandler) notModified(w http.ResponseWriter, r *http.Request) bool {
+	revision, err := h.service.Revision(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to read registry revision")
+		return true
+	}
+
+	setRevision(w, revision)
+	if !etagMatches(r.Header.Get("If-None-Match"), w.Header().Get("ETag")) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header names etag, using the
+// weak comparison conditional GETs call for
+func etagMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Heartbeat handles PUT /registry/heartbeat/{id}
+func (h *RegistryHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/registry/heartbeat/", "", "service")
+	if !ok {
+		return
+	}
+
+	if err := h.service.Heartbeat(r.Context(), id); err != nil {
+		if errors.Is(err, registry.ErrServiceNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "service not found")
+			return
+		}
+		if errors.Is(err, registry.ErrServiceGone) {
+			writeError(w, r, http.StatusGone, CodeGone, "service was deregistered; register it again")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to record heartbeat")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setStatusRequest is the body of PUT /registry/services/{id}/status
+type setStatusRequest struct {
+	Status service.Status `json:"status" validate:"oneof=draining healthy"`
+}
+
+// SetStatus handles PUT /registry/services/{id}/status.
+// It lets an operator drain an instance out of discovery, or return it to healthy.
+func (h *RegistryHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/registry/services/", "status", "service")
+	if !ok {
+		return
+	}
+
+	var req setStatusRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	svc, err := h.service.SetStatus(r.Context(), id, req.Status)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, registry.ErrServiceNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "service not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to set service status")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.respond(svc))
+}
+
+// Restore handles POST /registry/services/{id}/restore.
+// It brings back a deregistered service that has not been purged yet.
+func (h *RegistryHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/registry/services/", "restore", "service")
+	if !ok {
+		return
+	}
+
+	svc, err := h.service.Restore(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, registry.ErrServiceNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "service not found")
+			return
+		}
+		if errors.Is(err, registry.ErrServiceNotDeleted) {
+			writeError(w, r, http.StatusConflict, CodeConflict, "service is not deregistered")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to restore service")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.respond(svc))
+}
+
+// Graph handles GET /registry/graph. It answers with the services of the
+// caller's tenant as nodes and an edge from each service to every provider
+// of a capability it depends on; dependencies nothing provides are listed
+// under missing.
+func (h *RegistryHandler) Graph(w http.ResponseWriter, r *http.Request) {
+	graph, err := h.service.Graph(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to build dependency graph")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, graph)
+}
+
+// Impact handles GET /registry/impact/{id}. It answers with the services
+// that would lose every provider of a dependency, directly or through other
+// services, if the given one disappeared.
+func (h *RegistryHandler) Impact(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/registry/impact/", "", "service")
+	if !ok {
+		return
+	}
+
+	impact, err := h.service.Impact(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, registry.ErrServiceNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "service not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to compute impact")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, impact)
+}
+
+// maxImportBytes caps the size of registry import documents
+const maxImportBytes = 32 << 20
+
+// Export handles GET /admin/registry/export
+func (h *RegistryHandler) Export(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.service.Export(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to export registry")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// Import handles POST /admin/registry/import?mode=merge|replace.
+// The body is a document written by Export; mode defaults to merge.
+// It answers 200 with a result per service, 400 when the document is rejected,
+// or 500 when a storage error rolled an atomic import back.
+func (h *RegistryHandler) Import(w http.ResponseWriter, r *http.Request) {
+	mode := registry.ImportMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = registry.ImportMerge
+	}
+
+	var doc registry.Export
+	if err := decodeJSONLimit(w, r, &doc, maxImportBytes); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	report, err := h.service.Import(r.Context(), &doc, mode)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, registry.ErrImportRolledBack) {
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "import rolled back, no services were imported")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to import registry")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// ListSchemas handles GET /admin/registry/schemas
+func (h *RegistryHandler) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas, err := h.service.ListSchemas()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list metadata schemas")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schemas)
+}
+
+// GetSchema handles GET /admin/registry/schemas/{name}
+func (h *RegistryHandler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	name, ok := pathID(w, r, "/admin/registry/schemas/", "", "schema")
+	if !ok {
+		return
+	}
+
+	schema, err := h.service.Schema(name)
+	if err != nil {
+		if errors.Is(err, registry.ErrSchemaNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "metadata schema not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to get metadata schema")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schema)
+}
+
+// PutSchema handles PUT /admin/registry/schemas/{name}, the name being the
+// service name whose registrations the schema checks. The body's name may be
+// left out. It answers 201 for a new schema, 200 for a replaced one and 400
+// listing invalid fields.
+func (h *RegistryHandler) PutSchema(w http.ResponseWriter, r *http.Request) {
+	name, ok := pathID(w, r, "/admin/registry/schemas/", "", "schema")
+	if !ok {
+		return
+	}
+
+	var req registry.MetadataSchema
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Name != "" && req.Name != name {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "schema name does not match the path")
+		return
+	}
+	req.Name = name
+
+	schema, created, err := h.service.PutSchema(req)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to store metadata schema")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, schema)
+}
+
+// DeleteSchema handles DELETE /admin/registry/schemas/{name}
+func (h *RegistryHandler) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	name, ok := pathID(w, r, "/admin/registry/schemas/", "", "schema")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSchema(name); err != nil {
+		if errors.Is(err, registry.ErrSchemaNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "metadata schema not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to delete metadata schema")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,870 @@
+package handler
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// computedFields are the fields the registry handler adds to every service
+type computedFields struct {
+	ID                  string         `json:"id"`
+	Status              service.Status `json:"status"`
+	HeartbeatAgeSeconds *float64       `json:"heartbeat_age_seconds"`
+	EffectiveStatus     service.Status `json:"effective_status"`
+}
+
+func TestRegistryHandler_ComputedFields(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	for _, svc := range []*service.Service{
+		{ID: "fresh", Status: service.StatusHealthy, LastHeartbeat: now.Add(-10 * time.Second)},
+		{ID: "stale", Status: service.StatusHealthy, LastHeartbeat: now.Add(-45 * time.Second)},
+		{ID: "unhealthy", Status: service.StatusUnhealthy, LastHeartbeat: now.Add(-5 * time.Second)},
+		{ID: "probed", Status: service.StatusHealthy, LastHeartbeat: now.Add(-time.Hour), HealthCheckURL: "http://probed:8080/health"},
+		{ID: "imported", Status: service.StatusUnknown},
+	} {
+		repo.Register(ctx, svc)
+	}
+
+	h := NewRegistryHandler(registry.NewService(repo, registry.Config{HeartbeatTimeout: 30 * time.Second}, logger.NewNop()))
+	h.now = func() time.Time { return now }
+
+	tests := []struct {
+		id         string
+		wantAge    float64 // negative when no age is expected
+		wantStatus service.Status
+	}{
+		{id: "fresh", wantAge: 10, wantStatus: service.StatusHealthy},
+		{id: "stale", wantAge: 45, wantStatus: service.StatusUnhealthy},
+		{id: "unhealthy", wantAge: 5, wantStatus: service.StatusUnhealthy},
+		{id: "probed", wantAge: 3600, wantStatus: service.StatusHealthy},
+		{id: "imported", wantAge: -1, wantStatus: service.StatusUnknown},
+	}
+
+	check := func(t *testing.T, got computedFields, wantAge float64, wantStatus service.Status) {
+		t.Helper()
+		switch {
+		case wantAge < 0 && got.HeartbeatAgeSeconds != nil:
+			t.Errorf("expected no heartbeat age, got %v", *got.HeartbeatAgeSeconds)
+		case wantAge >= 0 && (got.HeartbeatAgeSeconds == nil || *got.HeartbeatAgeSeconds != wantAge):
+			t.Errorf("expected heartbeat age %v, got %v", wantAge, got.HeartbeatAgeSeconds)
+		}
+		if got.EffectiveStatus != wantStatus {
+			t.Errorf("expected effective status %s, got %s", wantStatus, got.EffectiveStatus)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		for _, tt := range tests {
+			t.Run(tt.id, func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				h.Get(rec, httptest.NewRequest(http.MethodGet, "/registry/services/"+tt.id, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+				}
+				var got computedFields
+				json.Unmarshal(rec.Body.Bytes(), &got)
+				check(t, got, tt.wantAge, tt.wantStatus)
+			})
+		}
+	})
+
+	lists := []struct {
+		name   string
+		target string
+		serve  http.HandlerFunc
+		decode func(body []byte) []computedFields
+	}{
+		{
+			name: "list", target: "/registry/services", serve: h.List,
+			decode: func(body []byte) []computedFields {
+				var page struct{ Items []computedFields }
+				json.Unmarshal(body, &page)
+				return page.Items
+			},
+		},
+		{
+			name: "plain list", target: "/registry/services?version=1", serve: h.List,
+			decode: func(body []byte) []computedFields {
+				var items []computedFields
+				json.Unmarshal(body, &items)
+				return items
+			},
+		},
+		{
+			name: "discover", target: "/registry/discover", serve: h.Discover,
+			decode: func(body []byte) []computedFields {
+				var items []computedFields
+				json.Unmarshal(body, &items)
+				return items
+			},
+		},
+	}
+	for _, list := range lists {
+		t.Run(list.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			list.serve(rec, httptest.NewRequest(http.MethodGet, list.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+			}
+
+			byID := make(map[string]computedFields)
+			for _, item := range list.decode(rec.Body.Bytes()) {
+				byID[item.ID] = item
+			}
+			for _, tt := range tests {
+				got, ok := byID[tt.id]
+				if !ok {
+					t.Errorf("expected %s to be listed", tt.id)
+					continue
+				}
+				check(t, got, tt.wantAge, tt.wantStatus)
+			}
+		})
+	}
+
+	stored, _ := repo.Get(ctx, "stale")
+	if stored.Status != service.StatusHealthy {
+		t.Errorf("expected the stored status to be left alone, got %s", stored.Status)
+	}
+}
+
+func TestRegistryHandler_GetUnknownService(t *testing.T) {
+	h := NewRegistryHandler(registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop()))
+
+	for _, target := range []string{"/registry/services/missing", "/registry/services/a/b"} {
+		rec := httptest.NewRecorder()
+		h.Get(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", target, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.Get(rec, httptest.NewRequest(http.MethodGet, "/registry/services/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without an id, got %d", rec.Code)
+	}
+}
+
+func TestRegistryHandler_CompressedResponses(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	for i := range 200 {
+		repo.Register(ctx, &service.Service{
+			ID:           fmt.Sprintf("payment-%d", i),
+			Name:         "payment",
+			Status:       service.StatusHealthy,
+			Endpoints:    []service.Endpoint{{URL: fmt.Sprintf("http://payment-%d:8080", i)}},
+			Capabilities: []string{"payments"},
+			Metadata:     map[string]string{"region": "eu-west-1", "team": "billing"},
+		})
+	}
+	h := NewRegistryHandler(registry.NewService(repo, registry.Config{}, logger.NewNop()))
+	compress := middleware.Compression(config.CompressionConfig{Enabled: true})
+
+	// byID keys services by ID, as discovery returns them in no particular order
+	byID := func(t *testing.T, items []map[string]any) map[any]map[string]any {
+		t.Helper()
+		services := make(map[any]map[string]any, len(items))
+		for _, item := range items {
+			services[item["id"]] = item
+		}
+		return services
+	}
+
+	for _, tt := range []struct {
+		name   string
+		target string
+		serve  http.HandlerFunc
+		decode func(t *testing.T, body []byte) map[any]map[string]any
+	}{
+		{
+			name: "list", target: "/registry/services?limit=200", serve: h.List,
+			decode: func(t *testing.T, body []byte) map[any]map[string]any {
+				var page struct{ Items []map[string]any }
+				if err := json.Unmarshal(body, &page); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				return byID(t, page.Items)
+			},
+		},
+		{
+			name: "discover", target: "/registry/discover?capability=payments", serve: h.Discover,
+			decode: func(t *testing.T, body []byte) map[any]map[string]any {
+				var items []map[string]any
+				if err := json.Unmarshal(body, &items); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				return byID(t, items)
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := httptest.NewRecorder()
+			compress(tt.serve).ServeHTTP(plain, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			gzipped := httptest.NewRecorder()
+			compress(tt.serve).ServeHTTP(gzipped, req)
+
+			if gzipped.Code != http.StatusOK || gzipped.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("expected a gzipped 200, got %d with Content-Encoding %q", gzipped.Code, gzipped.Header().Get("Content-Encoding"))
+			}
+			if gzipped.Body.Len()*5 > plain.Body.Len() {
+				t.Errorf("expected at least a 5x reduction, got %d bytes from %d", gzipped.Body.Len(), plain.Body.Len())
+			}
+
+			zr, err := gzip.NewReader(gzipped.Body)
+			if err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+			body, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+
+			got, want := tt.decode(t, body), tt.decode(t, plain.Body.Bytes())
+			if len(got) != 200 || !reflect.DeepEqual(got, want) {
+				t.Error("expected the decompressed JSON to match the uncompressed response")
+			}
+		})
+	}
+}
+
+func TestRegistryHandler_ConditionalListings(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	svc := registry.NewService(repo, registry.Config{}, logger.NewNop())
+	h := NewRegistryHandler(svc)
+	ctx := context.Background()
+	svc.Register(ctx, registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}, Capabilities: []string{"payments"}})
+
+	for _, tt := range []struct {
+		name   string
+		target string
+		serve  http.HandlerFunc
+	}{
+		{name: "list", target: "/registry/services", serve: h.List},
+		{name: "plain list", target: "/registry/services?version=1", serve: h.List},
+		{name: "grouped list", target: "/registry/services?grouped=true", serve: h.List},
+		{name: "discover", target: "/registry/discover?capability=payments", serve: h.Discover},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+				t.Helper()
+				req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+				if ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				rec := httptest.NewRecorder()
+				tt.serve(rec, req)
+				return rec
+			}
+
+			first := get("")
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" {
+				t.Fatalf("expected 200 with an ETag, got %d and %q", first.Code, etag)
+			}
+
+			for _, header := range []string{etag, "W/" + etag, `"rev-0", ` + etag, "*"} {
+				rec := get(header)
+				if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+					t.Errorf("If-None-Match %s: expected 304 without a body, got %d with %q", header, rec.Code, rec.Body)
+				}
+				if got := rec.Header().Get("ETag"); got != etag {
+					t.Errorf("If-None-Match %s: expected ETag %s, got %s", header, etag, got)
+				}
+			}
+
+			svc.Heartbeat(ctx, "payment-1")
+			if rec := get(etag); rec.Code != http.StatusNotModified {
+				t.Errorf("expected a heartbeat keeping the status to leave the listing unchanged, got %d", rec.Code)
+			}
+
+			svc.SetStatus(ctx, "payment-1", service.StatusDraining)
+			svc.SetStatus(ctx, "payment-1", service.StatusHealthy)
+			rec := get(etag)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200 after a change, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("ETag"); got == etag || got == "" {
+				t.Errorf("expected a new ETag after a change, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRegistryHandler_Instances(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	for _, svc := range []*service.Service{
+		{ID: "payment-a", Name: "payment", InstanceID: "a", Capabilities: []string{"payments"}, Status: service.StatusHealthy, LastHeartbeat: now},
+		{ID: "payment-b", Name: "payment", InstanceID: "b", Capabilities: []string{"payments"}, Status: service.StatusHealthy, LastHeartbeat: now.Add(20 * time.Second)},
+		{ID: "payment-c", Name: "payment", InstanceID: "c", Capabilities: []string{"payments"}, Status: service.StatusDraining, LastHeartbeat: now},
+		{ID: "billing", Name: "billing", Capabilities: []string{"payments"}, Status: service.StatusHealthy, LastHeartbeat: now},
+	} {
+		repo.Register(ctx, svc)
+	}
+
+	fake := clock.NewFake(now)
+	h := NewRegistryHandler(registry.NewService(repo, registry.Config{Clock: fake, HeartbeatTimeout: 30 * time.Second}, logger.NewNop()))
+	h.now = fake.Now
+	get := func(t *testing.T, serve http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		serve(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	type group struct {
+		Name      string         `json:"name"`
+		Status    service.Status `json:"status"`
+		Instances []struct {
+			ID              string         `json:"id"`
+			InstanceID      string         `json:"instance_id"`
+			ServiceName     string         `json:"service_name"`
+			EffectiveStatus service.Status `json:"effective_status"`
+		} `json:"instances"`
+	}
+
+	t.Run("grouped list aggregates instance statuses", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			elapsed time.Duration
+			want    map[string]service.Status
+		}{
+			{name: "all heartbeats fresh", elapsed: 10 * time.Second, want: map[string]service.Status{"billing": service.StatusHealthy, "payment": service.StatusHealthy}},
+			{name: "one instance left healthy", elapsed: 40 * time.Second, want: map[string]service.Status{"billing": service.StatusUnhealthy, "payment": service.StatusHealthy}},
+			{name: "every instance stale", elapsed: time.Minute, want: map[string]service.Status{"billing": service.StatusUnhealthy, "payment": service.StatusUnhealthy}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fake.Set(now.Add(tt.elapsed))
+				rec := get(t, h.List, "/registry/services?grouped=true")
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+				}
+				var page struct {
+					Items []group `json:"items"`
+					Total int     `json:"total"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if page.Total != 2 || len(page.Items) != 2 {
+					t.Fatalf("expected 2 groups, got %s", rec.Body)
+				}
+				for _, g := range page.Items {
+					if g.Status != tt.want[g.Name] {
+						t.Errorf("expected %s %s, got %s", g.Name, tt.want[g.Name], g.Status)
+					}
+				}
+				if payment := page.Items[1]; len(payment.Instances) != 3 || payment.Instances[0].InstanceID != "a" || payment.Instances[0].ServiceName != "payment" {
+					t.Errorf("expected the payment instances a, b and c, got %+v", payment.Instances)
+				}
+			})
+		}
+	})
+
+	t.Run("legacy registrations are single-instance services", func(t *testing.T) {
+		fake.Set(now)
+		var page struct {
+			Items []computedFields `json:"items"`
+		}
+		rec := get(t, h.List, "/registry/services")
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Items) != 4 {
+			t.Fatalf("expected the 4 registrations listed one by one, got %s", rec.Body)
+		}
+
+		var plain []map[string]any
+		rec = get(t, h.List, "/registry/services?version=1")
+		if err := json.Unmarshal(rec.Body.Bytes(), &plain); err != nil || len(plain) != 4 {
+			t.Fatalf("expected a plain array of 4 registrations, got %s", rec.Body)
+		}
+		for _, item := range plain {
+			if item["id"] == "billing" {
+				if _, ok := item["instance_id"]; ok {
+					t.Errorf("expected no instance_id for a legacy registration, got %v", item)
+				}
+				if item["service_name"] != "billing" {
+					t.Errorf("expected the legacy registration to be its own service, got %v", item["service_name"])
+				}
+			}
+		}
+	})
+
+	t.Run("discover healthy instances", func(t *testing.T) {
+		fake.Set(now.Add(40 * time.Second))
+		rec := get(t, h.Discover, "/registry/discover?capability=payments&healthy=true")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var found []map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		// payment-a and billing missed their heartbeats; payment-c is draining
+		var got []string
+		for _, item := range found {
+			got = append(got, fmt.Sprintf("%v/%v", item["service_name"], item["id"]))
+		}
+		if want := []string{"payment/payment-b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, target := range []string{
+			"/registry/services?grouped=maybe",
+			"/registry/services?grouped=true&include_deleted=true",
+			"/registry/services?grouped=true&sort_by=registered_at",
+			"/registry/discover?healthy=maybe",
+		} {
+			serve := h.List
+			if strings.HasPrefix(target, "/registry/discover") {
+				serve = h.Discover
+			}
+			if rec := get(t, serve, target); rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", target, rec.Code)
+			}
+		}
+	})
+}
+
+func TestRegistryHandler_ListFilters(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	for _, svc := range []*service.Service{
+		{ID: "payment-1", Name: "payment", Status: service.StatusHealthy, RegisteredAt: now.Add(-time.Hour), LastHeartbeat: now},
+		{ID: "payment-2", Name: "payment", Status: service.StatusUnhealthy, RegisteredAt: now.Add(-5 * time.Minute), LastHeartbeat: now.Add(-time.Minute)},
+		{ID: "billing", Name: "billing", Status: service.StatusUnknown, RegisteredAt: now.Add(-20 * time.Minute), LastHeartbeat: now.Add(-time.Minute)},
+		{ID: "mail", Name: "mail", Status: service.StatusDraining, RegisteredAt: now.Add(-time.Minute), LastHeartbeat: now.Add(-2 * time.Minute)},
+	} {
+		repo.Register(ctx, svc)
+	}
+	h := NewRegistryHandler(registry.NewService(repo, registry.Config{}, logger.NewNop()))
+	h.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		query     string
+		wantIDs   []string
+		wantTotal int
+	}{
+		{name: "status", query: "status=unhealthy", wantIDs: []string{"payment-2"}, wantTotal: 1},
+		{name: "repeated status", query: "status=unhealthy&status=unknown", wantIDs: []string{"billing", "payment-2"}, wantTotal: 2},
+		{name: "registered since a time", query: "registered_since=" + now.Add(-20*time.Minute).Format(time.RFC3339), wantIDs: []string{"billing", "mail", "payment-2"}, wantTotal: 3},
+		{name: "registered within a duration", query: "registered_since=10m", wantIDs: []string{"mail", "payment-2"}, wantTotal: 2},
+		{name: "name prefix", query: "name_prefix=pay", wantIDs: []string{"payment-1", "payment-2"}, wantTotal: 2},
+		{name: "combined", query: "name_prefix=pay&status=healthy&status=unhealthy&registered_since=30m", wantIDs: []string{"payment-2"}, wantTotal: 1},
+		{name: "descending", query: "order=desc&limit=2", wantIDs: []string{"payment-2", "payment-1"}, wantTotal: 4},
+		{name: "by registration descending", query: "sort_by=registered_at&order=desc", wantIDs: []string{"mail", "payment-2", "billing", "payment-1"}, wantTotal: 4},
+		// billing and payment-2 share a heartbeat and are ordered by ID
+		{name: "by heartbeat", query: "sort_by=last_heartbeat", wantIDs: []string{"mail", "billing", "payment-2", "payment-1"}, wantTotal: 4},
+		{name: "second page by heartbeat", query: "sort_by=last_heartbeat&limit=2&offset=1", wantIDs: []string{"billing", "payment-2"}, wantTotal: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.List(rec, httptest.NewRequest(http.MethodGet, "/registry/services?"+tt.query, nil))
+			var page struct {
+				Items []struct {
+					ID string `json:"id"`
+				} `json:"items"`
+				Total int `json:"total"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %v", rec.Code, err)
+			}
+			ids := make([]string, len(page.Items))
+			for i, item := range page.Items {
+				ids[i] = item.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || page.Total != tt.wantTotal {
+				t.Errorf("expected %v of %d, got %v of %d", tt.wantIDs, tt.wantTotal, ids, page.Total)
+			}
+		})
+	}
+
+	t.Run("invalid values", func(t *testing.T) {
+		for query, field := range map[string]string{
+			"status=sick":                  "status",
+			"status=healthy&status=":       "status",
+			"registered_since=yesterday":   "registered_since",
+			"registered_since=-10m":        "registered_since",
+			"order=up":                     "order",
+			"sort_by=status":               "sort_by",
+			"grouped=true&status=healthy":  "status",
+			"grouped=true&order=desc":      "order",
+			"grouped=true&name_prefix=pay": "name_prefix",
+		} {
+			rec := httptest.NewRecorder()
+			h.List(rec, httptest.NewRequest(http.MethodGet, "/registry/services?"+query, nil))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"`+field+`"`) {
+				t.Errorf("%s: expected 400 naming %s, got %d %s", query, field, rec.Code, rec.Body)
+			}
+		}
+	})
+
+	t.Run("listings that change without the revision are not tagged", func(t *testing.T) {
+		for query, wantTag := range map[string]bool{
+			"status=healthy": true,
+			"registered_since=" + now.Format(time.RFC3339): true,
+			"registered_since=10m":                         false,
+			"sort_by=last_heartbeat":                       false,
+		} {
+			rec := httptest.NewRecorder()
+			h.List(rec, httptest.NewRequest(http.MethodGet, "/registry/services?"+query, nil))
+			if got := rec.Header().Get("ETag") != ""; got != wantTag {
+				t.Errorf("%s: expected tagged %t, got %t", query, wantTag, got)
+			}
+		}
+	})
+}
+
+func TestRegistryHandler_Deregistered(t *testing.T) {
+	svc := registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop())
+	h := NewRegistryHandler(svc)
+	ctx := context.Background()
+	svc.Register(ctx, registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}})
+	svc.Deregister(ctx, "payment-1")
+
+	rec := httptest.NewRecorder()
+	h.Heartbeat(rec, httptest.NewRequest(http.MethodPut, "/registry/heartbeat/payment-1", nil))
+	if rec.Code != http.StatusGone || !strings.Contains(rec.Body.String(), CodeGone) {
+		t.Errorf("heartbeat: expected 410 %s, got %d %s", CodeGone, rec.Code, rec.Body)
+	}
+
+	total := func(target string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.List(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var page struct {
+			Total int `json:"total"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("%s: decode: %v", target, err)
+		}
+		return page.Total
+	}
+	if got := total("/registry/services"); got != 0 {
+		t.Errorf("expected deregistered services left out by default, got %d", got)
+	}
+	if got := total("/registry/services?include_deleted=true"); got != 1 {
+		t.Errorf("expected the deregistered service with include_deleted, got %d", got)
+	}
+	rec = httptest.NewRecorder()
+	h.List(rec, httptest.NewRequest(http.MethodGet, "/registry/services?include_deleted=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid include_deleted, got %d", rec.Code)
+	}
+
+	for _, tt := range []struct {
+		target   string
+		wantCode int
+	}{
+		{target: "/registry/services/payment-1/restore", wantCode: http.StatusOK},
+		{target: "/registry/services/payment-1/restore", wantCode: http.StatusConflict},
+		{target: "/registry/services/missing/restore", wantCode: http.StatusNotFound},
+		{target: "/registry/services/payment-1", wantCode: http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		h.Restore(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+		if rec.Code != tt.wantCode {
+			t.Errorf("POST %s: expected %d, got %d %s", tt.target, tt.wantCode, rec.Code, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.Heartbeat(rec, httptest.NewRequest(http.MethodPut, "/registry/heartbeat/payment-1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("heartbeat after restore: expected 204, got %d", rec.Code)
+	}
+}
+
+func TestRegistryHandler_Dependencies(t *testing.T) {
+	svc := registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop())
+	h := NewRegistryHandler(svc)
+	ctx := context.Background()
+	svc.Register(ctx, registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}, Capabilities: []string{"payments"}})
+	svc.Register(ctx, registry.RegisterRequest{ID: "checkout-1", Name: "checkout", Endpoints: []service.Endpoint{{URL: "http://checkout-1:8080"}}, DependsOn: []string{"payments", "fraud-check"}})
+
+	rec := httptest.NewRecorder()
+	h.Graph(rec, httptest.NewRequest(http.MethodGet, "/registry/graph", nil))
+	var graph registry.Graph
+	if err := json.NewDecoder(rec.Body).Decode(&graph); err != nil {
+		t.Fatalf("decode graph: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(graph.Nodes) != 2 || len(graph.Edges) != 1 || len(graph.Missing) != 1 {
+		t.Errorf("unexpected graph %d %+v", rec.Code, graph)
+	}
+	if graph.Edges[0] != (registry.GraphEdge{From: "checkout-1", To: "payment-1", Capability: "payments"}) {
+		t.Errorf("unexpected edge %+v", graph.Edges[0])
+	}
+
+	rec = httptest.NewRecorder()
+	h.Impact(rec, httptest.NewRequest(http.MethodGet, "/registry/impact/payment-1", nil))
+	var impact registry.Impact
+	if err := json.NewDecoder(rec.Body).Decode(&impact); err != nil {
+		t.Fatalf("decode impact: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(impact.Affected) != 1 || impact.Affected[0].ID != "checkout-1" {
+		t.Errorf("unexpected impact %d %+v", rec.Code, impact)
+	}
+
+	for _, target := range []string{"/registry/impact/missing", "/registry/impact/a/b"} {
+		rec := httptest.NewRecorder()
+		h.Impact(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestRegistryHandler_HealthHistory(t *testing.T) {
+	svc := registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop())
+	h := NewRegistryHandler(svc)
+	svc.Register(context.Background(), registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}})
+
+	rec := httptest.NewRecorder()
+	h.Get(rec, httptest.NewRequest(http.MethodGet, "/registry/services/payment-1/health-history", nil))
+	var history registry.HealthHistory
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if rec.Code != http.StatusOK || history.ServiceID != "payment-1" || history.Results == nil || history.Summary.Checks != 0 {
+		t.Errorf("unexpected history %d %+v", rec.Code, history)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Get(rec, httptest.NewRequest(http.MethodGet, "/registry/services/payment-1", nil))
+	var detail struct {
+		ID            string                  `json:"id"`
+		HealthSummary *registry.HealthSummary `json:"health_summary"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &detail)
+	if rec.Code != http.StatusOK || detail.ID != "payment-1" || detail.HealthSummary == nil {
+		t.Errorf("expected the service with a health summary, got %d %s", rec.Code, rec.Body)
+	}
+
+	for _, target := range []string{"/registry/services/missing/health-history", "/registry/services/a/b/health-history"} {
+		rec := httptest.NewRecorder()
+		h.Get(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestRegistryHandler_DiscoverOne(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	for _, id := range []string{"payment-a", "payment-b"} {
+		repo.Register(ctx, &service.Service{ID: id, Name: "payment", Capabilities: []string{"payments"}, Status: service.StatusHealthy})
+	}
+	h := NewRegistryHandler(registry.NewService(repo, registry.Config{}, logger.NewNop()))
+
+	discover := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/registry/discover?"+query, nil)
+		req.Header.Set("If-None-Match", "*")
+		h.Discover(rec, req)
+		return rec
+	}
+
+	var got []string
+	for range 4 {
+		rec := discover("capability=payments&select=one&strategy=round_robin")
+		var picked computedFields
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &picked) != nil {
+			t.Fatalf("expected one service, got %d: %s", rec.Code, rec.Body)
+		}
+		got = append(got, picked.ID)
+	}
+	if want := []string{"payment-a", "payment-b", "payment-a", "payment-b"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if rec := discover("capability=payments&select=one"); rec.Code != http.StatusOK {
+		t.Errorf("expected random selection by default, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := discover("capability=search&select=one"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a matching instance, got %d: %s", rec.Code, rec.Body)
+	}
+
+	invalid := map[string]string{
+		"select=some":                 "select",
+		"select=one&strategy=fastest": "strategy",
+		"strategy=random":             "strategy",
+	}
+	for query, field := range invalid {
+		rec := discover(query)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"`+field+`"`) {
+			t.Errorf("%s: expected 400 naming %s, got %d: %s", query, field, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestRegistryHandler_DiscoverLongPoll(t *testing.T) {
+	svc := registry.NewService(memory.NewRegistryRepository(), registry.Config{MaxDiscoverWait: 200 * time.Millisecond}, logger.NewNop())
+	h := NewRegistryHandler(svc)
+	ctx := context.Background()
+	revision, _ := svc.Revision(ctx)
+	target := fmt.Sprintf("/registry/discover?capability=payments&wait=30s&revision=%d", revision)
+
+	t.Run("unblocks on a change", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			rec := httptest.NewRecorder()
+			h.Discover(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			done <- rec
+		}()
+
+		select {
+		case rec := <-done:
+			t.Fatalf("expected the poll to wait, got %d", rec.Code)
+		case <-time.After(20 * time.Millisecond):
+		}
+		start := time.Now()
+		svc.Register(ctx, registry.RegisterRequest{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}, Capabilities: []string{"payments"}})
+
+		rec := <-done
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected the poll to return promptly after the change, took %s", elapsed)
+		}
+		var services []computedFields
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &services) != nil || len(services) != 1 {
+			t.Fatalf("expected the registered service, got %d: %s", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get(RevisionHeader); got == "" || got == fmt.Sprint(revision) {
+			t.Errorf("expected a new revision, got %q", got)
+		}
+	})
+
+	t.Run("wait elapses unchanged", func(t *testing.T) {
+		current, _ := svc.Revision(ctx)
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		h.Discover(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/registry/discover?wait=30s&revision=%d", current), nil))
+
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+			t.Errorf("expected the wait to be capped at 200ms, took %s", elapsed)
+		}
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("expected 304 without a body, got %d: %s", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get(RevisionHeader); got != fmt.Sprint(current) {
+			t.Errorf("expected revision %d, got %q", current, got)
+		}
+	})
+
+	t.Run("stale revision answers at once", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.Discover(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("client disconnect", func(t *testing.T) {
+		current, _ := svc.Revision(ctx)
+		reqCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		rec := httptest.NewRecorder()
+		h.Discover(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/registry/discover?wait=30s&revision=%d", current), nil).WithContext(reqCtx))
+		if rec.Body.Len() != 0 || rec.Header().Get(RevisionHeader) != "" {
+			t.Errorf("expected nothing written to a gone client, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"wait=soon&revision=1", "wait=-1s&revision=1", "wait=30s", "wait=30s&revision=latest"} {
+			rec := httptest.NewRecorder()
+			h.Discover(rec, httptest.NewRequest(http.MethodGet, "/registry/discover?"+query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", query, rec.Code)
+			}
+		}
+	})
+}
+
+func TestRegistryHandler_Schemas(t *testing.T) {
+	svc := registry.NewService(memory.NewRegistryRepository(), registry.Config{Schemas: memory.NewConfigRepository()}, logger.NewNop())
+	h := NewRegistryHandler(svc)
+
+	serve := func(handle http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handle(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	for _, tt := range []struct {
+		body     string
+		wantCode int
+	}{
+		{body: `{"required":["team"],"patterns":{"team":"[a-z]+"}}`, wantCode: http.StatusCreated},
+		{body: `{"name":"payment","required":["team"],"patterns":{"team":"[a-z]+"}}`, wantCode: http.StatusOK},
+		{body: `{"name":"search"}`, wantCode: http.StatusBadRequest},
+		{body: `{"patterns":{"team":"[a-z"}}`, wantCode: http.StatusBadRequest},
+	} {
+		if rec := serve(h.PutSchema, http.MethodPut, "/admin/registry/schemas/payment", tt.body); rec.Code != tt.wantCode {
+			t.Errorf("PUT %s: expected %d, got %d %s", tt.body, tt.wantCode, rec.Code, rec.Body)
+		}
+	}
+
+	rec := serve(h.Register, http.MethodPost, "/registry/register",
+		`{"id":"payment-1","name":"payment","endpoints":[{"url":"http://payment-1:8080"}],"metadata":{"team":"Payments"}}`)
+	var body ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusBadRequest || len(body.Fields) != 1 || body.Fields[0].Field != "metadata.team" {
+		t.Errorf("expected 400 naming metadata.team, got %d %+v", rec.Code, body)
+	}
+
+	rec = serve(h.ListSchemas, http.MethodGet, "/admin/registry/schemas", "")
+	var schemas []registry.MetadataSchema
+	json.NewDecoder(rec.Body).Decode(&schemas)
+	if rec.Code != http.StatusOK || len(schemas) != 1 || schemas[0].Name != "payment" || schemas[0].Patterns["team"] != "[a-z]+" {
+		t.Errorf("expected the payment schema listed, got %d %+v", rec.Code, schemas)
+	}
+
+	for _, tt := range []struct {
+		handle   http.HandlerFunc
+		method   string
+		target   string
+		wantCode int
+	}{
+		{handle: h.GetSchema, method: http.MethodGet, target: "/admin/registry/schemas/payment", wantCode: http.StatusOK},
+		{handle: h.GetSchema, method: http.MethodGet, target: "/admin/registry/schemas/search", wantCode: http.StatusNotFound},
+		{handle: h.DeleteSchema, method: http.MethodDelete, target: "/admin/registry/schemas/payment", wantCode: http.StatusNoContent},
+		{handle: h.DeleteSchema, method: http.MethodDelete, target: "/admin/registry/schemas/payment", wantCode: http.StatusNotFound},
+		{handle: h.DeleteSchema, method: http.MethodDelete, target: "/admin/registry/schemas/", wantCode: http.StatusBadRequest},
+	} {
+		if rec := serve(tt.handle, tt.method, tt.target, ""); rec.Code != tt.wantCode {
+			t.Errorf("%s %s: expected %d, got %d %s", tt.method, tt.target, tt.wantCode, rec.Code, rec.Body)
+		}
+	}
+}
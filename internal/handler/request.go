@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/internal/validate"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// maxBodyBytes caps the size of JSON request bodies
+const maxBodyBytes = 1 << 20
+
+// APIVersionHeader selects a response format; version 1 keeps list endpoints
+// returning a plain array instead of the paginated envelope
+const APIVersionHeader = "X-API-Version"
+
+// decodeJSON decodes the request body into v, rejecting unknown fields
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	return decodeJSONLimit(w, r, v, maxBodyBytes)
+}
+
+// decodeJSONLimit is decodeJSON for bodies allowed to exceed maxBodyBytes
+func decodeJSONLimit(w http.ResponseWriter, r *http.Request, v any, limit int64) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// decodeAndValidate decodes the request body into v like decodeJSON and
+// checks it with its Validate method, or against its validate tags when it
+// has none. When either fails it writes the 400 response, listing the invalid
+// fields, and returns false.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := decodeJSON(w, r, v); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return false
+	}
+
+	var err error
+	if req, ok := v.(interface{ Validate() error }); ok {
+		err = req.Validate()
+	} else {
+		err = validate.Validate(v)
+	}
+	var invalid validation.Errors
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, r, invalid)
+		return false
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to validate request")
+		return false
+	}
+	return true
+}
+
+// pathID returns the ID following resource in the request path, read with
+// server.PathParam, when the rest of the path is suffix, e.g. "status" for
+// /registry/services/{id}/status, or nothing for an empty suffix. Otherwise
+// it writes the response, naming the resource as noun, and returns false:
+// 404 when the rest differs and 400 when the ID is missing or invalid.
+func pathID(w http.ResponseWriter, r *http.Request, resource, suffix, noun string) (string, bool) {
+	id, rest, err := server.PathParam(r, resource)
+	switch pathStatus(rest, suffix, err) {
+	case http.StatusNotFound:
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "not found")
+		return "", false
+	case http.StatusBadRequest:
+		message := "invalid " + noun + " id"
+		if errors.Is(err, server.ErrMissingParam) {
+			message = noun + " id is required"
+		}
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, message)
+		return "", false
+	}
+	return id, true
+}
+
+// pathStatus is the status pathID answers the outcome of server.PathParam
+// with, or 0 when the request names a resource, for handlers without a body
+func pathStatus(rest, suffix string, err error) int {
+	switch {
+	case rest != suffix:
+		return http.StatusNotFound
+	case err != nil:
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+// listOptions reads the limit, offset and sort_by query parameters. Limit
+// defaults to pagination.DefaultLimit and may not exceed pagination.MaxLimit;
+// sort_by must be one of sortFields. Any problems are returned together.
+func listOptions(r *http.Request, sortFields []string) (pagination.ListOptions, validation.Errors) {
+	query := r.URL.Query()
+	opts := pagination.ListOptions{Limit: pagination.DefaultLimit, SortBy: query.Get("sort_by")}
+
+	var errs validation.Errors
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > pagination.MaxLimit {
+			errs.Add("limit", fmt.Sprintf("must be an integer from 1 to %d", pagination.MaxLimit))
+		}
+		opts.Limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			errs.Add("offset", "must be a non-negative integer")
+		}
+		opts.Offset = offset
+	}
+	if opts.SortBy != "" && !slices.Contains(sortFields, opts.SortBy) {
+		errs.Add("sort_by", "must be one of "+strings.Join(sortFields, ", "))
+	}
+
+	return opts, errs
+}
+
+// wantsPlainList reports whether the caller asked for the version 1 list
+// format, via the X-API-Version header or a version query parameter
+func wantsPlainList(r *http.Request) bool {
+	return r.Header.Get(APIVersionHeader) == "1" || r.URL.Query().Get("version") == "1"
+}
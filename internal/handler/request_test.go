@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/internal/service/webhook"
+	"github.com/aq189/bin/pkg/jwt"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestHandlers_ValidateRequestBodies(t *testing.T) {
+	authHandler := NewAuthHandler(auth.NewService(jwt.New(jwt.Config{Secret: "test-secret"}), memory.NewAPIKeyRepository(), auth.Config{}, logger.NewNop()))
+	sessionHandler := NewSessionHandler(session.NewService(memory.NewSessionRepository(), session.Config{}, logger.NewNop()))
+	registryHandler := NewRegistryHandler(registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop()))
+	webhookHandler := NewWebhookHandler(webhook.NewService(memory.NewConfigRepository(), webhook.Config{}, logger.NewNop()))
+
+	const registration = `"id":"payment-1","name":"payment","endpoints":[{"url":"http://payment-1:8080"}]`
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantFields []string // listed in a 400 response
+	}{
+		{name: "issue token", handler: authHandler.IssueToken, target: "/auth/token",
+			body: `{}`, wantStatus: http.StatusBadRequest, wantFields: []string{"subject"}},
+		{name: "validate token", handler: authHandler.ValidateToken, target: "/auth/validate",
+			body: `{"audience":"billing-1"}`, wantStatus: http.StatusBadRequest, wantFields: []string{"token"}},
+		{name: "validate token passes on", handler: authHandler.ValidateToken, target: "/auth/validate",
+			body: `{"token":"not-a-token"}`, wantStatus: http.StatusUnauthorized},
+		{name: "refresh token", handler: authHandler.RefreshToken, target: "/auth/refresh",
+			body: `{"refresh_token":""}`, wantStatus: http.StatusBadRequest, wantFields: []string{"refresh_token"}},
+		{name: "revoke token", handler: authHandler.RevokeToken, target: "/auth/revoke",
+			body: `{}`, wantStatus: http.StatusBadRequest, wantFields: []string{"token"}},
+		{name: "create api key", handler: authHandler.CreateAPIKey, target: "/auth/apikeys",
+			body: `{"ttl":-1}`, wantStatus: http.StatusBadRequest, wantFields: []string{"name", "ttl"}},
+		{name: "create api key passes on", handler: authHandler.CreateAPIKey, target: "/auth/apikeys",
+			body: `{"name":"ci","roles":["service"]}`, wantStatus: http.StatusCreated},
+		{name: "create session", handler: sessionHandler.Create, target: "/session",
+			body: `{"user_id":"","service_id":"web/1","ttl":-5}`, wantStatus: http.StatusBadRequest, wantFields: []string{"user_id", "service_id", "ttl"}},
+		{name: "create session passes on", handler: sessionHandler.Create, target: "/session",
+			body: `{"user_id":"user-1","service_id":"web"}`, wantStatus: http.StatusCreated},
+		{name: "get or create session", handler: sessionHandler.GetOrCreate, target: "/session/get-or-create",
+			body: `{"service_id":"web","merge_data":true}`, wantStatus: http.StatusBadRequest, wantFields: []string{"user_id"}},
+		{name: "update session", handler: sessionHandler.Update, method: http.MethodPut, target: "/session/missing",
+			body: `{"data":{"cart":1}}`, wantStatus: http.StatusNotFound},
+		{name: "register service", handler: registryHandler.Register, target: "/registry/register",
+			body:       `{"id":"payment-1","endpoints":[{"url":"/payments","weight":-1}],"capabilities":["Pay"],"metadata":{"zone":"` + strings.Repeat("z", 257) + `"}}`,
+			wantStatus: http.StatusBadRequest, wantFields: []string{"name", "endpoints[0].url", "endpoints[0].weight", "capabilities[0]", "metadata.zone"}},
+		{name: "register service across fields", handler: registryHandler.Register, target: "/registry/register",
+			body:       `{` + registration + `,"health_check":{"type":"tcp","url":"payment-1:9090","expected_status_codes":[200]}}`,
+			wantStatus: http.StatusBadRequest, wantFields: []string{"health_check.expected_status_codes"}},
+		{name: "register service passes on", handler: registryHandler.Register, target: "/registry/register",
+			body: `{` + registration + `}`, wantStatus: http.StatusCreated},
+		{name: "set service status", handler: registryHandler.SetStatus, method: http.MethodPut, target: "/registry/services/payment-1/status",
+			body: `{"status":"unhealthy"}`, wantStatus: http.StatusBadRequest, wantFields: []string{"status"}},
+		{name: "create webhook", handler: webhookHandler.Create, target: "/admin/webhooks",
+			body: `{"id":"hooks","url":"ftp://hooks"}`, wantStatus: http.StatusBadRequest, wantFields: []string{"url", "secret"}},
+		{name: "malformed body", handler: sessionHandler.Create, target: "/session",
+			body: `{"user_id":`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", handler: registryHandler.Register, target: "/registry/register",
+			body: `{` + registration + `,"owner":"payments"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(method, tt.target, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if rec.Code != http.StatusBadRequest {
+				return
+			}
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode error response: %v", err)
+			}
+			if resp.Code != CodeInvalidRequest {
+				t.Errorf("expected code %s, got %s", CodeInvalidRequest, resp.Code)
+			}
+			var fields []string
+			for _, fe := range resp.Fields {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestHandlers_PathIDs(t *testing.T) {
+	sessionHandler := NewSessionHandler(session.NewService(memory.NewSessionRepository(), session.Config{}, logger.NewNop()))
+	registryHandler := NewRegistryHandler(registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop()))
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "session", handler: sessionHandler.Get, target: "/session/missing", wantStatus: http.StatusNotFound},
+		{name: "session with trailing slash", handler: sessionHandler.Get, target: "/session/missing/", wantStatus: http.StatusNotFound},
+		{name: "session without id", handler: sessionHandler.Get, target: "/session/", wantStatus: http.StatusBadRequest},
+		{name: "session with encoded slash", handler: sessionHandler.Get, target: "/session/abc%2Fdef", wantStatus: http.StatusBadRequest},
+		{name: "session with double encoded slash", handler: sessionHandler.Get, target: "/session/abc%252Fdef", wantStatus: http.StatusBadRequest},
+		{name: "session validate with trailing slash", handler: sessionHandler.Get, target: "/session/missing/validate/", wantStatus: http.StatusOK},
+		{name: "session validate with encoded slash", handler: sessionHandler.Get, target: "/session/a%2Fb/validate", wantStatus: http.StatusBadRequest},
+		{name: "session head with encoded slash", handler: sessionHandler.Head, method: http.MethodHead, target: "/session/abc%2Fdef", wantStatus: http.StatusBadRequest},
+		{name: "session delete with encoded slash", handler: sessionHandler.Delete, method: http.MethodDelete, target: "/v1/session/abc%2Fdef", wantStatus: http.StatusBadRequest},
+		{name: "session in a sub-path", handler: sessionHandler.Delete, method: http.MethodDelete, target: "/session/abc/def", wantStatus: http.StatusNotFound},
+		{name: "heartbeat", handler: registryHandler.Heartbeat, method: http.MethodPut, target: "/registry/heartbeat/missing/", wantStatus: http.StatusNotFound},
+		{name: "heartbeat with traversal", handler: registryHandler.Heartbeat, method: http.MethodPut, target: "/registry/heartbeat/..%2F", wantStatus: http.StatusBadRequest},
+		{name: "heartbeat with double encoded traversal", handler: registryHandler.Heartbeat, method: http.MethodPut, target: "/registry/heartbeat/..%252F", wantStatus: http.StatusBadRequest},
+		{name: "deregister without id", handler: registryHandler.Deregister, method: http.MethodDelete, target: "/registry/deregister/", wantStatus: http.StatusBadRequest},
+		{name: "deregister with encoded slash", handler: registryHandler.Deregister, method: http.MethodDelete, target: "/registry/deregister/a%2Fb", wantStatus: http.StatusBadRequest},
+		{name: "deregister with trailing slash", handler: registryHandler.Deregister, method: http.MethodDelete, target: "/registry/deregister/missing/", wantStatus: http.StatusNoContent},
+		{name: "service with encoded slash", handler: registryHandler.Get, target: "/registry/services/a%2Fb", wantStatus: http.StatusBadRequest},
+		{name: "status with encoded slash", handler: registryHandler.SetStatus, method: http.MethodPut, target: "/registry/services/a%2Fb/status", wantStatus: http.StatusBadRequest},
+		{name: "restore of another path", handler: registryHandler.Restore, method: http.MethodPost, target: "/registry/services/a/undo", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(method, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// Error codes returned in the error envelope
+const (
+	CodeInvalidRequest  = "INVALID_REQUEST"
+	CodeUnauthorized    = "UNAUTHORIZED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeGone            = "GONE"
+	CodeTooManySessions = "TOO_MANY_SESSIONS"
+	CodeQuotaExceeded   = "QUOTA_EXCEEDED"
+	CodeInternal        = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the JSON body of every error response
+type ErrorResponse struct {
+	Error     string                  `json:"error"`
+	Code      string                  `json:"code"`
+	RequestID string                  `json:"request_id,omitempty"`
+	Fields    []validation.FieldError `json:"fields,omitempty"`
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error envelope tagged with the request ID
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeJSON(w, status, ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	})
+}
+
+// writeValidationError writes a 400 envelope listing each invalid field
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	writeJSON(w, http.StatusBadRequest, ErrorResponse{
+		Error:     "validation failed",
+		Code:      CodeInvalidRequest,
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+		Fields:    errs,
+	})
+}
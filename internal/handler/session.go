@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	domainsession "github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// SessionHandler serves session endpoints
+type SessionHandler struct {
+	service *session.Service
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(service *session.Service) *SessionHandler {
+	return &SessionHandler{service: service}
+}
+
+// updateSessionRequest is the body of PUT /session/{id}
+type updateSessionRequest struct {
+	Data map[string]any `json:"data"`
+}
+
+// SessionExpiresAtHeader carries the expiry of a valid session, in RFC 3339,
+// on responses to HEAD /session/{id}
+const SessionExpiresAtHeader = "X-Session-Expires-At"
+
+// validateResponse is the body of GET /session/{id}/validate
+type validateResponse struct {
+	Valid     bool      `json:"valid"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// cleanupResponse reports the result of a manual cleanup
+type cleanupResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// Create handles POST /session
+func (h *SessionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req session.CreateRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	sess, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, session.ErrTooManySessions) {
+			writeError(w, r, http.StatusConflict, CodeTooManySessions, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to create session")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sess)
+}
+
+// GetOrCreate handles POST /session/get-or-create, answering 201 with a new
+// session or 200 with the user's existing one
+func (h *SessionHandler) GetOrCreate(w http.ResponseWriter, r *http.Request) {
+	var req session.GetOrCreateRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	sess, created, err := h.service.GetOrCreate(r.Context(), req)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, session.ErrTooManySessions) {
+			writeError(w, r, http.StatusConflict, CodeTooManySessions, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to get or create session")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, sess)
+}
+
+// List handles GET /session?user_id=&limit=&offset=&sort_by=
+// and answers with a pagination.Page of the user's active sessions
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	opts, invalid := listOptions(r, domainsession.SortFields)
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		invalid.Add("user_id", "is required")
+	}
+	if invalid != nil {
+		writeValidationError(w, r, invalid)
+		return
+	}
+
+	page, err := h.service.ListByUser(r.Context(), userID, opts)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list sessions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Get handles GET /session/{id} and GET /session/{id}/validate
+func (h *SessionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	suffix := ""
+	if _, rest, _ := server.PathParam(r, "/session/"); rest == "validate" {
+		suffix = rest
+	}
+	id, ok := pathID(w, r, "/session/", suffix, "session")
+	if !ok {
+		return
+	}
+	if suffix != "" {
+		h.validate(w, r, id)
+		return
+	}
+
+	sess, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "session not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to get session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sess)
+}
+
+// Head handles HEAD /session/{id}, answering 200 with SessionExpiresAtHeader
+// for an active session and 404 otherwise, without a body either way
+func (h *SessionHandler) Head(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := server.PathParam(r, "/session/")
+	if status := pathStatus(rest, "", err); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	valid, expiresAt, err := h.service.Validate(r.Context(), id)
+	switch {
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	case !valid:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.Header().Set(SessionExpiresAtHeader, expiresAt.UTC().Format(time.RFC3339Nano))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// validate answers GET /session/{id}/validate with whether the session is
+// active, for clients that can't send HEAD
+func (h *SessionHandler) validate(w http.ResponseWriter, r *http.Request, id string) {
+	valid, expiresAt, err := h.service.Validate(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to validate session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, validateResponse{Valid: valid, ExpiresAt: expiresAt})
+}
+
+// Update handles PUT /session/{id}
+func (h *SessionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/session/", "", "session")
+	if !ok {
+		return
+	}
+
+	var req updateSessionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if err := h.service.Update(r.Context(), id, req.Data); err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, session.ErrSessionNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "session not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to update session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete handles DELETE /session/{id}
+func (h *SessionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/session/", "", "session")
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to delete session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Cleanup handles POST /admin/sessions/cleanup
+func (h *SessionHandler) Cleanup(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.service.CleanupNow(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "session cleanup failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cleanupResponse{Deleted: deleted})
+}
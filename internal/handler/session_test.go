@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	domainsession "github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func newValidateHandler(t *testing.T) (*SessionHandler, time.Time) {
+	t.Helper()
+	repo := memory.NewSessionRepository()
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	repo.Create(ctx, &domainsession.Session{ID: "active", Data: map[string]any{"cart": "secret"}, ExpiresAt: expiresAt})
+	repo.Create(ctx, &domainsession.Session{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	repo.Create(ctx, &domainsession.Session{ID: "validate", ExpiresAt: expiresAt})
+
+	return NewSessionHandler(session.NewService(repo, session.Config{}, logger.NewNop())), expiresAt
+}
+
+func TestSessionHandler_Head(t *testing.T) {
+	h, expiresAt := newValidateHandler(t)
+
+	tests := []struct {
+		id         string
+		wantStatus int
+	}{
+		{id: "active", wantStatus: http.StatusOK},
+		{id: "expired", wantStatus: http.StatusNotFound},
+		{id: "missing", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.Head(rec, httptest.NewRequest(http.MethodHead, "/session/"+tt.id, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("expected no body, got %q", rec.Body)
+			}
+
+			header := rec.Header().Get(SessionExpiresAtHeader)
+			if tt.wantStatus != http.StatusOK {
+				if header != "" {
+					t.Errorf("expected no expiry header, got %q", header)
+				}
+				return
+			}
+			got, err := time.Parse(time.RFC3339Nano, header)
+			if err != nil || !got.Equal(expiresAt) {
+				t.Errorf("expected expiry %v, got %q", expiresAt, header)
+			}
+		})
+	}
+}
+
+func TestSessionHandler_Validate(t *testing.T) {
+	h, expiresAt := newValidateHandler(t)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantValid  bool
+	}{
+		{name: "active", target: "/session/active/validate", wantStatus: http.StatusOK, wantValid: true},
+		{name: "expired", target: "/session/expired/validate", wantStatus: http.StatusOK},
+		{name: "missing", target: "/session/missing/validate", wantStatus: http.StatusOK},
+		{name: "no id", target: "/session//validate", wantStatus: http.StatusBadRequest},
+		{name: "nested path", target: "/session/a/b/validate", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.Get(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got["valid"] != tt.wantValid {
+				t.Errorf("expected valid %v, got %v", tt.wantValid, got["valid"])
+			}
+			if _, ok := got["data"]; ok {
+				t.Error("expected no session data in the response")
+			}
+			_, hasExpiry := got["expires_at"]
+			if hasExpiry != tt.wantValid {
+				t.Errorf("expected expires_at only for a valid session, got %v", got)
+			}
+			if tt.wantValid && got["expires_at"] != expiresAt.Format(time.RFC3339Nano) {
+				t.Errorf("expected expires_at %v, got %v", expiresAt, got["expires_at"])
+			}
+		})
+	}
+
+	t.Run("session named validate", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.Get(rec, httptest.NewRequest(http.MethodGet, "/session/validate", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected the session to be returned, got %d", rec.Code)
+		}
+	})
+}
+
+func TestSessionHandler_GetOrCreate(t *testing.T) {
+	h := NewSessionHandler(session.NewService(memory.NewSessionRepository(), session.Config{}, logger.NewNop()))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCart   string
+	}{
+		{name: "creates", body: `{"user_id":"user-1","service_id":"web","data":{"cart":"c-1"}}`, wantStatus: http.StatusCreated, wantCart: "c-1"},
+		{name: "returns existing", body: `{"user_id":"user-1","service_id":"web","data":{"cart":"c-2"}}`, wantStatus: http.StatusOK, wantCart: "c-1"},
+		{name: "merges", body: `{"user_id":"user-1","service_id":"web","data":{"cart":"c-2"},"merge_data":true}`, wantStatus: http.StatusOK, wantCart: "c-2"},
+		{name: "invalid", body: `{"user_id":"user-1"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	var firstID string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.GetOrCreate(rec, httptest.NewRequest(http.MethodPost, "/session/get-or-create", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantCart == "" {
+				return
+			}
+			var got domainsession.Session
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if firstID == "" {
+				firstID = got.ID
+			}
+			if got.ID != firstID || got.Data["cart"] != tt.wantCart {
+				t.Errorf("expected session %s with cart %s, got %s with %v", firstID, tt.wantCart, got.ID, got.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aq189/bin/internal/service/auth"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/internal/service/session"
+)
+
+// StatsHandler serves the aggregate numbers ops dashboards poll
+type StatsHandler struct {
+	startedAt time.Time
+	sessions  *session.Service
+	auth      *auth.Service
+	registry  *registry.Service
+}
+
+// NewStatsHandler creates a new stats handler reporting uptime since startedAt
+func NewStatsHandler(startedAt time.Time, sessions *session.Service, auth *auth.Service, registry *registry.Service) *StatsHandler {
+	return &StatsHandler{startedAt: startedAt, sessions: sessions, auth: auth, registry: registry}
+}
+
+// statsResponse is the body of GET /admin/stats
+type statsResponse struct {
+	UptimeSeconds float64          `json:"uptime_seconds"`
+	Sessions      session.Activity `json:"sessions"`
+	Services      registry.Counts  `json:"services"`
+	Tokens        tokenStats       `json:"tokens"`
+}
+
+// tokenStats counts issued tokens
+type tokenStats struct {
+	IssuedLastHour int64 `json:"issued_last_hour"`
+}
+
+// Stats handles GET /admin/stats. Sessions and services are counted across
+// every tenant; the last hour counts are kept by this server alone.
+func (h *StatsHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.sessions.Activity(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to count sessions")
+		return
+	}
+	services, err := h.registry.Counts(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to count services")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statsResponse{
+		UptimeSeconds: time.Since(h.startedAt).Seconds(),
+		Sessions:      sessions,
+		Services:      services,
+		Tokens:        tokenStats{IssuedLastHour: h.auth.TokensIssuedLastHour()},
+	})
+}
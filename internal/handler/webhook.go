@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aq189/bin/internal/service/webhook"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// WebhookHandler serves the admin endpoints managing webhook targets
+type WebhookHandler struct {
+	service *webhook.Service
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(service *webhook.Service) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// List handles GET /admin/webhooks. Secrets are left out.
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	targets, err := h.service.ListTargets()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to list webhook targets")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// Create handles POST /admin/webhooks.
+// It answers 201 with the target without its secret, 400 listing invalid
+// fields and 409 when the ID is taken.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req webhook.Target
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	target, err := h.service.AddTarget(req)
+	if err != nil {
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			writeValidationError(w, r, invalid)
+			return
+		}
+		if errors.Is(err, webhook.ErrTargetExists) {
+			writeError(w, r, http.StatusConflict, CodeConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to add webhook target")
+		return
+	}
+
+	target.Secret = ""
+	writeJSON(w, http.StatusCreated, target)
+}
+
+// Delete handles DELETE /admin/webhooks/{id}
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "/admin/webhooks/", "", "webhook target")
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveTarget(id); err != nil {
+		if errors.Is(err, webhook.ErrTargetNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "webhook target not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "failed to remove webhook target")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
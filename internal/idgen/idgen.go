@@ -0,0 +1,216 @@
+// Package idgen generates identifiers in the formats deployments choose
+// between: random hex, UUIDv4, and the time-ordered UUIDv7 and ULID, which
+// keep database indexes local and sort by creation time.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aq189/bin/internal/clock"
+)
+
+// Formats of the generated identifiers
+const (
+	// FormatHex is 32 random lowercase hex digits, the historical format
+	FormatHex = "hex"
+	// FormatUUIDv4 is a random UUID, RFC 9562 version 4
+	FormatUUIDv4 = "uuidv4"
+	// FormatUUIDv7 is a UUID starting with the Unix time in milliseconds,
+	// RFC 9562 version 7
+	FormatUUIDv7 = "uuidv7"
+	// FormatULID is 26 Crockford base32 characters starting with the Unix
+	// time in milliseconds
+	FormatULID = "ulid"
+)
+
+// Formats lists the formats New accepts
+var Formats = []string{FormatHex, FormatUUIDv4, FormatUUIDv7, FormatULID}
+
+// IDGenerator returns a new identifier on every call. Implementations are
+// safe for concurrent use.
+type IDGenerator interface {
+	NewID() string
+}
+
+// Hex is the IDGenerator of FormatHex
+var Hex IDGenerator = hexGenerator{}
+
+// New returns the generator of format, FormatHex when empty. UUIDv7 and ULID
+// take their time from c, nil using the system clock, and the identifiers a
+// generator returns sort in the order they were generated even when several
+// fall within a millisecond or the clock steps back.
+func New(format string, c clock.Clock) (IDGenerator, error) {
+	switch format {
+	case "", FormatHex:
+		return Hex, nil
+	case FormatUUIDv4:
+		return uuidV4Generator{}, nil
+	case FormatUUIDv7:
+		return &uuidV7Generator{clock: clock.OrReal(c)}, nil
+	case FormatULID:
+		return &ulidGenerator{clock: clock.OrReal(c)}, nil
+	}
+	return nil, fmt.Errorf("unknown id format %q, want one of %s", format, strings.Join(Formats, ", "))
+}
+
+// OrHex returns g, or Hex when g is nil, so a zero Config field means the
+// historical format
+func OrHex(g IDGenerator) IDGenerator {
+	if g == nil {
+		return Hex
+	}
+	return g
+}
+
+// Prefixed returns a generator prepending prefix to the identifiers of g,
+// like the "sess_" of session IDs
+func Prefixed(prefix string, g IDGenerator) IDGenerator {
+	return prefixed{prefix: prefix, g: OrHex(g)}
+}
+
+type prefixed struct {
+	prefix string
+	g      IDGenerator
+}
+
+func (p prefixed) NewID() string {
+	return p.prefix + p.g.NewID()
+}
+
+// hexGenerator generates FormatHex identifiers
+type hexGenerator struct{}
+
+func (hexGenerator) NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// uuidV4Generator generates FormatUUIDv4 identifiers
+type uuidV4Generator struct{}
+
+func (uuidV4Generator) NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return formatUUID(b, 4)
+}
+
+// uuidV7Generator generates FormatUUIDv7 identifiers. The 12 bits after the
+// version count identifiers within a millisecond, starting from a random
+// value below 2048 so there is room to count up; when they run out the
+// timestamp moves a millisecond ahead of the clock. The 62 bits after the
+// variant are random.
+type uuidV7Generator struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	ms      uint64 // timestamp of the last identifier
+	counter uint16
+}
+
+func (g *uuidV7Generator) NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	g.mu.Lock()
+	if ms := uint64(g.clock.Now().UnixMilli()); ms > g.ms {
+		g.ms = ms
+		g.counter = binary.BigEndian.Uint16(b[6:8]) & 0x7ff
+	} else if g.counter++; g.counter > 0xfff {
+		g.ms++
+		g.counter = 0
+	}
+	ms, counter := g.ms, g.counter
+	g.mu.Unlock()
+
+	putMillis(b[:6], ms)
+	binary.BigEndian.PutUint16(b[6:8], counter)
+	return formatUUID(b, 7)
+}
+
+// formatUUID sets the version and RFC 9562 variant bits of b and formats it
+// in the canonical 8-4-4-4-12 hex form
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
+
+// ulidGenerator generates FormatULID identifiers. Within a millisecond, or
+// when the clock steps back, the 80 random bits of the last identifier are
+// incremented, as the ULID specification's monotonic generator does; when
+// they overflow the timestamp moves a millisecond ahead of the clock.
+type ulidGenerator struct {
+	clock clock.Clock
+
+	mu   sync.Mutex
+	last [16]byte // the last identifier
+}
+
+func (g *ulidGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.clock.Now().UnixMilli())
+	lastMS := uint64(g.last[0])<<40 | uint64(g.last[1])<<32 | uint64(binary.BigEndian.Uint32(g.last[2:6]))
+	if ms > lastMS {
+		putMillis(g.last[:6], ms)
+		rand.Read(g.last[6:])
+	} else if !increment(g.last[6:]) {
+		putMillis(g.last[:6], lastMS+1)
+	}
+	return encodeULID(g.last)
+}
+
+// increment adds one to the big-endian number b, reporting false when it
+// wrapped around to zero
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// putMillis writes the low 48 bits of ms to b big-endian
+func putMillis(b []byte, ms uint64) {
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+}
+
+// crockford is the Crockford base32 alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// encodeULID writes the 128 bits of b as 26 base32 characters, the first
+// holding the top 3 bits
+func encodeULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
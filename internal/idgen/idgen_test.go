@@ -0,0 +1,175 @@
+package idgen
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+)
+
+var formatPatterns = map[string]*regexp.Regexp{
+	FormatHex:    regexp.MustCompile(`^[0-9a-f]{32}$`),
+	FormatUUIDv4: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	FormatUUIDv7: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	FormatULID:   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+}
+
+func newGenerator(t *testing.T, format string, c clock.Clock) IDGenerator {
+	t.Helper()
+	g, err := New(format, c)
+	if err != nil {
+		t.Fatalf("new %s generator: %v", format, err)
+	}
+	return g
+}
+
+func TestNew_Formats(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			g := newGenerator(t, format, nil)
+			for range 1000 {
+				if id := g.NewID(); !formatPatterns[format].MatchString(id) {
+					t.Fatalf("expected a %s, got %q", format, id)
+				}
+			}
+		})
+	}
+
+	if g := newGenerator(t, "", nil); g != Hex {
+		t.Errorf("expected hex when no format is set, got %T", g)
+	}
+	if _, err := New("snowflake", nil); err == nil {
+		t.Error("expected an unknown format refused")
+	}
+}
+
+func TestNew_Timestamps(t *testing.T) {
+	at := time.UnixMilli(1760000000123)
+	fake := clock.NewFake(at)
+
+	uuid := newGenerator(t, FormatUUIDv7, fake).NewID()
+	hexMillis := uuid[:8] + uuid[9:13]
+	if ms, _ := strconv.ParseUint(hexMillis, 16, 64); ms != uint64(at.UnixMilli()) {
+		t.Errorf("expected the uuidv7 to start with %d, got %d", at.UnixMilli(), ms)
+	}
+
+	// The first 10 characters of a ULID are its timestamp
+	ulid := newGenerator(t, FormatULID, fake).NewID()
+	var ms uint64
+	for _, c := range ulid[:10] {
+		ms = ms<<5 | uint64(slices.Index([]byte(crockford), byte(c)))
+	}
+	if ms != uint64(at.UnixMilli()) {
+		t.Errorf("expected the ulid to start with %d, got %d", at.UnixMilli(), ms)
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	var full [16]byte
+	for i := range full {
+		full[i] = 0xff
+	}
+	tests := map[string][16]byte{
+		"00000000000000000000000000": {},
+		"7ZZZZZZZZZZZZZZZZZZZZZZZZZ": full,
+		"0000000000000000000000000Z": {15: 31},
+		"00000000000000000000000010": {15: 32},
+	}
+	for want, b := range tests {
+		if got := encodeULID(b); got != want {
+			t.Errorf("expected %x encoded as %s, got %s", b, want, got)
+		}
+	}
+}
+
+func TestNew_Monotonic(t *testing.T) {
+	for _, format := range []string{FormatUUIDv7, FormatULID} {
+		t.Run(format, func(t *testing.T) {
+			fake := clock.NewFake(time.UnixMilli(1760000000000))
+			g := newGenerator(t, format, fake)
+
+			var ids []string
+			// Many within a millisecond, enough to run out of the UUIDv7
+			// counter, then a clock stepping back
+			for range 5000 {
+				ids = append(ids, g.NewID())
+			}
+			fake.Advance(time.Millisecond)
+			ids = append(ids, g.NewID())
+			fake.Set(fake.Now().Add(-time.Second))
+			for range 10 {
+				ids = append(ids, g.NewID())
+			}
+
+			for i := 1; i < len(ids); i++ {
+				if ids[i] <= ids[i-1] {
+					t.Fatalf("expected id %d %s after %s", i, ids[i], ids[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestNew_ULIDOverflow(t *testing.T) {
+	fake := clock.NewFake(time.UnixMilli(1760000000000))
+	g := &ulidGenerator{clock: fake}
+	before := g.NewID()
+	for i := 6; i < 16; i++ {
+		g.last[i] = 0xff
+	}
+	full := encodeULID(g.last)
+
+	after := g.NewID()
+	if after <= full || after[:10] == before[:10] {
+		t.Errorf("expected the timestamp moved on after %s, got %s", full, after)
+	}
+}
+
+func TestNew_UniqueUnderConcurrency(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			g := newGenerator(t, format, nil)
+			const workers, perWorker = 8, 2000
+
+			ids := make([][]string, workers)
+			var wg sync.WaitGroup
+			for w := range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range perWorker {
+						ids[w] = append(ids[w], g.NewID())
+					}
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, workers*perWorker)
+			for _, batch := range ids {
+				for _, id := range batch {
+					if seen[id] {
+						t.Fatalf("expected unique ids, got %s twice", id)
+					}
+					seen[id] = true
+				}
+			}
+		})
+	}
+}
+
+func TestPrefixed(t *testing.T) {
+	for _, format := range Formats {
+		g := Prefixed("sess_", newGenerator(t, format, nil))
+		id := g.NewID()
+		if len(id) < 5 || id[:5] != "sess_" || !formatPatterns[format].MatchString(id[5:]) {
+			t.Errorf("expected sess_ and a %s, got %q", format, id)
+		}
+	}
+	if id := Prefixed("sess_", nil).NewID(); !formatPatterns[FormatHex].MatchString(id[5:]) {
+		t.Errorf("expected hex without a generator, got %q", id)
+	}
+}
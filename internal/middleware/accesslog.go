@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+// accessLogEntry is what the access log records about one request
+type accessLogEntry struct {
+	time       time.Time // when the request was received
+	method     string
+	path       string
+	requestURI string // as sent by the client, query included
+	proto      string
+	route      string
+	status     int
+	bytes      int
+	duration   time.Duration
+	remoteAddr string // anonymized
+	referer    string
+	userAgent  string
+	requestID  string
+
+	compressed   bool
+	uncompressed int
+	sampled      bool
+	panicValue   any // nil unless the request panicked
+}
+
+// fields returns the entry as the key-value pairs of a structured log entry
+func (e *accessLogEntry) fields() []any {
+	fields := []any{
+		"method", e.method,
+		"path", e.path,
+		"route", e.route,
+		"status", e.status,
+		"bytes", e.bytes,
+		"duration_ms", float64(e.duration.Microseconds()) / 1000,
+		"remote_addr", e.remoteAddr,
+		"user_agent", e.userAgent,
+		"request_id", e.requestID,
+	}
+	if e.compressed {
+		fields = append(fields, "uncompressed_bytes", e.uncompressed)
+	}
+	if e.sampled {
+		fields = append(fields, "sampled", true)
+	}
+	if e.panicValue != nil {
+		fields = append(fields, "panic", true, "panic_value", fmt.Sprint(e.panicValue))
+	}
+	return fields
+}
+
+// accessLogFormatter appends one entry to buf as a line ending in a newline
+type accessLogFormatter func(buf *bytes.Buffer, e *accessLogEntry)
+
+// accessLogFormatters are the formatters by config.HTTPLogConfig.Format;
+// supporting another format takes only another entry here and in the
+// config's list of accepted formats
+var accessLogFormatters = map[string]accessLogFormatter{
+	config.AccessLogJSON: slogFormatter(func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, nil) }),
+	config.AccessLogText: slogFormatter(func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, nil) }),
+	config.AccessLogCLF: func(buf *bytes.Buffer, e *accessLogEntry) {
+		formatCommon(buf, e)
+		buf.WriteByte('\n')
+	},
+	config.AccessLogCombined: func(buf *bytes.Buffer, e *accessLogEntry) {
+		formatCommon(buf, e)
+		buf.WriteString(` "`)
+		writeCLFValue(buf, e.referer)
+		buf.WriteString(`" "`)
+		writeCLFValue(buf, e.userAgent)
+		buf.WriteString("\"\n")
+	},
+}
+
+// slogFormatter formats entries as the application log would, with the
+// handler newHandler returns
+func slogFormatter(newHandler func(w io.Writer) slog.Handler) accessLogFormatter {
+	return func(buf *bytes.Buffer, e *accessLogEntry) {
+		record := slog.NewRecord(e.time, slog.LevelInfo, "http request", 0)
+		record.Add(e.fields()...)
+		newHandler(buf).Handle(context.Background(), record)
+	}
+}
+
+// clfTimeFormat is the timestamp layout of the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// formatCommon appends the Common Log Format fields of an entry: remote host,
+// identity and user, both always "-", time, request line, status and size
+func formatCommon(buf *bytes.Buffer, e *accessLogEntry) {
+	buf.WriteString(e.remoteAddr)
+	buf.WriteString(" - - [")
+	buf.WriteString(e.time.Format(clfTimeFormat))
+	buf.WriteString(`] "`)
+	writeCLFValue(buf, e.method+" "+e.requestURI+" "+e.proto)
+	buf.WriteString(`" `)
+	buf.WriteString(strconv.Itoa(e.status))
+	buf.WriteByte(' ')
+	if e.bytes == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString(strconv.Itoa(e.bytes))
+	}
+}
+
+// writeCLFValue appends a quoted field's value, "-" when it is empty. Quotes
+// and backslashes are escaped with a backslash, control characters and
+// invalid UTF-8 as \xhh, as Apache does, so a value can't end the field or
+// the line.
+func writeCLFValue(buf *bytes.Buffer, value string) {
+	if value == "" {
+		buf.WriteByte('-')
+		return
+	}
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError && size == 1:
+			fmt.Fprintf(buf, `\x%02x`, value[i])
+		default:
+			buf.WriteString(value[i : i+size])
+		}
+		i += size
+	}
+}
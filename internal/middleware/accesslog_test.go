@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+func TestAccessLogFormatters(t *testing.T) {
+	received := time.Date(2024, 5, 1, 10, 0, 0, 250_000_000, time.FixedZone("", -7*60*60))
+	entry := func(modify func(e *accessLogEntry)) *accessLogEntry {
+		e := &accessLogEntry{
+			time:       received,
+			method:     http.MethodGet,
+			path:       "/v1/registry/services",
+			requestURI: "/v1/registry/services?limit=10",
+			proto:      "HTTP/1.1",
+			route:      "/v1/registry/services",
+			status:     http.StatusOK,
+			bytes:      2326,
+			duration:   1500 * time.Microsecond,
+			remoteAddr: "192.0.2.0",
+			referer:    "https://console.example.com/",
+			userAgent:  "curl/8.5.0",
+			requestID:  "req-1",
+		}
+		if modify != nil {
+			modify(e)
+		}
+		return e
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		entry  *accessLogEntry
+		want   string
+	}{
+		{
+			name: "json", format: config.AccessLogJSON, entry: entry(nil),
+			want: `{"time":"2024-05-01T10:00:00.25-07:00","level":"INFO","msg":"http request","method":"GET","path":"/v1/registry/services","route":"/v1/registry/services","status":200,"bytes":2326,"duration_ms":1.5,"remote_addr":"192.0.2.0","user_agent":"curl/8.5.0","request_id":"req-1"}`,
+		},
+		{
+			name: "text", format: config.AccessLogText, entry: entry(func(e *accessLogEntry) { e.sampled = true }),
+			want: `time=2024-05-01T10:00:00.250-07:00 level=INFO msg="http request" method=GET path=/v1/registry/services route=/v1/registry/services status=200 bytes=2326 duration_ms=1.5 remote_addr=192.0.2.0 user_agent=curl/8.5.0 request_id=req-1 sampled=true`,
+		},
+		{
+			name: "clf", format: config.AccessLogCLF, entry: entry(nil),
+			want: `192.0.2.0 - - [01/May/2024:10:00:00 -0700] "GET /v1/registry/services?limit=10 HTTP/1.1" 200 2326`,
+		},
+		{
+			name: "clf without body", format: config.AccessLogCLF,
+			entry: entry(func(e *accessLogEntry) { e.method, e.status, e.bytes = http.MethodDelete, http.StatusNoContent, 0 }),
+			want:  `192.0.2.0 - - [01/May/2024:10:00:00 -0700] "DELETE /v1/registry/services?limit=10 HTTP/1.1" 204 -`,
+		},
+		{
+			name: "combined", format: config.AccessLogCombined, entry: entry(nil),
+			want: `192.0.2.0 - - [01/May/2024:10:00:00 -0700] "GET /v1/registry/services?limit=10 HTTP/1.1" 200 2326 "https://console.example.com/" "curl/8.5.0"`,
+		},
+		{
+			name: "combined ipv6 without user agent", format: config.AccessLogCombined,
+			entry: entry(func(e *accessLogEntry) { e.remoteAddr, e.referer, e.userAgent = "2001:db8:1::", "", "" }),
+			want:  `2001:db8:1:: - - [01/May/2024:10:00:00 -0700] "GET /v1/registry/services?limit=10 HTTP/1.1" 200 2326 "-" "-"`,
+		},
+		{
+			name: "combined escapes", format: config.AccessLogCombined,
+			entry: entry(func(e *accessLogEntry) { e.requestURI, e.userAgent = `/a"b\c`, "evil\"\n agent\xff" }),
+			want:  `192.0.2.0 - - [01/May/2024:10:00:00 -0700] "GET /a\"b\\c HTTP/1.1" 200 2326 "https://console.example.com/" "evil\"\x0a agent\xff"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			accessLogFormatters[tt.format](&buf, tt.entry)
+			if got := buf.String(); got != tt.want+"\n" {
+				t.Errorf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLogger_Output(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		remoteAddr string
+		userAgent  string
+		want       string // line without its timestamp
+	}{
+		{
+			name: "combined ipv6", format: config.AccessLogCombined, remoteAddr: "[2001:db8:1:2::5]:51234", userAgent: "curl/8.5.0",
+			want: `2001:db8:1:: - - [] "GET /session/sess-1?full=1 HTTP/1.1" 404 - "-" "curl/8.5.0"`,
+		},
+		{
+			name: "clf", format: config.AccessLogCLF, remoteAddr: "192.0.2.33:51234",
+			want: `192.0.2.0 - - [] "GET /session/sess-1?full=1 HTTP/1.1" 404 -`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &testLogger{}
+			var out bytes.Buffer
+			h := Logger(log, config.HTTPLogConfig{Format: tt.format}, &out)(statusHandler(http.StatusNotFound))
+
+			req := httptest.NewRequest(http.MethodGet, "/session/sess-1?full=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.userAgent != "" {
+				req.Header.Set("User-Agent", tt.userAgent)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			line := out.String()
+			start, end := strings.Index(line, "["), strings.Index(line, "]")
+			if start < 0 || end < start {
+				t.Fatalf("expected a timestamp, got %q", line)
+			}
+			if got := line[:start+1] + line[end:]; got != tt.want+"\n" {
+				t.Errorf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+			if log.count() != 0 {
+				t.Errorf("expected nothing in the application log, got %d entries", log.count())
+			}
+		})
+	}
+}
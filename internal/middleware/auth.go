@@ -1 +1,105 @@
 package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/server"
+)
+
+// Authenticator validates bearer credentials
+type Authenticator interface {
+	ValidateToken(ctx context.Context, tokenString string) (*token.Claims, error)
+	ValidateAPIKey(ctx context.Context, key string) (*token.Claims, error)
+}
+
+// Authenticate requires a Bearer credential and stores the caller's claims in the context.
+// Credentials carrying the API key prefix are checked as API keys, everything else as a JWT.
+func Authenticate(auth Authenticator) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential, ok := bearerToken(r)
+			if !ok {
+				writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "missing bearer token")
+				return
+			}
+
+			claims, err := ValidateCredential(r.Context(), auth, credential)
+			if err != nil {
+				writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// AuthenticateCookie is Authenticate for browser pages: it reads the
+// credential from the named cookie and redirects to login when it is missing
+// or invalid, instead of answering 401
+func AuthenticateCookie(auth Authenticator, name, login string) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(name)
+			if err != nil || cookie.Value == "" {
+				http.Redirect(w, r, login, http.StatusSeeOther)
+				return
+			}
+
+			claims, err := ValidateCredential(r.Context(), auth, cookie.Value)
+			if err != nil {
+				http.Redirect(w, r, login, http.StatusSeeOther)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// ValidateCredential checks credential as an API key when it carries the API
+// key prefix and as a JWT otherwise, returning the caller's claims
+func ValidateCredential(ctx context.Context, auth Authenticator, credential string) (*token.Claims, error) {
+	if apikey.IsAPIKey(credential) {
+		return auth.ValidateAPIKey(ctx, credential)
+	}
+	return auth.ValidateToken(ctx, credential)
+}
+
+// RequireRole allows the request through if the caller has any of the given roles.
+// It must run after Authenticate.
+func RequireRole(roles ...string) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+				return
+			}
+
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			writeError(w, r, http.StatusForbidden, "FORBIDDEN", "insufficient role")
+		})
+	}
+}
+
+// bearerToken extracts the credential from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, credential, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	credential = strings.TrimSpace(credential)
+	return credential, credential != ""
+}
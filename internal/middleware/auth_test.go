@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/server"
+)
+
+// stubAuthenticator accepts fixed credentials
+type stubAuthenticator struct {
+	tokens map[string]*token.Claims
+	keys   map[string]*token.Claims
+}
+
+func (s *stubAuthenticator) ValidateToken(ctx context.Context, tokenString string) (*token.Claims, error) {
+	if claims, ok := s.tokens[tokenString]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func (s *stubAuthenticator) ValidateAPIKey(ctx context.Context, key string) (*token.Claims, error) {
+	if claims, ok := s.keys[key]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid api key")
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth := &stubAuthenticator{
+		tokens: map[string]*token.Claims{"jwt-user": {Subject: "user-1", Roles: []string{"user"}}},
+		keys:   map[string]*token.Claims{"rk_admin": {Subject: "apikey:ops", Roles: []string{"admin"}}},
+	}
+
+	tests := []struct {
+		name        string
+		header      string
+		roles       []string
+		wantStatus  int
+		wantSubject string
+	}{
+		{name: "missing header", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic jwt-user", wantStatus: http.StatusUnauthorized},
+		{name: "valid jwt", header: "Bearer jwt-user", wantStatus: http.StatusOK, wantSubject: "user-1"},
+		{name: "invalid jwt", header: "Bearer jwt-other", wantStatus: http.StatusUnauthorized},
+		{name: "api key detected by prefix", header: "Bearer rk_admin", wantStatus: http.StatusOK, wantSubject: "apikey:ops"},
+		{name: "jwt is not checked as api key", header: "Bearer admin", wantStatus: http.StatusUnauthorized},
+		{name: "api key roles satisfy RequireRole", header: "Bearer rk_admin", roles: []string{"admin"}, wantStatus: http.StatusOK, wantSubject: "apikey:ops"},
+		{name: "missing role is forbidden", header: "Bearer jwt-user", roles: []string{"admin"}, wantStatus: http.StatusForbidden},
+		{name: "any listed role is enough", header: "Bearer jwt-user", roles: []string{"admin", "user"}, wantStatus: http.StatusOK, wantSubject: "user-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var subject string
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := ClaimsFromContext(r.Context())
+				subject = claims.Subject
+			})
+			if tt.roles != nil {
+				h = RequireRole(tt.roles...)(h)
+			}
+			h = Authenticate(auth)(h)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("expected subject %q, got %q", tt.wantSubject, subject)
+			}
+		})
+	}
+}
+
+func TestAuthenticateCookie(t *testing.T) {
+	auth := &stubAuthenticator{
+		tokens: map[string]*token.Claims{"jwt-user": {Subject: "user-1"}},
+		keys:   map[string]*token.Claims{"rk_admin": {Subject: "apikey:ops"}},
+	}
+
+	tests := []struct {
+		name        string
+		cookie      *http.Cookie
+		wantStatus  int
+		wantSubject string
+	}{
+		{name: "missing cookie", wantStatus: http.StatusSeeOther},
+		{name: "empty cookie", cookie: &http.Cookie{Name: "ui_token"}, wantStatus: http.StatusSeeOther},
+		{name: "other cookie", cookie: &http.Cookie{Name: "other", Value: "jwt-user"}, wantStatus: http.StatusSeeOther},
+		{name: "valid jwt", cookie: &http.Cookie{Name: "ui_token", Value: "jwt-user"}, wantStatus: http.StatusOK, wantSubject: "user-1"},
+		{name: "valid api key", cookie: &http.Cookie{Name: "ui_token", Value: "rk_admin"}, wantStatus: http.StatusOK, wantSubject: "apikey:ops"},
+		{name: "invalid", cookie: &http.Cookie{Name: "ui_token", Value: "jwt-other"}, wantStatus: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var subject string
+			h := AuthenticateCookie(auth, "ui_token", "/ui/login")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := ClaimsFromContext(r.Context())
+				subject = claims.Subject
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/ui/", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus == http.StatusSeeOther && rec.Header().Get("Location") != "/ui/login" {
+				t.Errorf("expected a redirect to the login page, got %q", rec.Header().Get("Location"))
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("expected subject %q, got %q", tt.wantSubject, subject)
+			}
+		})
+	}
+}
+
+func TestRequireRole_WithoutAuthenticate(t *testing.T) {
+	h := RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestAuthenticate_Group(t *testing.T) {
+	auth := &stubAuthenticator{tokens: map[string]*token.Claims{"jwt-user": {Subject: "user-1", Roles: []string{"user"}}}}
+	srv, err := server.New(server.Config{})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	api := srv.Group("/v1")
+	authenticated := api.Group("", Authenticate(auth))
+	admin := authenticated.Group("/admin", RequireRole("admin"))
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	api.GET("/public", ok)
+	authenticated.GET("/items/", ok)
+	admin.POST("/reset", ok)
+
+	tests := []struct {
+		method     string
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{http.MethodGet, "/v1/public", "", http.StatusOK},
+		{http.MethodGet, "/v1/items/abc", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/items/abc", "Bearer jwt-user", http.StatusOK},
+		{http.MethodPost, "/v1/admin/reset", "", http.StatusUnauthorized},
+		{http.MethodPost, "/v1/admin/reset", "Bearer jwt-user", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path+" "+tt.header, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
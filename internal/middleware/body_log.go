@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// defaultMaxBodyBytes is how much of each body is logged when
+// log.http.max_body_bytes is unset
+const defaultMaxBodyBytes = 4096
+
+// BodyLog logs the start of the request and response bodies of requests
+// answered with 4xx at debug level, to see what a client sent that was
+// refused. It is enabled by cfg.HTTP.LogBodies with cfg.Level debug and
+// otherwise returns the handler it wraps untouched.
+//
+// Only JSON and URL-encoded form bodies are logged, up to
+// cfg.HTTP.MaxBodyBytes of each with a flag telling whether there was more.
+// The request body is copied as the handler reads it, so the handler still
+// reads all of it and a body it left unread is not logged. Routes registered
+// with server.Sensitive, which carry credentials, are never logged.
+func BodyLog(log logger.ILogger, cfg config.LogConfig) server.Middleware {
+	maxBytes := cfg.HTTP.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+
+	return func(next http.Handler) http.Handler {
+		if !cfg.HTTP.LogBodies || !strings.EqualFold(cfg.Level, "debug") {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if server.SensitiveRouteFromContext(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var request *bodyCapture
+			contentType := r.Header.Get("Content-Type")
+			if r.Body != nil && r.Body != http.NoBody && loggableBody(contentType) {
+				request = &bodyCapture{max: maxBytes}
+				r.Body = teeBody{Reader: io.TeeReader(r.Body, request), Closer: r.Body}
+			}
+			bw := &bodyLogWriter{ResponseWriter: w, max: maxBytes}
+
+			next.ServeHTTP(bw, r)
+
+			if bw.status < http.StatusBadRequest || bw.status >= http.StatusInternalServerError {
+				return
+			}
+			if request == nil && bw.capture == nil {
+				return
+			}
+			fields := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", server.RoutePatternFromContext(r.Context()),
+				"status", bw.status,
+				"request_id", RequestIDFromContext(r.Context()),
+			}
+			if request != nil {
+				fields = append(fields, "content_type", contentType, "body", string(request.buf), "truncated", request.truncated)
+			}
+			if bw.capture != nil {
+				fields = append(fields,
+					"response_content_type", bw.Header().Get("Content-Type"),
+					"response_body", string(bw.capture.buf),
+					"response_truncated", bw.capture.truncated)
+			}
+			log.Debug("http request body", fields...)
+		})
+	}
+}
+
+// loggableBody reports whether bodies of contentType are logged: JSON and
+// URL-encoded forms, which read as text in a log line
+func loggableBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// bodyCapture keeps the first max bytes written to it and whether more followed
+type bodyCapture struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := c.max - len(c.buf); n > room {
+		c.truncated = true
+		p = p[:room]
+	}
+	c.buf = append(c.buf, p...)
+	return n, nil
+}
+
+// teeBody is a request body copied to a bodyCapture as it is read
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyLogWriter records the response status and, for 4xx responses with a
+// loggable content type, the start of the body
+type bodyLogWriter struct {
+	http.ResponseWriter
+	max     int
+	status  int
+	capture *bodyCapture // nil unless the response body is logged
+}
+
+func (w *bodyLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		if status >= http.StatusBadRequest && status < http.StatusInternalServerError && loggableBody(w.Header().Get("Content-Type")) {
+			w.capture = &bodyCapture{max: w.max}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	if w.capture != nil {
+		w.capture.Write(b[:n])
+	}
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *bodyLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
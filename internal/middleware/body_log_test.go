@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+)
+
+// debugBodies is a logging configuration with body logging on
+var debugBodies = config.LogConfig{Level: "debug", HTTP: config.HTTPLogConfig{LogBodies: true, MaxBodyBytes: 16}}
+
+// rejectBody reads the whole request body and answers 400 with a JSON error,
+// failing t unless the handler read want
+func rejectBody(t *testing.T, want string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		if string(body) != want {
+			t.Errorf("expected the handler to read %q, got %q", want, body)
+		}
+		writeError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "name is required")
+	}
+}
+
+func postJSON(h http.Handler, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBodyLog_ClientErrors(t *testing.T) {
+	log := &testLogger{}
+	h := BodyLog(log, debugBodies)(rejectBody(t, `{"name":""}`))
+
+	rec := postJSON(h, "/registry/register", `{"name":""}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "name is required") {
+		t.Fatalf("expected the handler's response untouched, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	entries := log.all()
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %d", len(entries))
+	}
+	e := entries[0]
+	want := map[string]any{
+		"level":                 "debug",
+		"status":                http.StatusBadRequest,
+		"content_type":          "application/json; charset=utf-8",
+		"body":                  `{"name":""}`,
+		"truncated":             false,
+		"response_content_type": "application/json",
+		"response_body":         `{"error":"name i`,
+		"response_truncated":    true,
+	}
+	e.fields["level"] = e.level
+	for key, value := range want {
+		if e.fields[key] != value {
+			t.Errorf("expected %s %v, got %v", key, value, e.fields[key])
+		}
+	}
+}
+
+func TestBodyLog_Truncation(t *testing.T) {
+	log := &testLogger{}
+	body := `{"name":"payment","capabilities":["payment"]}`
+	h := BodyLog(log, debugBodies)(rejectBody(t, body))
+
+	postJSON(h, "/registry/register", body)
+
+	e := log.all()[0]
+	if e.fields["body"] != body[:16] || e.fields["truncated"] != true {
+		t.Errorf("expected the first 16 bytes, truncated, got %q truncated %v", e.fields["body"], e.fields["truncated"])
+	}
+}
+
+func TestBodyLog_Skipped(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+	}{
+		{name: "success", status: http.StatusOK, contentType: "application/json"},
+		{name: "server error", status: http.StatusInternalServerError, contentType: "application/json"},
+		{name: "binary body", status: http.StatusBadRequest, contentType: "application/octet-stream"},
+		{name: "multipart form", status: http.StatusBadRequest, contentType: "multipart/form-data; boundary=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &testLogger{}
+			h := BodyLog(log, debugBodies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte("body"))
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader("body"))
+			req.Header.Set("Content-Type", tt.contentType)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if n := log.count(); n != 0 {
+				t.Errorf("expected nothing logged, got %v", log.all())
+			}
+		})
+	}
+}
+
+func TestBodyLog_SensitiveRoutes(t *testing.T) {
+	log := &testLogger{}
+	srv, err := server.New(server.Config{Middlewares: []server.Middleware{BodyLog(log, debugBodies)}})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.POST("/auth/refresh", rejectBody(t, `{"refresh_token":"secret"}`).ServeHTTP, server.Sensitive())
+	srv.POST("/auth/apikeys", rejectBody(t, `{"name":""}`).ServeHTTP)
+
+	postJSON(srv.Handler(), "/auth/refresh", `{"refresh_token":"secret"}`)
+	if n := log.count(); n != 0 {
+		t.Fatalf("expected nothing logged for a sensitive route, got %v", log.all())
+	}
+
+	postJSON(srv.Handler(), "/auth/apikeys", `{"name":""}`)
+	if n := log.count(); n != 1 {
+		t.Fatalf("expected the other route logged, got %d entries", n)
+	}
+	if route := log.all()[0].fields["route"]; route != "/auth/apikeys" {
+		t.Errorf("expected route /auth/apikeys, got %v", route)
+	}
+}
+
+func TestBodyLog_Disabled(t *testing.T) {
+	for name, cfg := range map[string]config.LogConfig{
+		"log_bodies off": {Level: "debug"},
+		"info level":     {Level: "info", HTTP: config.HTTPLogConfig{LogBodies: true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/registry/register", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			body := req.Body
+
+			log := &testLogger{}
+			h := BodyLog(log, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The handler gets the request and writer as they came
+				if r != req || r.Body != body || w != rec {
+					t.Error("expected the request and writer passed through untouched")
+				}
+				w.WriteHeader(http.StatusBadRequest)
+			}))
+			h.ServeHTTP(rec, req)
+
+			if n := log.count(); n != 0 {
+				t.Errorf("expected nothing logged, got %v", log.all())
+			}
+		})
+	}
+}
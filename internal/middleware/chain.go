@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// ErrInvalidChain is returned by Chain.Build when middleware is missing,
+// duplicated or registered out of order
+var ErrInvalidChain = errors.New("invalid middleware chain")
+
+// Stage is a named position in the global middleware chain. Stages run in
+// the order they are declared, outermost first.
+type Stage int
+
+const (
+	// Identity establishes who and what the request is: request ID, client certificate
+	Identity Stage = iota
+	// Observability records the request: tracing, access logs, and the
+	// compression whose sizes the access log reports
+	Observability
+	// Protection keeps failures and policy violations from reaching clients raw: security headers, recovery, CORS
+	Protection
+	// Custom holds application specific middleware, closest to the routes
+	Custom
+)
+
+// requiredStages must each hold at least one middleware
+var requiredStages = []Stage{Identity, Observability, Protection}
+
+func (s Stage) String() string {
+	switch s {
+	case Identity:
+		return "identity"
+	case Observability:
+		return "observability"
+	case Protection:
+		return "protection"
+	case Custom:
+		return "custom"
+	default:
+		return fmt.Sprintf("stage(%d)", int(s))
+	}
+}
+
+// chainEntry is a named middleware registered in a stage
+type chainEntry struct {
+	stage Stage
+	name  string
+	mw    server.Middleware
+}
+
+// Chain builds the global middleware chain from named middleware grouped in
+// stages. Middleware is added in the order it should run, stage by stage;
+// InsertBefore and InsertAfter place custom middleware next to a named one.
+// Mistakes are collected and reported together by Build.
+type Chain struct {
+	entries []chainEntry
+	errs    []error
+}
+
+// NewChain creates an empty chain
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// Use appends mw to stage under name. A stage may not be used again once a
+// later stage was, so each stage forms one contiguous block.
+func (c *Chain) Use(stage Stage, name string, mw server.Middleware) *Chain {
+	if stage < Identity || stage > Custom {
+		c.errs = append(c.errs, fmt.Errorf("%w: middleware %q registered in unknown %s", ErrInvalidChain, name, stage))
+		return c
+	}
+	if n := len(c.entries); n > 0 && c.entries[n-1].stage > stage {
+		last := c.entries[n-1]
+		c.errs = append(c.errs, fmt.Errorf("%w: %s middleware %q registered after %s middleware %q", ErrInvalidChain, stage, name, last.stage, last.name))
+		return c
+	}
+	return c.insert(len(c.entries), chainEntry{stage: stage, name: name, mw: mw})
+}
+
+// InsertBefore places mw under name directly outside the middleware named
+// anchor, in the anchor's stage
+func (c *Chain) InsertBefore(anchor, name string, mw server.Middleware) *Chain {
+	i := c.index(anchor)
+	if i < 0 {
+		c.errs = append(c.errs, fmt.Errorf("%w: cannot insert %q before unknown middleware %q", ErrInvalidChain, name, anchor))
+		return c
+	}
+	return c.insert(i, chainEntry{stage: c.entries[i].stage, name: name, mw: mw})
+}
+
+// InsertAfter places mw under name directly inside the middleware named
+// anchor, in the anchor's stage
+func (c *Chain) InsertAfter(anchor, name string, mw server.Middleware) *Chain {
+	i := c.index(anchor)
+	if i < 0 {
+		c.errs = append(c.errs, fmt.Errorf("%w: cannot insert %q after unknown middleware %q", ErrInvalidChain, name, anchor))
+		return c
+	}
+	return c.insert(i+1, chainEntry{stage: c.entries[i].stage, name: name, mw: mw})
+}
+
+// Names returns the registered middleware names, outermost first
+func (c *Chain) Names() []string {
+	names := make([]string, len(c.entries))
+	for i, e := range c.entries {
+		names[i] = e.name
+	}
+	return names
+}
+
+// Build returns the middleware in the order they should wrap the server,
+// outermost first, for server.Config.Middlewares. It fails when any
+// registration was rejected or a required stage is empty.
+func (c *Chain) Build() ([]server.Middleware, error) {
+	errs := slices.Clone(c.errs)
+	for _, stage := range requiredStages {
+		if !slices.ContainsFunc(c.entries, func(e chainEntry) bool { return e.stage == stage }) {
+			errs = append(errs, fmt.Errorf("%w: no %s middleware registered", ErrInvalidChain, stage))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	middlewares := make([]server.Middleware, len(c.entries))
+	for i, e := range c.entries {
+		middlewares[i] = e.mw
+	}
+	return middlewares, nil
+}
+
+// insert adds e at position i unless its name is taken
+func (c *Chain) insert(i int, e chainEntry) *Chain {
+	if e.name == "" {
+		c.errs = append(c.errs, fmt.Errorf("%w: %s middleware registered without a name", ErrInvalidChain, e.stage))
+		return c
+	}
+	if c.index(e.name) >= 0 {
+		c.errs = append(c.errs, fmt.Errorf("%w: middleware %q registered twice", ErrInvalidChain, e.name))
+		return c
+	}
+	c.entries = slices.Insert(c.entries, i, e)
+	return c
+}
+
+// index returns the position of the middleware named name, or -1
+func (c *Chain) index(name string) int {
+	return slices.IndexFunc(c.entries, func(e chainEntry) bool { return e.name == name })
+}
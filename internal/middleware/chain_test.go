@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// tag returns a middleware appending name to the X-Chain request header, so
+// the order a request passed through the chain can be read back
+func tag(name string) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// baseChain returns a valid chain with one middleware per required stage
+func baseChain() *Chain {
+	return NewChain().
+		Use(Identity, "request_id", tag("request_id")).
+		Use(Observability, "logger", tag("logger")).
+		Use(Protection, "recovery", tag("recovery"))
+}
+
+func TestChain_Build(t *testing.T) {
+	tests := []struct {
+		name      string
+		chain     func() *Chain
+		wantOrder []string
+		wantErr   string // substring of the error, empty when the chain is valid
+	}{
+		{
+			name:      "canonical order",
+			chain:     baseChain,
+			wantOrder: []string{"request_id", "logger", "recovery"},
+		},
+		{
+			name: "several per stage and custom",
+			chain: func() *Chain {
+				return baseChain().Use(Protection, "cors", tag("cors")).Use(Custom, "audit", tag("audit"))
+			},
+			wantOrder: []string{"request_id", "logger", "recovery", "cors", "audit"},
+		},
+		{
+			name: "insert before",
+			chain: func() *Chain {
+				return baseChain().InsertBefore("recovery", "metrics", tag("metrics"))
+			},
+			wantOrder: []string{"request_id", "logger", "metrics", "recovery"},
+		},
+		{
+			name: "insert after",
+			chain: func() *Chain {
+				return baseChain().InsertAfter("request_id", "client_certificate", tag("client_certificate"))
+			},
+			wantOrder: []string{"request_id", "client_certificate", "logger", "recovery"},
+		},
+		{
+			name: "insert keeps later registrations in order",
+			chain: func() *Chain {
+				return NewChain().
+					Use(Identity, "request_id", tag("request_id")).
+					Use(Observability, "logger", tag("logger")).
+					InsertAfter("logger", "metrics", tag("metrics")).
+					Use(Protection, "recovery", tag("recovery"))
+			},
+			wantOrder: []string{"request_id", "logger", "metrics", "recovery"},
+		},
+		{
+			name: "earlier stage after a later one",
+			chain: func() *Chain {
+				return baseChain().Use(Identity, "tracing", tag("tracing"))
+			},
+			wantErr: `identity middleware "tracing" registered after protection middleware "recovery"`,
+		},
+		{
+			name: "duplicate name",
+			chain: func() *Chain {
+				return baseChain().Use(Protection, "recovery", tag("recovery"))
+			},
+			wantErr: `middleware "recovery" registered twice`,
+		},
+		{
+			name: "missing stage",
+			chain: func() *Chain {
+				return NewChain().Use(Identity, "request_id", tag("request_id")).Use(Protection, "recovery", tag("recovery"))
+			},
+			wantErr: "no observability middleware registered",
+		},
+		{
+			name: "unknown anchor",
+			chain: func() *Chain {
+				return baseChain().InsertBefore("rate_limit", "metrics", tag("metrics"))
+			},
+			wantErr: `cannot insert "metrics" before unknown middleware "rate_limit"`,
+		},
+		{
+			name: "unknown stage",
+			chain: func() *Chain {
+				return baseChain().Use(Stage(7), "audit", tag("audit"))
+			},
+			wantErr: "unknown stage(7)",
+		},
+		{
+			name: "unnamed",
+			chain: func() *Chain {
+				return baseChain().Use(Custom, "", tag("audit"))
+			},
+			wantErr: "custom middleware registered without a name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middlewares, err := tt.chain().Build()
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidChain) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected ErrInvalidChain mentioning %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			var got []string
+			h := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Values("X-Chain")
+			}))
+			for i := len(middlewares) - 1; i >= 0; i-- {
+				h = middlewares[i](h)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if !slices.Equal(got, tt.wantOrder) {
+				t.Errorf("expected order %v, got %v", tt.wantOrder, got)
+			}
+		})
+	}
+}
+
+func TestChain_BuildReportsEveryProblem(t *testing.T) {
+	_, err := NewChain().
+		Use(Protection, "recovery", tag("recovery")).
+		Use(Identity, "request_id", tag("request_id")).
+		Use(Protection, "recovery", tag("recovery")).
+		Build()
+
+	for _, want := range []string{"registered after", "registered twice", "no identity middleware", "no observability middleware"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got %v", want, err)
+		}
+	}
+}
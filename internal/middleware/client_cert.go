@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// ClientCertificate stores the common name of a verified TLS client
+// certificate in the request context. Certificates the server only requested
+// and did not verify are ignored.
+func ClientCertificate() server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				if cn := r.TLS.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+					r = r.WithContext(WithClientCN(r.Context(), cn))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
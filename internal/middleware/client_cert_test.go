@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "payment-service"}}
+
+	tests := []struct {
+		name   string
+		state  *tls.ConnectionState
+		wantCN string
+	}{
+		{name: "plain http"},
+		{name: "no client certificate", state: &tls.ConnectionState{}},
+		{name: "unverified certificate", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+		{
+			name: "verified certificate",
+			state: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			},
+			wantCN: "payment-service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotCN string
+			var gotOK bool
+			h := ClientCertificate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotCN, gotOK = ClientCNFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = tt.state
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotCN != tt.wantCN || gotOK != (tt.wantCN != "") {
+				t.Errorf("expected CN %q, got %q (ok %v)", tt.wantCN, gotCN, gotOK)
+			}
+		})
+	}
+}
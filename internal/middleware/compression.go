@@ -0,0 +1,243 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+)
+
+// defaultCompressionMinSize is the smallest response compressed when the
+// configuration leaves the threshold unset; gzip rarely pays off below it
+const defaultCompressionMinSize = 1024
+
+// incompressibleTypes are content types sent as they are: already compressed
+// formats, and event streams whose events must reach the client unbuffered
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+	"application/octet-stream",
+	"text/event-stream",
+}
+
+// gzipWriters recycles compressors between responses
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// compressionRecord is shared between Logger and Compression so the access
+// log entry of a compressed response can report its size before compression
+type compressionRecord struct {
+	compressed   bool
+	uncompressed int
+}
+
+// withCompressionRecord returns a copy of ctx carrying an empty compression record
+func withCompressionRecord(ctx context.Context) (context.Context, *compressionRecord) {
+	record := &compressionRecord{}
+	return context.WithValue(ctx, compressionKey, record), record
+}
+
+// compressWriter holds the response back until it is known to reach the
+// threshold, then sends it gzipped; smaller responses are sent as they are
+// when the handler returns. Flushing commits to the current choice, so
+// streamed responses aren't held back.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize int
+	record  *compressionRecord // nil when Logger isn't in the chain
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer // nil unless compressing
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = status
+	// Responses without a body have nothing to compress
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.passThrough()
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.record != nil {
+		cw.record.uncompressed += len(b)
+	}
+	if cw.decided {
+		if cw.gz != nil {
+			return cw.gz.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	if !cw.compressible() {
+		cw.passThrough()
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf.Write(b)
+	if cw.buf.Len() >= cw.minSize {
+		if err := cw.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends what was written so far, committing to compression only if
+// the threshold was already reached
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.passThrough()
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports whether the response may be compressed, judging by
+// the headers the handler set
+func (cw *compressWriter) compressible() bool {
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	for _, incompressible := range incompressibleTypes {
+		if strings.HasPrefix(contentType, incompressible) {
+			return false
+		}
+	}
+	return true
+}
+
+// startGzip sends the headers of a compressed response and the held back body
+func (cw *compressWriter) startGzip() error {
+	cw.decided = true
+	header := cw.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	header.Add("Vary", "Accept-Encoding")
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.gz = gzipWriters.Get().(*gzip.Writer)
+	cw.gz.Reset(cw.ResponseWriter)
+	if cw.record != nil {
+		cw.record.compressed = true
+	}
+	_, err := cw.gz.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// passThrough sends the headers and held back body uncompressed
+func (cw *compressWriter) passThrough() {
+	cw.decided = true
+	if cw.compressible() {
+		// Caches must not hand this uncompressed copy to clients accepting gzip
+		cw.Header().Add("Vary", "Accept-Encoding")
+	}
+	if cw.buf.Len() > 0 {
+		cw.Header().Set("Content-Length", strconv.Itoa(cw.buf.Len()))
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() > 0 {
+		cw.ResponseWriter.Write(cw.buf.Bytes())
+		cw.buf.Reset()
+	}
+}
+
+// close finishes the response once the handler returned
+func (cw *compressWriter) close() {
+	if cw.gz != nil {
+		cw.gz.Close()
+		gzipWriters.Put(cw.gz)
+		cw.gz = nil
+		return
+	}
+	if !cw.decided && cw.status != 0 {
+		cw.passThrough()
+	}
+}
+
+// Compression gzips responses of at least cfg.MinSize bytes (default 1 KiB)
+// for clients sending Accept-Encoding: gzip, setting Content-Encoding and
+// Vary. Responses that are already encoded, of an already compressed content
+// type or event streams are sent as they are. Placed inside Logger, the
+// access log reports the compressed size as bytes and the size before
+// compression as uncompressed_bytes. It is a no-op unless cfg.Enabled.
+func Compression(cfg config.CompressionConfig) server.Middleware {
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acceptsGzip(r) {
+				w.Header().Add("Vary", "Accept-Encoding")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			record, _ := r.Context().Value(compressionKey).(*compressionRecord)
+			cw := &compressWriter{ResponseWriter: w, minSize: minSize, record: record}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+)
+
+// writeBody returns a handler writing body with the given content type
+func writeBody(contentType, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		io.WriteString(w, body)
+	})
+}
+
+func gunzip(t *testing.T, body []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	return string(data)
+}
+
+func TestCompression(t *testing.T) {
+	large := `{"items":[` + strings.Repeat(`{"name":"payment","status":"healthy"},`, 100) + `{}]}`
+	small := `{"status":"ok"}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		handler        http.Handler
+		wantGzip       bool
+		wantBody       string
+	}{
+		{name: "large json", acceptEncoding: "gzip", handler: writeBody("application/json", large), wantGzip: true, wantBody: large},
+		{name: "among other codings", acceptEncoding: "br;q=1.0, gzip;q=0.8", handler: writeBody("application/json", large), wantGzip: true, wantBody: large},
+		{name: "below the threshold", acceptEncoding: "gzip", handler: writeBody("application/json", small), wantBody: small},
+		{name: "client without gzip", handler: writeBody("application/json", large), wantBody: large},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0", handler: writeBody("application/json", large), wantBody: large},
+		{name: "already compressed type", acceptEncoding: "gzip", handler: writeBody("image/png", large), wantBody: large},
+		{name: "event stream", acceptEncoding: "gzip", handler: writeBody("text/event-stream", large), wantBody: large},
+		{
+			name: "already encoded", acceptEncoding: "gzip", wantBody: large,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "identity")
+				io.WriteString(w, large)
+			}),
+		},
+		{
+			name: "many small writes", acceptEncoding: "gzip", wantGzip: true, wantBody: strings.Repeat("0123456789", 200),
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for range 200 {
+					io.WriteString(w, "0123456789")
+				}
+			}),
+		},
+	}
+
+	h := func(next http.Handler) http.Handler {
+		return Compression(config.CompressionConfig{Enabled: true})(next)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/registry/services", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h(tt.handler).ServeHTTP(rec, req)
+
+			gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("expected gzip %v, got Content-Encoding %q", tt.wantGzip, rec.Header().Get("Content-Encoding"))
+			}
+
+			body := rec.Body.String()
+			if gzipped {
+				if rec.Body.Len() >= len(tt.wantBody) {
+					t.Errorf("expected the body to shrink from %d bytes, got %d", len(tt.wantBody), rec.Body.Len())
+				}
+				if rec.Header().Get("Content-Length") != "" {
+					t.Error("expected no Content-Length on a compressed response")
+				}
+				body = gunzip(t, rec.Body.Bytes())
+			}
+			if body != tt.wantBody {
+				t.Errorf("expected the body to survive intact, got %d bytes", len(body))
+			}
+
+			if tt.wantGzip && !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Accept-Encoding") {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", rec.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCompression_Disabled(t *testing.T) {
+	body := strings.Repeat("a", 4096)
+	h := Compression(config.CompressionConfig{})(writeBody("text/plain", body))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+		t.Errorf("expected an untouched response, got Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompression_MinSize(t *testing.T) {
+	body := strings.Repeat("a", 200)
+	h := Compression(config.CompressionConfig{Enabled: true, MinSize: 100})(writeBody("text/plain", body))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" || gunzip(t, rec.Body.Bytes()) != body {
+		t.Errorf("expected a response above the configured threshold to be compressed")
+	}
+}
+
+func TestCompression_StatusAndEmptyBodies(t *testing.T) {
+	large := strings.Repeat("x", 2048)
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		wantStatus int
+		wantGzip   bool
+	}{
+		{name: "error status kept", handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, large)
+		}), wantStatus: http.StatusNotFound, wantGzip: true},
+		{name: "no content", handler: statusHandler(http.StatusNoContent), wantStatus: http.StatusNoContent},
+		{name: "empty body", handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			Compression(config.CompressionConfig{Enabled: true})(tt.handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.wantGzip {
+				t.Errorf("expected gzip %v, got %v", tt.wantGzip, gzipped)
+			}
+		})
+	}
+}
+
+func TestCompression_EventStreamsFlush(t *testing.T) {
+	events := make(chan server.Event, 1)
+	events <- server.Event{ID: "1", Type: "service.registered", Data: []byte(`{"id":"payment-1"}`)}
+	close(events)
+
+	h := Compression(config.CompressionConfig{Enabled: true, MinSize: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.ServeEvents(w, r, events, server.EventStreamConfig{})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/registry/watch", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected an event stream to be sent uncompressed, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if !rec.Flushed {
+		t.Error("expected flushes to reach the client")
+	}
+	if !strings.Contains(rec.Body.String(), "payment-1") {
+		t.Errorf("expected the event in the stream, got %q", rec.Body)
+	}
+}
+
+func TestCompression_LoggerCountsBytes(t *testing.T) {
+	log := &testLogger{}
+	body := strings.Repeat(`{"name":"payment"},`, 200)
+	h := Logger(log, config.HTTPLogConfig{SkipPaths: []string{}}, nil)(
+		Compression(config.CompressionConfig{Enabled: true})(writeBody("application/json", body)))
+
+	for _, acceptEncoding := range []string{"gzip", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/registry/services", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+	}
+
+	entries := log.all()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	compressed := entries[0].fields
+	if compressed["uncompressed_bytes"] != len(body) {
+		t.Errorf("expected uncompressed_bytes %d, got %v", len(body), compressed["uncompressed_bytes"])
+	}
+	if n, _ := compressed["bytes"].(int); n == 0 || n >= len(body) {
+		t.Errorf("expected bytes to count the compressed body, got %v", compressed["bytes"])
+	}
+
+	plain := entries[1].fields
+	if _, ok := plain["uncompressed_bytes"]; ok {
+		t.Error("expected no uncompressed_bytes on an uncompressed response")
+	}
+	if plain["bytes"] != len(body) {
+		t.Errorf("expected bytes %d, got %v", len(body), plain["bytes"])
+	}
+}
@@ -1 +1,69 @@
 package middleware
+
+import (
+	"context"
+
+	"github.com/aq189/bin/internal/domain/token"
+)
+
+// contextKey is the type for values stored in the request context by middleware
+type contextKey string
+
+const (
+	requestIDKey   contextKey = "request_id"
+	clientCNKey    contextKey = "client_cn"
+	panicKey       contextKey = "panic"
+	compressionKey contextKey = "compression"
+)
+
+// RequestIDFromContext returns the request ID stored by the RequestID middleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithRequestID returns a copy of ctx carrying the given request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// ClaimsFromContext returns the claims stored by the Authenticate middleware
+func ClaimsFromContext(ctx context.Context) (*token.Claims, bool) {
+	return token.FromContext(ctx)
+}
+
+// WithClaims returns a copy of ctx carrying the authenticated caller's claims
+func WithClaims(ctx context.Context, claims *token.Claims) context.Context {
+	return token.NewContext(ctx, claims)
+}
+
+// ClientCNFromContext returns the common name of the caller's verified TLS
+// client certificate, stored by the ClientCertificate middleware
+func ClientCNFromContext(ctx context.Context) (string, bool) {
+	cn, ok := ctx.Value(clientCNKey).(string)
+	return cn, ok
+}
+
+// WithClientCN returns a copy of ctx carrying a verified client certificate common name
+func WithClientCN(ctx context.Context, cn string) context.Context {
+	return context.WithValue(ctx, clientCNKey, cn)
+}
+
+// panicRecord is shared between Logger and Recovery so the access log entry
+// of a request whose panic was recovered further down the chain can report it
+type panicRecord struct {
+	value any
+}
+
+// withPanicRecord returns a copy of ctx carrying an empty panic record
+func withPanicRecord(ctx context.Context) (context.Context, *panicRecord) {
+	record := &panicRecord{}
+	return context.WithValue(ctx, panicKey, record), record
+}
+
+// recordPanic stores a recovered panic value in the request's panic record, if any
+func recordPanic(ctx context.Context, value any) {
+	if record, ok := ctx.Value(panicKey).(*panicRecord); ok {
+		record.value = value
+	}
+}
@@ -1 +1,160 @@
 package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+)
+
+// originMatcher decides whether a request origin is allowed
+type originMatcher struct {
+	any      bool
+	exact    map[string]struct{}
+	wildcard []wildcardOrigin
+	anyPort  []string // origins up to the port separator, from patterns like http://localhost:*
+}
+
+// wildcardOrigin is a pattern such as https://*.example.com split around the "*"
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func newOriginMatcher(origins []string) *originMatcher {
+	m := &originMatcher{exact: make(map[string]struct{})}
+
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			m.any = true
+		case strings.HasSuffix(origin, ":*") && !strings.Contains(strings.TrimSuffix(origin, ":*"), "*"):
+			m.anyPort = append(m.anyPort, strings.TrimSuffix(origin, "*"))
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			m.wildcard = append(m.wildcard, wildcardOrigin{prefix: prefix, suffix: suffix})
+		case origin != "":
+			m.exact[origin] = struct{}{}
+		}
+	}
+
+	return m
+}
+
+// allowed reports whether origin matches one of the configured origins
+func (m *originMatcher) allowed(origin string) bool {
+	return m.any || m.listed(origin)
+}
+
+// listed reports whether origin matches a configured origin other than "*"
+func (m *originMatcher) listed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if _, ok := m.exact[origin]; ok {
+		return true
+	}
+
+	for _, prefix := range m.anyPort {
+		if port, ok := strings.CutPrefix(origin, prefix); ok && isPort(port) {
+			return true
+		}
+	}
+
+	for _, w := range m.wildcard {
+		if len(origin) <= len(w.prefix)+len(w.suffix) {
+			continue
+		}
+		if !strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+			continue
+		}
+		// The wildcard only stands in for subdomain labels, never a port or path
+		sub := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+		if !strings.ContainsAny(sub, "/:@") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPort reports whether s is a non-empty run of decimal digits
+func isPort(s string) bool {
+	if s == "" || len(s) > 5 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CORS applies the configured cross-origin resource sharing policy.
+// Preflight requests (OPTIONS with Access-Control-Request-Method) for a
+// registered route are answered directly, and for other paths passed through
+// to be answered 404; every other request is passed through with the CORS
+// response headers.
+func CORS(cfg config.CORSConfig) server.Middleware {
+	matcher := newOriginMatcher(cfg.AllowedOrigins)
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || preflight && server.RoutePatternFromContext(r.Context()) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !matcher.allowed(origin) {
+				if preflight {
+					writeError(w, r, http.StatusForbidden, "FORBIDDEN", "CORS origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", origin)
+			// "*" reflects every origin, so it never lets credentials through
+			if cfg.AllowCredentials && matcher.listed(origin) {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				if allowMethods != "" {
+					h.Set("Access-Control-Allow-Methods", allowMethods)
+				}
+				if allowHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", allowHeaders)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+)
+
+func TestCORS(t *testing.T) {
+	base := config.CORSConfig{
+		Enabled:        true,
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org", "http://localhost:*"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"X-Request-ID"},
+	}
+	withCredentials := base
+	withCredentials.AllowCredentials = true
+	anyOrigin := base
+	anyOrigin.AllowedOrigins = []string{"*"}
+	anyOriginWithCredentials := withCredentials
+	anyOriginWithCredentials.AllowedOrigins = []string{"*", "https://app.example.com"}
+	disabled := base
+	disabled.Enabled = false
+
+	tests := []struct {
+		name          string
+		cfg           config.CORSConfig
+		method        string
+		unrouted      bool // the path matches no registered route
+		origin        string
+		requestMethod string
+		wantStatus    int
+		wantNext      bool
+		wantOrigin    string
+		wantCreds     bool
+		wantMethods   bool
+		wantExpose    bool
+		wantVary      []string
+	}{
+		{
+			name:       "simple request from allowed origin",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://app.example.com",
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "simple request from disallowed origin passes without headers",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "https://evil.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "request without origin",
+			cfg:        base,
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:          "preflight from allowed origin",
+			cfg:           base,
+			method:        http.MethodOptions,
+			origin:        "https://app.example.com",
+			requestMethod: http.MethodPost,
+			wantStatus:    http.StatusNoContent,
+			wantOrigin:    "https://app.example.com",
+			wantMethods:   true,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:          "preflight from disallowed origin is rejected",
+			cfg:           base,
+			method:        http.MethodOptions,
+			origin:        "https://evil.com",
+			requestMethod: http.MethodPost,
+			wantStatus:    http.StatusForbidden,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:          "preflight for an unknown path is passed through",
+			cfg:           base,
+			method:        http.MethodOptions,
+			unrouted:      true,
+			origin:        "https://app.example.com",
+			requestMethod: http.MethodPost,
+			wantStatus:    http.StatusOK,
+			wantNext:      true,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:       "options without request method is not a preflight",
+			cfg:        base,
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://app.example.com",
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:          "preflight with credentials",
+			cfg:           withCredentials,
+			method:        http.MethodOptions,
+			origin:        "https://app.example.com",
+			requestMethod: http.MethodGet,
+			wantStatus:    http.StatusNoContent,
+			wantOrigin:    "https://app.example.com",
+			wantCreds:     true,
+			wantMethods:   true,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:       "simple request with credentials",
+			cfg:        withCredentials,
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://app.example.com",
+			wantCreds:  true,
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "wildcard subdomain matches",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "https://api.example.org",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://api.example.org",
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "wildcard subdomain matches nested labels",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "https://a.b.example.org",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://a.b.example.org",
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "wildcard does not match apex domain",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "https://example.org",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "wildcard does not match other scheme",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "http://api.example.org",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:          "wildcard does not match lookalike suffix",
+			cfg:           base,
+			method:        http.MethodOptions,
+			origin:        "https://evil.com/.example.org",
+			requestMethod: http.MethodGet,
+			wantStatus:    http.StatusForbidden,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:       "port wildcard matches any port",
+			cfg:        base,
+			method:     http.MethodGet,
+			origin:     "http://localhost:5173",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "http://localhost:5173",
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:          "port wildcard does not match other hosts",
+			cfg:           base,
+			method:        http.MethodOptions,
+			origin:        "http://localhost:5173.evil.com",
+			requestMethod: http.MethodGet,
+			wantStatus:    http.StatusForbidden,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:          "star allows any origin",
+			cfg:           anyOrigin,
+			method:        http.MethodOptions,
+			origin:        "https://anything.test",
+			requestMethod: http.MethodGet,
+			wantStatus:    http.StatusNoContent,
+			wantOrigin:    "https://anything.test",
+			wantMethods:   true,
+			wantVary:      []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:       "star never allows credentials",
+			cfg:        anyOriginWithCredentials,
+			method:     http.MethodGet,
+			origin:     "https://anything.test",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://anything.test",
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "listed origin beside star allows credentials",
+			cfg:        anyOriginWithCredentials,
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantOrigin: "https://app.example.com",
+			wantCreds:  true,
+			wantExpose: true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:          "disabled passes everything through",
+			cfg:           disabled,
+			method:        http.MethodOptions,
+			origin:        "https://app.example.com",
+			requestMethod: http.MethodGet,
+			wantStatus:    http.StatusOK,
+			wantNext:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/session", nil)
+			if !tt.unrouted {
+				req = req.WithContext(server.WithRoutePattern(req.Context(), "/session"))
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+
+			CORS(tt.cfg)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if called != tt.wantNext {
+				t.Errorf("expected next called %v, got %v", tt.wantNext, called)
+			}
+
+			h := rec.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("expected Allow-Origin %q, got %q", tt.wantOrigin, got)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("expected Allow-Credentials %v, got %v", tt.wantCreds, got)
+			}
+			if got := h.Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("expected Allow-Methods present %v, got %v", tt.wantMethods, got)
+			}
+			if got := h.Get("Access-Control-Expose-Headers") != ""; got != tt.wantExpose {
+				t.Errorf("expected Expose-Headers present %v, got %v", tt.wantExpose, got)
+			}
+			if vary := h.Values("Vary"); !slices.Equal(vary, tt.wantVary) {
+				t.Errorf("expected Vary %v, got %v", tt.wantVary, vary)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// deprecationLogInterval limits the deprecation warning to one per route per interval
+const deprecationLogInterval = time.Minute
+
+// Deprecated marks responses of legacy routes with a Deprecation header and a
+// Link to the same path under successorPrefix, and logs a warning at most
+// once a minute per route pattern so busy clients don't flood the log
+func Deprecated(log logger.ILogger, successorPrefix string) server.Middleware {
+	var mu sync.Mutex
+	lastLogged := make(map[string]time.Time) // route pattern -> last warning
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successorPrefix+r.URL.Path+`>; rel="successor-version"`)
+
+			route := server.RoutePatternFromContext(r.Context())
+			now := time.Now()
+			mu.Lock()
+			warn := now.Sub(lastLogged[route]) >= deprecationLogInterval
+			if warn {
+				lastLogged[route] = now
+			}
+			mu.Unlock()
+			if warn {
+				log.Warn("deprecated route called", "route", route, "method", r.Method,
+					"successor", successorPrefix+route, "user_agent", r.UserAgent())
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+func TestDeprecated(t *testing.T) {
+	log := &testLogger{}
+	srv, err := server.New(server.Config{})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	legacy := srv.Group("", Deprecated(log, "/v1"))
+	legacy.GET("/session/", func(w http.ResponseWriter, r *http.Request) {})
+	legacy.GET("/registry/", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/session/a", "/session/b", "/registry/c"} {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if got := rec.Header().Get("Deprecation"); got != "true" {
+			t.Errorf("%s: expected Deprecation header, got %q", path, got)
+		}
+		if want, got := "</v1"+path+`>; rel="successor-version"`, rec.Header().Get("Link"); got != want {
+			t.Errorf("%s: expected Link %q, got %q", path, want, got)
+		}
+	}
+
+	entries := log.all()
+	if len(entries) != 2 {
+		t.Fatalf("expected one warning per route, got %d: %+v", len(entries), entries)
+	}
+	for i, route := range []string{"/session/", "/registry/"} {
+		if entries[i].level != "warn" || entries[i].fields["route"] != route || entries[i].fields["successor"] != "/v1"+route {
+			t.Errorf("expected warning for %s, got %+v", route, entries[i])
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/idempotency"
+	"github.com/aq189/bin/internal/server"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a POST it may repeat
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from the store
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	// maxIdempotencyKeyLength bounds the keys clients choose
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes bounds the request bodies hashed and the
+	// responses stored; larger responses are not replayed
+	maxIdempotentBodyBytes = 1 << 20
+	// idempotencyPendingTTL is how long a key stays claimed by a request still
+	// being processed, so a server dying mid-request doesn't hold it for the
+	// whole ttl
+	idempotencyPendingTTL = 5 * time.Minute
+)
+
+// Idempotency makes POST requests carrying an IdempotencyKeyHeader safe to
+// repeat. The first request with a key is processed and its response stored
+// in store for ttl; a repeat within ttl gets the stored response back, marked
+// with IdempotentReplayedHeader, without being processed again. Keys are
+// scoped to the caller and route, and a repeat must carry the same body: one
+// with another body, or one arriving while the first is still processed, is
+// refused with 409. Responses with a 5xx status aren't stored, so the request
+// can be retried under the same key. It must run after Authenticate.
+func Idempotency(store idempotency.IdempotencyStore, ttl time.Duration, c clock.Clock) server.Middleware {
+	c = clock.OrReal(c)
+	pendingTTL := min(ttl, idempotencyPendingTTL)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "idempotency key too long")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "invalid request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			requestHash := sha256.Sum256(body)
+			hash := hex.EncodeToString(requestHash[:])
+
+			// The store outlives the request: a client going away mustn't
+			// leave its key claimed
+			ctx := context.WithoutCancel(r.Context())
+			storeKey := idempotencyStoreKey(r, key)
+			existing, err := store.Begin(ctx, storeKey, hash, pendingTTL, c.Now())
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.RequestHash != hash:
+					writeError(w, r, http.StatusConflict, "CONFLICT", "idempotency key reused with a different request body")
+				case !existing.Done:
+					writeError(w, r, http.StatusConflict, "CONFLICT", "a request with this idempotency key is still being processed")
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rec := &idempotentWriter{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if !completed {
+					store.Release(ctx, storeKey)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError || rec.overflow {
+				return
+			}
+			completed = store.Complete(ctx, storeKey, idempotency.Response{
+				RequestHash: hash,
+				Status:      rec.status,
+				ContentType: rec.contentType,
+				Body:        rec.body.Bytes(),
+			}, ttl, c.Now()) == nil
+		})
+	}
+}
+
+// idempotencyStoreKey scopes a client's key to the caller and the route, so
+// callers can't replay each other's responses or reuse a key across routes
+func idempotencyStoreKey(r *http.Request, key string) string {
+	var subject, tenantID string
+	if claims, ok := ClaimsFromContext(r.Context()); ok {
+		subject, tenantID = claims.Subject, claims.TenantID
+	}
+	route := r.Method + " " + server.RoutePatternFromContext(r.Context())
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{subject, tenantID, route, key}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// replay writes a stored response
+func replay(w http.ResponseWriter, resp *idempotency.Response) {
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// idempotentWriter passes a response through while keeping a copy to store
+type idempotentWriter struct {
+	http.ResponseWriter
+	status      int
+	contentType string
+	body        bytes.Buffer
+	overflow    bool // the body exceeded maxIdempotentBodyBytes and wasn't kept
+	wroteHeader bool
+}
+
+func (w *idempotentWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.contentType = w.Header().Get("Content-Type")
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotentWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > maxIdempotentBodyBytes {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotentWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/server"
+)
+
+// newIdempotentHandler returns a handler creating a numbered resource from
+// each request it processes, behind Idempotency with a ttl of an hour
+func newIdempotentHandler(t *testing.T, c clock.Clock) (http.Handler, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	h := Idempotency(memory.NewIdempotencyStore(), time.Hour, c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "fail" {
+			writeError(w, r, http.StatusServiceUnavailable, "UNAVAILABLE", "try again")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"body":%q,"at":%q}`, calls.Add(1), body, time.Now().Format(time.RFC3339Nano))
+	}))
+	return h, &calls
+}
+
+// idempotentRequest sends body to h as subject with the idempotency key
+func idempotentRequest(h http.Handler, subject, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/session", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	ctx := server.WithRoutePattern(req.Context(), "/v1/session")
+	ctx = WithClaims(ctx, &token.Claims{Subject: subject})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req.WithContext(ctx))
+	return rec
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	h, calls := newIdempotentHandler(t, nil)
+
+	first := idempotentRequest(h, "user-1", "key-1", `{"user_id":"u1"}`)
+	if first.Code != http.StatusCreated || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("expected the first request processed, got %d %v", first.Code, first.Header())
+	}
+
+	second := idempotentRequest(h, "user-1", "key-1", `{"user_id":"u1"}`)
+	if calls.Load() != 1 {
+		t.Fatalf("expected the repeat not to be processed, got %d calls", calls.Load())
+	}
+	if second.Code != first.Code || !bytes.Equal(second.Body.Bytes(), first.Body.Bytes()) {
+		t.Errorf("expected a byte-identical replay of %d %s, got %d %s", first.Code, first.Body, second.Code, second.Body)
+	}
+	if second.Header().Get("Content-Type") != "application/json" || second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the replay marked with the stored content type, got %v", second.Header())
+	}
+
+	// Keys are scoped to the caller, and requests without one always run
+	idempotentRequest(h, "user-2", "key-1", `{"user_id":"u1"}`)
+	idempotentRequest(h, "user-1", "", `{"user_id":"u1"}`)
+	idempotentRequest(h, "user-1", "", `{"user_id":"u1"}`)
+	if calls.Load() != 4 {
+		t.Errorf("expected 4 requests processed, got %d", calls.Load())
+	}
+}
+
+func TestIdempotency_ConflictingReuse(t *testing.T) {
+	h, calls := newIdempotentHandler(t, nil)
+
+	idempotentRequest(h, "user-1", "key-1", `{"user_id":"u1"}`)
+	rec := idempotentRequest(h, "user-1", "key-1", `{"user_id":"u2"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a different body, got %d", rec.Code)
+	}
+	var body errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != "CONFLICT" {
+		t.Errorf("expected a conflict error, got %s", rec.Body)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the conflicting request not to be processed, got %d calls", calls.Load())
+	}
+
+	rec = idempotentRequest(h, "user-1", strings.Repeat("k", maxIdempotencyKeyLength+1), "{}")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an overlong key, got %d", rec.Code)
+	}
+}
+
+func TestIdempotency_Expiry(t *testing.T) {
+	c := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	h, calls := newIdempotentHandler(t, c)
+
+	idempotentRequest(h, "user-1", "key-1", `{"user_id":"u1"}`)
+	c.Advance(59 * time.Minute)
+	if rec := idempotentRequest(h, "user-1", "key-1", `{"user_id":"u2"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected the key held within the ttl, got %d", rec.Code)
+	}
+
+	c.Advance(time.Minute)
+	rec := idempotentRequest(h, "user-1", "key-1", `{"user_id":"u2"}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get(IdempotentReplayedHeader) != "" || calls.Load() != 2 {
+		t.Errorf("expected the expired key reused for a new request, got %d after %d calls", rec.Code, calls.Load())
+	}
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	h, calls := newIdempotentHandler(t, nil)
+
+	if rec := idempotentRequest(h, "user-1", "key-1", "fail"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the failure passed through, got %d", rec.Code)
+	}
+	// A retry under the same key with a corrected body is processed
+	if rec := idempotentRequest(h, "user-1", "key-1", "{}"); rec.Code != http.StatusCreated || calls.Load() != 1 {
+		t.Errorf("expected the retry processed, got %d", rec.Code)
+	}
+}
+
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+	store := memory.NewIdempotencyStore()
+	panicking := true
+	h := Idempotency(store, time.Hour, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panicking {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	func() {
+		defer func() { recover() }()
+		idempotentRequest(h, "user-1", "key-1", "{}")
+	}()
+	panicking = false
+	if rec := idempotentRequest(h, "user-1", "key-1", "{}"); rec.Code != http.StatusCreated {
+		t.Errorf("expected the key released after a panic, got %d", rec.Code)
+	}
+}
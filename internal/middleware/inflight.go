@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// InFlight counts the requests being served by route, so shutdown can report
+// what it waits for, and tells clients to go elsewhere once draining starts
+type InFlight struct {
+	mu       sync.Mutex
+	routes   map[string]int // "METHOD pattern" -> requests being served
+	draining atomic.Bool
+}
+
+// NewInFlight creates an empty request counter
+func NewInFlight() *InFlight {
+	return &InFlight{routes: make(map[string]int)}
+}
+
+// Count returns the number of requests being served
+func (f *InFlight) Count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, count := range f.routes {
+		n += count
+	}
+	return n
+}
+
+// Routes returns how many requests are being served on each route, keyed by
+// method and matched pattern, e.g. "GET /v1/registry/discover"
+func (f *InFlight) Routes() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.routes)
+}
+
+// Drain marks the server as shutting down: responses to requests arriving
+// from now on carry "Connection: close" so keep-alive clients reconnect
+// elsewhere. Requests already being served close their connection too, as
+// http.Server.Shutdown disables keep-alives.
+func (f *InFlight) Drain() {
+	f.draining.Store(true)
+}
+
+// add changes the count of route by delta, dropping routes with none left
+func (f *InFlight) add(route string, delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.routes[route] += delta
+	if f.routes[route] == 0 {
+		delete(f.routes, route)
+	}
+}
+
+// TrackInFlight counts every request against f while it is served. It reads
+// the matched route pattern, which the server stores before any global
+// middleware runs.
+func TrackInFlight(f *InFlight) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.Method + " " + server.RoutePatternFromContext(r.Context())
+			f.add(route, 1)
+			defer f.add(route, -1)
+
+			if f.draining.Load() {
+				w.Header().Set("Connection", "close")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+func TestTrackInFlight(t *testing.T) {
+	inFlight := NewInFlight()
+
+	opened := make(chan struct{})
+	release := make(chan struct{})
+	h := TrackInFlight(inFlight)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			opened <- struct{}{}
+			<-release
+		}
+	}))
+	request := func(target, pattern string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return req.WithContext(server.WithRoutePattern(req.Context(), pattern))
+	}
+
+	var wg sync.WaitGroup
+	for _, slow := range []struct{ target, pattern string }{
+		{"/registry/discover?slow", "/registry/discover"},
+		{"/registry/discover?slow", "/registry/discover"},
+		{"/session/sess-1?slow", "/session/"},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), request(slow.target, slow.pattern))
+		}()
+		<-opened
+	}
+
+	if got := inFlight.Count(); got != 3 {
+		t.Errorf("expected 3 requests in flight, got %d", got)
+	}
+	want := map[string]int{"GET /registry/discover": 2, "GET /session/": 1}
+	if got := inFlight.Routes(); !maps.Equal(got, want) {
+		t.Errorf("expected routes %v, got %v", want, got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, request("/health", "/health"))
+	if rec.Header().Get("Connection") != "" {
+		t.Error("expected connections kept alive before draining")
+	}
+	inFlight.Drain()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, request("/health", "/health"))
+	if rec.Header().Get("Connection") != "close" {
+		t.Error("expected Connection: close once draining")
+	}
+
+	close(release)
+	wg.Wait()
+	if got := inFlight.Count(); got != 0 || len(inFlight.Routes()) != 0 {
+		t.Errorf("expected nothing in flight after the requests end, got %d %v", got, inFlight.Routes())
+	}
+}
@@ -1 +1,195 @@
 package middleware
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// responseWriter captures the status code and body size written by a handler
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = status
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// defaultSkipPaths are probe endpoints left out of the access log unless configured otherwise
+var defaultSkipPaths = []string{"/health", "/ready", "/metrics"}
+
+// Logger writes an access log entry per request. Successful requests to skipped
+// paths are not logged and 2xx responses are sampled at 1 in cfg.SampleRate;
+// 4xx/5xx responses and requests slower than cfg.SlowThreshold are always logged.
+// Entries that survived sampling carry "sampled": true. Besides the raw path,
+// entries carry the matched route pattern, empty for unknown paths.
+// Requests that panicked are logged with status 500, "panic": true and the
+// panic value, whether Recovery handled the panic further down the chain or
+// it reached Logger, which then logs and re-panics. Responses gzipped by
+// Compression report the compressed size as bytes and add uncompressed_bytes.
+// The remote address is logged anonymized by anonymizeAddr.
+//
+// With a nil out, json and text entries go to log and clf and combined ones
+// to stdout; otherwise entries are written to out as lines in cfg.Format.
+// Lines carry the fields above except in the Common and Combined Log
+// Formats, which have fields of their own.
+func Logger(log logger.ILogger, cfg config.HTTPLogConfig, out io.Writer) server.Middleware {
+	format := accessLogFormatters[cmp.Or(cfg.Format, config.AccessLogJSON)]
+	if out == nil && (cfg.Format == config.AccessLogCLF || cfg.Format == config.AccessLogCombined) {
+		out = os.Stdout
+	}
+	var mu sync.Mutex // serializes writes to out
+
+	skipPaths := cfg.SkipPaths
+	if skipPaths == nil {
+		skipPaths = defaultSkipPaths
+	}
+	skip := make(map[string]struct{}, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = struct{}{}
+	}
+
+	slowThreshold := time.Duration(cfg.SlowThreshold) * time.Millisecond
+	var counter atomic.Uint64
+
+	logRequest := func(rw *responseWriter, r *http.Request, start time.Time, panicValue any, compression *compressionRecord) {
+		duration := time.Since(start)
+		status := rw.status
+		if panicValue != nil {
+			status = http.StatusInternalServerError
+		}
+		failed := status >= http.StatusBadRequest
+		slow := slowThreshold > 0 && duration >= slowThreshold
+
+		if _, ok := skip[r.URL.Path]; ok && !failed && !slow {
+			return
+		}
+
+		sampled := false
+		if cfg.SampleRate > 1 && status >= 200 && status < 300 && !slow {
+			if (counter.Add(1)-1)%uint64(cfg.SampleRate) != 0 {
+				return
+			}
+			sampled = true
+		}
+
+		requestURI := r.RequestURI
+		if requestURI == "" {
+			requestURI = r.URL.RequestURI()
+		}
+		entry := &accessLogEntry{
+			time:         start,
+			method:       r.Method,
+			path:         r.URL.Path,
+			requestURI:   requestURI,
+			proto:        r.Proto,
+			route:        server.RoutePatternFromContext(r.Context()),
+			status:       status,
+			bytes:        rw.bytes,
+			duration:     duration,
+			remoteAddr:   anonymizeAddr(r.RemoteAddr),
+			referer:      r.Referer(),
+			userAgent:    r.UserAgent(),
+			requestID:    RequestIDFromContext(r.Context()),
+			compressed:   compression.compressed,
+			uncompressed: compression.uncompressed,
+			sampled:      sampled,
+			panicValue:   panicValue,
+		}
+		if out == nil {
+			log.Info("http request", entry.fields()...)
+			return
+		}
+
+		var buf bytes.Buffer
+		format(&buf, entry)
+		mu.Lock()
+		_, err := out.Write(buf.Bytes())
+		mu.Unlock()
+		if err != nil {
+			log.Error("write access log failed", "error", err)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(w)
+			ctx, panicked := withPanicRecord(r.Context())
+			ctx, compression := withCompressionRecord(ctx)
+			r = r.WithContext(ctx)
+
+			defer func() {
+				rec := recover()
+				if rec != nil {
+					panicked.value = rec
+				}
+				logRequest(rw, r, start, panicked.value, compression)
+				if rec != nil {
+					panic(rec)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// anonymizeAddr drops the port of a remote address and zeroes the host part
+// of the IP, keeping the /24 network of IPv4 and the /48 of IPv6 addresses.
+// Addresses that are not IPs are logged as "unknown".
+func anonymizeAddr(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return "unknown"
+	}
+
+	ip = ip.Unmap().WithZone("")
+	bits := 48
+	if ip.Is4() {
+		bits = 24
+	}
+	prefix, _ := ip.Prefix(bits)
+	return prefix.Addr().String()
+}
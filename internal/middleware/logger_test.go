@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// testLogger records log entries for assertions
+type testLogger struct {
+	mu      sync.Mutex
+	entries []testLogEntry
+}
+
+type testLogEntry struct {
+	level  string
+	msg    string
+	fields map[string]any
+}
+
+func (l *testLogger) log(level, msg string, fields []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := testLogEntry{level: level, msg: msg, fields: make(map[string]any)}
+	for i := 0; i+1 < len(fields); i += 2 {
+		key, _ := fields[i].(string)
+		entry.fields[key] = fields[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func (l *testLogger) Debug(msg string, fields ...any) { l.log("debug", msg, fields) }
+func (l *testLogger) Info(msg string, fields ...any)  { l.log("info", msg, fields) }
+func (l *testLogger) Warn(msg string, fields ...any)  { l.log("warn", msg, fields) }
+func (l *testLogger) Error(msg string, fields ...any) { l.log("error", msg, fields) }
+func (l *testLogger) With(fields ...any) logger.ILogger {
+	return l
+}
+
+func (l *testLogger) all() []testLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]testLogEntry(nil), l.entries...)
+}
+
+func (l *testLogger) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func serve(h http.Handler, path string) {
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func statusHandler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+}
+
+func TestLogger_Sampling(t *testing.T) {
+	log := &testLogger{}
+	h := Logger(log, config.HTTPLogConfig{SampleRate: 10}, nil)(statusHandler(http.StatusOK))
+
+	for range 300 {
+		serve(h, "/registry/services")
+	}
+
+	if got := log.count(); got != 30 {
+		t.Fatalf("expected 30 sampled entries for 300 requests at 1 in 10, got %d", got)
+	}
+	for _, e := range log.all() {
+		if e.fields["sampled"] != true {
+			t.Errorf("expected sampled=true on %+v", e.fields)
+		}
+		for _, key := range []string{"method", "path", "status", "bytes", "duration_ms", "remote_addr", "user_agent", "request_id"} {
+			if _, ok := e.fields[key]; !ok {
+				t.Errorf("expected field %q in %+v", key, e.fields)
+			}
+		}
+	}
+}
+
+func TestLogger_ErrorsBypassSampling(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError} {
+		log := &testLogger{}
+		h := Logger(log, config.HTTPLogConfig{SampleRate: 100}, nil)(statusHandler(status))
+
+		for range 200 {
+			serve(h, "/session/abc")
+		}
+
+		if got := log.count(); got != 200 {
+			t.Errorf("status %d: expected every request logged, got %d", status, got)
+		}
+		if _, ok := log.all()[0].fields["sampled"]; ok {
+			t.Errorf("status %d: expected no sampled field on unsampled entries", status)
+		}
+	}
+}
+
+func TestLogger_SlowRequestsBypassSampling(t *testing.T) {
+	log := &testLogger{}
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+	})
+	h := Logger(log, config.HTTPLogConfig{SampleRate: 100, SlowThreshold: 1, SkipPaths: []string{"/health"}}, nil)(slow)
+
+	for range 5 {
+		serve(h, "/registry/services")
+	}
+	serve(h, "/health")
+
+	if got := log.count(); got != 6 {
+		t.Errorf("expected every slow request logged, got %d", got)
+	}
+}
+
+func TestLogger_SkipPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.HTTPLogConfig
+		path      string
+		status    int
+		wantCount int
+	}{
+		{name: "health skipped by default", path: "/health", status: http.StatusOK},
+		{name: "ready skipped by default", path: "/ready", status: http.StatusOK},
+		{name: "metrics skipped by default", path: "/metrics", status: http.StatusOK},
+		{name: "failing probe still logged", path: "/ready", status: http.StatusServiceUnavailable, wantCount: 100},
+		{name: "other paths logged", path: "/registry/services", status: http.StatusOK, wantCount: 100},
+		{name: "explicit empty list logs probes", cfg: config.HTTPLogConfig{SkipPaths: []string{}}, path: "/health", status: http.StatusOK, wantCount: 100},
+		{name: "custom list replaces defaults", cfg: config.HTTPLogConfig{SkipPaths: []string{"/internal"}}, path: "/internal", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &testLogger{}
+			h := Logger(log, tt.cfg, nil)(statusHandler(tt.status))
+
+			for range 100 {
+				serve(h, tt.path)
+			}
+
+			if got := log.count(); got != tt.wantCount {
+				t.Errorf("expected %d entries, got %d", tt.wantCount, got)
+			}
+		})
+	}
+}
+
+func TestLogger_RoutePattern(t *testing.T) {
+	log := &testLogger{}
+	srv, err := server.New(server.Config{Middlewares: []server.Middleware{Logger(log, config.HTTPLogConfig{}, nil)}})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.GET("/session/", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		path      string
+		wantRoute string
+	}{
+		{path: "/session/sess_1699", wantRoute: "/session/"},
+		{path: "/session/sess_1700", wantRoute: "/session/"},
+		{path: "/unknown", wantRoute: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			before := log.count()
+			serve(srv.Handler(), tt.path)
+
+			entries := log.all()
+			if len(entries) != before+1 {
+				t.Fatalf("expected one entry, got %d", len(entries)-before)
+			}
+			e := entries[len(entries)-1]
+			if e.fields["route"] != tt.wantRoute {
+				t.Errorf("expected route %q, got %v", tt.wantRoute, e.fields["route"])
+			}
+			if e.fields["path"] != tt.path {
+				t.Errorf("expected path %q, got %v", tt.path, e.fields["path"])
+			}
+		})
+	}
+}
+
+func TestLogger_Panics(t *testing.T) {
+	boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	partial := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("boom")
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{name: "recovered before writing", handler: boom},
+		{name: "recovered after writing headers", handler: partial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &testLogger{}
+			h := Logger(log, config.HTTPLogConfig{}, nil)(Recovery(log)(tt.handler))
+			serve(h, "/health")
+
+			var access *testLogEntry
+			for _, e := range log.all() {
+				if e.msg == "http request" {
+					access = &e
+				}
+			}
+			if access == nil {
+				t.Fatal("expected an access log entry")
+			}
+			if access.fields["status"] != http.StatusInternalServerError || access.fields["panic"] != true || access.fields["panic_value"] != "boom" {
+				t.Errorf("expected status 500 with panic fields, got %v", access.fields)
+			}
+		})
+	}
+
+	t.Run("unrecovered panic is logged and re-raised", func(t *testing.T) {
+		log := &testLogger{}
+		h := Logger(log, config.HTTPLogConfig{}, nil)(boom)
+
+		func() {
+			defer func() {
+				if rec := recover(); rec != "boom" {
+					t.Errorf("expected the panic to propagate, got %v", rec)
+				}
+			}()
+			serve(h, "/session/sess-1")
+		}()
+
+		entries := log.all()
+		if len(entries) != 1 || entries[0].fields["status"] != http.StatusInternalServerError || entries[0].fields["panic"] != true {
+			t.Errorf("expected one access log entry with status 500 and panic, got %v", entries)
+		}
+	})
+
+	t.Run("requests without a panic carry no panic fields", func(t *testing.T) {
+		log := &testLogger{}
+		serve(Logger(log, config.HTTPLogConfig{}, nil)(Recovery(log)(statusHandler(http.StatusOK))), "/session/sess-1")
+
+		if _, ok := log.all()[0].fields["panic"]; ok {
+			t.Error("expected no panic field")
+		}
+	})
+}
+
+func TestAnonymizeAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "203.0.113.57:52144", want: "203.0.113.0"},
+		{addr: "203.0.113.57", want: "203.0.113.0"},
+		{addr: "[2001:db8:85a3:8d3:1319:8a2e:370:7348]:443", want: "2001:db8:85a3::"},
+		{addr: "[::ffff:198.51.100.7]:80", want: "198.51.100.0"},
+		{addr: "[fe80::1%eth0]:80", want: "fe80::"},
+		{addr: "@", want: "unknown"},
+		{addr: "", want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := anonymizeAddr(tt.addr); got != tt.want {
+			t.Errorf("anonymizeAddr(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/server"
+)
+
+// MaintenanceMode reports whether the server is read-only for maintenance,
+// with the operator's message and when the mode clears
+type MaintenanceMode interface {
+	Maintenance() (message string, until time.Time, ok bool)
+}
+
+// defaultMaintenanceMessage answers writes when the operator left no message
+const defaultMaintenanceMessage = "server is in maintenance mode"
+
+// Maintenance rejects POST, PUT, PATCH and DELETE requests with 503 while
+// mode is enabled, with a Retry-After header counting down to when it clears
+// and the operator's message in the error. Reads keep working, as do the
+// routes whose matched pattern is in exempt, such as the one turning the
+// mode off.
+func Maintenance(mode MaintenanceMode, c clock.Clock, exempt ...string) server.Middleware {
+	c = clock.OrReal(c)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !mutating(r.Method) || slices.Contains(exempt, server.RoutePatternFromContext(r.Context())) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			message, until, ok := mode.Maintenance()
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			retryAfter := max(1, int(math.Ceil(until.Sub(c.Now()).Seconds())))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			if message == "" {
+				message = defaultMaintenanceMessage
+			}
+			writeError(w, r, http.StatusServiceUnavailable, "MAINTENANCE", message)
+		})
+	}
+}
+
+// mutating reports whether requests with method change state
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/server"
+)
+
+// maintenanceMode is a fixed maintenance mode
+type maintenanceMode struct {
+	message string
+	until   time.Time
+	enabled bool
+}
+
+func (m maintenanceMode) Maintenance() (string, time.Time, bool) {
+	return m.message, m.until, m.enabled
+}
+
+func TestMaintenance(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mode := maintenanceMode{message: "migrating storage", until: now.Add(90*time.Second + time.Millisecond), enabled: true}
+	h := Maintenance(mode, clock.NewFake(now), "/v1/auth/validate")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(method, pattern string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, pattern, nil)
+		req = req.WithContext(server.WithRoutePattern(req.Context(), pattern))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		method     string
+		pattern    string
+		wantStatus int
+	}{
+		{method: http.MethodGet, pattern: "/v1/registry/services", wantStatus: http.StatusNoContent},
+		{method: http.MethodHead, pattern: "/v1/session/", wantStatus: http.StatusNoContent},
+		{method: http.MethodOptions, pattern: "/v1/registry/register", wantStatus: http.StatusNoContent},
+		{method: http.MethodPost, pattern: "/v1/registry/register", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodPut, pattern: "/v1/session/", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodPatch, pattern: "/v1/session/", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodDelete, pattern: "/v1/session/", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodPost, pattern: "/v1/auth/validate", wantStatus: http.StatusNoContent},
+		{method: http.MethodPost, pattern: "/auth/validate", wantStatus: http.StatusServiceUnavailable},
+	} {
+		t.Run(tt.method+" "+tt.pattern, func(t *testing.T) {
+			rec := serve(tt.method, tt.pattern)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusServiceUnavailable {
+				return
+			}
+
+			var body errorResponse
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Code != "MAINTENANCE" || body.Error != "migrating storage" {
+				t.Errorf("expected the operator message, got %+v", body)
+			}
+			if got := rec.Header().Get("Retry-After"); got != "91" {
+				t.Errorf("expected Retry-After 91, got %q", got)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		h := Maintenance(maintenanceMode{}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/registry/register", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected writes served, got %d", rec.Code)
+		}
+	})
+}
@@ -1 +1,41 @@
 package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// Recovery converts handler panics into 500 responses and logs them. Placed
+// inside Logger, it hands the panic to the access log entry as well.
+func Recovery(log logger.ILogger) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				log.Error("panic recovered",
+					"panic", fmt.Sprint(rec),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"request_id", RequestIDFromContext(r.Context()),
+					"stack", string(debug.Stack()),
+				)
+
+				recordPanic(r.Context(), rec)
+				writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1 +1,30 @@
 package middleware
+
+import (
+	"net/http"
+
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/internal/server"
+)
+
+// RequestIDHeader is the header used to propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns every request an ID, honoring one supplied by the caller,
+// and echoes it in the response headers. IDs are generated by ids, nil using
+// random hex; a format the caller's tracing system also uses lets requests
+// be correlated with it.
+func RequestID(ids idgen.IDGenerator) server.Middleware {
+	ids = idgen.OrHex(ids)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = ids.NewID()
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// ScopeResourceID stands for the request's resource ID in a RequireScope pattern
+const ScopeResourceID = "{id}"
+
+// RequireScope allows the request through if the caller's token carries a
+// scope covering pattern, or no scopes at all. A ScopeResourceID in pattern
+// is replaced with the resource ID of the request: the path segment following
+// the matched route pattern, e.g. "svc-123" for /v1/registry/heartbeat/svc-123
+// on the route "/v1/registry/heartbeat/". It must run after Authenticate.
+func RequireScope(pattern string) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+				return
+			}
+
+			required := strings.ReplaceAll(pattern, ScopeResourceID, resourceID(r))
+			if claims.Scoped() && !claims.HasScope(required) {
+				writeError(w, r, http.StatusForbidden, "FORBIDDEN", "insufficient scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectScoped refuses tokens carrying scopes, for routes that check none, so
+// a scoped token only works where its scopes are checked. It must run after
+// Authenticate.
+func RejectScoped() server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, ok := ClaimsFromContext(r.Context()); ok && claims.Scoped() {
+				writeError(w, r, http.StatusForbidden, "FORBIDDEN", "insufficient scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resourceID returns the ID in the path segment following the matched route
+// pattern, read like handlers read it, or "" when there is no valid one
+func resourceID(r *http.Request) string {
+	id, _, err := server.PathParam(r, server.RoutePatternFromContext(r.Context()))
+	if err != nil {
+		return ""
+	}
+	return id
+}
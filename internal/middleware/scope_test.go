@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/server"
+)
+
+func TestRequireScope(t *testing.T) {
+	heartbeat := &token.Claims{Subject: "svc-123", Scopes: []string{"registry:heartbeat:svc-123"}}
+	anyHeartbeat := &token.Claims{Subject: "agent", Scopes: []string{"registry:heartbeat:*"}}
+	adminScoped := &token.Claims{Subject: "ops", Roles: []string{token.RoleAdmin}, Scopes: []string{"session:read:*"}}
+	unscoped := &token.Claims{Subject: "user-1", Roles: []string{"user"}}
+
+	tests := []struct {
+		name       string
+		claims     *token.Claims
+		pattern    string
+		route      string
+		target     string
+		wantStatus int
+	}{
+		{name: "matching resource", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/v1/registry/heartbeat/", target: "/v1/registry/heartbeat/svc-123", wantStatus: http.StatusOK},
+		{name: "other resource", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/v1/registry/heartbeat/", target: "/v1/registry/heartbeat/svc-456", wantStatus: http.StatusForbidden},
+		{name: "resource at the root", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-123", wantStatus: http.StatusOK},
+		{name: "prefix of the resource", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-1234", wantStatus: http.StatusForbidden},
+		{name: "bound to the first segment", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-456/svc-123", wantStatus: http.StatusForbidden},
+		{name: "trailing slash", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-123/", wantStatus: http.StatusOK},
+		{name: "encoded slash", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-123%2F..%2Fsvc-456", wantStatus: http.StatusForbidden},
+		{name: "missing resource", claims: heartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/", wantStatus: http.StatusForbidden},
+		{name: "wildcard", claims: anyHeartbeat, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-456", wantStatus: http.StatusOK},
+		{name: "wildcard of another action", claims: anyHeartbeat, pattern: "session:read:{id}", route: "/session/", target: "/session/abc", wantStatus: http.StatusForbidden},
+		{name: "sub-resource", claims: adminScoped, pattern: "session:read:{id}", route: "/session/", target: "/session/abc/validate", wantStatus: http.StatusOK},
+		{name: "roles do not widen scopes", claims: adminScoped, pattern: "session:write:{id}", route: "/session/", target: "/session/abc", wantStatus: http.StatusForbidden},
+		{name: "no resource in the pattern", claims: adminScoped, pattern: "session:read", route: "/session", target: "/session", wantStatus: http.StatusForbidden},
+		{name: "unscoped token", claims: unscoped, pattern: "registry:heartbeat:{id}", route: "/registry/heartbeat/", target: "/registry/heartbeat/svc-456", wantStatus: http.StatusOK},
+		{name: "unauthenticated", pattern: "session:read", route: "/session", target: "/session", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequireScope(tt.pattern)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			ctx := server.WithRoutePattern(req.Context(), tt.route)
+			if tt.claims != nil {
+				ctx = WithClaims(ctx, tt.claims)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				var body errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != "FORBIDDEN" || body.Error != "insufficient scope" {
+					t.Errorf("expected an insufficient scope error, got %s", rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestRejectScoped(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     *token.Claims
+		wantStatus int
+	}{
+		{name: "scoped", claims: &token.Claims{Subject: "svc-123", Roles: []string{token.RoleAdmin}, Scopes: []string{"registry:heartbeat:svc-123"}}, wantStatus: http.StatusForbidden},
+		{name: "unscoped", claims: &token.Claims{Subject: "user-1", Roles: []string{"user"}}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RejectScoped()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodPost, "/registry/register", nil)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req.WithContext(WithClaims(req.Context(), tt.claims)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/server"
+)
+
+// Default values of the security headers
+const (
+	defaultContentTypeOptions    = "nosniff"
+	defaultFrameOptions          = "DENY"
+	defaultReferrerPolicy        = "no-referrer"
+	defaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	defaultHSTSMaxAge            = 365 * 24 * 60 * 60 // one year, in seconds
+)
+
+// hstsHeader is sent only over TLS, as browsers ignore it on plain HTTP
+const hstsHeader = "Strict-Transport-Security"
+
+// SecurityHeaders adds hardening headers to every response. Strict-Transport-
+// Security is only added to requests served over TLS. Headers are set before
+// the handler runs and only when missing, so a value set by an outer
+// middleware is kept and a handler setting one of them replaces the default.
+func SecurityHeaders(cfg config.SecurityHeadersConfig) server.Middleware {
+	headers := securityHeaders(cfg)
+	hsts := ""
+	if headerEnabled(cfg.Disabled, hstsHeader) {
+		maxAge := cmp.Or(cfg.HSTSMaxAge, defaultHSTSMaxAge)
+		hsts = "max-age=" + strconv.Itoa(maxAge)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for _, header := range headers {
+				if h.Get(header.name) == "" {
+					h.Set(header.name, header.value)
+				}
+			}
+			if hsts != "" && r.TLS != nil && h.Get(hstsHeader) == "" {
+				h.Set(hstsHeader, hsts)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// securityHeader is a header name and the value SecurityHeaders sets
+type securityHeader struct {
+	name  string
+	value string
+}
+
+// securityHeaders returns the headers sent on every request, leaving out the
+// disabled ones
+func securityHeaders(cfg config.SecurityHeadersConfig) []securityHeader {
+	var headers []securityHeader
+	for _, header := range []securityHeader{
+		{"X-Content-Type-Options", cmp.Or(cfg.ContentTypeOptions, defaultContentTypeOptions)},
+		{"X-Frame-Options", cmp.Or(cfg.FrameOptions, defaultFrameOptions)},
+		{"Referrer-Policy", cmp.Or(cfg.ReferrerPolicy, defaultReferrerPolicy)},
+		{"Content-Security-Policy", cmp.Or(cfg.ContentSecurityPolicy, defaultContentSecurityPolicy)},
+	} {
+		if headerEnabled(cfg.Disabled, header.name) {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// headerEnabled reports whether name is missing from the disabled header names
+func headerEnabled(disabled []string, name string) bool {
+	return !slices.ContainsFunc(disabled, func(d string) bool {
+		return strings.EqualFold(strings.TrimSpace(d), name)
+	})
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	defaults := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+		"Strict-Transport-Security": "",
+	}
+	with := func(overrides map[string]string) map[string]string {
+		want := make(map[string]string, len(defaults))
+		for name, value := range defaults {
+			want[name] = value
+		}
+		for name, value := range overrides {
+			want[name] = value
+		}
+		return want
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.SecurityHeadersConfig
+		tls     bool
+		handler func(h http.Header)
+		want    map[string]string // "" means absent
+	}{
+		{
+			name: "disabled",
+			cfg:  config.SecurityHeadersConfig{Enabled: false},
+			tls:  true,
+			want: map[string]string{
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "",
+				"Referrer-Policy":           "",
+				"Content-Security-Policy":   "",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name: "defaults over plain http",
+			cfg:  config.SecurityHeadersConfig{Enabled: true},
+			want: defaults,
+		},
+		{
+			name: "hsts over tls",
+			cfg:  config.SecurityHeadersConfig{Enabled: true},
+			tls:  true,
+			want: with(map[string]string{"Strict-Transport-Security": "max-age=31536000"}),
+		},
+		{
+			name: "hsts max age and subdomains",
+			cfg:  config.SecurityHeadersConfig{Enabled: true, HSTSMaxAge: 600, HSTSIncludeSubdomains: true},
+			tls:  true,
+			want: with(map[string]string{"Strict-Transport-Security": "max-age=600; includeSubDomains"}),
+		},
+		{
+			name: "overridden values",
+			cfg: config.SecurityHeadersConfig{
+				Enabled:               true,
+				FrameOptions:          "SAMEORIGIN",
+				ReferrerPolicy:        "strict-origin-when-cross-origin",
+				ContentSecurityPolicy: "default-src 'self'",
+			},
+			want: with(map[string]string{
+				"X-Frame-Options":         "SAMEORIGIN",
+				"Referrer-Policy":         "strict-origin-when-cross-origin",
+				"Content-Security-Policy": "default-src 'self'",
+			}),
+		},
+		{
+			name: "disabled headers",
+			cfg:  config.SecurityHeadersConfig{Enabled: true, Disabled: []string{"content-security-policy", "Strict-Transport-Security"}},
+			tls:  true,
+			want: with(map[string]string{"Content-Security-Policy": ""}),
+		},
+		{
+			name: "handler values are kept",
+			cfg:  config.SecurityHeadersConfig{Enabled: true},
+			tls:  true,
+			handler: func(h http.Header) {
+				h.Set("X-Frame-Options", "SAMEORIGIN")
+				h.Set("Strict-Transport-Security", "max-age=0")
+			},
+			want: with(map[string]string{"X-Frame-Options": "SAMEORIGIN", "Strict-Transport-Security": "max-age=0"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecurityHeaders(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.handler != nil {
+					tt.handler(w.Header())
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/registry/services", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			for name, want := range tt.want {
+				if got := rec.Header().Values(name); want == "" && len(got) > 0 {
+					t.Errorf("expected no %s, got %q", name, got)
+				} else if want != "" && (len(got) != 1 || got[0] != want) {
+					t.Errorf("expected %s %q, got %q", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders_KeepsOuterValues(t *testing.T) {
+	inner := SecurityHeaders(config.SecurityHeadersConfig{Enabled: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		inner.ServeHTTP(w, r)
+	})
+
+	rec := httptest.NewRecorder()
+	outer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Content-Security-Policy"); got != "default-src 'self'" {
+		t.Errorf("expected the outer policy to be kept, got %q", got)
+	}
+}
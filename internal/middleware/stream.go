@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// defaultMaxStreams bounds concurrent streams when the configuration leaves it unset
+const defaultMaxStreams = 1000
+
+// StreamLimiter caps the number of concurrent streaming connections and
+// reports how many are open
+type StreamLimiter struct {
+	max    int64
+	active atomic.Int64
+}
+
+// NewStreamLimiter creates a limiter allowing max concurrent streams; 0 uses 1000
+func NewStreamLimiter(max int) *StreamLimiter {
+	if max <= 0 {
+		max = defaultMaxStreams
+	}
+	return &StreamLimiter{max: int64(max)}
+}
+
+// Active returns the number of streams currently open
+func (l *StreamLimiter) Active() int {
+	return int(l.active.Load())
+}
+
+// Streams counts the route's requests against the limiter and rejects them
+// with 503 once the limit is reached. Streaming routes combine it with
+// server.NoWriteTimeout and leave out Timeout.
+func Streams(l *StreamLimiter) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.active.Add(1) > l.max {
+				l.active.Add(-1)
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, http.StatusServiceUnavailable, "TOO_MANY_STREAMS", "too many concurrent streams")
+				return
+			}
+			defer l.active.Add(-1)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestStreams(t *testing.T) {
+	limiter := NewStreamLimiter(2)
+
+	opened := make(chan struct{})
+	release := make(chan struct{})
+	h := Streams(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opened <- struct{}{}
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/watch", nil))
+		}()
+		<-opened
+	}
+
+	if got := limiter.Active(); got != 2 {
+		t.Errorf("expected 2 active streams, got %d", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/watch", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 beyond the cap, got %d", rec.Code)
+	}
+	var body errorResponse
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body.Code != "TOO_MANY_STREAMS" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected TOO_MANY_STREAMS with Retry-After, got %q", body.Code)
+	}
+	if got := limiter.Active(); got != 2 {
+		t.Errorf("expected a rejected stream not to be counted, got %d", got)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := limiter.Active(); got != 0 {
+		t.Errorf("expected 0 active streams after they end, got %d", got)
+	}
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/watch", nil))
+	<-opened
+}
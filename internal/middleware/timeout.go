@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/server"
+)
+
+// timeoutWriter guards the response once the deadline has fired.
+// The handler writes into its own header map; nothing reaches the client
+// after the timeout response has been sent.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// FlushError lets http.ResponseController flush streamed responses, like
+// audit exports, through the timeout. It fails once the timeout fired.
+func (tw *timeoutWriter) FlushError() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return http.NewResponseController(tw.w).Flush()
+}
+
+// Timeout bounds handler work with a context deadline. If the deadline fires
+// before the handler has started its response, a 503 is written and any later
+// writes by the handler are discarded. A handler that has already started
+// writing is allowed to finish. A non-positive d disables the timeout.
+func Timeout(d time.Duration) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, header: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// Re-panic on the request goroutine so Recovery can handle it
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				tw.mu.Lock()
+				if tw.wroteHeader {
+					tw.mu.Unlock()
+					select {
+					case p := <-panicChan:
+						panic(p)
+					case <-done:
+					}
+					return
+				}
+				tw.timedOut = true
+				tw.mu.Unlock()
+
+				writeError(w, r, http.StatusServiceUnavailable, "TIMEOUT", "request timed out")
+			}
+		})
+	}
+}
+
+// LongPoll is Timeout for routes that may hold a request until something
+// changes. Requests carrying a wait query parameter may take maxWait longer
+// than d and have the server's write deadline cleared; the handler bounds
+// the wait itself. Other requests get Timeout(d).
+func LongPoll(d, maxWait time.Duration) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		short := Timeout(d)(next)
+		long := server.NoWriteTimeout()(next)
+		if d > 0 {
+			long = server.NoWriteTimeout()(Timeout(d + maxWait)(next))
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Has("wait") {
+				long.ServeHTTP(w, r)
+				return
+			}
+			short.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+)
+
+func TestTimeout(t *testing.T) {
+	t.Run("slow handler gets 503 and its late write is dropped", func(t *testing.T) {
+		lateWrite := make(chan error, 1)
+		slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			w.Header().Set("X-Late", "1")
+			_, err := io.WriteString(w, "too late")
+			lateWrite <- err
+		})
+
+		log := &testLogger{}
+		h := Logger(log, config.HTTPLogConfig{}, nil)(Timeout(20 * time.Millisecond)(slow))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status 503, got %d", rec.Code)
+		}
+		var body errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("expected JSON error body, got %q", rec.Body)
+		}
+		if body.Code != "TIMEOUT" {
+			t.Errorf("expected code TIMEOUT, got %q", body.Code)
+		}
+
+		select {
+		case err := <-lateWrite:
+			if !errors.Is(err, http.ErrHandlerTimeout) {
+				t.Errorf("expected ErrHandlerTimeout for late write, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler never attempted its late write")
+		}
+		if rec.Header().Get("X-Late") != "" {
+			t.Error("expected late header to be suppressed")
+		}
+
+		entries := log.all()
+		if len(entries) != 1 || entries[0].fields["status"] != http.StatusServiceUnavailable {
+			t.Errorf("expected one access log entry with status 503, got %+v", entries)
+		}
+	})
+
+	t.Run("fast handler is unaffected", func(t *testing.T) {
+		fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Deadline(); !ok {
+				t.Error("expected request context to carry a deadline")
+			}
+			w.Header().Set("X-Handler", "fast")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, "ok")
+		})
+
+		rec := httptest.NewRecorder()
+		Timeout(time.Second)(fast).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusCreated || rec.Body.String() != "ok" {
+			t.Errorf("expected 201 ok, got %d %q", rec.Code, rec.Body)
+		}
+		if rec.Header().Get("X-Handler") != "fast" {
+			t.Error("expected handler headers to be copied")
+		}
+	})
+
+	t.Run("handler that started writing finishes", func(t *testing.T) {
+		streaming := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "partial ")
+			<-r.Context().Done()
+			io.WriteString(w, "rest")
+		})
+
+		rec := httptest.NewRecorder()
+		Timeout(20*time.Millisecond)(streaming).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusOK || rec.Body.String() != "partial rest" {
+			t.Errorf("expected 200 with full body, got %d %q", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("streamed response is flushed through", func(t *testing.T) {
+		flushErr := make(chan error, 1)
+		streaming := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "row\n")
+			flushErr <- http.NewResponseController(w).Flush()
+		})
+
+		rec := httptest.NewRecorder()
+		Timeout(time.Second)(streaming).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if err := <-flushErr; err != nil || !rec.Flushed {
+			t.Errorf("expected the row flushed, got %v", err)
+		}
+	})
+
+	t.Run("zero duration disables the timeout", func(t *testing.T) {
+		h := Timeout(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Deadline(); ok {
+				t.Error("expected no deadline")
+			}
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	t.Run("panic reaches Recovery", func(t *testing.T) {
+		log := &testLogger{}
+		h := Recovery(log)(Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", rec.Code)
+		}
+	})
+}
+
+func TestLongPoll(t *testing.T) {
+	handler := LongPoll(10*time.Millisecond, time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+
+	for _, tt := range []struct {
+		target     string
+		wantStatus int
+	}{
+		{target: "/registry/discover", wantStatus: http.StatusServiceUnavailable},
+		{target: "/registry/discover?wait=30s&revision=1", wantStatus: http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.target, tt.wantStatus, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/aq189/bin/internal/server"
+	"github.com/aq189/bin/pkg/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span per request, continuing the trace named by an
+// incoming traceparent header. Spans are named after the matched route
+// pattern rather than the raw path and record the response status.
+func Tracing(tp trace.TracerProvider) server.Middleware {
+	tracer := tp.Tracer(tracing.InstrumentationName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			name := r.Method
+			route := server.RoutePatternFromContext(ctx)
+			if route != "" {
+				name += " " + route
+			}
+
+			ctx, span := tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			if id := RequestIDFromContext(ctx); id != "" {
+				span.SetAttributes(semconv.HTTPRequestHeader("x-request-id", id))
+			}
+
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+			tracing.RecordStatus(span, rw.status, trace.SpanKindServer)
+		})
+	}
+}
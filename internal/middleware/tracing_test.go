@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aq189/bin/internal/server"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	srv, err := server.New(server.Config{Middlewares: []server.Middleware{Tracing(tp)}})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.GET("/session/", func(w http.ResponseWriter, r *http.Request) {
+		if !trace.SpanContextFromContext(r.Context()).IsValid() {
+			t.Error("expected the handler context to carry the server span")
+		}
+	})
+	srv.GET("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		wantName    string
+		wantStatus  codes.Code
+	}{
+		{name: "named by route", path: "/session/sess_1699", wantName: "GET /session/", wantStatus: codes.Unset},
+		{name: "continues incoming trace", path: "/session/sess_1700", traceparent: parent, wantName: "GET /session/", wantStatus: codes.Unset},
+		{name: "server errors", path: "/fail", wantName: "GET /fail", wantStatus: codes.Error},
+		{name: "unknown path", path: "/unknown", wantName: "GET", wantStatus: codes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			span := spans[0]
+			if span.Name != tt.wantName {
+				t.Errorf("expected span %q, got %q", tt.wantName, span.Name)
+			}
+			if span.SpanKind != trace.SpanKindServer {
+				t.Errorf("expected server span, got %s", span.SpanKind)
+			}
+			if span.Status.Code != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, span.Status.Code)
+			}
+
+			if tt.traceparent == "" {
+				if span.Parent.IsValid() {
+					t.Errorf("expected a root span, got parent %s", span.Parent.SpanID())
+				}
+				return
+			}
+			if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+				t.Errorf("expected span to continue the incoming trace, got trace %s parent %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+			}
+			if !span.Parent.IsRemote() {
+				t.Error("expected a remote parent")
+			}
+		})
+	}
+}
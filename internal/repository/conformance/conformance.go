@@ -0,0 +1,42 @@
+// Package conformance holds the behavioral contract of the repository
+// interfaces as test suites. Every storage backend runs the suites against
+// its own implementations from its tests, so a new backend is done when it
+// passes them and a behavior the suites pin down can't drift between
+// backends.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// now returns the current time at the precision every backend stores
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// cancelled returns a context that is already cancelled
+func cancelled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// expectCancelled checks that the call named op failed with the error of a
+// cancelled context
+func expectCancelled(t *testing.T, op string, err error) {
+	t.Helper()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("%s: expected context.Canceled, got %v", op, err)
+	}
+}
+
+// must fails the test when a call setting up a case fails
+func must(t *testing.T, op string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", op, err)
+	}
+}
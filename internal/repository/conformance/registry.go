@@ -0,0 +1,485 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+)
+
+// TestRegistryRepository runs the registry repository contract against the
+// repositories newRepo returns, an empty one for each case. The cases for
+// CapabilityFinder, HeartbeatUpdater, BatchUpdater and repository.Transactor
+// run only for repositories that implement them.
+func TestRegistryRepository(t *testing.T, newRepo func(t *testing.T) service.RegistryRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo service.RegistryRepository)
+	}{
+		{"register and get", testRegistryRegisterGet},
+		{"create if absent", testRegistryCreateIfAbsent},
+		{"not found", testRegistryNotFound},
+		{"update", testRegistryUpdate},
+		{"deregister", testRegistryDeregister},
+		{"soft delete", testRegistrySoftDelete},
+		{"list paged", testRegistryListPaged},
+		{"purge", testRegistryPurge},
+		{"revision", testRegistryRevision},
+		{"find by capability", testRegistryFindByCapability},
+		{"update heartbeat", testRegistryUpdateHeartbeat},
+		{"batch update", testRegistryBatchUpdate},
+		{"transaction", testRegistryTransaction},
+		{"cancellation", testRegistryCancellation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+// newService returns a healthy service named name registered at registered
+func newService(id, name string, registered time.Time) *service.Service {
+	return &service.Service{
+		ID:           id,
+		Name:         name,
+		Version:      "1.0.0",
+		Endpoints:    []service.Endpoint{{URL: "http://localhost:8080", Weight: 1, Healthy: true}},
+		Capabilities: []string{"storage"},
+		Metadata:     map[string]string{"region": "eu"},
+		Status:       service.StatusHealthy,
+		RegisteredAt: registered,
+	}
+}
+
+// sameService reports whether got holds what want was stored with
+func sameService(got, want *service.Service) bool {
+	return got.ID == want.ID && got.TenantID == want.TenantID && got.Name == want.Name &&
+		got.InstanceID == want.InstanceID && got.Version == want.Version && slices.Equal(got.Endpoints, want.Endpoints) &&
+		slices.Equal(got.Capabilities, want.Capabilities) && maps.Equal(got.Metadata, want.Metadata) &&
+		got.Status == want.Status && got.OverrideStatus == want.OverrideStatus &&
+		got.RegisteredAt.Equal(want.RegisteredAt) && got.LastHeartbeat.Equal(want.LastHeartbeat) &&
+		got.DeletedAt.Equal(want.DeletedAt)
+}
+
+// serviceIDs returns the IDs of services in order
+func serviceIDs(services []*service.Service) []string {
+	ids := make([]string, len(services))
+	for i, svc := range services {
+		ids[i] = svc.ID
+	}
+	return ids
+}
+
+func testRegistryRegisterGet(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	svc := newService("svc-1", "auth", now())
+	svc.TenantID = "acme"
+	svc.InstanceID = "auth-a"
+	svc.LastHeartbeat = svc.RegisteredAt
+	must(t, "register", repo.Register(ctx, svc))
+
+	got, err := repo.Get(ctx, "svc-1")
+	if err != nil || !sameService(got, svc) {
+		t.Fatalf("expected %+v, got %+v, %v", svc, got, err)
+	}
+
+	replaced := newService("svc-1", "auth", now())
+	replaced.Version = "2.0.0"
+	must(t, "register again", repo.Register(ctx, replaced))
+	got, err = repo.Get(ctx, "svc-1")
+	if err != nil || !sameService(got, replaced) {
+		t.Errorf("expected registering again to replace the service, got %+v, %v", got, err)
+	}
+}
+
+func testRegistryCreateIfAbsent(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	first := newService("svc-1", "auth", now())
+	existing, err := repo.CreateIfAbsent(ctx, first)
+	if err != nil || existing != nil {
+		t.Fatalf("expected a new service stored, got %v, %v", existing, err)
+	}
+
+	second := newService("svc-1", "billing", now())
+	existing, err = repo.CreateIfAbsent(ctx, second)
+	if err != nil || existing == nil || !sameService(existing, first) {
+		t.Fatalf("expected the existing service returned, got %+v, %v", existing, err)
+	}
+	got, err := repo.Get(ctx, "svc-1")
+	if err != nil || got.Name != "auth" {
+		t.Errorf("expected the existing service kept, got %+v, %v", got, err)
+	}
+}
+
+func testRegistryNotFound(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get: expected ErrNotFound, got %v", err)
+	}
+	if err := repo.Update(ctx, newService("missing", "auth", now())); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected an update of a missing service not to create it, got %v", err)
+	}
+	if err := repo.Deregister(ctx, "missing"); err != nil {
+		t.Errorf("deregister: expected no error, got %v", err)
+	}
+}
+
+func testRegistryUpdate(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	svc := newService("svc-1", "auth", now())
+	must(t, "register", repo.Register(ctx, svc))
+
+	updated := newService("svc-1", "auth", svc.RegisteredAt)
+	updated.Status = service.StatusUnhealthy
+	updated.OverrideStatus = true
+	updated.Capabilities = []string{"storage", "search"}
+	updated.LastHeartbeat = now()
+	must(t, "update", repo.Update(ctx, updated))
+
+	got, err := repo.Get(ctx, "svc-1")
+	if err != nil || !sameService(got, updated) {
+		t.Errorf("expected %+v, got %+v, %v", updated, got, err)
+	}
+}
+
+func testRegistryDeregister(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	must(t, "register", repo.Register(ctx, newService("svc-1", "auth", now())))
+	must(t, "register", repo.Register(ctx, newService("svc-2", "billing", now())))
+
+	must(t, "deregister", repo.Deregister(ctx, "svc-1"))
+	if _, err := repo.Get(ctx, "svc-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after deregister, got %v", err)
+	}
+	services, err := repo.List(ctx)
+	if err != nil || !slices.Equal(serviceIDs(services), []string{"svc-2"}) {
+		t.Errorf("expected only svc-2 listed, got %v, %v", serviceIDs(services), err)
+	}
+}
+
+func testRegistrySoftDelete(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	must(t, "register", repo.Register(ctx, newService("svc-1", "auth", now())))
+	deleted := newService("svc-2", "billing", now())
+	must(t, "register", repo.Register(ctx, deleted))
+	deleted.DeletedAt = now()
+	must(t, "update", repo.Update(ctx, deleted))
+
+	got, err := repo.Get(ctx, "svc-2")
+	if err != nil || !sameService(got, deleted) {
+		t.Errorf("expected soft-deleted services returned by get, got %+v, %v", got, err)
+	}
+	services, err := repo.List(ctx)
+	if err != nil || !slices.Equal(serviceIDs(services), []string{"svc-1"}) {
+		t.Errorf("expected soft-deleted services left out of list, got %v, %v", serviceIDs(services), err)
+	}
+
+	restored := newService("svc-2", "billing", deleted.RegisteredAt)
+	must(t, "restore", repo.Update(ctx, restored))
+	services, err = repo.List(ctx)
+	ids := serviceIDs(services)
+	slices.Sort(ids)
+	if err != nil || !slices.Equal(ids, []string{"svc-1", "svc-2"}) {
+		t.Errorf("expected a restored service listed again, got %v, %v", ids, err)
+	}
+}
+
+func testRegistryListPaged(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	registered := now()
+	for i, svc := range []*service.Service{newService("svc-a", "search", registered), newService("svc-b", "auth", registered), newService("svc-c", "billing", registered)} {
+		svc.RegisteredAt = registered.Add(time.Duration(-i) * time.Second)
+		svc.LastHeartbeat = registered.Add(time.Duration([]int{-5, 0, -10}[i]) * time.Second)
+		svc.Status = []service.Status{service.StatusHealthy, service.StatusUnhealthy, service.StatusUnknown}[i]
+		must(t, "register", repo.Register(ctx, svc))
+	}
+	acme := newService("svc-acme", "mail", registered)
+	acme.TenantID = "acme"
+	must(t, "register", repo.Register(ctx, acme))
+	deleted := newService("svc-deleted", "archive", registered)
+	deleted.DeletedAt = registered
+	must(t, "register", repo.Register(ctx, deleted))
+
+	tests := []struct {
+		name      string
+		filter    service.ListFilter
+		opts      pagination.ListOptions
+		wantIDs   []string
+		wantTotal int
+	}{
+		{name: "by id", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-a", "svc-b", "svc-c"}, wantTotal: 3},
+		{name: "by name", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 10, SortBy: service.SortByName}, wantIDs: []string{"svc-b", "svc-c", "svc-a"}, wantTotal: 3},
+		{name: "by registration", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 10, SortBy: service.SortByRegisteredAt}, wantIDs: []string{"svc-c", "svc-b", "svc-a"}, wantTotal: 3},
+		{name: "window", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 1, Offset: 1}, wantIDs: []string{"svc-b"}, wantTotal: 3},
+		{name: "past the end", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 10, Offset: 5}, wantIDs: []string{}, wantTotal: 3},
+		{name: "other tenant", filter: service.ListFilter{Scope: tenant.Only("acme")}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-acme"}, wantTotal: 1},
+		{name: "every tenant", filter: service.ListFilter{Scope: tenant.Unrestricted}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-a", "svc-acme", "svc-b", "svc-c"}, wantTotal: 4},
+		{name: "with deleted", filter: service.ListFilter{Scope: tenant.Unrestricted, IncludeDeleted: true}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-a", "svc-acme", "svc-b", "svc-c", "svc-deleted"}, wantTotal: 5},
+		{name: "by heartbeat", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 10, SortBy: service.SortByLastHeartbeat}, wantIDs: []string{"svc-c", "svc-a", "svc-b"}, wantTotal: 3},
+		{name: "descending", filter: service.ListFilter{Scope: tenant.Unrestricted}, opts: pagination.ListOptions{Limit: 2, Descending: true}, wantIDs: []string{"svc-c", "svc-b"}, wantTotal: 4},
+		{name: "descending by name", filter: service.ListFilter{Scope: tenant.Only("")}, opts: pagination.ListOptions{Limit: 10, SortBy: service.SortByName, Descending: true}, wantIDs: []string{"svc-a", "svc-c", "svc-b"}, wantTotal: 3},
+		{name: "by status", filter: service.ListFilter{Scope: tenant.Only(""), Statuses: []service.Status{service.StatusUnhealthy, service.StatusUnknown}}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-b", "svc-c"}, wantTotal: 2},
+		{name: "registered since", filter: service.ListFilter{Scope: tenant.Only(""), RegisteredSince: registered.Add(-time.Second)}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-a", "svc-b"}, wantTotal: 2},
+		{name: "name prefix", filter: service.ListFilter{Scope: tenant.Unrestricted, IncludeDeleted: true, NamePrefix: "a"}, opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"svc-b", "svc-deleted"}, wantTotal: 2},
+		{name: "combined", filter: service.ListFilter{Scope: tenant.Unrestricted, Statuses: []service.Status{service.StatusHealthy}, RegisteredSince: registered.Add(-time.Second)}, opts: pagination.ListOptions{Limit: 1, Offset: 1}, wantIDs: []string{"svc-acme"}, wantTotal: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, total, err := repo.ListPaged(ctx, tt.filter, tt.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if total != tt.wantTotal || !slices.Equal(serviceIDs(services), tt.wantIDs) {
+				t.Errorf("expected %v of %d, got %v of %d", tt.wantIDs, tt.wantTotal, serviceIDs(services), total)
+			}
+		})
+	}
+}
+
+func testRegistryPurge(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	cutoff := now()
+	must(t, "register", repo.Register(ctx, newService("svc-live", "auth", cutoff)))
+	for id, deletedAt := range map[string]time.Time{"svc-old": cutoff.Add(-time.Hour), "svc-recent": cutoff.Add(time.Minute)} {
+		svc := newService(id, "billing", cutoff.Add(-2*time.Hour))
+		svc.DeletedAt = deletedAt
+		must(t, "register", repo.Register(ctx, svc))
+	}
+
+	purged, err := repo.Purge(ctx, cutoff)
+	if err != nil || purged != 1 {
+		t.Fatalf("expected one service purged, got %d, %v", purged, err)
+	}
+	if _, err := repo.Get(ctx, "svc-old"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected svc-old purged, got %v", err)
+	}
+	for _, id := range []string{"svc-live", "svc-recent"} {
+		if _, err := repo.Get(ctx, id); err != nil {
+			t.Errorf("expected %s kept, got %v", id, err)
+		}
+	}
+	if purged, err := repo.Purge(ctx, cutoff); err != nil || purged != 0 {
+		t.Errorf("expected nothing left to purge, got %d, %v", purged, err)
+	}
+}
+
+func testRegistryRevision(t *testing.T, repo service.RegistryRepository) {
+	ctx := context.Background()
+	start, err := repo.GetRevision(ctx)
+	must(t, "get revision", err)
+
+	last := start
+	for range 3 {
+		rev, err := repo.BumpRevision(ctx)
+		must(t, "bump revision", err)
+		if rev <= last {
+			t.Fatalf("expected the revision to move forward from %d, got %d", last, rev)
+		}
+		last = rev
+	}
+	if rev, err := repo.GetRevision(ctx); err != nil || rev != last {
+		t.Errorf("expected revision %d, got %d, %v", last, rev, err)
+	}
+}
+
+func testRegistryFindByCapability(t *testing.T, repo service.RegistryRepository) {
+	finder, ok := repo.(service.CapabilityFinder)
+	if !ok {
+		t.Skip("repository does not implement service.CapabilityFinder")
+	}
+	ctx := context.Background()
+	search := newService("svc-search", "search", now())
+	search.Capabilities = []string{"search", "storage"}
+	must(t, "register", repo.Register(ctx, search))
+	must(t, "register", repo.Register(ctx, newService("svc-storage", "storage", now())))
+	deleted := newService("svc-deleted", "archive", now())
+	deleted.Capabilities = []string{"search"}
+	deleted.DeletedAt = now()
+	must(t, "register", repo.Register(ctx, deleted))
+
+	tests := []struct {
+		capability string
+		wantIDs    []string
+	}{
+		{capability: "search", wantIDs: []string{"svc-search"}},
+		{capability: "storage", wantIDs: []string{"svc-search", "svc-storage"}},
+		{capability: "mail", wantIDs: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.capability, func(t *testing.T) {
+			services, err := finder.FindByCapability(ctx, tt.capability)
+			ids := serviceIDs(services)
+			slices.Sort(ids)
+			if err != nil || !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("expected %v, got %v, %v", tt.wantIDs, ids, err)
+			}
+		})
+	}
+}
+
+func testRegistryUpdateHeartbeat(t *testing.T, repo service.RegistryRepository) {
+	updater, ok := repo.(service.HeartbeatUpdater)
+	if !ok {
+		t.Skip("repository does not implement service.HeartbeatUpdater")
+	}
+	ctx := context.Background()
+	unhealthy := newService("svc-unhealthy", "auth", now())
+	unhealthy.Status = service.StatusUnhealthy
+	must(t, "register", repo.Register(ctx, unhealthy))
+	overridden := newService("svc-overridden", "billing", now())
+	overridden.Status = service.StatusDraining
+	overridden.OverrideStatus = true
+	must(t, "register", repo.Register(ctx, overridden))
+	deleted := newService("svc-deleted", "archive", now())
+	deleted.DeletedAt = now()
+	must(t, "register", repo.Register(ctx, deleted))
+
+	at := now().Add(time.Minute)
+	tests := []struct {
+		id         string
+		wantErr    error
+		wantStatus service.Status
+	}{
+		{id: "svc-unhealthy", wantStatus: service.StatusHealthy},
+		{id: "svc-overridden", wantStatus: service.StatusDraining},
+		{id: "svc-deleted", wantErr: service.ErrServiceDeleted},
+		{id: "missing", wantErr: service.ErrServiceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := updater.UpdateHeartbeat(ctx, tt.id, at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			got, err := repo.Get(ctx, tt.id)
+			if err != nil || got.Status != tt.wantStatus || !got.LastHeartbeat.Equal(at) {
+				t.Errorf("expected status %s and heartbeat %v, got %+v, %v", tt.wantStatus, at, got, err)
+			}
+		})
+	}
+
+	if got, err := repo.Get(ctx, "svc-deleted"); err != nil || !got.LastHeartbeat.IsZero() {
+		t.Errorf("expected the soft-deleted service left untouched, got %+v, %v", got, err)
+	}
+}
+
+func testRegistryBatchUpdate(t *testing.T, repo service.RegistryRepository) {
+	updater, ok := repo.(service.BatchUpdater)
+	if !ok {
+		t.Skip("repository does not implement service.BatchUpdater")
+	}
+	ctx := context.Background()
+	first, second := newService("svc-1", "auth", now()), newService("svc-2", "billing", now())
+	must(t, "register", repo.Register(ctx, first))
+	must(t, "register", repo.Register(ctx, second))
+
+	updatedFirst, updatedSecond := *first, *second
+	updatedFirst.Status = service.StatusUnhealthy
+	updatedSecond.Status = service.StatusUnknown
+	missing := newService("missing", "mail", now())
+	if err := updater.BatchUpdate(ctx, []*service.Service{&updatedFirst, missing, &updatedSecond}); err != nil {
+		t.Fatalf("expected services no longer stored skipped, got %v", err)
+	}
+
+	for _, want := range []*service.Service{&updatedFirst, &updatedSecond} {
+		if got, err := repo.Get(ctx, want.ID); err != nil || !sameService(got, want) {
+			t.Errorf("expected %+v stored, got %+v, %v", want, got, err)
+		}
+	}
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the missing service left unstored, got %v", err)
+	}
+}
+
+func testRegistryTransaction(t *testing.T, repo service.RegistryRepository) {
+	tx, ok := repo.(repository.Transactor)
+	if !ok {
+		t.Skip("repository does not implement repository.Transactor")
+	}
+	ctx := context.Background()
+	must(t, "register", repo.Register(ctx, newService("svc-1", "auth", now())))
+
+	errAbort := errors.New("abort")
+	err := tx.WithinTx(ctx, func(ctx context.Context) error {
+		must(t, "register in transaction", repo.Register(ctx, newService("svc-2", "billing", now())))
+		must(t, "deregister in transaction", repo.Deregister(ctx, "svc-1"))
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-1"); err != nil {
+		t.Errorf("expected the deregistration rolled back, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-2"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the registration rolled back, got %v", err)
+	}
+
+	err = tx.WithinTx(ctx, func(ctx context.Context) error {
+		return repo.Register(ctx, newService("svc-2", "billing", now()))
+	})
+	if err != nil {
+		t.Fatalf("expected the transaction committed, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-2"); err != nil {
+		t.Errorf("expected the registration committed, got %v", err)
+	}
+}
+
+func testRegistryCancellation(t *testing.T, repo service.RegistryRepository) {
+	must(t, "register", repo.Register(context.Background(), newService("svc-1", "auth", now())))
+	ctx := cancelled()
+
+	expectCancelled(t, "register", repo.Register(ctx, newService("svc-2", "billing", now())))
+	_, err := repo.CreateIfAbsent(ctx, newService("svc-2", "billing", now()))
+	expectCancelled(t, "create if absent", err)
+	_, err = repo.Get(ctx, "svc-1")
+	expectCancelled(t, "get", err)
+	_, err = repo.List(ctx)
+	expectCancelled(t, "list", err)
+	_, _, err = repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted}, pagination.ListOptions{Limit: 10})
+	expectCancelled(t, "list paged", err)
+	expectCancelled(t, "update", repo.Update(ctx, newService("svc-1", "renamed", now())))
+	expectCancelled(t, "deregister", repo.Deregister(ctx, "svc-1"))
+	_, err = repo.Purge(ctx, now())
+	expectCancelled(t, "purge", err)
+	_, err = repo.GetRevision(ctx)
+	expectCancelled(t, "get revision", err)
+	_, err = repo.BumpRevision(ctx)
+	expectCancelled(t, "bump revision", err)
+	if finder, ok := repo.(service.CapabilityFinder); ok {
+		_, err = finder.FindByCapability(ctx, "storage")
+		expectCancelled(t, "find by capability", err)
+	}
+	if updater, ok := repo.(service.HeartbeatUpdater); ok {
+		expectCancelled(t, "update heartbeat", updater.UpdateHeartbeat(ctx, "svc-1", now()))
+	}
+
+	// Nothing called with the cancelled context took effect
+	got, err := repo.Get(context.Background(), "svc-1")
+	if err != nil || got.Name != "auth" || !got.LastHeartbeat.IsZero() {
+		t.Errorf("expected svc-1 unchanged, got %+v, %v", got, err)
+	}
+	if _, err := repo.Get(context.Background(), "svc-2"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected svc-2 not registered, got %v", err)
+	}
+}
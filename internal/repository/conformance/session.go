@@ -0,0 +1,345 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+)
+
+// SessionOptions describes where a session repository may differ from the
+// others within the contract
+type SessionOptions struct {
+	// ExpiresByTTL is set when the storage drops expired sessions on its own,
+	// so DeleteExpired has nothing to remove and doesn't touch the storage
+	ExpiresByTTL bool
+}
+
+// TestSessionRepository runs the session repository contract against the
+// repositories newRepo returns, an empty one for each case
+func TestSessionRepository(t *testing.T, newRepo func(t *testing.T) session.SessionRepository, opts SessionOptions) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo session.SessionRepository, opts SessionOptions)
+	}{
+		{"create and get", testSessionCreateGet},
+		{"duplicate", testSessionDuplicate},
+		{"not found", testSessionNotFound},
+		{"update", testSessionUpdate},
+		{"delete", testSessionDelete},
+		{"list by user", testSessionListByUser},
+		{"get by user and service", testSessionGetByUserService},
+		{"expiry", testSessionExpiry},
+		{"remove expired", testSessionRemoveExpired},
+		{"cancellation", testSessionCancellation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t), opts)
+		})
+	}
+}
+
+// newSession returns a session of userID on serviceID created at created and
+// expiring ttl later
+func newSession(id, userID, serviceID string, created time.Time, ttl time.Duration) *session.Session {
+	return &session.Session{
+		ID:        id,
+		UserID:    userID,
+		ServiceID: serviceID,
+		Data:      map[string]any{"theme": "dark"},
+		CreatedAt: created,
+		UpdatedAt: created,
+		ExpiresAt: created.Add(ttl),
+	}
+}
+
+// sameSession reports whether got holds what want was stored with. Data is
+// compared by its string values, which every backend returns unchanged.
+func sameSession(got, want *session.Session) bool {
+	return got.ID == want.ID && got.UserID == want.UserID && got.ServiceID == want.ServiceID &&
+		got.TenantID == want.TenantID && got.Data["theme"] == want.Data["theme"] &&
+		got.CreatedAt.Equal(want.CreatedAt) && got.UpdatedAt.Equal(want.UpdatedAt) && got.ExpiresAt.Equal(want.ExpiresAt)
+}
+
+// sessionIDs returns the IDs of sessions in order
+func sessionIDs(sessions []*session.Session) []string {
+	ids := make([]string, len(sessions))
+	for i, sess := range sessions {
+		ids[i] = sess.ID
+	}
+	return ids
+}
+
+func testSessionCreateGet(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+	sess := newSession("sess-1", "user-1", "web", now(), time.Hour)
+	sess.TenantID = "acme"
+	must(t, "create", repo.Create(ctx, sess))
+
+	got, err := repo.Get(ctx, "sess-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !sameSession(got, sess) {
+		t.Errorf("expected %+v, got %+v", sess, got)
+	}
+}
+
+func testSessionDuplicate(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+	first := newSession("sess-1", "user-1", "web", now(), time.Hour)
+	must(t, "create", repo.Create(ctx, first))
+
+	second := newSession("sess-1", "user-2", "api", now(), time.Hour)
+	second.Data = map[string]any{"theme": "light"}
+	if err := repo.Create(ctx, second); !errors.Is(err, repository.ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+
+	got, err := repo.Get(ctx, "sess-1")
+	if err != nil || !sameSession(got, first) {
+		t.Errorf("expected the first session kept, got %+v, %v", got, err)
+	}
+}
+
+func testSessionNotFound(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get: expected ErrNotFound, got %v", err)
+	}
+	if err := repo.Update(ctx, newSession("missing", "user-1", "web", now(), time.Hour)); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected an update of a missing session not to create it, got %v", err)
+	}
+	if err := repo.Delete(ctx, "missing"); err != nil {
+		t.Errorf("delete: expected no error, got %v", err)
+	}
+	if _, err := repo.GetByUserService(ctx, tenant.Unrestricted, "user-1", "web"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by user and service: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testSessionUpdate(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+	created := now()
+	must(t, "create", repo.Create(ctx, newSession("sess-1", "user-1", "web", created, time.Hour)))
+
+	updated := newSession("sess-1", "user-1", "web", created, 2*time.Hour)
+	updated.Data = map[string]any{"theme": "light"}
+	updated.UpdatedAt = created.Add(time.Minute)
+	must(t, "update", repo.Update(ctx, updated))
+
+	got, err := repo.Get(ctx, "sess-1")
+	if err != nil || !sameSession(got, updated) {
+		t.Errorf("expected %+v, got %+v, %v", updated, got, err)
+	}
+}
+
+func testSessionDelete(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+	must(t, "create", repo.Create(ctx, newSession("sess-1", "user-1", "web", now(), time.Hour)))
+	must(t, "create", repo.Create(ctx, newSession("sess-2", "user-1", "web", now(), time.Hour)))
+
+	must(t, "delete", repo.Delete(ctx, "sess-1"))
+	if _, err := repo.Get(ctx, "sess-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	sessions, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10})
+	if err != nil || total != 1 || !slices.Equal(sessionIDs(sessions), []string{"sess-2"}) {
+		t.Errorf("expected only sess-2 listed, got %v (total %d), %v", sessionIDs(sessions), total, err)
+	}
+}
+
+func testSessionListByUser(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+	created := now()
+	for i, id := range []string{"sess-c", "sess-a", "sess-b"} {
+		must(t, "create", repo.Create(ctx, newSession(id, "user-1", "web", created.Add(time.Duration(i)*time.Second), time.Duration(3-i)*time.Hour)))
+	}
+	must(t, "create", repo.Create(ctx, newSession("sess-other", "user-2", "web", created, time.Hour)))
+	acme := newSession("sess-acme", "user-1", "web", created, time.Hour)
+	acme.TenantID = "acme"
+	must(t, "create", repo.Create(ctx, acme))
+
+	tests := []struct {
+		name      string
+		scope     tenant.Scope
+		opts      pagination.ListOptions
+		wantIDs   []string
+		wantTotal int
+	}{
+		{name: "by creation", scope: tenant.Only(""), opts: pagination.ListOptions{Limit: 2}, wantIDs: []string{"sess-c", "sess-a"}, wantTotal: 3},
+		{name: "second page", scope: tenant.Only(""), opts: pagination.ListOptions{Limit: 2, Offset: 2}, wantIDs: []string{"sess-b"}, wantTotal: 3},
+		{name: "by id", scope: tenant.Only(""), opts: pagination.ListOptions{Limit: 10, SortBy: session.SortByID}, wantIDs: []string{"sess-a", "sess-b", "sess-c"}, wantTotal: 3},
+		{name: "by expiry", scope: tenant.Only(""), opts: pagination.ListOptions{Limit: 10, SortBy: session.SortByExpiresAt}, wantIDs: []string{"sess-b", "sess-a", "sess-c"}, wantTotal: 3},
+		{name: "other tenant", scope: tenant.Only("acme"), opts: pagination.ListOptions{Limit: 10}, wantIDs: []string{"sess-acme"}, wantTotal: 1},
+		{name: "every tenant", scope: tenant.Unrestricted, opts: pagination.ListOptions{Limit: 10, SortBy: session.SortByID}, wantIDs: []string{"sess-a", "sess-acme", "sess-b", "sess-c"}, wantTotal: 4},
+		{name: "past the end", scope: tenant.Only(""), opts: pagination.ListOptions{Limit: 10, Offset: 5}, wantIDs: []string{}, wantTotal: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, total, err := repo.ListByUser(ctx, tt.scope, "user-1", tt.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if total != tt.wantTotal || !slices.Equal(sessionIDs(sessions), tt.wantIDs) {
+				t.Errorf("expected %v of %d, got %v of %d", tt.wantIDs, tt.wantTotal, sessionIDs(sessions), total)
+			}
+		})
+	}
+}
+
+func testSessionGetByUserService(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	ctx := context.Background()
+	created := now()
+	must(t, "create", repo.Create(ctx, newSession("sess-old", "user-1", "web", created, time.Hour)))
+	must(t, "create", repo.Create(ctx, newSession("sess-new", "user-1", "web", created.Add(time.Second), time.Hour)))
+	must(t, "create", repo.Create(ctx, newSession("sess-api", "user-1", "api", created.Add(2*time.Second), time.Hour)))
+	must(t, "create", repo.Create(ctx, newSession("sess-other", "user-2", "web", created.Add(2*time.Second), time.Hour)))
+	acme := newSession("sess-acme", "user-1", "web", created.Add(3*time.Second), time.Hour)
+	acme.TenantID = "acme"
+	must(t, "create", repo.Create(ctx, acme))
+
+	tests := []struct {
+		name      string
+		scope     tenant.Scope
+		serviceID string
+		wantID    string // "" expects ErrNotFound
+	}{
+		{name: "newest", scope: tenant.Only(""), serviceID: "web", wantID: "sess-new"},
+		{name: "other service", scope: tenant.Only(""), serviceID: "api", wantID: "sess-api"},
+		{name: "other tenant", scope: tenant.Only("acme"), serviceID: "web", wantID: "sess-acme"},
+		{name: "every tenant", scope: tenant.Unrestricted, serviceID: "web", wantID: "sess-acme"},
+		{name: "unknown service", scope: tenant.Unrestricted, serviceID: "mobile"},
+		{name: "tenant without sessions", scope: tenant.Only("globex"), serviceID: "web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetByUserService(ctx, tt.scope, "user-1", tt.serviceID)
+			if tt.wantID == "" {
+				if !errors.Is(err, repository.ErrNotFound) {
+					t.Errorf("expected ErrNotFound, got %v, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got.ID != tt.wantID {
+				t.Errorf("expected %s, got %v, %v", tt.wantID, got, err)
+			}
+		})
+	}
+}
+
+func testSessionExpiry(t *testing.T, repo session.SessionRepository, opts SessionOptions) {
+	ctx := context.Background()
+	created := now().Add(-2 * time.Hour)
+	active := newSession("sess-active", "user-1", "web", created, 3*time.Hour)
+	must(t, "create", repo.Create(ctx, active))
+	must(t, "create", repo.Create(ctx, newSession("sess-expired", "user-1", "web", created.Add(time.Second), time.Hour)))
+
+	sessions, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10})
+	if err != nil || total != 1 || !slices.Equal(sessionIDs(sessions), []string{"sess-active"}) {
+		t.Errorf("expected expired sessions left out of lists, got %v (total %d), %v", sessionIDs(sessions), total, err)
+	}
+	if got, err := repo.GetByUserService(ctx, tenant.Unrestricted, "user-1", "web"); err != nil || got.ID != "sess-active" {
+		t.Errorf("expected the newest active session, not the newer expired one, got %v, %v", got, err)
+	}
+	if counter, ok := repo.(session.ActiveCounter); ok {
+		if count, err := counter.CountActive(ctx, time.Now()); err != nil || count != 1 {
+			t.Errorf("expected one active session counted, got %d, %v", count, err)
+		}
+	}
+
+	deleted, err := repo.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	if !opts.ExpiresByTTL && deleted != 1 {
+		t.Errorf("expected one expired session deleted, got %d", deleted)
+	}
+	if got, err := repo.Get(ctx, "sess-active"); err != nil || !sameSession(got, active) {
+		t.Errorf("expected the active session kept, got %v, %v", got, err)
+	}
+}
+
+func testSessionRemoveExpired(t *testing.T, repo session.SessionRepository, _ SessionOptions) {
+	remover, ok := repo.(session.ExpiredRemover)
+	if !ok {
+		t.Skip("repository can't return the expired sessions it removes")
+	}
+	ctx := context.Background()
+	created := now().Add(-2 * time.Hour)
+	expired := newSession("sess-expired", "user-1", "web", created, time.Hour)
+	expired.TenantID = "acme"
+	must(t, "create", repo.Create(ctx, expired))
+	must(t, "create", repo.Create(ctx, newSession("sess-active", "user-1", "web", created, 3*time.Hour)))
+
+	removed, err := remover.RemoveExpired(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("remove expired: %v", err)
+	}
+	if len(removed) != 1 || removed[0].ID != "sess-expired" || removed[0].TenantID != "acme" ||
+		removed[0].UserID != "user-1" || removed[0].ServiceID != "web" || !removed[0].ExpiresAt.Equal(expired.ExpiresAt) {
+		t.Fatalf("expected the expired session returned, got %+v", removed)
+	}
+	if removed, err := remover.RemoveExpired(ctx, time.Now()); err != nil || len(removed) != 0 {
+		t.Errorf("expected nothing left to remove, got %v, %v", sessionIDs(removed), err)
+	}
+	if _, err := repo.Get(ctx, "sess-active"); err != nil {
+		t.Errorf("expected the active session kept, got %v", err)
+	}
+}
+
+func testSessionCancellation(t *testing.T, repo session.SessionRepository, opts SessionOptions) {
+	must(t, "create", repo.Create(context.Background(), newSession("sess-1", "user-1", "web", now(), time.Hour)))
+	ctx := cancelled()
+
+	expectCancelled(t, "create", repo.Create(ctx, newSession("sess-2", "user-1", "web", now(), time.Hour)))
+	_, err := repo.Get(ctx, "sess-1")
+	expectCancelled(t, "get", err)
+	expectCancelled(t, "update", repo.Update(ctx, newSession("sess-1", "user-1", "web", now(), 2*time.Hour)))
+	expectCancelled(t, "delete", repo.Delete(ctx, "sess-1"))
+	_, _, err = repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10})
+	expectCancelled(t, "list by user", err)
+	_, err = repo.GetByUserService(ctx, tenant.Unrestricted, "user-1", "web")
+	expectCancelled(t, "get by user and service", err)
+	if !opts.ExpiresByTTL {
+		_, err = repo.DeleteExpired(ctx)
+		expectCancelled(t, "delete expired", err)
+	}
+	if remover, ok := repo.(session.ExpiredRemover); ok {
+		_, err = remover.RemoveExpired(ctx, time.Now())
+		expectCancelled(t, "remove expired", err)
+	}
+	if counter, ok := repo.(session.ActiveCounter); ok {
+		_, err = counter.CountActive(ctx, time.Now())
+		expectCancelled(t, "count active", err)
+	}
+
+	deadline, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := repo.Get(deadline, "sess-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("get past a deadline: expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// Nothing called with the cancelled context took effect
+	got, err := repo.Get(context.Background(), "sess-1")
+	if err != nil || !got.ExpiresAt.Equal(got.CreatedAt.Add(time.Hour)) {
+		t.Errorf("expected sess-1 unchanged, got %+v, %v", got, err)
+	}
+	if _, err := repo.Get(context.Background(), "sess-2"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected sess-2 not created, got %v", err)
+	}
+}
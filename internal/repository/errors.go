@@ -0,0 +1,16 @@
+// Package repository defines the errors and optional capabilities shared by
+// every storage backend. Backends wrap the errors, directly or through the
+// domain sentinels built on them, so callers can tell failures apart with
+// errors.Is whichever backend is configured.
+package repository
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when no record is stored under a key
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a record is created under a key that is already taken
+	ErrDuplicate = errors.New("already exists")
+	// ErrConflict is returned when a write loses to concurrent writes and gives up
+	ErrConflict = errors.New("conflicting concurrent update")
+)
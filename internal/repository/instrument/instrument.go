@@ -0,0 +1,111 @@
+// Package instrument wraps session and registry repositories to time every
+// call. Durations are recorded as a histogram labeled by repository, method
+// and outcome, and calls slower than a threshold are logged with the
+// identifiers they were made with, never the records they read or wrote.
+//
+// Services detect optional capabilities, like service.CapabilityFinder, by
+// type assertion, so a wrapper implements exactly the optional interfaces of
+// the repository it wraps: wrapping never hides a fast path nor advertises
+// one the backend lacks.
+package instrument
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/tracing"
+)
+
+// DurationMetric is the name of the histogram of repository call durations
+const DurationMetric = "repository.call.duration"
+
+// Call outcomes
+const (
+	OutcomeOK       = "ok"
+	OutcomeNotFound = "not_found" // the record asked for isn't stored
+	OutcomeError    = "error"
+)
+
+// Config configures instrumented repositories
+type Config struct {
+	// MeterProvider records call durations; nil records none
+	MeterProvider metric.MeterProvider
+	// SlowThreshold is how long a call may take before it is logged; 0 logs none
+	SlowThreshold time.Duration
+	Clock         clock.Clock // nil uses the real clock
+}
+
+// recorder times the calls of one repository
+type recorder struct {
+	repository string
+	duration   metric.Float64Histogram
+	slow       time.Duration
+	clock      clock.Clock
+	logger     logger.ILogger
+}
+
+func newRecorder(name string, cfg Config, log logger.ILogger) *recorder {
+	provider := cfg.MeterProvider
+	if provider == nil {
+		provider = noop.NewMeterProvider()
+	}
+	duration, err := provider.Meter(tracing.InstrumentationName).Float64Histogram(DurationMetric,
+		metric.WithDescription("Duration of repository calls"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		// The returned histogram still works; the provider only reports the problem
+		log.Warn("create repository duration histogram failed", "repository", name, "error", err)
+	}
+
+	return &recorder{
+		repository: name,
+		duration:   duration,
+		slow:       cfg.SlowThreshold,
+		clock:      clock.OrReal(cfg.Clock),
+		logger:     log,
+	}
+}
+
+// start returns the time a call starts at
+func (r *recorder) start() time.Time {
+	return r.clock.Now()
+}
+
+// done records a call to method that started at start and returned err.
+// ids are key/value pairs identifying what the call was about, logged when
+// the call was slow.
+func (r *recorder) done(ctx context.Context, method string, start time.Time, err error, ids ...any) {
+	elapsed := r.clock.Now().Sub(start)
+	outcome := Outcome(err)
+	r.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(
+		attribute.String("repository", r.repository),
+		attribute.String("method", method),
+		attribute.String("outcome", outcome),
+	))
+
+	if r.slow > 0 && elapsed > r.slow {
+		fields := append([]any{"repository", r.repository, "method", method, "duration", elapsed.String(), "outcome", outcome}, ids...)
+		r.logger.Warn("slow repository call", fields...)
+	}
+}
+
+// Outcome classifies the error a repository call returned
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, repository.ErrNotFound):
+		return OutcomeNotFound
+	default:
+		return OutcomeError
+	}
+}
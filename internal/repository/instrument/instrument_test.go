@@ -0,0 +1,153 @@
+package instrument
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// collect returns how many calls were recorded per repository, method and
+// outcome, keyed as "repository method outcome"
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]uint64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+
+	calls := make(map[string]uint64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != DurationMetric {
+				continue
+			}
+			histogram, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok {
+				t.Fatalf("expected %s to be a float histogram, got %T", DurationMetric, m.Data)
+			}
+			for _, point := range histogram.DataPoints {
+				value := func(key string) string {
+					v, _ := point.Attributes.Value(attribute.Key(key))
+					return v.AsString()
+				}
+				calls[fmt.Sprintf("%s %s %s", value("repository"), value("method"), value("outcome"))] += point.Count
+			}
+		}
+	}
+	return calls
+}
+
+// slowSessions is a session repository whose Get takes delay on clk
+type slowSessions struct {
+	*memory.SessionRepository
+	clk   *clock.Fake
+	delay time.Duration
+}
+
+func (s *slowSessions) Get(ctx context.Context, id string) (*session.Session, error) {
+	s.clk.Advance(s.delay)
+	return s.SessionRepository.Get(ctx, id)
+}
+
+func TestRecorder_Metrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	repo := NewSessionRepository(memory.NewSessionRepository(), Config{
+		MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	}, logger.NewNop())
+
+	ctx := context.Background()
+	sess := &session.Session{ID: "sess-1", UserID: "user-1", ServiceID: "web", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repo.Create(ctx, sess); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	repo.Create(ctx, sess)
+	repo.Get(ctx, "sess-1")
+	repo.Get(ctx, "missing")
+	repo.Get(ctx, "missing")
+
+	want := map[string]uint64{
+		"sessions Create ok":     1,
+		"sessions Create error":  1,
+		"sessions Get ok":        1,
+		"sessions Get not_found": 2,
+	}
+	got := collect(t, reader)
+	if len(got) != len(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for key, count := range want {
+		if got[key] != count {
+			t.Errorf("expected %d calls recorded as %q, got %d", count, key, got[key])
+		}
+	}
+}
+
+func TestRecorder_SlowCalls(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		delay     time.Duration
+		wantLog   bool
+	}{
+		{name: "slow call logged", threshold: 100 * time.Millisecond, delay: 250 * time.Millisecond, wantLog: true},
+		{name: "fast call not logged", threshold: 100 * time.Millisecond, delay: 50 * time.Millisecond},
+		{name: "at the threshold not logged", threshold: 100 * time.Millisecond, delay: 100 * time.Millisecond},
+		{name: "disabled", delay: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+			inner := &slowSessions{SessionRepository: memory.NewSessionRepository(), clk: clk, delay: tt.delay}
+			var buf bytes.Buffer
+			repo := NewSessionRepository(inner, Config{SlowThreshold: tt.threshold, Clock: clk},
+				logger.NewLogger(logger.Config{Output: &buf}))
+
+			ctx := context.Background()
+			sess := &session.Session{ID: "sess-1", UserID: "user-1", ServiceID: "web", ExpiresAt: clk.Now().Add(time.Hour),
+				Data: map[string]any{"card": "4111-1111"}}
+			if err := repo.Create(ctx, sess); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if _, err := repo.Get(ctx, "sess-1"); err != nil {
+				t.Fatalf("get: %v", err)
+			}
+
+			if !tt.wantLog {
+				if buf.Len() > 0 {
+					t.Errorf("expected nothing logged, got %s", buf.String())
+				}
+				return
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("expected one log entry, got %q: %v", buf.String(), err)
+			}
+			want := map[string]any{
+				"level": "WARN", "msg": "slow repository call", "repository": "sessions", "method": "Get",
+				"duration": tt.delay.String(), "outcome": OutcomeOK, "session_id": "sess-1",
+			}
+			for key, value := range want {
+				if entry[key] != value {
+					t.Errorf("expected %s %v, got %v", key, value, entry[key])
+				}
+			}
+			if strings.Contains(buf.String(), "4111") {
+				t.Errorf("expected the session's data left out, got %s", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package instrument
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// Optional registry repository capabilities, as bits of a mask
+const (
+	registryFinder = 1 << iota
+	registryHeartbeat
+	registryTransactor
+	registryBatch
+)
+
+// registry times the calls of a registry repository. It has the methods of
+// every optional interface; NewRegistryRepository exposes those repo has.
+type registry struct {
+	repo       service.RegistryRepository
+	finder     service.CapabilityFinder
+	heartbeat  service.HeartbeatUpdater
+	transactor repository.Transactor
+	batch      service.BatchUpdater
+	recorder   *recorder
+}
+
+// NewRegistryRepository returns repo with every call timed. The result
+// implements service.CapabilityFinder, service.HeartbeatUpdater,
+// service.BatchUpdater and repository.Transactor when repo does, and returns repo from an Unwrap
+// method. A transaction is timed as a whole, and the calls made within it one
+// by one.
+func NewRegistryRepository(repo service.RegistryRepository, cfg Config, log logger.ILogger) service.RegistryRepository {
+	r := &registry{repo: repo, recorder: newRecorder("registry", cfg, log)}
+	r.finder, _ = repo.(service.CapabilityFinder)
+	r.heartbeat, _ = repo.(service.HeartbeatUpdater)
+	r.transactor, _ = repo.(repository.Transactor)
+	r.batch, _ = repo.(service.BatchUpdater)
+	return r.withCapabilities(r.capabilities())
+}
+
+// capabilities returns the mask of the optional interfaces repo implements
+func (r *registry) capabilities() int {
+	var mask int
+	if r.finder != nil {
+		mask |= registryFinder
+	}
+	if r.heartbeat != nil {
+		mask |= registryHeartbeat
+	}
+	if r.transactor != nil {
+		mask |= registryTransactor
+	}
+	if r.batch != nil {
+		mask |= registryBatch
+	}
+	return mask
+}
+
+// withCapabilities returns r implementing the optional interfaces in mask and
+// no others
+func (r *registry) withCapabilities(mask int) service.RegistryRepository {
+	type (
+		repo interface {
+			service.RegistryRepository
+			Unwrap() service.RegistryRepository
+		}
+		finder     = service.CapabilityFinder
+		heartbeat  = service.HeartbeatUpdater
+		transactor = repository.Transactor
+		batch      = service.BatchUpdater
+	)
+
+	switch mask {
+	case registryFinder:
+		return struct {
+			repo
+			finder
+		}{r, r}
+	case registryHeartbeat:
+		return struct {
+			repo
+			heartbeat
+		}{r, r}
+	case registryFinder | registryHeartbeat:
+		return struct {
+			repo
+			finder
+			heartbeat
+		}{r, r, r}
+	case registryTransactor:
+		return struct {
+			repo
+			transactor
+		}{r, r}
+	case registryFinder | registryTransactor:
+		return struct {
+			repo
+			finder
+			transactor
+		}{r, r, r}
+	case registryHeartbeat | registryTransactor:
+		return struct {
+			repo
+			heartbeat
+			transactor
+		}{r, r, r}
+	case registryFinder | registryHeartbeat | registryTransactor:
+		return struct {
+			repo
+			finder
+			heartbeat
+			transactor
+		}{r, r, r, r}
+	case registryBatch:
+		return struct {
+			repo
+			batch
+		}{r, r}
+	case registryFinder | registryBatch:
+		return struct {
+			repo
+			finder
+			batch
+		}{r, r, r}
+	case registryHeartbeat | registryBatch:
+		return struct {
+			repo
+			heartbeat
+			batch
+		}{r, r, r}
+	case registryFinder | registryHeartbeat | registryBatch:
+		return struct {
+			repo
+			finder
+			heartbeat
+			batch
+		}{r, r, r, r}
+	case registryTransactor | registryBatch:
+		return struct {
+			repo
+			transactor
+			batch
+		}{r, r, r}
+	case registryFinder | registryTransactor | registryBatch:
+		return struct {
+			repo
+			finder
+			transactor
+			batch
+		}{r, r, r, r}
+	case registryHeartbeat | registryTransactor | registryBatch:
+		return struct {
+			repo
+			heartbeat
+			transactor
+			batch
+		}{r, r, r, r}
+	case registryFinder | registryHeartbeat | registryTransactor | registryBatch:
+		return struct {
+			repo
+			finder
+			heartbeat
+			transactor
+			batch
+		}{r, r, r, r, r}
+	default:
+		return struct{ repo }{r}
+	}
+}
+
+// Unwrap returns the repository the calls are passed to
+func (r *registry) Unwrap() service.RegistryRepository {
+	return r.repo
+}
+
+func (r *registry) Register(ctx context.Context, svc *service.Service) error {
+	start := r.recorder.start()
+	err := r.repo.Register(ctx, svc)
+	r.recorder.done(ctx, "Register", start, err, "service_id", svc.ID)
+	return err
+}
+
+func (r *registry) CreateIfAbsent(ctx context.Context, svc *service.Service) (*service.Service, error) {
+	start := r.recorder.start()
+	existing, err := r.repo.CreateIfAbsent(ctx, svc)
+	r.recorder.done(ctx, "CreateIfAbsent", start, err, "service_id", svc.ID)
+	return existing, err
+}
+
+func (r *registry) Deregister(ctx context.Context, id string) error {
+	start := r.recorder.start()
+	err := r.repo.Deregister(ctx, id)
+	r.recorder.done(ctx, "Deregister", start, err, "service_id", id)
+	return err
+}
+
+func (r *registry) Get(ctx context.Context, id string) (*service.Service, error) {
+	start := r.recorder.start()
+	svc, err := r.repo.Get(ctx, id)
+	r.recorder.done(ctx, "Get", start, err, "service_id", id)
+	return svc, err
+}
+
+func (r *registry) List(ctx context.Context) ([]*service.Service, error) {
+	start := r.recorder.start()
+	list, err := r.repo.List(ctx)
+	r.recorder.done(ctx, "List", start, err)
+	return list, err
+}
+
+func (r *registry) ListPaged(ctx context.Context, filter service.ListFilter, opts pagination.ListOptions) ([]*service.Service, int, error) {
+	start := r.recorder.start()
+	list, total, err := r.repo.ListPaged(ctx, filter, opts)
+	r.recorder.done(ctx, "ListPaged", start, err, "limit", opts.Limit, "offset", opts.Offset)
+	return list, total, err
+}
+
+func (r *registry) Update(ctx context.Context, svc *service.Service) error {
+	start := r.recorder.start()
+	err := r.repo.Update(ctx, svc)
+	r.recorder.done(ctx, "Update", start, err, "service_id", svc.ID)
+	return err
+}
+
+func (r *registry) Purge(ctx context.Context, before time.Time) (int, error) {
+	start := r.recorder.start()
+	count, err := r.repo.Purge(ctx, before)
+	r.recorder.done(ctx, "Purge", start, err)
+	return count, err
+}
+
+func (r *registry) GetRevision(ctx context.Context) (int64, error) {
+	start := r.recorder.start()
+	revision, err := r.repo.GetRevision(ctx)
+	r.recorder.done(ctx, "GetRevision", start, err)
+	return revision, err
+}
+
+func (r *registry) BumpRevision(ctx context.Context) (int64, error) {
+	start := r.recorder.start()
+	revision, err := r.repo.BumpRevision(ctx)
+	r.recorder.done(ctx, "BumpRevision", start, err)
+	return revision, err
+}
+
+func (r *registry) FindByCapability(ctx context.Context, capability string) ([]*service.Service, error) {
+	start := r.recorder.start()
+	list, err := r.finder.FindByCapability(ctx, capability)
+	r.recorder.done(ctx, "FindByCapability", start, err, "capability", capability)
+	return list, err
+}
+
+func (r *registry) UpdateHeartbeat(ctx context.Context, id string, at time.Time) error {
+	start := r.recorder.start()
+	err := r.heartbeat.UpdateHeartbeat(ctx, id, at)
+	r.recorder.done(ctx, "UpdateHeartbeat", start, err, "service_id", id)
+	return err
+}
+
+func (r *registry) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	start := r.recorder.start()
+	err := r.transactor.WithinTx(ctx, fn)
+	r.recorder.done(ctx, "WithinTx", start, err)
+	return err
+}
+
+func (r *registry) BatchUpdate(ctx context.Context, services []*service.Service) error {
+	start := r.recorder.start()
+	err := r.batch.BatchUpdate(ctx, services)
+	r.recorder.done(ctx, "BatchUpdate", start, err, "count", len(services))
+	return err
+}
@@ -0,0 +1,133 @@
+package instrument
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/internal/repository/conformance"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/repository/postgres"
+	"github.com/aq189/bin/internal/repository/redis"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestRegistryRepository_Conformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		conformance.TestRegistryRepository(t, func(t *testing.T) service.RegistryRepository {
+			return NewRegistryRepository(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+		})
+	})
+	t.Run("redis", func(t *testing.T) {
+		conformance.TestRegistryRepository(t, func(t *testing.T) service.RegistryRepository {
+			return NewRegistryRepository(redis.NewRegistryRepository(newRedisRepository(t)), Config{}, logger.NewNop())
+		})
+	})
+}
+
+// registryCapabilities reports which optional interfaces repo implements
+func registryCapabilities(repo service.RegistryRepository) int {
+	var mask int
+	if _, ok := repo.(service.CapabilityFinder); ok {
+		mask |= registryFinder
+	}
+	if _, ok := repo.(service.HeartbeatUpdater); ok {
+		mask |= registryHeartbeat
+	}
+	if _, ok := repo.(repository.Transactor); ok {
+		mask |= registryTransactor
+	}
+	if _, ok := repo.(service.BatchUpdater); ok {
+		mask |= registryBatch
+	}
+	return mask
+}
+
+func TestRegistryRepository_ForwardsOptionalInterfaces(t *testing.T) {
+	tests := []struct {
+		name string
+		repo service.RegistryRepository
+		want int
+	}{
+		{name: "memory", repo: memory.NewRegistryRepository(), want: registryFinder | registryHeartbeat | registryTransactor},
+		{name: "redis", repo: redis.NewRegistryRepository(newRedisRepository(t)), want: registryFinder | registryHeartbeat},
+		{name: "postgres", repo: &postgres.Repository{}, want: registryHeartbeat | registryTransactor | registryBatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registryCapabilities(tt.repo); got != tt.want {
+				t.Fatalf("expected the %s repository to implement %04b, got %04b", tt.name, tt.want, got)
+			}
+			wrapped := NewRegistryRepository(tt.repo, Config{}, logger.NewNop())
+			if got := registryCapabilities(wrapped); got != tt.want {
+				t.Errorf("expected the wrapper to implement %04b, got %04b", tt.want, got)
+			}
+			if unwrapped := wrapped.(interface {
+				Unwrap() service.RegistryRepository
+			}).Unwrap(); unwrapped != tt.repo {
+				t.Errorf("expected Unwrap to return the %s repository, got %T", tt.name, unwrapped)
+			}
+		})
+	}
+
+	// Every combination, including those no backend has yet
+	r := &registry{}
+	for mask := range registryBatch << 1 {
+		if got := registryCapabilities(r.withCapabilities(mask)); got != mask {
+			t.Errorf("expected the wrapper to implement %04b, got %04b", mask, got)
+		}
+	}
+}
+
+func TestRegistryRepository_TimesOptionalCalls(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	repo := NewRegistryRepository(memory.NewRegistryRepository(), Config{
+		MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	}, logger.NewNop())
+
+	ctx := context.Background()
+	now := time.Now()
+	svc := &service.Service{ID: "pay-1", Name: "pay", Capabilities: []string{"payments"}, Status: service.StatusHealthy, RegisteredAt: now}
+	if err := repo.Register(ctx, svc); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if found, err := repo.(service.CapabilityFinder).FindByCapability(ctx, "payments"); err != nil || len(found) != 1 {
+		t.Errorf("expected pay-1 found, got %v, %v", found, err)
+	}
+	if err := repo.(service.HeartbeatUpdater).UpdateHeartbeat(ctx, "missing", now); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+	// Calls within the transaction are recorded besides the transaction
+	errRollback := errors.New("roll back")
+	err := repo.(repository.Transactor).WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Deregister(ctx, "pay-1"); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Errorf("expected the transaction's error, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "pay-1"); err != nil {
+		t.Errorf("expected pay-1 kept by the rolled back transaction, got %v", err)
+	}
+
+	calls := collect(t, reader)
+	for _, key := range []string{
+		"registry FindByCapability ok",
+		"registry UpdateHeartbeat not_found",
+		"registry WithinTx error",
+		"registry Deregister ok",
+	} {
+		if calls[key] != 1 {
+			t.Errorf("expected one call recorded as %q, got %v", key, calls)
+		}
+	}
+}
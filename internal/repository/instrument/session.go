@@ -0,0 +1,252 @@
+package instrument
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// Optional session repository capabilities, as bits of a mask
+const (
+	sessionStats = 1 << iota
+	sessionCounter
+	sessionRemover
+	sessionExpiry
+)
+
+// sessions times the calls of a session repository. It has the methods of
+// every optional interface; NewSessionRepository exposes those repo has.
+type sessions struct {
+	repo     session.SessionRepository
+	stats    session.StatsReporter
+	counter  session.ActiveCounter
+	remover  session.ExpiredRemover
+	expiry   session.ExpiryReader
+	recorder *recorder
+}
+
+// NewSessionRepository returns repo with every call timed. The result
+// implements session.StatsReporter, session.ActiveCounter,
+// session.ExpiredRemover and session.ExpiryReader when repo does, and
+// returns repo from an Unwrap method. Stats reads no storage and isn't timed.
+func NewSessionRepository(repo session.SessionRepository, cfg Config, log logger.ILogger) session.SessionRepository {
+	s := &sessions{repo: repo, recorder: newRecorder("sessions", cfg, log)}
+	s.stats, _ = repo.(session.StatsReporter)
+	s.counter, _ = repo.(session.ActiveCounter)
+	s.remover, _ = repo.(session.ExpiredRemover)
+	s.expiry, _ = repo.(session.ExpiryReader)
+	return s.withCapabilities(s.capabilities())
+}
+
+// capabilities returns the mask of the optional interfaces repo implements
+func (s *sessions) capabilities() int {
+	var mask int
+	if s.stats != nil {
+		mask |= sessionStats
+	}
+	if s.counter != nil {
+		mask |= sessionCounter
+	}
+	if s.remover != nil {
+		mask |= sessionRemover
+	}
+	if s.expiry != nil {
+		mask |= sessionExpiry
+	}
+	return mask
+}
+
+// withCapabilities returns s implementing the optional interfaces in mask and
+// no others
+func (s *sessions) withCapabilities(mask int) session.SessionRepository {
+	type (
+		repo interface {
+			session.SessionRepository
+			Unwrap() session.SessionRepository
+		}
+		stats   = session.StatsReporter
+		counter = session.ActiveCounter
+		remover = session.ExpiredRemover
+		expiry  = session.ExpiryReader
+	)
+
+	switch mask {
+	case sessionStats:
+		return struct {
+			repo
+			stats
+		}{s, s}
+	case sessionCounter:
+		return struct {
+			repo
+			counter
+		}{s, s}
+	case sessionStats | sessionCounter:
+		return struct {
+			repo
+			stats
+			counter
+		}{s, s, s}
+	case sessionRemover:
+		return struct {
+			repo
+			remover
+		}{s, s}
+	case sessionStats | sessionRemover:
+		return struct {
+			repo
+			stats
+			remover
+		}{s, s, s}
+	case sessionCounter | sessionRemover:
+		return struct {
+			repo
+			counter
+			remover
+		}{s, s, s}
+	case sessionStats | sessionCounter | sessionRemover:
+		return struct {
+			repo
+			stats
+			counter
+			remover
+		}{s, s, s, s}
+	case sessionExpiry:
+		return struct {
+			repo
+			expiry
+		}{s, s}
+	case sessionStats | sessionExpiry:
+		return struct {
+			repo
+			stats
+			expiry
+		}{s, s, s}
+	case sessionCounter | sessionExpiry:
+		return struct {
+			repo
+			counter
+			expiry
+		}{s, s, s}
+	case sessionStats | sessionCounter | sessionExpiry:
+		return struct {
+			repo
+			stats
+			counter
+			expiry
+		}{s, s, s, s}
+	case sessionRemover | sessionExpiry:
+		return struct {
+			repo
+			remover
+			expiry
+		}{s, s, s}
+	case sessionStats | sessionRemover | sessionExpiry:
+		return struct {
+			repo
+			stats
+			remover
+			expiry
+		}{s, s, s, s}
+	case sessionCounter | sessionRemover | sessionExpiry:
+		return struct {
+			repo
+			counter
+			remover
+			expiry
+		}{s, s, s, s}
+	case sessionStats | sessionCounter | sessionRemover | sessionExpiry:
+		return struct {
+			repo
+			stats
+			counter
+			remover
+			expiry
+		}{s, s, s, s, s}
+	default:
+		return struct{ repo }{s}
+	}
+}
+
+// Unwrap returns the repository the calls are passed to
+func (s *sessions) Unwrap() session.SessionRepository {
+	return s.repo
+}
+
+func (s *sessions) Create(ctx context.Context, sess *session.Session) error {
+	start := s.recorder.start()
+	err := s.repo.Create(ctx, sess)
+	s.recorder.done(ctx, "Create", start, err, "session_id", sess.ID)
+	return err
+}
+
+func (s *sessions) Get(ctx context.Context, id string) (*session.Session, error) {
+	start := s.recorder.start()
+	sess, err := s.repo.Get(ctx, id)
+	s.recorder.done(ctx, "Get", start, err, "session_id", id)
+	return sess, err
+}
+
+func (s *sessions) Update(ctx context.Context, sess *session.Session) error {
+	start := s.recorder.start()
+	err := s.repo.Update(ctx, sess)
+	s.recorder.done(ctx, "Update", start, err, "session_id", sess.ID)
+	return err
+}
+
+func (s *sessions) Delete(ctx context.Context, id string) error {
+	start := s.recorder.start()
+	err := s.repo.Delete(ctx, id)
+	s.recorder.done(ctx, "Delete", start, err, "session_id", id)
+	return err
+}
+
+func (s *sessions) ListByUser(ctx context.Context, scope tenant.Scope, userID string, opts pagination.ListOptions) ([]*session.Session, int, error) {
+	start := s.recorder.start()
+	list, total, err := s.repo.ListByUser(ctx, scope, userID, opts)
+	s.recorder.done(ctx, "ListByUser", start, err, "user_id", userID, "limit", opts.Limit, "offset", opts.Offset)
+	return list, total, err
+}
+
+func (s *sessions) GetByUserService(ctx context.Context, scope tenant.Scope, userID, serviceID string) (*session.Session, error) {
+	start := s.recorder.start()
+	sess, err := s.repo.GetByUserService(ctx, scope, userID, serviceID)
+	s.recorder.done(ctx, "GetByUserService", start, err, "user_id", userID, "service_id", serviceID)
+	return sess, err
+}
+
+func (s *sessions) DeleteExpired(ctx context.Context) (int, error) {
+	start := s.recorder.start()
+	count, err := s.repo.DeleteExpired(ctx)
+	s.recorder.done(ctx, "DeleteExpired", start, err)
+	return count, err
+}
+
+func (s *sessions) Stats() session.Stats {
+	return s.stats.Stats()
+}
+
+func (s *sessions) CountActive(ctx context.Context, now time.Time) (int, error) {
+	start := s.recorder.start()
+	count, err := s.counter.CountActive(ctx, now)
+	s.recorder.done(ctx, "CountActive", start, err)
+	return count, err
+}
+
+func (s *sessions) RemoveExpired(ctx context.Context, now time.Time) ([]*session.Session, error) {
+	start := s.recorder.start()
+	removed, err := s.remover.RemoveExpired(ctx, now)
+	s.recorder.done(ctx, "RemoveExpired", start, err)
+	return removed, err
+}
+
+func (s *sessions) Expiry(ctx context.Context, id string) (time.Time, error) {
+	start := s.recorder.start()
+	expires, err := s.expiry.Expiry(ctx, id)
+	s.recorder.done(ctx, "Expiry", start, err, "session_id", id)
+	return expires, err
+}
@@ -0,0 +1,130 @@
+package instrument
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/conformance"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/repository/postgres"
+	"github.com/aq189/bin/internal/repository/redis"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func newRedisRepository(t *testing.T) *redis.Repository {
+	t.Helper()
+	repo, err := redis.NewRepository(context.Background(), redis.Config{Addr: miniredis.RunT(t).Addr()})
+	if err != nil {
+		t.Fatalf("new redis repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestSessionRepository_Conformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		conformance.TestSessionRepository(t, func(t *testing.T) session.SessionRepository {
+			return NewSessionRepository(memory.NewSessionRepository(), Config{}, logger.NewNop())
+		}, conformance.SessionOptions{})
+	})
+	t.Run("redis", func(t *testing.T) {
+		conformance.TestSessionRepository(t, func(t *testing.T) session.SessionRepository {
+			return NewSessionRepository(newRedisRepository(t), Config{}, logger.NewNop())
+		}, conformance.SessionOptions{ExpiresByTTL: true})
+	})
+}
+
+// sessionCapabilities reports which optional interfaces repo implements
+func sessionCapabilities(repo session.SessionRepository) int {
+	var mask int
+	if _, ok := repo.(session.StatsReporter); ok {
+		mask |= sessionStats
+	}
+	if _, ok := repo.(session.ActiveCounter); ok {
+		mask |= sessionCounter
+	}
+	if _, ok := repo.(session.ExpiredRemover); ok {
+		mask |= sessionRemover
+	}
+	if _, ok := repo.(session.ExpiryReader); ok {
+		mask |= sessionExpiry
+	}
+	return mask
+}
+
+func TestSessionRepository_ForwardsOptionalInterfaces(t *testing.T) {
+	tests := []struct {
+		name string
+		repo session.SessionRepository
+		want int
+	}{
+		{name: "memory", repo: memory.NewSessionRepository(), want: sessionStats | sessionCounter | sessionRemover},
+		{name: "redis", repo: newRedisRepository(t), want: sessionExpiry},
+		{name: "postgres", repo: postgres.NewSessionRepository(&postgres.Repository{}), want: sessionCounter | sessionRemover},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionCapabilities(tt.repo); got != tt.want {
+				t.Fatalf("expected the %s repository to implement %04b, got %04b", tt.name, tt.want, got)
+			}
+			wrapped := NewSessionRepository(tt.repo, Config{}, logger.NewNop())
+			if got := sessionCapabilities(wrapped); got != tt.want {
+				t.Errorf("expected the wrapper to implement %04b, got %04b", tt.want, got)
+			}
+			if unwrapped := wrapped.(interface {
+				Unwrap() session.SessionRepository
+			}).Unwrap(); unwrapped != tt.repo {
+				t.Errorf("expected Unwrap to return the %s repository, got %T", tt.name, unwrapped)
+			}
+		})
+	}
+
+	// Every combination, including those no backend has yet
+	s := &sessions{}
+	for mask := range sessionExpiry << 1 {
+		if got := sessionCapabilities(s.withCapabilities(mask)); got != mask {
+			t.Errorf("expected the wrapper to implement %04b, got %04b", mask, got)
+		}
+	}
+}
+
+func TestSessionRepository_TimesOptionalCalls(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	repo := NewSessionRepository(memory.NewSessionRepository(), Config{
+		MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	}, logger.NewNop())
+
+	ctx := context.Background()
+	now := time.Now()
+	must := func(op string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", op, err)
+		}
+	}
+	must("create", repo.Create(ctx, &session.Session{ID: "sess-1", UserID: "user-1", ServiceID: "web", ExpiresAt: now.Add(-time.Minute)}))
+	must("create", repo.Create(ctx, &session.Session{ID: "sess-2", UserID: "user-1", ServiceID: "web", ExpiresAt: now.Add(time.Hour)}))
+
+	if count, err := repo.(session.ActiveCounter).CountActive(ctx, now); err != nil || count != 1 {
+		t.Errorf("expected 1 active session, got %d, %v", count, err)
+	}
+	if removed, err := repo.(session.ExpiredRemover).RemoveExpired(ctx, now); err != nil || len(removed) != 1 || removed[0].ID != "sess-1" {
+		t.Errorf("expected sess-1 removed, got %v, %v", removed, err)
+	}
+	if stats := repo.(session.StatsReporter).Stats(); stats.Sessions != 1 {
+		t.Errorf("expected 1 stored session, got %+v", stats)
+	}
+
+	calls := collect(t, reader)
+	for _, key := range []string{"sessions CountActive ok", "sessions RemoveExpired ok"} {
+		if calls[key] != 1 {
+			t.Errorf("expected one call recorded as %q, got %v", key, calls)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+)
+
+// APIKeyRepository implements in-memory API key storage
+type APIKeyRepository struct {
+	mu     sync.RWMutex
+	keys   map[string]*apikey.APIKey // id -> key
+	byHash map[string]string         // hash -> id
+}
+
+// NewAPIKeyRepository creates a new in-memory API key repository
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{
+		keys:   make(map[string]*apikey.APIKey),
+		byHash: make(map[string]string),
+	}
+}
+
+// Create stores a new API key
+func (r *APIKeyRepository) Create(ctx context.Context, key *apikey.APIKey) error {
+	if err := checkContext(ctx, "create api key"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.keys[key.ID]; exists {
+		return apikey.ErrAPIKeyExists
+	}
+	if _, exists := r.byHash[key.Hash]; exists {
+		return apikey.ErrAPIKeyExists
+	}
+
+	r.keys[key.ID] = key
+	r.byHash[key.Hash] = key.ID
+	return nil
+}
+
+// GetByHash retrieves an API key by the hash of its plaintext
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	if err := checkContext(ctx, "get api key"); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, exists := r.byHash[hash]
+	if !exists {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+
+	key := *r.keys[id]
+	return &key, nil
+}
+
+// Revoke marks an API key as revoked
+func (r *APIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	if err := checkContext(ctx, "revoke api key"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[id]
+	if !exists {
+		return apikey.ErrAPIKeyNotFound
+	}
+
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/audit"
+)
+
+// DefaultAuditCapacity is how many events an AuditRepository keeps when
+// created with no capacity
+const DefaultAuditCapacity = 10000
+
+// auditChunk is how many events Each copies out per lock
+const auditChunk = 256
+
+// AuditRepository implements in-memory audit storage in a ring buffer of a
+// fixed capacity; once it is full every event appended drops the oldest.
+// Events hold consecutive IDs, so the position of an ID in the ring follows
+// from the newest one.
+type AuditRepository struct {
+	mu     sync.RWMutex
+	events []audit.Event // ring buffer, len is the capacity
+	next   int           // index the next event is written to
+	count  int           // events held
+	lastID int64         // ID of the newest event
+}
+
+// NewAuditRepository creates an audit repository keeping the newest capacity
+// events, DefaultAuditCapacity when capacity isn't positive
+func NewAuditRepository(capacity int) *AuditRepository {
+	if capacity <= 0 {
+		capacity = DefaultAuditCapacity
+	}
+	return &AuditRepository{events: make([]audit.Event, capacity)}
+}
+
+// Append stores a copy of e, dropping the oldest event when the buffer is full
+func (r *AuditRepository) Append(ctx context.Context, e *audit.Event) error {
+	if err := checkContext(ctx, "append audit event"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	e.ID = r.lastID
+	stored := *e
+	stored.Details = maps.Clone(e.Details)
+	r.events[r.next] = stored
+	r.next = (r.next + 1) % len(r.events)
+	r.count = min(r.count+1, len(r.events))
+	return nil
+}
+
+// List returns up to limit events matching filter with an ID below before,
+// newest first
+func (r *AuditRepository) List(ctx context.Context, filter audit.Filter, before int64, limit int) ([]*audit.Event, error) {
+	if err := checkContext(ctx, "list audit events"); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events, _ := r.collect(filter, before, limit)
+	return events, nil
+}
+
+// Each calls fn with every event matching filter, newest first. Events are
+// copied out a chunk at a time, so fn runs without the lock and appends go
+// on meanwhile; events appended after Each started aren't visited.
+func (r *AuditRepository) Each(ctx context.Context, filter audit.Filter, fn func(*audit.Event) error) error {
+	r.mu.RLock()
+	before := r.lastID + 1
+	r.mu.RUnlock()
+
+	for {
+		if err := checkContext(ctx, "list audit events"); err != nil {
+			return err
+		}
+		r.mu.RLock()
+		events, last := r.collect(filter, before, auditChunk)
+		r.mu.RUnlock()
+
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if last == 0 {
+			return nil
+		}
+		before = last
+	}
+}
+
+// collect returns up to limit copies of the events matching filter with an
+// ID below before, newest first, and the ID of the last event it looked at,
+// 0 when it reached the oldest. The caller holds the lock.
+func (r *AuditRepository) collect(filter audit.Filter, before int64, limit int) ([]*audit.Event, int64) {
+	// The i-th newest event has ID lastID-i
+	start := 0
+	if before > 0 {
+		start = int(max(r.lastID-before+1, 0))
+	}
+
+	var events []*audit.Event
+	for i := start; i < r.count; i++ {
+		e := &r.events[(r.next-1-i+2*len(r.events))%len(r.events)]
+		if !filter.Matches(e) {
+			continue
+		}
+		copied := *e
+		copied.Details = maps.Clone(e.Details)
+		events = append(events, &copied)
+		if len(events) == limit {
+			if i == r.count-1 {
+				return events, 0
+			}
+			return events, e.ID
+		}
+	}
+	return events, 0
+}
+
+// Prune removes the events older than before, starting from the oldest
+func (r *AuditRepository) Prune(ctx context.Context, before time.Time) (int, error) {
+	if err := checkContext(ctx, "prune audit events"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for r.count > 0 {
+		oldest := (r.next - r.count + len(r.events)) % len(r.events)
+		if !r.events[oldest].Time.Before(before) {
+			break
+		}
+		r.events[oldest] = audit.Event{}
+		r.count--
+		removed++
+	}
+	return removed, nil
+}
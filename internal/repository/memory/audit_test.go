@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/audit"
+)
+
+var auditStart = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// appendEvents appends n events a second apart from at, acted by alice and
+// bob in turn
+func appendEvents(t *testing.T, repo *AuditRepository, at time.Time, n int) {
+	t.Helper()
+	for i := range n {
+		e := &audit.Event{
+			Time:     at.Add(time.Duration(i) * time.Second),
+			Actor:    []string{"alice", "bob"}[i%2],
+			Action:   "registry.register",
+			Resource: fmt.Sprintf("service/payment-%d", i),
+		}
+		if err := repo.Append(context.Background(), e); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+}
+
+func ids(events []*audit.Event) []int64 {
+	out := make([]int64, 0, len(events))
+	for _, e := range events {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestAuditRepository_List(t *testing.T) {
+	repo := NewAuditRepository(0)
+	ctx := context.Background()
+	appendEvents(t, repo, auditStart, 10)
+
+	events, _ := repo.List(ctx, audit.Filter{}, 0, 3)
+	if got := ids(events); !slices.Equal(got, []int64{10, 9, 8}) {
+		t.Errorf("expected the newest events first, got %v", got)
+	}
+
+	filter := audit.Filter{Actor: "bob", Since: auditStart.Add(2 * time.Second), Until: auditStart.Add(7 * time.Second)}
+	events, _ = repo.List(ctx, filter, 0, 10)
+	if got := ids(events); !slices.Equal(got, []int64{6, 4}) {
+		t.Errorf("expected bob's events from the third second to before the eighth, got %v", got)
+	}
+}
+
+func TestAuditRepository_CursorStableWhileAppending(t *testing.T) {
+	repo := NewAuditRepository(0)
+	ctx := context.Background()
+	appendEvents(t, repo, auditStart, 10)
+
+	var seen []int64
+	var before int64
+	for {
+		page, _ := repo.List(ctx, audit.Filter{}, before, 4)
+		if len(page) == 0 {
+			break
+		}
+		seen = append(seen, ids(page)...)
+		before = page[len(page)-1].ID
+		// Events arriving between pages don't shift the next page
+		appendEvents(t, repo, auditStart.Add(time.Hour), 2)
+	}
+	if want := []int64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}; !slices.Equal(seen, want) {
+		t.Errorf("expected every event once, got %v", seen)
+	}
+}
+
+func TestAuditRepository_RingDropsOldest(t *testing.T) {
+	repo := NewAuditRepository(5)
+	appendEvents(t, repo, auditStart, 8)
+
+	events, _ := repo.List(context.Background(), audit.Filter{}, 0, 100)
+	if got := ids(events); !slices.Equal(got, []int64{8, 7, 6, 5, 4}) {
+		t.Errorf("expected the newest 5 events, got %v", got)
+	}
+	if events, _ := repo.List(context.Background(), audit.Filter{}, 3, 100); len(events) != 0 {
+		t.Errorf("expected nothing before a dropped event, got %v", ids(events))
+	}
+}
+
+func TestAuditRepository_Each(t *testing.T) {
+	repo := NewAuditRepository(0)
+	ctx := context.Background()
+	appendEvents(t, repo, auditStart, 3*auditChunk+7)
+
+	var got []int64
+	err := repo.Each(ctx, audit.Filter{Actor: "alice"}, func(e *audit.Event) error {
+		got = append(got, e.ID)
+		if len(got) == 10 {
+			// Appends made while iterating aren't visited
+			appendEvents(t, repo, auditStart.Add(time.Hour), 4)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("each: %v", err)
+	}
+	if len(got) != (3*auditChunk+7)/2+1 || got[0] != 3*auditChunk+7 || got[len(got)-1] != 1 {
+		t.Errorf("expected alice's %d events newest first, got %d from %d to %d", (3*auditChunk+7)/2+1, len(got), got[0], got[len(got)-1])
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = repo.Each(ctx, audit.Filter{}, func(*audit.Event) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("expected Each to stop at the first error, got %v after %d events", err, n)
+	}
+}
+
+func TestAuditRepository_Prune(t *testing.T) {
+	repo := NewAuditRepository(0)
+	ctx := context.Background()
+	appendEvents(t, repo, auditStart, 10)
+
+	// The event at the cutoff itself is kept
+	removed, err := repo.Prune(ctx, auditStart.Add(4*time.Second))
+	if err != nil || removed != 4 {
+		t.Fatalf("expected 4 events pruned, got %d, %v", removed, err)
+	}
+	events, _ := repo.List(ctx, audit.Filter{}, 0, 100)
+	if got := ids(events); !slices.Equal(got, []int64{10, 9, 8, 7, 6, 5}) {
+		t.Errorf("expected the events from the cutoff on, got %v", got)
+	}
+
+	// IDs go on after pruning
+	appendEvents(t, repo, auditStart.Add(time.Minute), 1)
+	if events, _ := repo.List(ctx, audit.Filter{}, 0, 1); events[0].ID != 11 {
+		t.Errorf("expected ID 11, got %d", events[0].ID)
+	}
+}
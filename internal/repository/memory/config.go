@@ -2,7 +2,10 @@ package memory
 
 import (
 	"fmt"
+	"maps"
 	"sync"
+
+	domainconfig "github.com/aq189/bin/internal/domain/config"
 )
 
 // ConfigRepository implements in-memory configuration storage
@@ -23,14 +26,9 @@ func (r *ConfigRepository) Get(serviceID, version string) (map[string]any, error
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	versions, exists := r.configs[serviceID]
-	if !exists {
-		return nil, fmt.Errorf("service not found")
-	}
-
-	config, exists := versions[version]
+	config, exists := r.configs[serviceID][version]
 	if !exists {
-		return nil, fmt.Errorf("version not found")
+		return nil, fmt.Errorf("%w: %s@%s", domainconfig.ErrConfigNotFound, serviceID, version)
 	}
 
 	return config, nil
@@ -81,3 +79,31 @@ func (r *ConfigRepository) List(serviceID string) ([]string, error) {
 
 	return result, nil
 }
+
+// Export returns a copy of every stored configuration keyed by service ID and
+// version so it can be encoded without holding the lock
+func (r *ConfigRepository) Export() map[string]map[string]map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	configs := make(map[string]map[string]map[string]any, len(r.configs))
+	for serviceID, versions := range r.configs {
+		copied := make(map[string]map[string]any, len(versions))
+		for version, config := range versions {
+			copied[version] = maps.Clone(config)
+		}
+		configs[serviceID] = copied
+	}
+	return configs
+}
+
+// Import replaces the stored configurations with the given ones
+func (r *ConfigRepository) Import(configs map[string]map[string]map[string]any) {
+	if configs == nil {
+		configs = make(map[string]map[string]map[string]any)
+	}
+
+	r.mu.Lock()
+	r.configs = configs
+	r.mu.Unlock()
+}
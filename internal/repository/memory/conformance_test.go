@@ -0,0 +1,21 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/conformance"
+)
+
+func TestSessionRepository_Conformance(t *testing.T) {
+	conformance.TestSessionRepository(t, func(t *testing.T) session.SessionRepository {
+		return NewSessionRepository()
+	}, conformance.SessionOptions{})
+}
+
+func TestRegistryRepository_Conformance(t *testing.T) {
+	conformance.TestRegistryRepository(t, func(t *testing.T) service.RegistryRepository {
+		return NewRegistryRepository()
+	})
+}
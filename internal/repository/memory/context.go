@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+)
+
+// scanBatch is how many entries a long scan visits between context checks
+const scanBatch = 1024
+
+// checkContext returns the error of a cancelled or expired ctx wrapped with
+// the name of the operation it stops, or nil while ctx is live
+func checkContext(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository"
+)
+
+func TestRepositories_SharedErrors(t *testing.T) {
+	ctx := context.Background()
+
+	registry := NewRegistryRepository()
+	registry.Register(ctx, &service.Service{ID: "svc-1", Name: "svc"})
+
+	keys := NewAPIKeyRepository()
+	keys.Create(ctx, &apikey.APIKey{ID: "ak_1", Hash: "hash-1"})
+
+	configs := NewConfigRepository()
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{"registry get", func() error { _, err := registry.Get(ctx, "missing"); return err }(), repository.ErrNotFound},
+		{"registry update", registry.Update(ctx, &service.Service{ID: "missing"}), repository.ErrNotFound},
+		{"registry heartbeat", registry.UpdateHeartbeat(ctx, "missing", time.Now()), repository.ErrNotFound},
+		{"api key lookup", func() error { _, err := keys.GetByHash(ctx, "unknown"); return err }(), repository.ErrNotFound},
+		{"api key revoke", keys.Revoke(ctx, "ak_missing", time.Now()), repository.ErrNotFound},
+		{"api key duplicate", keys.Create(ctx, &apikey.APIKey{ID: "ak_1", Hash: "hash-2"}), repository.ErrDuplicate},
+		{"config get", func() error { _, err := configs.Get("svc-1", "v1"); return err }(), repository.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.target) {
+				t.Errorf("expected %v, got %v", tt.target, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/idempotency"
+)
+
+// idempotencySweepInterval is how often Begin drops expired records, since
+// keys are rarely looked up again once their client got a response
+const idempotencySweepInterval = time.Minute
+
+// IdempotencyStore implements an in-memory idempotency store. Expired records
+// are ignored when looked up and dropped by a sweep Begin runs at most once
+// every idempotencySweepInterval.
+type IdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]idempotencyRecord
+	lastSweep time.Time
+}
+
+type idempotencyRecord struct {
+	resp      idempotency.Response
+	expiresAt time.Time
+}
+
+// NewIdempotencyStore creates a new in-memory idempotency store
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{records: make(map[string]idempotencyRecord)}
+}
+
+// Begin claims key unless an unexpired record holds it
+func (s *IdempotencyStore) Begin(ctx context.Context, key, requestHash string, ttl time.Duration, now time.Time) (*idempotency.Response, error) {
+	if err := checkContext(ctx, "begin idempotent request"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= idempotencySweepInterval {
+		s.sweep(now)
+	}
+
+	if record, ok := s.records[key]; ok && now.Before(record.expiresAt) {
+		resp := record.resp
+		return &resp, nil
+	}
+	s.records[key] = idempotencyRecord{
+		resp:      idempotency.Response{RequestHash: requestHash},
+		expiresAt: now.Add(ttl),
+	}
+	return nil, nil
+}
+
+// Complete stores the response under key
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, resp idempotency.Response, ttl time.Duration, now time.Time) error {
+	if err := checkContext(ctx, "complete idempotent request"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp.Done = true
+	s.records[key] = idempotencyRecord{resp: resp, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Release drops key
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := checkContext(ctx, "release idempotent request"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// sweep drops the records expired at now
+func (s *IdempotencyStore) sweep(now time.Time) {
+	for key, record := range s.records {
+		if !now.Before(record.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+	s.lastSweep = now
+}
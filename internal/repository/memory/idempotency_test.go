@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/idempotency"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	store := NewIdempotencyStore()
+	ctx := context.Background()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	ttl := time.Hour
+
+	if existing, err := store.Begin(ctx, "key-1", "hash-a", ttl, start); err != nil || existing != nil {
+		t.Fatalf("expected the key to be claimed, got %+v, %v", existing, err)
+	}
+	existing, err := store.Begin(ctx, "key-1", "hash-b", ttl, start.Add(time.Second))
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if existing == nil || existing.Done || existing.RequestHash != "hash-a" {
+		t.Fatalf("expected the pending claim, got %+v", existing)
+	}
+
+	resp := idempotency.Response{RequestHash: "hash-a", Status: 201, ContentType: "application/json", Body: []byte(`{"id":"1"}`)}
+	if err := store.Complete(ctx, "key-1", resp, ttl, start.Add(time.Second)); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	existing, _ = store.Begin(ctx, "key-1", "hash-a", ttl, start.Add(time.Minute))
+	if existing == nil || !existing.Done || existing.Status != 201 || string(existing.Body) != `{"id":"1"}` {
+		t.Fatalf("expected the completed response, got %+v", existing)
+	}
+
+	// The record expires ttl after it was completed
+	if existing, _ := store.Begin(ctx, "key-1", "hash-b", ttl, start.Add(time.Second+ttl)); existing != nil {
+		t.Errorf("expected the expired key to be claimed again, got %+v", existing)
+	}
+
+	store.Begin(ctx, "key-2", "hash-a", ttl, start)
+	if err := store.Release(ctx, "key-2"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if existing, _ := store.Begin(ctx, "key-2", "hash-a", ttl, start); existing != nil {
+		t.Errorf("expected a released key to be claimed again, got %+v", existing)
+	}
+
+	store.Begin(ctx, "key-3", "hash-a", ttl, start.Add(3*ttl))
+	if len(store.records) != 1 {
+		t.Errorf("expected expired records to be swept, got %d", len(store.records))
+	}
+}
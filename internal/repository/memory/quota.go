@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/quota"
+)
+
+// QuotaStore implements in-memory sliding window quotas. Uses are kept per
+// subject in the order they were recorded and dropped once a window old.
+type QuotaStore struct {
+	mu   sync.Mutex
+	uses map[string][]time.Time // subject -> use times, oldest first
+}
+
+// NewQuotaStore creates a new in-memory quota store
+func NewQuotaStore() *QuotaStore {
+	return &QuotaStore{uses: make(map[string][]time.Time)}
+}
+
+// Acquire records a use unless the subject's limit is reached
+func (s *QuotaStore) Acquire(ctx context.Context, subject string, limit int, window time.Duration, now time.Time) (quota.Usage, bool, error) {
+	if err := checkContext(ctx, "acquire quota"); err != nil {
+		return quota.Usage{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uses := s.prune(subject, window, now)
+	if len(uses) >= limit {
+		return usage(uses), false, nil
+	}
+
+	uses = append(uses, now)
+	s.uses[subject] = uses
+	return usage(uses), true, nil
+}
+
+// Usage returns the subject's uses within the window
+func (s *QuotaStore) Usage(ctx context.Context, subject string, window time.Duration, now time.Time) (quota.Usage, error) {
+	if err := checkContext(ctx, "get quota usage"); err != nil {
+		return quota.Usage{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return usage(s.prune(subject, window, now)), nil
+}
+
+// prune drops the subject's uses that are a window old and returns the rest
+func (s *QuotaStore) prune(subject string, window time.Duration, now time.Time) []time.Time {
+	uses := s.uses[subject]
+	start := now.Add(-window)
+	i := 0
+	for i < len(uses) && !uses[i].After(start) {
+		i++
+	}
+	uses = uses[i:]
+
+	if len(uses) == 0 {
+		delete(s.uses, subject)
+		return nil
+	}
+	s.uses[subject] = uses
+	return uses
+}
+
+func usage(uses []time.Time) quota.Usage {
+	if len(uses) == 0 {
+		return quota.Usage{}
+	}
+	return quota.Usage{Count: len(uses), Oldest: uses[0]}
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuotaStore_SlidingWindow(t *testing.T) {
+	store := NewQuotaStore()
+	ctx := context.Background()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	window := time.Hour
+
+	acquire := func(at time.Duration) bool {
+		t.Helper()
+		_, ok, err := store.Acquire(ctx, "svc-a", 2, window, start.Add(at))
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		return ok
+	}
+
+	if !acquire(0) || !acquire(10*time.Minute) {
+		t.Fatal("expected the first two uses to be acquired")
+	}
+	if acquire(59 * time.Minute) {
+		t.Error("expected a third use within the window to be refused")
+	}
+	if _, ok, _ := store.Acquire(ctx, "svc-b", 2, window, start.Add(59*time.Minute)); !ok {
+		t.Error("expected another subject to have its own quota")
+	}
+
+	usage, err := store.Usage(ctx, "svc-a", window, start.Add(59*time.Minute))
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if usage.Count != 2 || !usage.Oldest.Equal(start) {
+		t.Errorf("expected 2 uses since %v, got %+v", start, usage)
+	}
+	if reset := usage.ResetAt(window, start.Add(59*time.Minute)); !reset.Equal(start.Add(window)) {
+		t.Errorf("expected the first slot to free at %v, got %v", start.Add(window), reset)
+	}
+
+	// The first use leaves the window an hour after it was made
+	if !acquire(time.Hour) {
+		t.Error("expected a slot once the oldest use left the window")
+	}
+	if acquire(time.Hour + time.Minute) {
+		t.Error("expected the second use to still hold its slot")
+	}
+
+	usage, _ = store.Usage(ctx, "svc-a", window, start.Add(3*time.Hour))
+	if usage.Count != 0 {
+		t.Errorf("expected no uses once the window passed, got %+v", usage)
+	}
+	if len(store.uses) != 1 {
+		t.Errorf("expected expired subjects to be dropped, got %d", len(store.uses))
+	}
+}
@@ -2,78 +2,377 @@ package memory
 
 import (
 	"context"
-	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/aq189/bin/internal/domain/pagination"
 	"github.com/aq189/bin/internal/domain/service"
 )
 
-// RegistryRepository implements in-memory service registry storage
+// RegistryRepository implements in-memory service registry storage.
+// Services are indexed by capability for FindByCapability.
 type RegistryRepository struct {
-	mu       sync.RWMutex
-	services map[string]*service.Service
+	txMu         sync.Mutex // held by writes and transactions, never by reads
+	mu           sync.RWMutex
+	services     map[string]*service.Service
+	capabilities map[string]map[string]struct{} // capability -> service IDs
+	// indexed holds the capabilities each service was indexed under. Stored
+	// services may be modified by callers, so the index is not derived from them.
+	indexed  map[string][]string
+	revision atomic.Int64
 }
 
-// NewRegistryRepository creates a new in-memory registry repository
+// NewRegistryRepository creates a new in-memory registry repository. The
+// revision starts at the current time in milliseconds rather than zero, so
+// clients holding a revision from before a restart are unlikely to match
+// the restarted registry.
 func NewRegistryRepository() *RegistryRepository {
-	return &RegistryRepository{
-		services: make(map[string]*service.Service),
+	r := &RegistryRepository{
+		services:     make(map[string]*service.Service),
+		capabilities: make(map[string]map[string]struct{}),
+		indexed:      make(map[string][]string),
 	}
+	r.revision.Store(time.Now().UnixMilli())
+	return r
 }
 
 // Register stores a new service
 func (r *RegistryRepository) Register(ctx context.Context, svc *service.Service) error {
+	if err := checkContext(ctx, "register service"); err != nil {
+		return err
+	}
+	defer r.lockWrites(ctx)()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.services[svc.ID] = svc
+	r.reindex(svc.ID, svc.Capabilities)
 	return nil
 }
 
+// CreateIfAbsent stores a service unless its ID is taken, returning the existing one if so
+func (r *RegistryRepository) CreateIfAbsent(ctx context.Context, svc *service.Service) (*service.Service, error) {
+	if err := checkContext(ctx, "create service"); err != nil {
+		return nil, err
+	}
+	defer r.lockWrites(ctx)()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, exists := r.services[svc.ID]; exists {
+		return existing, nil
+	}
+
+	r.services[svc.ID] = svc
+	r.reindex(svc.ID, svc.Capabilities)
+	return nil, nil
+}
+
 // Deregister removes a service
 func (r *RegistryRepository) Deregister(ctx context.Context, id string) error {
+	if err := checkContext(ctx, "deregister service"); err != nil {
+		return err
+	}
+	defer r.lockWrites(ctx)()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	delete(r.services, id)
+	r.reindex(id, nil)
 	return nil
 }
 
 // Get retrieves a service by ID
 func (r *RegistryRepository) Get(ctx context.Context, id string) (*service.Service, error) {
+	if err := checkContext(ctx, "get service"); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	svc, exists := r.services[id]
 	if !exists {
-		return nil, fmt.Errorf("service not found")
+		return nil, service.ErrServiceNotFound
 	}
 
 	return svc, nil
 }
 
-// List returns all registered services
+// List returns all registered services that are not soft-deleted, checking
+// ctx every scanBatch services
 func (r *RegistryRepository) List(ctx context.Context) ([]*service.Service, error) {
+	if err := checkContext(ctx, "list services"); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	services := make([]*service.Service, 0, len(r.services))
+	scanned := 0
 	for _, svc := range r.services {
-		services = append(services, svc)
+		if scanned++; scanned%scanBatch == 0 {
+			if err := checkContext(ctx, "list services"); err != nil {
+				return nil, err
+			}
+		}
+		if !svc.IsDeleted() {
+			services = append(services, svc)
+		}
 	}
 
 	return services, nil
 }
 
+// ListPaged returns one page of the services matching filter in the order
+// given by opts.SortBy and opts.Descending
+func (r *RegistryRepository) ListPaged(ctx context.Context, filter service.ListFilter, opts pagination.ListOptions) ([]*service.Service, int, error) {
+	if err := checkContext(ctx, "list services"); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	services := make([]*service.Service, 0, len(r.services))
+	scanned := 0
+	for _, svc := range r.services {
+		if scanned++; scanned%scanBatch == 0 {
+			if err := checkContext(ctx, "list services"); err != nil {
+				r.mu.RUnlock()
+				return nil, 0, err
+			}
+		}
+		if filter.Matches(svc) {
+			services = append(services, svc)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(services, service.CompareBy(opts.SortBy))
+	if opts.Descending {
+		slices.Reverse(services)
+	}
+	start, end := opts.Window(len(services))
+	return services[start:end], len(services), nil
+}
+
 // Update updates an existing service
 func (r *RegistryRepository) Update(ctx context.Context, svc *service.Service) error {
+	if err := checkContext(ctx, "update service"); err != nil {
+		return err
+	}
+	defer r.lockWrites(ctx)()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if _, exists := r.services[svc.ID]; !exists {
-		return fmt.Errorf("service not found")
+		return service.ErrServiceNotFound
 	}
 
 	r.services[svc.ID] = svc
+	r.reindex(svc.ID, svc.Capabilities)
 	return nil
 }
+
+// FindByCapability returns the services advertising the given capability
+// using the capability index
+func (r *RegistryRepository) FindByCapability(ctx context.Context, capability string) ([]*service.Service, error) {
+	if err := checkContext(ctx, "find services by capability"); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := r.capabilities[capability]
+	services := make([]*service.Service, 0, len(ids))
+	for id := range ids {
+		if svc := r.services[id]; !svc.IsDeleted() {
+			services = append(services, svc)
+		}
+	}
+	return services, nil
+}
+
+// Purge removes the services soft-deleted before the given time. It checks
+// ctx every scanBatch services and, once ctx is done, returns the count so far
+// with the context's error.
+func (r *RegistryRepository) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := checkContext(ctx, "purge services"); err != nil {
+		return 0, err
+	}
+	defer r.lockWrites(ctx)()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged, scanned int
+	for id, svc := range r.services {
+		if scanned++; scanned%scanBatch == 0 {
+			if err := checkContext(ctx, "purge services"); err != nil {
+				return purged, err
+			}
+		}
+		if svc.IsDeleted() && svc.DeletedAt.Before(before) {
+			delete(r.services, id)
+			r.reindex(id, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// txKey marks a context passed to a WithinTx callback; its value is the
+// repository running the transaction
+type txKey struct{}
+
+// WithinTx runs fn with writes from outside the transaction held off, and puts
+// the services and capability index back as they were when fn fails. Reads
+// are not blocked, so they may observe writes that are later rolled back.
+func (r *RegistryRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := checkContext(ctx, "begin transaction"); err != nil {
+		return err
+	}
+	if ctx.Value(txKey{}) == r {
+		return fn(ctx)
+	}
+
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	r.mu.RLock()
+	services := maps.Clone(r.services)
+	indexed := maps.Clone(r.indexed)
+	r.mu.RUnlock()
+
+	if err := fn(context.WithValue(ctx, txKey{}, r)); err != nil {
+		r.mu.Lock()
+		r.services = services
+		r.capabilities = make(map[string]map[string]struct{})
+		r.indexed = make(map[string][]string, len(indexed))
+		for id, capabilities := range indexed {
+			r.reindex(id, capabilities)
+		}
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// lockWrites waits for running transactions unless ctx belongs to one of this
+// repository's, and returns the matching unlock
+func (r *RegistryRepository) lockWrites(ctx context.Context) func() {
+	if ctx.Value(txKey{}) == r {
+		return func() {}
+	}
+	r.txMu.Lock()
+	return r.txMu.Unlock
+}
+
+// reindex moves a service from the capabilities it was indexed under to the
+// given ones; nil removes it from the index. Callers hold the write lock.
+func (r *RegistryRepository) reindex(id string, capabilities []string) {
+	for _, capability := range r.indexed[id] {
+		if slices.Contains(capabilities, capability) {
+			continue
+		}
+		delete(r.capabilities[capability], id)
+		if len(r.capabilities[capability]) == 0 {
+			delete(r.capabilities, capability)
+		}
+	}
+
+	if len(capabilities) == 0 {
+		delete(r.indexed, id)
+		return
+	}
+	for _, capability := range capabilities {
+		ids, exists := r.capabilities[capability]
+		if !exists {
+			ids = make(map[string]struct{})
+			r.capabilities[capability] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	r.indexed[id] = slices.Clone(capabilities)
+}
+
+// UpdateHeartbeat records a heartbeat under the write lock. The stored service
+// is replaced by an updated copy so callers holding the previous value never
+// observe the change. The revision moves forward when the status changes.
+func (r *RegistryRepository) UpdateHeartbeat(ctx context.Context, id string, at time.Time) error {
+	if err := checkContext(ctx, "update heartbeat"); err != nil {
+		return err
+	}
+	defer r.lockWrites(ctx)()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.services[id]
+	if !exists {
+		return service.ErrServiceNotFound
+	}
+	if stored.IsDeleted() {
+		return service.ErrServiceDeleted
+	}
+
+	updated := *stored
+	updated.LastHeartbeat = at
+	if !updated.OverrideStatus {
+		updated.Status = service.StatusHealthy
+	}
+	r.services[id] = &updated
+	if updated.Status != stored.Status {
+		r.revision.Add(1)
+	}
+	return nil
+}
+
+// GetRevision returns the registry revision
+func (r *RegistryRepository) GetRevision(ctx context.Context) (int64, error) {
+	if err := checkContext(ctx, "get revision"); err != nil {
+		return 0, err
+	}
+	return r.revision.Load(), nil
+}
+
+// BumpRevision moves the registry revision forward and returns it
+func (r *RegistryRepository) BumpRevision(ctx context.Context) (int64, error) {
+	if err := checkContext(ctx, "bump revision"); err != nil {
+		return 0, err
+	}
+	return r.revision.Add(1), nil
+}
+
+// Export returns copies of every registered service so they can be encoded
+// without holding the lock
+func (r *RegistryRepository) Export() []*service.Service {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	services := make([]*service.Service, 0, len(r.services))
+	for _, svc := range r.services {
+		copied := *svc
+		copied.Endpoints = slices.Clone(svc.Endpoints)
+		copied.Capabilities = slices.Clone(svc.Capabilities)
+		copied.DependsOn = slices.Clone(svc.DependsOn)
+		copied.Metadata = maps.Clone(svc.Metadata)
+		services = append(services, &copied)
+	}
+	return services
+}
+
+// Import replaces the registered services with the given ones and rebuilds
+// the capability index
+func (r *RegistryRepository) Import(services []*service.Service) {
+	defer r.lockWrites(context.Background())()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.services = make(map[string]*service.Service, len(services))
+	r.capabilities = make(map[string]map[string]struct{})
+	r.indexed = make(map[string][]string)
+	for _, svc := range services {
+		r.services[svc.ID] = svc
+		r.reindex(svc.ID, svc.Capabilities)
+	}
+	r.revision.Add(1)
+}
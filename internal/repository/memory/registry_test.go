@@ -0,0 +1,336 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+)
+
+func TestRegistryRepository_ListPaged(t *testing.T) {
+	repo := NewRegistryRepository()
+	ctx := context.Background()
+
+	base := time.Now()
+	for i, id := range []string{"d", "b", "e", "a", "c"} {
+		repo.Register(ctx, &service.Service{
+			ID:           id,
+			Name:         "same-name",
+			RegisteredAt: base.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+
+	collect := func(sortBy string) []string {
+		var ids []string
+		for offset := 0; ; offset += 2 {
+			page, total, err := repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted}, pagination.ListOptions{Limit: 2, Offset: offset, SortBy: sortBy})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if total != 5 {
+				t.Fatalf("expected total 5, got %d", total)
+			}
+			if len(page) == 0 {
+				return ids
+			}
+			for _, svc := range page {
+				ids = append(ids, svc.ID)
+			}
+		}
+	}
+
+	tests := []struct {
+		sortBy string
+		want   []string
+	}{
+		{sortBy: "", want: []string{"a", "b", "c", "d", "e"}},
+		{sortBy: service.SortByName, want: []string{"a", "b", "c", "d", "e"}}, // ties fall back to ID
+		{sortBy: service.SortByRegisteredAt, want: []string{"c", "a", "e", "b", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("sort by "+tt.sortBy, func(t *testing.T) {
+			if got := collect(tt.sortBy); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("scoped to a tenant", func(t *testing.T) {
+		repo.Register(ctx, &service.Service{ID: "f", TenantID: "acme"})
+
+		page, total, _ := repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Only("acme")}, pagination.ListOptions{Limit: 10})
+		if total != 1 || len(page) != 1 || page[0].ID != "f" {
+			t.Errorf("expected only the tenant's service, got %v", page)
+		}
+		if _, total, _ := repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted}, pagination.ListOptions{Limit: 10}); total != 6 {
+			t.Errorf("expected every service unrestricted, got %d", total)
+		}
+	})
+}
+
+func TestRegistryRepository_UpdateHeartbeat(t *testing.T) {
+	repo := NewRegistryRepository()
+	ctx := context.Background()
+
+	previous := &service.Service{ID: "svc-1", Status: service.StatusUnhealthy}
+	repo.Register(ctx, previous)
+	repo.Register(ctx, &service.Service{ID: "svc-2", Status: service.StatusDraining, OverrideStatus: true})
+
+	at := time.Now()
+	for _, id := range []string{"svc-1", "svc-2"} {
+		if err := repo.UpdateHeartbeat(ctx, id, at); err != nil {
+			t.Fatalf("%s: expected no error, got %v", id, err)
+		}
+	}
+
+	got, _ := repo.Get(ctx, "svc-1")
+	if !got.LastHeartbeat.Equal(at) || got.Status != service.StatusHealthy {
+		t.Errorf("expected healthy with heartbeat %v, got %s at %v", at, got.Status, got.LastHeartbeat)
+	}
+	if previous.Status != service.StatusUnhealthy || !previous.LastHeartbeat.IsZero() {
+		t.Error("expected previously returned value to be left unchanged")
+	}
+	if got, _ := repo.Get(ctx, "svc-2"); got.Status != service.StatusDraining {
+		t.Errorf("expected draining override to survive heartbeat, got %s", got.Status)
+	}
+
+	if err := repo.UpdateHeartbeat(ctx, "missing", at); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+func TestRegistryRepository_Revision(t *testing.T) {
+	repo := NewRegistryRepository()
+	ctx := context.Background()
+	repo.Register(ctx, &service.Service{ID: "svc-1", Status: service.StatusUnhealthy})
+
+	start, _ := repo.GetRevision(ctx)
+	if bumped, _ := repo.BumpRevision(ctx); bumped <= start {
+		t.Errorf("expected a bump past %d, got %d", start, bumped)
+	}
+
+	revision := func() int64 {
+		got, _ := repo.GetRevision(ctx)
+		return got
+	}
+	before := revision()
+	repo.UpdateHeartbeat(ctx, "svc-1", time.Now())
+	if after := revision(); after == before {
+		t.Error("expected a heartbeat changing the status to bump the revision")
+	}
+	before = revision()
+	repo.UpdateHeartbeat(ctx, "svc-1", time.Now())
+	if after := revision(); after != before {
+		t.Errorf("expected a heartbeat keeping the status to leave revision %d, got %d", before, after)
+	}
+}
+
+func TestRegistryRepository_FindByCapability(t *testing.T) {
+	repo := NewRegistryRepository()
+	ctx := context.Background()
+
+	find := func(capability string) []string {
+		t.Helper()
+		found, err := repo.FindByCapability(ctx, capability)
+		if err != nil {
+			t.Fatalf("find %s: %v", capability, err)
+		}
+		ids := make([]string, 0, len(found))
+		for _, svc := range found {
+			ids = append(ids, svc.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	payment := &service.Service{ID: "payment-1", Capabilities: []string{"payment", "refund"}}
+	repo.Register(ctx, payment)
+	repo.CreateIfAbsent(ctx, &service.Service{ID: "payment-2", Capabilities: []string{"payment"}})
+	repo.CreateIfAbsent(ctx, &service.Service{ID: "payment-1", Capabilities: []string{"search"}})
+
+	if got := find("payment"); !slices.Equal(got, []string{"payment-1", "payment-2"}) {
+		t.Errorf("expected both payment services, got %v", got)
+	}
+	if got := find("search"); len(got) != 0 {
+		t.Errorf("expected a rejected CreateIfAbsent not to be indexed, got %v", got)
+	}
+
+	t.Run("update moves capabilities", func(t *testing.T) {
+		// Callers may change the stored value before calling Update
+		payment.Capabilities = []string{"payment", "search"}
+		repo.Update(ctx, payment)
+
+		if got := find("refund"); len(got) != 0 {
+			t.Errorf("expected dropped capability to be unindexed, got %v", got)
+		}
+		if got := find("search"); !slices.Equal(got, []string{"payment-1"}) {
+			t.Errorf("expected added capability to be indexed, got %v", got)
+		}
+		if got := find("payment"); !slices.Equal(got, []string{"payment-1", "payment-2"}) {
+			t.Errorf("expected kept capability to stay indexed, got %v", got)
+		}
+	})
+
+	t.Run("re-register replaces capabilities", func(t *testing.T) {
+		repo.Register(ctx, &service.Service{ID: "payment-2", Capabilities: []string{"billing"}})
+
+		if got := find("payment"); !slices.Equal(got, []string{"payment-1"}) {
+			t.Errorf("expected payment-2 to leave payment, got %v", got)
+		}
+		if got := find("billing"); !slices.Equal(got, []string{"payment-2"}) {
+			t.Errorf("expected payment-2 under billing, got %v", got)
+		}
+	})
+
+	t.Run("deregister removes from the index", func(t *testing.T) {
+		repo.Deregister(ctx, "payment-1")
+		repo.Deregister(ctx, "payment-2")
+
+		for _, capability := range []string{"payment", "search", "billing"} {
+			if got := find(capability); len(got) != 0 {
+				t.Errorf("expected %s to be empty, got %v", capability, got)
+			}
+		}
+		if len(repo.capabilities) != 0 || len(repo.indexed) != 0 {
+			t.Errorf("expected empty index, got %v and %v", repo.capabilities, repo.indexed)
+		}
+	})
+}
+
+func TestRegistryRepository_WithinTx(t *testing.T) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	newRepo := func() *RegistryRepository {
+		repo := NewRegistryRepository()
+		repo.Register(ctx, &service.Service{ID: "payment-1", Capabilities: []string{"payment"}})
+		repo.Register(ctx, &service.Service{ID: "search-1", Capabilities: []string{"search"}})
+		return repo
+	}
+	ids := func(services []*service.Service) []string {
+		out := make([]string, 0, len(services))
+		for _, svc := range services {
+			out = append(out, svc.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		repo := newRepo()
+		err := repo.WithinTx(ctx, func(ctx context.Context) error {
+			repo.Register(ctx, &service.Service{ID: "payment-2", Capabilities: []string{"payment"}})
+			repo.Update(ctx, &service.Service{ID: "payment-1", Capabilities: []string{"refund"}})
+			repo.Deregister(ctx, "search-1")
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("expected the callback's error, got %v", err)
+		}
+
+		all, _ := repo.List(ctx)
+		if got := ids(all); !slices.Equal(got, []string{"payment-1", "search-1"}) {
+			t.Errorf("expected the original services, got %v", got)
+		}
+		for capability, want := range map[string][]string{"payment": {"payment-1"}, "search": {"search-1"}, "refund": {}} {
+			found, _ := repo.FindByCapability(ctx, capability)
+			if got := ids(found); !slices.Equal(got, want) {
+				t.Errorf("expected %s to index %v, got %v", capability, want, got)
+			}
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		repo := newRepo()
+		err := repo.WithinTx(ctx, func(ctx context.Context) error {
+			repo.Register(ctx, &service.Service{ID: "payment-2", Capabilities: []string{"payment"}})
+			// A nested call joins the transaction instead of waiting for it
+			return repo.WithinTx(ctx, func(ctx context.Context) error {
+				return repo.Deregister(ctx, "search-1")
+			})
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		found, _ := repo.FindByCapability(ctx, "payment")
+		if got := ids(found); !slices.Equal(got, []string{"payment-1", "payment-2"}) {
+			t.Errorf("expected both payment services, got %v", got)
+		}
+		if _, err := repo.Get(ctx, "search-1"); !errors.Is(err, service.ErrServiceNotFound) {
+			t.Errorf("expected search-1 to be deregistered, got %v", err)
+		}
+	})
+
+	t.Run("outside writes wait", func(t *testing.T) {
+		repo := newRepo()
+		started, written := make(chan struct{}), make(chan struct{})
+
+		go repo.WithinTx(ctx, func(ctx context.Context) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return errAbort
+		})
+		<-started
+		go func() {
+			repo.Register(ctx, &service.Service{ID: "billing-1"})
+			close(written)
+		}()
+
+		select {
+		case <-written:
+		case <-time.After(5 * time.Second):
+			t.Fatal("write did not complete after the transaction")
+		}
+		if _, err := repo.Get(ctx, "billing-1"); err != nil {
+			t.Errorf("expected a write made after the rollback to survive it, got %v", err)
+		}
+	})
+}
+
+func TestRegistryRepository_SoftDelete(t *testing.T) {
+	repo := NewRegistryRepository()
+	ctx := context.Background()
+
+	deletedAt := time.Now()
+	repo.Register(ctx, &service.Service{ID: "svc-1", Capabilities: []string{"payment"}})
+	repo.Register(ctx, &service.Service{ID: "svc-2", Capabilities: []string{"payment"}, DeletedAt: deletedAt})
+
+	if got, err := repo.Get(ctx, "svc-2"); err != nil || !got.IsDeleted() {
+		t.Errorf("expected Get to return the soft-deleted service, got %v, %v", got, err)
+	}
+	if services, _ := repo.List(ctx); len(services) != 1 {
+		t.Errorf("expected List to leave out soft-deleted services, got %d", len(services))
+	}
+	if services, _ := repo.FindByCapability(ctx, "payment"); len(services) != 1 {
+		t.Errorf("expected FindByCapability to leave out soft-deleted services, got %d", len(services))
+	}
+	if _, total, _ := repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted}, pagination.ListOptions{Limit: 10}); total != 1 {
+		t.Errorf("expected ListPaged to leave out soft-deleted services, got %d", total)
+	}
+	if _, total, _ := repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted, IncludeDeleted: true}, pagination.ListOptions{Limit: 10}); total != 2 {
+		t.Errorf("expected ListPaged to include soft-deleted services when asked, got %d", total)
+	}
+	if err := repo.UpdateHeartbeat(ctx, "svc-2", time.Now()); !errors.Is(err, service.ErrServiceDeleted) {
+		t.Errorf("expected ErrServiceDeleted, got %v", err)
+	}
+
+	if purged, _ := repo.Purge(ctx, deletedAt); purged != 0 {
+		t.Errorf("expected nothing purged before the cutoff, got %d", purged)
+	}
+	if purged, _ := repo.Purge(ctx, deletedAt.Add(time.Second)); purged != 1 {
+		t.Errorf("expected one service purged, got %d", purged)
+	}
+	if _, err := repo.Get(ctx, "svc-2"); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected the purged service gone, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-1"); err != nil {
+		t.Errorf("expected live services kept, got %v", err)
+	}
+}
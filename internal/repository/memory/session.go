@@ -1,48 +1,330 @@
 package memory
 
 import (
+	"cmp"
+	"container/heap"
 	"context"
-	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/pagination"
 	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
 )
 
-// SessionRepository implements in-memory session storage
+// DefaultSessionShards is the shard count when SessionConfig.Shards is unset
+const DefaultSessionShards = 32
+
+// SessionConfig sizes an in-memory session repository
+type SessionConfig struct {
+	MaxSessions int         // 0 means unbounded
+	Shards      int         // independently locked partitions; 0 uses DefaultSessionShards
+	Clock       clock.Clock // decides which sessions have expired; nil uses the system clock
+}
+
+// SessionRepository implements in-memory session storage.
+// Sessions are spread over shards by a hash of their ID, each shard with its
+// own lock, so operations on different sessions rarely contend.
+// A bounded repository evicts sessions to make room for new ones, finding
+// them through an index ordered by expiry rather than a scan of every shard.
 type SessionRepository struct {
+	shards      []*sessionShard
+	maxSessions int // 0 means unbounded
+	clock       clock.Clock
+
+	// count is the number of stored sessions plus the slots reserved by
+	// Creates in progress
+	count   atomic.Int64
+	evicted atomic.Int64
+	// evictMu serializes eviction and Import, which span every shard
+	evictMu sync.Mutex
+
+	// owners indexes the IDs of stored sessions by user and service.
+	// ownersMu is taken while holding a shard lock, never the other way round.
+	ownersMu sync.RWMutex
+	owners   map[ownerKey]map[string]struct{}
+
+	// expiry orders the stored sessions of a bounded repository by expiry,
+	// nil when unbounded. Like ownersMu, expiryMu is taken while holding a
+	// shard lock, never the other way round.
+	expiryMu sync.Mutex
+	expiry   *expiryIndex
+}
+
+// ownerKey is the user and service a session belongs to
+type ownerKey struct {
+	userID, serviceID string
+}
+
+// ownerOf returns the index key of sess
+func ownerOf(sess *session.Session) ownerKey {
+	return ownerKey{userID: sess.UserID, serviceID: sess.ServiceID}
+}
+
+// sessionShard is one independently locked part of a SessionRepository
+type sessionShard struct {
 	mu       sync.RWMutex
 	sessions map[string]*session.Session
 }
 
-// NewSessionRepository creates a new in-memory session repository
+// NewSessionRepository creates a new unbounded in-memory session repository
 func NewSessionRepository() *SessionRepository {
-	return &SessionRepository{
-		sessions: make(map[string]*session.Session),
+	return NewSessionRepositoryWithConfig(SessionConfig{})
+}
+
+// NewBoundedSessionRepository creates an in-memory session repository holding
+// at most maxSessions sessions; 0 means unbounded
+func NewBoundedSessionRepository(maxSessions int) *SessionRepository {
+	return NewSessionRepositoryWithConfig(SessionConfig{MaxSessions: maxSessions})
+}
+
+// NewSessionRepositoryWithConfig creates an in-memory session repository
+// sized by cfg
+func NewSessionRepositoryWithConfig(cfg SessionConfig) *SessionRepository {
+	shards := cfg.Shards
+	if shards <= 0 {
+		shards = DefaultSessionShards
+	}
+
+	r := &SessionRepository{
+		shards:      make([]*sessionShard, shards),
+		maxSessions: max(cfg.MaxSessions, 0),
+		clock:       clock.OrReal(cfg.Clock),
+		owners:      make(map[ownerKey]map[string]struct{}),
+	}
+	for i := range r.shards {
+		r.shards[i] = &sessionShard{sessions: make(map[string]*session.Session)}
+	}
+	if r.maxSessions > 0 {
+		r.expiry = newExpiryIndex()
+	}
+	return r
+}
+
+// shardIndex returns the index of the shard holding the session with id
+func (r *SessionRepository) shardIndex(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(r.shards)))
+}
+
+// shard returns the shard holding the session with id
+func (r *SessionRepository) shard(id string) *sessionShard {
+	return r.shards[r.shardIndex(id)]
+}
+
+// index adds sess to the owner index
+func (r *SessionRepository) index(sess *session.Session) {
+	r.ownersMu.Lock()
+	defer r.ownersMu.Unlock()
+
+	key := ownerOf(sess)
+	ids := r.owners[key]
+	if ids == nil {
+		ids = make(map[string]struct{})
+		r.owners[key] = ids
+	}
+	ids[sess.ID] = struct{}{}
+}
+
+// unindex removes sess from the owner index
+func (r *SessionRepository) unindex(sess *session.Session) {
+	r.ownersMu.Lock()
+	defer r.ownersMu.Unlock()
+
+	key := ownerOf(sess)
+	delete(r.owners[key], sess.ID)
+	if len(r.owners[key]) == 0 {
+		delete(r.owners, key)
+	}
+}
+
+// trackExpiry adds sess to the expiry index, or moves it to its new expiry.
+// The caller holds the lock of the session's shard.
+func (r *SessionRepository) trackExpiry(sess *session.Session) {
+	if r.expiry == nil {
+		return
 	}
+	r.expiryMu.Lock()
+	defer r.expiryMu.Unlock()
+	r.expiry.set(sess.ID, sess.ExpiresAt)
 }
 
-// Create stores a new session
+// remove drops sess from shard and the indexes. The caller holds the shard's lock.
+func (r *SessionRepository) remove(shard *sessionShard, sess *session.Session) {
+	delete(shard.sessions, sess.ID)
+	r.unindex(sess)
+	if r.expiry != nil {
+		r.expiryMu.Lock()
+		r.expiry.remove(sess.ID)
+		r.expiryMu.Unlock()
+	}
+	r.count.Add(-1)
+}
+
+// Create stores a new session. When the repository is full, expired
+// sessions are evicted first, then those closest to expiry.
 func (r *SessionRepository) Create(ctx context.Context, sess *session.Session) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := checkContext(ctx, "create session"); err != nil {
+		return err
+	}
+	shard := r.shard(sess.ID)
 
-	if _, exists := r.sessions[sess.ID]; exists {
-		return fmt.Errorf("session already exists")
+	// Rejecting a duplicate must not evict anything
+	shard.mu.RLock()
+	_, exists := shard.sessions[sess.ID]
+	shard.mu.RUnlock()
+	if exists {
+		return session.ErrSessionExists
 	}
 
-	r.sessions[sess.ID] = sess
+	r.reserve()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, exists := shard.sessions[sess.ID]; exists {
+		r.count.Add(-1)
+		return session.ErrSessionExists
+	}
+	shard.sessions[sess.ID] = sess
+	r.index(sess)
+	r.trackExpiry(sess)
 	return nil
 }
 
+// reserve counts a session about to be stored, first evicting others when a
+// bounded repository is full
+func (r *SessionRepository) reserve() {
+	if r.maxSessions == 0 {
+		r.count.Add(1)
+		return
+	}
+
+	for {
+		count := r.count.Load()
+		if count < int64(r.maxSessions) {
+			if r.count.CompareAndSwap(count, count+1) {
+				return
+			}
+			continue
+		}
+
+		r.evictMu.Lock()
+		r.evict(1)
+		r.evictMu.Unlock()
+	}
+}
+
+// evict drops sessions until room more fit within maxSessions: every expired
+// session once the limit is reached, then those closest to expiry, taken in
+// order from the expiry index. Callers hold evictMu.
+func (r *SessionRepository) evict(room int) {
+	if r.maxSessions == 0 || r.count.Load()+int64(room) <= int64(r.maxSessions) {
+		return
+	}
+
+	now := r.clock.Now()
+	for {
+		r.expiryMu.Lock()
+		id, expiresAt, ok := r.expiry.next()
+		r.expiryMu.Unlock()
+		if !ok {
+			// Only slots reserved by Creates in progress remain
+			return
+		}
+		if !session.Expired(expiresAt, now) && r.count.Load()+int64(room) <= int64(r.maxSessions) {
+			return
+		}
+
+		// The session may have been updated or removed since it was looked
+		// up; the index is checked again under the shard's lock
+		shard := r.shard(id)
+		shard.mu.Lock()
+		r.expiryMu.Lock()
+		current, tracked := r.expiry.expiresAt(id)
+		r.expiryMu.Unlock()
+		if sess, exists := shard.sessions[id]; exists && tracked && current.Equal(expiresAt) {
+			r.remove(shard, sess)
+			r.evicted.Add(1)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// removeExpired removes the sessions expired by now, one shard at a
+// time, and returns them. It stops between shards once ctx is done,
+// returning those removed so far with the context's error.
+func (r *SessionRepository) removeExpired(ctx context.Context, now time.Time) ([]*session.Session, error) {
+	var removed []*session.Session
+	for _, shard := range r.shards {
+		if err := checkContext(ctx, "delete expired sessions"); err != nil {
+			return removed, err
+		}
+		shard.mu.Lock()
+		for _, sess := range shard.sessions {
+			if sess.IsExpired(now) {
+				r.remove(shard, sess)
+				removed = append(removed, sess)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return removed, nil
+}
+
+// Stats reports the number of stored and evicted sessions
+func (r *SessionRepository) Stats() session.Stats {
+	sessions := 0
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		sessions += len(shard.sessions)
+		shard.mu.RUnlock()
+	}
+
+	return session.Stats{
+		Sessions:    sessions,
+		MaxSessions: r.maxSessions,
+		Evicted:     r.evicted.Load(),
+	}
+}
+
+// CountActive counts the sessions of every tenant expiring after now
+func (r *SessionRepository) CountActive(ctx context.Context, now time.Time) (int, error) {
+	active := 0
+	for _, shard := range r.shards {
+		if err := checkContext(ctx, "count active sessions"); err != nil {
+			return 0, err
+		}
+		shard.mu.RLock()
+		for _, sess := range shard.sessions {
+			if sess.IsActive(now) {
+				active++
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return active, nil
+}
+
 // Get retrieves a session by ID
 func (r *SessionRepository) Get(ctx context.Context, id string) (*session.Session, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	if err := checkContext(ctx, "get session"); err != nil {
+		return nil, err
+	}
+	shard := r.shard(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
 
-	sess, exists := r.sessions[id]
+	sess, exists := shard.sessions[id]
 	if !exists {
-		return nil, fmt.Errorf("session not found")
+		return nil, session.ErrSessionNotFound
 	}
 
 	return sess, nil
@@ -50,40 +332,261 @@ func (r *SessionRepository) Get(ctx context.Context, id string) (*session.Sessio
 
 // Update updates an existing session
 func (r *SessionRepository) Update(ctx context.Context, sess *session.Session) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := checkContext(ctx, "update session"); err != nil {
+		return err
+	}
+	shard := r.shard(sess.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	if _, exists := r.sessions[sess.ID]; !exists {
-		return fmt.Errorf("session not found")
+	old, exists := shard.sessions[sess.ID]
+	if !exists {
+		return session.ErrSessionNotFound
 	}
 
-	r.sessions[sess.ID] = sess
+	shard.sessions[sess.ID] = sess
+	if ownerOf(old) != ownerOf(sess) {
+		r.unindex(old)
+		r.index(sess)
+	}
+	r.trackExpiry(sess)
 	return nil
 }
 
 // Delete removes a session
 func (r *SessionRepository) Delete(ctx context.Context, id string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := checkContext(ctx, "delete session"); err != nil {
+		return err
+	}
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	delete(r.sessions, id)
+	if sess, exists := shard.sessions[id]; exists {
+		r.remove(shard, sess)
+	}
 	return nil
 }
 
-// DeleteExpired removes all expired sessions
+// ListByUser returns one page of a user's unexpired sessions within scope
+func (r *SessionRepository) ListByUser(ctx context.Context, scope tenant.Scope, userID string, opts pagination.ListOptions) ([]*session.Session, int, error) {
+	now := r.clock.Now()
+	var sessions []*session.Session
+	for _, shard := range r.shards {
+		if err := checkContext(ctx, "list sessions"); err != nil {
+			return nil, 0, err
+		}
+		shard.mu.RLock()
+		for _, sess := range shard.sessions {
+			if sess.UserID == userID && scope.Allows(sess.TenantID) && sess.IsActive(now) {
+				sessions = append(sessions, sess)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	slices.SortFunc(sessions, session.CompareBy(opts.SortBy))
+	start, end := opts.Window(len(sessions))
+	return sessions[start:end], len(sessions), nil
+}
+
+// GetByUserService returns the newest unexpired session within scope that
+// userID holds on serviceID, found through the owner index
+func (r *SessionRepository) GetByUserService(ctx context.Context, scope tenant.Scope, userID, serviceID string) (*session.Session, error) {
+	if err := checkContext(ctx, "get session by user and service"); err != nil {
+		return nil, err
+	}
+	r.ownersMu.RLock()
+	ids := slices.Collect(maps.Keys(r.owners[ownerKey{userID: userID, serviceID: serviceID}]))
+	r.ownersMu.RUnlock()
+
+	now := r.clock.Now()
+	byCreation := session.CompareBy(session.SortByCreatedAt)
+	var newest *session.Session
+	for _, id := range ids {
+		shard := r.shard(id)
+		shard.mu.RLock()
+		sess, exists := shard.sessions[id]
+		shard.mu.RUnlock()
+		if !exists || sess.UserID != userID || sess.ServiceID != serviceID || !scope.Allows(sess.TenantID) || !sess.IsActive(now) {
+			continue
+		}
+		if newest == nil || byCreation(sess, newest) > 0 {
+			newest = sess
+		}
+	}
+	if newest == nil {
+		return nil, session.ErrSessionNotFound
+	}
+	return newest, nil
+}
+
+// DeleteExpired removes all expired sessions. Each shard's lock is released
+// before the next is scanned, so a large sweep does not stall other requests,
+// and the sweep stops between shards once ctx is done.
 func (r *SessionRepository) DeleteExpired(ctx context.Context) (int, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	removed, err := r.removeExpired(ctx, r.clock.Now())
+	return len(removed), err
+}
 
-	count := 0
-	now := time.Now()
+// RemoveExpired removes the sessions expired by now and returns
+// them; like DeleteExpired it locks one shard at a time
+func (r *SessionRepository) RemoveExpired(ctx context.Context, now time.Time) ([]*session.Session, error) {
+	return r.removeExpired(ctx, now)
+}
 
-	for id, sess := range r.sessions {
-		if sess.ExpiresAt.Before(now) {
-			delete(r.sessions, id)
-			count++
+// Export returns copies of every stored session so they can be encoded
+// without holding the locks
+func (r *SessionRepository) Export() []*session.Session {
+	sessions := make([]*session.Session, 0, max(r.count.Load(), 0))
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		for _, sess := range shard.sessions {
+			copied := *sess
+			copied.Data = maps.Clone(sess.Data)
+			sessions = append(sessions, &copied)
 		}
+		shard.mu.RUnlock()
 	}
+	return sessions
+}
+
+// Import replaces the stored sessions with the given ones, evicting any
+// beyond the repository's limit
+func (r *SessionRepository) Import(sessions []*session.Session) {
+	imported := make([]map[string]*session.Session, len(r.shards))
+	for i := range imported {
+		imported[i] = make(map[string]*session.Session)
+	}
+	for _, sess := range sessions {
+		imported[r.shardIndex(sess.ID)][sess.ID] = sess
+	}
+
+	r.evictMu.Lock()
+	defer r.evictMu.Unlock()
+
+	// All shards are locked, in order, so readers never see a partial import
+	for _, shard := range r.shards {
+		shard.mu.Lock()
+	}
+	var delta int64
+	for i, shard := range r.shards {
+		delta += int64(len(imported[i]) - len(shard.sessions))
+		shard.sessions = imported[i]
+	}
+	r.count.Add(delta)
+
+	owners := make(map[ownerKey]map[string]struct{})
+	for _, sess := range sessions {
+		key := ownerOf(sess)
+		if owners[key] == nil {
+			owners[key] = make(map[string]struct{})
+		}
+		owners[key][sess.ID] = struct{}{}
+	}
+	r.ownersMu.Lock()
+	r.owners = owners
+	r.ownersMu.Unlock()
+
+	if r.expiry != nil {
+		expiry := newExpiryIndex()
+		for _, shard := range imported {
+			for _, sess := range shard {
+				expiry.set(sess.ID, sess.ExpiresAt)
+			}
+		}
+		r.expiryMu.Lock()
+		r.expiry = expiry
+		r.expiryMu.Unlock()
+	}
+
+	for _, shard := range r.shards {
+		shard.mu.Unlock()
+	}
+
+	r.evict(0)
+}
+
+// expiryEntry is a session's place in an expiryIndex
+type expiryEntry struct {
+	id        string
+	expiresAt time.Time
+	pos       int // index in the heap
+}
+
+// expiryIndex is a min-heap of session IDs by expiry, then ID, the order
+// session.SortByExpiresAt lists them in. It is not safe for concurrent use.
+type expiryIndex struct {
+	heap    []*expiryEntry
+	entries map[string]*expiryEntry
+}
+
+func newExpiryIndex() *expiryIndex {
+	return &expiryIndex{entries: make(map[string]*expiryEntry)}
+}
+
+// set adds id expiring at expiresAt, or moves it there
+func (x *expiryIndex) set(id string, expiresAt time.Time) {
+	if e, ok := x.entries[id]; ok {
+		e.expiresAt = expiresAt
+		heap.Fix(x, e.pos)
+		return
+	}
+	e := &expiryEntry{id: id, expiresAt: expiresAt}
+	x.entries[id] = e
+	heap.Push(x, e)
+}
+
+// remove drops id, if indexed
+func (x *expiryIndex) remove(id string) {
+	if e, ok := x.entries[id]; ok {
+		heap.Remove(x, e.pos)
+		delete(x.entries, id)
+	}
+}
+
+// next returns the ID expiring first and when, if any
+func (x *expiryIndex) next() (string, time.Time, bool) {
+	if len(x.heap) == 0 {
+		return "", time.Time{}, false
+	}
+	return x.heap[0].id, x.heap[0].expiresAt, true
+}
+
+// expiresAt returns when id expires, if indexed
+func (x *expiryIndex) expiresAt(id string) (time.Time, bool) {
+	e, ok := x.entries[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.expiresAt, true
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface
+
+func (x *expiryIndex) Len() int { return len(x.heap) }
+
+func (x *expiryIndex) Less(i, j int) bool {
+	a, b := x.heap[i], x.heap[j]
+	return cmp.Or(a.expiresAt.Compare(b.expiresAt), strings.Compare(a.id, b.id)) < 0
+}
+
+func (x *expiryIndex) Swap(i, j int) {
+	x.heap[i], x.heap[j] = x.heap[j], x.heap[i]
+	x.heap[i].pos = i
+	x.heap[j].pos = j
+}
+
+func (x *expiryIndex) Push(v any) {
+	e := v.(*expiryEntry)
+	e.pos = len(x.heap)
+	x.heap = append(x.heap, e)
+}
 
-	return count, nil
+func (x *expiryIndex) Pop() any {
+	last := len(x.heap) - 1
+	e := x.heap[last]
+	x.heap[last] = nil
+	x.heap = x.heap[:last]
+	return e
 }
@@ -2,10 +2,20 @@ package memory
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/pagination"
 	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
 )
 
 func TestSessionRepository_Create(t *testing.T) {
@@ -31,8 +41,8 @@ func TestSessionRepository_Create(t *testing.T) {
 
 	t.Run("rejects duplicate session", func(t *testing.T) {
 		err := repo.Create(ctx, sess)
-		if err == nil {
-			t.Error("expected error for duplicate session, got nil")
+		if !errors.Is(err, repository.ErrDuplicate) {
+			t.Errorf("expected ErrDuplicate, got %v", err)
 		}
 	})
 }
@@ -70,8 +80,8 @@ func TestSessionRepository_Get(t *testing.T) {
 
 	t.Run("returns error for non-existent session", func(t *testing.T) {
 		_, err := repo.Get(ctx, "non-existent")
-		if err == nil {
-			t.Error("expected error for non-existent session, got nil")
+		if !errors.Is(err, repository.ErrNotFound) || !errors.Is(err, session.ErrSessionNotFound) {
+			t.Errorf("expected ErrSessionNotFound, got %v", err)
 		}
 	})
 }
@@ -108,8 +118,8 @@ func TestSessionRepository_Update(t *testing.T) {
 	t.Run("returns error for non-existent session", func(t *testing.T) {
 		nonExistent := &session.Session{ID: "non-existent"}
 		err := repo.Update(ctx, nonExistent)
-		if err == nil {
-			t.Error("expected error for non-existent session, got nil")
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
 		}
 	})
 }
@@ -202,3 +212,435 @@ func TestSessionRepository_DeleteExpired(t *testing.T) {
 		}
 	})
 }
+
+func TestSessionRepository_Clock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	repo := NewSessionRepositoryWithConfig(SessionConfig{Clock: fake})
+	ctx := context.Background()
+
+	repo.Create(ctx, &session.Session{ID: "sess-1", UserID: "user-1", ServiceID: "web", ExpiresAt: fake.Now().Add(time.Hour)})
+
+	live := func() int {
+		t.Helper()
+		_, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if _, err := repo.GetByUserService(ctx, tenant.Unrestricted, "user-1", "web"); (err == nil) != (total == 1) {
+			t.Errorf("expected lookups to agree with the list of %d, got %v", total, err)
+		}
+		return total
+	}
+
+	fake.Advance(time.Hour - time.Nanosecond)
+	if got := live(); got != 1 {
+		t.Errorf("expected the session live before its expiry, got %d", got)
+	}
+
+	// Expired from its expiry on, as the session service decides
+	fake.Advance(time.Nanosecond)
+	if got := live(); got != 0 {
+		t.Errorf("expected the session expired at its expiry, got %d", got)
+	}
+	if count, err := repo.DeleteExpired(ctx); err != nil || count != 1 {
+		t.Errorf("expected the session deleted by the fake clock, got %d, %v", count, err)
+	}
+}
+
+func TestSessionRepository_CountActive(t *testing.T) {
+	repo := NewSessionRepository()
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for id, expiresIn := range map[string]time.Duration{"expired": -time.Minute, "expiring": 0, "active": time.Minute} {
+		repo.Create(ctx, &session.Session{ID: id, UserID: "user-1", TenantID: id, ExpiresAt: now.Add(expiresIn)})
+	}
+
+	active, err := repo.CountActive(ctx, now)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if active != 1 {
+		t.Errorf("expected 1 active session, got %d", active)
+	}
+}
+
+func TestSessionRepository_ListByUser(t *testing.T) {
+	repo := NewSessionRepository()
+	ctx := context.Background()
+
+	now := time.Now()
+	for i, id := range []string{"s3", "s1", "s2"} {
+		repo.Create(ctx, &session.Session{
+			ID:        id,
+			UserID:    "user-1",
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			ExpiresAt: now.Add(time.Hour),
+		})
+	}
+	repo.Create(ctx, &session.Session{ID: "other", UserID: "user-2", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	repo.Create(ctx, &session.Session{ID: "expired", UserID: "user-1", CreatedAt: now, ExpiresAt: now.Add(-time.Minute)})
+
+	page, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if total != 3 {
+		t.Errorf("expected 3 active sessions, got %d", total)
+	}
+	if len(page) != 2 || page[0].ID != "s3" || page[1].ID != "s1" {
+		t.Errorf("expected oldest sessions first, got %v", page)
+	}
+
+	page, _, _ = repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10, SortBy: session.SortByID})
+	if len(page) != 3 || page[0].ID != "s1" || page[2].ID != "s3" {
+		t.Errorf("expected sessions ordered by ID, got %v", page)
+	}
+	repo.Create(ctx, &session.Session{ID: "acme", UserID: "user-1", TenantID: "acme", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if page, total, _ := repo.ListByUser(ctx, tenant.Only("acme"), "user-1", pagination.ListOptions{Limit: 10}); total != 1 || page[0].ID != "acme" {
+		t.Errorf("expected only the tenant's session, got %v", page)
+	}
+	if _, total, _ := repo.ListByUser(ctx, tenant.Only(""), "user-1", pagination.ListOptions{Limit: 10}); total != 3 {
+		t.Errorf("expected the default tenant's 3 sessions, got %d", total)
+	}
+}
+
+func TestSessionRepository_Eviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	newSession := func(id string, expiresIn time.Duration) *session.Session {
+		return &session.Session{ID: id, UserID: "user-1", ExpiresAt: now.Add(expiresIn)}
+	}
+
+	t.Run("expired sessions go first", func(t *testing.T) {
+		repo := NewBoundedSessionRepository(3)
+		repo.Create(ctx, newSession("soon", time.Minute))
+		repo.Create(ctx, newSession("expired-1", -time.Minute))
+		repo.Create(ctx, newSession("expired-2", -time.Hour))
+
+		if err := repo.Create(ctx, newSession("new", time.Hour)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := sessionIDs(repo); !slices.Equal(got, []string{"new", "soon"}) {
+			t.Errorf("expected both expired sessions evicted, got %v", got)
+		}
+		if stats := repo.Stats(); stats != (session.Stats{Sessions: 2, MaxSessions: 3, Evicted: 2}) {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("then those closest to expiry", func(t *testing.T) {
+		repo := NewBoundedSessionRepository(3)
+		repo.Create(ctx, newSession("late", 3*time.Hour))
+		repo.Create(ctx, newSession("soonest", time.Minute))
+		repo.Create(ctx, newSession("middle", time.Hour))
+
+		repo.Create(ctx, newSession("new-1", 2*time.Hour))
+		repo.Create(ctx, newSession("new-2", 2*time.Hour))
+		if got := sessionIDs(repo); !slices.Equal(got, []string{"late", "new-1", "new-2"}) {
+			t.Errorf("expected soonest then middle to be evicted, got %v", got)
+		}
+		if stats := repo.Stats(); stats.Sessions != 3 || stats.Evicted != 2 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("updated and deleted sessions keep their place", func(t *testing.T) {
+		repo := NewBoundedSessionRepository(3)
+		repo.Create(ctx, newSession("renewed", time.Minute))
+		repo.Create(ctx, newSession("deleted", 2*time.Minute))
+		repo.Create(ctx, newSession("middle", time.Hour))
+
+		repo.Update(ctx, newSession("renewed", 3*time.Hour))
+		repo.Delete(ctx, "deleted")
+		repo.Create(ctx, newSession("new-1", 2*time.Hour))
+		repo.Create(ctx, newSession("new-2", 2*time.Hour))
+		if got := sessionIDs(repo); !slices.Equal(got, []string{"new-1", "new-2", "renewed"}) {
+			t.Errorf("expected middle to be evicted by its expiry, got %v", got)
+		}
+		if stats := repo.Stats(); stats.Sessions != 3 || stats.Evicted != 1 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("import keeps the limit", func(t *testing.T) {
+		repo := NewBoundedSessionRepository(2)
+		repo.Import([]*session.Session{newSession("a", time.Hour), newSession("b", time.Minute), newSession("c", 2*time.Hour)})
+		if got := sessionIDs(repo); !slices.Equal(got, []string{"a", "c"}) {
+			t.Errorf("expected b to be evicted, got %v", got)
+		}
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		repo := NewSessionRepository()
+		for i := range 100 {
+			repo.Create(ctx, newSession(fmt.Sprintf("sess-%d", i), -time.Minute))
+		}
+		if stats := repo.Stats(); stats != (session.Stats{Sessions: 100}) {
+			t.Errorf("expected nothing evicted, got %+v", stats)
+		}
+	})
+}
+
+func TestSessionRepository_StatsUnderConcurrentCreates(t *testing.T) {
+	repo := NewBoundedSessionRepository(50)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			repo.Create(ctx, &session.Session{ID: fmt.Sprintf("sess-%d", i), ExpiresAt: time.Now().Add(time.Hour)})
+		}()
+	}
+	wg.Wait()
+
+	stats := repo.Stats()
+	if stats.Sessions != 50 || stats.Evicted != 150 {
+		t.Errorf("expected 50 stored and 150 evicted, got %+v", stats)
+	}
+	if stored := len(repo.Export()); stored != stats.Sessions {
+		t.Errorf("expected stats to match the %d stored sessions, got %d", stored, stats.Sessions)
+	}
+}
+
+func sessionIDs(repo *SessionRepository) []string {
+	var ids []string
+	for _, sess := range repo.Export() {
+		ids = append(ids, sess.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestSessionRepository_ConcurrentMixedOperations(t *testing.T) {
+	for _, maxSessions := range []int{0, 64} {
+		t.Run(fmt.Sprintf("max_sessions=%d", maxSessions), func(t *testing.T) {
+			repo := NewSessionRepositoryWithConfig(SessionConfig{MaxSessions: maxSessions, Shards: 4})
+			ctx := context.Background()
+			now := time.Now()
+
+			var wg sync.WaitGroup
+			for w := range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range 200 {
+						id := fmt.Sprintf("sess-%d-%d", w, i%50)
+						expiresIn := time.Hour
+						if i%3 == 0 {
+							expiresIn = -time.Minute
+						}
+						sess := &session.Session{ID: id, UserID: fmt.Sprintf("user-%d", w), ExpiresAt: now.Add(expiresIn)}
+
+						switch i % 6 {
+						case 0, 1:
+							repo.Create(ctx, sess)
+						case 2:
+							repo.Get(ctx, id)
+						case 3:
+							repo.Update(ctx, sess)
+						case 4:
+							repo.Delete(ctx, id)
+						case 5:
+							repo.DeleteExpired(ctx)
+							repo.ListByUser(ctx, tenant.Unrestricted, sess.UserID, pagination.ListOptions{})
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			stats := repo.Stats()
+			if stored := len(repo.Export()); stored != stats.Sessions {
+				t.Errorf("expected stats to match the %d stored sessions, got %+v", stored, stats)
+			}
+			if maxSessions > 0 && stats.Sessions > maxSessions {
+				t.Errorf("expected at most %d sessions, got %d", maxSessions, stats.Sessions)
+			}
+		})
+	}
+}
+
+func TestSessionRepository_ConcurrentImport(t *testing.T) {
+	repo := NewBoundedSessionRepository(20)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 200 {
+			repo.Create(ctx, &session.Session{ID: fmt.Sprintf("sess-%d", i), ExpiresAt: expiresAt})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range 20 {
+			repo.Import([]*session.Session{{ID: fmt.Sprintf("imported-%d", i), ExpiresAt: expiresAt}})
+		}
+	}()
+	wg.Wait()
+
+	stats := repo.Stats()
+	if stats.Sessions > 20 {
+		t.Errorf("expected at most 20 sessions, got %d", stats.Sessions)
+	}
+	if stored := len(repo.Export()); stored != stats.Sessions {
+		t.Errorf("expected stats to match the %d stored sessions, got %+v", stored, stats)
+	}
+}
+
+// benchmarkShards compares a single shard, which behaves like one map behind
+// one lock, with the default
+var benchmarkShards = []int{1, DefaultSessionShards}
+
+func BenchmarkCreateParallel(b *testing.B) {
+	for _, shards := range benchmarkShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			repo := NewSessionRepositoryWithConfig(SessionConfig{Shards: shards})
+			ctx := context.Background()
+			expiresAt := time.Now().Add(time.Hour)
+			var next atomic.Int64
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					repo.Create(ctx, &session.Session{ID: fmt.Sprintf("sess-%d", next.Add(1)), ExpiresAt: expiresAt})
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	const stored = 10000
+
+	for _, shards := range benchmarkShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			repo := NewSessionRepositoryWithConfig(SessionConfig{Shards: shards})
+			ctx := context.Background()
+			ids := make([]string, stored)
+			for i := range ids {
+				ids[i] = fmt.Sprintf("sess-%d", i)
+				repo.Create(ctx, &session.Session{ID: ids[i], ExpiresAt: time.Now().Add(time.Hour)})
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(stored)
+				for pb.Next() {
+					repo.Get(ctx, ids[i%stored])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkDeleteExpiredLarge(b *testing.B) {
+	const stored = 100000
+
+	for _, shards := range benchmarkShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			ctx := context.Background()
+			now := time.Now()
+			sessions := make([]*session.Session, stored)
+			for i := range sessions {
+				expiresIn := time.Hour
+				if i%2 == 0 {
+					expiresIn = -time.Minute
+				}
+				sessions[i] = &session.Session{ID: fmt.Sprintf("sess-%d", i), ExpiresAt: now.Add(expiresIn)}
+			}
+
+			for b.Loop() {
+				b.StopTimer()
+				repo := NewSessionRepositoryWithConfig(SessionConfig{Shards: shards})
+				repo.Import(sessions)
+				b.StartTimer()
+
+				repo.DeleteExpired(ctx)
+			}
+		})
+	}
+}
+
+func TestSessionRepository_GetByUserService(t *testing.T) {
+	repo := NewSessionRepository()
+	ctx := context.Background()
+
+	now := time.Now()
+	add := func(id, userID, serviceID, tenantID string, created, expires time.Duration) {
+		t.Helper()
+		err := repo.Create(ctx, &session.Session{
+			ID: id, UserID: userID, ServiceID: serviceID, TenantID: tenantID,
+			CreatedAt: now.Add(created), ExpiresAt: now.Add(expires),
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	add("old", "user-1", "web", "", 0, time.Hour)
+	add("new", "user-1", "web", "", time.Second, time.Hour)
+	add("expired", "user-1", "web", "", 2*time.Second, -time.Minute)
+	add("api", "user-1", "api", "", 3*time.Second, time.Hour)
+	add("other-user", "user-2", "web", "", 3*time.Second, time.Hour)
+	add("acme", "user-1", "web", "acme", 3*time.Second, time.Hour)
+
+	get := func(scope tenant.Scope, userID, serviceID string) string {
+		t.Helper()
+		sess, err := repo.GetByUserService(ctx, scope, userID, serviceID)
+		if errors.Is(err, session.ErrSessionNotFound) {
+			return ""
+		}
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return sess.ID
+	}
+
+	if got := get(tenant.Only(""), "user-1", "web"); got != "new" {
+		t.Errorf("expected the newest active session, got %q", got)
+	}
+	if got := get(tenant.Only("acme"), "user-1", "web"); got != "acme" {
+		t.Errorf("expected the tenant's session, got %q", got)
+	}
+	if got := get(tenant.Unrestricted, "user-1", "web"); got != "acme" {
+		t.Errorf("expected the newest session of any tenant, got %q", got)
+	}
+	if got := get(tenant.Unrestricted, "user-3", "web"); got != "" {
+		t.Errorf("expected no session for an unknown user, got %q", got)
+	}
+
+	repo.Delete(ctx, "new")
+	if got := get(tenant.Only(""), "user-1", "web"); got != "old" {
+		t.Errorf("expected the remaining session after a delete, got %q", got)
+	}
+
+	moved, _ := repo.Get(ctx, "old")
+	updated := *moved
+	updated.ServiceID = "api"
+	repo.Update(ctx, &updated)
+	if got := get(tenant.Only(""), "user-1", "web"); got != "" {
+		t.Errorf("expected no web session once it moved to api, got %q", got)
+	}
+	if got := get(tenant.Only(""), "user-1", "api"); got != "api" {
+		t.Errorf("expected the newest api session, got %q", got)
+	}
+
+	repo.DeleteExpired(ctx)
+	repo.Import([]*session.Session{{ID: "imported", UserID: "user-1", ServiceID: "web", ExpiresAt: now.Add(time.Hour)}})
+	if got := get(tenant.Only(""), "user-1", "web"); got != "imported" {
+		t.Errorf("expected the index rebuilt on import, got %q", got)
+	}
+	if got := get(tenant.Only(""), "user-1", "api"); got != "" {
+		t.Errorf("expected sessions replaced by an import to be unindexed, got %q", got)
+	}
+	repo.ownersMu.RLock()
+	owners := len(repo.owners)
+	repo.ownersMu.RUnlock()
+	if owners != 1 {
+		t.Errorf("expected one indexed owner, got %d", owners)
+	}
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+)
+
+// snapshotVersion is the format version of snapshot files and the only one Load accepts
+const snapshotVersion = 1
+
+// snapshot is the on-disk form of the memory repositories
+type snapshot struct {
+	Version  int                                  `json:"version"`
+	TakenAt  time.Time                            `json:"taken_at"`
+	Sessions []*session.Session                   `json:"sessions,omitempty"`
+	Services []*service.Service                   `json:"services,omitempty"`
+	Configs  map[string]map[string]map[string]any `json:"configs,omitempty"`
+}
+
+// SnapshotStats counts what Load restored
+type SnapshotStats struct {
+	Sessions int
+	Expired  int // sessions in the snapshot that had expired and were dropped
+	Services int
+	Configs  int // services with stored configuration
+}
+
+// Snapshotter saves memory repositories to a JSON file and restores them from
+// it. Nil repositories are neither saved nor restored, so components stored
+// in other backends are left out.
+type Snapshotter struct {
+	path     string
+	sessions *SessionRepository
+	registry *RegistryRepository
+	configs  *ConfigRepository
+
+	mu sync.Mutex // serializes saves so two writers never race on the rename
+}
+
+// NewSnapshotter creates a snapshotter for the given file and repositories
+func NewSnapshotter(path string, sessions *SessionRepository, registry *RegistryRepository, configs *ConfigRepository) *Snapshotter {
+	return &Snapshotter{
+		path:     path,
+		sessions: sessions,
+		registry: registry,
+		configs:  configs,
+	}
+}
+
+// Save writes the repositories to a temporary file next to the snapshot and
+// renames it into place, so a crash never leaves a partial snapshot behind.
+// Repositories are copied under their locks and encoded afterwards.
+func (s *Snapshotter) Save() error {
+	snap := snapshot{Version: snapshotVersion, TakenAt: time.Now().UTC()}
+	if s.sessions != nil {
+		snap.Sessions = s.sessions.Export()
+	}
+	if s.registry != nil {
+		snap.Services = s.registry.Export()
+	}
+	if s.configs != nil {
+		snap.Configs = s.configs.Export()
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load replaces the contents of the repositories with the snapshot file's.
+// A missing file restores nothing. Sessions that expired while the snapshot
+// sat on disk are dropped.
+func (s *Snapshotter) Load() (SnapshotStats, error) {
+	var stats SnapshotStats
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return stats, fmt.Errorf("parse snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return stats, fmt.Errorf("unsupported snapshot version %d, expected %d", snap.Version, snapshotVersion)
+	}
+
+	if s.sessions != nil {
+		active := make([]*session.Session, 0, len(snap.Sessions))
+		now := s.sessions.clock.Now()
+		for _, sess := range snap.Sessions {
+			if sess.IsExpired(now) {
+				stats.Expired++
+				continue
+			}
+			active = append(active, sess)
+		}
+		s.sessions.Import(active)
+		stats.Sessions = len(active)
+	}
+	if s.registry != nil {
+		s.registry.Import(snap.Services)
+		stats.Services = len(snap.Services)
+	}
+	if s.configs != nil {
+		s.configs.Import(snap.Configs)
+		stats.Configs = len(snap.Configs)
+	}
+	return stats, nil
+}
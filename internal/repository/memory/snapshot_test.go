@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+)
+
+func TestSnapshotter_SaveLoad(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	sessions := NewSessionRepository()
+	sessions.Create(ctx, &session.Session{ID: "active", UserID: "user-1", TenantID: "acme", Data: map[string]any{"theme": "dark"}, ExpiresAt: time.Now().Add(time.Hour)})
+	sessions.Create(ctx, &session.Session{ID: "expired", UserID: "user-1", ExpiresAt: time.Now().Add(-time.Minute)})
+	registry := NewRegistryRepository()
+	registry.Register(ctx, &service.Service{ID: "payment-1", Name: "payment", Capabilities: []string{"payments"}, Status: service.StatusHealthy})
+	configs := NewConfigRepository()
+	configs.Set("payment-1", "v1", map[string]any{"retries": "3"})
+
+	if err := NewSnapshotter(path, sessions, registry, configs).Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if matches, _ := filepath.Glob(path + ".tmp-*"); len(matches) != 0 {
+		t.Errorf("expected temporary files to be renamed away, found %v", matches)
+	}
+
+	restoredSessions := NewSessionRepository()
+	restoredRegistry := NewRegistryRepository()
+	restoredConfigs := NewConfigRepository()
+	stats, err := NewSnapshotter(path, restoredSessions, restoredRegistry, restoredConfigs).Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if want := (SnapshotStats{Sessions: 1, Expired: 1, Services: 1, Configs: 1}); stats != want {
+		t.Errorf("expected stats %+v, got %+v", want, stats)
+	}
+
+	sess, err := restoredSessions.Get(ctx, "active")
+	if err != nil {
+		t.Fatalf("expected active session to be restored: %v", err)
+	}
+	if sess.TenantID != "acme" || sess.Data["theme"] != "dark" {
+		t.Errorf("expected restored session to match, got %+v", sess)
+	}
+	if _, err := restoredSessions.Get(ctx, "expired"); err == nil {
+		t.Error("expected expired session to be dropped on load")
+	}
+
+	found, _ := restoredRegistry.FindByCapability(ctx, "payments")
+	if len(found) != 1 || found[0].ID != "payment-1" || found[0].Status != service.StatusHealthy {
+		t.Errorf("expected payment-1 to be restored and indexed, got %v", found)
+	}
+
+	config, err := restoredConfigs.Get("payment-1", "v1")
+	if err != nil || config["retries"] != "3" {
+		t.Errorf("expected config to be restored, got %v, %v", config, err)
+	}
+}
+
+func TestSnapshotter_SkipsNilRepositories(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	registry := NewRegistryRepository()
+	registry.Register(ctx, &service.Service{ID: "payment-1"})
+	if err := NewSnapshotter(path, nil, registry, nil).Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	sessions := NewSessionRepository()
+	sessions.Create(ctx, &session.Session{ID: "live", ExpiresAt: time.Now().Add(time.Hour)})
+	restored := NewRegistryRepository()
+	if _, err := NewSnapshotter(path, sessions, restored, nil).Load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if _, err := restored.Get(ctx, "payment-1"); err != nil {
+		t.Errorf("expected service to be restored: %v", err)
+	}
+	if live := sessions.Export(); len(live) != 0 {
+		t.Errorf("expected sessions to be replaced by the snapshot's, got %d", len(live))
+	}
+}
+
+func TestSnapshotter_Load(t *testing.T) {
+	dir := t.TempDir()
+	unsupported := filepath.Join(dir, "v2.json")
+	os.WriteFile(unsupported, []byte(`{"version":2}`), 0o600)
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte(`{"version":`), 0o600)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "missing file restores nothing", path: filepath.Join(dir, "missing.json")},
+		{name: "unsupported version", path: unsupported, wantErr: true},
+		{name: "corrupt file", path: corrupt, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistryRepository()
+			registry.Register(context.Background(), &service.Service{ID: "kept"})
+
+			_, err := NewSnapshotter(tt.path, nil, registry, nil).Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			ids := []string{}
+			for _, svc := range registry.Export() {
+				ids = append(ids, svc.ID)
+			}
+			if !slices.Equal(ids, []string{"kept"}) {
+				t.Errorf("expected repository to be left alone, got %v", ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// APIKeyRepository implements PostgreSQL-based API key storage
+type APIKeyRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewAPIKeyRepository creates an API key repository sharing the PostgreSQL pool
+func NewAPIKeyRepository(repo *Repository) *APIKeyRepository {
+	return &APIKeyRepository{pool: repo.pool}
+}
+
+// Create stores a new API key
+func (r *APIKeyRepository) Create(ctx context.Context, key *apikey.APIKey) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO api_keys (id, name, key_hash, roles, created_at, expires_at, revoked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.ID, key.Name, key.Hash, nonNil(key.Roles), key.CreatedAt.UTC(),
+		utcPtr(key.ExpiresAt), utcPtr(key.RevokedAt),
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return apikey.ErrAPIKeyExists
+	}
+	if err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+	return nil
+}
+
+// GetByHash retrieves an API key by the hash of its plaintext
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	var key apikey.APIKey
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, name, key_hash, roles, created_at, expires_at, revoked_at
+		FROM api_keys WHERE key_hash = $1`, hash,
+	).Scan(&key.ID, &key.Name, &key.Hash, &key.Roles, &key.CreatedAt, &key.ExpiresAt, &key.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+
+	key.CreatedAt = asUTC(key.CreatedAt)
+	key.ExpiresAt = asUTCPtr(key.ExpiresAt)
+	key.RevokedAt = asUTCPtr(key.RevokedAt)
+
+	return &key, nil
+}
+
+// Revoke marks an API key as revoked, keeping the original revocation time
+func (r *APIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`,
+		id, at.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apikey.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+func asUTCPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := asUTC(*t)
+	return &utc
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/audit"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// auditFilter is the WHERE clause of the audit queries, selecting the events
+// matching an audit.Filter in $1 to $5 with an id below $6, when not 0
+const auditFilter = `
+	WHERE ($1::timestamp IS NULL OR time >= $1)
+	AND ($2::timestamp IS NULL OR time < $2)
+	AND ($3 = '' OR actor = $3)
+	AND ($4 = '' OR action = $4)
+	AND ($5 = '' OR resource = $5)
+	AND ($6 = 0 OR id < $6)`
+
+// AuditRepository implements PostgreSQL-based audit storage. Events are read
+// newest first by id, through the index of the filtered column.
+type AuditRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewAuditRepository creates an audit repository sharing the PostgreSQL pool
+func NewAuditRepository(repo *Repository) *AuditRepository {
+	return &AuditRepository{pool: repo.pool}
+}
+
+// Append stores e and sets its ID
+func (r *AuditRepository) Append(ctx context.Context, e *audit.Event) error {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO audit_events (time, actor, action, resource, request_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		e.Time.UTC(), e.Actor, e.Action, e.Resource, e.RequestID, e.Details,
+	).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("append audit event: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit events matching filter with an ID below before,
+// newest first
+func (r *AuditRepository) List(ctx context.Context, filter audit.Filter, before int64, limit int) ([]*audit.Event, error) {
+	var events []*audit.Event
+	err := r.query(ctx, filter, before, limit, func(e *audit.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list audit events: %w", err)
+	}
+	return events, nil
+}
+
+// Each calls fn with every event matching filter, newest first, as the rows
+// arrive. The query holds a pooled connection until it returns.
+func (r *AuditRepository) Each(ctx context.Context, filter audit.Filter, fn func(*audit.Event) error) error {
+	return r.query(ctx, filter, 0, 0, fn)
+}
+
+// query calls fn with each event matching filter with an ID below before,
+// newest first, at most limit of them unless limit is 0
+func (r *AuditRepository) query(ctx context.Context, filter audit.Filter, before int64, limit int, fn func(*audit.Event) error) error {
+	var limitArg *int
+	if limit > 0 {
+		limitArg = &limit
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, time, actor, action, resource, request_id, details
+		FROM audit_events`+auditFilter+`
+		ORDER BY id DESC
+		LIMIT $7`,
+		timeArg(filter.Since), timeArg(filter.Until), filter.Actor, filter.Action, filter.Resource, before, limitArg,
+	)
+	if err != nil {
+		return fmt.Errorf("query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e audit.Event
+		if err := rows.Scan(&e.ID, &e.Time, &e.Actor, &e.Action, &e.Resource, &e.RequestID, &e.Details); err != nil {
+			return fmt.Errorf("scan audit event: %w", err)
+		}
+		e.Time = asUTC(e.Time)
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Prune removes the events older than before through the time index
+func (r *AuditRepository) Prune(ctx context.Context, before time.Time) (int, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM audit_events WHERE time < $1`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune audit events: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// timeArg is the query argument of an optional time bound, NULL when unset
+func timeArg(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
@@ -0,0 +1,96 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/audit"
+)
+
+func appendAuditEvents(t *testing.T, repo *AuditRepository, at time.Time, n int) []int64 {
+	t.Helper()
+	ids := make([]int64, 0, n)
+	for i := range n {
+		e := &audit.Event{
+			Time:     at.Add(time.Duration(i) * time.Second),
+			Actor:    []string{"alice", "bob"}[i%2],
+			Action:   "registry.set_status",
+			Resource: fmt.Sprintf("service/payment-%d", i),
+			Details:  map[string]string{"after_status": "draining"},
+		}
+		if err := repo.Append(context.Background(), e); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestAuditRepository(t *testing.T) {
+	repo := NewAuditRepository(newTestRepository(t))
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Second)
+	appended := appendAuditEvents(t, repo, start, 10)
+
+	t.Run("pages newest first while events arrive", func(t *testing.T) {
+		var seen []int64
+		var before int64
+		for {
+			page, err := repo.List(ctx, audit.Filter{Until: start.Add(time.Hour)}, before, 4)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, e := range page {
+				seen = append(seen, e.ID)
+			}
+			before = page[len(page)-1].ID
+			appendAuditEvents(t, repo, start.Add(2*time.Hour), 1)
+		}
+		want := slices.Clone(appended)
+		slices.Reverse(want)
+		if !slices.Equal(seen, want) {
+			t.Errorf("expected %v, got %v", want, seen)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		filter := audit.Filter{Actor: "bob", Since: start.Add(2 * time.Second), Until: start.Add(7 * time.Second)}
+		events, err := repo.List(ctx, filter, 0, 100)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(events) != 2 || events[0].Resource != "service/payment-5" || events[1].Details["after_status"] != "draining" {
+			t.Errorf("expected bob's events 5 and 3, got %+v", events)
+		}
+	})
+
+	t.Run("each streams every match", func(t *testing.T) {
+		n := 0
+		err := repo.Each(ctx, audit.Filter{Action: "registry.set_status"}, func(*audit.Event) error {
+			n++
+			return nil
+		})
+		if err != nil || n < 10 {
+			t.Errorf("expected every event, got %d, %v", n, err)
+		}
+	})
+
+	t.Run("prune keeps the cutoff", func(t *testing.T) {
+		removed, err := repo.Prune(ctx, start.Add(4*time.Second))
+		if err != nil || removed != 4 {
+			t.Fatalf("expected 4 events pruned, got %d, %v", removed, err)
+		}
+		events, _ := repo.List(ctx, audit.Filter{Until: start.Add(time.Hour)}, 0, 100)
+		if len(events) != 6 || !events[len(events)-1].Time.Equal(start.Add(4*time.Second)) {
+			t.Errorf("expected the 6 events from the cutoff on, got %d", len(events))
+		}
+	})
+}
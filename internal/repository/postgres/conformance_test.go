@@ -0,0 +1,23 @@
+//go:build integration
+
+package postgres
+
+import (
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/conformance"
+)
+
+func TestSessionRepository_Conformance(t *testing.T) {
+	conformance.TestSessionRepository(t, func(t *testing.T) session.SessionRepository {
+		return NewSessionRepository(newTestRepository(t))
+	}, conformance.SessionOptions{})
+}
+
+func TestRegistryRepository_Conformance(t *testing.T) {
+	conformance.TestRegistryRepository(t, func(t *testing.T) service.RegistryRepository {
+		return newTestRepository(t)
+	})
+}
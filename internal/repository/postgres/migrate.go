@@ -0,0 +1,242 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationFiles holds the schema migrations shipped with the binary. The
+// .down.sql files are kept beside them for rolling back by hand.
+//
+//go:embed migrations/*.up.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key serializing migrations across
+// instances starting at once
+const migrationLockID = 0x726f6f74
+
+// ErrSchemaAhead is returned when the database has migrations applied that
+// this binary doesn't know, as after a rollback to an older release
+var ErrSchemaAhead = errors.New("database schema is newer than this binary")
+
+// ErrSchemaDirty is returned when golang-migrate, which managed the schema
+// before the server did, left a migration half applied
+var ErrSchemaDirty = errors.New("database schema is dirty")
+
+// Migration is one schema change, applied in order of Version
+type Migration struct {
+	Version int
+	Name    string
+	sql     string
+}
+
+// String returns the migration's file name without the .up.sql suffix
+func (m Migration) String() string {
+	return fmt.Sprintf("%06d_%s", m.Version, m.Name)
+}
+
+// Migrate applies the pending migrations in order, each in its own
+// transaction, and returns them. Instances starting together wait for each
+// other on an advisory lock, so every migration is applied once. Migrate
+// fails with ErrSchemaAhead when the database has a migration applied that
+// this binary doesn't know, and changes nothing.
+func (r *Repository) Migrate(ctx context.Context) ([]Migration, error) {
+	return r.migrate(ctx, migrationFiles, true)
+}
+
+// PendingMigrations returns the migrations Migrate would apply without
+// changing the database
+func (r *Repository) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	return r.migrate(ctx, migrationFiles, false)
+}
+
+// migrate finds the migrations of fsys not applied yet and, when apply is
+// set, applies them
+func (r *Repository) migrate(ctx context.Context, fsys fs.FS, apply bool) ([]Migration, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+	db := conn.Conn()
+
+	if apply {
+		// The lock belongs to the connection, so it is released on the same one
+		if _, err := db.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return nil, fmt.Errorf("lock migrations: %w", err)
+		}
+		defer db.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+		if _, err := db.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS applied_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			)`); err != nil {
+			return nil, fmt.Errorf("create migrations table: %w", err)
+		}
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	for _, version := range applied {
+		if !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == version }) {
+			return nil, fmt.Errorf("%w: migration %d is applied, this binary knows up to %d", ErrSchemaAhead, version, latest)
+		}
+	}
+
+	// A schema golang-migrate managed counts as migrated up to its version
+	var baseline []Migration
+	if len(applied) == 0 {
+		version, err := legacyVersion(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		if version > latest {
+			return nil, fmt.Errorf("%w: golang-migrate applied migration %d, this binary knows up to %d", ErrSchemaAhead, version, latest)
+		}
+		for _, m := range migrations {
+			if m.Version <= version {
+				baseline = append(baseline, m)
+				applied = append(applied, m.Version)
+			}
+		}
+	}
+
+	pending := slices.DeleteFunc(migrations, func(m Migration) bool {
+		return slices.Contains(applied, m.Version)
+	})
+	if !apply {
+		return pending, nil
+	}
+
+	if len(baseline) > 0 {
+		err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			for _, m := range baseline {
+				if err := recordMigration(ctx, tx, m); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("record golang-migrate migrations: %w", err)
+		}
+	}
+	for i, m := range pending {
+		err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.sql); err != nil {
+				return err
+			}
+			return recordMigration(ctx, tx, m)
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("apply migration %s: %w", m, err)
+		}
+	}
+	return pending, nil
+}
+
+// recordMigration marks m as applied
+func recordMigration(ctx context.Context, tx pgx.Tx, m Migration) error {
+	_, err := tx.Exec(ctx, `INSERT INTO applied_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	return err
+}
+
+// appliedVersions returns the versions of the applied migrations, none when
+// the migrations table doesn't exist yet
+func appliedVersions(ctx context.Context, db *pgx.Conn) ([]int, error) {
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass('applied_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check migrations table: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := db.Query(ctx, `SELECT version FROM applied_migrations ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return versions, nil
+}
+
+// legacyVersion returns the version golang-migrate recorded in its
+// schema_migrations table, or 0 when it never ran
+func legacyVersion(ctx context.Context, db *pgx.Conn) (int, error) {
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("check golang-migrate table: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	var dirty bool
+	err := db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("read golang-migrate version: %w", err)
+	case dirty:
+		return 0, fmt.Errorf("%w: golang-migrate failed applying migration %d; repair it and clear the dirty flag", ErrSchemaDirty, version)
+	}
+	return version, nil
+}
+
+// loadMigrations reads the migrations/NNNNNN_name.up.sql files of fsys
+// ordered by version
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.up.sql")
+	if err != nil {
+		return nil, fmt.Errorf("list migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(paths))
+	for _, p := range paths {
+		prefix, name, _ := strings.Cut(strings.TrimSuffix(path.Base(p), ".up.sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version", p)
+		}
+		sql, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("read migration: %w", err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, sql: string(sql)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s share a version", migrations[i-1], migrations[i])
+		}
+	}
+	return migrations, nil
+}
@@ -0,0 +1,209 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// migrationsUpTo returns the embedded migrations up to version, as an
+// older binary would ship them
+func migrationsUpTo(t *testing.T, version int) fs.FS {
+	t.Helper()
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	files := fstest.MapFS{}
+	for _, m := range migrations {
+		if m.Version <= version {
+			files["migrations/"+m.String()+".up.sql"] = &fstest.MapFile{Data: []byte(m.sql)}
+		}
+	}
+	return files
+}
+
+// countMigrations returns the number of embedded migrations
+func countMigrations(t *testing.T) int {
+	t.Helper()
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	return len(migrations)
+}
+
+// tableExists reports whether the repository's schema has table
+func tableExists(t *testing.T, repo *Repository, table string) bool {
+	t.Helper()
+
+	var exists bool
+	if err := repo.pool.QueryRow(context.Background(), `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		t.Fatalf("check table %s: %v", table, err)
+	}
+	return exists
+}
+
+func TestRepository_MigrateFreshInstall(t *testing.T) {
+	repo := &Repository{pool: newTestPool(t)}
+	ctx := context.Background()
+	total := countMigrations(t)
+
+	pending, err := repo.PendingMigrations(ctx)
+	if err != nil {
+		t.Fatalf("pending migrations: %v", err)
+	}
+	if len(pending) != total {
+		t.Errorf("expected %d pending migrations, got %v", total, pending)
+	}
+	if tableExists(t, repo, "applied_migrations") || tableExists(t, repo, "services") {
+		t.Fatal("expected a dry run to leave the schema untouched")
+	}
+
+	applied, err := repo.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(applied) != total {
+		t.Errorf("expected %d applied migrations, got %v", total, applied)
+	}
+	for _, table := range []string{"services", "sessions", "api_keys", "registry_revision"} {
+		if !tableExists(t, repo, table) {
+			t.Errorf("expected table %s", table)
+		}
+	}
+
+	if applied, err := repo.Migrate(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("expected migrating again to apply nothing, got %v, %v", applied, err)
+	}
+	if pending, err := repo.PendingMigrations(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("expected nothing pending, got %v, %v", pending, err)
+	}
+}
+
+func TestRepository_MigrateIncrementalUpgrade(t *testing.T) {
+	repo := &Repository{pool: newTestPool(t)}
+	ctx := context.Background()
+	total := countMigrations(t)
+
+	if _, err := repo.migrate(ctx, migrationsUpTo(t, 4), true); err != nil {
+		t.Fatalf("migrate to 4: %v", err)
+	}
+	if tableExists(t, repo, "registry_revision") {
+		t.Fatal("expected migration 7 not to be applied yet")
+	}
+
+	pending, err := repo.PendingMigrations(ctx)
+	if err != nil {
+		t.Fatalf("pending migrations: %v", err)
+	}
+	if len(pending) != total-4 || pending[0].Version != 5 {
+		t.Errorf("expected migrations 5 to %d pending, got %v", total, pending)
+	}
+
+	applied, err := repo.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(applied) != total-4 || applied[0].Version != 5 {
+		t.Errorf("expected migrations 5 to %d applied, got %v", total, applied)
+	}
+	if !tableExists(t, repo, "registry_revision") {
+		t.Error("expected migration 7 to be applied")
+	}
+}
+
+func TestRepository_MigrateRefusesNewerSchema(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	if _, err := repo.pool.Exec(ctx, `INSERT INTO applied_migrations (version, name) VALUES (9999, 'from_the_future')`); err != nil {
+		t.Fatalf("record migration: %v", err)
+	}
+
+	if _, err := repo.Migrate(ctx); !errors.Is(err, ErrSchemaAhead) {
+		t.Errorf("expected ErrSchemaAhead, got %v", err)
+	}
+	if _, err := repo.PendingMigrations(ctx); !errors.Is(err, ErrSchemaAhead) {
+		t.Errorf("expected ErrSchemaAhead from a dry run, got %v", err)
+	}
+}
+
+func TestRepository_MigrateFromGolangMigrate(t *testing.T) {
+	ctx := context.Background()
+	total := countMigrations(t)
+
+	legacy := func(t *testing.T, version int, dirty bool) *Repository {
+		repo := &Repository{pool: newTestPool(t)}
+		if _, err := repo.migrate(ctx, migrationsUpTo(t, version), true); err != nil {
+			t.Fatalf("migrate to %d: %v", version, err)
+		}
+		// Leave the schema as golang-migrate would have
+		_, err := repo.pool.Exec(ctx, `
+			DROP TABLE applied_migrations;
+			CREATE TABLE schema_migrations (version BIGINT PRIMARY KEY, dirty BOOLEAN NOT NULL);`)
+		if err != nil {
+			t.Fatalf("create golang-migrate table: %v", err)
+		}
+		if _, err := repo.pool.Exec(ctx, `INSERT INTO schema_migrations VALUES ($1, $2)`, version, dirty); err != nil {
+			t.Fatalf("record golang-migrate version: %v", err)
+		}
+		return repo
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		repo := legacy(t, 4, false)
+		applied, err := repo.Migrate(ctx)
+		if err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		if len(applied) != total-4 || applied[0].Version != 5 {
+			t.Errorf("expected migrations 5 to %d applied, got %v", total, applied)
+		}
+		var recorded int
+		if err := repo.pool.QueryRow(ctx, `SELECT COUNT(*) FROM applied_migrations`).Scan(&recorded); err != nil || recorded != total {
+			t.Errorf("expected %d recorded migrations, got %d, %v", total, recorded, err)
+		}
+	})
+
+	t.Run("dirty", func(t *testing.T) {
+		repo := legacy(t, 4, true)
+		if _, err := repo.Migrate(ctx); !errors.Is(err, ErrSchemaDirty) {
+			t.Errorf("expected ErrSchemaDirty, got %v", err)
+		}
+	})
+}
+
+func TestRepository_MigrateConcurrently(t *testing.T) {
+	repo := &Repository{pool: newTestPool(t)}
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	applied := 0
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrations, err := repo.Migrate(ctx)
+			if err != nil {
+				t.Errorf("migrate: %v", err)
+			}
+			mu.Lock()
+			applied += len(migrations)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if total := countMigrations(t); applied != total {
+		t.Errorf("expected %d migrations applied once in total, got %d", total, applied)
+	}
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("load embedded migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || m.Name == "" || m.sql == "" {
+			t.Errorf("expected migration %d with a name and SQL, got %s", i+1, m)
+		}
+	}
+	if got := migrations[0].String(); got != "000001_init" {
+		t.Errorf("expected 000001_init, got %s", got)
+	}
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr bool
+	}{
+		{name: "ordered by version", files: fstest.MapFS{
+			"migrations/000010_ten.up.sql": {Data: []byte("SELECT 10")},
+			"migrations/2_two.up.sql":      {Data: []byte("SELECT 2")},
+			"migrations/2_two.down.sql":    {Data: []byte("SELECT -2")},
+		}},
+		{name: "no version", files: fstest.MapFS{"migrations/init.up.sql": {}}, wantErr: true},
+		{name: "zero version", files: fstest.MapFS{"migrations/000000_init.up.sql": {}}, wantErr: true},
+		{name: "shared version", files: fstest.MapFS{
+			"migrations/000001_a.up.sql": {},
+			"migrations/1_b.up.sql":      {},
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", migrations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(migrations) != 2 || migrations[0].String() != "000002_two" || migrations[1].String() != "000010_ten" {
+				t.Errorf("expected 000002_two and 000010_ten, got %v", migrations)
+			}
+		})
+	}
+}
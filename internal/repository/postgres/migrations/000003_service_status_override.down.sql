@@ -0,0 +1,3 @@
+-- Rollback operator status override
+
+ALTER TABLE services DROP COLUMN IF EXISTS override_status;
@@ -0,0 +1,3 @@
+-- Operator status override for service registrations
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS override_status BOOLEAN NOT NULL DEFAULT FALSE;
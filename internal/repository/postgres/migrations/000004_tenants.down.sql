@@ -0,0 +1,7 @@
+-- Rollback tenant ownership
+
+DROP INDEX IF EXISTS idx_sessions_tenant_user;
+DROP INDEX IF EXISTS idx_services_tenant_id;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE services DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,9 @@
+-- Rollback weighted endpoints, keeping only each endpoint's URL
+
+ALTER TABLE services ADD COLUMN endpoint_urls TEXT[] NOT NULL DEFAULT '{}';
+UPDATE services SET endpoint_urls = ARRAY(
+    SELECT COALESCE(e->>'url', e#>>'{}') FROM jsonb_array_elements(endpoints) AS e
+);
+ALTER TABLE services DROP COLUMN endpoints;
+ALTER TABLE services RENAME COLUMN endpoint_urls TO endpoints;
+ALTER TABLE services ALTER COLUMN endpoints DROP DEFAULT;
@@ -0,0 +1,5 @@
+-- Weighted endpoints with per-endpoint health. Existing rows keep their
+-- endpoints as JSON strings, which the application reads as healthy
+-- endpoints of weight 1.
+
+ALTER TABLE services ALTER COLUMN endpoints TYPE JSONB USING to_jsonb(endpoints);
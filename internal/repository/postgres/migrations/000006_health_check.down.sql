@@ -0,0 +1,4 @@
+-- Rollback typed health checks; tcp checks are lost and http checks keep
+-- only their health_check_url
+
+ALTER TABLE services DROP COLUMN IF EXISTS health_check;
@@ -0,0 +1,4 @@
+-- Typed health checks. Rows without one keep probing health_check_url over
+-- http, as before.
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS health_check JSONB;
@@ -0,0 +1,3 @@
+-- Rollback the registry revision
+
+DROP TABLE IF EXISTS registry_revision;
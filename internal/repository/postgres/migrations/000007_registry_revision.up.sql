@@ -0,0 +1,13 @@
+-- Registry revision, bumped after every change to the services so listings
+-- can be served conditionally. The single row starts at the current time in
+-- milliseconds rather than zero, so clients holding a revision from before the
+-- table was recreated are unlikely to match it.
+
+CREATE TABLE IF NOT EXISTS registry_revision (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    revision BIGINT NOT NULL
+);
+
+INSERT INTO registry_revision (id, revision)
+VALUES (TRUE, (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT)
+ON CONFLICT (id) DO NOTHING;
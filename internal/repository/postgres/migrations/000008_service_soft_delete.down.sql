@@ -0,0 +1,5 @@
+-- Rollback soft deletes; soft-deleted services come back as registered
+
+DROP INDEX IF EXISTS idx_services_deleted_at;
+
+ALTER TABLE services DROP COLUMN IF EXISTS deleted_at;
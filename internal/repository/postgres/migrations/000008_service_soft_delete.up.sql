@@ -0,0 +1,6 @@
+-- Soft-deleted services. Deregistering sets deleted_at; the registry purges
+-- rows whose deleted_at is older than registry.deleted_retention.
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_services_deleted_at ON services (deleted_at) WHERE deleted_at IS NOT NULL;
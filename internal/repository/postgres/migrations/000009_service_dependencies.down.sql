@@ -0,0 +1,3 @@
+-- Rollback dependency declarations
+
+ALTER TABLE services DROP COLUMN IF EXISTS depends_on;
@@ -0,0 +1,4 @@
+-- Dependency declarations: the capabilities a service needs from others,
+-- which the registry's dependency graph resolves to their providers.
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS depends_on TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- Rollback the session lookup by user and service
+
+DROP INDEX IF EXISTS idx_sessions_user_service;
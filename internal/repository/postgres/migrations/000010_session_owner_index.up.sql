@@ -0,0 +1,3 @@
+-- Lookup of a user's newest session on a service, used by get-or-create
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_service ON sessions(user_id, service_id, created_at DESC);
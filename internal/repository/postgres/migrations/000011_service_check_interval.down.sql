@@ -0,0 +1,3 @@
+-- Rollback per-service health check intervals
+
+ALTER TABLE services DROP COLUMN IF EXISTS check_interval_seconds;
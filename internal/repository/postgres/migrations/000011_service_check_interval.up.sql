@@ -0,0 +1,3 @@
+-- Per-service health check intervals; 0 checks at the registry's interval
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS check_interval_seconds INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Rollback service instances; every registration becomes a service of its own
+
+ALTER TABLE services DROP COLUMN IF EXISTS instance_id;
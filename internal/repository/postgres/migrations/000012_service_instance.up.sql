@@ -0,0 +1,5 @@
+-- Service instances: registrations sharing a name with an instance_id group
+-- into one logical service. Existing rows keep an empty instance_id and stay
+-- single-instance services.
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS instance_id VARCHAR(128) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Rollback audit events
+
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,16 @@
+-- Audit events, read newest first by id and pruned by time
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMP NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,
+    resource VARCHAR(512) NOT NULL,
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    details JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_time ON audit_events (time);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events (actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource ON audit_events (resource, id);
@@ -2,13 +2,24 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aq189/bin/internal/domain/pagination"
 	"github.com/aq189/bin/internal/domain/service"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Repository implements PostgreSQL-based storage
 type Repository struct {
-	// TODO: Add database connection pool
+	pool *pgxpool.Pool
 }
 
 // Config holds PostgreSQL configuration
@@ -20,44 +31,403 @@ type Config struct {
 	Database string
 }
 
+// connString builds a postgres:// URL from the configuration
+func (c Config) connString() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:   "/" + c.Database,
+	}
+	return u.String()
+}
+
 // NewRepository creates a new PostgreSQL repository
 func NewRepository(ctx context.Context, cfg Config) (*Repository, error) {
-	// TODO: Initialize database connection
-	return &Repository{}, nil
+	pool, err := pgxpool.New(ctx, cfg.connString())
+	if err != nil {
+		return nil, fmt.Errorf("create pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping postgres at %s:%d: %w", cfg.Host, cfg.Port, err)
+	}
+
+	return &Repository{pool: pool}, nil
+}
+
+// querier runs statements on the pool or, inside WithinTx, on the transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// txKey carries the transaction started by WithinTx
+type txKey struct{}
+
+// db returns the transaction ctx was started with by WithinTx, or the pool
+func (r *Repository) db(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return r.pool
+}
+
+// WithinTx runs fn in a PostgreSQL transaction, committing when fn succeeds
+// and rolling back when it fails. Repository calls made with the context
+// passed to fn run in the transaction.
+func (r *Repository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
 }
 
-// Register stores a new service in PostgreSQL
+const serviceColumns = `id, tenant_id, name, version, endpoints, capabilities, metadata, status,
+	override_status, registered_at, last_heartbeat, COALESCE(health_check_url, ''), health_check, deleted_at, depends_on,
+	check_interval_seconds, instance_id`
+
+// Register stores a new service in PostgreSQL, replacing any existing row with the same ID
 func (r *Repository) Register(ctx context.Context, svc *service.Service) error {
-	// TODO: Implement PostgreSQL insertion
+	_, err := r.db(ctx).Exec(ctx, `
+		INSERT INTO services (id, name, version, endpoints, capabilities, metadata, status,
+			override_status, registered_at, last_heartbeat, health_check_url, tenant_id, health_check, deleted_at, depends_on,
+			check_interval_seconds, instance_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (id) DO UPDATE SET
+			tenant_id = EXCLUDED.tenant_id,
+			name = EXCLUDED.name,
+			version = EXCLUDED.version,
+			endpoints = EXCLUDED.endpoints,
+			capabilities = EXCLUDED.capabilities,
+			metadata = EXCLUDED.metadata,
+			status = EXCLUDED.status,
+			override_status = EXCLUDED.override_status,
+			registered_at = EXCLUDED.registered_at,
+			last_heartbeat = EXCLUDED.last_heartbeat,
+			health_check_url = EXCLUDED.health_check_url,
+			health_check = EXCLUDED.health_check,
+			deleted_at = EXCLUDED.deleted_at,
+			depends_on = EXCLUDED.depends_on,
+			check_interval_seconds = EXCLUDED.check_interval_seconds,
+			instance_id = EXCLUDED.instance_id,
+			updated_at = NOW()`,
+		svc.ID, svc.Name, svc.Version, nonNil(svc.Endpoints), nonNil(svc.Capabilities), svc.Metadata,
+		string(svc.Status), svc.OverrideStatus, svc.RegisteredAt.UTC(), svc.LastHeartbeat.UTC(), svc.HealthCheckURL,
+		svc.TenantID, svc.HealthCheck, nullTime(svc.DeletedAt), nonNil(svc.DependsOn), svc.CheckIntervalSeconds,
+		svc.InstanceID,
+	)
+	if err != nil {
+		return fmt.Errorf("register service: %w", err)
+	}
 	return nil
 }
 
+// CreateIfAbsent inserts a service unless its ID is taken, returning the existing row if so
+func (r *Repository) CreateIfAbsent(ctx context.Context, svc *service.Service) (*service.Service, error) {
+	tag, err := r.db(ctx).Exec(ctx, `
+		INSERT INTO services (id, name, version, endpoints, capabilities, metadata, status,
+			override_status, registered_at, last_heartbeat, health_check_url, tenant_id, health_check, deleted_at, depends_on,
+			check_interval_seconds, instance_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (id) DO NOTHING`,
+		svc.ID, svc.Name, svc.Version, nonNil(svc.Endpoints), nonNil(svc.Capabilities), svc.Metadata,
+		string(svc.Status), svc.OverrideStatus, svc.RegisteredAt.UTC(), svc.LastHeartbeat.UTC(), svc.HealthCheckURL,
+		svc.TenantID, svc.HealthCheck, nullTime(svc.DeletedAt), nonNil(svc.DependsOn), svc.CheckIntervalSeconds,
+		svc.InstanceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create service: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	return r.Get(ctx, svc.ID)
+}
+
 // Deregister removes a service from PostgreSQL
 func (r *Repository) Deregister(ctx context.Context, id string) error {
-	// TODO: Implement PostgreSQL deletion
+	if _, err := r.db(ctx).Exec(ctx, `DELETE FROM services WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("deregister service: %w", err)
+	}
 	return nil
 }
 
 // Get retrieves a service from PostgreSQL
 func (r *Repository) Get(ctx context.Context, id string) (*service.Service, error) {
-	// TODO: Implement PostgreSQL query
-	return nil, nil
+	row := r.db(ctx).QueryRow(ctx, `SELECT `+serviceColumns+` FROM services WHERE id = $1`, id)
+
+	svc, err := scanService(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, service.ErrServiceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get service: %w", err)
+	}
+
+	return svc, nil
 }
 
-// List returns all services from PostgreSQL
+// List returns all services from PostgreSQL that are not soft-deleted
 func (r *Repository) List(ctx context.Context) ([]*service.Service, error) {
-	// TODO: Implement PostgreSQL query
-	return nil, nil
+	rows, err := r.db(ctx).Query(ctx, `SELECT `+serviceColumns+` FROM services WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	defer rows.Close()
+
+	services := make([]*service.Service, 0)
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan service: %w", err)
+		}
+		services = append(services, svc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	return services, nil
+}
+
+// serviceOrder maps sort fields to the ORDER BY columns, each ending in the ID tie-breaker
+var serviceOrder = map[string][]string{
+	service.SortByID:            {"id"},
+	service.SortByName:          {"name", "id"},
+	service.SortByRegisteredAt:  {"registered_at", "id"},
+	service.SortByLastHeartbeat: {"last_heartbeat", "id"},
+}
+
+// listFilter is the WHERE clause ListPaged selects services with; $1 and $2
+// carry the tenant scope, $3 whether soft-deleted services are included, $4
+// the statuses selected, none meaning all, $5 the earliest registration time
+// or NULL and $6 the name prefix
+const listFilter = `($1 OR tenant_id = $2) AND ($3 OR deleted_at IS NULL)
+	AND (cardinality($4::text[]) = 0 OR status = ANY($4)) AND ($5::timestamp IS NULL OR registered_at >= $5)
+	AND starts_with(name, $6)`
+
+// ListPaged returns one page of the services matching filter, pushing the
+// filter, order and limit down to PostgreSQL
+func (r *Repository) ListPaged(ctx context.Context, filter service.ListFilter, opts pagination.ListOptions) ([]*service.Service, int, error) {
+	scope := filter.Scope
+	statuses := make([]string, len(filter.Statuses))
+	for i, status := range filter.Statuses {
+		statuses[i] = string(status)
+	}
+	args := []any{scope.All, scope.ID, filter.IncludeDeleted, statuses, nullTime(filter.RegisteredSince), filter.NamePrefix}
+
+	var total int
+	err := r.db(ctx).QueryRow(ctx, `SELECT COUNT(*) FROM services WHERE `+listFilter, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count services: %w", err)
+	}
+
+	columns, ok := serviceOrder[opts.SortBy]
+	if !ok {
+		columns = serviceOrder[service.SortByID]
+	}
+	order := strings.Join(columns, ", ")
+	if opts.Descending {
+		order = strings.Join(columns, " DESC, ") + " DESC"
+	}
+	start, end := opts.Window(total)
+
+	rows, err := r.db(ctx).Query(ctx,
+		`SELECT `+serviceColumns+` FROM services WHERE `+listFilter+` ORDER BY `+order+` LIMIT $7 OFFSET $8`,
+		append(args, end-start, start)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list services: %w", err)
+	}
+	defer rows.Close()
+
+	services := make([]*service.Service, 0, end-start)
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan service: %w", err)
+		}
+		services = append(services, svc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list services: %w", err)
+	}
+
+	return services, total, nil
+}
+
+// updateService is the statement Update and BatchUpdate store a service with;
+// updateArgs returns its arguments
+const updateService = `
+	UPDATE services SET
+		name = $2, version = $3, endpoints = $4, capabilities = $5, metadata = $6,
+		status = $7, override_status = $8, registered_at = $9, last_heartbeat = $10,
+		health_check_url = NULLIF($11, ''), tenant_id = $12, health_check = $13, deleted_at = $14,
+		depends_on = $15, check_interval_seconds = $16, instance_id = $17, updated_at = NOW()
+	WHERE id = $1`
+
+func updateArgs(svc *service.Service) []any {
+	return []any{
+		svc.ID, svc.Name, svc.Version, nonNil(svc.Endpoints), nonNil(svc.Capabilities), svc.Metadata,
+		string(svc.Status), svc.OverrideStatus, svc.RegisteredAt.UTC(), svc.LastHeartbeat.UTC(), svc.HealthCheckURL,
+		svc.TenantID, svc.HealthCheck, nullTime(svc.DeletedAt), nonNil(svc.DependsOn), svc.CheckIntervalSeconds,
+		svc.InstanceID,
+	}
 }
 
 // Update updates a service in PostgreSQL
 func (r *Repository) Update(ctx context.Context, svc *service.Service) error {
-	// TODO: Implement PostgreSQL update
+	tag, err := r.db(ctx).Exec(ctx, updateService, updateArgs(svc)...)
+	if err != nil {
+		return fmt.Errorf("update service: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return service.ErrServiceNotFound
+	}
+	return nil
+}
+
+// BatchUpdate stores the services in one transaction, sending their updates
+// in a single batch. Services no longer stored are skipped.
+func (r *Repository) BatchUpdate(ctx context.Context, services []*service.Service) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		batch := &pgx.Batch{}
+		for _, svc := range services {
+			batch.Queue(updateService, updateArgs(svc)...)
+		}
+		if err := r.db(ctx).SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("update services: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateHeartbeat records a heartbeat with a single UPDATE, leaving the rest
+// of the row untouched. The revision moves forward when the status changes.
+func (r *Repository) UpdateHeartbeat(ctx context.Context, id string, at time.Time) error {
+	var changed bool
+	err := r.db(ctx).QueryRow(ctx, `
+		WITH previous AS (SELECT status FROM services WHERE id = $1 FOR UPDATE)
+		UPDATE services s SET
+			last_heartbeat = $2,
+			status = CASE WHEN s.override_status THEN s.status ELSE $3 END,
+			updated_at = NOW()
+		FROM previous
+		WHERE s.id = $1 AND s.deleted_at IS NULL
+		RETURNING s.status <> previous.status`,
+		id, at.UTC(), string(service.StatusHealthy),
+	).Scan(&changed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Nothing was updated: the service is either unknown or soft-deleted
+		var deleted bool
+		err := r.db(ctx).QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM services WHERE id = $1`, id).Scan(&deleted)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return service.ErrServiceNotFound
+		case err != nil:
+			return fmt.Errorf("update heartbeat: %w", err)
+		case deleted:
+			return service.ErrServiceDeleted
+		}
+		return service.ErrServiceNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update heartbeat: %w", err)
+	}
+	if changed {
+		if _, err := r.BumpRevision(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Purge deletes the services soft-deleted before the given time
+func (r *Repository) Purge(ctx context.Context, before time.Time) (int, error) {
+	tag, err := r.db(ctx).Exec(ctx, `DELETE FROM services WHERE deleted_at < $1`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("purge services: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// GetRevision returns the registry revision
+func (r *Repository) GetRevision(ctx context.Context) (int64, error) {
+	var revision int64
+	if err := r.db(ctx).QueryRow(ctx, `SELECT revision FROM registry_revision`).Scan(&revision); err != nil {
+		return 0, fmt.Errorf("get registry revision: %w", err)
+	}
+	return revision, nil
+}
+
+// BumpRevision moves the registry revision forward and returns it
+func (r *Repository) BumpRevision(ctx context.Context) (int64, error) {
+	var revision int64
+	err := r.db(ctx).QueryRow(ctx, `UPDATE registry_revision SET revision = revision + 1 RETURNING revision`).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("bump registry revision: %w", err)
+	}
+	return revision, nil
+}
+
 // Close closes the database connection
 func (r *Repository) Close() error {
-	// TODO: Close database connection
+	r.pool.Close()
 	return nil
 }
+
+// scanService decodes a row selected with serviceColumns
+func scanService(row pgx.Row) (*service.Service, error) {
+	var (
+		svc       service.Service
+		status    string
+		deletedAt *time.Time
+	)
+
+	err := row.Scan(
+		&svc.ID, &svc.TenantID, &svc.Name, &svc.Version, &svc.Endpoints, &svc.Capabilities, &svc.Metadata,
+		&status, &svc.OverrideStatus, &svc.RegisteredAt, &svc.LastHeartbeat, &svc.HealthCheckURL,
+		&svc.HealthCheck, &deletedAt, &svc.DependsOn, &svc.CheckIntervalSeconds, &svc.InstanceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Status = service.Status(status)
+	svc.RegisteredAt = asUTC(svc.RegisteredAt)
+	svc.LastHeartbeat = asUTC(svc.LastHeartbeat)
+	if deletedAt != nil {
+		svc.DeletedAt = asUTC(*deletedAt)
+	}
+
+	return &svc, nil
+}
+
+// nonNil keeps NOT NULL array and JSONB columns satisfied when a slice is unset
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// asUTC marks a TIMESTAMP (without time zone) value as UTC, which is how it was written
+func asUTC(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,350 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newTestPool connects to the database named by POSTGRES_TEST_DSN with a
+// schema of its own first on the search path, dropped when the test ends
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+		admin.Close(ctx)
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("parse dsn: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// newTestRepository returns a repository on an empty, migrated schema
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	repo := &Repository{pool: newTestPool(t)}
+	if _, err := repo.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return repo
+}
+
+func TestRepository_UpdateHeartbeat(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	registered := time.Now().UTC().Truncate(time.Microsecond)
+	repo.Register(ctx, &service.Service{ID: "svc-1", Name: "payment", Status: service.StatusUnhealthy, RegisteredAt: registered})
+	repo.Register(ctx, &service.Service{ID: "svc-2", Name: "payment", Status: service.StatusDraining, OverrideStatus: true, RegisteredAt: registered})
+
+	at := registered.Add(time.Minute)
+	for _, id := range []string{"svc-1", "svc-2"} {
+		if err := repo.UpdateHeartbeat(ctx, id, at); err != nil {
+			t.Fatalf("%s: expected no error, got %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		id         string
+		wantStatus service.Status
+	}{
+		{id: "svc-1", wantStatus: service.StatusHealthy},
+		{id: "svc-2", wantStatus: service.StatusDraining},
+	}
+	for _, tt := range tests {
+		got, err := repo.Get(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("get %s: %v", tt.id, err)
+		}
+		if !got.LastHeartbeat.Equal(at) || got.Status != tt.wantStatus {
+			t.Errorf("%s: expected heartbeat %v and status %s, got %v and %s", tt.id, at, tt.wantStatus, got.LastHeartbeat, got.Status)
+		}
+	}
+
+	if err := repo.UpdateHeartbeat(ctx, "missing", at); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+func TestRepository_SoftDelete(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	registered := time.Now().UTC().Truncate(time.Microsecond)
+	deletedAt := registered.Add(time.Minute)
+	repo.Register(ctx, &service.Service{ID: "svc-1", Name: "payment", Status: service.StatusHealthy, RegisteredAt: registered})
+	repo.Register(ctx, &service.Service{ID: "svc-2", Name: "payment", Status: service.StatusHealthy, RegisteredAt: registered, DeletedAt: deletedAt})
+
+	got, err := repo.Get(ctx, "svc-2")
+	if err != nil || !got.DeletedAt.Equal(deletedAt) {
+		t.Errorf("expected Get to return the soft-deleted service, got %v, %v", got, err)
+	}
+	if services, _ := repo.List(ctx); len(services) != 1 {
+		t.Errorf("expected List to leave out soft-deleted services, got %d", len(services))
+	}
+	if _, total, _ := repo.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted, IncludeDeleted: true}, pagination.ListOptions{Limit: 10}); total != 2 {
+		t.Errorf("expected ListPaged to include soft-deleted services when asked, got %d", total)
+	}
+	if err := repo.UpdateHeartbeat(ctx, "svc-2", time.Now()); !errors.Is(err, service.ErrServiceDeleted) {
+		t.Errorf("expected ErrServiceDeleted, got %v", err)
+	}
+
+	if purged, _ := repo.Purge(ctx, deletedAt); purged != 0 {
+		t.Errorf("expected nothing purged before the cutoff, got %d", purged)
+	}
+	if purged, _ := repo.Purge(ctx, deletedAt.Add(time.Second)); purged != 1 {
+		t.Errorf("expected one service purged, got %d", purged)
+	}
+	if _, err := repo.Get(ctx, "svc-2"); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected the purged service gone, got %v", err)
+	}
+}
+
+func TestRepository_Revision(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	repo.Register(ctx, &service.Service{ID: "svc-1", Name: "payment", Status: service.StatusUnhealthy, RegisteredAt: time.Now()})
+
+	start, err := repo.GetRevision(ctx)
+	if err != nil {
+		t.Fatalf("get revision: %v", err)
+	}
+	if got, err := repo.BumpRevision(ctx); err != nil || got != start+1 {
+		t.Fatalf("expected bump to revision %d, got %d (%v)", start+1, got, err)
+	}
+
+	tests := []struct {
+		name string
+		want int64
+	}{
+		{name: "heartbeat changing the status", want: start + 2},
+		{name: "heartbeat keeping the status", want: start + 2},
+	}
+	for _, tt := range tests {
+		if err := repo.UpdateHeartbeat(ctx, "svc-1", time.Now()); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if got, _ := repo.GetRevision(ctx); got != tt.want {
+			t.Errorf("%s: expected revision %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRepository_WithinTx(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	registered := time.Now().UTC().Truncate(time.Microsecond)
+	repo.Register(ctx, &service.Service{ID: "svc-1", Name: "payment", RegisteredAt: registered})
+
+	err := repo.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := repo.CreateIfAbsent(ctx, &service.Service{ID: "svc-2", Name: "search", RegisteredAt: registered}); err != nil {
+			return err
+		}
+		if err := repo.Deregister(ctx, "svc-1"); err != nil {
+			return err
+		}
+		if _, err := repo.Get(ctx, "svc-2"); err != nil {
+			t.Errorf("expected the transaction to see its own insert, got %v", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected the callback's error, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-1"); err != nil {
+		t.Errorf("expected svc-1 to survive the rollback, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-2"); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected svc-2 to be rolled back, got %v", err)
+	}
+
+	err = repo.WithinTx(ctx, func(ctx context.Context) error {
+		return repo.WithinTx(ctx, func(ctx context.Context) error {
+			return repo.Register(ctx, &service.Service{ID: "svc-2", Name: "search", RegisteredAt: registered})
+		})
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "svc-2"); err != nil {
+		t.Errorf("expected svc-2 to be committed, got %v", err)
+	}
+}
+
+func TestRepository_Endpoints(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	// A row written before endpoints carried weights, as migrated by 000005
+	_, err := repo.pool.Exec(ctx, `
+		INSERT INTO services (id, name, version, endpoints, capabilities, status, registered_at, last_heartbeat)
+		VALUES ('legacy', 'payment', '1.0', '["http://10.0.0.1:8080"]', '{}', 'healthy', NOW(), NOW())`)
+	if err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+	legacy, err := repo.Get(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("get legacy: %v", err)
+	}
+	if want := []service.Endpoint{{URL: "http://10.0.0.1:8080", Weight: 1, Healthy: true}}; !slices.Equal(legacy.Endpoints, want) {
+		t.Errorf("expected legacy endpoints %v, got %v", want, legacy.Endpoints)
+	}
+
+	checked := time.Now().UTC().Truncate(time.Microsecond)
+	endpoints := []service.Endpoint{
+		{URL: "http://10.0.0.2:8080", Weight: 3, Healthy: true, LastCheckedAt: checked},
+		{URL: "http://10.0.0.3:8080", Weight: 1, Healthy: false, LastCheckedAt: checked},
+	}
+	repo.Register(ctx, &service.Service{ID: "svc-1", Name: "payment", Endpoints: endpoints, RegisteredAt: checked})
+	got, err := repo.Get(ctx, "svc-1")
+	if err != nil {
+		t.Fatalf("get svc-1: %v", err)
+	}
+	if !slices.EqualFunc(got.Endpoints, endpoints, func(a, b service.Endpoint) bool {
+		return a.URL == b.URL && a.Weight == b.Weight && a.Healthy == b.Healthy && a.LastCheckedAt.Equal(b.LastCheckedAt)
+	}) {
+		t.Errorf("expected endpoints %v, got %v", endpoints, got.Endpoints)
+	}
+}
+
+func TestRepository_HealthCheck(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	registered := time.Now().UTC().Truncate(time.Microsecond)
+
+	tcpCheck := &service.HealthCheck{Type: service.HealthCheckTCP, URL: "10.0.0.1:9090", TimeoutSeconds: 2}
+	httpCheck := &service.HealthCheck{Type: service.HealthCheckHTTP, URL: "http://10.0.0.2:8080/health", ExpectedStatusCodes: []int{200, 204}, ExpectedBodySubstring: "ok"}
+	repo.Register(ctx, &service.Service{ID: "tcp", Name: "grpc", HealthCheck: tcpCheck, RegisteredAt: registered})
+	repo.Register(ctx, &service.Service{ID: "http", Name: "payment", HealthCheckURL: httpCheck.URL, HealthCheck: httpCheck, RegisteredAt: registered})
+	repo.Register(ctx, &service.Service{ID: "legacy", Name: "search", HealthCheckURL: "http://10.0.0.3:8080/health", RegisteredAt: registered})
+
+	tests := []struct {
+		id   string
+		want *service.HealthCheck
+	}{
+		{id: "tcp", want: tcpCheck},
+		{id: "http", want: httpCheck},
+		{id: "legacy", want: &service.HealthCheck{Type: service.HealthCheckHTTP, URL: "http://10.0.0.3:8080/health"}},
+	}
+	for _, tt := range tests {
+		got, err := repo.Get(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("get %s: %v", tt.id, err)
+		}
+		check := got.EffectiveHealthCheck()
+		if check == nil || check.Type != tt.want.Type || check.URL != tt.want.URL || check.TimeoutSeconds != tt.want.TimeoutSeconds ||
+			check.ExpectedBodySubstring != tt.want.ExpectedBodySubstring || !slices.Equal(check.ExpectedStatusCodes, tt.want.ExpectedStatusCodes) {
+			t.Errorf("%s: expected health check %+v, got %+v", tt.id, tt.want, check)
+		}
+	}
+}
+
+func TestRepository_DependsOn(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	repo.Register(ctx, &service.Service{ID: "orders", Name: "orders", DependsOn: []string{"payments", "inventory"}})
+	repo.Register(ctx, &service.Service{ID: "payments", Name: "payments"})
+
+	got, err := repo.Get(ctx, "orders")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !slices.Equal(got.DependsOn, []string{"payments", "inventory"}) {
+		t.Errorf("expected dependencies to round trip, got %v", got.DependsOn)
+	}
+
+	got.DependsOn = []string{"inventory"}
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, _ := repo.Get(ctx, "orders"); !slices.Equal(got.DependsOn, []string{"inventory"}) {
+		t.Errorf("expected updated dependencies, got %v", got.DependsOn)
+	}
+	if got, _ := repo.Get(ctx, "payments"); len(got.DependsOn) != 0 {
+		t.Errorf("expected no dependencies, got %v", got.DependsOn)
+	}
+}
+
+func TestRepository_CheckInterval(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	repo.Register(ctx, &service.Service{ID: "orders", Name: "orders", CheckIntervalSeconds: 10})
+	got, err := repo.Get(ctx, "orders")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.CheckIntervalSeconds != 10 {
+		t.Errorf("expected the check interval to round trip, got %d", got.CheckIntervalSeconds)
+	}
+
+	got.CheckIntervalSeconds = 0
+	if err := repo.Update(ctx, got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, _ := repo.Get(ctx, "orders"); got.CheckIntervalSeconds != 0 {
+		t.Errorf("expected the registry interval restored, got %d", got.CheckIntervalSeconds)
+	}
+}
+
+func TestAPIKeyRepository_Errors(t *testing.T) {
+	repo := NewAPIKeyRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	key := &apikey.APIKey{ID: "ak_1", Name: "ci", Hash: "hash-1", CreatedAt: time.Now()}
+	if err := repo.Create(ctx, key); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := repo.Create(ctx, key); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+	if _, err := repo.GetByHash(ctx, "unknown"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := repo.Revoke(ctx, "ak_missing", time.Now()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
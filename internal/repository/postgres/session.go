@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation is the SQLSTATE for unique constraint violations
+const uniqueViolation = "23505"
+
+// utcNow is the SQL expression for the current time in the UTC wall clock
+// that TIMESTAMP (without time zone) columns are written in
+const utcNow = `(NOW() AT TIME ZONE 'UTC')`
+
+// SessionRepository implements PostgreSQL-based session storage.
+// Expired rows are invisible to Get and Update; DeleteExpired removes them.
+type SessionRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewSessionRepository creates a session repository sharing the PostgreSQL pool
+func NewSessionRepository(repo *Repository) *SessionRepository {
+	return &SessionRepository{pool: repo.pool}
+}
+
+// Create stores a new session
+func (r *SessionRepository) Create(ctx context.Context, sess *session.Session) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO sessions (id, user_id, service_id, tenant_id, data, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		sess.ID, sess.UserID, sess.ServiceID, sess.TenantID, nonNilData(sess.Data),
+		sess.CreatedAt.UTC(), sess.UpdatedAt.UTC(), sess.ExpiresAt.UTC(),
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return session.ErrSessionExists
+	}
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves an unexpired session by ID. Expired sessions are reported as
+// not found even if the cleanup loop hasn't deleted them yet.
+func (r *SessionRepository) Get(ctx context.Context, id string) (*session.Session, error) {
+	var sess session.Session
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, user_id, service_id, tenant_id, data, created_at, updated_at, expires_at
+		FROM sessions
+		WHERE id = $1 AND expires_at > `+utcNow, id,
+	).Scan(&sess.ID, &sess.UserID, &sess.ServiceID, &sess.TenantID, &sess.Data, &sess.CreatedAt, &sess.UpdatedAt, &sess.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, session.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+
+	sess.CreatedAt = asUTC(sess.CreatedAt)
+	sess.UpdatedAt = asUTC(sess.UpdatedAt)
+	sess.ExpiresAt = asUTC(sess.ExpiresAt)
+
+	return &sess, nil
+}
+
+// Update updates an unexpired session
+func (r *SessionRepository) Update(ctx context.Context, sess *session.Session) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE sessions
+		SET user_id = $2, service_id = $3, data = $4, updated_at = $5, expires_at = $6
+		WHERE id = $1 AND expires_at > `+utcNow,
+		sess.ID, sess.UserID, sess.ServiceID, nonNilData(sess.Data), sess.UpdatedAt.UTC(), sess.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return session.ErrSessionNotFound
+	}
+	return nil
+}
+
+// Delete removes a session
+func (r *SessionRepository) Delete(ctx context.Context, id string) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM sessions WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes all expired sessions in a single statement and
+// returns how many rows were deleted
+func (r *SessionRepository) DeleteExpired(ctx context.Context) (int, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM sessions WHERE expires_at <= `+utcNow)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// RemoveExpired deletes the sessions expired by now in a single
+// statement and returns them without their data
+func (r *SessionRepository) RemoveExpired(ctx context.Context, now time.Time) ([]*session.Session, error) {
+	rows, err := r.pool.Query(ctx, `
+		DELETE FROM sessions
+		WHERE expires_at <= $1
+		RETURNING id, user_id, service_id, tenant_id, created_at, updated_at, expires_at`, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var removed []*session.Session
+	for rows.Next() {
+		var sess session.Session
+		if err := rows.Scan(&sess.ID, &sess.UserID, &sess.ServiceID, &sess.TenantID, &sess.CreatedAt, &sess.UpdatedAt, &sess.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan expired session: %w", err)
+		}
+		sess.CreatedAt = asUTC(sess.CreatedAt)
+		sess.UpdatedAt = asUTC(sess.UpdatedAt)
+		sess.ExpiresAt = asUTC(sess.ExpiresAt)
+		removed = append(removed, &sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return removed, nil
+}
+
+// CountActive counts the sessions of every tenant expiring after now
+func (r *SessionRepository) CountActive(ctx context.Context, now time.Time) (int, error) {
+	var active int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM sessions WHERE expires_at > $1`, now.UTC()).Scan(&active); err != nil {
+		return 0, fmt.Errorf("count active sessions: %w", err)
+	}
+	return active, nil
+}
+
+// sessionOrder maps sort fields to ORDER BY clauses, each ending in the ID tie-breaker
+var sessionOrder = map[string]string{
+	session.SortByCreatedAt: "created_at, id",
+	session.SortByExpiresAt: "expires_at, id",
+	session.SortByID:        "id",
+}
+
+// ListByUser returns one page of a user's unexpired sessions within scope
+func (r *SessionRepository) ListByUser(ctx context.Context, scope tenant.Scope, userID string, opts pagination.ListOptions) ([]*session.Session, int, error) {
+	var total int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM sessions
+		WHERE user_id = $1 AND ($2 OR tenant_id = $3) AND expires_at > `+utcNow,
+		userID, scope.All, scope.ID,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count sessions: %w", err)
+	}
+
+	order, ok := sessionOrder[opts.SortBy]
+	if !ok {
+		order = sessionOrder[session.SortByCreatedAt]
+	}
+	start, end := opts.Window(total)
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, user_id, service_id, tenant_id, data, created_at, updated_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND ($2 OR tenant_id = $3) AND expires_at > `+utcNow+`
+		ORDER BY `+order+`
+		LIMIT $4 OFFSET $5`,
+		userID, scope.All, scope.ID, end-start, start,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*session.Session, 0, end-start)
+	for rows.Next() {
+		var sess session.Session
+		if err := rows.Scan(&sess.ID, &sess.UserID, &sess.ServiceID, &sess.TenantID, &sess.Data, &sess.CreatedAt, &sess.UpdatedAt, &sess.ExpiresAt); err != nil {
+			return nil, 0, fmt.Errorf("scan session: %w", err)
+		}
+		sess.CreatedAt = asUTC(sess.CreatedAt)
+		sess.UpdatedAt = asUTC(sess.UpdatedAt)
+		sess.ExpiresAt = asUTC(sess.ExpiresAt)
+		sessions = append(sessions, &sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list sessions: %w", err)
+	}
+
+	return sessions, total, nil
+}
+
+// GetByUserService returns the newest unexpired session within scope that
+// userID holds on serviceID, using the (user_id, service_id, created_at) index
+func (r *SessionRepository) GetByUserService(ctx context.Context, scope tenant.Scope, userID, serviceID string) (*session.Session, error) {
+	var sess session.Session
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, user_id, service_id, tenant_id, data, created_at, updated_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND service_id = $2 AND ($3 OR tenant_id = $4) AND expires_at > `+utcNow+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`,
+		userID, serviceID, scope.All, scope.ID,
+	).Scan(&sess.ID, &sess.UserID, &sess.ServiceID, &sess.TenantID, &sess.Data, &sess.CreatedAt, &sess.UpdatedAt, &sess.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, session.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session by user and service: %w", err)
+	}
+
+	sess.CreatedAt = asUTC(sess.CreatedAt)
+	sess.UpdatedAt = asUTC(sess.UpdatedAt)
+	sess.ExpiresAt = asUTC(sess.ExpiresAt)
+
+	return &sess, nil
+}
+
+// nonNilData keeps the NOT NULL data column satisfied when a session has no data
+func nonNilData(data map[string]any) map[string]any {
+	if data == nil {
+		return map[string]any{}
+	}
+	return data
+}
@@ -0,0 +1,241 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+)
+
+func newTestSession(id string, expiresIn time.Duration) *session.Session {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return &session.Session{
+		ID:        id,
+		UserID:    "user-" + id,
+		ServiceID: "service-1",
+		Data:      map[string]any{"theme": "dark"},
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(expiresIn),
+	}
+}
+
+func TestSessionRepository_Create(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	sess := newTestSession("sess-1", time.Hour)
+	if err := repo.Create(ctx, sess); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("duplicate maps to ErrSessionExists", func(t *testing.T) {
+		err := repo.Create(ctx, sess)
+		if !errors.Is(err, session.ErrSessionExists) {
+			t.Errorf("expected ErrSessionExists, got %v", err)
+		}
+	})
+}
+
+func TestSessionRepository_Get(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	valid := newTestSession("sess-valid", time.Hour)
+	expired := newTestSession("sess-expired", -time.Minute)
+	repo.Create(ctx, valid)
+	repo.Create(ctx, expired)
+
+	t.Run("retrieves existing session", func(t *testing.T) {
+		got, err := repo.Get(ctx, valid.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got.UserID != valid.UserID || got.Data["theme"] != "dark" {
+			t.Errorf("expected %+v, got %+v", valid, got)
+		}
+		if !got.ExpiresAt.Equal(valid.ExpiresAt) {
+			t.Errorf("expected expires_at %v, got %v", valid.ExpiresAt, got.ExpiresAt)
+		}
+	})
+
+	t.Run("expired session is not returned", func(t *testing.T) {
+		if _, err := repo.Get(ctx, expired.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for expired session, got %v", err)
+		}
+	})
+
+	t.Run("returns error for non-existent session", func(t *testing.T) {
+		if _, err := repo.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSessionRepository_Update(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	sess := newTestSession("sess-1", time.Hour)
+	repo.Create(ctx, sess)
+
+	sess.Data["theme"] = "light"
+	if err := repo.Update(ctx, sess); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, _ := repo.Get(ctx, sess.ID)
+	if got.Data["theme"] != "light" {
+		t.Errorf("expected updated data, got %v", got.Data["theme"])
+	}
+
+	if err := repo.Update(ctx, newTestSession("missing", time.Hour)); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSessionRepository_DeleteExpired(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	repo.Create(ctx, newTestSession("expired-1", -time.Hour))
+	repo.Create(ctx, newTestSession("expired-2", -time.Minute))
+	repo.Create(ctx, newTestSession("valid", time.Hour))
+
+	count, err := repo.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 deleted sessions, got %d", count)
+	}
+
+	if _, err := repo.Get(ctx, "valid"); err != nil {
+		t.Error("expected valid session to still exist")
+	}
+
+	count, _ = repo.DeleteExpired(ctx)
+	if count != 0 {
+		t.Errorf("expected nothing left to delete, got %d", count)
+	}
+}
+
+func TestSessionRepository_CountActive(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	repo.Create(ctx, newTestSession("expired", -time.Minute))
+	repo.Create(ctx, newTestSession("active-1", time.Hour))
+	other := newTestSession("active-2", time.Hour)
+	other.TenantID = "acme"
+	repo.Create(ctx, other)
+
+	active, err := repo.CountActive(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if active != 2 {
+		t.Errorf("expected 2 active sessions, got %d", active)
+	}
+}
+
+func TestSessionRepository_Delete(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	sess := newTestSession("sess-1", time.Hour)
+	repo.Create(ctx, sess)
+
+	if err := repo.Delete(ctx, sess.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := repo.Get(ctx, sess.ID); err == nil {
+		t.Error("expected deleted session to be gone")
+	}
+	if err := repo.Delete(ctx, "missing"); err != nil {
+		t.Errorf("expected no error deleting non-existent session, got %v", err)
+	}
+}
+
+func TestSessionRepository_ListByUser(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	for i, id := range []string{"sess-b", "sess-a", "sess-c"} {
+		sess := newTestSession(id, time.Hour)
+		sess.UserID = "user-1"
+		sess.CreatedAt = sess.CreatedAt.Add(time.Duration(i) * time.Second)
+		repo.Create(ctx, sess)
+	}
+	expired := newTestSession("sess-expired", -time.Minute)
+	expired.UserID = "user-1"
+	repo.Create(ctx, expired)
+
+	page, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 2, Offset: 1, SortBy: session.SortByID})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if total != 3 {
+		t.Errorf("expected 3 active sessions, got %d", total)
+	}
+	if len(page) != 2 || page[0].ID != "sess-b" || page[1].ID != "sess-c" {
+		t.Errorf("expected [sess-b sess-c], got %v", page)
+	}
+	owned := newTestSession("sess-acme", time.Hour)
+	owned.UserID = "user-1"
+	owned.TenantID = "acme"
+	repo.Create(ctx, owned)
+
+	page, total, err = repo.ListByUser(ctx, tenant.Only("acme"), "user-1", pagination.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if total != 1 || len(page) != 1 || page[0].TenantID != "acme" {
+		t.Errorf("expected only the tenant's session, got %v", page)
+	}
+}
+
+func TestSessionRepository_GetByUserService(t *testing.T) {
+	repo := NewSessionRepository(newTestRepository(t))
+	ctx := context.Background()
+
+	for i, spec := range []struct{ id, serviceID, tenantID string }{
+		{"sess-old", "web", ""},
+		{"sess-new", "web", ""},
+		{"sess-api", "api", ""},
+		{"sess-acme", "web", "acme"},
+	} {
+		sess := newTestSession(spec.id, time.Hour)
+		sess.UserID = "user-1"
+		sess.ServiceID = spec.serviceID
+		sess.TenantID = spec.tenantID
+		sess.CreatedAt = sess.CreatedAt.Add(time.Duration(i) * time.Second)
+		repo.Create(ctx, sess)
+	}
+	expired := newTestSession("sess-expired", -time.Minute)
+	expired.UserID = "user-1"
+	expired.ServiceID = "web"
+	expired.CreatedAt = expired.CreatedAt.Add(time.Minute)
+	repo.Create(ctx, expired)
+
+	got, err := repo.GetByUserService(ctx, tenant.Only(""), "user-1", "web")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.ID != "sess-new" || got.Data["theme"] != "dark" {
+		t.Errorf("expected the newest active session, got %+v", got)
+	}
+
+	if got, err := repo.GetByUserService(ctx, tenant.Only("acme"), "user-1", "web"); err != nil || got.ID != "sess-acme" {
+		t.Errorf("expected the tenant's session, got %v, %v", got, err)
+	}
+	if _, err := repo.GetByUserService(ctx, tenant.Unrestricted, "user-1", "mobile"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build integration
+
+package redis
+
+import (
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/conformance"
+)
+
+func TestSessionRepository_Conformance(t *testing.T) {
+	conformance.TestSessionRepository(t, func(t *testing.T) session.SessionRepository {
+		repo, _ := newTestRepository(t)
+		return repo
+	}, conformance.SessionOptions{ExpiresByTTL: true})
+}
+
+func TestRegistryRepository_Conformance(t *testing.T) {
+	conformance.TestRegistryRepository(t, func(t *testing.T) service.RegistryRepository {
+		repo, _ := newTestRepository(t)
+		return NewRegistryRepository(repo)
+	})
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// eventsChannel is the pub/sub channel every instance publishes its events to
+const eventsChannel = "events"
+
+// eventsReceiveTimeout bounds each wait for a message, so Subscribe notices
+// a done context and pings the server while the channel is quiet
+const eventsReceiveTimeout = time.Second
+
+// EventTransport carries events between root-server instances over Redis
+// pub/sub. It implements eventbus.Transport: every instance publishes to and
+// subscribes to one channel, and payloads carry the event type.
+type EventTransport struct {
+	client goredis.UniversalClient
+}
+
+// NewEventTransport creates an event transport sharing the Redis connection
+func NewEventTransport(repo *Repository) *EventTransport {
+	return &EventTransport{client: repo.client}
+}
+
+// Publish sends payload to every subscribed instance
+func (t *EventTransport) Publish(ctx context.Context, payload []byte) error {
+	if err := t.client.Publish(ctx, eventsChannel, payload).Err(); err != nil {
+		return fmt.Errorf("publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe receives the payloads published on the channel until ctx is done
+// or the connection fails. Reads on a subscription don't watch ctx, so it
+// waits eventsReceiveTimeout at a time, pinging the server in between to
+// find out about a connection that died quietly.
+func (t *EventTransport) Subscribe(ctx context.Context, subscribed func(), receive func(payload []byte)) error {
+	pubsub := t.client.Subscribe(ctx, eventsChannel)
+	defer pubsub.Close()
+
+	// The first reply confirms the subscription
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to events: %w", err)
+	}
+	subscribed()
+
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, eventsReceiveTimeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			if err := pubsub.Ping(ctx); err != nil {
+				return fmt.Errorf("ping event subscription: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("receive event: %w", err)
+		}
+
+		if msg, ok := msg.(*goredis.Message); ok {
+			receive([]byte(msg.Payload))
+		}
+	}
+}
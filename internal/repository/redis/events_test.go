@@ -0,0 +1,138 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/eventbus"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// instance is a root-server instance's bus over its own Redis connection
+type instance struct {
+	bus      *eventbus.Shared
+	received chan event.Event
+}
+
+func startInstance(t *testing.T, addr, origin string) *instance {
+	t.Helper()
+	repo, err := NewRepository(context.Background(), Config{Addr: addr})
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	in := &instance{
+		bus:      eventbus.NewShared(NewEventTransport(repo), eventbus.Config{Origin: origin, MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}, logger.NewNop()),
+		received: make(chan event.Event, 16),
+	}
+	in.bus.Subscribe(func(e event.Event) { in.received <- e })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		in.bus.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return in
+}
+
+// connected waits until every instance is subscribed
+func connected(t *testing.T, instances ...*instance) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, in := range instances {
+		for !in.bus.Connected() {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the instances to subscribe")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+// next returns the next event the instance received, failing the test when
+// none arrives
+func (in *instance) next(t *testing.T) event.Event {
+	t.Helper()
+	select {
+	case e := <-in.received:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+		return event.Event{}
+	}
+}
+
+// none fails the test if the instance receives an event shortly
+func (in *instance) none(t *testing.T) {
+	t.Helper()
+	select {
+	case e := <-in.received:
+		t.Fatalf("expected no further event, got %s %s", e.Type, e.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventTransport_CrossInstanceDelivery(t *testing.T) {
+	_, mr := newTestRepository(t)
+	a := startInstance(t, mr.Addr(), "instance-a")
+	b := startInstance(t, mr.Addr(), "instance-b")
+	connected(t, a, b)
+
+	registered := event.New(event.ServiceRegistered, "acme", map[string]string{"id": "payment-1"})
+	a.bus.Publish(context.Background(), registered)
+
+	if e := a.next(t); e.ID != registered.ID {
+		t.Errorf("expected the local subscriber to get %s, got %s", registered.ID, e.ID)
+	}
+	e := b.next(t)
+	if e.ID != registered.ID || e.Type != event.ServiceRegistered || e.TenantID != "acme" || !e.OccurredAt.Equal(registered.OccurredAt) {
+		t.Errorf("expected %+v on the other instance, got %+v", registered, e)
+	}
+	if data, ok := e.Data.(map[string]any); !ok || data["id"] != "payment-1" {
+		t.Errorf("expected the event data decoded, got %#v", e.Data)
+	}
+	// a's own event comes back on the channel and is not delivered twice
+	a.none(t)
+	b.none(t)
+}
+
+func TestEventTransport_Reconnect(t *testing.T) {
+	_, mr := newTestRepository(t)
+	a := startInstance(t, mr.Addr(), "instance-a")
+	b := startInstance(t, mr.Addr(), "instance-b")
+	connected(t, a, b)
+
+	mr.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for a.bus.Connected() || b.bus.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the instances to notice the lost connection")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	a.bus.Publish(context.Background(), event.Event{ID: "evt-local", Type: event.ServiceDeregistered})
+	if e := a.next(t); e.ID != "evt-local" {
+		t.Errorf("expected local delivery while disconnected, got %s", e.ID)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	connected(t, a, b)
+	a.bus.Publish(context.Background(), event.Event{ID: "evt-shared", Type: event.ServiceRegistered})
+	a.next(t)
+	if e := b.next(t); e.ID != "evt-shared" {
+		t.Errorf("expected delivery to resume after reconnecting, got %s", e.ID)
+	}
+	b.none(t)
+}
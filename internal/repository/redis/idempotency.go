@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/idempotency"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const idempotencyKeyPrefix = "idempotency:"
+
+func idempotencyKey(key string) string {
+	return idempotencyKeyPrefix + key
+}
+
+// beginIdempotentScript stores ARGV[1] in KEYS[1] for ARGV[2] ms unless the
+// key exists, and returns the value already stored, or nil when it claimed
+// the key
+var beginIdempotentScript = goredis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return false
+end
+return redis.call("GET", KEYS[1])
+`)
+
+// IdempotencyStore implements a Redis-based idempotency store. Each record is
+// a JSON value under idempotency:<key> that Redis expires, so records expire
+// by the server's clock rather than the now callers pass.
+type IdempotencyStore struct {
+	client goredis.UniversalClient
+}
+
+// NewIdempotencyStore creates an idempotency store sharing the Redis connection
+func NewIdempotencyStore(repo *Repository) *IdempotencyStore {
+	return &IdempotencyStore{client: repo.client}
+}
+
+// Begin claims key unless a record holds it
+func (s *IdempotencyStore) Begin(ctx context.Context, key, requestHash string, ttl time.Duration, now time.Time) (*idempotency.Response, error) {
+	pending, err := json.Marshal(idempotency.Response{RequestHash: requestHash})
+	if err != nil {
+		return nil, fmt.Errorf("begin idempotent request: %w", err)
+	}
+
+	data, err := beginIdempotentScript.Run(ctx, s.client, []string{idempotencyKey(key)}, pending, ttl.Milliseconds()).Text()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("begin idempotent request: %w", err)
+	}
+
+	var existing idempotency.Response
+	if err := json.Unmarshal([]byte(data), &existing); err != nil {
+		return nil, fmt.Errorf("begin idempotent request: decode record: %w", err)
+	}
+	return &existing, nil
+}
+
+// Complete stores the response under key
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, resp idempotency.Response, ttl time.Duration, now time.Time) error {
+	resp.Done = true
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("complete idempotent request: %w", err)
+	}
+	if err := s.client.Set(ctx, idempotencyKey(key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("complete idempotent request: %w", err)
+	}
+	return nil
+}
+
+// Release drops key
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, idempotencyKey(key)).Err(); err != nil {
+		return fmt.Errorf("release idempotent request: %w", err)
+	}
+	return nil
+}
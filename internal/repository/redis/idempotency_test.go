@@ -0,0 +1,55 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/idempotency"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	store := NewIdempotencyStore(repo)
+	ctx := context.Background()
+	now := time.Now()
+	ttl := time.Hour
+
+	if existing, err := store.Begin(ctx, "key-1", "hash-a", ttl, now); err != nil || existing != nil {
+		t.Fatalf("expected the key to be claimed, got %+v, %v", existing, err)
+	}
+	existing, err := store.Begin(ctx, "key-1", "hash-b", ttl, now)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if existing == nil || existing.Done || existing.RequestHash != "hash-a" {
+		t.Fatalf("expected the pending claim, got %+v", existing)
+	}
+
+	resp := idempotency.Response{RequestHash: "hash-a", Status: 201, ContentType: "application/json", Body: []byte(`{"id":"1"}`)}
+	if err := store.Complete(ctx, "key-1", resp, ttl, now); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	existing, _ = store.Begin(ctx, "key-1", "hash-a", ttl, now)
+	if existing == nil || !existing.Done || existing.Status != 201 || existing.ContentType != "application/json" || string(existing.Body) != `{"id":"1"}` {
+		t.Fatalf("expected the completed response, got %+v", existing)
+	}
+	if got := mr.TTL(idempotencyKey("key-1")); got != ttl {
+		t.Errorf("expected the record to expire in %v, got %v", ttl, got)
+	}
+
+	mr.FastForward(ttl)
+	if existing, _ := store.Begin(ctx, "key-1", "hash-b", ttl, now); existing != nil {
+		t.Errorf("expected the expired key to be claimed again, got %+v", existing)
+	}
+
+	store.Begin(ctx, "key-2", "hash-a", ttl, now)
+	if err := store.Release(ctx, "key-2"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if existing, _ := store.Begin(ctx, "key-2", "hash-a", ttl, now); existing != nil {
+		t.Errorf("expected a released key to be claimed again, got %+v", existing)
+	}
+}
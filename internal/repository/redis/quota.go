@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/quota"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const quotaKeyPrefix = "quota:"
+
+func quotaKey(subject string) string {
+	return quotaKeyPrefix + subject
+}
+
+// acquireQuotaScript drops uses a window old from the sorted set in KEYS[1]
+// and records a use scored ARGV[1] (now, ms) as member ARGV[4] unless ARGV[3]
+// uses remain within the ARGV[2] ms window. It returns whether the use was
+// recorded, the count and the oldest score.
+var acquireQuotaScript = goredis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local acquired = 0
+if count < tonumber(ARGV[3]) then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	count = count + 1
+	acquired = 1
+end
+if count > 0 then
+	redis.call("PEXPIRE", KEYS[1], window)
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {acquired, count, oldest[2] or "0"}
+`)
+
+// QuotaStore implements Redis-based sliding window quotas. Each subject's
+// uses are a sorted set under quota:<subject> scored by time in
+// milliseconds; the key expires a window after the last use.
+type QuotaStore struct {
+	client goredis.UniversalClient
+}
+
+// NewQuotaStore creates a quota store sharing the Redis connection
+func NewQuotaStore(repo *Repository) *QuotaStore {
+	return &QuotaStore{client: repo.client}
+}
+
+// Acquire records a use unless the subject's limit is reached
+func (s *QuotaStore) Acquire(ctx context.Context, subject string, limit int, window time.Duration, now time.Time) (quota.Usage, bool, error) {
+	result, err := acquireQuotaScript.Run(ctx, s.client, []string{quotaKey(subject)},
+		now.UnixMilli(), window.Milliseconds(), limit, useMember(now)).Slice()
+	if err != nil {
+		return quota.Usage{}, false, fmt.Errorf("acquire quota: %w", err)
+	}
+	if len(result) != 3 {
+		return quota.Usage{}, false, fmt.Errorf("acquire quota: unexpected reply %v", result)
+	}
+
+	acquired, _ := result[0].(int64)
+	count, _ := result[1].(int64)
+	oldest, _ := result[2].(string)
+	usage, err := quotaUsage(int(count), oldest)
+	if err != nil {
+		return quota.Usage{}, false, fmt.Errorf("acquire quota: %w", err)
+	}
+	return usage, acquired == 1, nil
+}
+
+// Usage returns the subject's uses within the window
+func (s *QuotaStore) Usage(ctx context.Context, subject string, window time.Duration, now time.Time) (quota.Usage, error) {
+	key := quotaKey(subject)
+	start := "(" + strconv.FormatInt(now.Add(-window).UnixMilli(), 10)
+
+	pipe := s.client.Pipeline()
+	count := pipe.ZCount(ctx, key, start, "+inf")
+	oldest := pipe.ZRangeByScoreWithScores(ctx, key, &goredis.ZRangeBy{Min: start, Max: "+inf", Count: 1})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return quota.Usage{}, fmt.Errorf("get quota usage: %w", err)
+	}
+
+	usage := quota.Usage{Count: int(count.Val())}
+	if scores := oldest.Val(); len(scores) > 0 {
+		usage.Oldest = time.UnixMilli(int64(scores[0].Score))
+	}
+	return usage, nil
+}
+
+// quotaUsage builds a usage from the count and oldest score the acquire script returns
+func quotaUsage(count int, oldest string) (quota.Usage, error) {
+	if count == 0 {
+		return quota.Usage{}, nil
+	}
+	ms, err := strconv.ParseFloat(oldest, 64)
+	if err != nil {
+		return quota.Usage{}, fmt.Errorf("parse oldest use %q: %w", oldest, err)
+	}
+	return quota.Usage{Count: count, Oldest: time.UnixMilli(int64(ms))}, nil
+}
+
+// useMember returns a unique sorted set member for a use at now, so uses in
+// the same millisecond are counted separately
+func useMember(now time.Time) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return strconv.FormatInt(now.UnixMilli(), 10) + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,91 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQuotaStore_SlidingWindow(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	store := NewQuotaStore(repo)
+	ctx := context.Background()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	window := time.Hour
+
+	acquire := func(at time.Duration) bool {
+		t.Helper()
+		_, ok, err := store.Acquire(ctx, "svc-a", 2, window, start.Add(at))
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		return ok
+	}
+
+	if !acquire(0) || !acquire(10*time.Minute) {
+		t.Fatal("expected the first two uses to be acquired")
+	}
+	if acquire(59 * time.Minute) {
+		t.Error("expected a third use within the window to be refused")
+	}
+
+	usage, err := store.Usage(ctx, "svc-a", window, start.Add(59*time.Minute))
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if usage.Count != 2 || !usage.Oldest.Equal(start) {
+		t.Errorf("expected 2 uses since %v, got %+v", start, usage)
+	}
+
+	if !acquire(time.Hour) {
+		t.Error("expected a slot once the oldest use left the window")
+	}
+	if acquire(time.Hour + time.Minute) {
+		t.Error("expected the second use to still hold its slot")
+	}
+	if ttl := mr.TTL(quotaKey("svc-a")); ttl != window {
+		t.Errorf("expected the key to expire a window after the last use, got %v", ttl)
+	}
+
+	usage, _ = store.Usage(ctx, "svc-a", window, start.Add(3*time.Hour))
+	if usage.Count != 0 {
+		t.Errorf("expected no uses once the window passed, got %+v", usage)
+	}
+}
+
+func TestQuotaStore_ConcurrentAcquire(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	store := NewQuotaStore(repo)
+	ctx := context.Background()
+	now := time.Now()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		acquired int
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := store.Acquire(ctx, "svc-a", 5, time.Hour, now)
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 5 {
+		t.Errorf("expected exactly 5 uses acquired, got %d", acquired)
+	}
+}
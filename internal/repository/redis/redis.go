@@ -2,60 +2,141 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
-	"github.com/aq189/bin/internal/domain/session"
+	goredis "github.com/redis/go-redis/v9"
 )
 
+// Connection modes
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
+// ErrInvalidConfig is returned by NewRepository when the connection settings
+// don't fit the mode
+var ErrInvalidConfig = errors.New("invalid redis config")
+
 // Repository implements Redis-based storage
 type Repository struct {
-	// TODO: Add redis client
+	client goredis.UniversalClient
 }
 
 // Config holds Redis configuration
 type Config struct {
-	Addr     string
-	Password string
-	DB       int
+	Mode       string   // single (default), sentinel or cluster
+	Addr       string   // server address in single mode
+	Addrs      []string // sentinel addresses in sentinel mode, seed nodes in cluster mode
+	MasterName string   // master monitored by the sentinels
+	Password   string
+	DB         int // ignored in cluster mode
+
+	// Pool tuning; zero values keep the go-redis defaults
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
 }
 
-// NewRepository creates a new Redis repository
-func NewRepository(ctx context.Context, cfg Config) (*Repository, error) {
-	// TODO: Initialize Redis client
-	return &Repository{}, nil
+// clientFactory builds the go-redis client of each connection mode, so tests
+// can check what NewRepository asks for without connecting
+type clientFactory struct {
+	single   func(*goredis.Options) goredis.UniversalClient
+	sentinel func(*goredis.FailoverOptions) goredis.UniversalClient
+	cluster  func(*goredis.ClusterOptions) goredis.UniversalClient
 }
 
-// Create stores a new session in Redis
-func (r *Repository) Create(ctx context.Context, sess *session.Session) error {
-	// TODO: Implement Redis storage
-	return nil
+var defaultFactory = clientFactory{
+	single:   func(opts *goredis.Options) goredis.UniversalClient { return goredis.NewClient(opts) },
+	sentinel: func(opts *goredis.FailoverOptions) goredis.UniversalClient { return goredis.NewFailoverClient(opts) },
+	cluster:  func(opts *goredis.ClusterOptions) goredis.UniversalClient { return goredis.NewClusterClient(opts) },
 }
 
-// Get retrieves a session from Redis
-func (r *Repository) Get(ctx context.Context, id string) (*session.Session, error) {
-	// TODO: Implement Redis retrieval
-	return nil, nil
+// NewRepository creates a new Redis repository connected in cfg.Mode and
+// checks the connection with a ping
+func NewRepository(ctx context.Context, cfg Config) (*Repository, error) {
+	return newRepository(ctx, cfg, defaultFactory)
+}
+
+func newRepository(ctx context.Context, cfg Config, factory clientFactory) (*Repository, error) {
+	client, err := factory.newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ping redis (%s): %w", describe(cfg), err)
+	}
+
+	return &Repository{client: client}, nil
 }
 
-// Update updates a session in Redis
-func (r *Repository) Update(ctx context.Context, sess *session.Session) error {
-	// TODO: Implement Redis update
-	return nil
+// newClient builds the client for cfg.Mode
+func (f clientFactory) newClient(cfg Config) (goredis.UniversalClient, error) {
+	switch cfg.Mode {
+	case "", ModeSingle:
+		if cfg.Addr == "" {
+			return nil, fmt.Errorf("%w: single mode requires addr", ErrInvalidConfig)
+		}
+		return f.single(&goredis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+		}), nil
+	case ModeSentinel:
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("%w: sentinel mode requires master_name and addrs", ErrInvalidConfig)
+		}
+		return f.sentinel(&goredis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.Addrs,
+			Password:      cfg.Password,
+			DB:            cfg.DB,
+			PoolSize:      cfg.PoolSize,
+			MinIdleConns:  cfg.MinIdleConns,
+			DialTimeout:   cfg.DialTimeout,
+		}), nil
+	case ModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("%w: cluster mode requires addrs", ErrInvalidConfig)
+		}
+		return f.cluster(&goredis.ClusterOptions{
+			Addrs:        cfg.Addrs,
+			Password:     cfg.Password,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidConfig, cfg.Mode)
+	}
 }
 
-// Delete removes a session from Redis
-func (r *Repository) Delete(ctx context.Context, id string) error {
-	// TODO: Implement Redis deletion
-	return nil
+// describe names the mode and addresses of cfg for error messages
+func describe(cfg Config) string {
+	switch cfg.Mode {
+	case ModeSentinel:
+		return fmt.Sprintf("sentinel master %s via %s", cfg.MasterName, strings.Join(cfg.Addrs, ", "))
+	case ModeCluster:
+		return "cluster at " + strings.Join(cfg.Addrs, ", ")
+	default:
+		return "single at " + cfg.Addr
+	}
 }
 
-// DeleteExpired removes expired sessions from Redis
-func (r *Repository) DeleteExpired(ctx context.Context) (int, error) {
-	// TODO: Implement cleanup
-	return 0, nil
+// Ping checks that Redis is reachable, for readiness probes
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
 }
 
 // Close closes the Redis connection
 func (r *Repository) Close() error {
-	// TODO: Close Redis client
-	return nil
+	return r.client.Close()
 }
@@ -0,0 +1,58 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepository_Ping(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("expected ping to succeed, got %v", err)
+	}
+
+	mr.Close()
+	if err := repo.Ping(ctx); err == nil {
+		t.Error("expected ping to fail once redis is gone")
+	}
+}
+
+func TestNewRepository_ReportsWhatWasAttempted(t *testing.T) {
+	_, mr := newTestRepository(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{name: "single", cfg: Config{Addr: addr}, want: []string{"single", addr}},
+		{name: "sentinel", cfg: Config{Mode: ModeSentinel, MasterName: "mymaster", Addrs: []string{addr}}, want: []string{"sentinel", "mymaster", addr}},
+		{name: "cluster", cfg: Config{Mode: ModeCluster, Addrs: []string{addr}}, want: []string{"cluster", addr}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.DialTimeout = 100 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := NewRepository(ctx, tt.cfg)
+			if err == nil {
+				t.Fatal("expected connecting to a closed port to fail")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected the error to mention %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// recordingFactory builds real, unconnected clients and records the options
+// each mode was asked for
+type recordingFactory struct {
+	single   *goredis.Options
+	sentinel *goredis.FailoverOptions
+	cluster  *goredis.ClusterOptions
+}
+
+func (f *recordingFactory) factory() clientFactory {
+	return clientFactory{
+		single: func(opts *goredis.Options) goredis.UniversalClient {
+			f.single = opts
+			return defaultFactory.single(opts)
+		},
+		sentinel: func(opts *goredis.FailoverOptions) goredis.UniversalClient {
+			f.sentinel = opts
+			return defaultFactory.sentinel(opts)
+		},
+		cluster: func(opts *goredis.ClusterOptions) goredis.UniversalClient {
+			f.cluster = opts
+			return defaultFactory.cluster(opts)
+		},
+	}
+}
+
+func TestClientFactory_Modes(t *testing.T) {
+	pool := Config{Password: "secret", PoolSize: 20, MinIdleConns: 5, DialTimeout: 3 * time.Second}
+
+	t.Run("single", func(t *testing.T) {
+		cfg := pool
+		cfg.Addr, cfg.DB = "redis:6379", 2
+
+		var rec recordingFactory
+		client, err := rec.factory().newClient(cfg)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer client.Close()
+
+		if _, ok := client.(*goredis.Client); !ok {
+			t.Errorf("expected a *redis.Client, got %T", client)
+		}
+		opts := rec.single
+		if opts == nil || opts.Addr != "redis:6379" || opts.DB != 2 || opts.Password != "secret" {
+			t.Fatalf("unexpected options %+v", opts)
+		}
+		if opts.PoolSize != 20 || opts.MinIdleConns != 5 || opts.DialTimeout != 3*time.Second {
+			t.Errorf("expected the pool settings to be passed on, got %+v", opts)
+		}
+	})
+
+	t.Run("sentinel", func(t *testing.T) {
+		cfg := pool
+		cfg.Mode, cfg.MasterName, cfg.Addrs, cfg.DB = ModeSentinel, "mymaster", []string{"s1:26379", "s2:26379"}, 1
+
+		var rec recordingFactory
+		client, err := rec.factory().newClient(cfg)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer client.Close()
+
+		if _, ok := client.(*goredis.Client); !ok {
+			t.Errorf("expected a failover *redis.Client, got %T", client)
+		}
+		opts := rec.sentinel
+		if opts == nil || opts.MasterName != "mymaster" || !slices.Equal(opts.SentinelAddrs, cfg.Addrs) || opts.DB != 1 {
+			t.Fatalf("unexpected options %+v", opts)
+		}
+		if opts.PoolSize != 20 || opts.MinIdleConns != 5 || opts.DialTimeout != 3*time.Second {
+			t.Errorf("expected the pool settings to be passed on, got %+v", opts)
+		}
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		cfg := pool
+		cfg.Mode, cfg.Addrs = ModeCluster, []string{"n1:6379", "n2:6379", "n3:6379"}
+
+		var rec recordingFactory
+		client, err := rec.factory().newClient(cfg)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer client.Close()
+
+		if _, ok := client.(*goredis.ClusterClient); !ok {
+			t.Errorf("expected a *redis.ClusterClient, got %T", client)
+		}
+		opts := rec.cluster
+		if opts == nil || !slices.Equal(opts.Addrs, cfg.Addrs) || opts.Password != "secret" {
+			t.Fatalf("unexpected options %+v", opts)
+		}
+		if opts.PoolSize != 20 || opts.MinIdleConns != 5 || opts.DialTimeout != 3*time.Second {
+			t.Errorf("expected the pool settings to be passed on, got %+v", opts)
+		}
+	})
+}
+
+func TestClientFactory_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "single without addr", cfg: Config{}},
+		{name: "sentinel without master", cfg: Config{Mode: ModeSentinel, Addrs: []string{"s1:26379"}}},
+		{name: "sentinel without addrs", cfg: Config{Mode: ModeSentinel, MasterName: "mymaster"}},
+		{name: "cluster without addrs", cfg: Config{Mode: ModeCluster, Addr: "n1:6379"}},
+		{name: "unknown mode", cfg: Config{Mode: "replica", Addr: "redis:6379"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec recordingFactory
+			if _, err := rec.factory().newClient(tt.cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected ErrInvalidConfig, got %v", err)
+			}
+			if rec.single != nil || rec.sentinel != nil || rec.cluster != nil {
+				t.Error("expected no client to be built")
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	serviceKeyPrefix    = "service:"
+	serviceIndexKey     = "services"
+	deletedIndexKey     = "services:deleted"
+	capabilityKeyPrefix = "capability:"
+	revisionKey         = "registry:revision"
+
+	fieldData          = "data"
+	fieldStatus        = "status"
+	fieldLastHeartbeat = "last_heartbeat"
+	fieldDeletedAt     = "deleted_at"
+
+	// maxTxRetries bounds optimistic-lock retries when a watched key changes mid-transaction
+	maxTxRetries = 5
+)
+
+// updateHeartbeatScript sets the heartbeat fields only when the service exists
+// and is not soft-deleted, leaving an operator-set draining status in place.
+// It returns 0 for unknown services, -1 for soft-deleted ones, 2 when the
+// status changed and 1 otherwise.
+var updateHeartbeatScript = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+if redis.call("HEXISTS", KEYS[1], "deleted_at") == 1 then
+	return -1
+end
+redis.call("HSET", KEYS[1], "last_heartbeat", ARGV[1])
+local status = redis.call("HGET", KEYS[1], "status")
+if status ~= ARGV[3] and status ~= ARGV[2] then
+	redis.call("HSET", KEYS[1], "status", ARGV[2])
+	return 2
+end
+return 1
+`)
+
+func serviceKey(id string) string {
+	return serviceKeyPrefix + id
+}
+
+func capabilityKey(capability string) string {
+	return capabilityKeyPrefix + capability
+}
+
+// RegistryRepository implements Redis-based service registry storage.
+// Each service is a hash under service:<id> holding the JSON document plus
+// separately writable status and heartbeat fields. The services set indexes
+// the IDs of live services, services:deleted those of soft-deleted ones and
+// capability:<name> sets index live services by capability.
+type RegistryRepository struct {
+	client goredis.UniversalClient
+}
+
+// NewRegistryRepository creates a registry repository sharing the Redis connection
+func NewRegistryRepository(repo *Repository) *RegistryRepository {
+	return &RegistryRepository{client: repo.client}
+}
+
+// Register stores a service, replacing any existing registration with the same ID
+func (r *RegistryRepository) Register(ctx context.Context, svc *service.Service) error {
+	if err := r.write(ctx, svc, false); err != nil {
+		return fmt.Errorf("register service: %w", err)
+	}
+	return nil
+}
+
+// Update updates an existing service
+func (r *RegistryRepository) Update(ctx context.Context, svc *service.Service) error {
+	if err := r.write(ctx, svc, true); err != nil {
+		if errors.Is(err, service.ErrServiceNotFound) {
+			return err
+		}
+		return fmt.Errorf("update service: %w", err)
+	}
+	return nil
+}
+
+// CreateIfAbsent stores a service unless its ID is taken, returning the existing one if so
+func (r *RegistryRepository) CreateIfAbsent(ctx context.Context, svc *service.Service) (*service.Service, error) {
+	data, err := json.Marshal(svc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal service: %w", err)
+	}
+
+	var existing *service.Service
+	key := serviceKey(svc.ID)
+	err = r.transact(ctx, func(tx *goredis.Tx) error {
+		previous, err := r.load(ctx, tx, svc.ID)
+		if err == nil {
+			existing = previous
+			return nil
+		}
+		if !errors.Is(err, service.ErrServiceNotFound) {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			r.queueWrite(ctx, pipe, svc, data, nil)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("create service: %w", err)
+	}
+
+	return existing, nil
+}
+
+// write stores the service hash and reconciles capability index membership
+// against the previously stored capabilities in a single transaction
+func (r *RegistryRepository) write(ctx context.Context, svc *service.Service, mustExist bool) error {
+	data, err := json.Marshal(svc)
+	if err != nil {
+		return fmt.Errorf("marshal service: %w", err)
+	}
+
+	return r.transact(ctx, func(tx *goredis.Tx) error {
+		previous, err := r.load(ctx, tx, svc.ID)
+		if err != nil && !errors.Is(err, service.ErrServiceNotFound) {
+			return err
+		}
+		if previous == nil && mustExist {
+			return service.ErrServiceNotFound
+		}
+
+		var removed []string
+		if previous != nil {
+			removed = difference(previous.Capabilities, svc.Capabilities)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			r.queueWrite(ctx, pipe, svc, data, removed)
+			return nil
+		})
+		return err
+	}, serviceKey(svc.ID))
+}
+
+// queueWrite queues the hash write and index updates for a service,
+// dropping it from the indexes of capabilities it no longer advertises. A
+// soft-deleted service moves to the deleted index and out of the capability
+// indexes altogether.
+func (r *RegistryRepository) queueWrite(ctx context.Context, pipe goredis.Pipeliner, svc *service.Service, data []byte, removed []string) {
+	key := serviceKey(svc.ID)
+	pipe.HSet(ctx, key,
+		fieldData, data,
+		fieldStatus, string(svc.Status),
+		fieldLastHeartbeat, svc.LastHeartbeat.Format(time.RFC3339Nano),
+	)
+
+	if svc.IsDeleted() {
+		pipe.HSet(ctx, key, fieldDeletedAt, svc.DeletedAt.Format(time.RFC3339Nano))
+		pipe.SRem(ctx, serviceIndexKey, svc.ID)
+		pipe.SAdd(ctx, deletedIndexKey, svc.ID)
+		for _, capability := range slices.Concat(removed, svc.Capabilities) {
+			pipe.SRem(ctx, capabilityKey(capability), svc.ID)
+		}
+		return
+	}
+
+	pipe.HDel(ctx, key, fieldDeletedAt)
+	pipe.SRem(ctx, deletedIndexKey, svc.ID)
+	pipe.SAdd(ctx, serviceIndexKey, svc.ID)
+	for _, capability := range removed {
+		pipe.SRem(ctx, capabilityKey(capability), svc.ID)
+	}
+	for _, capability := range svc.Capabilities {
+		pipe.SAdd(ctx, capabilityKey(capability), svc.ID)
+	}
+}
+
+// Deregister removes a service and its index entries
+func (r *RegistryRepository) Deregister(ctx context.Context, id string) error {
+	if err := r.remove(ctx, id, nil); err != nil {
+		return fmt.Errorf("deregister service: %w", err)
+	}
+	return nil
+}
+
+// remove deletes a service and its index entries when keep, if given,
+// reports false for the stored service
+func (r *RegistryRepository) remove(ctx context.Context, id string, keep func(*service.Service) bool) error {
+	key := serviceKey(id)
+	return r.transact(ctx, func(tx *goredis.Tx) error {
+		previous, err := r.load(ctx, tx, id)
+		if err != nil && !errors.Is(err, service.ErrServiceNotFound) {
+			return err
+		}
+		if previous != nil && keep != nil && keep(previous) {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.SRem(ctx, serviceIndexKey, id)
+			pipe.SRem(ctx, deletedIndexKey, id)
+			if previous != nil {
+				for _, capability := range previous.Capabilities {
+					pipe.SRem(ctx, capabilityKey(capability), id)
+				}
+			}
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// Purge removes the services soft-deleted before the given time. Each one is
+// checked again under WATCH, so a service restored meanwhile is kept.
+func (r *RegistryRepository) Purge(ctx context.Context, before time.Time) (int, error) {
+	ids, err := r.client.SMembers(ctx, deletedIndexKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("list deleted service ids: %w", err)
+	}
+	deleted, err := r.loadMany(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := func(svc *service.Service) bool {
+		return svc.IsDeleted() && svc.DeletedAt.Before(before)
+	}
+	var purged int
+	for _, svc := range deleted {
+		if !expired(svc) {
+			continue
+		}
+		keep := func(stored *service.Service) bool { return !expired(stored) }
+		if err := r.remove(ctx, svc.ID, keep); err != nil {
+			return purged, fmt.Errorf("purge service %s: %w", svc.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Get retrieves a service by ID
+func (r *RegistryRepository) Get(ctx context.Context, id string) (*service.Service, error) {
+	return r.load(ctx, r.client, id)
+}
+
+// List returns all registered services that are not soft-deleted
+func (r *RegistryRepository) List(ctx context.Context) ([]*service.Service, error) {
+	ids, err := r.client.SMembers(ctx, serviceIndexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("list service ids: %w", err)
+	}
+	return r.loadMany(ctx, ids)
+}
+
+// ListPaged returns one page of the services matching filter. Ordering by ID
+// without a tenant restriction or a field filter pages the index and only
+// loads the selected services; otherwise every service is loaded first.
+func (r *RegistryRepository) ListPaged(ctx context.Context, filter service.ListFilter, opts pagination.ListOptions) ([]*service.Service, int, error) {
+	ids, err := r.client.SMembers(ctx, serviceIndexKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("list service ids: %w", err)
+	}
+	if filter.IncludeDeleted {
+		// Separate reads rather than SUNION, which cluster mode rejects
+		// for keys in different slots
+		deleted, err := r.client.SMembers(ctx, deletedIndexKey).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf("list deleted service ids: %w", err)
+		}
+		ids = append(ids, deleted...)
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+	}
+
+	if filter.Scope.All && !filter.SelectsByField() && (opts.SortBy == "" || opts.SortBy == service.SortByID) {
+		slices.Sort(ids)
+		if opts.Descending {
+			slices.Reverse(ids)
+		}
+		start, end := opts.Window(len(ids))
+		services, err := r.loadMany(ctx, ids[start:end])
+		if err != nil {
+			return nil, 0, err
+		}
+		return services, len(ids), nil
+	}
+
+	services, err := r.loadMany(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	services = slices.DeleteFunc(services, func(svc *service.Service) bool {
+		return !filter.Matches(svc)
+	})
+	slices.SortFunc(services, service.CompareBy(opts.SortBy))
+	if opts.Descending {
+		slices.Reverse(services)
+	}
+	start, end := opts.Window(len(services))
+	return services[start:end], len(services), nil
+}
+
+// FindByCapability returns the services advertising the given capability
+func (r *RegistryRepository) FindByCapability(ctx context.Context, capability string) ([]*service.Service, error) {
+	ids, err := r.client.SMembers(ctx, capabilityKey(capability)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("find services by capability: %w", err)
+	}
+	return r.loadMany(ctx, ids)
+}
+
+// UpdateHeartbeat records a heartbeat without rewriting the service document.
+// The revision moves forward when the status changes.
+func (r *RegistryRepository) UpdateHeartbeat(ctx context.Context, id string, at time.Time) error {
+	updated, err := updateHeartbeatScript.Run(ctx, r.client,
+		[]string{serviceKey(id)},
+		at.Format(time.RFC3339Nano), string(service.StatusHealthy), string(service.StatusDraining),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("update heartbeat: %w", err)
+	}
+	switch updated {
+	case 0:
+		return service.ErrServiceNotFound
+	case -1:
+		return service.ErrServiceDeleted
+	case 2:
+		if _, err := r.BumpRevision(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRevision returns the registry revision, zero until the first change
+func (r *RegistryRepository) GetRevision(ctx context.Context) (int64, error) {
+	revision, err := r.client.Get(ctx, revisionKey).Int64()
+	if errors.Is(err, goredis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get registry revision: %w", err)
+	}
+	return revision, nil
+}
+
+// BumpRevision moves the registry revision forward and returns it
+func (r *RegistryRepository) BumpRevision(ctx context.Context) (int64, error) {
+	revision, err := r.client.Incr(ctx, revisionKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("bump registry revision: %w", err)
+	}
+	return revision, nil
+}
+
+// transact runs fn under WATCH on the given keys, retrying when they change concurrently
+func (r *RegistryRepository) transact(ctx context.Context, fn func(tx *goredis.Tx) error, keys ...string) error {
+	for range maxTxRetries {
+		err := r.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, goredis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: transaction aborted after %d retries", repository.ErrConflict, maxTxRetries)
+}
+
+// load reads and decodes a single service hash
+func (r *RegistryRepository) load(ctx context.Context, cmd goredis.Cmdable, id string) (*service.Service, error) {
+	fields, err := cmd.HGetAll(ctx, serviceKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get service: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, service.ErrServiceNotFound
+	}
+	return decodeService(fields)
+}
+
+// loadMany reads several service hashes in one round trip, skipping stale index entries
+func (r *RegistryRepository) loadMany(ctx context.Context, ids []string) ([]*service.Service, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*goredis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, serviceKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, fmt.Errorf("load services: %w", err)
+	}
+
+	services := make([]*service.Service, 0, len(ids))
+	for _, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		svc, err := decodeService(fields)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+
+	return services, nil
+}
+
+// decodeService rebuilds a service from its hash, applying the separately stored
+// status and heartbeat fields over the JSON document
+func decodeService(fields map[string]string) (*service.Service, error) {
+	var svc service.Service
+	if err := json.Unmarshal([]byte(fields[fieldData]), &svc); err != nil {
+		return nil, fmt.Errorf("unmarshal service: %w", err)
+	}
+
+	if status, ok := fields[fieldStatus]; ok {
+		svc.Status = service.Status(status)
+	}
+	if heartbeat, ok := fields[fieldLastHeartbeat]; ok {
+		at, err := time.Parse(time.RFC3339Nano, heartbeat)
+		if err != nil {
+			return nil, fmt.Errorf("parse heartbeat: %w", err)
+		}
+		svc.LastHeartbeat = at
+	}
+
+	return &svc, nil
+}
+
+// difference returns the elements of a that are not in b
+func difference(a, b []string) []string {
+	keep := make(map[string]struct{}, len(b))
+	for _, v := range b {
+		keep[v] = struct{}{}
+	}
+
+	var out []string
+	for _, v := range a {
+		if _, ok := keep[v]; !ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,441 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+)
+
+func newTestRepository(t *testing.T) (*Repository, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	repo, err := NewRepository(context.Background(), Config{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return repo, mr
+}
+
+func newTestService(id string, capabilities ...string) *service.Service {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return &service.Service{
+		ID:            id,
+		Name:          "svc-" + id,
+		Version:       "1.0.0",
+		Endpoints:     []service.Endpoint{{URL: "http://" + id + ":8080"}},
+		Capabilities:  capabilities,
+		Metadata:      map[string]string{"region": "us-east-1"},
+		Status:        service.StatusHealthy,
+		RegisteredAt:  now,
+		LastHeartbeat: now,
+	}
+}
+
+func serviceIDs(services []*service.Service) []string {
+	ids := make([]string, 0, len(services))
+	for _, svc := range services {
+		ids = append(ids, svc.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRegistryRepository_RegisterAndGet(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	svc := newTestService("svc-1", "payment", "refund")
+	svc.DependsOn = []string{"inventory"}
+	if err := registry.Register(ctx, svc); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got, err := registry.Get(ctx, svc.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.Name != svc.Name || !slices.Equal(got.Capabilities, svc.Capabilities) || !slices.Equal(got.DependsOn, svc.DependsOn) {
+		t.Errorf("expected %+v, got %+v", svc, got)
+	}
+	if !got.LastHeartbeat.Equal(svc.LastHeartbeat) {
+		t.Errorf("expected heartbeat %v, got %v", svc.LastHeartbeat, got.LastHeartbeat)
+	}
+
+	t.Run("register is idempotent", func(t *testing.T) {
+		if err := registry.Register(ctx, svc); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		all, _ := registry.List(ctx)
+		if len(all) != 1 {
+			t.Errorf("expected 1 service, got %d", len(all))
+		}
+		found, _ := registry.FindByCapability(ctx, "payment")
+		if len(found) != 1 {
+			t.Errorf("expected 1 payment provider, got %d", len(found))
+		}
+	})
+
+	t.Run("returns error for non-existent service", func(t *testing.T) {
+		if _, err := registry.Get(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestRegistryRepository_CreateIfAbsent(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	svc := newTestService("svc-1", "payment")
+	existing, err := registry.CreateIfAbsent(ctx, svc)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if existing != nil {
+		t.Fatalf("expected no existing service, got %+v", existing)
+	}
+
+	other := newTestService("svc-1", "search")
+	other.Name = "other"
+	existing, err = registry.CreateIfAbsent(ctx, other)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if existing == nil || existing.Name != svc.Name {
+		t.Fatalf("expected existing service %q, got %+v", svc.Name, existing)
+	}
+
+	found, _ := registry.FindByCapability(ctx, "search")
+	if len(found) != 0 {
+		t.Errorf("expected rejected registration not to be indexed, got %v", serviceIDs(found))
+	}
+}
+
+func TestRegistryRepository_List(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := registry.Register(ctx, newTestService(id, "cap")); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+	}
+
+	services, err := registry.List(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ids := serviceIDs(services); !slices.Equal(ids, []string{"a", "b", "c"}) {
+		t.Errorf("expected [a b c], got %v", ids)
+	}
+}
+
+func TestRegistryRepository_UpdateCapabilities(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	svc := newTestService("svc-1", "payment", "refund")
+	registry.Register(ctx, svc)
+
+	svc.Capabilities = []string{"refund", "subscription"}
+	if err := registry.Update(ctx, svc); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		capability string
+		want       []string
+	}{
+		{capability: "payment", want: []string{}},
+		{capability: "refund", want: []string{"svc-1"}},
+		{capability: "subscription", want: []string{"svc-1"}},
+	}
+	for _, tt := range tests {
+		found, err := registry.FindByCapability(ctx, tt.capability)
+		if err != nil {
+			t.Fatalf("find %s: %v", tt.capability, err)
+		}
+		if ids := serviceIDs(found); !slices.Equal(ids, tt.want) {
+			t.Errorf("capability %s: expected %v, got %v", tt.capability, tt.want, ids)
+		}
+	}
+
+	t.Run("returns error for non-existent service", func(t *testing.T) {
+		if err := registry.Update(ctx, newTestService("missing")); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestRegistryRepository_Deregister(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	registry.Register(ctx, newTestService("svc-1", "payment"))
+	registry.Register(ctx, newTestService("svc-2", "payment"))
+
+	if err := registry.Deregister(ctx, "svc-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := registry.Get(ctx, "svc-1"); err == nil {
+		t.Error("expected deregistered service to be gone")
+	}
+	if mr.Exists(serviceKey("svc-1")) {
+		t.Error("expected service hash to be deleted")
+	}
+	if ok, _ := mr.SIsMember(capabilityKey("payment"), "svc-1"); ok {
+		t.Error("expected capability index membership to be removed")
+	}
+	if ok, _ := mr.SIsMember(serviceIndexKey, "svc-1"); ok {
+		t.Error("expected service index membership to be removed")
+	}
+
+	found, _ := registry.FindByCapability(ctx, "payment")
+	if ids := serviceIDs(found); !slices.Equal(ids, []string{"svc-2"}) {
+		t.Errorf("expected [svc-2], got %v", ids)
+	}
+
+	t.Run("deregistering non-existent service does not error", func(t *testing.T) {
+		if err := registry.Deregister(ctx, "missing"); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestRegistryRepository_UpdateHeartbeat(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	svc := newTestService("svc-1", "payment")
+	svc.Status = service.StatusUnhealthy
+	registry.Register(ctx, svc)
+	document := mr.HGet(serviceKey(svc.ID), fieldData)
+
+	at := svc.LastHeartbeat.Add(time.Minute)
+	if err := registry.UpdateHeartbeat(ctx, svc.ID, at); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if mr.HGet(serviceKey(svc.ID), fieldData) != document {
+		t.Error("expected heartbeat to leave the service document untouched")
+	}
+
+	got, _ := registry.Get(ctx, svc.ID)
+	if !got.LastHeartbeat.Equal(at) {
+		t.Errorf("expected heartbeat %v, got %v", at, got.LastHeartbeat)
+	}
+	if got.Status != service.StatusHealthy {
+		t.Errorf("expected status healthy, got %s", got.Status)
+	}
+
+	t.Run("keeps draining status", func(t *testing.T) {
+		draining := newTestService("svc-2", "payment")
+		draining.Status = service.StatusDraining
+		draining.OverrideStatus = true
+		registry.Register(ctx, draining)
+
+		if err := registry.UpdateHeartbeat(ctx, draining.ID, at); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		got, _ := registry.Get(ctx, draining.ID)
+		if got.Status != service.StatusDraining || !got.OverrideStatus {
+			t.Errorf("expected draining override to survive heartbeat, got %s (override %v)", got.Status, got.OverrideStatus)
+		}
+		if !got.LastHeartbeat.Equal(at) {
+			t.Errorf("expected heartbeat %v, got %v", at, got.LastHeartbeat)
+		}
+	})
+
+	t.Run("returns error for non-existent service", func(t *testing.T) {
+		if err := registry.UpdateHeartbeat(ctx, "missing", at); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if mr.Exists(serviceKey("missing")) {
+			t.Error("expected heartbeat not to create a service hash")
+		}
+	})
+}
+
+func TestRegistryRepository_Revision(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	if got, err := registry.GetRevision(ctx); err != nil || got != 0 {
+		t.Fatalf("expected revision 0 before any change, got %d (%v)", got, err)
+	}
+	if got, err := registry.BumpRevision(ctx); err != nil || got != 1 {
+		t.Fatalf("expected bump to revision 1, got %d (%v)", got, err)
+	}
+
+	svc := newTestService("svc-1", "payment")
+	svc.Status = service.StatusUnhealthy
+	registry.Register(ctx, svc)
+
+	tests := []struct {
+		name string
+		want int64
+	}{
+		{name: "heartbeat changing the status", want: 2},
+		{name: "heartbeat keeping the status", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := registry.UpdateHeartbeat(ctx, svc.ID, time.Now()); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got, _ := registry.GetRevision(ctx); got != tt.want {
+				t.Errorf("expected revision %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRegistryRepository_ListPaged(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	for i, id := range []string{"svc-c", "svc-a", "svc-b"} {
+		svc := newTestService(id)
+		svc.RegisteredAt = svc.RegisteredAt.Add(time.Duration(i) * time.Minute)
+		registry.Register(ctx, svc)
+	}
+
+	tests := []struct {
+		sortBy string
+		want   [][]string
+	}{
+		{sortBy: "", want: [][]string{{"svc-a", "svc-b"}, {"svc-c"}}},
+		{sortBy: service.SortByRegisteredAt, want: [][]string{{"svc-c", "svc-a"}, {"svc-b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run("sort by "+tt.sortBy, func(t *testing.T) {
+			for i, want := range tt.want {
+				page, total, err := registry.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted}, pagination.ListOptions{Limit: 2, Offset: 2 * i, SortBy: tt.sortBy})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if total != 3 {
+					t.Errorf("expected total 3, got %d", total)
+				}
+
+				got := make([]string, len(page))
+				for j, svc := range page {
+					got[j] = svc.ID
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("page %d: expected %v, got %v", i, want, got)
+				}
+			}
+		})
+	}
+	t.Run("scoped to a tenant", func(t *testing.T) {
+		svc := newTestService("svc-d")
+		svc.TenantID = "acme"
+		registry.Register(ctx, svc)
+
+		page, total, err := registry.ListPaged(ctx, service.ListFilter{Scope: tenant.Only("acme")}, pagination.ListOptions{Limit: 10})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if total != 1 || len(page) != 1 || page[0].ID != "svc-d" || page[0].TenantID != "acme" {
+			t.Errorf("expected only the tenant's service, got %v", page)
+		}
+	})
+}
+
+func TestRegistryRepository_SoftDelete(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	registry := NewRegistryRepository(repo)
+	ctx := context.Background()
+
+	registry.Register(ctx, newTestService("svc-1", "payment"))
+	deleted := newTestService("svc-2", "payment")
+	registry.Register(ctx, deleted)
+
+	deleted.DeletedAt = time.Now().UTC().Truncate(time.Millisecond)
+	if err := registry.Update(ctx, deleted); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if ok, _ := mr.SIsMember(serviceIndexKey, "svc-2"); ok {
+		t.Error("expected soft-deleted service out of the service index")
+	}
+	if ok, _ := mr.SIsMember(deletedIndexKey, "svc-2"); !ok {
+		t.Error("expected soft-deleted service in the deleted index")
+	}
+	if ok, _ := mr.SIsMember(capabilityKey("payment"), "svc-2"); ok {
+		t.Error("expected soft-deleted service out of the capability index")
+	}
+
+	got, err := registry.Get(ctx, "svc-2")
+	if err != nil || !got.DeletedAt.Equal(deleted.DeletedAt) {
+		t.Errorf("expected Get to return the soft-deleted service, got %v, %v", got, err)
+	}
+	if services, _ := registry.List(ctx); !slices.Equal(serviceIDs(services), []string{"svc-1"}) {
+		t.Errorf("expected List to return [svc-1], got %v", serviceIDs(services))
+	}
+	if found, _ := registry.FindByCapability(ctx, "payment"); !slices.Equal(serviceIDs(found), []string{"svc-1"}) {
+		t.Errorf("expected FindByCapability to return [svc-1], got %v", serviceIDs(found))
+	}
+	page, total, _ := registry.ListPaged(ctx, service.ListFilter{Scope: tenant.Unrestricted, IncludeDeleted: true}, pagination.ListOptions{Limit: 10})
+	if total != 2 || !slices.Equal(serviceIDs(page), []string{"svc-1", "svc-2"}) {
+		t.Errorf("expected both services with IncludeDeleted, got %v of %d", serviceIDs(page), total)
+	}
+	if err := registry.UpdateHeartbeat(ctx, "svc-2", time.Now()); !errors.Is(err, service.ErrServiceDeleted) {
+		t.Errorf("expected ErrServiceDeleted, got %v", err)
+	}
+
+	t.Run("restoring puts it back in the indexes", func(t *testing.T) {
+		restored := *deleted
+		restored.DeletedAt = time.Time{}
+		registry.Update(ctx, &restored)
+
+		if found, _ := registry.FindByCapability(ctx, "payment"); len(found) != 2 {
+			t.Errorf("expected both services by capability, got %v", serviceIDs(found))
+		}
+		if mr.Exists(deletedIndexKey) {
+			t.Error("expected the deleted index emptied")
+		}
+		registry.Update(ctx, deleted)
+	})
+
+	t.Run("purge removes services deleted before the cutoff", func(t *testing.T) {
+		if purged, _ := registry.Purge(ctx, deleted.DeletedAt); purged != 0 {
+			t.Errorf("expected nothing purged before the cutoff, got %d", purged)
+		}
+		purged, err := registry.Purge(ctx, deleted.DeletedAt.Add(time.Second))
+		if err != nil || purged != 1 {
+			t.Fatalf("expected one service purged, got %d, %v", purged, err)
+		}
+		if mr.Exists(serviceKey("svc-2")) {
+			t.Error("expected the service hash deleted")
+		}
+		if _, err := registry.Get(ctx, "svc-1"); err != nil {
+			t.Errorf("expected live services kept, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionKeyPrefix      = "session:"
+	userSessionsKeyPrefix = "user_sessions:"
+)
+
+func sessionKey(id string) string {
+	return sessionKeyPrefix + id
+}
+
+// userSessionsKey names the set indexing a user's session IDs. Members outlive
+// sessions that expire through their TTL and are pruned when it is read.
+func userSessionsKey(userID string) string {
+	return userSessionsKeyPrefix + userID
+}
+
+// sessionTTL returns the key expiry for a session; Redis requires a positive TTL
+func sessionTTL(expiresAt time.Time) time.Duration {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Millisecond {
+		return time.Millisecond
+	}
+	return ttl
+}
+
+// Create stores a new session in Redis
+func (r *Repository) Create(ctx context.Context, sess *session.Session) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+
+	created, err := r.client.SetNX(ctx, sessionKey(sess.ID), data, sessionTTL(sess.ExpiresAt)).Result()
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	if !created {
+		return session.ErrSessionExists
+	}
+
+	if err := r.client.SAdd(ctx, userSessionsKey(sess.UserID), sess.ID).Err(); err != nil {
+		return fmt.Errorf("index session: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a session from Redis
+func (r *Repository) Get(ctx context.Context, id string) (*session.Session, error) {
+	data, err := r.client.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, session.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+
+	var sess session.Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("unmarshal session: %w", err)
+	}
+
+	return &sess, nil
+}
+
+// Expiry reports when a session expires from its key's TTL, without reading
+// the session itself
+func (r *Repository) Expiry(ctx context.Context, id string) (time.Time, error) {
+	key := sessionKey(id)
+	pipe := r.client.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("get session expiry: %w", err)
+	}
+
+	// PTTL is negative for a key without expiry or one deleted in between
+	if exists.Val() == 0 || ttl.Val() < 0 {
+		return time.Time{}, session.ErrSessionNotFound
+	}
+	return time.Now().Add(ttl.Val()), nil
+}
+
+// Update updates a session in Redis
+func (r *Repository) Update(ctx context.Context, sess *session.Session) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+
+	err = r.client.SetArgs(ctx, sessionKey(sess.ID), data, goredis.SetArgs{
+		Mode: "XX",
+		TTL:  sessionTTL(sess.ExpiresAt),
+	}).Err()
+	if errors.Is(err, goredis.Nil) {
+		return session.ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a session from Redis along with its user index entry
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	// A session that already expired leaves its index entry for ListByUser to prune
+	sess, _ := r.Get(ctx, id)
+
+	_, err := r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(id))
+		if sess != nil {
+			pipe.SRem(ctx, userSessionsKey(sess.UserID), id)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns one page of a user's unexpired sessions within scope,
+// dropping index entries whose session has expired
+func (r *Repository) ListByUser(ctx context.Context, scope tenant.Scope, userID string, opts pagination.ListOptions) ([]*session.Session, int, error) {
+	sessions, err := r.userSessions(ctx, scope, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	slices.SortFunc(sessions, session.CompareBy(opts.SortBy))
+	start, end := opts.Window(len(sessions))
+	return sessions[start:end], len(sessions), nil
+}
+
+// GetByUserService returns the newest unexpired session within scope that
+// userID holds on serviceID, found through the user's session index
+func (r *Repository) GetByUserService(ctx context.Context, scope tenant.Scope, userID, serviceID string) (*session.Session, error) {
+	sessions, err := r.userSessions(ctx, scope, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions = slices.DeleteFunc(sessions, func(sess *session.Session) bool { return sess.ServiceID != serviceID })
+	if len(sessions) == 0 {
+		return nil, session.ErrSessionNotFound
+	}
+	return slices.MaxFunc(sessions, session.CompareBy(session.SortByCreatedAt)), nil
+}
+
+// userSessions loads a user's unexpired sessions within scope, in no
+// particular order, and prunes index entries whose session has expired
+func (r *Repository) userSessions(ctx context.Context, scope tenant.Scope, userID string) ([]*session.Session, error) {
+	indexKey := userSessionsKey(userID)
+	ids, err := r.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("list session ids: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("load sessions: %w", err)
+	}
+
+	var (
+		sessions []*session.Session
+		stale    []any
+	)
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+		var sess session.Session
+		if err := json.Unmarshal([]byte(data), &sess); err != nil {
+			return nil, fmt.Errorf("unmarshal session: %w", err)
+		}
+		if sess.IsActive(time.Now()) && scope.Allows(sess.TenantID) {
+			sessions = append(sessions, &sess)
+		}
+	}
+	if len(stale) > 0 {
+		if err := r.client.SRem(ctx, indexKey, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("prune session index: %w", err)
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteExpired removes expired sessions from Redis.
+// Session keys carry a TTL matching ExpiresAt, so Redis evicts them on its own.
+func (r *Repository) DeleteExpired(ctx context.Context) (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,207 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+)
+
+func TestSessionRepository_CRUD(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	sess := &session.Session{
+		ID:        "sess-123",
+		UserID:    "user-123",
+		ServiceID: "service-1",
+		Data:      map[string]any{"key": "value"},
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := repo.Create(ctx, sess); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.Create(ctx, sess); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+
+	got, err := repo.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.UserID != sess.UserID || got.Data["key"] != "value" {
+		t.Errorf("expected %+v, got %+v", sess, got)
+	}
+
+	sess.Data["key"] = "updated"
+	if err := repo.Update(ctx, sess); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, _ = repo.Get(ctx, sess.ID)
+	if got.Data["key"] != "updated" {
+		t.Errorf("expected updated data, got %v", got.Data["key"])
+	}
+
+	if err := repo.Update(ctx, &session.Session{ID: "missing", ExpiresAt: time.Now().Add(time.Hour)}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating non-existent session, got %v", err)
+	}
+
+	t.Run("keys expire with the session", func(t *testing.T) {
+		mr.FastForward(2 * time.Hour)
+		if _, err := repo.Get(ctx, sess.ID); !errors.Is(err, session.ErrSessionNotFound) {
+			t.Errorf("expected expired session to be gone, got %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		other := *sess
+		other.ID = "sess-456"
+		other.ExpiresAt = time.Now().Add(time.Hour)
+		repo.Create(ctx, &other)
+
+		if err := repo.Delete(ctx, other.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := repo.Get(ctx, other.ID); err == nil {
+			t.Error("expected deleted session to be gone")
+		}
+	})
+}
+
+func TestSessionRepository_ListByUser(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for i, id := range []string{"sess-b", "sess-a", "sess-c"} {
+		repo.Create(ctx, &session.Session{
+			ID:        id,
+			UserID:    "user-1",
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			ExpiresAt: now.Add(time.Duration(i+1) * time.Hour),
+		})
+	}
+	repo.Create(ctx, &session.Session{ID: "other", UserID: "user-2", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	page, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if total != 3 || len(page) != 2 || page[0].ID != "sess-b" || page[1].ID != "sess-a" {
+		t.Errorf("expected first two of 3 sessions by creation, got %d %v", total, page)
+	}
+
+	t.Run("deleted sessions leave the index", func(t *testing.T) {
+		repo.Delete(ctx, "sess-a")
+		if member, _ := mr.IsMember(userSessionsKey("user-1"), "sess-a"); member {
+			t.Error("expected delete to remove the index entry")
+		}
+	})
+
+	t.Run("expired sessions are pruned", func(t *testing.T) {
+		mr.FastForward(90 * time.Minute)
+
+		page, total, err := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if total != 1 || page[0].ID != "sess-c" {
+			t.Errorf("expected only sess-c, got %d %v", total, page)
+		}
+		if member, _ := mr.IsMember(userSessionsKey("user-1"), "sess-b"); member {
+			t.Error("expected expired session to be pruned from the index")
+		}
+	})
+}
+
+func TestSessionRepository_GetByUserService(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for i, spec := range []struct {
+		id, serviceID, tenantID string
+		ttl                     time.Duration
+	}{
+		{"sess-old", "web", "", 2 * time.Hour},
+		{"sess-new", "web", "", time.Hour},
+		{"sess-api", "api", "", 2 * time.Hour},
+		{"sess-acme", "web", "acme", 2 * time.Hour},
+	} {
+		repo.Create(ctx, &session.Session{
+			ID:        spec.id,
+			UserID:    "user-1",
+			ServiceID: spec.serviceID,
+			TenantID:  spec.tenantID,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			ExpiresAt: now.Add(spec.ttl),
+		})
+	}
+
+	get := func(scope tenant.Scope, serviceID string) string {
+		t.Helper()
+		sess, err := repo.GetByUserService(ctx, scope, "user-1", serviceID)
+		if errors.Is(err, session.ErrSessionNotFound) {
+			return ""
+		}
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return sess.ID
+	}
+
+	if got := get(tenant.Only(""), "web"); got != "sess-new" {
+		t.Errorf("expected the newest active session, got %q", got)
+	}
+	if got := get(tenant.Only("acme"), "web"); got != "sess-acme" {
+		t.Errorf("expected the tenant's session, got %q", got)
+	}
+	if got := get(tenant.Unrestricted, "mobile"); got != "" {
+		t.Errorf("expected no session for another service, got %q", got)
+	}
+
+	mr.FastForward(90 * time.Minute)
+	if got := get(tenant.Only(""), "web"); got != "sess-old" {
+		t.Errorf("expected the older session once the newest expired, got %q", got)
+	}
+	if member, _ := mr.IsMember(userSessionsKey("user-1"), "sess-new"); member {
+		t.Error("expected the expired session pruned from the index")
+	}
+}
+
+func TestSessionRepository_Expiry(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(time.Hour)
+	if err := repo.Create(ctx, &session.Session{ID: "sess-1", UserID: "user-1", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Expiry(ctx, "sess-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if diff := got.Sub(expiresAt); diff < -time.Second || diff > time.Second {
+		t.Errorf("expected expiry near %v, got %v", expiresAt, got)
+	}
+
+	if _, err := repo.Expiry(ctx, "missing"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound for a missing session, got %v", err)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if _, err := repo.Expiry(ctx, "sess-1"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound for an expired session, got %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+package repository
+
+import "context"
+
+// Transactor is implemented by repositories that can run several calls as
+// one unit. Calls made with the context passed to fn either all take effect
+// or, when fn returns an error, none do. WithinTx called again with that
+// context joins the running transaction.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
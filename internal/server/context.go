@@ -0,0 +1,36 @@
+package server
+
+import "context"
+
+// contextKey is the type for values stored in the request context by the server
+type contextKey string
+
+const (
+	routePatternKey   contextKey = "route_pattern"
+	sensitiveRouteKey contextKey = "sensitive_route"
+)
+
+// RoutePatternFromContext returns the registered pattern that matched the
+// request, e.g. "/session/" for /session/sess_123. It is empty for requests
+// that matched no route, so logs and metrics keep a bounded set of values.
+func RoutePatternFromContext(ctx context.Context) string {
+	pattern, _ := ctx.Value(routePatternKey).(string)
+	return pattern
+}
+
+// WithRoutePattern returns a copy of ctx carrying the matched route pattern
+func WithRoutePattern(ctx context.Context, pattern string) context.Context {
+	return context.WithValue(ctx, routePatternKey, pattern)
+}
+
+// SensitiveRouteFromContext reports whether the request matched a route
+// registered with Sensitive. It is set before the global middleware runs.
+func SensitiveRouteFromContext(ctx context.Context) bool {
+	sensitive, _ := ctx.Value(sensitiveRouteKey).(bool)
+	return sensitive
+}
+
+// WithSensitiveRoute returns a copy of ctx marking the matched route sensitive
+func WithSensitiveRoute(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sensitiveRouteKey, true)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Group registers routes under a common path prefix with shared options.
+// Group middleware wraps each route once, outside the route's own middleware,
+// and timeouts a route sets replace the group's.
+type Group struct {
+	server  *Server
+	prefix  string
+	options []RouteOption
+}
+
+// Group returns a route group whose patterns are prefixed with prefix, which
+// must start with "/" and not end with one; "" groups routes at the root
+func (s *Server) Group(prefix string, options ...RouteOption) *Group {
+	return &Group{server: s, prefix: prefix, options: options}
+}
+
+// Group returns a nested group adding prefix and options to this group's
+func (g *Group) Group(prefix string, options ...RouteOption) *Group {
+	return &Group{
+		server:  g.server,
+		prefix:  g.prefix + prefix,
+		options: slices.Concat(g.options, options),
+	}
+}
+
+// GET registers a GET route within the group
+func (g *Group) GET(pattern string, handler HandlerFunc, options ...RouteOption) {
+	g.handle(http.MethodGet, pattern, handler, options)
+}
+
+// HEAD registers a HEAD route within the group
+func (g *Group) HEAD(pattern string, handler HandlerFunc, options ...RouteOption) {
+	g.handle(http.MethodHead, pattern, handler, options)
+}
+
+// POST registers a POST route within the group
+func (g *Group) POST(pattern string, handler HandlerFunc, options ...RouteOption) {
+	g.handle(http.MethodPost, pattern, handler, options)
+}
+
+// PUT registers a PUT route within the group
+func (g *Group) PUT(pattern string, handler HandlerFunc, options ...RouteOption) {
+	g.handle(http.MethodPut, pattern, handler, options)
+}
+
+// DELETE registers a DELETE route within the group
+func (g *Group) DELETE(pattern string, handler HandlerFunc, options ...RouteOption) {
+	g.handle(http.MethodDelete, pattern, handler, options)
+}
+
+func (g *Group) handle(method, pattern string, handler HandlerFunc, options []RouteOption) {
+	g.server.handle(method, g.prefix+pattern, handler, slices.Concat(g.options, options)...)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, RoutePatternFromContext(r.Context()))
+	}
+
+	srv, _ := New(Config{Addr: "127.0.0.1:0"})
+	api := srv.Group("/v1", tag("api"))
+	api.GET("/items/", echo, tag("route"))
+	api.Group("/admin", tag("admin")).POST("/reset", echo)
+	srv.Group("").GET("/plain", echo)
+
+	tests := []struct {
+		method      string
+		path        string
+		wantStatus  int
+		wantPattern string
+		wantCalls   []string
+	}{
+		{http.MethodGet, "/v1/items/abc", http.StatusOK, "/v1/items/", []string{"api", "route"}},
+		{http.MethodPost, "/v1/admin/reset", http.StatusOK, "/v1/admin/reset", []string{"api", "admin"}},
+		{http.MethodGet, "/plain", http.StatusOK, "/plain", nil},
+		{http.MethodGet, "/items/abc", http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			calls = nil
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != tt.wantPattern {
+				t.Errorf("expected pattern %q, got %q", tt.wantPattern, rec.Body.String())
+			}
+			if len(calls) != len(tt.wantCalls) {
+				t.Fatalf("expected middleware %v, got %v", tt.wantCalls, calls)
+			}
+			for i := range calls {
+				if calls[i] != tt.wantCalls[i] {
+					t.Errorf("expected middleware %v, got %v", tt.wantCalls, calls)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// ListenerMode selects how Start obtains its listener
+type ListenerMode string
+
+const (
+	// ListenerTCP listens on Config.Addr
+	ListenerTCP ListenerMode = "tcp"
+	// ListenerUnix listens on a unix domain socket at ListenerConfig.SocketPath
+	ListenerUnix ListenerMode = "unix"
+	// ListenerActivation adopts the socket systemd passed under socket
+	// activation, as described by the LISTEN_PID and LISTEN_FDS variables
+	ListenerActivation ListenerMode = "activation"
+)
+
+// ListenerConfig holds the listener settings; the zero value listens on TCP
+type ListenerConfig struct {
+	Mode ListenerMode // empty means ListenerTCP
+	// SocketPath is the unix socket file. A socket left behind by a server
+	// that is gone is replaced; one still accepting connections is an error.
+	SocketPath string
+	// SocketMode sets the permissions of the socket file; 0 keeps those the
+	// umask leaves
+	SocketMode fs.FileMode
+	// SocketOwner and SocketGroup hand the socket file to a user and group,
+	// by name or numeric ID; empty keeps the server's
+	SocketOwner string
+	SocketGroup string
+}
+
+// listenFDsStart is the first descriptor systemd passes, SD_LISTEN_FDS_START.
+// It is a variable so tests can pass another.
+var listenFDsStart = 3
+
+// staleSocketTimeout bounds the dial that tells a stale socket file from one
+// a running server listens on
+const staleSocketTimeout = time.Second
+
+// listen builds the listener for the configured mode
+func (s *Server) listen() (net.Listener, error) {
+	cfg := s.config.Listener
+	switch cfg.Mode {
+	case "", ListenerTCP:
+		ln, err := net.Listen("tcp", s.config.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen on %s: %w", s.config.Addr, err)
+		}
+		return ln, nil
+	case ListenerUnix:
+		return listenUnix(cfg)
+	case ListenerActivation:
+		return activationListener()
+	default:
+		return nil, fmt.Errorf("unknown listener mode %q", cfg.Mode)
+	}
+}
+
+// listenUnix listens on cfg.SocketPath, replacing a stale socket file, and
+// applies the socket's permissions and ownership
+func listenUnix(cfg ListenerConfig) (net.Listener, error) {
+	if cfg.SocketPath == "" {
+		return nil, errors.New("listen on unix socket: no socket path")
+	}
+	if err := removeStaleSocket(cfg.SocketPath); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", cfg.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", cfg.SocketPath, err)
+	}
+	if err := setSocketPermissions(cfg); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket file at path unless a server still
+// accepts connections on it. Files other than sockets are left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check socket %s: %w", path, err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("listen on %s: file exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, staleSocketTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("listen on %s: socket is in use", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove stale socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// setSocketPermissions applies cfg's mode and ownership to the socket file
+func setSocketPermissions(cfg ListenerConfig) error {
+	if cfg.SocketMode != 0 {
+		if err := os.Chmod(cfg.SocketPath, cfg.SocketMode); err != nil {
+			return fmt.Errorf("set socket mode: %w", err)
+		}
+	}
+	if cfg.SocketOwner == "" && cfg.SocketGroup == "" {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	if cfg.SocketOwner != "" {
+		id, err := lookupID(cfg.SocketOwner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("socket owner: %w", err)
+		}
+		uid = id
+	}
+	if cfg.SocketGroup != "" {
+		id, err := lookupID(cfg.SocketGroup, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("socket group: %w", err)
+		}
+		gid = id
+	}
+	if err := os.Chown(cfg.SocketPath, uid, gid); err != nil {
+		return fmt.Errorf("set socket ownership: %w", err)
+	}
+	return nil
+}
+
+// lookupID returns the numeric ID nameOrID stands for, resolving names with
+// lookup
+func lookupID(nameOrID string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	raw, err := lookup(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(raw)
+}
+
+// activationListener adopts the first socket systemd passed to this process.
+// The activation variables are cleared so child processes don't adopt it too.
+func activationListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, errors.New("socket activation: LISTEN_PID does not name this process")
+	}
+	if n, err := strconv.Atoi(fds); err != nil || n < 1 {
+		return nil, errors.New("socket activation: LISTEN_FDS passes no socket")
+	}
+
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_"+strconv.Itoa(listenFDsStart))
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return ln, nil
+}
+
+// removeSocket removes the unix socket file Start listened on. A socket
+// adopted through activation belongs to systemd and is kept.
+func (s *Server) removeSocket() error {
+	cfg := s.config.Listener
+	if cfg.Mode != ListenerUnix || cfg.SocketPath == "" {
+		return nil
+	}
+	s.mu.Lock()
+	started := s.listener != nil
+	s.mu.Unlock()
+	if !started {
+		return nil
+	}
+	if err := os.Remove(cfg.SocketPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove socket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// unixClient returns an HTTP client that dials the unix socket at path
+// whatever the request URL names
+func unixClient(path string, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for "localhost" and
+// its key to dir, returning their paths and a pool trusting the certificate
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+// ping asks the server behind client for /ping and checks the answer
+func ping(t *testing.T, client *http.Client, url string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "pong" {
+		t.Errorf("expected 200 pong, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func newPingServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.GET("/ping", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	})
+	return srv
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pool := writeTestCertificate(t, dir)
+
+	tests := []struct {
+		name     string
+		listener ListenerConfig
+		tls      bool
+		wantMode fs.FileMode
+	}{
+		{name: "plain", listener: ListenerConfig{Mode: ListenerUnix}},
+		{name: "mode and ownership", listener: ListenerConfig{
+			Mode:        ListenerUnix,
+			SocketMode:  0o600,
+			SocketOwner: strconv.Itoa(os.Getuid()),
+			SocketGroup: strconv.Itoa(os.Getgid()),
+		}, wantMode: 0o600},
+		{name: "tls", listener: ListenerConfig{Mode: ListenerUnix}, tls: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".sock")
+			cfg := Config{Listener: tt.listener}
+			cfg.Listener.SocketPath = path
+			scheme, clientTLS := "http", (*tls.Config)(nil)
+			if tt.tls {
+				cfg.TLS = TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile}
+				scheme, clientTLS = "https", &tls.Config{RootCAs: pool, ServerName: "localhost"}
+			}
+			srv := newPingServer(t, cfg)
+			errChan := startTestServer(t, srv)
+
+			if addr := srv.Addr(); addr != path {
+				t.Errorf("expected address %s, got %s", path, addr)
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.Mode().Type() != fs.ModeSocket {
+				t.Fatalf("expected a socket at %s, got %v, %v", path, info, err)
+			}
+			if tt.wantMode != 0 && info.Mode().Perm() != tt.wantMode {
+				t.Errorf("expected socket mode %v, got %v", tt.wantMode, info.Mode().Perm())
+			}
+
+			ping(t, unixClient(path, clientTLS), scheme+"://localhost/ping")
+
+			if err := srv.Shutdown(context.Background()); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+			if err := <-errChan; err != nil {
+				t.Errorf("expected Start to return nil after shutdown, got %v", err)
+			}
+			if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected the socket removed on shutdown, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_UnixSocketExistingFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("stale socket is replaced", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		ln.Close()
+
+		srv := newPingServer(t, Config{Listener: ListenerConfig{Mode: ListenerUnix, SocketPath: path}})
+		startTestServer(t, srv)
+		defer srv.Close()
+		ping(t, unixClient(path, nil), "http://localhost/ping")
+	})
+
+	tests := []struct {
+		name     string
+		prepare  func(t *testing.T, path string)
+		owner    string
+		wantErr  string
+		wantKept bool // whether the existing file must survive
+	}{
+		{name: "socket in use", prepare: func(t *testing.T, path string) {
+			ln, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			t.Cleanup(func() { ln.Close() })
+		}, wantErr: "socket is in use", wantKept: true},
+		{name: "regular file", prepare: func(t *testing.T, path string) {
+			os.WriteFile(path, []byte("keep me"), 0o600)
+		}, wantErr: "not a socket", wantKept: true},
+		{name: "unknown owner", prepare: func(t *testing.T, path string) {}, owner: "no-such-user-here", wantErr: "socket owner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".sock")
+			tt.prepare(t, path)
+			srv := newPingServer(t, Config{Listener: ListenerConfig{Mode: ListenerUnix, SocketPath: path, SocketOwner: tt.owner}})
+			err := srv.Start()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+			}
+			if _, err := os.Lstat(path); tt.wantKept && err != nil {
+				t.Errorf("expected the existing file kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_SocketActivation(t *testing.T) {
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer inherited.Close()
+	f, err := inherited.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("listener file: %v", err)
+	}
+	// Start takes the descriptor over as it would from systemd, so it must
+	// not belong to an *os.File that closes it again
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+
+	start := listenFDsStart
+	listenFDsStart = fd
+	t.Cleanup(func() { listenFDsStart = start })
+
+	t.Run("adopts the passed socket", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		t.Setenv("LISTEN_FDS", "1")
+
+		srv := newPingServer(t, Config{Listener: ListenerConfig{Mode: ListenerActivation}})
+		errChan := startTestServer(t, srv)
+		if addr := srv.Addr(); addr != inherited.Addr().String() {
+			t.Errorf("expected the inherited address %s, got %s", inherited.Addr(), addr)
+		}
+		ping(t, http.DefaultClient, "http://"+srv.Addr()+"/ping")
+
+		if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+			t.Error("expected the activation variables cleared")
+		}
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+		if err := <-errChan; err != nil {
+			t.Errorf("expected Start to return nil after shutdown, got %v", err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		pid     string
+		fds     string
+		wantErr string
+	}{
+		{name: "another process", pid: "1", fds: "1", wantErr: "LISTEN_PID"},
+		{name: "no sockets", pid: strconv.Itoa(os.Getpid()), fds: "0", wantErr: "LISTEN_FDS"},
+		{name: "not activated", wantErr: "LISTEN_PID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+
+			srv := newPingServer(t, Config{Listener: ListenerConfig{Mode: ListenerActivation}})
+			if err := srv.Start(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
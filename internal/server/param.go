@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// Path parameter errors returned by PathParam
+var (
+	// ErrMissingParam is returned when nothing follows the prefix
+	ErrMissingParam = errors.New("missing path parameter")
+	// ErrInvalidParam is returned for a parameter that isn't a valid ID,
+	// such as one holding a percent-encoded slash
+	ErrInvalidParam = errors.New("invalid path parameter")
+)
+
+// PathParam returns the ID in the path segment following prefix, e.g. "abc"
+// for /v1/session/abc and prefix "/session/", and the segments after it
+// without their leading slash. A trailing slash is ignored.
+//
+// It reads the escaped path, so an encoded slash stays within its segment
+// instead of splitting the ID, and the decoded ID must be a valid ID as
+// registration requires. Handlers and scope checks reading IDs through it
+// agree on which resource a request is for.
+func PathParam(r *http.Request, prefix string) (id, rest string, err error) {
+	_, after, _ := strings.Cut(r.URL.EscapedPath(), prefix)
+	after = strings.TrimSuffix(after, "/")
+	segment, rest, _ := strings.Cut(after, "/")
+	if segment == "" {
+		return "", rest, ErrMissingParam
+	}
+
+	id, err = url.PathUnescape(segment)
+	if err != nil || !validation.IsID(id) {
+		return "", rest, ErrInvalidParam
+	}
+	return id, rest, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathParam(t *testing.T) {
+	tests := []struct {
+		target   string
+		wantID   string
+		wantRest string
+		wantErr  error
+	}{
+		{target: "/session/abc", wantID: "abc"},
+		{target: "/v1/session/abc", wantID: "abc"},
+		{target: "/session/abc/", wantID: "abc"},
+		{target: "/session/abc/validate", wantID: "abc", wantRest: "validate"},
+		{target: "/session/abc/validate/", wantID: "abc", wantRest: "validate"},
+		{target: "/session/a/b", wantID: "a", wantRest: "b"},
+		{target: "/session/payment%2D1", wantID: "payment-1"},
+		{target: "/session/", wantErr: ErrMissingParam},
+		{target: "/session//validate", wantRest: "validate", wantErr: ErrMissingParam},
+		{target: "/session/abc%2Fdef", wantErr: ErrInvalidParam},
+		{target: "/session/abc%2fdef", wantErr: ErrInvalidParam},
+		{target: "/session/abc%252Fdef", wantErr: ErrInvalidParam},
+		{target: "/session/..%2F", wantErr: ErrInvalidParam},
+		{target: "/session/..", wantErr: ErrInvalidParam},
+		{target: "/session/%2E%2E", wantErr: ErrInvalidParam},
+		{target: "/session/a%20b", wantErr: ErrInvalidParam},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			id, rest, err := PathParam(httptest.NewRequest(http.MethodGet, tt.target, nil), "/session/")
+			if id != tt.wantID || rest != tt.wantRest || !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %q, %q, %v, got %q, %q, %v", tt.wantID, tt.wantRest, tt.wantErr, id, rest, err)
+			}
+		})
+	}
+}
+
+func TestPathParam_ThroughServer(t *testing.T) {
+	srv, err := New(Config{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.PUT("/registry/heartbeat/", func(w http.ResponseWriter, r *http.Request) {
+		id, _, err := PathParam(r, "/registry/heartbeat/")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(id))
+	})
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantID     string
+	}{
+		{target: "/registry/heartbeat/svc-1", wantStatus: http.StatusOK, wantID: "svc-1"},
+		{target: "/registry/heartbeat/svc-1/", wantStatus: http.StatusOK, wantID: "svc-1"},
+		{target: "/registry/heartbeat/", wantStatus: http.StatusBadRequest},
+		{target: "/registry/heartbeat/svc%2F1", wantStatus: http.StatusBadRequest},
+		{target: "/registry/heartbeat/..%2F", wantStatus: http.StatusBadRequest},
+		{target: "/registry/heartbeat/svc%252F1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, tt.target, nil))
+			if rec.Code != tt.wantStatus || rec.Body.String() != tt.wantID {
+				t.Errorf("expected %d %q, got %d %q", tt.wantStatus, tt.wantID, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"cmp"
+	"net/http"
+	"time"
+)
+
+// defaultMaxRouteTimeout caps the timeouts routes ask for when
+// Config.MaxRouteTimeout is unset
+const defaultMaxRouteTimeout = 5 * time.Minute
+
+// RouteOption configures a route or every route of a group. A Middleware
+// wraps the route's handler; WithReadTimeout and WithWriteTimeout give the
+// route longer timeouts than the server's; Sensitive keeps its bodies out of
+// logs.
+type RouteOption interface {
+	applyRoute(r *route)
+}
+
+// route collects the options a route is registered with
+type route struct {
+	middleware   []Middleware
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	sensitive    bool
+}
+
+func (m Middleware) applyRoute(r *route) {
+	r.middleware = append(r.middleware, m)
+}
+
+// timeoutOption sets a route's read or write timeout
+type timeoutOption struct {
+	read, write time.Duration
+}
+
+func (o timeoutOption) applyRoute(r *route) {
+	if o.read > 0 {
+		r.readTimeout = o.read
+	}
+	if o.write > 0 {
+		r.writeTimeout = o.write
+	}
+}
+
+// WithReadTimeout gives a route d, measured from when the route is reached,
+// to read the request body in instead of Config.ReadTimeout, for routes
+// accepting large uploads. It never shortens the server's timeout or sets
+// one the server doesn't have, and is capped at Config.MaxRouteTimeout.
+func WithReadTimeout(d time.Duration) RouteOption {
+	return timeoutOption{read: d}
+}
+
+// WithWriteTimeout gives a route d, measured from when the route is reached,
+// to write its response in instead of Config.WriteTimeout, for routes
+// producing large responses slowly, like exports. It never shortens the
+// server's timeout or sets one the server doesn't have, and is capped at
+// Config.MaxRouteTimeout.
+func WithWriteTimeout(d time.Duration) RouteOption {
+	return timeoutOption{write: d}
+}
+
+// sensitiveOption marks a route sensitive
+type sensitiveOption struct{}
+
+func (sensitiveOption) applyRoute(r *route) {
+	r.sensitive = true
+}
+
+// Sensitive marks a route whose request or response bodies carry
+// credentials, like token issuance, so middleware logging bodies leaves them
+// out; see SensitiveRouteFromContext.
+func Sensitive() RouteOption {
+	return sensitiveOption{}
+}
+
+// withDeadlines extends the deadlines of the connection serving each request
+// to the route's timeouts before calling h. Writers that cannot adjust
+// deadlines, like httptest recorders, keep none.
+func (s *Server) withDeadlines(h http.Handler, rt route) http.Handler {
+	read := s.routeTimeout(rt.readTimeout, s.config.ReadTimeout)
+	write := s.routeTimeout(rt.writeTimeout, s.config.WriteTimeout)
+	if read == 0 && write == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		now := time.Now()
+		if read > 0 {
+			rc.SetReadDeadline(now.Add(read))
+		}
+		if write > 0 {
+			rc.SetWriteDeadline(now.Add(write))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// routeTimeout returns the timeout a route asking for d gets, capped at the
+// configured maximum, or 0 when the route keeps the server's timeout
+func (s *Server) routeTimeout(d, server time.Duration) time.Duration {
+	d = min(d, cmp.Or(s.config.MaxRouteTimeout, defaultMaxRouteTimeout))
+	if server == 0 || d <= server {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_RouteWriteTimeout(t *testing.T) {
+	const serverTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name       string
+		maxTimeout time.Duration
+		group      []RouteOption
+		route      []RouteOption
+		wantDone   bool
+	}{
+		{name: "server timeout cuts a slow response"},
+		{name: "route timeout lets it finish", route: []RouteOption{WithWriteTimeout(5 * time.Second)}, wantDone: true},
+		{name: "group timeout lets it finish", group: []RouteOption{WithWriteTimeout(5 * time.Second)}, wantDone: true},
+		{name: "route timeout replaces the group's", group: []RouteOption{WithWriteTimeout(5 * time.Second)}, route: []RouteOption{WithWriteTimeout(serverTimeout / 2)}},
+		{name: "read timeout leaves writes alone", route: []RouteOption{WithReadTimeout(5 * time.Second)}},
+		{name: "capped at the maximum", maxTimeout: 150 * time.Millisecond, route: []RouteOption{WithWriteTimeout(5 * time.Second)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := New(Config{Addr: "127.0.0.1:0", WriteTimeout: serverTimeout, MaxRouteTimeout: tt.maxTimeout})
+			if err != nil {
+				t.Fatalf("new server: %v", err)
+			}
+			srv.Group("", tt.group...).GET("/export", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(3 * serverTimeout)
+				io.WriteString(w, "done")
+			}, tt.route...)
+			startTestServer(t, srv)
+			defer srv.Close()
+
+			resp, err := http.Get("http://" + srv.Addr() + "/export")
+			var body []byte
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if done := err == nil && string(body) == "done"; done != tt.wantDone {
+				t.Errorf("expected the response completed %v, got %q, %v", tt.wantDone, body, err)
+			}
+		})
+	}
+}
+
+func TestServer_RouteReadTimeout(t *testing.T) {
+	const serverTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		route    []RouteOption
+		wantRead bool
+	}{
+		{name: "server timeout cuts a slow upload"},
+		{name: "route timeout lets it arrive", route: []RouteOption{WithReadTimeout(5 * time.Second)}, wantRead: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := New(Config{Addr: "127.0.0.1:0", ReadTimeout: serverTimeout})
+			if err != nil {
+				t.Fatalf("new server: %v", err)
+			}
+			srv.POST("/import", func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusRequestTimeout)
+					return
+				}
+				w.Write(body)
+			}, tt.route...)
+			startTestServer(t, srv)
+			defer srv.Close()
+
+			// The body's second half arrives well after the server's read timeout
+			pr, pw := io.Pipe()
+			go func() {
+				io.WriteString(pw, "first half, ")
+				time.Sleep(3 * serverTimeout)
+				io.WriteString(pw, "second half")
+				pw.Close()
+			}()
+			resp, err := http.Post("http://"+srv.Addr()+"/import", "text/plain", pr)
+			var body []byte
+			if err == nil {
+				body, _ = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			read := err == nil && resp.StatusCode == http.StatusOK && strings.HasSuffix(string(body), "second half")
+			if read != tt.wantRead {
+				t.Errorf("expected the body read %v, got %q, %v", tt.wantRead, body, err)
+			}
+		})
+	}
+}
+
+func TestServer_RouteTimeouts(t *testing.T) {
+	tests := []struct {
+		name       string
+		server     time.Duration
+		maxTimeout time.Duration
+		route      time.Duration
+		want       time.Duration
+	}{
+		{name: "extends", server: 15 * time.Second, route: time.Minute, want: time.Minute},
+		{name: "never shortens", server: 15 * time.Second, route: 5 * time.Second},
+		{name: "unset", server: 15 * time.Second},
+		{name: "server without a timeout", route: time.Minute},
+		{name: "default cap", server: 15 * time.Second, route: time.Hour, want: defaultMaxRouteTimeout},
+		{name: "configured cap", server: 15 * time.Second, maxTimeout: 30 * time.Second, route: time.Minute, want: 30 * time.Second},
+		{name: "cap below the server's timeout", server: 15 * time.Second, maxTimeout: 10 * time.Second, route: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := New(Config{Addr: "127.0.0.1:0", MaxRouteTimeout: tt.maxTimeout})
+			if got := srv.routeTimeout(tt.route, tt.server); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
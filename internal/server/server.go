@@ -2,8 +2,16 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,14 +21,26 @@ type Middleware func(http.Handler) http.Handler
 // HandlerFunc is the signature for HTTP handler functions
 type HandlerFunc func(http.ResponseWriter, *http.Request)
 
+// defaultShutdownGrace is how long Shutdown waits for requests in flight
+// when neither its context nor Config.ShutdownGrace bounds it
+const defaultShutdownGrace = 30 * time.Second
+
 // Config holds HTTP server configuration
 type Config struct {
-	Addr         string
+	Addr         string // listened on in ListenerTCP mode
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
-	TLS          TLSConfig
-	Middlewares  []Middleware
+	// ShutdownGrace is how long Shutdown waits for requests in flight when
+	// its context has no deadline; 0 uses 30 seconds
+	ShutdownGrace time.Duration
+	// MaxRouteTimeout caps the timeouts routes ask for with WithReadTimeout
+	// and WithWriteTimeout; 0 uses 5 minutes
+	MaxRouteTimeout time.Duration
+	Listener        ListenerConfig
+	// TLS applies to connections accepted in any listener mode
+	TLS         TLSConfig
+	Middlewares []Middleware
 }
 
 // TLSConfig holds TLS configuration
@@ -28,6 +48,60 @@ type TLSConfig struct {
 	Enabled  bool
 	CertFile string
 	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs trusted to sign client certificates
+	ClientCAFile string
+	ClientAuth   ClientAuth
+}
+
+// ClientAuth selects how the server treats client certificates
+type ClientAuth string
+
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthRequest asks for a certificate but neither requires nor verifies it
+	ClientAuthRequest ClientAuth = "request"
+	// ClientAuthVerifyIfGiven verifies a certificate against ClientCAFile when one is sent
+	ClientAuthVerifyIfGiven ClientAuth = "verify_if_given"
+	// ClientAuthRequire rejects connections without a certificate signed by ClientCAFile
+	ClientAuthRequire ClientAuth = "require"
+)
+
+// tlsConfig builds the listener TLS settings for client certificate handling.
+// The server certificate itself is loaded by ServeTLS.
+func (c TLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch c.ClientAuth {
+	case "", ClientAuthNone:
+		cfg.ClientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		cfg.ClientAuth = tls.RequestClientCert
+	case ClientAuthVerifyIfGiven:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", c.ClientAuth)
+	}
+
+	verifies := cfg.ClientAuth == tls.VerifyClientCertIfGiven || cfg.ClientAuth == tls.RequireAndVerifyClientCert
+	if verifies && c.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth mode %q requires a client CA file", c.ClientAuth)
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+
+	return cfg, nil
 }
 
 // Server wraps net/http server with routing and middleware
@@ -36,12 +110,27 @@ type Server struct {
 	httpServer *http.Server
 	mux        *http.ServeMux
 	middleware []Middleware
+	routes     map[string]map[string]http.Handler // pattern -> method -> handler
+	sensitive  map[string]bool                    // "METHOD pattern" of routes registered with Sensitive
+
+	mu        sync.Mutex
+	listener  net.Listener
+	listenErr error
+	ready     chan struct{}
 }
 
 // New creates a new HTTP server instance
 func New(config Config) (*Server, error) {
 	mux := http.NewServeMux()
 
+	var tlsConfig *tls.Config
+	if config.TLS.Enabled {
+		var err error
+		if tlsConfig, err = config.TLS.tlsConfig(); err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+	}
+
 	srv := &Server{
 		config: config,
 		httpServer: &http.Server{
@@ -50,74 +139,245 @@ func New(config Config) (*Server, error) {
 			ReadTimeout:  config.ReadTimeout,
 			WriteTimeout: config.WriteTimeout,
 			IdleTimeout:  config.IdleTimeout,
+			TLSConfig:    tlsConfig,
 		},
 		mux:        mux,
 		middleware: config.Middlewares,
+		routes:     make(map[string]map[string]http.Handler),
+		sensitive:  make(map[string]bool),
+		ready:      make(chan struct{}),
 	}
 
+	// Mount the catch-all pattern up front so unmatched requests still pass
+	// through the global middleware and are answered with 404
+	srv.routes["/"] = make(map[string]http.Handler)
+	mux.Handle("/", srv.dispatcher("/", srv.routes["/"]))
+
 	return srv, nil
 }
 
 // GET registers a GET route
-func (s *Server) GET(pattern string, handler HandlerFunc, middleware ...Middleware) {
-	s.handle(http.MethodGet, pattern, handler, middleware...)
+func (s *Server) GET(pattern string, handler HandlerFunc, options ...RouteOption) {
+	s.handle(http.MethodGet, pattern, handler, options...)
+}
+
+// HEAD registers a HEAD route
+func (s *Server) HEAD(pattern string, handler HandlerFunc, options ...RouteOption) {
+	s.handle(http.MethodHead, pattern, handler, options...)
 }
 
 // POST registers a POST route
-func (s *Server) POST(pattern string, handler HandlerFunc, middleware ...Middleware) {
-	s.handle(http.MethodPost, pattern, handler, middleware...)
+func (s *Server) POST(pattern string, handler HandlerFunc, options ...RouteOption) {
+	s.handle(http.MethodPost, pattern, handler, options...)
 }
 
 // PUT registers a PUT route
-func (s *Server) PUT(pattern string, handler HandlerFunc, middleware ...Middleware) {
-	s.handle(http.MethodPut, pattern, handler, middleware...)
+func (s *Server) PUT(pattern string, handler HandlerFunc, options ...RouteOption) {
+	s.handle(http.MethodPut, pattern, handler, options...)
 }
 
 // DELETE registers a DELETE route
-func (s *Server) DELETE(pattern string, handler HandlerFunc, middleware ...Middleware) {
-	s.handle(http.MethodDelete, pattern, handler, middleware...)
+func (s *Server) DELETE(pattern string, handler HandlerFunc, options ...RouteOption) {
+	s.handle(http.MethodDelete, pattern, handler, options...)
 }
 
-// handle registers a route with method-based filtering and middleware
-func (s *Server) handle(method, pattern string, handler HandlerFunc, middleware ...Middleware) {
-	// Wrap handler with method checking
+// handle registers a route with method-based filtering and its options.
+// Several methods may share a pattern; each pattern is mounted once with a
+// dispatcher that picks the handler for the request method from the
+// pattern's method table.
+func (s *Server) handle(method, pattern string, handler HandlerFunc, options ...RouteOption) {
+	var rt route
+	for _, option := range options {
+		option.applyRoute(&rt)
+	}
+	var h http.Handler = http.HandlerFunc(handler)
+
+	// Apply route-specific middleware, within the route's deadlines
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	h = s.withDeadlines(h, rt)
+	if rt.sensitive {
+		s.sensitive[method+" "+pattern] = true
+	}
+
+	methods, exists := s.routes[pattern]
+	if !exists {
+		methods = make(map[string]http.Handler)
+		s.routes[pattern] = methods
+		s.mux.Handle(pattern, s.dispatcher(pattern, methods))
+	}
+	methods[method] = h
+}
+
+// dispatcher routes a request to the handler registered for its method,
+// wrapped in the global middleware. The matched pattern, and whether the
+// route is sensitive, are stored in the request context first so every
+// middleware can read them.
+//
+// HEAD requests to a pattern without a HEAD handler are served by its GET
+// handler with the body discarded. OPTIONS requests that the CORS middleware
+// did not answer get 204 with an Allow header listing the pattern's methods,
+// and other unregistered methods get 405 with the same header.
+func (s *Server) dispatcher(pattern string, methods map[string]http.Handler) http.Handler {
 	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != method {
+		if len(methods) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		handler, ok := methods[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			if handler, ok = methods[http.MethodGet]; ok {
+				w = headResponseWriter{w}
+			}
+		}
+		if !ok {
+			w.Header().Set("Allow", allowedMethods(methods))
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		handler(w, r)
+		handler.ServeHTTP(w, r)
 	})
 
-	// Apply route-specific middleware
-	for i := len(middleware) - 1; i >= 0; i-- {
-		h = middleware[i](h)
-	}
-
 	// Apply global middleware
 	for i := len(s.middleware) - 1; i >= 0; i-- {
 		h = s.middleware[i](h)
 	}
 
-	s.mux.Handle(pattern, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matched := pattern
+		if len(methods) == 0 {
+			matched = ""
+		}
+		ctx := WithRoutePattern(r.Context(), matched)
+		if s.sensitive[r.Method+" "+pattern] {
+			ctx = WithSensitiveRoute(ctx)
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// allowedMethods lists the methods a pattern answers for the Allow header:
+// its registered methods, HEAD when it has GET, and OPTIONS
+func allowedMethods(methods map[string]http.Handler) string {
+	allowed := []string{http.MethodOptions}
+	for method := range methods {
+		allowed = append(allowed, method)
+	}
+	if _, ok := methods[http.MethodGet]; ok {
+		allowed = append(allowed, http.MethodHead)
+	}
+	slices.Sort(allowed)
+	return strings.Join(slices.Compact(allowed), ", ")
+}
+
+// headResponseWriter serves a HEAD request with a GET handler: headers and
+// status are sent, the body is dropped
+type headResponseWriter struct {
+	http.ResponseWriter
 }
 
-// Start begins listening for HTTP requests
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Handler returns the root handler serving all registered routes
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start binds the listener of the configured mode and serves requests until
+// Shutdown is called. It returns nil after a graceful shutdown and must only
+// be called once. When binding fails, Ready is closed too and ListenErr
+// returns the error.
 func (s *Server) Start() error {
+	ln, err := s.listen()
+
+	s.mu.Lock()
+	s.listener, s.listenErr = ln, err
+	s.mu.Unlock()
+	close(s.ready)
+	if err != nil {
+		return err
+	}
+
 	if s.config.TLS.Enabled {
-		return s.httpServer.ListenAndServeTLS(s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		err = s.httpServer.ServeTLS(ln, s.config.TLS.CertFile, s.config.TLS.KeyFile)
+	} else {
+		err = s.httpServer.Serve(ln)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Ready returns a channel that is closed once Start has bound the listener,
+// or failed to; ListenErr reports which
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// ListenErr returns the error binding the listener failed with, nil before
+// Start or once it accepts connections
+func (s *Server) ListenErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listenErr
+}
+
+// Addr returns the bound listener address, or the configured address before Start.
+// Useful when listening on ":0". A unix socket's address is its path.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr().String()
 	}
-	return s.httpServer.ListenAndServe()
+	return s.config.Addr
 }
 
-// Shutdown gracefully stops the server
+// Shutdown gracefully stops the server: it stops accepting connections,
+// removes the unix socket file it listened on, closes idle connections and
+// waits for requests in flight until ctx is done, or for the shutdown grace
+// when ctx has no deadline. When they don't finish in time the error wraps
+// context.DeadlineExceeded and their connections stay open; call Close to
+// drop them.
 func (s *Server) Shutdown(ctx context.Context) error {
-	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		grace := s.config.ShutdownGrace
+		if grace <= 0 {
+			grace = defaultShutdownGrace
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grace)
+		defer cancel()
+	}
 
-	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+	err := s.httpServer.Shutdown(ctx)
+	if removeErr := s.removeSocket(); err == nil {
+		err = removeErr
+	}
+	if err != nil {
 		return fmt.Errorf("server shutdown: %w", err)
 	}
 
 	return nil
 }
+
+// Close drops every connection at once, including those with requests in
+// flight, for when Shutdown ran out of time, and removes the unix socket file
+func (s *Server) Close() error {
+	return errors.Join(s.httpServer.Close(), s.removeSocket())
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestServer(t *testing.T, srv *Server) <-chan error {
+	t.Helper()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Start()
+	}()
+
+	select {
+	case <-srv.Ready():
+		if err := srv.ListenErr(); err != nil {
+			t.Fatalf("server failed to start: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not become ready")
+	}
+
+	return errChan
+}
+
+func TestServer_StartReadyShutdown(t *testing.T) {
+	srv, err := New(Config{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.GET("/ping", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong")
+	})
+
+	if addr := srv.Addr(); addr != "127.0.0.1:0" {
+		t.Errorf("expected configured address before start, got %s", addr)
+	}
+
+	errChan := startTestServer(t, srv)
+
+	addr := srv.Addr()
+	if addr == "127.0.0.1:0" {
+		t.Fatal("expected bound address after ready")
+	}
+
+	resp, err := http.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "pong" {
+		t.Errorf("expected 200 pong, got %d %q", resp.StatusCode, body)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("expected Start to return nil after shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after shutdown")
+	}
+}
+
+func TestServer_ShutdownGrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler time.Duration // how long the request in flight takes
+		wantErr bool
+	}{
+		{name: "request finishes within the grace", handler: 50 * time.Millisecond},
+		{name: "grace expires", handler: time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := New(Config{Addr: "127.0.0.1:0", ShutdownGrace: 300 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("new server: %v", err)
+			}
+			started := make(chan struct{})
+			done := make(chan struct{})
+			defer close(done)
+			srv.GET("/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-time.After(tt.handler):
+				case <-done:
+				}
+				io.WriteString(w, "done")
+			})
+			startTestServer(t, srv)
+
+			respErr := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + srv.Addr() + "/slow")
+				if err == nil {
+					_, err = io.ReadAll(resp.Body)
+					resp.Body.Close()
+				}
+				respErr <- err
+			}()
+			<-started
+
+			err = srv.Shutdown(context.Background())
+			if tt.wantErr != errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr {
+				if err := <-respErr; err != nil {
+					t.Errorf("expected the request to complete, got %v", err)
+				}
+				return
+			}
+
+			if err := srv.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			select {
+			case err := <-respErr:
+				if err == nil {
+					t.Error("expected the request dropped by Close")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("request still open after Close")
+			}
+		})
+	}
+}
+
+func TestServer_StartListenError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer taken.Close()
+
+	for name, addr := range map[string]string{"address in use": taken.Addr().String(), "invalid address": "256.0.0.1:0"} {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := New(Config{Addr: addr})
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- srv.Start()
+			}()
+
+			// Waiting on Ready must not block when binding fails
+			select {
+			case <-srv.Ready():
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected Ready closed after the listen failure")
+			}
+			if srv.ListenErr() == nil {
+				t.Error("expected the listen error recorded")
+			}
+			if err := <-errChan; err == nil {
+				t.Error("expected Start to return the listen error")
+			}
+		})
+	}
+}
+
+func TestServer_MethodsSharePattern(t *testing.T) {
+	srv, _ := New(Config{Addr: "127.0.0.1:0"})
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		srv.handle(method, "/items/", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Method)
+		})
+	}
+
+	tests := []struct {
+		method     string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodGet, http.StatusOK, "GET"},
+		{http.MethodPut, http.StatusOK, "PUT"},
+		{http.MethodDelete, http.StatusOK, "DELETE"},
+		{http.MethodPost, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.mux.ServeHTTP(rec, httptest.NewRequest(tt.method, "/items/abc", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_MethodTable(t *testing.T) {
+	srv, _ := New(Config{Addr: "127.0.0.1:0"})
+	srv.GET("/items/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Item", "abc")
+		io.WriteString(w, "item")
+	})
+	srv.PUT("/items/", func(w http.ResponseWriter, r *http.Request) {})
+	srv.POST("/jobs", func(w http.ResponseWriter, r *http.Request) {})
+	srv.GET("/files/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "file") })
+	srv.HEAD("/files/", func(w http.ResponseWriter, r *http.Request) { w.Header().Set("X-Head", "own") })
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{name: "HEAD on GET route", method: http.MethodHead, path: "/items/abc", wantStatus: http.StatusOK, wantHeader: map[string]string{"X-Item": "abc"}},
+		{name: "HEAD route preferred over GET", method: http.MethodHead, path: "/files/a", wantStatus: http.StatusOK, wantHeader: map[string]string{"X-Head": "own"}},
+		{name: "405 lists methods", method: http.MethodDelete, path: "/items/abc", wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS, PUT"}},
+		{name: "405 on POST-only route", method: http.MethodGet, path: "/jobs", wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: map[string]string{"Allow": "OPTIONS, POST"}},
+		{name: "HEAD on POST-only route", method: http.MethodHead, path: "/jobs", wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: map[string]string{"Allow": "OPTIONS, POST"}},
+		{name: "OPTIONS on POST-only route", method: http.MethodOptions, path: "/jobs", wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{"Allow": "OPTIONS, POST"}},
+		{name: "OPTIONS on unknown path", method: http.MethodOptions, path: "/unknown", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus < http.StatusMultipleChoices && rec.Body.Len() != 0 {
+				t.Errorf("expected no body, got %q", rec.Body.String())
+			}
+			for key, want := range tt.wantHeader {
+				if got := rec.Header().Get(key); got != want {
+					t.Errorf("expected %s %q, got %q", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_RoutePattern(t *testing.T) {
+	var got string
+	record := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = RoutePatternFromContext(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	srv, _ := New(Config{Addr: "127.0.0.1:0", Middlewares: []Middleware{record}})
+	srv.GET("/items/", func(w http.ResponseWriter, r *http.Request) {})
+	srv.GET("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		path        string
+		wantPattern string
+		wantStatus  int
+	}{
+		{"/items/abc", "/items/", http.StatusOK},
+		{"/health", "/health", http.StatusOK},
+		{"/unknown/abc", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got = "unset"
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got != tt.wantPattern {
+				t.Errorf("expected pattern %q, got %q", tt.wantPattern, got)
+			}
+		})
+	}
+}
+
+func TestNew_TLSClientAuth(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	os.WriteFile(garbage, []byte("not a certificate"), 0o600)
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{name: "no client auth", tls: TLSConfig{Enabled: true}},
+		{name: "request without CA", tls: TLSConfig{Enabled: true, ClientAuth: ClientAuthRequest}},
+		{name: "require without CA", tls: TLSConfig{Enabled: true, ClientAuth: ClientAuthRequire}, wantErr: "requires a client CA file"},
+		{name: "verify if given without CA", tls: TLSConfig{Enabled: true, ClientAuth: ClientAuthVerifyIfGiven}, wantErr: "requires a client CA file"},
+		{name: "unknown mode", tls: TLSConfig{Enabled: true, ClientAuth: "sometimes"}, wantErr: "unknown client auth mode"},
+		{name: "missing CA file", tls: TLSConfig{Enabled: true, ClientAuth: ClientAuthRequire, ClientCAFile: "/nonexistent/ca.pem"}, wantErr: "read client CA file"},
+		{name: "CA file without certificates", tls: TLSConfig{Enabled: true, ClientAuth: ClientAuthRequire, ClientCAFile: garbage}, wantErr: "no certificates"},
+		{name: "ignored when TLS is disabled", tls: TLSConfig{ClientAuth: ClientAuthRequire}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(Config{Addr: "127.0.0.1:0", TLS: tt.tls})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultKeepAlive is how often a comment line is sent on an idle event
+// stream so proxies do not buffer or drop it
+const DefaultKeepAlive = 15 * time.Second
+
+// ErrStreamIdle is returned by ServeEvents when no event was sent within the idle timeout
+var ErrStreamIdle = errors.New("event stream idle")
+
+// NoWriteTimeout is a route option for long-lived responses. It clears the
+// write deadline set from Config.WriteTimeout so the connection is not cut
+// mid-stream; handlers must then end the response themselves, e.g. through
+// ServeEvents' idle timeout.
+func NoWriteTimeout() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Writers that cannot adjust deadlines, like httptest recorders, have none to clear
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Event is a single server-sent event
+type Event struct {
+	ID   string
+	Type string // event name; empty uses the client's default "message"
+	Data []byte
+}
+
+// EventStreamConfig controls a server-sent event response
+type EventStreamConfig struct {
+	KeepAlive time.Duration // interval between keepalive comments; 0 uses DefaultKeepAlive
+	// IdleTimeout closes the stream when no event arrives for this long;
+	// 0 disables. Clients never write on an event stream, so a closed stream
+	// makes the client reconnect, which is how dead clients are released.
+	IdleTimeout time.Duration
+}
+
+// ServeEvents writes events as a text/event-stream response until the
+// channel is closed, the client goes away or the stream is idle for
+// cfg.IdleTimeout. Keepalive comments are flushed every cfg.KeepAlive.
+// It returns nil when the channel closes and otherwise the reason it stopped.
+// HEAD requests get the stream's headers and return at once.
+func ServeEvents(w http.ResponseWriter, r *http.Request, events <-chan Event, cfg EventStreamConfig) error {
+	keepAlive := cfg.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultKeepAlive
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if err := rc.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if cfg.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(cfg.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return context.Cause(r.Context())
+		case <-idle:
+			return ErrStreamIdle
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return fmt.Errorf("write keepalive: %w", err)
+			}
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if _, err := w.Write(encodeEvent(event)); err != nil {
+				return fmt.Errorf("write event: %w", err)
+			}
+			if idleTimer != nil {
+				idleTimer.Reset(cfg.IdleTimeout)
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+}
+
+// encodeEvent formats an event in the text/event-stream wire format
+func encodeEvent(event Event) []byte {
+	var buf bytes.Buffer
+	if event.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", event.ID)
+	}
+	if event.Type != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event.Type)
+	}
+	for line := range bytes.Lines(event.Data) {
+		fmt.Fprintf(&buf, "data: %s\n", bytes.TrimRight(line, "\r\n"))
+	}
+	if len(event.Data) == 0 {
+		buf.WriteString("data:\n")
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoWriteTimeout(t *testing.T) {
+	srv, err := New(Config{Addr: "127.0.0.1:0", WriteTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		io.WriteString(w, "done")
+	}
+	srv.GET("/slow", slow)
+	srv.GET("/stream", slow, NoWriteTimeout())
+	startTestServer(t, srv)
+	defer srv.Shutdown(context.Background())
+
+	get := func(path string) (string, error) {
+		resp, err := http.Get("http://" + srv.Addr() + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if body, err := get("/slow"); err == nil && body == "done" {
+		t.Error("expected the write timeout to cut the slow response")
+	}
+	if body, err := get("/stream"); err != nil || body != "done" {
+		t.Errorf("expected the exempt route to complete, got %q (%v)", body, err)
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	events := make(chan Event)
+	served := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- ServeEvents(w, r, events, EventStreamConfig{KeepAlive: 10 * time.Millisecond})
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	readUntil := func(want string) {
+		t.Helper()
+		for lines.Scan() {
+			if lines.Text() == want {
+				return
+			}
+		}
+		t.Fatalf("stream ended before %q: %v", want, lines.Err())
+	}
+
+	readUntil(": keepalive")
+
+	go func() {
+		events <- Event{ID: "1", Type: "service.registered", Data: []byte("{\"id\":\"payment-1\"}\n{}")}
+	}()
+	readUntil("id: 1")
+	readUntil("event: service.registered")
+	readUntil(`data: {"id":"payment-1"}`)
+	readUntil("data: {}")
+
+	close(events)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected nil after the channel closed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeEvents did not return after the channel closed")
+	}
+}
+
+func TestServeEvents_IdleTimeout(t *testing.T) {
+	events := make(chan Event)
+	served := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- ServeEvents(w, r, events, EventStreamConfig{KeepAlive: 5 * time.Millisecond, IdleTimeout: 50 * time.Millisecond})
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Keepalives do not count as activity; the stream ends on its own
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), ": keepalive") {
+		t.Errorf("expected keepalive comments before closing, got %q", body)
+	}
+	if err := <-served; !errors.Is(err, ErrStreamIdle) {
+		t.Errorf("expected ErrStreamIdle, got %v", err)
+	}
+}
+
+func TestServeEvents_Head(t *testing.T) {
+	srv, _ := New(Config{Addr: "127.0.0.1:0"})
+	events := make(chan Event) // never closed: a GET would stream until cancelled
+	srv.GET("/events", func(w http.ResponseWriter, r *http.Request) {
+		ServeEvents(w, r, events, EventStreamConfig{})
+	})
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/events", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected 200 text/event-stream, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,222 @@
+// Package audit records the registry's mutations as audit events, prunes
+// them after the retention period and serves them for review and export
+package audit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/audit"
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// ErrInvalidCursor is returned by List for a cursor it didn't hand out
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Defaults applied when the configuration leaves settings unset
+const (
+	defaultRetention     = 30 * 24 * time.Hour
+	defaultPruneInterval = time.Hour
+	defaultBufferSize    = 1000
+	defaultLimit         = 50
+	pruneTimeout         = time.Minute
+)
+
+// Config holds audit settings
+type Config struct {
+	Retention     time.Duration // age after which events are pruned
+	PruneInterval time.Duration // time between prunes
+	// BufferSize is how many events may wait to be stored before new ones
+	// are dropped
+	BufferSize int
+	// RequestID returns the ID of the request a context belongs to; nil
+	// leaves request IDs out
+	RequestID func(ctx context.Context) string
+	Clock     clock.Clock // nil uses the system clock
+}
+
+// Page is one page of events, newest first
+type Page struct {
+	Items []*audit.Event `json:"items"`
+	// NextCursor continues the listing after the last item; nil on the last page
+	NextCursor *string `json:"next_cursor"`
+}
+
+// Service stores audit events and prunes them. It implements
+// journal.Recorder, so the registry hands it its mutations: they are queued
+// and stored by the goroutine Start runs, so recording never waits on the
+// repository.
+type Service struct {
+	repo   audit.AuditRepository
+	config Config
+	logger logger.ILogger
+	queue  chan audit.Event
+
+	dropped atomic.Uint64
+}
+
+// NewService creates an audit service storing events in repo. Unset
+// settings default to 30 days of retention, pruned hourly, and a buffer of
+// 1000 events.
+func NewService(repo audit.AuditRepository, cfg Config, log logger.ILogger) *Service {
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultRetention
+	}
+	if cfg.PruneInterval <= 0 {
+		cfg.PruneInterval = defaultPruneInterval
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+
+	return &Service{
+		repo:   repo,
+		config: cfg,
+		logger: log,
+		queue:  make(chan audit.Event, cfg.BufferSize),
+	}
+}
+
+// Record queues the registry mutation as an event with the action
+// "registry.<op>" on the resource "service/<id>", adding the caller's token
+// subject and request ID from ctx. Heartbeats are not recorded. It never
+// blocks: when the buffer is full the event is dropped and counted.
+func (s *Service) Record(ctx context.Context, e journal.Entry) {
+	if e.Op == journal.OpHeartbeat {
+		return
+	}
+
+	event := audit.Event{
+		Time:      e.Time,
+		Actor:     e.Actor,
+		Action:    "registry." + e.Op,
+		Resource:  "service/" + e.ServiceID,
+		RequestID: e.RequestID,
+	}
+	if event.Time.IsZero() {
+		event.Time = s.config.Clock.Now().UTC()
+	}
+	if claims, ok := token.FromContext(ctx); ok && event.Actor == "" {
+		event.Actor = claims.Subject
+	}
+	if s.config.RequestID != nil && event.RequestID == "" {
+		event.RequestID = s.config.RequestID(ctx)
+	}
+	if e.BeforeStatus != "" || e.AfterStatus != "" {
+		event.Details = make(map[string]string, 2)
+		if e.BeforeStatus != "" {
+			event.Details["before_status"] = string(e.BeforeStatus)
+		}
+		if e.AfterStatus != "" {
+			event.Details["after_status"] = string(e.AfterStatus)
+		}
+	}
+
+	select {
+	case s.queue <- event:
+	default:
+		if s.dropped.Add(1) == 1 {
+			s.logger.Warn("audit buffer full, events are being dropped", "action", event.Action, "resource", event.Resource)
+		}
+	}
+}
+
+// Start stores queued events and prunes expired ones, once right away and
+// then every PruneInterval, until ctx is cancelled. It then stores what is
+// still queued.
+func (s *Service) Start(ctx context.Context) {
+	ticker := s.config.Clock.NewTicker(s.config.PruneInterval)
+	defer ticker.Stop()
+
+	s.prune(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-s.queue:
+					s.store(context.WithoutCancel(ctx), e)
+				default:
+					if dropped := s.dropped.Load(); dropped > 0 {
+						s.logger.Warn("audit events were dropped", "dropped", dropped)
+					}
+					return
+				}
+			}
+		case e := <-s.queue:
+			s.store(ctx, e)
+		case <-ticker.C():
+			s.prune(ctx)
+		}
+	}
+}
+
+func (s *Service) store(ctx context.Context, e audit.Event) {
+	if err := s.repo.Append(ctx, &e); err != nil {
+		s.logger.Error("store audit event failed", "action", e.Action, "resource", e.Resource, "error", err)
+	}
+}
+
+func (s *Service) prune(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, pruneTimeout)
+	defer cancel()
+	if n, err := s.Prune(ctx); err != nil {
+		s.logger.Error("prune audit events failed", "error", err)
+	} else if n > 0 {
+		s.logger.Info("audit events pruned", "count", n)
+	}
+}
+
+// Prune removes the events older than the retention period and returns how
+// many were removed. An event exactly Retention old is kept.
+func (s *Service) Prune(ctx context.Context) (int, error) {
+	return s.repo.Prune(ctx, s.config.Clock.Now().Add(-s.config.Retention))
+}
+
+// List returns up to limit events matching filter, newest first, after the
+// cursor of the previous page, or from the newest event when cursor is
+// empty. A non-positive limit selects 50. Events stored meanwhile don't
+// shift the pages that follow. It fails with ErrInvalidCursor when cursor
+// isn't one List returned.
+func (s *Service) List(ctx context.Context, filter audit.Filter, cursor string, limit int) (Page, error) {
+	var before int64
+	if cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return Page{}, ErrInvalidCursor
+		}
+		before = id
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	// One more than asked tells whether another page follows
+	events, err := s.repo.List(ctx, filter, before, limit+1)
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Items: events}
+	if len(events) > limit {
+		page.Items = events[:limit]
+		next := strconv.FormatInt(page.Items[limit-1].ID, 10)
+		page.NextCursor = &next
+	}
+	if page.Items == nil {
+		page.Items = []*audit.Event{}
+	}
+	return page, nil
+}
+
+// Export calls fn with every event matching filter, newest first, as they
+// are read from the repository
+func (s *Service) Export(ctx context.Context, filter audit.Filter, fn func(*audit.Event) error) error {
+	return s.repo.Each(ctx, filter, fn)
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/audit"
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+var start = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// run starts svc until the test ends
+func run(t *testing.T, svc *Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor polls repo until it holds n events
+func waitFor(t *testing.T, repo audit.AuditRepository, n int) []*audit.Event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, _ := repo.List(context.Background(), audit.Filter{}, 0, n+1)
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestService_Record(t *testing.T) {
+	repo := memory.NewAuditRepository(0)
+	svc := NewService(repo, Config{
+		RequestID: func(context.Context) string { return "req-1" },
+		Clock:     clock.NewFake(start),
+	}, logger.NewNop())
+	run(t, svc)
+
+	ctx := token.NewContext(context.Background(), &token.Claims{Subject: "ops"})
+	svc.Record(ctx, journal.Entry{Time: start, Op: journal.OpHeartbeat, ServiceID: "payment-1"})
+	svc.Record(ctx, journal.Entry{Time: start, Op: journal.OpSetStatus, ServiceID: "payment-1",
+		BeforeStatus: service.StatusHealthy, AfterStatus: service.StatusDraining})
+	svc.Record(context.Background(), journal.Entry{Time: start.Add(time.Second), Op: journal.OpHealth, ServiceID: "payment-1",
+		AfterStatus: service.StatusUnhealthy})
+
+	events := waitFor(t, repo, 2)
+	if len(events) != 2 {
+		t.Fatalf("expected the heartbeat left out, got %d events", len(events))
+	}
+	got := events[1]
+	if got.Actor != "ops" || got.Action != "registry.set_status" || got.Resource != "service/payment-1" || got.RequestID != "req-1" ||
+		got.Details["before_status"] != "healthy" || got.Details["after_status"] != "draining" {
+		t.Errorf("expected the status change by ops, got %+v", got)
+	}
+	if events[0].Actor != "" || events[0].Action != "registry.health" {
+		t.Errorf("expected the health change without actor, got %+v", events[0])
+	}
+}
+
+func TestService_Prune(t *testing.T) {
+	repo := memory.NewAuditRepository(0)
+	fake := clock.NewFake(start)
+	svc := NewService(repo, Config{Retention: 24 * time.Hour, Clock: fake}, logger.NewNop())
+
+	ctx := context.Background()
+	for _, age := range []time.Duration{25 * time.Hour, 24*time.Hour + time.Nanosecond, 24 * time.Hour, time.Hour} {
+		repo.Append(ctx, &audit.Event{Time: start.Add(-age), Action: "registry.register", Resource: "service/payment-1"})
+	}
+
+	// The event exactly a retention period old is kept
+	if n, err := svc.Prune(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 events pruned, got %d, %v", n, err)
+	}
+	page, _ := svc.List(ctx, audit.Filter{}, "", 10)
+	if len(page.Items) != 2 || !page.Items[1].Time.Equal(start.Add(-24*time.Hour)) {
+		t.Errorf("expected the events from the cutoff on, got %+v", page.Items)
+	}
+
+	// Start prunes right away, then on every tick
+	run(t, svc)
+	fake.Advance(time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		page, _ = svc.List(ctx, audit.Filter{}, "", 10)
+		if len(page.Items) == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(page.Items) != 1 {
+		t.Errorf("expected the day-old event pruned on the next tick, got %d events", len(page.Items))
+	}
+}
+
+func TestService_List(t *testing.T) {
+	repo := memory.NewAuditRepository(0)
+	svc := NewService(repo, Config{}, logger.NewNop())
+	ctx := context.Background()
+	for i := range 5 {
+		repo.Append(ctx, &audit.Event{Time: start.Add(time.Duration(i) * time.Second), Action: "registry.register"})
+	}
+
+	var seen []int64
+	cursor := ""
+	for range 10 {
+		page, err := svc.List(ctx, audit.Filter{}, cursor, 2)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, e := range page.Items {
+			seen = append(seen, e.ID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = *page.NextCursor
+	}
+	if want := []int64{5, 4, 3, 2, 1}; !slices.Equal(seen, want) {
+		t.Errorf("expected %v, got %v", want, seen)
+	}
+
+	for _, cursor := range []string{"abc", "-1", "0"} {
+		if _, err := svc.List(ctx, audit.Filter{}, cursor, 2); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected cursor %q refused, got %v", cursor, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/token"
+)
+
+// CacheStats reports the size and effectiveness of the token validation cache
+type CacheStats struct {
+	Entries  int   `json:"entries"`
+	Capacity int   `json:"capacity"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+// cacheKey is the SHA-256 of a token string, so the cache holds no bearer credentials
+type cacheKey [sha256.Size]byte
+
+// cacheEntry is a token that passed validation, with its claims
+type cacheEntry struct {
+	key    cacheKey
+	claims *token.Claims
+}
+
+// validationCache is a least-recently-used cache of validated tokens. Entries
+// expire with their token. Tokens are also indexed by ID so revoking one
+// removes its entry.
+type validationCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	order   *list.List          // of *cacheEntry, most recently used first
+	byID    map[string]cacheKey // token ID -> key
+
+	hits, misses atomic.Int64
+}
+
+func newValidationCache(capacity int) *validationCache {
+	return &validationCache{
+		capacity: capacity,
+		entries:  make(map[cacheKey]*list.Element, capacity),
+		order:    list.New(),
+		byID:     make(map[string]cacheKey, capacity),
+	}
+}
+
+// get returns the claims cached for a token. Claims of a token that expired
+// since it was cached are dropped and reported with expired.
+func (c *validationCache) get(key cacheKey, now time.Time) (claims *token.Claims, expired bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if exp := entry.claims.ExpiresAt; !exp.IsZero() && now.After(exp) {
+		c.remove(elem)
+		c.misses.Add(1)
+		return nil, true
+	}
+
+	c.hits.Add(1)
+	c.order.MoveToFront(elem)
+	return entry.claims, false
+}
+
+// add caches the claims of a validated token, evicting the least recently
+// used entry when full. valid is called under the cache lock and the entry is
+// only added if it still reports true, so a revocation that raced the
+// validation can't leave the token cached.
+func (c *validationCache) add(key cacheKey, claims *token.Claims, valid func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok || !valid() {
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, claims: claims})
+	c.byID[claims.ID] = key
+}
+
+// purge removes the entry of the token with the given ID
+func (c *validationCache) purge(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.byID[id]; ok {
+		c.remove(c.entries[key])
+	}
+}
+
+// clear removes every entry
+func (c *validationCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	clear(c.byID)
+	c.order.Init()
+}
+
+// remove drops an entry from the list and both indexes. Callers hold the lock.
+func (c *validationCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	if c.byID[entry.claims.ID] == entry.key {
+		delete(c.byID, entry.claims.ID)
+	}
+}
+
+func (c *validationCache) stats() CacheStats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Entries:  entries,
+		Capacity: c.capacity,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+	}
+}
+
+// cloneClaims copies claims with their own roles, scopes and metadata
+func cloneClaims(claims *token.Claims) *token.Claims {
+	cloned := *claims
+	cloned.Roles = slices.Clone(claims.Roles)
+	cloned.Scopes = slices.Clone(claims.Scopes)
+	cloned.Metadata = maps.Clone(claims.Metadata)
+	return &cloned
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/jwt"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func newCachingService(size int) *Service {
+	return NewService(
+		jwt.New(jwt.Config{Secret: "test-secret", Issuer: "root-server"}),
+		memory.NewAPIKeyRepository(),
+		Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour, ValidationCacheSize: size},
+		logger.NewNop(),
+	)
+}
+
+func TestService_ValidationCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("repeat validations hit the cache", func(t *testing.T) {
+		svc := newCachingService(10)
+		resp, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1", Roles: []string{"user"}})
+
+		for range 3 {
+			claims, err := svc.ValidateToken(ctx, resp.Token)
+			if err != nil || claims.Subject != "user-1" {
+				t.Fatalf("expected user-1's claims, got %+v, %v", claims, err)
+			}
+		}
+		if stats := svc.CacheStats(); stats != (CacheStats{Entries: 1, Capacity: 10, Hits: 2, Misses: 1}) {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("callers can't alter the cached claims", func(t *testing.T) {
+		svc := newCachingService(10)
+		resp, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1", Roles: []string{"user"}, Scopes: []string{"session:read"}, Metadata: map[string]any{"team": "payments"}})
+
+		for range 2 {
+			claims, err := svc.ValidateToken(ctx, resp.Token)
+			if err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			claims.Roles[0] = token.RoleAdmin
+			claims.Scopes[0] = "session:write"
+			claims.Metadata["team"] = "platform"
+		}
+
+		claims, _ := svc.ValidateToken(ctx, resp.Token)
+		if claims.Roles[0] != "user" || claims.Scopes[0] != "session:read" || claims.Metadata["team"] != "payments" {
+			t.Errorf("expected the cached claims unchanged, got %+v", claims)
+		}
+		if stats := svc.CacheStats(); stats.Hits != 2 {
+			t.Errorf("expected the later validations served from the cache, got %+v", stats)
+		}
+	})
+
+	t.Run("cached tokens keep their type", func(t *testing.T) {
+		svc := newCachingService(10)
+		resp, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1"})
+
+		svc.ValidateToken(ctx, resp.Token)
+		if _, err := svc.RefreshToken(ctx, resp.Token); !errors.Is(err, ErrWrongTokenType) {
+			t.Errorf("expected ErrWrongTokenType for a cached access token, got %v", err)
+		}
+	})
+
+	t.Run("revocation invalidates the cache", func(t *testing.T) {
+		svc := newCachingService(10)
+		resp, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1"})
+		other, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-2"})
+		svc.ValidateToken(ctx, resp.Token)
+		svc.ValidateToken(ctx, other.Token)
+
+		if err := svc.RevokeToken(ctx, resp.Token); err != nil {
+			t.Fatalf("revoke: %v", err)
+		}
+		if _, err := svc.ValidateToken(ctx, resp.Token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("expected ErrTokenRevoked after revocation, got %v", err)
+		}
+		if _, err := svc.ValidateToken(ctx, resp.Token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("expected the revoked token to stay out of the cache, got %v", err)
+		}
+		if _, err := svc.ValidateToken(ctx, other.Token); err != nil {
+			t.Errorf("expected other tokens to stay valid, got %v", err)
+		}
+		if stats := svc.CacheStats(); stats.Entries != 1 {
+			t.Errorf("expected only the other token to stay cached, got %+v", stats)
+		}
+	})
+
+	t.Run("removing a secret invalidates the cache", func(t *testing.T) {
+		svc := newCachingService(10)
+		resp, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1", Roles: []string{"user"}})
+		if _, err := svc.ValidateToken(ctx, resp.Token); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+
+		if err := svc.SetSigningSecrets([]jwt.SecretVersion{{ID: "2026-10", Value: "new-secret", Primary: true}}); err != nil {
+			t.Fatalf("set secrets: %v", err)
+		}
+		if _, err := svc.ValidateToken(ctx, resp.Token); !errors.Is(err, jwt.ErrSignatureMismatch) {
+			t.Errorf("expected the token signed with the removed secret refused, got %v", err)
+		}
+		if stats := svc.CacheStats(); stats.Entries != 0 {
+			t.Errorf("expected the cache emptied, got %+v", stats)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		svc := newCachingService(0)
+		resp, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1"})
+		svc.ValidateToken(ctx, resp.Token)
+		svc.ValidateToken(ctx, resp.Token)
+
+		if stats := svc.CacheStats(); stats != (CacheStats{}) {
+			t.Errorf("expected zero stats without a cache, got %+v", stats)
+		}
+	})
+}
+
+func TestValidationCache_Expiry(t *testing.T) {
+	exp := time.Now().Add(time.Minute)
+	key := cacheKey(sha256.Sum256([]byte("token")))
+	always := func() bool { return true }
+
+	tests := []struct {
+		name        string
+		at          time.Time
+		wantClaims  bool
+		wantExpired bool
+	}{
+		{name: "before expiry", at: exp.Add(-time.Nanosecond), wantClaims: true},
+		{name: "at expiry", at: exp, wantClaims: true},
+		{name: "after expiry", at: exp.Add(time.Nanosecond), wantExpired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newValidationCache(10)
+			cache.add(key, &token.Claims{ID: "tok-1", ExpiresAt: exp}, always)
+
+			claims, expired := cache.get(key, tt.at)
+			if (claims != nil) != tt.wantClaims || expired != tt.wantExpired {
+				t.Fatalf("expected claims %v and expired %v, got %+v and %v", tt.wantClaims, tt.wantExpired, claims, expired)
+			}
+			if tt.wantExpired {
+				if claims, expired := cache.get(key, tt.at); claims != nil || expired {
+					t.Errorf("expected the expired entry to be dropped, got %+v, %v", claims, expired)
+				}
+				if _, indexed := cache.byID["tok-1"]; indexed {
+					t.Error("expected the expired entry to leave the ID index")
+				}
+			}
+		})
+	}
+
+	t.Run("claims without expiry never expire", func(t *testing.T) {
+		cache := newValidationCache(10)
+		cache.add(key, &token.Claims{ID: "tok-1"}, always)
+		if claims, _ := cache.get(key, time.Now().Add(24*365*time.Hour)); claims == nil {
+			t.Error("expected claims without expiry to stay cached")
+		}
+	})
+}
+
+func TestValidationCache_Eviction(t *testing.T) {
+	cache := newValidationCache(2)
+	now := time.Now()
+	keys := make([]cacheKey, 3)
+	for i := range keys {
+		keys[i] = sha256.Sum256([]byte(fmt.Sprintf("token-%d", i)))
+	}
+
+	cache.add(keys[0], &token.Claims{ID: "tok-0"}, func() bool { return true })
+	cache.add(keys[1], &token.Claims{ID: "tok-1"}, func() bool { return true })
+	cache.get(keys[0], now) // tok-1 becomes the least recently used
+	cache.add(keys[2], &token.Claims{ID: "tok-2"}, func() bool { return true })
+
+	for i, want := range []bool{true, false, true} {
+		if claims, _ := cache.get(keys[i], now); (claims != nil) != want {
+			t.Errorf("tok-%d: expected cached %v", i, want)
+		}
+	}
+	if _, indexed := cache.byID["tok-1"]; indexed {
+		t.Error("expected the evicted entry to leave the ID index")
+	}
+
+	cache.add(keys[1], &token.Claims{ID: "tok-1"}, func() bool { return false })
+	if claims, _ := cache.get(keys[1], now); claims != nil {
+		t.Error("expected a token revoked during validation not to be cached")
+	}
+}
+
+func BenchmarkService_ValidateToken(b *testing.B) {
+	metadata := make(map[string]any, 50)
+	for i := range 50 {
+		metadata[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("a reasonably long metadata value number %d", i)
+	}
+
+	for _, size := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			svc := newCachingService(size)
+			ctx := context.Background()
+			resp, err := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-1", Roles: []string{"user"}, Metadata: metadata})
+			if err != nil {
+				b.Fatalf("issue: %v", err)
+			}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := svc.ValidateToken(ctx, resp.Token); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
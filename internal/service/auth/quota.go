@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/quota"
+)
+
+// ErrQuotaExceeded matches the *QuotaExceededError IssueToken returns when a
+// caller has issued its quota of tokens within the window
+var ErrQuotaExceeded = errors.New("issuance quota exceeded")
+
+// defaultQuotaWindow applies when a quota limit is set without a window
+const defaultQuotaWindow = time.Hour
+
+// IssuanceQuota caps the tokens each caller issues over a sliding window
+type IssuanceQuota struct {
+	Limit  int           // tokens per caller within Window, 0 disables the quota
+	Window time.Duration // 0 uses an hour
+	Exempt []string      // caller subjects the quota doesn't apply to
+	// Store counts issuances; it is required when Limit is set
+	Store quota.QuotaStore
+}
+
+func (q IssuanceQuota) enabled() bool {
+	return q.Limit > 0 && q.Store != nil
+}
+
+// QuotaExceededError is returned when a caller has used up its quota. It
+// matches ErrQuotaExceeded.
+type QuotaExceededError struct {
+	Subject string
+	Limit   int
+	ResetAt time.Time // when the oldest issuance leaves the window and frees a slot
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %q may issue %d tokens per window, next at %s",
+		ErrQuotaExceeded, e.Subject, e.Limit, e.ResetAt.UTC().Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, ErrQuotaExceeded) hold
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// QuotaStatus is a caller's issuance quota usage
+type QuotaStatus struct {
+	Subject string `json:"subject"`
+	// Unlimited is set when no quota applies, because it is disabled or the
+	// subject is exempt; the other fields are then left empty
+	Unlimited     bool      `json:"unlimited"`
+	Limit         int       `json:"limit,omitempty"`
+	Used          int       `json:"used"`
+	Remaining     int       `json:"remaining"`
+	WindowSeconds int       `json:"window_seconds,omitempty"`
+	ResetAt       time.Time `json:"reset_at,omitzero"` // when the next slot frees, unset while none is used
+}
+
+// QuotaStats counts issuance quota decisions since the service started
+type QuotaStats struct {
+	Limit         int    `json:"limit"`
+	WindowSeconds int    `json:"window_seconds"`
+	Granted       uint64 `json:"granted"`
+	Rejected      uint64 `json:"rejected"`
+	Exempted      uint64 `json:"exempted"`
+}
+
+// quotaCounters holds the counters behind QuotaStats
+type quotaCounters struct {
+	granted, rejected, exempted atomic.Uint64
+}
+
+// exempt reports whether the quota skips the subject
+func (s *Service) exempt(subject string) bool {
+	return slices.Contains(s.config.Quota.Exempt, subject)
+}
+
+// acquireQuota counts one issuance against the subject's quota and fails
+// with a *QuotaExceededError when none is left
+func (s *Service) acquireQuota(ctx context.Context, subject string) error {
+	q := s.config.Quota
+	if !q.enabled() {
+		return nil
+	}
+	if s.exempt(subject) {
+		s.quota.exempted.Add(1)
+		return nil
+	}
+
+	now := s.now()
+	usage, ok, err := q.Store.Acquire(ctx, subject, q.Limit, q.Window, now)
+	if err != nil {
+		return fmt.Errorf("check issuance quota: %w", err)
+	}
+	if !ok {
+		s.quota.rejected.Add(1)
+		resetAt := usage.ResetAt(q.Window, now)
+		s.logger.Warn("token issuance quota exceeded", "subject", subject, "limit", q.Limit, "reset_at", resetAt)
+		return &QuotaExceededError{Subject: subject, Limit: q.Limit, ResetAt: resetAt}
+	}
+
+	s.quota.granted.Add(1)
+	return nil
+}
+
+// Quota returns the issuance quota usage of subject
+func (s *Service) Quota(ctx context.Context, subject string) (*QuotaStatus, error) {
+	q := s.config.Quota
+	if !q.enabled() || s.exempt(subject) {
+		return &QuotaStatus{Subject: subject, Unlimited: true}, nil
+	}
+
+	now := s.now()
+	usage, err := q.Store.Usage(ctx, subject, q.Window, now)
+	if err != nil {
+		return nil, fmt.Errorf("get issuance quota: %w", err)
+	}
+
+	status := &QuotaStatus{
+		Subject:       subject,
+		Limit:         q.Limit,
+		Used:          usage.Count,
+		Remaining:     max(q.Limit-usage.Count, 0),
+		WindowSeconds: int(q.Window / time.Second),
+	}
+	if usage.Count > 0 {
+		status.ResetAt = usage.ResetAt(q.Window, now)
+	}
+	return status, nil
+}
+
+// QuotaStats reports the issuance quota settings and decisions. The zero
+// value is returned when the quota is disabled.
+func (s *Service) QuotaStats() QuotaStats {
+	q := s.config.Quota
+	if !q.enabled() {
+		return QuotaStats{}
+	}
+	return QuotaStats{
+		Limit:         q.Limit,
+		WindowSeconds: int(q.Window / time.Second),
+		Granted:       s.quota.granted.Load(),
+		Rejected:      s.quota.rejected.Load(),
+		Exempted:      s.quota.exempted.Load(),
+	}
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/jwt"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func newQuotaTestService(quota IssuanceQuota) *Service {
+	quota.Store = memory.NewQuotaStore()
+	return NewService(
+		jwt.New(jwt.Config{Secret: "test-secret", Issuer: "root-server"}),
+		memory.NewAPIKeyRepository(),
+		Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour, Quota: quota},
+		logger.NewNop(),
+	)
+}
+
+func callerContext(subject string, roles ...string) context.Context {
+	return token.NewContext(context.Background(), &token.Claims{Subject: subject, Roles: roles})
+}
+
+func TestService_IssuanceQuotaWindow(t *testing.T) {
+	svc := newQuotaTestService(IssuanceQuota{Limit: 2, Window: time.Hour})
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	svc.now = func() time.Time { return now }
+
+	gateway := callerContext("gateway", token.RoleIssuer)
+	issue := func(at time.Duration) error {
+		now = start.Add(at)
+		_, err := svc.IssueToken(gateway, IssueTokenRequest{Subject: "user-1"})
+		return err
+	}
+
+	if err := issue(0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := issue(30 * time.Minute); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err := issue(45 * time.Minute)
+	var exceeded *QuotaExceededError
+	if !errors.As(err, &exceeded) || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected a QuotaExceededError, got %v", err)
+	}
+	if !exceeded.ResetAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("expected the quota to reset when the first token leaves the window, got %v", exceeded.ResetAt)
+	}
+
+	status, err := svc.Quota(context.Background(), "gateway")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status.Used != 2 || status.Remaining != 0 || status.Limit != 2 || !status.ResetAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if err := issue(time.Hour); err != nil {
+		t.Errorf("expected a slot once the first token left the window, got %v", err)
+	}
+	if err := issue(time.Hour + time.Minute); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected the second token to still count, got %v", err)
+	}
+
+	if _, err := svc.IssueToken(callerContext("user-2", "user"), IssueTokenRequest{Subject: "user-2"}); err != nil {
+		t.Errorf("expected another caller to have its own quota, got %v", err)
+	}
+	if _, err := svc.IssueToken(context.Background(), IssueTokenRequest{Subject: "user-3"}); err != nil {
+		t.Errorf("expected issuance without a caller to skip the quota, got %v", err)
+	}
+
+	stats := svc.QuotaStats()
+	if stats.Granted != 4 || stats.Rejected != 2 || stats.Limit != 2 || stats.WindowSeconds != 3600 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestService_IssuanceQuotaConcurrent(t *testing.T) {
+	svc := newQuotaTestService(IssuanceQuota{Limit: 5})
+	gateway := callerContext("gateway", token.RoleIssuer)
+
+	var (
+		wg               sync.WaitGroup
+		mu               sync.Mutex
+		issued, rejected int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.IssueToken(gateway, IssueTokenRequest{Subject: "user-1"})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				issued++
+			case errors.Is(err, ErrQuotaExceeded):
+				rejected++
+			default:
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if issued != 5 || rejected != 45 {
+		t.Errorf("expected 5 issued and 45 rejected, got %d and %d", issued, rejected)
+	}
+}
+
+func TestService_IssuanceQuotaExempt(t *testing.T) {
+	svc := newQuotaTestService(IssuanceQuota{Limit: 1, Exempt: []string{"apikey:bootstrap"}})
+	admin := callerContext("apikey:bootstrap", token.RoleAdmin)
+
+	for range 3 {
+		if _, err := svc.IssueToken(admin, IssueTokenRequest{Subject: "user-1"}); err != nil {
+			t.Fatalf("expected an exempt caller to be unlimited, got %v", err)
+		}
+	}
+	if status, _ := svc.Quota(context.Background(), "apikey:bootstrap"); !status.Unlimited {
+		t.Errorf("expected an exempt caller's quota to be unlimited, got %+v", status)
+	}
+
+	other := callerContext("apikey:ci", token.RoleAdmin)
+	if _, err := svc.IssueToken(other, IssueTokenRequest{Subject: "user-1"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.IssueToken(other, IssueTokenRequest{Subject: "user-1"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected the admin role alone not to exempt a caller, got %v", err)
+	}
+
+	if stats := svc.QuotaStats(); stats.Exempted != 3 || stats.Granted != 1 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestService_IssuanceQuotaDisabled(t *testing.T) {
+	svc, _ := newTestService()
+	for range 3 {
+		if _, err := svc.IssueToken(callerContext("user-1", "user"), IssueTokenRequest{Subject: "user-1"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if status, _ := svc.Quota(context.Background(), "user-1"); !status.Unlimited {
+		t.Errorf("expected no quota, got %+v", status)
+	}
+	if stats := svc.QuotaStats(); stats != (QuotaStats{}) {
+		t.Errorf("expected zero stats, got %+v", stats)
+	}
+}
@@ -1 +1,504 @@
 package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/apikey"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/internal/stats"
+	"github.com/aq189/bin/pkg/jwt"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func newTestService() (*Service, *memory.APIKeyRepository) {
+	repo := memory.NewAPIKeyRepository()
+	svc := NewService(
+		jwt.New(jwt.Config{Secret: "test-secret", Issuer: "root-server"}),
+		repo,
+		Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour},
+		logger.NewNop(),
+	)
+	return svc, repo
+}
+
+func TestService_IssueAndValidateToken(t *testing.T) {
+	svc, _ := newTestService()
+	ctx := context.Background()
+
+	resp, err := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-123", Roles: []string{"user"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("access token validates", func(t *testing.T) {
+		claims, err := svc.ValidateToken(ctx, resp.Token)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if claims.Subject != "user-123" || !slices.Equal(claims.Roles, []string{"user"}) {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+		if claims.Issuer != "root-server" {
+			t.Errorf("expected issuer root-server, got %q", claims.Issuer)
+		}
+	})
+
+	t.Run("refresh token is not an access token", func(t *testing.T) {
+		if _, err := svc.ValidateToken(ctx, resp.RefreshToken); !errors.Is(err, ErrWrongTokenType) {
+			t.Errorf("expected ErrWrongTokenType, got %v", err)
+		}
+	})
+
+	t.Run("refresh issues a new access token", func(t *testing.T) {
+		refreshed, err := svc.RefreshToken(ctx, resp.RefreshToken)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.ValidateToken(ctx, refreshed.Token); err != nil {
+			t.Errorf("expected refreshed token to validate, got %v", err)
+		}
+	})
+
+	t.Run("revoked token is rejected", func(t *testing.T) {
+		if err := svc.RevokeToken(ctx, resp.Token); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.ValidateToken(ctx, resp.Token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("expected ErrTokenRevoked, got %v", err)
+		}
+	})
+}
+
+func TestService_TokenExpiry(t *testing.T) {
+	for _, cacheSize := range []int{0, 10} {
+		t.Run(fmt.Sprintf("cache size %d", cacheSize), func(t *testing.T) {
+			fake := clock.NewFake(time.Now())
+			svc := NewService(
+				jwt.New(jwt.Config{Secret: "test-secret", Clock: fake}),
+				memory.NewAPIKeyRepository(),
+				Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour, ValidationCacheSize: cacheSize, Clock: fake},
+				logger.NewNop(),
+			)
+			ctx := context.Background()
+
+			resp, err := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-123"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !resp.IssuedAt.Equal(fake.Now()) {
+				t.Errorf("expected the token issued at %v, got %v", fake.Now(), resp.IssuedAt)
+			}
+
+			fake.Advance(15 * time.Minute)
+			if _, err := svc.ValidateToken(ctx, resp.Token); err != nil {
+				t.Fatalf("expected the token valid until its expiry, got %v", err)
+			}
+
+			fake.Advance(time.Second)
+			if _, err := svc.ValidateToken(ctx, resp.Token); !errors.Is(err, jwt.ErrTokenExpired) {
+				t.Errorf("expected ErrTokenExpired after expiry, got %v", err)
+			}
+			if _, err := svc.RefreshToken(ctx, resp.RefreshToken); err != nil {
+				t.Errorf("expected the refresh token still valid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestService_TokensIssuedLastHour(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	fake := clock.NewFake(start)
+	svc := NewService(
+		jwt.New(jwt.Config{Secret: "test-secret", Clock: fake}),
+		memory.NewAPIKeyRepository(),
+		Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour, Issued: new(stats.Counter), Clock: fake},
+		logger.NewNop(),
+	)
+	ctx := context.Background()
+
+	issue := func(at time.Duration) *TokenResponse {
+		t.Helper()
+		fake.Set(start.Add(at))
+		resp, err := svc.IssueToken(ctx, IssueTokenRequest{Subject: "user-123"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return resp
+	}
+	resp := issue(0)
+	issue(30 * time.Minute)
+	if _, err := svc.RefreshToken(ctx, resp.RefreshToken); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.IssueToken(ctx, IssueTokenRequest{}); err == nil {
+		t.Fatal("expected a request without subject to fail")
+	}
+
+	tests := []struct {
+		at   time.Duration
+		want int64
+	}{
+		{at: 30 * time.Minute, want: 2},
+		{at: time.Hour - time.Second, want: 2},
+		{at: time.Hour, want: 1},
+		{at: 90 * time.Minute, want: 0},
+	}
+	for _, tt := range tests {
+		fake.Set(start.Add(tt.at))
+		if got := svc.TokensIssuedLastHour(); got != tt.want {
+			t.Errorf("at %v: expected %d tokens issued, got %d", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestService_IssueTokenTenant(t *testing.T) {
+	svc, _ := newTestService()
+	acme := token.NewContext(context.Background(), &token.Claims{Subject: "acme-service", Roles: []string{token.RoleIssuer}, TenantID: "acme"})
+	admin := token.NewContext(context.Background(), &token.Claims{Subject: "operator", Roles: []string{token.RoleAdmin}})
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		tenant     string
+		wantTenant string
+		wantErr    error
+	}{
+		{name: "inherits the caller's tenant", ctx: acme, wantTenant: "acme"},
+		{name: "same tenant", ctx: acme, tenant: "acme", wantTenant: "acme"},
+		{name: "other tenant", ctx: acme, tenant: "globex", wantErr: ErrForeignTenant},
+		{name: "admin picks any tenant", ctx: admin, tenant: "globex", wantTenant: "globex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.IssueToken(tt.ctx, IssueTokenRequest{Subject: "worker", Tenant: tt.tenant})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			claims, _ := svc.ValidateToken(context.Background(), resp.Token)
+			if claims.Tenant() != tt.wantTenant {
+				t.Errorf("expected tenant %q, got %q", tt.wantTenant, claims.Tenant())
+			}
+			refreshed, _ := svc.RefreshToken(context.Background(), resp.RefreshToken)
+			if claims, _ := svc.ValidateToken(context.Background(), refreshed.Token); claims.Tenant() != tt.wantTenant {
+				t.Errorf("expected refreshed token to keep tenant %q, got %q", tt.wantTenant, claims.Tenant())
+			}
+		})
+	}
+}
+
+func TestService_IssueTokenPolicy(t *testing.T) {
+	svc, _ := newTestService()
+	caller := func(subject string, roles ...string) context.Context {
+		return token.NewContext(context.Background(), &token.Claims{Subject: subject, Roles: roles})
+	}
+	scoped := func(subject string, scopes ...string) context.Context {
+		return token.NewContext(context.Background(), &token.Claims{Subject: subject, Roles: []string{"service"}, Scopes: scopes})
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		req     IssueTokenRequest
+		wantErr error
+	}{
+		{name: "self issuance", ctx: caller("user-1", "user"), req: IssueTokenRequest{Subject: "user-1", Roles: []string{"user"}}},
+		{name: "subset of roles", ctx: caller("user-1", "user", "billing"), req: IssueTokenRequest{Subject: "user-1", Roles: []string{"billing"}}},
+		{name: "no roles", ctx: caller("user-1", "user"), req: IssueTokenRequest{Subject: "user-1"}},
+		{name: "other subject", ctx: caller("user-1", "user"), req: IssueTokenRequest{Subject: "user-2", Roles: []string{"user"}}, wantErr: ErrForbidden},
+		{name: "role escalation", ctx: caller("user-1", "user"), req: IssueTokenRequest{Subject: "user-1", Roles: []string{token.RoleAdmin}}, wantErr: ErrForbidden},
+		{name: "issuer delegates", ctx: caller("gateway", token.RoleIssuer), req: IssueTokenRequest{Subject: "user-2", Roles: []string{"billing"}}},
+		{name: "admin override", ctx: caller("operator", token.RoleAdmin), req: IssueTokenRequest{Subject: "user-2", Roles: []string{token.RoleAdmin}}},
+		{name: "unscoped caller narrows", ctx: caller("svc-123", "service"), req: IssueTokenRequest{Subject: "svc-123", Roles: []string{"service"}, Scopes: []string{"registry:heartbeat:svc-123"}}},
+		{name: "scopes within wildcard", ctx: scoped("svc-123", "registry:heartbeat:*"), req: IssueTokenRequest{Subject: "svc-123", Scopes: []string{"registry:heartbeat:svc-123"}}},
+		{name: "scope escalation", ctx: scoped("svc-123", "registry:heartbeat:svc-123"), req: IssueTokenRequest{Subject: "svc-123", Scopes: []string{"registry:heartbeat:*"}}, wantErr: ErrForbidden},
+		{name: "scoped caller drops scopes", ctx: scoped("svc-123", "registry:heartbeat:svc-123"), req: IssueTokenRequest{Subject: "svc-123", Roles: []string{"service"}}, wantErr: ErrForbidden},
+		{name: "admin grants any scope", ctx: caller("operator", token.RoleAdmin), req: IssueTokenRequest{Subject: "svc-123", Scopes: []string{"session:*"}}},
+		{name: "malformed scope", ctx: caller("operator", token.RoleAdmin), req: IssueTokenRequest{Subject: "svc-123", Scopes: []string{"session::read"}}, wantErr: ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.IssueToken(tt.ctx, tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			issuer, _ := token.FromContext(tt.ctx)
+			claims, _ := svc.ValidateToken(context.Background(), resp.Token)
+			if got, _ := claims.GetString(token.MetadataIssuedBy); got != issuer.Subject {
+				t.Errorf("expected issued_by %q, got %q", issuer.Subject, got)
+			}
+			refreshed, _ := svc.RefreshToken(context.Background(), resp.RefreshToken)
+			refreshedClaims, _ := svc.ValidateToken(context.Background(), refreshed.Token)
+			if !slices.Equal(claims.Scopes, tt.req.Scopes) || !slices.Equal(refreshedClaims.Scopes, tt.req.Scopes) {
+				t.Errorf("expected scopes %v on both tokens, got %v and %v", tt.req.Scopes, claims.Scopes, refreshedClaims.Scopes)
+			}
+		})
+	}
+
+	t.Run("issued_by cannot be forged", func(t *testing.T) {
+		resp, err := svc.IssueToken(caller("user-1"), IssueTokenRequest{Subject: "user-1", Metadata: map[string]any{token.MetadataIssuedBy: "operator"}})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		claims, _ := svc.ValidateToken(context.Background(), resp.Token)
+		if got, _ := claims.GetString(token.MetadataIssuedBy); got != "user-1" {
+			t.Errorf("expected issued_by user-1, got %q", got)
+		}
+	})
+
+	t.Run("tenant cannot be chosen through metadata", func(t *testing.T) {
+		resp, err := svc.IssueToken(caller("user-1"), IssueTokenRequest{Subject: "user-1", Metadata: map[string]any{token.MetadataTenant: "victim", "team": "payments"}})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		claims, err := svc.ValidateToken(context.Background(), resp.Token)
+		if err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		if _, ok := claims.Metadata[token.MetadataTenant]; ok || claims.Metadata["team"] != "payments" {
+			t.Errorf("expected only the tenant metadata dropped, got %v", claims.Metadata)
+		}
+		if scope := tenant.FromContext(token.NewContext(context.Background(), claims)); scope != tenant.Only("") {
+			t.Errorf("expected the caller's own tenant, got %+v", scope)
+		}
+	})
+}
+
+// warnCounter counts the warnings logged through it
+type warnCounter struct {
+	logger.ILogger
+	warnings int
+}
+
+func (l *warnCounter) Warn(msg string, fields ...any) { l.warnings++ }
+
+func TestService_TokenAudience(t *testing.T) {
+	ctx := context.Background()
+	services := memory.NewRegistryRepository()
+	services.Register(ctx, &service.Service{ID: "billing-1", Name: "billing"})
+	services.Register(ctx, &service.Service{ID: "globex-billing-1", Name: "billing", TenantID: "globex"})
+	lookup := registry.NewService(services, registry.Config{}, logger.NewNop())
+
+	admin := token.NewContext(ctx, &token.Claims{Subject: "operator", Roles: []string{token.RoleAdmin}})
+	acme := token.NewContext(ctx, &token.Claims{Subject: "acme-gateway", Roles: []string{token.RoleIssuer}, TenantID: "acme"})
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		audience     string
+		reject       bool
+		wantErr      error
+		wantWarnings int
+	}{
+		{name: "registered service", ctx: admin, audience: "billing-1"},
+		{name: "no audience", ctx: admin, reject: true},
+		{name: "unknown audience warns", ctx: admin, audience: "missing-1", wantWarnings: 1},
+		{name: "unknown audience rejected", ctx: admin, audience: "missing-1", reject: true, wantErr: ErrUnknownAudience},
+		{name: "service of another tenant", ctx: acme, audience: "globex-billing-1", reject: true, wantErr: ErrUnknownAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &warnCounter{ILogger: logger.NewNop()}
+			svc := NewService(
+				jwt.New(jwt.Config{Secret: "test-secret", Issuer: "root-server"}),
+				memory.NewAPIKeyRepository(),
+				Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour, Services: lookup, RejectUnknownAudiences: tt.reject},
+				log,
+			)
+
+			resp, err := svc.IssueToken(tt.ctx, IssueTokenRequest{Subject: "worker", Audience: tt.audience})
+			if got := log.warnings; got != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %d", tt.wantWarnings, got)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if claims, _ := svc.ValidateToken(ctx, resp.Token); claims.Audience != tt.audience {
+				t.Errorf("expected audience %q, got %q", tt.audience, claims.Audience)
+			}
+		})
+	}
+}
+
+func TestService_ValidateTokenFor(t *testing.T) {
+	svc, _ := newTestService()
+	ctx := context.Background()
+	bound, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "worker", Audience: "billing-1"})
+	unbound, _ := svc.IssueToken(ctx, IssueTokenRequest{Subject: "worker"})
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		wantErr  error
+	}{
+		{name: "matching audience", token: bound.Token, audience: "billing-1"},
+		{name: "other audience", token: bound.Token, audience: "search-1", wantErr: ErrAudienceMismatch},
+		{name: "token without audience", token: unbound.Token, audience: "billing-1", wantErr: ErrAudienceMismatch},
+		{name: "any audience", token: bound.Token},
+		{name: "refresh token", token: bound.RefreshToken, audience: "billing-1", wantErr: ErrWrongTokenType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := svc.ValidateTokenFor(ctx, tt.token, tt.audience)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || claims.Subject != "worker" {
+				t.Fatalf("expected the token accepted, got %+v, %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestService_APIKeys(t *testing.T) {
+	svc, repo := newTestService()
+	ctx := context.Background()
+
+	created, err := svc.CreateAPIKey(ctx, CreateAPIKeyRequest{Name: "billing", Roles: []string{"service", "reader"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("only the hash is stored", func(t *testing.T) {
+		if !apikey.IsAPIKey(created.Key) {
+			t.Errorf("expected key with %q prefix, got %q", apikey.Prefix, created.Key)
+		}
+		stored, err := repo.GetByHash(ctx, apikey.Hash(created.Key))
+		if err != nil {
+			t.Fatalf("expected key to be stored by hash, got %v", err)
+		}
+		if stored.Hash == created.Key {
+			t.Error("expected plaintext not to be stored")
+		}
+	})
+
+	t.Run("roles propagate into claims", func(t *testing.T) {
+		claims, err := svc.ValidateAPIKey(ctx, created.Key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !slices.Equal(claims.Roles, []string{"service", "reader"}) {
+			t.Errorf("expected key roles, got %v", claims.Roles)
+		}
+		if claims.Subject != "apikey:billing" || claims.Metadata["api_key_id"] != created.ID {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("unknown key is rejected", func(t *testing.T) {
+		if _, err := svc.ValidateAPIKey(ctx, apikey.Generate()); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey, got %v", err)
+		}
+	})
+
+	t.Run("revoked key is rejected", func(t *testing.T) {
+		if err := svc.RevokeAPIKey(ctx, created.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.ValidateAPIKey(ctx, created.Key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey, got %v", err)
+		}
+	})
+
+	t.Run("revoking unknown key reports not found", func(t *testing.T) {
+		if err := svc.RevokeAPIKey(ctx, "ak_missing"); !errors.Is(err, apikey.ErrAPIKeyNotFound) {
+			t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+		}
+	})
+}
+
+func TestService_ExpiredAPIKey(t *testing.T) {
+	svc, repo := newTestService()
+	ctx := context.Background()
+
+	plaintext := apikey.Generate()
+	expiredAt := time.Now().Add(-time.Minute)
+	repo.Create(ctx, &apikey.APIKey{
+		ID:        "ak_expired",
+		Name:      "old",
+		Hash:      apikey.Hash(plaintext),
+		CreatedAt: time.Now().Add(-time.Hour),
+		ExpiresAt: &expiredAt,
+	})
+
+	if _, err := svc.ValidateAPIKey(ctx, plaintext); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey, got %v", err)
+	}
+}
+
+func TestService_EnsureAPIKey(t *testing.T) {
+	svc, _ := newTestService()
+	ctx := context.Background()
+
+	const key = "rk_bootstrap"
+	for i := 0; i < 2; i++ {
+		if err := svc.EnsureAPIKey(ctx, "bootstrap", key, []string{"admin"}, 0); err != nil {
+			t.Fatalf("seed %d: expected no error, got %v", i, err)
+		}
+	}
+
+	claims, err := svc.ValidateAPIKey(ctx, key)
+	if err != nil {
+		t.Fatalf("expected seeded key to validate, got %v", err)
+	}
+	if !slices.Equal(claims.Roles, []string{"admin"}) {
+		t.Errorf("expected admin role, got %v", claims.Roles)
+	}
+
+	if err := svc.EnsureAPIKey(ctx, "bad", "not-a-key", nil, 0); err == nil {
+		t.Error("expected error for key without prefix, got nil")
+	}
+
+	t.Run("expires after its ttl", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		svc := NewService(jwt.New(jwt.Config{Secret: "test-secret"}), memory.NewAPIKeyRepository(), Config{Clock: fake}, logger.NewNop())
+
+		if err := svc.EnsureAPIKey(ctx, "bootstrap", key, []string{"admin"}, time.Hour); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		if _, err := svc.ValidateAPIKey(ctx, key); err != nil {
+			t.Fatalf("expected the seeded key valid within its ttl, got %v", err)
+		}
+		fake.Advance(time.Hour + time.Second)
+		if _, err := svc.ValidateAPIKey(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey once the ttl passed, got %v", err)
+		}
+	})
+}
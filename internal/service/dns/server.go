@@ -0,0 +1,457 @@
+// Package dns answers DNS queries for the capabilities of the service
+// registry, so consumers that only speak DNS, the way they would query a
+// Consul agent, can find the healthy instances of a capability without the
+// HTTP API.
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// Defaults applied when the configuration leaves settings unset
+const (
+	DefaultAddr   = ":8600"
+	DefaultDomain = "service.root."
+	defaultTTL    = 5 * time.Second
+)
+
+const (
+	// srvPriority is the priority of every SRV record; instances are told
+	// apart by their weight alone
+	srvPriority = 1
+	// addrLabel is the label under the domain of the names standing for an IP
+	// address, like 0a000001.addr.service.root. for 10.0.0.1
+	addrLabel = "addr"
+
+	// minUDPSize is the size UDP answers are kept to unless the query
+	// advertises a larger one with EDNS0, and maxUDPSize the largest accepted
+	minUDPSize = 512
+	maxUDPSize = 4096
+
+	queryTimeout   = 2 * time.Second  // per lookup in the registry
+	tcpIdleTimeout = 10 * time.Second // between queries on a TCP connection
+	maxInFlight    = 64               // UDP queries answered at once
+)
+
+// Discoverer finds the services advertising a capability.
+// *registry.Service implements it.
+type Discoverer interface {
+	Discover(ctx context.Context, opts registry.DiscoverOptions) ([]*service.Service, error)
+}
+
+// Config holds the settings of the DNS server
+type Config struct {
+	Addr   string        // UDP and TCP address, DefaultAddr when empty
+	Domain string        // names answered are <capability>.<Domain>, DefaultDomain when empty
+	TTL    time.Duration // how long answers may be cached, 5 seconds when unset
+}
+
+// Server answers queries for <capability>.<domain>: SRV queries with a
+// record per healthy endpoint of the healthy instances advertising the
+// capability, weighted by the endpoint weight, and A and AAAA queries with
+// the endpoints whose host is an IP address. An SRV target is the endpoint
+// host, or for an IP address a name under addr.<domain> the server answers
+// with that address, sent along as an additional record. Names of
+// capabilities without a healthy instance don't exist, and names outside the
+// domain are refused.
+//
+// Queries are answered over UDP and TCP on the same address. UDP answers
+// larger than the client accepts are truncated so it retries over TCP.
+type Server struct {
+	services Discoverer
+	config   Config
+	domain   string // config.Domain lowercased, with a leading dot
+	logger   logger.ILogger
+
+	udp net.PacketConn
+	tcp net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{} // open TCP connections
+}
+
+// NewServer creates a server answering from services. It serves nothing
+// until Listen and Serve are called.
+func NewServer(services Discoverer, cfg Config, log logger.ILogger) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+	cfg.Domain = strings.TrimPrefix(cfg.Domain, ".")
+	if cfg.Domain == "" {
+		cfg.Domain = DefaultDomain
+	}
+	if !strings.HasSuffix(cfg.Domain, ".") {
+		cfg.Domain += "."
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultTTL
+	}
+
+	return &Server{
+		services: services,
+		config:   cfg,
+		domain:   "." + strings.ToLower(cfg.Domain),
+		logger:   log,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen binds the UDP and TCP sockets. With port 0 the TCP socket takes the
+// port the UDP socket was given.
+func (s *Server) Listen() error {
+	udp, err := net.ListenPacket("udp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	s.udp, s.tcp = udp, tcp
+	return nil
+}
+
+// Addr returns the address the server is bound to, or the configured one
+// before Listen
+func (s *Server) Addr() string {
+	if s.udp == nil {
+		return s.config.Addr
+	}
+	return s.udp.LocalAddr().String()
+}
+
+// Serve answers queries until ctx is done, then closes the sockets and open
+// connections and waits for the queries being answered
+func (s *Server) Serve(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.serveUDP(ctx, &wg)
+	}()
+	go func() {
+		defer wg.Done()
+		s.serveTCP(ctx, &wg)
+	}()
+
+	<-ctx.Done()
+	s.udp.Close()
+	s.tcp.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	wg.Wait()
+}
+
+func (s *Server) serveUDP(ctx context.Context, wg *sync.WaitGroup) {
+	inFlight := make(chan struct{}, maxInFlight)
+	for {
+		buf := make([]byte, maxUDPSize)
+		n, addr, err := s.udp.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.logger.Warn("dns read failed", "error", err)
+			continue
+		}
+
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-inFlight
+				wg.Done()
+			}()
+			if resp := s.answer(ctx, buf[:n], false); resp != nil {
+				s.udp.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP(ctx context.Context, wg *sync.WaitGroup) {
+	for {
+		conn, err := s.tcp.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.logger.Warn("dns accept failed", "error", err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// serveConn answers the length-prefixed queries of a TCP connection until it
+// is closed or idle for tcpIdleTimeout
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	var size [2]byte
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		resp := s.answer(ctx, query, true)
+		if resp == nil {
+			return
+		}
+		out := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(resp)), uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the packed response to query, or nil when it isn't a query
+// worth answering. UDP responses are truncated to what the client accepts.
+func (s *Server) answer(ctx context.Context, query []byte, overTCP bool) []byte {
+	var req dnsmessage.Message
+	if err := req.Unpack(query); err != nil || req.Header.Response {
+		return nil
+	}
+
+	resp := dnsmessage.Message{Header: dnsmessage.Header{
+		ID:               req.Header.ID,
+		Response:         true,
+		OpCode:           req.Header.OpCode,
+		Authoritative:    true,
+		RecursionDesired: req.Header.RecursionDesired,
+	}}
+	udpSize := minUDPSize
+	var edns bool
+	for _, r := range req.Additionals {
+		if r.Header.Type == dnsmessage.TypeOPT {
+			edns = true
+			udpSize = min(max(int(r.Header.Class), minUDPSize), maxUDPSize)
+		}
+	}
+
+	switch {
+	case req.Header.OpCode != 0:
+		resp.Header.RCode = dnsmessage.RCodeNotImplemented
+	case len(req.Questions) != 1:
+		resp.Header.RCode = dnsmessage.RCodeFormatError
+	default:
+		q := req.Questions[0]
+		resp.Questions = req.Questions
+		resp.Header.RCode, resp.Answers, resp.Additionals = s.resolve(ctx, q)
+	}
+	if edns {
+		resp.Additionals = append(resp.Additionals, optRecord())
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		s.logger.Error("dns answer failed", "error", err)
+		return nil
+	}
+	if overTCP || len(packed) <= udpSize {
+		return packed
+	}
+
+	// Too large for the client: send the question alone, flagged truncated
+	resp.Header.Truncated = true
+	resp.Answers, resp.Additionals = nil, nil
+	if edns {
+		resp.Additionals = []dnsmessage.Resource{optRecord()}
+	}
+	packed, err = resp.Pack()
+	if err != nil {
+		s.logger.Error("dns answer failed", "error", err)
+		return nil
+	}
+	return packed
+}
+
+// optRecord is the EDNS0 record of responses to queries carrying one
+func optRecord() dnsmessage.Resource {
+	opt := dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+	opt.Header.Name = dnsmessage.MustNewName(".")
+	opt.Header.SetEDNS0(maxUDPSize, dnsmessage.RCodeSuccess, false)
+	return opt
+}
+
+// resolve returns the response code, answers and additional records of q
+func (s *Server) resolve(ctx context.Context, q dnsmessage.Question) (dnsmessage.RCode, []dnsmessage.Resource, []dnsmessage.Resource) {
+	name := q.Name.String()
+	if q.Class != dnsmessage.ClassINET || !strings.HasSuffix(strings.ToLower(name), s.domain) {
+		return dnsmessage.RCodeRefused, nil, nil
+	}
+	label := name[:len(name)-len(s.domain)]
+
+	if encoded, ok := strings.CutSuffix(strings.ToLower(label), "."+addrLabel); ok {
+		ip, ok := decodeAddr(encoded)
+		if !ok {
+			return dnsmessage.RCodeNameError, nil, nil
+		}
+		if rr, ok := s.addrRecord(q.Name, ip); ok && rr.Header.Type == q.Type {
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{rr}, nil
+		}
+		return dnsmessage.RCodeSuccess, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	services, err := s.services.Discover(ctx, registry.DiscoverOptions{
+		Capability:           label,
+		HealthyOnly:          true,
+		HealthyEndpointsOnly: true,
+	})
+	if err != nil {
+		s.logger.Error("dns lookup failed", "capability", label, "error", err)
+		return dnsmessage.RCodeServerFailure, nil, nil
+	}
+	if len(services) == 0 {
+		return dnsmessage.RCodeNameError, nil, nil
+	}
+
+	var answers, additionals []dnsmessage.Resource
+	seen := make(map[string]bool)
+	for _, svc := range services {
+		for _, e := range svc.Endpoints {
+			if !e.Healthy {
+				continue
+			}
+			host, port, ok := hostPort(e.URL)
+			if !ok {
+				continue
+			}
+			ip, err := netip.ParseAddr(host)
+			isIP := err == nil
+
+			switch q.Type {
+			case dnsmessage.TypeSRV:
+				target := host + "."
+				if isIP {
+					target = encodeAddr(ip) + "." + addrLabel + "." + s.config.Domain
+				}
+				if seen[target+":"+strconv.Itoa(port)] {
+					continue
+				}
+				targetName, err := dnsmessage.NewName(target)
+				if err != nil {
+					continue
+				}
+				seen[target+":"+strconv.Itoa(port)] = true
+				answers = append(answers, dnsmessage.Resource{
+					Header: s.header(q.Name, dnsmessage.TypeSRV),
+					Body: &dnsmessage.SRVResource{
+						Priority: srvPriority,
+						Weight:   uint16(min(max(e.Weight, 1), 0xffff)),
+						Port:     uint16(port),
+						Target:   targetName,
+					},
+				})
+				if rr, ok := s.addrRecord(targetName, ip); isIP && ok {
+					additionals = append(additionals, rr)
+				}
+			case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+				if !isIP || seen[ip.String()] {
+					continue
+				}
+				if rr, ok := s.addrRecord(q.Name, ip); ok && rr.Header.Type == q.Type {
+					seen[ip.String()] = true
+					answers = append(answers, rr)
+				}
+			}
+		}
+	}
+	return dnsmessage.RCodeSuccess, answers, additionals
+}
+
+// header returns the header of a record of name
+func (s *Server) header(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{
+		Name:  name,
+		Type:  typ,
+		Class: dnsmessage.ClassINET,
+		TTL:   uint32(s.config.TTL / time.Second),
+	}
+}
+
+// addrRecord returns the A or AAAA record of name resolving to ip, reporting
+// false when ip isn't valid
+func (s *Server) addrRecord(name dnsmessage.Name, ip netip.Addr) (dnsmessage.Resource, bool) {
+	ip = ip.Unmap()
+	switch {
+	case ip.Is4():
+		return dnsmessage.Resource{Header: s.header(name, dnsmessage.TypeA), Body: &dnsmessage.AResource{A: ip.As4()}}, true
+	case ip.Is6():
+		return dnsmessage.Resource{Header: s.header(name, dnsmessage.TypeAAAA), Body: &dnsmessage.AAAAResource{AAAA: ip.As16()}}, true
+	}
+	return dnsmessage.Resource{}, false
+}
+
+// hostPort returns the host of an endpoint URL and its port, the default one
+// of http and https when the URL has none
+func hostPort(endpoint string) (string, int, bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return "", 0, false
+	}
+	if p := u.Port(); p != "" {
+		port, err := strconv.ParseUint(p, 10, 16)
+		return u.Hostname(), int(port), err == nil && port > 0
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return u.Hostname(), 80, true
+	case "https":
+		return u.Hostname(), 443, true
+	}
+	return "", 0, false
+}
+
+// encodeAddr returns the label standing for ip under addr.<domain>: the hex
+// digits of its 4 or 16 bytes
+func encodeAddr(ip netip.Addr) string {
+	return hex.EncodeToString(ip.Unmap().AsSlice())
+}
+
+// decodeAddr parses a label written by encodeAddr
+func decodeAddr(label string) (netip.Addr, bool) {
+	b, err := hex.DecodeString(label)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return netip.AddrFromSlice(b)
+}
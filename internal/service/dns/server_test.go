@@ -0,0 +1,277 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// startServer serves the registry seeded with services on a loopback port
+// until the test ends, returning its address
+func startServer(t *testing.T, cfg Config, services ...*service.Service) string {
+	t.Helper()
+	repo := memory.NewRegistryRepository()
+	for _, svc := range services {
+		if err := repo.Register(context.Background(), svc); err != nil {
+			t.Fatalf("seed %s: %v", svc.ID, err)
+		}
+	}
+
+	cfg.Addr = "127.0.0.1:0"
+	srv := NewServer(registry.NewService(repo, registry.Config{}, logger.NewNop()), cfg, logger.NewNop())
+	if err := srv.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return srv.Addr()
+}
+
+// resolver is the Go resolver sending every query to addr
+func resolver(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// query sends one question over UDP and returns the unpacked response
+func query(t *testing.T, addr, name string, typ dnsmessage.Type) dnsmessage.Message {
+	t.Helper()
+	req := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(packed); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, maxUDPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		t.Fatalf("unpack: %v", err)
+	}
+	if resp.Header.ID != 42 || !resp.Header.Response {
+		t.Fatalf("expected the response to query 42, got %+v", resp.Header)
+	}
+	return resp
+}
+
+func instance(id, capability string, endpoints ...service.Endpoint) *service.Service {
+	return &service.Service{
+		ID:           id,
+		Name:         capability + "-service",
+		Endpoints:    endpoints,
+		Capabilities: []string{capability},
+		Status:       service.StatusHealthy,
+	}
+}
+
+func endpoint(url string, weight int) service.Endpoint {
+	return service.Endpoint{URL: url, Weight: weight, Healthy: true}
+}
+
+// seeded is a registry with payment instances on IP addresses and a host
+// name, some of which are unhealthy, and a draining search instance
+func seeded() []*service.Service {
+	unhealthy := instance("payment-3", "payment", endpoint("http://10.0.0.3:8080", 1))
+	unhealthy.Status = service.StatusUnhealthy
+	draining := instance("search-1", "search", endpoint("http://10.0.1.1:8080", 1))
+	draining.Status = service.StatusDraining
+	return []*service.Service{
+		instance("payment-1", "payment",
+			endpoint("http://10.0.0.1:8080", 3),
+			service.Endpoint{URL: "http://10.0.0.9:8080", Weight: 1, Healthy: false}),
+		instance("payment-2", "payment", endpoint("https://[fd00::2]", 1)),
+		instance("payment-4", "payment", endpoint("https://payment-4.internal:9443", 2)),
+		unhealthy,
+		draining,
+	}
+}
+
+func TestServer_SRV(t *testing.T) {
+	addr := startServer(t, Config{}, seeded()...)
+
+	_, records, err := resolver(addr).LookupSRV(context.Background(), "", "", "payment.service.root.")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	got := make([]string, 0, len(records))
+	for _, r := range records {
+		got = append(got, fmt.Sprintf("%s:%d priority %d weight %d", r.Target, r.Port, r.Priority, r.Weight))
+	}
+	slices.Sort(got)
+	want := []string{
+		"0a000001.addr.service.root.:8080 priority 1 weight 3",
+		"fd000000000000000000000000000002.addr.service.root.:443 priority 1 weight 1",
+		"payment-4.internal.:9443 priority 1 weight 2",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected the healthy endpoints\n%v\ngot\n%v", want, got)
+	}
+
+	resp := query(t, addr, "payment.service.root.", dnsmessage.TypeSRV)
+	if !resp.Header.Authoritative || resp.Header.RCode != dnsmessage.RCodeSuccess {
+		t.Errorf("expected an authoritative answer, got %+v", resp.Header)
+	}
+	var additionals []string
+	for _, r := range resp.Additionals {
+		switch body := r.Body.(type) {
+		case *dnsmessage.AResource:
+			additionals = append(additionals, r.Header.Name.String()+" "+netip.AddrFrom4(body.A).String())
+		case *dnsmessage.AAAAResource:
+			additionals = append(additionals, r.Header.Name.String()+" "+netip.AddrFrom16(body.AAAA).String())
+		}
+	}
+	slices.Sort(additionals)
+	wantAdditionals := []string{
+		"0a000001.addr.service.root. 10.0.0.1",
+		"fd000000000000000000000000000002.addr.service.root. fd00::2",
+	}
+	if !slices.Equal(additionals, wantAdditionals) {
+		t.Errorf("expected the addresses of the targets %v, got %v", wantAdditionals, additionals)
+	}
+	for _, r := range slices.Concat(resp.Answers, resp.Additionals) {
+		if r.Header.TTL != 5 {
+			t.Errorf("expected a ttl of 5 seconds, got %d on %s", r.Header.TTL, r.Header.Name)
+		}
+	}
+}
+
+func TestServer_Addresses(t *testing.T) {
+	addr := startServer(t, Config{}, seeded()...)
+	r := resolver(addr)
+
+	ips, err := r.LookupNetIP(context.Background(), "ip", "payment.service.root.")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	got := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		got = append(got, ip.String())
+	}
+	slices.Sort(got)
+	if want := []string{"10.0.0.1", "fd00::2"}; !slices.Equal(got, want) {
+		t.Errorf("expected the healthy IP endpoints %v, got %v", want, got)
+	}
+
+	// The names SRV records point at resolve to their address
+	ips, err = r.LookupNetIP(context.Background(), "ip4", "0a000001.addr.service.root.")
+	if err != nil || len(ips) != 1 || ips[0] != netip.MustParseAddr("10.0.0.1") {
+		t.Errorf("expected 10.0.0.1, got %v %v", ips, err)
+	}
+}
+
+func TestServer_NameErrors(t *testing.T) {
+	addr := startServer(t, Config{}, seeded()...)
+
+	tests := []struct {
+		name  string
+		query string
+		typ   dnsmessage.Type
+		want  dnsmessage.RCode
+	}{
+		{name: "unknown capability", query: "billing.service.root.", typ: dnsmessage.TypeSRV, want: dnsmessage.RCodeNameError},
+		{name: "draining instances only", query: "search.service.root.", typ: dnsmessage.TypeSRV, want: dnsmessage.RCodeNameError},
+		{name: "invalid address name", query: "zz.addr.service.root.", typ: dnsmessage.TypeA, want: dnsmessage.RCodeNameError},
+		{name: "outside the domain", query: "payment.example.com.", typ: dnsmessage.TypeSRV, want: dnsmessage.RCodeRefused},
+		{name: "other record type", query: "payment.service.root.", typ: dnsmessage.TypeTXT, want: dnsmessage.RCodeSuccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := query(t, addr, tt.query, tt.typ)
+			if resp.Header.RCode != tt.want || len(resp.Answers) != 0 {
+				t.Errorf("expected %v without answers, got %v with %d", tt.want, resp.Header.RCode, len(resp.Answers))
+			}
+		})
+	}
+
+	var dnsErr *net.DNSError
+	_, _, err := resolver(addr).LookupSRV(context.Background(), "", "", "billing.service.root.")
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("expected the resolver to report billing not found, got %v", err)
+	}
+}
+
+func TestServer_Config(t *testing.T) {
+	addr := startServer(t, Config{Domain: "Consul.", TTL: time.Minute},
+		instance("payment-1", "payment", endpoint("http://10.0.0.1:8080", 1)))
+
+	resp := query(t, addr, "payment.consul.", dnsmessage.TypeSRV)
+	if len(resp.Answers) != 1 || resp.Answers[0].Header.TTL != 60 {
+		t.Fatalf("expected one record cached for a minute, got %+v", resp.Answers)
+	}
+	if target := resp.Answers[0].Body.(*dnsmessage.SRVResource).Target.String(); target != "0a000001.addr.Consul." {
+		t.Errorf("expected a target under the configured domain, got %s", target)
+	}
+	if resp := query(t, addr, "payment.service.root.", dnsmessage.TypeSRV); resp.Header.RCode != dnsmessage.RCodeRefused {
+		t.Errorf("expected the default domain refused, got %v", resp.Header.RCode)
+	}
+}
+
+func TestServer_TruncatesLargeAnswers(t *testing.T) {
+	services := make([]*service.Service, 0, 100)
+	for i := range 100 {
+		services = append(services, instance(fmt.Sprintf("payment-%d", i), "payment",
+			endpoint(fmt.Sprintf("http://payment-%d.instances.example.internal:8080", i), 1)))
+	}
+	addr := startServer(t, Config{}, services...)
+
+	resp := query(t, addr, "payment.service.root.", dnsmessage.TypeSRV)
+	if !resp.Header.Truncated || len(resp.Answers) != 0 {
+		t.Fatalf("expected a truncated answer over UDP, got truncated %v with %d records", resp.Header.Truncated, len(resp.Answers))
+	}
+
+	// The Go resolver retries over TCP
+	_, records, err := resolver(addr).LookupSRV(context.Background(), "", "", "payment.service.root.")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(records) != 100 {
+		t.Errorf("expected 100 records over TCP, got %d", len(records))
+	}
+	for _, r := range records {
+		if !strings.HasSuffix(r.Target, ".instances.example.internal.") {
+			t.Errorf("expected the endpoint host as target, got %s", r.Target)
+		}
+	}
+}
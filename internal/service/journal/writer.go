@@ -0,0 +1,280 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// Defaults applied when the configuration leaves journal settings unset
+const (
+	defaultMaxBytes          = 10 << 20
+	defaultMaxFiles          = 5
+	defaultBufferSize        = 1000
+	defaultHeartbeatSampling = 10
+)
+
+// Config holds journal settings
+type Config struct {
+	// Path is the file entries are appended to; rotated files get ".1",
+	// ".2" and so on appended, ".1" being the most recent
+	Path     string
+	MaxBytes int64 // size a file may grow to before it is rotated
+	MaxFiles int   // rotated files kept besides the one being written
+	// BufferSize is how many entries may wait to be written before new ones
+	// are dropped
+	BufferSize int
+	// HeartbeatSampling records one heartbeat in every HeartbeatSampling;
+	// 1 records them all
+	HeartbeatSampling int
+	// RequestID returns the ID of the request a context belongs to; nil
+	// leaves request IDs out
+	RequestID func(ctx context.Context) string
+}
+
+// Stats counts entries since the writer was created
+type Stats struct {
+	Queued    int    `json:"queued"`
+	Capacity  int    `json:"capacity"`
+	Written   uint64 `json:"written"`
+	Dropped   uint64 `json:"dropped"` // not queued because the buffer was full
+	Failed    uint64 `json:"failed"`  // queued but not written because of a file error
+	Rotations uint64 `json:"rotations"`
+}
+
+// Writer appends journal entries to a size-rotated file. It implements
+// journal.Recorder: entries are queued and written by the goroutine Start
+// runs, so recording never waits on the disk.
+type Writer struct {
+	config Config
+	logger logger.ILogger
+	queue  chan journal.Entry
+
+	file *os.File // owned by Start once it runs
+	size int64
+
+	heartbeats atomic.Uint64
+	written    atomic.Uint64
+	dropped    atomic.Uint64
+	failed     atomic.Uint64
+	rotations  atomic.Uint64
+}
+
+// NewWriter opens the journal file, creating it and its directory when
+// missing, and returns a writer appending to it
+func NewWriter(cfg Config, log logger.ILogger) (*Writer, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("journal path is required")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaultMaxFiles
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.HeartbeatSampling <= 0 {
+		cfg.HeartbeatSampling = defaultHeartbeatSampling
+	}
+
+	w := &Writer{
+		config: cfg,
+		logger: log,
+		queue:  make(chan journal.Entry, cfg.BufferSize),
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("create journal directory: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Record queues the entry, adding the caller's token subject and request ID
+// from ctx. It never blocks: when the buffer is full the entry is dropped
+// and counted. Only every HeartbeatSampling-th heartbeat is kept.
+func (w *Writer) Record(ctx context.Context, e journal.Entry) {
+	if e.Op == journal.OpHeartbeat && (w.heartbeats.Add(1)-1)%uint64(w.config.HeartbeatSampling) != 0 {
+		return
+	}
+	if claims, ok := token.FromContext(ctx); ok && e.Actor == "" {
+		e.Actor = claims.Subject
+	}
+	if w.config.RequestID != nil && e.RequestID == "" {
+		e.RequestID = w.config.RequestID(ctx)
+	}
+
+	select {
+	case w.queue <- e:
+	default:
+		if w.dropped.Add(1) == 1 {
+			w.logger.Warn("journal buffer full, entries are being dropped", "service_id", e.ServiceID, "op", e.Op)
+		}
+	}
+}
+
+// Start writes queued entries until ctx is cancelled, then writes what is
+// still queued and closes the file
+func (w *Writer) Start(ctx context.Context) {
+	buf := bufio.NewWriter(w.file)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-w.queue:
+					buf = w.write(buf, e)
+				default:
+					w.flush(buf)
+					w.close()
+					if dropped := w.dropped.Load(); dropped > 0 {
+						w.logger.Warn("journal entries were dropped", "dropped", dropped)
+					}
+					return
+				}
+			}
+		case e := <-w.queue:
+			buf = w.write(buf, e)
+			if len(w.queue) == 0 {
+				w.flush(buf)
+			}
+		}
+	}
+}
+
+// write encodes one entry into buf, rotating the file first when the entry
+// would take it past MaxBytes. It returns the buffer to keep writing to.
+func (w *Writer) write(buf *bufio.Writer, e journal.Entry) *bufio.Writer {
+	line, err := json.Marshal(e)
+	if err != nil {
+		w.failed.Add(1)
+		w.logger.Error("encode journal entry failed", "service_id", e.ServiceID, "op", e.Op, "error", err)
+		return buf
+	}
+	line = append(line, '\n')
+
+	if w.file == nil {
+		// A failed rotation left no file open; try again before giving up
+		if err := w.open(); err != nil {
+			w.failed.Add(1)
+			return buf
+		}
+		buf = bufio.NewWriter(w.file)
+	}
+	if w.size > 0 && w.size+int64(len(line)) > w.config.MaxBytes {
+		w.flush(buf)
+		if err := w.rotate(); err != nil {
+			w.logger.Error("rotate journal failed", "path", w.config.Path, "error", err)
+			if w.file == nil {
+				w.failed.Add(1)
+				return buf
+			}
+		}
+		buf = bufio.NewWriter(w.file)
+	}
+
+	if _, err := buf.Write(line); err != nil {
+		w.failed.Add(1)
+		w.logger.Error("write journal entry failed", "path", w.config.Path, "error", err)
+		return buf
+	}
+	w.size += int64(len(line))
+	w.written.Add(1)
+	return buf
+}
+
+// flush writes buffered entries to the file
+func (w *Writer) flush(buf *bufio.Writer) {
+	if err := buf.Flush(); err != nil {
+		w.logger.Error("flush journal failed", "path", w.config.Path, "error", err)
+	}
+}
+
+// rotate closes the current file, shifts it and the rotated ones up by one
+// and opens a new file. When shifting fails the current file is reopened, so
+// entries keep being written to it.
+func (w *Writer) rotate() error {
+	w.close()
+	err := w.shift()
+	if err == nil {
+		w.rotations.Add(1)
+	}
+	if openErr := w.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// shift renames the journal to ".1" and every rotated file to the next
+// number, removing the oldest beyond MaxFiles
+func (w *Writer) shift() error {
+	oldest := rotatedPath(w.config.Path, w.config.MaxFiles)
+	if err := os.Remove(oldest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove %s: %w", oldest, err)
+	}
+	for n := w.config.MaxFiles - 1; n >= 1; n-- {
+		err := os.Rename(rotatedPath(w.config.Path, n), rotatedPath(w.config.Path, n+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotate %s: %w", rotatedPath(w.config.Path, n), err)
+		}
+	}
+	if err := os.Rename(w.config.Path, rotatedPath(w.config.Path, 1)); err != nil {
+		return fmt.Errorf("rotate %s: %w", w.config.Path, err)
+	}
+	return nil
+}
+
+// open opens the journal file for appending
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat journal: %w", err)
+	}
+	w.file, w.size = file, info.Size()
+	return nil
+}
+
+// close closes the current file, if any
+func (w *Writer) close() {
+	if w.file == nil {
+		return
+	}
+	if err := w.file.Close(); err != nil {
+		w.logger.Error("close journal failed", "path", w.config.Path, "error", err)
+	}
+	w.file = nil
+}
+
+// Stats reports the writer's counters
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Queued:    len(w.queue),
+		Capacity:  cap(w.queue),
+		Written:   w.written.Load(),
+		Dropped:   w.dropped.Load(),
+		Failed:    w.failed.Load(),
+		Rotations: w.rotations.Load(),
+	}
+}
+
+// rotatedPath returns the path of the n-th most recent rotated file
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
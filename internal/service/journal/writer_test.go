@@ -0,0 +1,178 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// readEntries decodes every line of a journal file
+func readEntries(t *testing.T, path string) []journal.Entry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var entries []journal.Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e journal.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decode %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// run starts the writer and returns a function stopping it and waiting for
+// it to close the file
+func run(w *Writer) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Start(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestWriter_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal", "registry.log")
+	w, err := NewWriter(Config{
+		Path:      path,
+		RequestID: func(context.Context) string { return "req-1" },
+	}, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	stop := run(w)
+
+	ctx := token.NewContext(context.Background(), &token.Claims{Subject: "ops"})
+	w.Record(ctx, journal.Entry{
+		Time:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Op:          journal.OpRegister,
+		ServiceID:   "payment-1",
+		AfterStatus: service.StatusUnknown,
+		Service:     &service.Service{ID: "payment-1", Name: "payment"},
+	})
+	w.Record(context.Background(), journal.Entry{Op: journal.OpHealth, ServiceID: "payment-1", RequestID: "check-1"})
+	stop()
+
+	entries := readEntries(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if e := entries[0]; e.Actor != "ops" || e.RequestID != "req-1" || e.Service == nil || e.Service.Name != "payment" {
+		t.Errorf("unexpected first entry %+v", e)
+	}
+	if e := entries[1]; e.Actor != "" || e.RequestID != "check-1" {
+		t.Errorf("expected the entry's own request ID and no actor, got %+v", e)
+	}
+	if stats := w.Stats(); stats.Written != 2 || stats.Dropped != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestWriter_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.log")
+	line, _ := json.Marshal(journal.Entry{Op: journal.OpDeregister, ServiceID: "svc-00"})
+	w, err := NewWriter(Config{
+		Path:       path,
+		MaxBytes:   int64(len(line)+1) * 2, // two entries per file
+		MaxFiles:   2,
+		BufferSize: 100,
+	}, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	stop := run(w)
+	for i := range 9 {
+		w.Record(context.Background(), journal.Entry{Op: journal.OpDeregister, ServiceID: fmt.Sprintf("svc-%02d", i)})
+	}
+	stop()
+
+	ids := func(path string) []string {
+		var ids []string
+		for _, e := range readEntries(t, path) {
+			ids = append(ids, e.ServiceID)
+		}
+		return ids
+	}
+	// svc-00 to svc-03 were rotated past the two kept files
+	if got := ids(path); !slices.Equal(got, []string{"svc-08"}) {
+		t.Errorf("expected the current file to hold svc-08, got %v", got)
+	}
+	if got := ids(rotatedPath(path, 1)); !slices.Equal(got, []string{"svc-06", "svc-07"}) {
+		t.Errorf("expected .1 to hold svc-06 and svc-07, got %v", got)
+	}
+	if got := ids(rotatedPath(path, 2)); !slices.Equal(got, []string{"svc-04", "svc-05"}) {
+		t.Errorf("expected .2 to hold svc-04 and svc-05, got %v", got)
+	}
+	if _, err := os.Stat(rotatedPath(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("expected no file beyond max files, got %v", err)
+	}
+	if stats := w.Stats(); stats.Written != 9 || stats.Rotations != 4 {
+		t.Errorf("expected 9 written and 4 rotations, got %+v", stats)
+	}
+}
+
+func TestWriter_Overflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.log")
+	w, err := NewWriter(Config{Path: path, BufferSize: 2}, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+
+	// Nothing writes yet, so entries beyond the buffer are dropped
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		w.Record(context.Background(), journal.Entry{Op: journal.OpDeregister, ServiceID: id})
+	}
+	if stats := w.Stats(); stats.Queued != 2 || stats.Capacity != 2 || stats.Dropped != 3 {
+		t.Errorf("expected 2 queued and 3 dropped, got %+v", stats)
+	}
+
+	run(w)()
+	var got []string
+	for _, e := range readEntries(t, path) {
+		got = append(got, e.ServiceID)
+	}
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("expected the queued entries to be written on stop, got %v", got)
+	}
+	if stats := w.Stats(); stats.Written != 2 || stats.Dropped != 3 {
+		t.Errorf("unexpected stats after stop %+v", stats)
+	}
+}
+
+func TestWriter_HeartbeatSampling(t *testing.T) {
+	w, err := NewWriter(Config{Path: filepath.Join(t.TempDir(), "registry.log"), BufferSize: 100, HeartbeatSampling: 3}, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for range 7 {
+		w.Record(context.Background(), journal.Entry{Op: journal.OpHeartbeat, ServiceID: "payment-1"})
+	}
+	w.Record(context.Background(), journal.Entry{Op: journal.OpDeregister, ServiceID: "payment-1"})
+
+	// Heartbeats 1, 4 and 7 and the deregistration
+	if queued := w.Stats().Queued; queued != 4 {
+		t.Errorf("expected 4 queued entries, got %d", queued)
+	}
+}
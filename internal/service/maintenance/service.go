@@ -0,0 +1,217 @@
+// Package maintenance keeps the server read-only for a while, e.g. during a
+// storage migration, remembering the mode across restarts
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// The config repository service ID and version the state is stored under.
+// The colon keeps the namespace apart from every valid service ID.
+const (
+	stateNamespace = "root:maintenance"
+	stateVersion   = "state"
+)
+
+// Defaults applied when the configuration leaves settings unset
+const defaultRefreshInterval = 5 * time.Second
+
+// MaxMessageLength caps the operator message returned to rejected clients
+const MaxMessageLength = 512
+
+// Config holds maintenance mode settings
+type Config struct {
+	// RefreshInterval is how often the stored state is read again, so a
+	// change made through another server sharing the storage applies here
+	// too; zero uses 5 seconds
+	RefreshInterval time.Duration
+	Clock           clock.Clock // nil uses the system clock
+}
+
+// State is the maintenance mode of the server
+type State struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"` // returned to the clients whose writes are rejected
+	// Until is when the mode clears by itself
+	Until time.Time `json:"until,omitzero"`
+	// Since is when the mode was enabled
+	Since time.Time `json:"since,omitzero"`
+}
+
+// Service holds the maintenance mode. It implements
+// middleware.MaintenanceMode with a single atomic load, so the mode may be
+// checked on every request.
+type Service struct {
+	store  config.ConfigRepository
+	config Config
+	logger logger.ILogger
+
+	mu    sync.Mutex // serializes Set and refresh, so the state stored and held agree
+	state atomic.Pointer[State]
+}
+
+// NewService creates the service with the state stored in store, which is
+// kept in memory only when store is the memory repository
+func NewService(store config.ConfigRepository, cfg Config, log logger.ILogger) (*Service, error) {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+
+	s := &Service{store: store, config: cfg, logger: log}
+	s.state.Store(&State{})
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	if state, ok := s.active(); ok {
+		s.logger.Warn("maintenance mode restored", "until", state.Until, "message", state.Message)
+	}
+	return s, nil
+}
+
+// Current returns the maintenance mode, disabled once its Until has passed
+func (s *Service) Current() State {
+	state, _ := s.active()
+	return state
+}
+
+// Maintenance returns the operator's message and when the mode clears, and
+// whether it is enabled
+func (s *Service) Maintenance() (message string, until time.Time, ok bool) {
+	state, ok := s.active()
+	return state.Message, state.Until, ok
+}
+
+// active returns the maintenance mode and whether it is enabled. A mode
+// whose Until has passed is cleared.
+func (s *Service) active() (State, bool) {
+	current := s.state.Load()
+	if !current.Enabled {
+		return *current, false
+	}
+	if s.config.Clock.Now().Before(current.Until) {
+		return *current, true
+	}
+	if s.state.CompareAndSwap(current, &State{}) {
+		s.logger.Info("maintenance mode expired", "until", current.Until)
+	}
+	return State{}, false
+}
+
+// Set enables the maintenance mode until the given time, which must be in
+// the future, or disables it. Invalid requests fail with validation.Errors.
+func (s *Service) Set(enabled bool, message string, until time.Time) (State, error) {
+	now := s.config.Clock.Now()
+	state := State{}
+	if enabled {
+		var errs validation.Errors
+		if until.IsZero() {
+			errs.Add("until", "is required to enable maintenance mode")
+		} else if !until.After(now) {
+			errs.Add("until", "must be in the future")
+		}
+		if len(message) > MaxMessageLength {
+			errs.Add("message", fmt.Sprintf("must be at most %d characters", MaxMessageLength))
+		}
+		if err := errs.Err(); err != nil {
+			return State{}, err
+		}
+		state = State{Enabled: true, Message: message, Until: until.UTC(), Since: now.UTC()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.store.Set(stateNamespace, stateVersion, stateFields(state)); err != nil {
+		return State{}, fmt.Errorf("store maintenance mode: %w", err)
+	}
+	s.state.Store(&state)
+
+	if enabled {
+		s.logger.Warn("maintenance mode enabled", "until", state.Until, "message", message)
+	} else {
+		s.logger.Info("maintenance mode disabled")
+	}
+	return state, nil
+}
+
+// Start reads the stored state every Config.RefreshInterval until ctx is done
+func (s *Service) Start(ctx context.Context) {
+	ticker := s.config.Clock.NewTicker(s.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := s.refresh(); err != nil {
+				s.logger.Error("refresh maintenance mode failed", "error", err)
+			}
+		}
+	}
+}
+
+// refresh replaces the state held with the stored one; nothing stored, or
+// a mode whose Until has passed, leaves it disabled
+func (s *Service) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fields, err := s.store.Get(stateNamespace, stateVersion)
+	if errors.Is(err, repository.ErrNotFound) {
+		s.state.Store(&State{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get maintenance mode: %w", err)
+	}
+	state, err := parseState(fields)
+	if err != nil {
+		return fmt.Errorf("decode maintenance mode: %w", err)
+	}
+	if !s.config.Clock.Now().Before(state.Until) {
+		state = State{}
+	}
+	s.state.Store(&state)
+	return nil
+}
+
+// stateFields converts a state into the generic form the config repository stores
+func stateFields(state State) map[string]any {
+	return map[string]any{
+		"enabled": state.Enabled,
+		"message": state.Message,
+		"until":   state.Until.Format(time.RFC3339Nano),
+		"since":   state.Since.Format(time.RFC3339Nano),
+	}
+}
+
+// parseState reverses stateFields
+func parseState(fields map[string]any) (State, error) {
+	var state State
+	state.Enabled, _ = fields["enabled"].(bool)
+	state.Message, _ = fields["message"].(string)
+	for key, t := range map[string]*time.Time{"until": &state.Until, "since": &state.Since} {
+		raw, _ := fields[key].(string)
+		parsed, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return State{}, fmt.Errorf("%s: %w", key, err)
+		}
+		*t = parsed
+	}
+	if !state.Enabled {
+		return State{}, nil
+	}
+	return state, nil
+}
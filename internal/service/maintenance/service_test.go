@@ -0,0 +1,133 @@
+package maintenance
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func newTestService(t *testing.T, store *memory.ConfigRepository, c clock.Clock) *Service {
+	t.Helper()
+	s, err := NewService(store, Config{Clock: c}, logger.NewNop())
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	return s
+}
+
+func TestService_Expiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	s := newTestService(t, memory.NewConfigRepository(), fake)
+
+	if _, _, ok := s.Maintenance(); ok {
+		t.Fatal("expected maintenance mode off by default")
+	}
+
+	until := fake.Now().Add(time.Minute)
+	state, err := s.Set(true, "migrating storage", until)
+	if err != nil || !state.Enabled || !state.Since.Equal(fake.Now()) {
+		t.Fatalf("expected maintenance mode enabled, got %+v, %v", state, err)
+	}
+	if message, got, ok := s.Maintenance(); !ok || message != "migrating storage" || !got.Equal(until) {
+		t.Errorf("expected the mode with its message and until, got %q, %v, %v", message, got, ok)
+	}
+
+	fake.Advance(59 * time.Second)
+	if _, _, ok := s.Maintenance(); !ok {
+		t.Error("expected the mode still on before until")
+	}
+	fake.Advance(time.Second)
+	if _, _, ok := s.Maintenance(); ok {
+		t.Error("expected the mode cleared once until passed")
+	}
+	if state := s.Current(); state.Enabled {
+		t.Errorf("expected the mode reported off, got %+v", state)
+	}
+}
+
+func TestService_SetValidates(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	s := newTestService(t, memory.NewConfigRepository(), fake)
+
+	for _, until := range []time.Time{{}, fake.Now()} {
+		var errs validation.Errors
+		if _, err := s.Set(true, "", until); !errors.As(err, &errs) || errs[0].Field != "until" {
+			t.Errorf("until %v: expected an invalid until, got %v", until, err)
+		}
+	}
+	if _, _, ok := s.Maintenance(); ok {
+		t.Error("expected invalid requests to leave the mode off")
+	}
+	if state, err := s.Set(false, "", time.Time{}); err != nil || state.Enabled {
+		t.Errorf("expected disabling to need no until, got %+v, %v", state, err)
+	}
+}
+
+func TestService_Persistence(t *testing.T) {
+	store := memory.NewConfigRepository()
+	fake := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	until := fake.Now().Add(time.Hour)
+	if _, err := newTestService(t, store, fake).Set(true, "migrating storage", until); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	restarted := newTestService(t, store, fake)
+	if message, got, ok := restarted.Maintenance(); !ok || message != "migrating storage" || !got.Equal(until) {
+		t.Errorf("expected the mode restored, got %q, %v, %v", message, got, ok)
+	}
+
+	t.Run("changes stored by another server are refreshed", func(t *testing.T) {
+		if _, err := newTestService(t, store, fake).Set(false, "", time.Time{}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		if err := restarted.refresh(); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		if _, _, ok := restarted.Maintenance(); ok {
+			t.Error("expected the mode disabled elsewhere to clear")
+		}
+	})
+
+	t.Run("expired mode is not restored", func(t *testing.T) {
+		newTestService(t, store, fake).Set(true, "", fake.Now().Add(time.Minute))
+		fake.Advance(time.Minute)
+		if _, _, ok := newTestService(t, store, fake).Maintenance(); ok {
+			t.Error("expected the expired mode left off")
+		}
+	})
+}
+
+func TestService_ConcurrentSet(t *testing.T) {
+	store := memory.NewConfigRepository()
+	fake := clock.NewFake(time.Now())
+	s := newTestService(t, store, fake)
+	until := fake.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Set(i%2 == 0, "", until); err != nil {
+				t.Errorf("set: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.Maintenance()
+			s.refresh()
+		}()
+	}
+	wg.Wait()
+
+	_, _, held := s.Maintenance()
+	if _, _, stored := newTestService(t, store, fake).Maintenance(); held != stored {
+		t.Errorf("expected the mode held to match the stored one, got %v and %v", held, stored)
+	}
+}
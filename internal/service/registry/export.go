@@ -0,0 +1,275 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// ExportSchemaVersion is the schema version of documents written by Export
+// and the only one Import accepts
+const ExportSchemaVersion = 1
+
+// Export is a snapshot of every registered service
+type Export struct {
+	SchemaVersion int                `json:"schema_version"`
+	ExportedAt    time.Time          `json:"exported_at"`
+	Services      []*service.Service `json:"services"`
+}
+
+// ImportMode decides what happens to imported services whose ID is already registered
+type ImportMode string
+
+const (
+	// ImportMerge keeps the registered service and skips the imported one
+	ImportMerge ImportMode = "merge"
+	// ImportReplace overwrites the registered service with the imported one
+	ImportReplace ImportMode = "replace"
+)
+
+// Outcomes of importing a single service
+const (
+	ImportCreated  = "created"
+	ImportReplaced = "replaced"
+	ImportSkipped  = "skipped"
+	ImportInvalid  = "invalid"
+	ImportFailed   = "failed"
+)
+
+// ImportResult reports the outcome for one service of an import
+type ImportResult struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+
+	stored *service.Service // as created or replaced, for the journal
+}
+
+// ImportReport lists the outcome for every service of an import, in document order
+type ImportReport struct {
+	Mode ImportMode `json:"mode"`
+	// Atomic is set when the import ran as one transaction, so it either
+	// stored every valid service or, with ErrImportRolledBack, none
+	Atomic  bool           `json:"atomic"`
+	Results []ImportResult `json:"results"`
+}
+
+// stored reports whether the import created or replaced any service
+func (r *ImportReport) stored() bool {
+	return slices.ContainsFunc(r.Results, func(result ImportResult) bool {
+		return result.Result == ImportCreated || result.Result == ImportReplaced
+	})
+}
+
+// Export returns every service registered within the caller's tenant ordered by ID
+func (s *Service) Export(ctx context.Context) (*Export, error) {
+	services, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("export services: %w", err)
+	}
+	services = visible(ctx, services)
+	slices.SortFunc(services, service.CompareBy(service.SortByID))
+
+	return &Export{
+		SchemaVersion: ExportSchemaVersion,
+		ExportedAt:    s.config.Clock.Now().UTC(),
+		Services:      services,
+	}, nil
+}
+
+// Import registers the services of an export. The document as a whole must
+// have a supported schema version, a known mode and unique IDs, or nothing is
+// imported and validation.Errors is returned. Services that fail validation
+// are reported and skipped. Imported services start with status unknown and
+// no heartbeat so health checks re-evaluate them; operator overrides are kept.
+// Callers confined to a tenant import into that tenant and cannot replace
+// services of other tenants; unrestricted callers keep each service's tenant.
+// When the repository supports transactions a storage error rolls the whole
+// import back and ErrImportRolledBack is returned; otherwise the failed
+// service is reported and the import carries on.
+func (s *Service) Import(ctx context.Context, doc *Export, mode ImportMode) (*ImportReport, error) {
+	if err := validateImport(doc, mode); err != nil {
+		return nil, err
+	}
+
+	tx, atomic := s.repo.(repository.Transactor)
+	if !atomic {
+		report, _ := s.importServices(ctx, doc.Services, mode, false)
+		if report.stored() {
+			s.changed(ctx)
+		}
+		s.recordImport(ctx, report)
+		s.logger.Info("registry imported", "mode", mode, "services", len(doc.Services), "atomic", false)
+		return report, nil
+	}
+
+	var report *ImportReport
+	err := tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		report, err = s.importServices(ctx, doc.Services, mode, true)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrImportRolledBack, err)
+	}
+	if report.stored() {
+		s.changed(ctx)
+	}
+	s.recordImport(ctx, report)
+
+	s.logger.Info("registry imported", "mode", mode, "services", len(doc.Services), "atomic", true)
+	return report, nil
+}
+
+// importServices imports each service in turn. Atomic imports stop at the
+// first storage error and return it so the transaction is rolled back;
+// otherwise failures are only reported.
+func (s *Service) importServices(ctx context.Context, services []*service.Service, mode ImportMode, atomic bool) (*ImportReport, error) {
+	report := &ImportReport{Mode: mode, Atomic: atomic, Results: make([]ImportResult, 0, len(services))}
+	for _, svc := range services {
+		result := ImportResult{ID: svc.ID}
+		err := s.importService(ctx, svc, mode, &result)
+		report.Results = append(report.Results, result)
+		if err == nil {
+			continue
+		}
+		s.logger.Error("import service failed", "service_id", svc.ID, "error", err)
+		if atomic {
+			return nil, fmt.Errorf("import service %s: %w", svc.ID, err)
+		}
+	}
+	return report, nil
+}
+
+// importService stores one imported service and records the outcome in result.
+// It returns storage errors for logging.
+func (s *Service) importService(ctx context.Context, in *service.Service, mode ImportMode, result *ImportResult) error {
+	req := RegisterRequest{
+		ID:                   in.ID,
+		Name:                 in.Name,
+		InstanceID:           in.InstanceID,
+		Version:              in.Version,
+		Endpoints:            in.Endpoints,
+		Capabilities:         in.Capabilities,
+		DependsOn:            in.DependsOn,
+		Metadata:             in.Metadata,
+		HealthCheckURL:       in.HealthCheckURL,
+		HealthCheck:          in.HealthCheck,
+		CheckIntervalSeconds: in.CheckIntervalSeconds,
+	}
+	if err := req.Validate(); err != nil {
+		result.Result, result.Error = ImportInvalid, err.Error()
+		return nil
+	}
+	if err := s.validateTargets(ctx, req); err != nil {
+		result.Result, result.Error = ImportInvalid, err.Error()
+		return nil
+	}
+	if err := s.validateCheckInterval(req); err != nil {
+		result.Result, result.Error = ImportInvalid, err.Error()
+		return nil
+	}
+	if err := s.validateMetadata(req); err != nil {
+		var invalid validation.Errors
+		if !errors.As(err, &invalid) {
+			result.Result, result.Error = ImportFailed, "failed to check metadata"
+			return err
+		}
+		result.Result, result.Error = ImportInvalid, err.Error()
+		return nil
+	}
+
+	scope := tenant.FromContext(ctx)
+	svc := *in
+	if !scope.All {
+		svc.TenantID = scope.ID
+	}
+	svc.Endpoints = newEndpoints(in.Endpoints)
+	svc.HealthCheck = req.healthCheck()
+	svc.HealthCheckURL = healthCheckURL(svc.HealthCheck)
+	svc.Status = service.StatusUnknown
+	svc.LastHeartbeat = time.Time{}
+	svc.DeletedAt = time.Time{}
+	if svc.OverrideStatus {
+		svc.Status = service.StatusDraining
+	}
+	if svc.RegisteredAt.IsZero() {
+		svc.RegisteredAt = s.config.Clock.Now()
+	}
+
+	existing, err := s.repo.CreateIfAbsent(ctx, &svc)
+	if err != nil {
+		result.Result, result.Error = ImportFailed, "failed to store service"
+		return err
+	}
+	switch {
+	case existing == nil:
+		result.Result = ImportCreated
+	case existing.IsDeleted() && scope.Allows(existing.TenantID):
+		// A deregistered service is replaced as if it were absent
+		if err := s.repo.Register(ctx, &svc); err != nil {
+			result.Result, result.Error = ImportFailed, "failed to store service"
+			return err
+		}
+		result.Result = ImportCreated
+	case mode == ImportMerge:
+		result.Result = ImportSkipped
+		return nil
+	case !scope.Allows(existing.TenantID):
+		result.Result, result.Error = ImportSkipped, "id is already registered"
+		return nil
+	default:
+		if err := s.repo.Register(ctx, &svc); err != nil {
+			result.Result, result.Error = ImportFailed, "failed to store service"
+			return err
+		}
+		result.Result = ImportReplaced
+	}
+	result.stored = &svc
+	return nil
+}
+
+// recordImport journals the services an import created or replaced. It runs
+// once the import is over, so services of a rolled back import are never
+// journaled.
+func (s *Service) recordImport(ctx context.Context, report *ImportReport) {
+	for _, result := range report.Results {
+		if result.stored != nil {
+			s.record(ctx, journal.Entry{Op: journal.OpImport, ServiceID: result.ID, AfterStatus: result.stored.Status, Service: result.stored})
+		}
+	}
+}
+
+// validateImport checks the parts of an import that apply to the whole document
+func validateImport(doc *Export, mode ImportMode) error {
+	var errs validation.Errors
+
+	if mode != ImportMerge && mode != ImportReplace {
+		errs.Add("mode", fmt.Sprintf("must be %q or %q", ImportMerge, ImportReplace))
+	}
+	if doc.SchemaVersion != ExportSchemaVersion {
+		errs.Add("schema_version", fmt.Sprintf("unsupported version %d, expected %d", doc.SchemaVersion, ExportSchemaVersion))
+	}
+
+	seen := make(map[string]bool, len(doc.Services))
+	for i, svc := range doc.Services {
+		if svc == nil {
+			errs.Add(fmt.Sprintf("services[%d]", i), "must be an object")
+			continue
+		}
+		if seen[svc.ID] {
+			errs.Add(fmt.Sprintf("services[%d].id", i), fmt.Sprintf("duplicate id %q", svc.ID))
+		}
+		seen[svc.ID] = true
+	}
+
+	return errs.Err()
+}
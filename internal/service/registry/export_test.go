@@ -0,0 +1,237 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func TestService_ExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+
+	for _, req := range []RegisterRequest{
+		{ID: "search-1", Name: "search", Endpoints: []service.Endpoint{{URL: "http://search-1:8080"}}, Capabilities: []string{"search"}},
+		{ID: "payment-1", Name: "payment", Version: "2.1.0", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}, Metadata: map[string]string{"region": "eu"}, HealthCheckURL: "http://payment-1:8080/health"},
+	} {
+		if _, _, err := source.Register(ctx, req); err != nil {
+			t.Fatalf("register %s: %v", req.ID, err)
+		}
+	}
+	source.SetStatus(ctx, "search-1", service.StatusDraining)
+
+	doc, err := source.Export(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if doc.SchemaVersion != ExportSchemaVersion || len(doc.Services) != 2 || doc.Services[0].ID != "payment-1" {
+		t.Fatalf("expected 2 services ordered by ID, got %+v", doc)
+	}
+
+	repo := memory.NewRegistryRepository()
+	target := NewService(repo, Config{}, logger.NewNop())
+	report, err := target.Import(ctx, doc, ImportMerge)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, result := range report.Results {
+		if result.Result != ImportCreated {
+			t.Errorf("expected %s created, got %+v", result.ID, result)
+		}
+	}
+
+	payment, _ := repo.Get(ctx, "payment-1")
+	original, _ := source.Get(ctx, "payment-1")
+	if payment.Version != "2.1.0" || payment.Metadata["region"] != "eu" || payment.HealthCheckURL != original.HealthCheckURL {
+		t.Errorf("expected fields to survive the round trip, got %+v", payment)
+	}
+	if !payment.RegisteredAt.Equal(original.RegisteredAt) {
+		t.Errorf("expected registered_at %v, got %v", original.RegisteredAt, payment.RegisteredAt)
+	}
+	if payment.Status != service.StatusUnknown || !payment.LastHeartbeat.IsZero() {
+		t.Errorf("expected unknown status and no heartbeat, got %s at %v", payment.Status, payment.LastHeartbeat)
+	}
+
+	search, _ := repo.Get(ctx, "search-1")
+	if search.Status != service.StatusDraining || !search.OverrideStatus {
+		t.Errorf("expected the draining override to be kept, got %s (override %v)", search.Status, search.OverrideStatus)
+	}
+}
+
+func TestService_ImportModes(t *testing.T) {
+	ctx := context.Background()
+
+	doc := &Export{SchemaVersion: ExportSchemaVersion, Services: []*service.Service{
+		{ID: "payment-1", Name: "payment", Version: "2.0.0", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}},
+		{ID: "search-1", Name: "search", Endpoints: []service.Endpoint{{URL: "http://search-1:8080"}}},
+		{ID: "bad id", Name: "bad", Endpoints: []service.Endpoint{{URL: "http://bad:8080"}}},
+	}}
+
+	tests := []struct {
+		mode        ImportMode
+		want        []string
+		wantVersion string
+	}{
+		{mode: ImportMerge, want: []string{ImportSkipped, ImportCreated, ImportInvalid}, wantVersion: "1.0.0"},
+		{mode: ImportReplace, want: []string{ImportReplaced, ImportCreated, ImportInvalid}, wantVersion: "2.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			repo := memory.NewRegistryRepository()
+			svc := NewService(repo, Config{}, logger.NewNop())
+			svc.Register(ctx, RegisterRequest{ID: "payment-1", Name: "payment", Version: "1.0.0", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}})
+
+			report, err := svc.Import(ctx, doc, tt.mode)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			got := make([]string, len(report.Results))
+			for i, result := range report.Results {
+				got[i] = result.Result
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected results %v, got %v", tt.want, got)
+			}
+			if report.Results[2].Error == "" {
+				t.Error("expected the invalid service to carry its validation error")
+			}
+
+			payment, _ := repo.Get(ctx, "payment-1")
+			if payment.Version != tt.wantVersion {
+				t.Errorf("expected version %s, got %s", tt.wantVersion, payment.Version)
+			}
+			if _, err := repo.Get(ctx, "bad id"); err == nil {
+				t.Error("expected the invalid service not to be stored")
+			}
+		})
+	}
+}
+
+func TestService_ImportRejectsDocument(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	valid := &service.Service{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}, RegisteredAt: time.Now()}
+
+	tests := []struct {
+		name      string
+		doc       *Export
+		mode      ImportMode
+		wantField string
+	}{
+		{name: "unsupported schema version", doc: &Export{SchemaVersion: 2, Services: []*service.Service{valid}}, mode: ImportMerge, wantField: "schema_version"},
+		{name: "missing schema version", doc: &Export{Services: []*service.Service{valid}}, mode: ImportMerge, wantField: "schema_version"},
+		{name: "unknown mode", doc: &Export{SchemaVersion: ExportSchemaVersion}, mode: "overwrite", wantField: "mode"},
+		{name: "duplicate ids", doc: &Export{SchemaVersion: ExportSchemaVersion, Services: []*service.Service{valid, valid}}, mode: ImportMerge, wantField: "services[1].id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Import(context.Background(), tt.doc, tt.mode)
+
+			var errs validation.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			if len(errs) != 1 || errs[0].Field != tt.wantField {
+				t.Errorf("expected invalid field %s, got %v", tt.wantField, errs)
+			}
+		})
+	}
+
+	if services, _ := svc.List(context.Background()); len(services) != 0 {
+		t.Errorf("expected rejected documents to import nothing, got %d services", len(services))
+	}
+}
+
+// flakyRepository fails to store the service with the given ID. Embedding the
+// interface hides the memory repository's WithinTx.
+type flakyRepository struct {
+	service.RegistryRepository
+	failID string
+}
+
+func (r flakyRepository) CreateIfAbsent(ctx context.Context, svc *service.Service) (*service.Service, error) {
+	if svc.ID == r.failID {
+		return nil, errStorage
+	}
+	return r.RegistryRepository.CreateIfAbsent(ctx, svc)
+}
+
+// transactionalFlakyRepository is a flakyRepository that supports transactions
+type transactionalFlakyRepository struct {
+	flakyRepository
+	repository.Transactor
+}
+
+func TestService_ImportStorageFailure(t *testing.T) {
+	ctx := context.Background()
+	doc := &Export{SchemaVersion: ExportSchemaVersion, Services: []*service.Service{
+		{ID: "payment-1", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-1:8080"}}},
+		{ID: "search-1", Name: "search", Endpoints: []service.Endpoint{{URL: "http://search-1:8080"}}},
+		{ID: "billing-1", Name: "billing", Endpoints: []service.Endpoint{{URL: "http://billing-1:8080"}}},
+	}}
+
+	tests := []struct {
+		name        string
+		atomic      bool
+		wantResults []string
+		wantIDs     []string
+	}{
+		{name: "transactional repository rolls back", atomic: true, wantIDs: []string{"existing-1"}},
+		{
+			name:        "other repositories import the rest",
+			wantResults: []string{ImportCreated, ImportFailed, ImportCreated},
+			wantIDs:     []string{"billing-1", "existing-1", "payment-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.NewRegistryRepository()
+			mem.Register(ctx, &service.Service{ID: "existing-1", Name: "existing"})
+			flaky := flakyRepository{RegistryRepository: mem, failID: "search-1"}
+
+			var repo service.RegistryRepository = flaky
+			if tt.atomic {
+				repo = transactionalFlakyRepository{flaky, mem}
+			}
+			report, err := NewService(repo, Config{}, logger.NewNop()).Import(ctx, doc, ImportMerge)
+
+			if tt.atomic {
+				if !errors.Is(err, ErrImportRolledBack) || !errors.Is(err, errStorage) {
+					t.Fatalf("expected ErrImportRolledBack wrapping the storage error, got %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				got := make([]string, 0, len(report.Results))
+				for _, result := range report.Results {
+					got = append(got, result.Result)
+				}
+				if report.Atomic || !slices.Equal(got, tt.wantResults) {
+					t.Errorf("expected non-atomic results %v, got %v (atomic %v)", tt.wantResults, got, report.Atomic)
+				}
+			}
+
+			stored, _ := mem.List(ctx)
+			ids := make([]string, 0, len(stored))
+			for _, svc := range stored {
+				ids = append(ids, svc.ID)
+			}
+			slices.Sort(ids)
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("expected stored services %v, got %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/service"
+)
+
+// GraphNode is a registered service in the dependency graph
+type GraphNode struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Status       service.Status `json:"status"`
+	Capabilities []string       `json:"capabilities"`
+	DependsOn    []string       `json:"depends_on"`
+}
+
+// GraphEdge links a service to one provider of a capability it depends on.
+// A capability with several providers gets an edge to each.
+type GraphEdge struct {
+	From       string `json:"from"` // the dependent service
+	To         string `json:"to"`   // the providing service
+	Capability string `json:"capability"`
+}
+
+// MissingDependency is a declared dependency no registered service provides
+type MissingDependency struct {
+	ServiceID  string `json:"service_id"`
+	Capability string `json:"capability"`
+}
+
+// Graph is the dependency graph of the registered services. Nodes are
+// ordered by ID, edges and missing dependencies by service then capability.
+type Graph struct {
+	Nodes   []GraphNode         `json:"nodes"`
+	Edges   []GraphEdge         `json:"edges"`
+	Missing []MissingDependency `json:"missing"`
+}
+
+// ImpactedService is a service left without any provider of a capability it
+// depends on
+type ImpactedService struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Capability string `json:"capability"` // the dependency that lost its last provider
+	Depth      int    `json:"depth"`      // 1 for direct dependents of the removed service
+}
+
+// Impact lists the services that would break if a service disappeared,
+// ordered by depth then ID
+type Impact struct {
+	ServiceID string            `json:"service_id"`
+	Affected  []ImpactedService `json:"affected"`
+}
+
+// dependencies indexes the registered services of a tenant by the
+// capabilities they provide and depend on
+type dependencies struct {
+	services   []*service.Service
+	providers  map[string][]*service.Service
+	dependents map[string][]*service.Service
+}
+
+// loadDependencies indexes the services registered within the caller's
+// tenant, ordered by ID. Deregistered services are left out.
+func (s *Service) loadDependencies(ctx context.Context) (*dependencies, error) {
+	services, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	services = visible(ctx, services)
+	slices.SortFunc(services, service.CompareBy(service.SortByID))
+
+	deps := &dependencies{
+		services:   services,
+		providers:  make(map[string][]*service.Service),
+		dependents: make(map[string][]*service.Service),
+	}
+	for _, svc := range services {
+		for _, capability := range slices.Compact(slices.Sorted(slices.Values(svc.Capabilities))) {
+			deps.providers[capability] = append(deps.providers[capability], svc)
+		}
+		for _, capability := range slices.Compact(slices.Sorted(slices.Values(svc.DependsOn))) {
+			deps.dependents[capability] = append(deps.dependents[capability], svc)
+		}
+	}
+	return deps, nil
+}
+
+// Graph returns the dependency graph of the services registered within the
+// caller's tenant: every declared dependency resolved to the services
+// currently providing it, whatever their health. A service providing a
+// capability it also depends on gets no edge to itself.
+func (s *Service) Graph(ctx context.Context) (*Graph, error) {
+	deps, err := s.loadDependencies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("build dependency graph: %w", err)
+	}
+
+	graph := &Graph{
+		Nodes:   make([]GraphNode, 0, len(deps.services)),
+		Edges:   []GraphEdge{},
+		Missing: []MissingDependency{},
+	}
+	for _, svc := range deps.services {
+		graph.Nodes = append(graph.Nodes, GraphNode{
+			ID:           svc.ID,
+			Name:         svc.Name,
+			Status:       svc.Status,
+			Capabilities: nonNil(svc.Capabilities),
+			DependsOn:    nonNil(svc.DependsOn),
+		})
+
+		for _, capability := range slices.Compact(slices.Sorted(slices.Values(svc.DependsOn))) {
+			providers := deps.providers[capability]
+			if len(providers) == 0 {
+				graph.Missing = append(graph.Missing, MissingDependency{ServiceID: svc.ID, Capability: capability})
+				continue
+			}
+			for _, provider := range providers {
+				if provider.ID != svc.ID {
+					graph.Edges = append(graph.Edges, GraphEdge{From: svc.ID, To: provider.ID, Capability: capability})
+				}
+			}
+		}
+	}
+	return graph, nil
+}
+
+// Impact returns the services within the caller's tenant that would break if
+// the service with the given ID disappeared. A service breaks when every
+// provider of a capability it depends on is gone, so dependents of a
+// capability another provider still offers are not affected. The
+// search runs breadth first from the service and visits each service once,
+// so dependency cycles end it. It returns ErrServiceNotFound for unknown and
+// deregistered services.
+func (s *Service) Impact(ctx context.Context, id string) (*Impact, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	deps, err := s.loadDependencies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("compute impact: %w", err)
+	}
+
+	impact := &Impact{ServiceID: id, Affected: []ImpactedService{}}
+	gone := map[string]int{id: 0} // depth by service ID
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, capability := range deps.provided(current) {
+			if slices.ContainsFunc(deps.providers[capability], func(provider *service.Service) bool {
+				_, ok := gone[provider.ID]
+				return !ok
+			}) {
+				continue
+			}
+
+			for _, dependent := range deps.dependents[capability] {
+				if _, ok := gone[dependent.ID]; ok {
+					continue
+				}
+				gone[dependent.ID] = gone[current] + 1
+				queue = append(queue, dependent.ID)
+				impact.Affected = append(impact.Affected, ImpactedService{
+					ID:         dependent.ID,
+					Name:       dependent.Name,
+					Capability: capability,
+					Depth:      gone[dependent.ID],
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(impact.Affected, func(a, b ImpactedService) int {
+		return cmp.Or(cmp.Compare(a.Depth, b.Depth), strings.Compare(a.ID, b.ID))
+	})
+	return impact, nil
+}
+
+// provided returns the capabilities the service with the given ID provides
+func (d *dependencies) provided(id string) []string {
+	i, found := slices.BinarySearchFunc(d.services, id, func(svc *service.Service, id string) int {
+		return strings.Compare(svc.ID, id)
+	})
+	if !found {
+		return nil
+	}
+	return slices.Compact(slices.Sorted(slices.Values(d.services[i].Capabilities)))
+}
+
+// nonNil returns values, or an empty slice so it encodes as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// newTopology registers a small synthetic topology:
+//
+//	web -> checkout -> payments (payments-a, payments-b)
+//	          |     -> inventory (inventory) -> catalog (catalog)
+//	          |                                     -> inventory: a cycle
+//	          +----> fraud-check (no provider)
+//	reports -> inventory
+func newTopology(t *testing.T) (*Service, context.Context) {
+	t.Helper()
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	for _, node := range []struct {
+		id           string
+		capabilities []string
+		dependsOn    []string
+	}{
+		{id: "web", capabilities: []string{"frontend"}, dependsOn: []string{"checkout"}},
+		{id: "checkout", capabilities: []string{"checkout"}, dependsOn: []string{"payments", "inventory", "fraud-check"}},
+		{id: "payments-a", capabilities: []string{"payments"}},
+		{id: "payments-b", capabilities: []string{"payments"}},
+		{id: "inventory", capabilities: []string{"inventory"}, dependsOn: []string{"catalog"}},
+		{id: "catalog", capabilities: []string{"catalog"}, dependsOn: []string{"inventory"}},
+		{id: "reports", dependsOn: []string{"inventory"}},
+	} {
+		req := newRegisterRequest(node.id, node.id)
+		req.Capabilities = node.capabilities
+		req.DependsOn = node.dependsOn
+		if _, _, err := svc.Register(ctx, req); err != nil {
+			t.Fatalf("register %s: %v", node.id, err)
+		}
+	}
+	return svc, ctx
+}
+
+func TestService_Graph(t *testing.T) {
+	svc, ctx := newTopology(t)
+
+	graph, err := svc.Graph(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var nodes []string
+	for _, node := range graph.Nodes {
+		nodes = append(nodes, node.ID)
+	}
+	if want := []string{"catalog", "checkout", "inventory", "payments-a", "payments-b", "reports", "web"}; !slices.Equal(nodes, want) {
+		t.Errorf("expected nodes %v, got %v", want, nodes)
+	}
+
+	var edges []string
+	for _, edge := range graph.Edges {
+		edges = append(edges, fmt.Sprintf("%s-%s->%s", edge.From, edge.Capability, edge.To))
+	}
+	want := []string{
+		"catalog-inventory->inventory",
+		"checkout-inventory->inventory",
+		"checkout-payments->payments-a",
+		"checkout-payments->payments-b",
+		"inventory-catalog->catalog",
+		"reports-inventory->inventory",
+		"web-checkout->checkout",
+	}
+	if !slices.Equal(edges, want) {
+		t.Errorf("expected edges %v, got %v", want, edges)
+	}
+
+	if want := []MissingDependency{{ServiceID: "checkout", Capability: "fraud-check"}}; !slices.Equal(graph.Missing, want) {
+		t.Errorf("expected missing %v, got %v", want, graph.Missing)
+	}
+}
+
+func TestService_GraphLeavesOutDeregisteredProviders(t *testing.T) {
+	svc, ctx := newTopology(t)
+	svc.Deregister(ctx, "catalog")
+
+	graph, _ := svc.Graph(ctx)
+	if len(graph.Nodes) != 6 {
+		t.Errorf("expected 6 nodes, got %d", len(graph.Nodes))
+	}
+	if !slices.Contains(graph.Missing, MissingDependency{ServiceID: "inventory", Capability: "catalog"}) {
+		t.Errorf("expected catalog to be missing for inventory, got %v", graph.Missing)
+	}
+}
+
+func TestService_GraphWithinTenant(t *testing.T) {
+	svc, ctx := newTopology(t)
+	acme := token.NewContext(ctx, &token.Claims{Subject: "acme-service", TenantID: "acme"})
+
+	req := newRegisterRequest("acme-shop", "shop")
+	req.DependsOn = []string{"inventory"}
+	if _, _, err := svc.Register(acme, req); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	graph, err := svc.Graph(acme)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(graph.Nodes) != 1 || len(graph.Edges) != 0 {
+		t.Errorf("expected only the tenant's service, got %+v", graph)
+	}
+	if want := []MissingDependency{{ServiceID: "acme-shop", Capability: "inventory"}}; !slices.Equal(graph.Missing, want) {
+		t.Errorf("expected providers of other tenants to be left out, got %v", graph.Missing)
+	}
+
+	impact, _ := svc.Impact(ctx, "inventory")
+	if !slices.ContainsFunc(impact.Affected, func(affected ImpactedService) bool { return affected.ID == "acme-shop" }) {
+		t.Errorf("expected an unrestricted caller to see every tenant, got %v", impact.Affected)
+	}
+}
+
+func TestService_Impact(t *testing.T) {
+	tests := []struct {
+		name    string
+		removed []string // deregistered before asking
+		id      string
+		want    []ImpactedService
+	}{
+		{
+			name: "cycle is visited once",
+			id:   "catalog",
+			want: []ImpactedService{
+				{ID: "inventory", Name: "inventory", Capability: "catalog", Depth: 1},
+				{ID: "checkout", Name: "checkout", Capability: "inventory", Depth: 2},
+				{ID: "reports", Name: "reports", Capability: "inventory", Depth: 2},
+				{ID: "web", Name: "web", Capability: "checkout", Depth: 3},
+			},
+		},
+		{
+			name: "another provider remains",
+			id:   "payments-a",
+			want: []ImpactedService{},
+		},
+		{
+			name:    "last provider",
+			removed: []string{"payments-b"},
+			id:      "payments-a",
+			want: []ImpactedService{
+				{ID: "checkout", Name: "checkout", Capability: "payments", Depth: 1},
+				{ID: "web", Name: "web", Capability: "checkout", Depth: 2},
+			},
+		},
+		{
+			name: "no dependents",
+			id:   "web",
+			want: []ImpactedService{},
+		},
+		{
+			name: "dependency without provider is not caused by the removal",
+			id:   "reports",
+			want: []ImpactedService{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, ctx := newTopology(t)
+			for _, id := range tt.removed {
+				svc.Deregister(ctx, id)
+			}
+
+			impact, err := svc.Impact(ctx, tt.id)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if impact.ServiceID != tt.id || !slices.Equal(impact.Affected, tt.want) {
+				t.Errorf("expected %v, got %+v", tt.want, impact)
+			}
+		})
+	}
+}
+
+func TestService_ImpactNotFound(t *testing.T) {
+	svc, ctx := newTopology(t)
+	svc.Deregister(ctx, "catalog")
+
+	for _, id := range []string{"missing", "catalog"} {
+		if _, err := svc.Impact(ctx, id); !errors.Is(err, ErrServiceNotFound) {
+			t.Errorf("%s: expected ErrServiceNotFound, got %v", id, err)
+		}
+	}
+}
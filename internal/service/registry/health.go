@@ -0,0 +1,346 @@
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+)
+
+// requestIDHeader correlates health check requests with the checked service's logs
+const requestIDHeader = "X-Request-ID"
+
+// StartHealthChecks checks every service once per its check interval until
+// ctx is cancelled. New registrations are checked within a second, and each
+// service is checked at its own offset within its interval so a large
+// registry is not probed all at once; see nextSlot.
+func (s *Service) StartHealthChecks(ctx context.Context) {
+	ticker := s.config.Clock.NewTicker(min(scheduleTick, s.config.HealthCheckInterval, s.config.MinCheckInterval))
+	defer ticker.Stop()
+
+	schedule := newHealthSchedule()
+	s.checkDue(ctx, schedule)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.checkDue(ctx, schedule)
+		}
+	}
+}
+
+// transition is a status change stored by a health check
+type transition struct {
+	serviceID  string
+	instanceID string // empty for services registered without one
+	before     service.Status
+	status     service.Status
+	requestID  string // of the probe, empty for heartbeat expiry
+	reason     string // why the service became unhealthy
+}
+
+// checkAll checks every service at once
+func (s *Service) checkAll(ctx context.Context) {
+	services, err := s.repo.List(ctx)
+	if err != nil {
+		s.logger.Error("list services for health check failed", "error", err)
+		return
+	}
+	s.checkServices(ctx, services)
+}
+
+// checkServices checks the services, at most HealthCheckWorkers at a time
+// and each instance of a logical service on its own, and marks those whose
+// heartbeat has expired unhealthy. Only changes are stored, queued and
+// flushed at the configured write rate along with those earlier calls left
+// waiting. Services turning unhealthy are logged together in one warning per
+// call, while each recovery is logged on its own.
+func (s *Service) checkServices(ctx context.Context, services []*service.Service) {
+	writes := make([]*healthWrite, len(services))
+	workers := make(chan struct{}, s.config.HealthCheckWorkers)
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			writes[i] = s.checkService(ctx, svc)
+		}()
+	}
+	wg.Wait()
+
+	s.writes.queue(ctx, writes)
+	transitions := s.flushHealthWrites(ctx)
+
+	var unhealthy []*transition
+	for _, t := range transitions {
+		switch {
+		case t.status == service.StatusUnhealthy:
+			unhealthy = append(unhealthy, t)
+		default:
+			s.logger.Info("service status changed", "service_id", t.serviceID, "instance_id", t.instanceID, "status", t.status, "request_id", t.requestID)
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		ids := make([]string, len(unhealthy))
+		reasons := make(map[string]string, len(unhealthy))
+		for i, t := range unhealthy {
+			ids[i] = t.serviceID
+			reasons[t.serviceID] = t.reason
+		}
+		s.logger.Warn(fmt.Sprintf("%d services transitioned to unhealthy: %s", len(ids), strings.Join(ids, ", ")),
+			"count", len(ids), "service_ids", ids, "reasons", reasons)
+	}
+}
+
+// checkService probes svc, or judges it by its heartbeats when it has no
+// health check, returning the write its result calls for, if any
+func (s *Service) checkService(ctx context.Context, svc *service.Service) *healthWrite {
+	if svc.EffectiveHealthCheck() == nil {
+		return s.checkHeartbeat(svc, s.config.Clock.Now())
+	}
+	return s.checkServiceHealth(ctx, svc)
+}
+
+// EffectiveStatus returns the status the registry assigns svc at now given
+// the heartbeat timeout. A service without a health check is unhealthy once
+// its last heartbeat is timeout old. Operator overrides, services
+// checked by probes, services that never sent a heartbeat and a zero timeout
+// keep their stored status. The health loop stores this status, so responses
+// computing it ahead of the next round agree with what will be stored.
+func EffectiveStatus(svc *service.Service, timeout time.Duration, now time.Time) service.Status {
+	if timeout <= 0 || svc.OverrideStatus || svc.EffectiveHealthCheck() != nil || svc.LastHeartbeat.IsZero() {
+		return svc.Status
+	}
+	if now.Sub(svc.LastHeartbeat) >= timeout {
+		return service.StatusUnhealthy
+	}
+	return svc.Status
+}
+
+// HeartbeatTimeout returns the configured heartbeat timeout, zero when
+// heartbeats never expire
+func (s *Service) HeartbeatTimeout() time.Duration {
+	return s.config.HeartbeatTimeout
+}
+
+// checkHeartbeat returns the write storing the effective status of a service
+// judged by its heartbeats at now when it differs from the listed one. The
+// write judges the service again as stored when it is flushed, so a
+// heartbeat or override stored meanwhile is not overwritten.
+func (s *Service) checkHeartbeat(svc *service.Service, now time.Time) *healthWrite {
+	if EffectiveStatus(svc, s.config.HeartbeatTimeout, now) == svc.Status {
+		return nil
+	}
+
+	return &healthWrite{serviceID: svc.ID, apply: func(current *service.Service) (*service.Service, *transition) {
+		if current.IsDeleted() {
+			return nil, nil
+		}
+		status := EffectiveStatus(current, s.config.HeartbeatTimeout, now)
+		if status == current.Status {
+			return nil, nil
+		}
+
+		// Store a copy; the repository may hand out the value it holds
+		updated := *current
+		updated.Status = status
+		return &updated, &transition{
+			serviceID:  current.ID,
+			instanceID: current.InstanceID,
+			before:     current.Status,
+			status:     status,
+			reason:     "no heartbeat since " + current.LastHeartbeat.UTC().Format(time.RFC3339),
+		}
+	}}
+}
+
+// checkServiceHealth probes a single service and returns the write storing
+// its status when it changed. Services under an operator status override
+// are skipped, including those overridden by the time the write is flushed.
+func (s *Service) checkServiceHealth(ctx context.Context, svc *service.Service) *healthWrite {
+	if svc.OverrideStatus {
+		return nil
+	}
+	if svc.ChecksEndpoints() {
+		return s.checkEndpointHealth(ctx, svc)
+	}
+
+	check := svc.EffectiveHealthCheck()
+	requestID := generateRequestID()
+	err := s.probe(ctx, svc.ID, check, check.URL, requestID)
+
+	status, reason := service.StatusHealthy, ""
+	if err != nil {
+		status, reason = service.StatusUnhealthy, err.Error()
+		s.logger.Debug("health check failed",
+			"service_id", svc.ID, "type", check.Type, "url", redactURL(check.URL), "request_id", requestID, "error", err)
+	} else {
+		s.logger.Debug("health check passed",
+			"service_id", svc.ID, "type", check.Type, "url", redactURL(check.URL), "request_id", requestID)
+	}
+
+	if svc.Status == status {
+		return nil
+	}
+
+	return &healthWrite{serviceID: svc.ID, apply: func(current *service.Service) (*service.Service, *transition) {
+		if current.OverrideStatus || current.IsDeleted() || current.Status == status {
+			return nil, nil
+		}
+
+		// Store a copy; the repository may hand out the value it holds
+		updated := *current
+		updated.Status = status
+		return &updated, &transition{serviceID: current.ID, instanceID: current.InstanceID, before: current.Status, status: status, requestID: requestID, reason: reason}
+	}}
+}
+
+// checkEndpointHealth probes each endpoint of a service whose http health
+// check URL is templated with service.EndpointPlaceholder and returns the
+// write storing the endpoints' health when an endpoint is checked for the
+// first time or its health changes. The service is healthy while at least
+// one endpoint is; a change of its status is reported as a transition.
+func (s *Service) checkEndpointHealth(ctx context.Context, svc *service.Service) *healthWrite {
+	check := svc.EffectiveHealthCheck()
+	requestID := generateRequestID()
+	checkedAt := s.config.Clock.Now()
+
+	healthy := make(map[string]bool, len(svc.Endpoints)) // endpoint URL -> probe passed
+	var failures []string
+	for _, endpoint := range svc.Endpoints {
+		url := endpoint.HealthCheckURL(check.URL)
+		if err := s.probe(ctx, svc.ID, check, url, requestID); err != nil {
+			healthy[endpoint.URL] = false
+			failures = append(failures, endpoint.URL+": "+err.Error())
+			s.logger.Debug("endpoint health check failed",
+				"service_id", svc.ID, "endpoint", redactURL(endpoint.URL), "url", redactURL(url), "request_id", requestID, "error", err)
+			continue
+		}
+		healthy[endpoint.URL] = true
+		s.logger.Debug("endpoint health check passed",
+			"service_id", svc.ID, "endpoint", redactURL(endpoint.URL), "url", redactURL(url), "request_id", requestID)
+	}
+
+	if applyEndpointHealth(svc, healthy, checkedAt) == nil {
+		return nil
+	}
+
+	// Applied to the service as stored when flushed, so an override or new
+	// endpoints stored while the write waited are not overwritten
+	return &healthWrite{serviceID: svc.ID, apply: func(current *service.Service) (*service.Service, *transition) {
+		if current.OverrideStatus || current.IsDeleted() {
+			return nil, nil
+		}
+		updated := applyEndpointHealth(current, healthy, checkedAt)
+		if updated == nil || updated.Status == current.Status {
+			return updated, nil
+		}
+		return updated, &transition{
+			serviceID:  current.ID,
+			instanceID: current.InstanceID,
+			before:     current.Status,
+			status:     updated.Status,
+			requestID:  requestID,
+			reason:     strings.Join(failures, "; "),
+		}
+	}}
+}
+
+// applyEndpointHealth returns a copy of svc with the health of its endpoints
+// probed at checkedAt, healthy telling by URL whether each passed, and the
+// status that follows from them, or nil when neither changes
+func applyEndpointHealth(svc *service.Service, healthy map[string]bool, checkedAt time.Time) *service.Service {
+	// Copy; the repository may hand out the value it holds
+	updated := *svc
+	updated.Endpoints = slices.Clone(svc.Endpoints)
+	changed := false
+	for i, endpoint := range updated.Endpoints {
+		passed, ok := healthy[endpoint.URL]
+		if !ok || (passed == endpoint.Healthy && !endpoint.LastCheckedAt.IsZero()) {
+			continue
+		}
+		updated.Endpoints[i].Healthy = passed
+		updated.Endpoints[i].LastCheckedAt = checkedAt
+		changed = true
+	}
+	updated.Status = service.StatusUnhealthy
+	if updated.HasHealthyEndpoint() {
+		updated.Status = service.StatusHealthy
+	}
+	if !changed && updated.Status == svc.Status {
+		return nil
+	}
+	return &updated
+}
+
+// probe runs the check against target with the prober of its type, within
+// the check's timeout capped by the registry's, and records the result in
+// the health history of the service. Targets the target policy refuses fail
+// with ErrTargetNotAllowed without being probed.
+func (s *Service) probe(ctx context.Context, serviceID string, check *service.HealthCheck, target, requestID string) error {
+	p, ok := s.probers[check.Type]
+	if !ok {
+		return fmt.Errorf("unsupported health check type %q", check.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.probeTimeout(check))
+	defer cancel()
+	checkedAt, start := s.config.Clock.Now(), time.Now()
+	err := s.config.TargetPolicy.checkTarget(ctx, check.Type, target)
+	if err == nil {
+		err = p.probe(ctx, check, target, requestID)
+	}
+
+	result := HealthCheckResult{
+		Time:      checkedAt.UTC(),
+		Type:      check.Type,
+		Target:    redactURL(target),
+		Success:   err == nil,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		RequestID: requestID,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	s.history.add(serviceID, result)
+	return err
+}
+
+// probeTimeout returns the time a probe of check may take
+func (s *Service) probeTimeout(check *service.HealthCheck) time.Duration {
+	timeout := s.config.HealthCheckTimeout
+	if check.TimeoutSeconds > 0 {
+		timeout = min(timeout, time.Duration(check.TimeoutSeconds)*time.Second)
+	}
+	return timeout
+}
+
+// generateRequestID returns a random 128-bit hex identifier
+func generateRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// redactURL hides the password of a URL logged with a health check; URLs
+// without credentials, including tcp host:port targets, are logged unchanged
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultHealthHistorySize is how many health check results are kept per
+// service when the configuration leaves it unset
+const defaultHealthHistorySize = 50
+
+// HealthCheckResult is the outcome of one health check probe
+type HealthCheckResult struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`            // probe type, service.HealthCheckHTTP or service.HealthCheckTCP
+	Target    string    `json:"target"`          // URL or host:port probed, with any password redacted
+	Success   bool      `json:"success"`         // whether the probe passed
+	LatencyMS float64   `json:"latency_ms"`      // time the probe took
+	Error     string    `json:"error,omitempty"` // why the probe failed
+	RequestID string    `json:"request_id"`      // sent with http probes for correlation
+}
+
+// HealthSummary condenses the recorded health checks of a service
+type HealthSummary struct {
+	Checks       int     `json:"checks"`         // results in the window
+	SuccessRate  float64 `json:"success_rate"`   // share of passed checks, 0 to 1
+	P95LatencyMS float64 `json:"p95_latency_ms"` // 95th percentile latency, nearest rank
+}
+
+// HealthHistory is the recent health checks of a service, oldest first
+type HealthHistory struct {
+	ServiceID string              `json:"service_id"`
+	Results   []HealthCheckResult `json:"results"`
+	Summary   HealthSummary       `json:"summary"`
+}
+
+// healthRing keeps the most recent results of one service in a fixed-size
+// ring buffer
+type healthRing struct {
+	results []HealthCheckResult
+	next    int // index the next result is written at once the ring is full
+}
+
+// add stores a result, overwriting the oldest once size results are held
+func (r *healthRing) add(result HealthCheckResult, size int) {
+	if len(r.results) < size {
+		r.results = append(r.results, result)
+		return
+	}
+	r.results[r.next] = result
+	r.next = (r.next + 1) % size
+}
+
+// list returns a copy of the results, oldest first
+func (r *healthRing) list() []HealthCheckResult {
+	return slices.Concat(r.results[r.next:], r.results[:r.next])
+}
+
+// healthHistory holds the health check results of every probed service. It
+// lives in memory only, so it starts empty on every start of the server.
+type healthHistory struct {
+	size int
+
+	mu    sync.Mutex
+	rings map[string]*healthRing // by service ID
+}
+
+func newHealthHistory(size int) *healthHistory {
+	return &healthHistory{size: size, rings: make(map[string]*healthRing)}
+}
+
+// add records a result for the service
+func (h *healthHistory) add(serviceID string, result HealthCheckResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.rings[serviceID]
+	if !ok {
+		ring = &healthRing{results: make([]HealthCheckResult, 0, h.size)}
+		h.rings[serviceID] = ring
+	}
+	ring.add(result, h.size)
+}
+
+// list returns the results recorded for the service, oldest first
+func (h *healthHistory) list(serviceID string) []HealthCheckResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.rings[serviceID]
+	if !ok {
+		return []HealthCheckResult{}
+	}
+	return ring.list()
+}
+
+// forget drops the results of the service
+func (h *healthHistory) forget(serviceID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.rings, serviceID)
+}
+
+// summarize computes the success rate and 95th percentile latency of results
+func summarize(results []HealthCheckResult) HealthSummary {
+	summary := HealthSummary{Checks: len(results)}
+	if len(results) == 0 {
+		return summary
+	}
+
+	latencies := make([]float64, len(results))
+	passed := 0
+	for i, result := range results {
+		latencies[i] = result.LatencyMS
+		if result.Success {
+			passed++
+		}
+	}
+	slices.Sort(latencies)
+
+	summary.SuccessRate = float64(passed) / float64(len(results))
+	// Nearest rank: the smallest latency at least 95% of the results reach
+	rank := (95*len(latencies) + 99) / 100
+	summary.P95LatencyMS = latencies[rank-1]
+	return summary
+}
+
+// HealthHistory returns the recent health checks of a registered service
+// within the caller's tenant, oldest first, with their summary. Services
+// without a health check have an empty history. The history is kept in
+// memory by this server, so it is empty after a restart and differs between
+// servers sharing the storage.
+func (s *Service) HealthHistory(ctx context.Context, id string) (*HealthHistory, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	results := s.history.list(id)
+	return &HealthHistory{ServiceID: id, Results: results, Summary: summarize(results)}, nil
+}
+
+// HealthSummary returns the summary of the recent health checks of the
+// service with the given ID, without checking that it exists
+func (s *Service) HealthSummary(id string) HealthSummary {
+	return summarize(s.history.list(id))
+}
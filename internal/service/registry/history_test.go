@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestService_HealthHistory(t *testing.T) {
+	// The backend flaps: every third check fails
+	var checks atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checks.Add(1)%3 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer target.Close()
+
+	start := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	svc := NewService(memory.NewRegistryRepository(), Config{Clock: fake, HealthHistorySize: 4}, logger.NewNop())
+	ctx := context.Background()
+	req := newRegisterRequest("payment-1", "payment")
+	req.HealthCheckURL = target.URL + "/health"
+	if _, _, err := svc.Register(ctx, req); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	for range 6 {
+		svc.checkAll(ctx)
+		fake.Advance(time.Minute)
+	}
+
+	history, err := svc.HealthHistory(ctx, "payment-1")
+	if err != nil {
+		t.Fatalf("health history: %v", err)
+	}
+	// Checks 3 to 6 are kept, oldest first; checks 3 and 6 failed
+	var times []time.Time
+	var passed []bool
+	for _, result := range history.Results {
+		times = append(times, result.Time)
+		passed = append(passed, result.Success)
+		if result.Type != service.HealthCheckHTTP || result.Target != target.URL+"/health" || result.RequestID == "" {
+			t.Errorf("unexpected result %+v", result)
+		}
+		if result.Success == (result.Error != "") {
+			t.Errorf("expected an error exactly on failed checks, got %+v", result)
+		}
+	}
+	wantTimes := []time.Time{start.Add(2 * time.Minute), start.Add(3 * time.Minute), start.Add(4 * time.Minute), start.Add(5 * time.Minute)}
+	if !slices.Equal(times, wantTimes) {
+		t.Errorf("expected results at %v, got %v", wantTimes, times)
+	}
+	if want := []bool{false, true, true, false}; !slices.Equal(passed, want) {
+		t.Errorf("expected outcomes %v, got %v", want, passed)
+	}
+	if history.Summary.Checks != 4 || history.Summary.SuccessRate != 0.5 {
+		t.Errorf("expected 4 checks at a 0.5 success rate, got %+v", history.Summary)
+	}
+	if got := svc.HealthSummary("payment-1"); got != history.Summary {
+		t.Errorf("expected the summary %+v, got %+v", history.Summary, got)
+	}
+
+	if err := svc.Deregister(ctx, "payment-1"); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+	if _, err := svc.HealthHistory(ctx, "payment-1"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound after deregistration, got %v", err)
+	}
+	if _, err := svc.Restore(ctx, "payment-1"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if history, _ := svc.HealthHistory(ctx, "payment-1"); len(history.Results) != 0 {
+		t.Errorf("expected the history to be dropped on deregistration, got %d results", len(history.Results))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := func(latencies ...float64) []HealthCheckResult {
+		out := make([]HealthCheckResult, len(latencies))
+		for i, latency := range latencies {
+			out[i] = HealthCheckResult{LatencyMS: latency, Success: i%4 != 0}
+		}
+		return out
+	}
+	twenty := make([]float64, 20)
+	for i := range twenty {
+		twenty[i] = float64(20 - i) // 20 down to 1
+	}
+
+	tests := []struct {
+		name    string
+		results []HealthCheckResult
+		want    HealthSummary
+	}{
+		{name: "empty", want: HealthSummary{}},
+		{name: "single failure", results: results(12), want: HealthSummary{Checks: 1, SuccessRate: 0, P95LatencyMS: 12}},
+		{name: "four", results: results(5, 1, 9, 3), want: HealthSummary{Checks: 4, SuccessRate: 0.75, P95LatencyMS: 9}},
+		{name: "twenty", results: results(twenty...), want: HealthSummary{Checks: 20, SuccessRate: 0.75, P95LatencyMS: 19}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(tt.results); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
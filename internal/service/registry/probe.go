@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aq189/bin/internal/domain/service"
+)
+
+// maxProbeBodyBytes caps how much of a response body an http probe searches
+// for the expected substring
+const maxProbeBodyBytes = 64 << 10
+
+// prober runs one type of health check against a target once. The target is
+// the check's URL, expanded per endpoint when templated; ctx carries the
+// probe's deadline.
+type prober interface {
+	probe(ctx context.Context, check *service.HealthCheck, target, requestID string) error
+}
+
+// httpProber GETs the target and passes when the response status and body
+// meet the check's expectations
+type httpProber struct {
+	client *http.Client
+}
+
+func (p httpProber) probe(ctx context.Context, check *service.HealthCheck, target, requestID string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set(requestIDHeader, requestID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !check.AcceptsStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if check.ExpectedBodySubstring == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodyBytes))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if !strings.Contains(string(body), check.ExpectedBodySubstring) {
+		return fmt.Errorf("body does not contain %q", check.ExpectedBodySubstring)
+	}
+	return nil
+}
+
+// tcpProber passes when a TCP connection to the target host:port opens
+type tcpProber struct {
+	dialer net.Dialer
+}
+
+func (p *tcpProber) probe(ctx context.Context, check *service.HealthCheck, target, requestID string) error {
+	conn, err := p.dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
@@ -0,0 +1,163 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestHTTPProber(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte(`{"status":"SERVING"}`))
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		case "/redirect":
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		check   service.HealthCheck
+		wantErr bool
+	}{
+		{name: "any 2xx by default", path: "/no-content"},
+		{name: "5xx fails by default", path: "/down", wantErr: true},
+		{name: "expected status", path: "/redirect", check: service.HealthCheck{ExpectedStatusCodes: []int{http.StatusFound}}},
+		{name: "2xx outside the expected set", path: "/ok", check: service.HealthCheck{ExpectedStatusCodes: []int{http.StatusNoContent}}, wantErr: true},
+		{name: "expected body", path: "/ok", check: service.HealthCheck{ExpectedBodySubstring: "SERVING"}},
+		{name: "unexpected body", path: "/ok", check: service.HealthCheck{ExpectedBodySubstring: "NOT_SERVING"}, wantErr: true},
+		{name: "expected body with an unexpected status", path: "/down", check: service.HealthCheck{ExpectedBodySubstring: "SERVING"}, wantErr: true},
+	}
+
+	p := httpProber{client: target.Client()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check.Type = service.HealthCheckHTTP
+			tt.check.URL = target.URL + tt.path
+
+			err := p.probe(context.Background(), &tt.check, tt.check.URL, "req-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTCPProber(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	open := listener.Addr().String()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	defer listener.Close()
+
+	p := &tcpProber{}
+	check := &service.HealthCheck{Type: service.HealthCheckTCP}
+	if err := p.probe(context.Background(), check, open, "req-1"); err != nil {
+		t.Errorf("expected an open port to pass, got %v", err)
+	}
+	if err := p.probe(context.Background(), check, closedAddr, "req-1"); err == nil {
+		t.Error("expected a closed port to fail")
+	}
+}
+
+func TestService_ProbeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer target.Close()
+	defer close(release)
+
+	tests := []struct {
+		name          string
+		globalTimeout time.Duration
+		checkTimeout  int
+		wantTimeout   time.Duration
+	}{
+		{name: "registry timeout by default", globalTimeout: 100 * time.Millisecond, wantTimeout: 100 * time.Millisecond},
+		{name: "shorter per-service timeout", globalTimeout: 10 * time.Second, checkTimeout: 1, wantTimeout: time.Second},
+		{name: "longer per-service timeout is capped", globalTimeout: 100 * time.Millisecond, checkTimeout: 10, wantTimeout: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(memory.NewRegistryRepository(), Config{HealthCheckTimeout: tt.globalTimeout}, logger.NewNop())
+			check := &service.HealthCheck{Type: service.HealthCheckHTTP, URL: target.URL, TimeoutSeconds: tt.checkTimeout}
+
+			start := time.Now()
+			err := svc.probe(context.Background(), "payment-1", check, check.URL, "req-1")
+			elapsed := time.Since(start)
+
+			if err == nil {
+				t.Fatal("expected a hung target to fail")
+			}
+			if elapsed < tt.wantTimeout || elapsed > tt.wantTimeout+2*time.Second {
+				t.Errorf("expected the probe to give up after %v, took %v", tt.wantTimeout, elapsed)
+			}
+		})
+	}
+}
+
+func TestService_CheckTCPHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{HealthCheckTimeout: time.Second}, logger.NewNop())
+	ctx := context.Background()
+
+	if _, _, err := svc.Register(ctx, RegisterRequest{
+		ID:          "grpc-1",
+		Name:        "grpc",
+		Endpoints:   []service.Endpoint{{URL: "http://" + addr}},
+		HealthCheck: &service.HealthCheck{Type: service.HealthCheckTCP, URL: addr},
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	svc.checkAll(ctx)
+	if stored, _ := repo.Get(ctx, "grpc-1"); stored.Status != service.StatusHealthy {
+		t.Errorf("expected a listening service to be healthy, got %s", stored.Status)
+	}
+
+	listener.Close()
+	svc.checkAll(ctx)
+	if stored, _ := repo.Get(ctx, "grpc-1"); stored.Status != service.StatusUnhealthy {
+		t.Errorf("expected a closed port to mark the service unhealthy, got %s", stored.Status)
+	}
+}
+
+func TestService_ProbeUnsupportedType(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	if err := svc.probe(context.Background(), "payment-1", &service.HealthCheck{Type: "grpc"}, "payment-1:9090", "req-1"); err == nil {
+		t.Error("expected an unsupported type to fail")
+	}
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+// maxPurgeInterval bounds how long a deregistered service can outlive its
+// retention period before the purge loop removes it
+const maxPurgeInterval = 10 * time.Minute
+
+// StartPurge permanently removes deregistered services once
+// Config.DeletedRetention has passed, checking every retention period or
+// every ten minutes, whichever is shorter, until ctx is cancelled
+func (s *Service) StartPurge(ctx context.Context) {
+	ticker := s.config.Clock.NewTicker(min(s.config.DeletedRetention, maxPurgeInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			s.purge(ctx, now)
+		}
+	}
+}
+
+// purge removes the services deregistered more than the retention period
+// before now
+func (s *Service) purge(ctx context.Context, now time.Time) {
+	purged, err := s.repo.Purge(ctx, now.Add(-s.config.DeletedRetention))
+	if err != nil {
+		s.logger.Error("purge deregistered services failed", "error", err)
+		return
+	}
+	if purged > 0 {
+		s.changed(ctx)
+		s.logger.Info("deregistered services purged", "count", purged, "retention", s.config.DeletedRetention)
+	}
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestService_DeregisterAndRestore(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+	if err := svc.Deregister(ctx, "payment-1"); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+
+	if _, err := svc.Get(ctx, "payment-1"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound from Get, got %v", err)
+	}
+	if services, _ := svc.List(ctx); len(services) != 0 {
+		t.Errorf("expected no listed services, got %d", len(services))
+	}
+	if services, _ := svc.Discover(ctx, DiscoverOptions{Capability: "payment"}); len(services) != 0 {
+		t.Errorf("expected no discovered services, got %d", len(services))
+	}
+	page, _ := svc.ListPaged(ctx, service.ListFilter{IncludeDeleted: true}, pagination.ListOptions{Limit: 10})
+	if page.Total != 1 || !page.Items[0].IsDeleted() {
+		t.Errorf("expected the deregistered service with include_deleted, got %+v", page)
+	}
+
+	restored, err := svc.Restore(ctx, "payment-1")
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored.IsDeleted() {
+		t.Errorf("expected DeletedAt cleared, got %v", restored.DeletedAt)
+	}
+	if services, _ := svc.Discover(ctx, DiscoverOptions{Capability: "payment"}); len(services) != 1 {
+		t.Errorf("expected the restored service to be discoverable, got %d", len(services))
+	}
+
+	if _, err := svc.Restore(ctx, "payment-1"); !errors.Is(err, ErrServiceNotDeleted) {
+		t.Errorf("expected ErrServiceNotDeleted restoring a registered service, got %v", err)
+	}
+	if _, err := svc.Restore(ctx, "missing"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound restoring an unknown service, got %v", err)
+	}
+}
+
+func TestService_PurgeAfterRetention(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	fake := clock.NewFake(time.Now())
+	svc := NewService(repo, Config{DeletedRetention: time.Hour, Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+
+	svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+	svc.Register(ctx, newRegisterRequest("payment-2", "payment-service"))
+	svc.Deregister(ctx, "payment-1")
+
+	// Within the retention period nothing is purged
+	fake.Advance(30 * time.Minute)
+	svc.purge(ctx, fake.Now())
+	if _, err := repo.Get(ctx, "payment-1"); err != nil {
+		t.Fatalf("expected the service kept within retention, got %v", err)
+	}
+
+	fake.Advance(time.Hour)
+	svc.purge(ctx, fake.Now())
+	if _, err := repo.Get(ctx, "payment-1"); !errors.Is(err, service.ErrServiceNotFound) {
+		t.Errorf("expected the service purged after retention, got %v", err)
+	}
+	if _, err := svc.Restore(ctx, "payment-1"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound restoring a purged service, got %v", err)
+	}
+	if _, err := svc.Get(ctx, "payment-2"); err != nil {
+		t.Errorf("expected registered services left alone, got %v", err)
+	}
+}
+
+func TestService_HeartbeatAfterDeregister(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(*memory.RegistryRepository) service.RegistryRepository
+	}{
+		{name: "in place", wrap: func(repo *memory.RegistryRepository) service.RegistryRepository { return repo }},
+		{name: "by rewrite", wrap: func(repo *memory.RegistryRepository) service.RegistryRepository { return readWriteRepository{repo} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memory.NewRegistryRepository()
+			svc := NewService(tt.wrap(repo), Config{}, logger.NewNop())
+			ctx := context.Background()
+
+			svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+			svc.Deregister(ctx, "payment-1")
+
+			if err := svc.Heartbeat(ctx, "payment-1"); !errors.Is(err, ErrServiceGone) {
+				t.Fatalf("expected ErrServiceGone, got %v", err)
+			}
+			stored, _ := repo.Get(ctx, "payment-1")
+			if !stored.IsDeleted() {
+				t.Errorf("expected the heartbeat to leave the service deregistered")
+			}
+
+			// Registering again replaces the deregistered service
+			if _, created, err := svc.Register(ctx, newRegisterRequest("payment-1", "payment-service")); err != nil || !created {
+				t.Fatalf("expected a new registration, got created %v, error %v", created, err)
+			}
+			if err := svc.Heartbeat(ctx, "payment-1"); err != nil {
+				t.Errorf("expected heartbeats accepted after registering again, got %v", err)
+			}
+		})
+	}
+}
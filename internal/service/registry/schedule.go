@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// scheduleTick is the longest the health check scheduler waits between
+// looking for due checks and new registrations
+const scheduleTick = time.Second
+
+// healthSchedule tracks when each registered service is next due for a
+// health check. Only the StartHealthChecks loop uses it.
+type healthSchedule struct {
+	listed   bool                  // the services were listed at least once
+	revision int64                 // registry revision the services were listed at
+	entries  map[string]*scheduled // by service ID
+}
+
+// scheduled is a service as last listed and the time of its next check
+type scheduled struct {
+	svc      *service.Service
+	interval time.Duration
+	due      time.Time
+}
+
+func newHealthSchedule() *healthSchedule {
+	return &healthSchedule{entries: make(map[string]*scheduled)}
+}
+
+// checkDue brings the schedule up to date with the registry and checks the
+// services whose check is due
+func (s *Service) checkDue(ctx context.Context, schedule *healthSchedule) {
+	now := s.config.Clock.Now()
+	if err := s.refreshSchedule(ctx, schedule, now); err != nil {
+		s.logger.Error("list services for health check failed", "error", err)
+		return
+	}
+	s.checkServices(ctx, schedule.takeDue(now))
+}
+
+// refreshSchedule lists the services again when the registry revision moved
+// since they were last listed, which every registration, deregistration and
+// status change does
+func (s *Service) refreshSchedule(ctx context.Context, schedule *healthSchedule, now time.Time) error {
+	revision, err := s.repo.GetRevision(ctx)
+	if err != nil {
+		return fmt.Errorf("get registry revision: %w", err)
+	}
+	if schedule.listed && revision == schedule.revision {
+		return nil
+	}
+
+	services, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	schedule.update(services, now, s.checkInterval)
+	schedule.listed, schedule.revision = true, revision
+	return nil
+}
+
+// update replaces the listed services. A service registered since the last
+// listing is due at once; on the first listing each service waits for its
+// slot instead, so a restart does not check the whole registry together.
+// Services no longer listed are dropped, and a service whose interval changed
+// moves to its new slot unless its next check comes sooner.
+func (h *healthSchedule) update(services []*service.Service, now time.Time, interval func(*service.Service) time.Duration) {
+	entries := make(map[string]*scheduled, len(services))
+	for _, svc := range services {
+		e := &scheduled{svc: svc, interval: interval(svc)}
+		prev, ok := h.entries[svc.ID]
+		switch {
+		case !ok && !h.listed:
+			e.due = nextSlot(svc.ID, e.interval, now)
+		case !ok:
+			e.due = now
+		case prev.interval != e.interval:
+			e.due = nextSlot(svc.ID, e.interval, now)
+			if prev.due.Before(e.due) {
+				e.due = prev.due
+			}
+		default:
+			e.due = prev.due
+		}
+		entries[svc.ID] = e
+	}
+	h.entries = entries
+}
+
+// takeDue returns the services due at now, ordered by ID, and schedules
+// their next check at their next slot
+func (h *healthSchedule) takeDue(now time.Time) []*service.Service {
+	var due []*service.Service
+	for _, e := range h.entries {
+		if e.due.After(now) {
+			continue
+		}
+		due = append(due, e.svc)
+		e.due = nextSlot(e.svc.ID, e.interval, now)
+	}
+	slices.SortFunc(due, service.CompareBy(service.SortByID))
+	return due
+}
+
+// nextSlot returns the first time after now at which the service with the
+// given ID is checked when checked every interval. Each service is offset
+// within its interval by a jitter derived from its ID, so services sharing
+// an interval are spread across it rather than checked in lockstep, and keep
+// their offset across restarts.
+func nextSlot(id string, interval time.Duration, now time.Time) time.Time {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	jitter := time.Duration(h.Sum64() % uint64(interval))
+
+	slot := now.Truncate(interval).Add(jitter)
+	if !slot.After(now) {
+		slot = slot.Add(interval)
+	}
+	return slot
+}
+
+// checkInterval returns how often svc is checked: the interval it registered
+// with, or the registry's
+func (s *Service) checkInterval(svc *service.Service) time.Duration {
+	if svc.CheckIntervalSeconds > 0 {
+		return time.Duration(svc.CheckIntervalSeconds) * time.Second
+	}
+	return s.config.HealthCheckInterval
+}
+
+// validateCheckInterval checks a requested check interval against the
+// bounds the registry is configured with
+func (s *Service) validateCheckInterval(req RegisterRequest) error {
+	if req.CheckIntervalSeconds == 0 {
+		return nil
+	}
+	interval := time.Duration(req.CheckIntervalSeconds) * time.Second
+	if interval >= s.config.MinCheckInterval && interval <= s.config.MaxCheckInterval {
+		return nil
+	}
+
+	var errs validation.Errors
+	errs.Add("check_interval_seconds", fmt.Sprintf("must be from %d to %d seconds",
+		int(s.config.MinCheckInterval.Seconds()), int(s.config.MaxCheckInterval.Seconds())))
+	return errs.Err()
+}
@@ -0,0 +1,185 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// probeRecorder answers health checks at /<service ID> and remembers the
+// fake time of each
+type probeRecorder struct {
+	clock  *clock.Fake
+	mu     sync.Mutex
+	probes map[string][]time.Time
+}
+
+func (p *probeRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	p.probes[id] = append(p.probes[id], p.clock.Now())
+}
+
+func (p *probeRecorder) times(id string) []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.probes[id])
+}
+
+func TestService_HealthCheckSchedule(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	probes := &probeRecorder{clock: fake, probes: make(map[string][]time.Time)}
+	target := httptest.NewServer(probes)
+	defer target.Close()
+
+	svc := NewService(memory.NewRegistryRepository(), Config{HealthCheckInterval: 30 * time.Second, Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+	register := func(id string, interval int) {
+		t.Helper()
+		req := newRegisterRequest(id, id)
+		req.HealthCheckURL = target.URL + "/" + id
+		req.CheckIntervalSeconds = interval
+		if _, _, err := svc.Register(ctx, req); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+	}
+	register("fast", 10)
+	register("default", 0)
+
+	// run checks once per second of fake time for the given duration
+	schedule := newHealthSchedule()
+	run := func(d time.Duration) {
+		for range int(d / time.Second) {
+			svc.checkDue(ctx, schedule)
+			fake.Advance(time.Second)
+		}
+	}
+	run(2 * time.Minute)
+
+	for _, tt := range []struct {
+		id       string
+		interval time.Duration
+	}{
+		{id: "fast", interval: 10 * time.Second},
+		{id: "default", interval: 30 * time.Second},
+	} {
+		times := probes.times(tt.id)
+		if want := int(2 * time.Minute / tt.interval); len(times) != want {
+			t.Errorf("%s: expected %d checks in two minutes, got %d", tt.id, want, len(times))
+		}
+		if len(times) > 0 && !times[0].Before(start.Add(tt.interval)) {
+			t.Errorf("%s: expected the first check within one interval, got %v", tt.id, times[0].Sub(start))
+		}
+		for i := 1; i < len(times); i++ {
+			if gap := times[i].Sub(times[i-1]); gap != tt.interval {
+				t.Errorf("%s: expected checks %v apart, got %v", tt.id, tt.interval, gap)
+			}
+		}
+	}
+
+	// A registration is checked on the next pass, a deregistration no more
+	registeredAt := fake.Now()
+	register("new", 0)
+	if err := svc.Deregister(ctx, "fast"); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+	fastChecks := len(probes.times("fast"))
+	run(time.Second)
+	if times := probes.times("new"); len(times) != 1 || !times[0].Equal(registeredAt) {
+		t.Errorf("expected the new service checked at once, got %v", times)
+	}
+	run(time.Minute)
+	if got := len(probes.times("fast")); got != fastChecks {
+		t.Errorf("expected no checks after deregistration, got %d more", got-fastChecks)
+	}
+	if _, ok := schedule.entries["fast"]; ok {
+		t.Error("expected the deregistered service dropped from the schedule")
+	}
+}
+
+func TestHealthSchedule_Jitter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := 30 * time.Second
+
+	services := make([]*service.Service, 300)
+	for i := range services {
+		services[i] = &service.Service{ID: fmt.Sprintf("svc-%d", i)}
+	}
+	schedule := newHealthSchedule()
+	schedule.update(services, now, func(*service.Service) time.Duration { return interval })
+
+	perSecond := make(map[time.Duration]int)
+	for _, e := range schedule.entries {
+		offset := e.due.Sub(now)
+		if offset <= 0 || offset > interval {
+			t.Fatalf("%s: expected its first check within the interval, got %v", e.svc.ID, offset)
+		}
+		perSecond[offset.Truncate(time.Second)]++
+	}
+	if len(perSecond) != int(interval/time.Second) {
+		t.Errorf("expected checks in each of the %v seconds, got %d", interval, len(perSecond))
+	}
+	for second, n := range perSecond {
+		if n > 3*len(services)/len(perSecond) {
+			t.Errorf("expected checks spread evenly, got %d of %d at %v", n, len(services), second)
+		}
+	}
+
+	// Each service keeps its offset from one interval to the next
+	for _, e := range schedule.entries {
+		if next := nextSlot(e.svc.ID, interval, e.due); next.Sub(e.due) != interval {
+			t.Errorf("%s: expected the next check one interval later, got %v", e.svc.ID, next.Sub(e.due))
+		}
+	}
+}
+
+func TestService_RegisterCheckInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int
+		wantErr  bool
+	}{
+		{name: "registry interval", interval: 0},
+		{name: "within bounds", interval: 10},
+		{name: "below the minimum", interval: 1, wantErr: true},
+		{name: "above the maximum", interval: 7200, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(memory.NewRegistryRepository(), Config{MinCheckInterval: 5 * time.Second, MaxCheckInterval: time.Hour}, logger.NewNop())
+			req := newRegisterRequest("payment-1", "payment-service")
+			req.CheckIntervalSeconds = tt.interval
+
+			registered, _, err := svc.Register(context.Background(), req)
+			var errs validation.Errors
+			if tt.wantErr {
+				if !errors.As(err, &errs) || errs[0].Field != "check_interval_seconds" {
+					t.Fatalf("expected check_interval_seconds rejected, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("register: %v", err)
+			}
+			if registered.CheckIntervalSeconds != tt.interval {
+				t.Errorf("expected interval %d stored, got %d", tt.interval, registered.CheckIntervalSeconds)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+var (
+	// ErrSchemaNotFound is returned when no metadata schema is stored for a name
+	ErrSchemaNotFound = errors.New("metadata schema not found")
+	// ErrSchemasDisabled is returned when schemas are managed on a service
+	// without Config.Schemas
+	ErrSchemasDisabled = errors.New("metadata schemas are not enabled")
+)
+
+// schemaNamespace is the config repository service ID schemas are stored
+// under, one version per service name. The colon keeps it apart from every
+// valid service ID.
+const schemaNamespace = "root:schemas"
+
+// schemaCacheTTL is how long a schema, or its absence, is trusted before it
+// is read again, so schemas changed by another server sharing the storage
+// are enforced here too
+const schemaCacheTTL = 30 * time.Second
+
+// MetadataSchema constrains the metadata of the services registered under
+// Name. Keys outside Required and Allowed are rejected when Allowed is set,
+// and any key with a pattern must have a value matching it in full.
+type MetadataSchema struct {
+	Name     string            `json:"name"`
+	Required []string          `json:"required,omitempty"`
+	Allowed  []string          `json:"allowed,omitempty"`
+	Patterns map[string]string `json:"patterns,omitempty"` // regular expression per key
+}
+
+// Validate checks the schema's name, keys and patterns and returns
+// validation.Errors listing every invalid field
+func (m MetadataSchema) Validate() error {
+	var errs validation.Errors
+	if m.Name == "" {
+		errs.Add("name", "is required")
+	} else if !validation.IsID(m.Name) {
+		errs.Add("name", fmt.Sprintf("must be at most %d letters, digits, '.', '-' or '_' and start with a letter or digit", validation.MaxIDLength))
+	}
+	for i, key := range m.Required {
+		validateSchemaKey(&errs, fmt.Sprintf("required[%d]", i), key)
+	}
+	for i, key := range m.Allowed {
+		validateSchemaKey(&errs, fmt.Sprintf("allowed[%d]", i), key)
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.Patterns)) {
+		validateSchemaKey(&errs, "patterns", key)
+		if _, err := compilePattern(m.Patterns[key]); err != nil {
+			errs.Add("patterns."+key, "must be a valid regular expression")
+		}
+	}
+	return errs.Err()
+}
+
+// validateSchemaKey adds a problem with a metadata key named in a schema to errs
+func validateSchemaKey(errs *validation.Errors, field, key string) {
+	if key == "" || len(key) > validation.MaxMetadataKeyLength {
+		errs.Add(field, fmt.Sprintf("key %q must be 1 to %d characters", key, validation.MaxMetadataKeyLength))
+	}
+}
+
+// compilePattern compiles a schema pattern so it matches whole values only
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// compiledSchema is a stored schema ready to check metadata against
+type compiledSchema struct {
+	MetadataSchema
+	allowed  map[string]bool // Required and Allowed; nil when any key is allowed
+	patterns map[string]*regexp.Regexp
+}
+
+func compileSchema(m MetadataSchema) (*compiledSchema, error) {
+	c := &compiledSchema{MetadataSchema: m, patterns: make(map[string]*regexp.Regexp, len(m.Patterns))}
+	if len(m.Allowed) > 0 {
+		c.allowed = make(map[string]bool, len(m.Required)+len(m.Allowed))
+		for _, key := range slices.Concat(m.Required, m.Allowed) {
+			c.allowed[key] = true
+		}
+	}
+	for key, pattern := range m.Patterns {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern for %s: %w", key, err)
+		}
+		c.patterns[key] = re
+	}
+	return c, nil
+}
+
+// check adds every way metadata breaks the schema to errs, by metadata key
+func (c *compiledSchema) check(errs *validation.Errors, metadata map[string]string) {
+	for _, key := range c.Required {
+		if _, ok := metadata[key]; !ok {
+			errs.Add("metadata."+key, "is required by the schema for "+c.Name)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		if c.allowed != nil && !c.allowed[key] {
+			errs.Add("metadata."+key, "is not allowed by the schema for "+c.Name)
+			continue
+		}
+		if re, ok := c.patterns[key]; ok && !re.MatchString(metadata[key]) {
+			errs.Add("metadata."+key, fmt.Sprintf("must match %q", c.Patterns[key]))
+		}
+	}
+}
+
+// schemaCache holds the schemas recently read by service name, nil for names
+// without one
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedSchema
+	// generation counts invalidations, so a read racing one isn't cached
+	generation uint64
+}
+
+type cachedSchema struct {
+	schema   *compiledSchema
+	loadedAt time.Time
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{entries: make(map[string]cachedSchema)}
+}
+
+// get returns the cached schema for name and whether it is still fresh at
+// now, and the generation to store a fresh read with
+func (c *schemaCache) get(name string, now time.Time) (*compiledSchema, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	if !ok || now.Sub(entry.loadedAt) >= schemaCacheTTL {
+		return nil, false, c.generation
+	}
+	return entry.schema, true, c.generation
+}
+
+// put caches schema for name unless the cache was invalidated since generation
+func (c *schemaCache) put(name string, schema *compiledSchema, now time.Time, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.entries[name] = cachedSchema{schema: schema, loadedAt: now}
+	}
+}
+
+// invalidate forgets the schema for name
+func (c *schemaCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.entries, name)
+}
+
+// PutSchema stores the metadata schema for the services named schema.Name,
+// replacing any existing one; it applies to registrations from then on.
+// Invalid schemas fail with validation.Errors. The returned bool reports
+// whether no schema existed before.
+func (s *Service) PutSchema(schema MetadataSchema) (*MetadataSchema, bool, error) {
+	if s.config.Schemas == nil {
+		return nil, false, ErrSchemasDisabled
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	_, err := s.config.Schemas.Get(schemaNamespace, schema.Name)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, false, fmt.Errorf("get metadata schema: %w", err)
+	}
+	created := err != nil
+
+	fields, err := schemaFields(schema)
+	if err != nil {
+		return nil, false, fmt.Errorf("encode metadata schema: %w", err)
+	}
+	if err := s.config.Schemas.Set(schemaNamespace, schema.Name, fields); err != nil {
+		return nil, false, fmt.Errorf("store metadata schema: %w", err)
+	}
+	s.schemas.invalidate(schema.Name)
+
+	s.logger.Info("metadata schema stored", "name", schema.Name, "created", created)
+	return &schema, created, nil
+}
+
+// Schema returns the metadata schema for name, or ErrSchemaNotFound
+func (s *Service) Schema(name string) (*MetadataSchema, error) {
+	if s.config.Schemas == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	schema, err := s.loadSchema(name)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// ListSchemas returns every metadata schema ordered by name
+func (s *Service) ListSchemas() ([]MetadataSchema, error) {
+	if s.config.Schemas == nil {
+		return []MetadataSchema{}, nil
+	}
+	names, err := s.config.Schemas.List(schemaNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("list metadata schemas: %w", err)
+	}
+	slices.Sort(names)
+
+	schemas := make([]MetadataSchema, 0, len(names))
+	for _, name := range names {
+		schema, err := s.loadSchema(name)
+		if errors.Is(err, ErrSchemaNotFound) {
+			continue // removed since it was listed
+		}
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+// DeleteSchema removes the metadata schema for name, so its services'
+// metadata is no longer checked; unknown names fail with ErrSchemaNotFound
+func (s *Service) DeleteSchema(name string) error {
+	if s.config.Schemas == nil {
+		return fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	if _, err := s.loadSchema(name); err != nil {
+		return err
+	}
+	if err := s.config.Schemas.Delete(schemaNamespace, name); err != nil {
+		return fmt.Errorf("delete metadata schema: %w", err)
+	}
+	s.schemas.invalidate(name)
+
+	s.logger.Info("metadata schema deleted", "name", name)
+	return nil
+}
+
+// loadSchema reads the schema for name from storage
+func (s *Service) loadSchema(name string) (MetadataSchema, error) {
+	fields, err := s.config.Schemas.Get(schemaNamespace, name)
+	if errors.Is(err, repository.ErrNotFound) {
+		return MetadataSchema{}, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	if err != nil {
+		return MetadataSchema{}, fmt.Errorf("get metadata schema: %w", err)
+	}
+	schema, err := parseSchema(fields)
+	if err != nil {
+		return MetadataSchema{}, fmt.Errorf("decode metadata schema %s: %w", name, err)
+	}
+	return schema, nil
+}
+
+// validateMetadata checks the request's metadata against the schema for its
+// name, if there is one, and returns validation.Errors by metadata key
+func (s *Service) validateMetadata(req RegisterRequest) error {
+	if s.config.Schemas == nil || !validation.IsID(req.Name) {
+		return nil // names that can't have a schema are never looked up
+	}
+
+	now := s.config.Clock.Now()
+	schema, fresh, generation := s.schemas.get(req.Name, now)
+	if !fresh {
+		stored, err := s.loadSchema(req.Name)
+		switch {
+		case errors.Is(err, ErrSchemaNotFound):
+			schema = nil
+		case err != nil:
+			return err
+		default:
+			if schema, err = compileSchema(stored); err != nil {
+				return fmt.Errorf("compile metadata schema %s: %w", req.Name, err)
+			}
+		}
+		s.schemas.put(req.Name, schema, now, generation)
+	}
+	if schema == nil {
+		return nil
+	}
+
+	var errs validation.Errors
+	schema.check(&errs, req.Metadata)
+	return errs.Err()
+}
+
+// schemaFields converts a schema into the generic form the config repository stores
+func schemaFields(m MetadataSchema) (map[string]any, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// parseSchema reverses schemaFields
+func parseSchema(fields map[string]any) (MetadataSchema, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return MetadataSchema{}, err
+	}
+	var schema MetadataSchema
+	err = json.Unmarshal(data, &schema)
+	return schema, err
+}
@@ -0,0 +1,188 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// invalidFields returns the fields of the validation.Errors err holds, or
+// fails the test
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation.Errors, got %v", err)
+	}
+	fields := make([]string, len(errs))
+	for i, e := range errs {
+		fields[i] = e.Field
+	}
+	return fields
+}
+
+func TestService_MetadataSchemaEnforced(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{Schemas: memory.NewConfigRepository()}, logger.NewNop())
+	ctx := context.Background()
+
+	_, created, err := svc.PutSchema(MetadataSchema{
+		Name:     "payment",
+		Required: []string{"team"},
+		Allowed:  []string{"region"},
+		Patterns: map[string]string{"team": "[a-z]+", "region": "eu|us"},
+	})
+	if err != nil || !created {
+		t.Fatalf("expected the schema created, got %v, %v", created, err)
+	}
+
+	t.Run("register", func(t *testing.T) {
+		req := newRegisterRequest("payment-1", "payment")
+		req.Metadata = map[string]string{"region": "asia", "owner": "x"}
+		_, _, err := svc.Register(ctx, req)
+		if fields := invalidFields(t, err); !slices.Equal(fields, []string{"metadata.team", "metadata.owner", "metadata.region"}) {
+			t.Errorf("expected every metadata problem, got %v", fields)
+		}
+
+		req.Metadata = map[string]string{"team": "payments", "region": "eu"}
+		if _, created, err := svc.Register(ctx, req); err != nil || !created {
+			t.Fatalf("expected conforming metadata registered, got %v, %v", created, err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		req := newRegisterRequest("payment-1", "payment")
+		req.Metadata = map[string]string{"team": "Payments"}
+		_, _, err := svc.Register(ctx, req)
+		if fields := invalidFields(t, err); !slices.Equal(fields, []string{"metadata.team"}) {
+			t.Errorf("expected the team pattern to fail in full, got %v", fields)
+		}
+
+		stored, _ := svc.Get(ctx, "payment-1")
+		if stored.Metadata["team"] != "payments" {
+			t.Errorf("expected the registration unchanged, got %v", stored.Metadata)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		doc := &Export{SchemaVersion: ExportSchemaVersion, Services: []*service.Service{
+			{ID: "payment-2", Name: "payment", Endpoints: []service.Endpoint{{URL: "http://payment-2:8080"}}},
+		}}
+		report, err := svc.Import(ctx, doc, ImportMerge)
+		if err != nil {
+			t.Fatalf("import: %v", err)
+		}
+		if report.Results[0].Result != ImportInvalid {
+			t.Errorf("expected the service without team invalid, got %+v", report.Results[0])
+		}
+	})
+}
+
+func TestService_MetadataSchemaPassthrough(t *testing.T) {
+	for name, schemas := range map[string]*memory.ConfigRepository{"no schema": memory.NewConfigRepository(), "schemas disabled": nil} {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{}
+			if schemas != nil {
+				cfg.Schemas = schemas
+			}
+			svc := NewService(memory.NewRegistryRepository(), cfg, logger.NewNop())
+
+			req := newRegisterRequest("payment-1", "payment")
+			req.Metadata = map[string]string{"anything": "goes"}
+			if _, _, err := svc.Register(context.Background(), req); err != nil {
+				t.Errorf("expected metadata unchecked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestService_MetadataSchemaCache(t *testing.T) {
+	schemas := memory.NewConfigRepository()
+	fake := clock.NewFake(time.Now())
+	svc := NewService(memory.NewRegistryRepository(), Config{Schemas: schemas, Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+
+	register := func(metadata map[string]string) error {
+		req := newRegisterRequest("payment-1", "payment")
+		req.Metadata = metadata
+		_, _, err := svc.Register(ctx, req)
+		return err
+	}
+
+	// Caches the absence of a schema
+	if err := register(nil); err != nil {
+		t.Fatalf("expected no schema enforced, got %v", err)
+	}
+
+	if _, _, err := svc.PutSchema(MetadataSchema{Name: "payment", Required: []string{"team"}}); err != nil {
+		t.Fatalf("put schema: %v", err)
+	}
+	if err := register(nil); err == nil {
+		t.Error("expected the new schema enforced at once")
+	}
+
+	if _, created, err := svc.PutSchema(MetadataSchema{Name: "payment", Required: []string{"owner"}}); err != nil || created {
+		t.Fatalf("expected the schema replaced, got %v, %v", created, err)
+	}
+	if err := register(map[string]string{"owner": "payments"}); err != nil {
+		t.Errorf("expected the replaced schema enforced, got %v", err)
+	}
+
+	if err := svc.DeleteSchema("payment"); err != nil {
+		t.Fatalf("delete schema: %v", err)
+	}
+	if err := register(nil); err != nil {
+		t.Errorf("expected the deleted schema no longer enforced, got %v", err)
+	}
+
+	t.Run("changes made elsewhere are read once the cache expires", func(t *testing.T) {
+		other := NewService(memory.NewRegistryRepository(), Config{Schemas: schemas}, logger.NewNop())
+		if _, _, err := other.PutSchema(MetadataSchema{Name: "payment", Required: []string{"team"}}); err != nil {
+			t.Fatalf("put schema: %v", err)
+		}
+		if err := register(nil); err != nil {
+			t.Errorf("expected the cached absence still trusted, got %v", err)
+		}
+		fake.Advance(schemaCacheTTL)
+		if err := register(nil); err == nil {
+			t.Error("expected the schema enforced once the cache expired")
+		}
+	})
+}
+
+func TestService_PutSchemaValidates(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{Schemas: memory.NewConfigRepository()}, logger.NewNop())
+
+	_, _, err := svc.PutSchema(MetadataSchema{
+		Name:     "payment/1",
+		Required: []string{""},
+		Patterns: map[string]string{"team": "[a-z"},
+	})
+	if fields := invalidFields(t, err); !slices.Equal(fields, []string{"name", "required[0]", "patterns.team"}) {
+		t.Errorf("expected every schema problem, got %v", fields)
+	}
+
+	if _, err := svc.Schema("payment"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+	if err := svc.DeleteSchema("payment"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+
+	for _, name := range []string{"search", "payment"} {
+		if _, _, err := svc.PutSchema(MetadataSchema{Name: name, Allowed: []string{"team"}}); err != nil {
+			t.Fatalf("put schema: %v", err)
+		}
+	}
+	schemas, err := svc.ListSchemas()
+	if err != nil || len(schemas) != 2 || schemas[0].Name != "payment" || !slices.Equal(schemas[1].Allowed, []string{"team"}) {
+		t.Errorf("expected both schemas ordered by name, got %+v, %v", schemas, err)
+	}
+}
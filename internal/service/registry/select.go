@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+)
+
+// Strategies DiscoverOne picks an instance with
+const (
+	// SelectRandom picks any matching instance with equal chance
+	SelectRandom = "random"
+	// SelectRoundRobin cycles through the matching instances in ID order
+	SelectRoundRobin = "round_robin"
+	// SelectLeastRecentlyReturned picks the matching instance this server
+	// returned longest ago, one never returned first
+	SelectLeastRecentlyReturned = "least_recently_returned"
+)
+
+// SelectStrategies lists the strategies DiscoverOne accepts
+var SelectStrategies = []string{SelectRandom, SelectRoundRobin, SelectLeastRecentlyReturned}
+
+// ErrNoInstance is returned by DiscoverOne when no instance matches
+var ErrNoInstance = errors.New("no matching instance")
+
+// DiscoverOne returns one of the services Discover would return for opts,
+// picked by strategy, for callers that want a single endpoint to call. The
+// round-robin and least-recently-returned state is kept per caller tenant
+// and options, in memory on this server only: behind a load balancer each
+// server cycles on its own, so the spread across instances is best effort.
+func (s *Service) DiscoverOne(ctx context.Context, opts DiscoverOptions, strategy string) (*service.Service, error) {
+	if !slices.Contains(SelectStrategies, strategy) {
+		return nil, fmt.Errorf("unknown selection strategy %q", strategy)
+	}
+	services, err := s.Discover(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	key := selectionKey{scope: tenant.FromContext(ctx), opts: opts}
+	if len(services) == 0 {
+		s.selections.forget(key)
+		return nil, ErrNoInstance
+	}
+	return s.selections.pick(key, services, strategy), nil
+}
+
+// selectionKey names the candidates a selection state cycles through
+type selectionKey struct {
+	scope tenant.Scope // of the caller
+	opts  DiscoverOptions
+}
+
+// selections holds the round-robin and least-recently-returned state of
+// DiscoverOne. State is dropped when its candidates run out, so it only
+// grows with the option combinations that match services.
+type selections struct {
+	mu       sync.Mutex
+	next     map[selectionKey]uint64            // round robin, the index of the next pick
+	returned map[selectionKey]map[string]uint64 // service ID -> sequence number it was last returned at
+	seq      uint64
+}
+
+func newSelections() *selections {
+	return &selections{
+		next:     make(map[selectionKey]uint64),
+		returned: make(map[selectionKey]map[string]uint64),
+	}
+}
+
+// pick returns one of candidates, which is not empty, by strategy
+func (s *selections) pick(key selectionKey, candidates []*service.Service, strategy string) *service.Service {
+	if strategy == SelectRandom {
+		return candidates[rand.IntN(len(candidates))]
+	}
+
+	// Repositories list in no particular order; cycle in ID order instead
+	candidates = slices.SortedFunc(slices.Values(candidates), func(a, b *service.Service) int { return cmp.Compare(a.ID, b.ID) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strategy == SelectRoundRobin {
+		n := s.next[key]
+		s.next[key] = n + 1
+		return candidates[n%uint64(len(candidates))]
+	}
+
+	// Instances no longer matching are forgotten; one matching again is
+	// then picked as if never returned
+	previous := s.returned[key]
+	returned := make(map[string]uint64, len(candidates))
+	for _, svc := range candidates {
+		if seq, ok := previous[svc.ID]; ok {
+			returned[svc.ID] = seq
+		}
+	}
+	s.returned[key] = returned
+	picked := slices.MinFunc(candidates, func(a, b *service.Service) int {
+		return cmp.Or(cmp.Compare(returned[a.ID], returned[b.ID]), cmp.Compare(a.ID, b.ID))
+	})
+	s.seq++
+	returned[picked.ID] = s.seq
+	return picked
+}
+
+// forget drops the state of key, whose candidates ran out
+func (s *selections) forget(key selectionKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.next, key)
+	delete(s.returned, key)
+}
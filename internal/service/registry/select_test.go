@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// registerInstances registers healthy payment instances with the given IDs
+func registerInstances(t *testing.T, repo service.RegistryRepository, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		svc := &service.Service{ID: id, Name: "payment", Capabilities: []string{"payment"}, Status: service.StatusHealthy}
+		if err := repo.Register(context.Background(), svc); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+	}
+}
+
+// pickMany returns how often DiscoverOne returned each instance over n calls
+func pickMany(t *testing.T, svc *Service, strategy string, n int) map[string]int {
+	t.Helper()
+	picks := make(map[string]int)
+	for range n {
+		picked, err := svc.DiscoverOne(context.Background(), DiscoverOptions{Capability: "payment", HealthyOnly: true}, strategy)
+		if err != nil {
+			t.Fatalf("discover one: %v", err)
+		}
+		picks[picked.ID]++
+	}
+	return picks
+}
+
+func TestService_DiscoverOneDistribution(t *testing.T) {
+	ids := []string{"payment-a", "payment-b", "payment-c", "payment-d"}
+	const calls = 4000
+
+	for _, tt := range []struct {
+		strategy string
+		// slack is how far from an even share an instance may get
+		slack int
+	}{
+		{strategy: SelectRandom, slack: calls / 10},
+		{strategy: SelectRoundRobin},
+		{strategy: SelectLeastRecentlyReturned},
+	} {
+		t.Run(tt.strategy, func(t *testing.T) {
+			repo := memory.NewRegistryRepository()
+			registerInstances(t, repo, ids...)
+			svc := NewService(repo, Config{}, logger.NewNop())
+
+			picks := pickMany(t, svc, tt.strategy, calls)
+			for _, id := range ids {
+				if share := picks[id]; share < calls/len(ids)-tt.slack || share > calls/len(ids)+tt.slack {
+					t.Errorf("expected %s picked about %d times, got %v", id, calls/len(ids), picks)
+				}
+			}
+		})
+	}
+}
+
+func TestService_DiscoverOneCycles(t *testing.T) {
+	for _, strategy := range []string{SelectRoundRobin, SelectLeastRecentlyReturned} {
+		t.Run(strategy, func(t *testing.T) {
+			repo := memory.NewRegistryRepository()
+			registerInstances(t, repo, "payment-c", "payment-a", "payment-b")
+			svc := NewService(repo, Config{}, logger.NewNop())
+
+			var got []string
+			for range 6 {
+				picked, _ := svc.DiscoverOne(context.Background(), DiscoverOptions{Capability: "payment"}, strategy)
+				got = append(got, picked.ID)
+			}
+			want := []string{"payment-a", "payment-b", "payment-c", "payment-a", "payment-b", "payment-c"}
+			if !slices.Equal(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestService_DiscoverOneHealthySetChanges(t *testing.T) {
+	for _, strategy := range SelectStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			repo := memory.NewRegistryRepository()
+			registerInstances(t, repo, "payment-a", "payment-b", "payment-c")
+			svc := NewService(repo, Config{}, logger.NewNop())
+			ctx := context.Background()
+			pickMany(t, svc, strategy, 5)
+
+			// payment-b fails its checks: it is never picked while unhealthy
+			stored, _ := repo.Get(ctx, "payment-b")
+			unhealthy := *stored
+			unhealthy.Status = service.StatusUnhealthy
+			repo.Update(ctx, &unhealthy)
+			if picks := pickMany(t, svc, strategy, 40); picks["payment-b"] != 0 || picks["payment-a"] == 0 || picks["payment-c"] == 0 {
+				t.Errorf("expected only payment-a and payment-c picked, got %v", picks)
+			}
+
+			// A new instance joins and payment-b recovers: both get their turn
+			registerInstances(t, repo, "payment-d")
+			repo.Update(ctx, stored)
+			if picks := pickMany(t, svc, strategy, 400); len(picks) != 4 {
+				t.Errorf("expected all 4 instances picked, got %v", picks)
+			}
+
+			// Every instance gone unhealthy leaves nothing to pick
+			for _, id := range []string{"payment-a", "payment-b", "payment-c", "payment-d"} {
+				current, _ := repo.Get(ctx, id)
+				down := *current
+				down.Status = service.StatusUnhealthy
+				repo.Update(ctx, &down)
+			}
+			_, err := svc.DiscoverOne(ctx, DiscoverOptions{Capability: "payment", HealthyOnly: true}, strategy)
+			if !errors.Is(err, ErrNoInstance) {
+				t.Errorf("expected ErrNoInstance, got %v", err)
+			}
+		})
+	}
+}
+
+func TestService_DiscoverOneLeastRecentlyReturnedFavorsNewInstances(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	registerInstances(t, repo, "payment-a", "payment-b")
+	svc := NewService(repo, Config{}, logger.NewNop())
+	pickMany(t, svc, SelectLeastRecentlyReturned, 3)
+
+	registerInstances(t, repo, "payment-c")
+	picked, _ := svc.DiscoverOne(context.Background(), DiscoverOptions{Capability: "payment", HealthyOnly: true}, SelectLeastRecentlyReturned)
+	if picked.ID != "payment-c" {
+		t.Errorf("expected the instance never returned picked first, got %s", picked.ID)
+	}
+}
+
+func TestService_DiscoverOneStatePerTenant(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	for _, id := range []string{"payment-a", "payment-b"} {
+		repo.Register(context.Background(), &service.Service{ID: id, TenantID: "acme", Capabilities: []string{"payment"}, Status: service.StatusHealthy})
+	}
+	svc := NewService(repo, Config{}, logger.NewNop())
+
+	var got []string
+	for i := range 4 {
+		// A caller of acme and an admin seeing every tenant alternate
+		claims := &token.Claims{Subject: "caller", TenantID: "acme"}
+		if i%2 == 1 {
+			claims = &token.Claims{Subject: "admin", Roles: []string{token.RoleAdmin}}
+		}
+		ctx := token.NewContext(context.Background(), claims)
+		picked, err := svc.DiscoverOne(ctx, DiscoverOptions{Capability: "payment"}, SelectRoundRobin)
+		if err != nil {
+			t.Fatalf("discover one as %v: %v", tenant.FromContext(ctx), err)
+		}
+		got = append(got, picked.ID)
+	}
+	if want := []string{"payment-a", "payment-a", "payment-b", "payment-b"}; !slices.Equal(got, want) {
+		t.Errorf("expected each tenant scope to cycle on its own, %v, got %v", want, got)
+	}
+}
+
+func TestService_DiscoverOneUnknownStrategy(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	if _, err := svc.DiscoverOne(context.Background(), DiscoverOptions{}, "fastest"); err == nil {
+		t.Error("expected an unknown strategy refused")
+	}
+}
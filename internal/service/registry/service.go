@@ -1 +1,739 @@
 package registry
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/internal/stats"
+	"github.com/aq189/bin/internal/validate"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+var (
+	// ErrServiceConflict is returned when an ID is already registered under a different name
+	ErrServiceConflict = errors.New("service id already registered")
+	// ErrServiceNotFound is returned when no service is registered under an ID
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrServiceGone is returned by Heartbeat when the service was deregistered
+	// and is waiting to be purged
+	ErrServiceGone = errors.New("service deregistered")
+	// ErrServiceNotDeleted is returned by Restore when the service is registered
+	ErrServiceNotDeleted = errors.New("service is not deregistered")
+	// ErrImportRolledBack is returned by Import when a storage error aborted an
+	// import run as one transaction, leaving the registry as it was. Only
+	// repositories implementing repository.Transactor (memory and postgres)
+	// import atomically; on redis each service is stored on its own, a failed
+	// service is reported in the ImportReport and the rest are still imported.
+	ErrImportRolledBack = errors.New("import rolled back")
+)
+
+// Defaults applied when the configuration leaves health checking unset
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultMinCheckInterval    = 5 * time.Second
+	defaultMaxCheckInterval    = time.Hour
+	defaultHealthCheckWorkers  = 8
+	defaultDeletedRetention    = 24 * time.Hour
+	defaultHealthWriteBatch    = 100
+	defaultHealthWriteDelay    = 50 * time.Millisecond
+)
+
+// Config holds registry service settings
+type Config struct {
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	// MinCheckInterval and MaxCheckInterval bound the check interval a
+	// registration may ask for; zero uses 5 seconds and one hour
+	MinCheckInterval time.Duration
+	MaxCheckInterval time.Duration
+	// HealthCheckWorkers is how many services are checked at once; zero uses 8
+	HealthCheckWorkers int
+	// HealthCheckTransport sends health check requests; nil uses
+	// TargetPolicy.Transport, or http.DefaultTransport without a policy
+	HealthCheckTransport http.RoundTripper
+	// TargetPolicy restricts the addresses health checks may reach, checked on
+	// registration and before every probe; nil allows any. A HealthCheckTransport
+	// should send through TargetPolicy.Transport, which also checks the
+	// addresses it connects to.
+	TargetPolicy *TargetPolicy
+	// HeartbeatTimeout is how long a service without a health check URL stays
+	// healthy after its last heartbeat; zero never expires heartbeats
+	HeartbeatTimeout time.Duration
+	// DeletedRetention is how long a deregistered service can be restored
+	// before it is purged; zero uses 24 hours
+	DeletedRetention time.Duration
+	// MaxDiscoverWait caps how long a discovery request may wait for the
+	// registry to change; zero uses one minute
+	MaxDiscoverWait time.Duration
+	// HealthHistorySize is how many health check results are kept per
+	// service; zero uses 50
+	HealthHistorySize int
+	// HealthWriteRate caps the services per second whose health check
+	// results are stored, the rest waiting for the next pass; zero stores
+	// every change a pass finds
+	HealthWriteRate float64
+	// HealthWriteBatch is how many health check results are stored together,
+	// in one BatchUpdate where the repository supports it; zero uses 100
+	HealthWriteBatch int
+	// HealthWriteDelay is the pause between batches; zero uses 50ms
+	HealthWriteDelay time.Duration
+	// Events receives registrations, deregistrations and status changes; nil publishes nothing
+	Events event.Publisher
+	// Bus shares the same events with the other instances and brings theirs
+	// to this one, waking WaitForChange without waiting for its recheck; nil
+	// shares nothing
+	Bus event.Bus
+	// Journal records every mutation for debugging and replay; nil records nothing
+	Journal journal.Recorder
+	// Registered counts new registrations, for Counts; nil counts nothing
+	Registered *stats.Counter
+	// Schemas stores the metadata schemas registrations are checked against,
+	// by service name; nil checks no metadata and manages no schemas
+	Schemas config.ConfigRepository
+	// MeterProvider records the health check writes queued, stored and
+	// deferred; nil records nothing
+	MeterProvider metric.MeterProvider
+	// Clock stamps registrations and heartbeats and schedules health checks
+	// and purges; nil uses the system clock
+	Clock clock.Clock
+}
+
+// Service manages service registrations and their health
+type Service struct {
+	repo    service.RegistryRepository
+	config  Config
+	logger  logger.ILogger
+	probers map[string]prober // by service.HealthCheck type
+	changes *changeNotifier   // wakes WaitForChange
+	history *healthHistory    // recent health check results, in memory only
+	writes  *writeCoalescer   // health check results waiting to be stored
+	// selections is the round-robin and least-recently-returned state of DiscoverOne
+	selections *selections
+	schemas    *schemaCache // metadata schemas by service name
+}
+
+// RegisterRequest represents a service registration request
+type RegisterRequest struct {
+	ID           string             `json:"id" validate:"required,serviceid"`
+	Name         string             `json:"name" validate:"required"`
+	InstanceID   string             `json:"instance_id,omitempty" validate:"omitempty,serviceid"` // registers one instance of service Name
+	Version      string             `json:"version"`
+	Endpoints    []service.Endpoint `json:"endpoints" validate:"required"`
+	Capabilities []string           `json:"capabilities" validate:"dive,capability"`
+	DependsOn    []string           `json:"depends_on,omitempty" validate:"dive,capability"` // capabilities the service needs from others
+	// Metadata values are at most validation.MaxMetadataValueLength characters
+	Metadata map[string]string `json:"metadata,omitempty" validate:"dive,max=256"`
+	// HealthCheckURL registers an http health check expecting a 2xx, as
+	// before HealthCheck existed; when both are set it must match HealthCheck
+	HealthCheckURL string               `json:"health_check_url,omitempty"`
+	HealthCheck    *service.HealthCheck `json:"health_check,omitempty"`
+	// CheckIntervalSeconds asks for checks at another interval than the
+	// registry's, within the bounds it is configured with; 0 uses its own
+	CheckIntervalSeconds int `json:"check_interval_seconds,omitempty" validate:"min=0"`
+}
+
+// Validate checks the request against its validate tags and the rules
+// spanning several fields, and returns validation.Errors listing every
+// invalid field
+func (r RegisterRequest) Validate() error {
+	var errs validation.Errors
+	if err := validate.Validate(r); err != nil && !errors.As(err, &errs) {
+		return err
+	}
+
+	switch {
+	case r.HealthCheck != nil:
+		validateHealthCheck(&errs, r.HealthCheck, r.Endpoints)
+		check := r.healthCheck()
+		if r.HealthCheckURL != "" && (check.Type != service.HealthCheckHTTP || r.HealthCheckURL != check.URL) {
+			errs.Add("health_check_url", "must be empty or the url of an http health_check")
+		}
+	case r.HealthCheckURL != "" && !validHealthCheckURL(r.HealthCheckURL, r.Endpoints):
+		errs.Add("health_check_url", "must be an absolute http or https URL once "+service.EndpointPlaceholder+" is replaced by an endpoint")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(r.Metadata)) {
+		if key == "" || len(key) > validation.MaxMetadataKeyLength {
+			errs.Add("metadata", fmt.Sprintf("key %q must be 1 to %d characters", key, validation.MaxMetadataKeyLength))
+		}
+	}
+	if url, ok := r.Metadata[service.MetadataCallbackURL]; ok && !validation.IsHTTPURL(url) {
+		errs.Add("metadata."+service.MetadataCallbackURL, "must be an absolute http or https URL")
+	}
+
+	return errs.Err()
+}
+
+// validateHealthCheck adds the problems of a requested health check that
+// depend on its type to errs; its tags cover the rest
+func validateHealthCheck(errs *validation.Errors, check *service.HealthCheck, endpoints []service.Endpoint) {
+	switch cmp.Or(check.Type, service.HealthCheckHTTP) {
+	case service.HealthCheckHTTP:
+		if !validHealthCheckURL(check.URL, endpoints) {
+			errs.Add("health_check.url", "must be an absolute http or https URL once "+service.EndpointPlaceholder+" is replaced by an endpoint")
+		}
+	case service.HealthCheckTCP:
+		if !validation.IsHostPort(check.URL) {
+			errs.Add("health_check.url", "must be a host:port address")
+		}
+		if len(check.ExpectedStatusCodes) > 0 {
+			errs.Add("health_check.expected_status_codes", "only applies to http health checks")
+		}
+		if check.ExpectedBodySubstring != "" {
+			errs.Add("health_check.expected_body_substring", "only applies to http health checks")
+		}
+	}
+}
+
+// healthCheck returns the health check to store for the request: HealthCheck
+// with its type defaulted, an http check built from HealthCheckURL when only
+// that is set, or nil
+func (r RegisterRequest) healthCheck() *service.HealthCheck {
+	if r.HealthCheck == nil {
+		if r.HealthCheckURL == "" {
+			return nil
+		}
+		return &service.HealthCheck{Type: service.HealthCheckHTTP, URL: r.HealthCheckURL}
+	}
+
+	check := *r.HealthCheck
+	check.Type = cmp.Or(check.Type, service.HealthCheckHTTP)
+	check.ExpectedStatusCodes = slices.Clone(check.ExpectedStatusCodes)
+	return &check
+}
+
+// healthCheckURL returns the HealthCheckURL stored alongside a health check
+// so clients reading only that field keep seeing http checks
+func healthCheckURL(check *service.HealthCheck) string {
+	if check == nil || check.Type != service.HealthCheckHTTP {
+		return ""
+	}
+	return check.URL
+}
+
+// validHealthCheckURL reports whether the health check URL, or every URL it
+// expands to when templated with service.EndpointPlaceholder, is absolute http(s)
+func validHealthCheckURL(url string, endpoints []service.Endpoint) bool {
+	if !strings.Contains(url, service.EndpointPlaceholder) {
+		return validation.IsHTTPURL(url)
+	}
+	for _, endpoint := range endpoints {
+		if !validation.IsHTTPURL(endpoint.HealthCheckURL(url)) {
+			return false
+		}
+	}
+	return true
+}
+
+// newEndpoints returns the endpoints as stored for a new or imported
+// registration: a weight of 0 counts as 1, and every endpoint starts out
+// healthy and unchecked whatever the caller sent
+func newEndpoints(endpoints []service.Endpoint) []service.Endpoint {
+	stored := make([]service.Endpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		stored[i] = service.Endpoint{URL: endpoint.URL, Weight: max(endpoint.Weight, 1), Healthy: true}
+	}
+	return stored
+}
+
+// NewService creates a new registry service
+func NewService(repo service.RegistryRepository, cfg Config, log logger.ILogger) *Service {
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = defaultHealthCheckInterval
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		cfg.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+	if cfg.MinCheckInterval <= 0 {
+		cfg.MinCheckInterval = defaultMinCheckInterval
+	}
+	if cfg.MaxCheckInterval <= 0 {
+		cfg.MaxCheckInterval = defaultMaxCheckInterval
+	}
+	cfg.MaxCheckInterval = max(cfg.MaxCheckInterval, cfg.MinCheckInterval)
+	if cfg.HealthCheckWorkers <= 0 {
+		cfg.HealthCheckWorkers = defaultHealthCheckWorkers
+	}
+	if cfg.DeletedRetention <= 0 {
+		cfg.DeletedRetention = defaultDeletedRetention
+	}
+	if cfg.MaxDiscoverWait <= 0 {
+		cfg.MaxDiscoverWait = defaultMaxDiscoverWait
+	}
+	if cfg.HealthHistorySize <= 0 {
+		cfg.HealthHistorySize = defaultHealthHistorySize
+	}
+	if cfg.HealthWriteBatch <= 0 {
+		cfg.HealthWriteBatch = defaultHealthWriteBatch
+	}
+	if cfg.HealthWriteDelay <= 0 {
+		cfg.HealthWriteDelay = defaultHealthWriteDelay
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+
+	client := &http.Client{Transport: cfg.HealthCheckTransport}
+	tcp := &tcpProber{}
+	if cfg.TargetPolicy != nil {
+		if client.Transport == nil {
+			client.Transport = cfg.TargetPolicy.Transport()
+		}
+		client.CheckRedirect = cfg.TargetPolicy.checkRedirect
+		tcp.dialer.Control = cfg.TargetPolicy.control
+	}
+
+	s := &Service{
+		repo:   repo,
+		config: cfg,
+		logger: log,
+		probers: map[string]prober{
+			service.HealthCheckHTTP: httpProber{client: client},
+			service.HealthCheckTCP:  tcp,
+		},
+		changes: newChangeNotifier(),
+		history: newHealthHistory(cfg.HealthHistorySize),
+		writes:  newWriteCoalescer(cfg.HealthWriteRate, cfg.MeterProvider),
+
+		selections: newSelections(),
+		schemas:    newSchemaCache(),
+	}
+	if cfg.Bus != nil {
+		cfg.Bus.Subscribe(s.observe)
+	}
+	return s
+}
+
+// Register registers a service owned by the caller's tenant. A new ID is
+// created; an existing ID with the same name is treated as a re-registration that refreshes the record but keeps
+// its original RegisteredAt and any operator status override; an existing ID with a different name or
+// owned by another tenant is a conflict. Service IDs are unique across tenants.
+// A deregistered service not yet purged is replaced by the new registration.
+// Metadata must conform to the schema stored for the name, if there is one.
+// The returned bool reports whether a new registration was created.
+func (s *Service) Register(ctx context.Context, req RegisterRequest) (*service.Service, bool, error) {
+	if err := req.Validate(); err != nil {
+		return nil, false, err
+	}
+	if err := s.validateTargets(ctx, req); err != nil {
+		return nil, false, err
+	}
+	if err := s.validateCheckInterval(req); err != nil {
+		return nil, false, err
+	}
+	if err := s.validateMetadata(req); err != nil {
+		return nil, false, err
+	}
+
+	scope := tenant.FromContext(ctx)
+	now := s.config.Clock.Now()
+	check := req.healthCheck()
+	svc := &service.Service{
+		ID:                   req.ID,
+		TenantID:             scope.ID,
+		Name:                 req.Name,
+		InstanceID:           req.InstanceID,
+		Version:              req.Version,
+		Endpoints:            newEndpoints(req.Endpoints),
+		Capabilities:         req.Capabilities,
+		DependsOn:            req.DependsOn,
+		Metadata:             req.Metadata,
+		Status:               service.StatusHealthy,
+		RegisteredAt:         now,
+		LastHeartbeat:        now,
+		HealthCheckURL:       healthCheckURL(check),
+		HealthCheck:          check,
+		CheckIntervalSeconds: req.CheckIntervalSeconds,
+	}
+
+	existing, err := s.repo.CreateIfAbsent(ctx, svc)
+	if err != nil {
+		return nil, false, fmt.Errorf("register service: %w", err)
+	}
+
+	if existing == nil {
+		s.changed(ctx)
+		s.logger.Info("service registered", "service_id", svc.ID, "name", svc.Name, "instance_id", svc.InstanceID, "version", svc.Version)
+		s.record(ctx, journal.Entry{Op: journal.OpRegister, ServiceID: svc.ID, AfterStatus: svc.Status, Service: svc})
+		s.publish(ctx, event.ServiceRegistered, svc)
+		s.config.Registered.Add(now, 1)
+		return svc, true, nil
+	}
+
+	if !scope.Allows(existing.TenantID) {
+		s.logger.Warn("service id conflict", "service_id", svc.ID, "tenant", svc.TenantID, "registered_tenant", existing.TenantID)
+		return nil, false, fmt.Errorf("%w: %q", ErrServiceConflict, svc.ID)
+	}
+	if existing.IsDeleted() {
+		if err := s.repo.Register(ctx, svc); err != nil {
+			return nil, false, fmt.Errorf("register service: %w", err)
+		}
+		s.changed(ctx)
+		s.logger.Info("service registered", "service_id", svc.ID, "name", svc.Name, "instance_id", svc.InstanceID, "version", svc.Version, "replaced_deleted", true)
+		s.record(ctx, journal.Entry{Op: journal.OpRegister, ServiceID: svc.ID, BeforeStatus: existing.Status, AfterStatus: svc.Status, Service: svc})
+		s.publish(ctx, event.ServiceRegistered, svc)
+		s.config.Registered.Add(now, 1)
+		return svc, true, nil
+	}
+	if existing.Name != svc.Name {
+		s.logger.Warn("service id conflict",
+			"service_id", svc.ID, "name", svc.Name, "registered_name", existing.Name)
+		return nil, false, fmt.Errorf("%w: %q belongs to %q", ErrServiceConflict, svc.ID, existing.Name)
+	}
+
+	svc.TenantID = existing.TenantID
+	svc.RegisteredAt = existing.RegisteredAt
+	if existing.OverrideStatus {
+		svc.Status = existing.Status
+		svc.OverrideStatus = true
+	}
+	if err := s.repo.Update(ctx, svc); err != nil {
+		return nil, false, fmt.Errorf("re-register service: %w", err)
+	}
+	s.changed(ctx)
+
+	s.logger.Info("service re-registered", "service_id", svc.ID, "name", svc.Name, "instance_id", svc.InstanceID, "version", svc.Version)
+	s.record(ctx, journal.Entry{Op: journal.OpRegister, ServiceID: svc.ID, BeforeStatus: existing.Status, AfterStatus: svc.Status, Service: svc})
+	s.publish(ctx, event.ServiceRegistered, svc)
+	return svc, false, nil
+}
+
+// Deregister soft-deletes a service: it disappears from listings and
+// discovery but can be restored until the purge loop removes it once
+// Config.DeletedRetention has passed. Unknown and already deregistered
+// services, and services of other tenants, are left alone.
+func (s *Service) Deregister(ctx context.Context, id string) error {
+	existing, err := s.find(ctx, id)
+	if errors.Is(err, ErrServiceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deregister service: %w", err)
+	}
+	if existing.IsDeleted() {
+		return nil
+	}
+
+	// Store a copy; the repository may hand out the value it holds
+	deleted := *existing
+	deleted.DeletedAt = s.config.Clock.Now()
+	err = s.repo.Update(ctx, &deleted)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deregister service: %w", err)
+	}
+	s.changed(ctx)
+	s.history.forget(id)
+
+	s.logger.Info("service deregistered", "service_id", id)
+	s.record(ctx, journal.Entry{Op: journal.OpDeregister, ServiceID: id, BeforeStatus: existing.Status, AfterStatus: deleted.Status})
+	s.publish(ctx, event.ServiceDeregistered, &deleted)
+	return nil
+}
+
+// Restore brings back a deregistered service that has not been purged yet.
+// It returns ErrServiceNotDeleted when the service is registered.
+func (s *Service) Restore(ctx context.Context, id string) (*service.Service, error) {
+	existing, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !existing.IsDeleted() {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotDeleted, id)
+	}
+
+	restored := *existing
+	restored.DeletedAt = time.Time{}
+	err = s.repo.Update(ctx, &restored)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restore service: %w", err)
+	}
+	s.changed(ctx)
+
+	s.logger.Info("service restored", "service_id", id, "deleted_at", existing.DeletedAt)
+	s.record(ctx, journal.Entry{Op: journal.OpRestore, ServiceID: id, BeforeStatus: existing.Status, AfterStatus: restored.Status})
+	s.publish(ctx, event.ServiceRegistered, &restored)
+	return &restored, nil
+}
+
+// Get retrieves a service by ID. Deregistered services and services of other
+// tenants are reported as not found.
+func (s *Service) Get(ctx context.Context, id string) (*service.Service, error) {
+	svc, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if svc.IsDeleted() {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+	}
+	return svc, nil
+}
+
+// find retrieves a service by ID, deregistered or not. Services of other
+// tenants are reported as not found.
+func (s *Service) find(ctx context.Context, id string) (*service.Service, error) {
+	svc, err := s.repo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get service: %w", err)
+	}
+	if !tenant.FromContext(ctx).Allows(svc.TenantID) {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+	}
+	return svc, nil
+}
+
+// List returns all services registered within the caller's tenant
+func (s *Service) List(ctx context.Context) ([]*service.Service, error) {
+	services, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return visible(ctx, services), nil
+}
+
+// ListPaged returns one page of the services registered within the caller's
+// tenant that match filter, including draining ones and, when
+// filter.IncludeDeleted is set, deregistered ones not yet purged. The
+// repository applies the filter; filter.Scope is replaced by the caller's.
+func (s *Service) ListPaged(ctx context.Context, filter service.ListFilter, opts pagination.ListOptions) (pagination.Page[*service.Service], error) {
+	filter.Scope = tenant.FromContext(ctx)
+	services, total, err := s.repo.ListPaged(ctx, filter, opts)
+	if err != nil {
+		return pagination.Page[*service.Service]{}, fmt.Errorf("list services: %w", err)
+	}
+	return pagination.NewPage(services, total, opts), nil
+}
+
+// ListGroups returns one page of the logical services within the caller's
+// tenant ordered by name, each with its instances, including draining ones.
+// Registrations without an InstanceID are single-instance services named by
+// their ID. Grouping needs every registration, so the page is cut in memory.
+func (s *Service) ListGroups(ctx context.Context, opts pagination.ListOptions) (pagination.Page[*service.Group], error) {
+	services, err := s.List(ctx)
+	if err != nil {
+		return pagination.Page[*service.Group]{}, fmt.Errorf("list services: %w", err)
+	}
+	groups := service.GroupInstances(services)
+	start, end := opts.Window(len(groups))
+	return pagination.NewPage(groups[start:end], len(groups), opts), nil
+}
+
+// DiscoverOptions narrows the services Discover returns
+type DiscoverOptions struct {
+	// Capability selects services advertising it; empty selects all services
+	Capability string
+	// HealthyEndpointsOnly leaves out services none of whose endpoints passed
+	// their last health check
+	HealthyEndpointsOnly bool
+	// HealthyOnly leaves out instances whose effective status is not healthy
+	HealthyOnly bool
+}
+
+// Discover returns the services within the caller's tenant matching opts.
+// Draining services are left out. Repositories implementing
+// service.CapabilityFinder are queried through their index; others are scanned.
+func (s *Service) Discover(ctx context.Context, opts DiscoverOptions) ([]*service.Service, error) {
+	var services []*service.Service
+	var err error
+	if finder, ok := s.repo.(service.CapabilityFinder); ok && opts.Capability != "" {
+		services, err = finder.FindByCapability(ctx, opts.Capability)
+	} else {
+		services, err = s.repo.List(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scope := tenant.FromContext(ctx)
+	now := s.config.Clock.Now()
+	matched := make([]*service.Service, 0, len(services))
+	for _, svc := range services {
+		if !svc.IsDiscoverable() || !scope.Allows(svc.TenantID) {
+			continue
+		}
+		if opts.HealthyEndpointsOnly && !svc.HasHealthyEndpoint() {
+			continue
+		}
+		if opts.HealthyOnly && EffectiveStatus(svc, s.config.HeartbeatTimeout, now) != service.StatusHealthy {
+			continue
+		}
+		if opts.Capability == "" || slices.Contains(svc.Capabilities, opts.Capability) {
+			matched = append(matched, svc)
+		}
+	}
+	return matched, nil
+}
+
+// SetStatus applies an operator status. Draining sets an override that health
+// checks and heartbeats leave alone; healthy clears it.
+func (s *Service) SetStatus(ctx context.Context, id string, status service.Status) (*service.Service, error) {
+	if status != service.StatusDraining && status != service.StatusHealthy {
+		var errs validation.Errors
+		errs.Add("status", fmt.Sprintf("must be %q or %q", service.StatusDraining, service.StatusHealthy))
+		return nil, errs.Err()
+	}
+
+	svc, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store a copy; the repository may hand out the value it holds
+	updated := *svc
+	updated.Status = status
+	updated.OverrideStatus = status == service.StatusDraining
+	err = s.repo.Update(ctx, &updated)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set service status: %w", err)
+	}
+	s.changed(ctx)
+
+	s.logger.Info("service status set", "service_id", id, "status", status, "override", updated.OverrideStatus)
+	s.record(ctx, journal.Entry{Op: journal.OpSetStatus, ServiceID: id, BeforeStatus: svc.Status, AfterStatus: status})
+	if svc.Status != status {
+		s.publish(ctx, event.ServiceStatusChanged, &updated)
+	}
+	return &updated, nil
+}
+
+// Heartbeat records a heartbeat for a service. Repositories implementing
+// service.HeartbeatUpdater update it in place so concurrent writes to the same
+// service are not lost; others fall back to reading and rewriting it. A
+// deregistered service is not brought back: Heartbeat returns ErrServiceGone.
+func (s *Service) Heartbeat(ctx context.Context, id string) error {
+	if updater, ok := s.repo.(service.HeartbeatUpdater); ok {
+		if !tenant.FromContext(ctx).All {
+			if _, err := s.find(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		err := updater.UpdateHeartbeat(ctx, id, s.config.Clock.Now())
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+		}
+		if errors.Is(err, service.ErrServiceDeleted) {
+			return fmt.Errorf("%w: %s", ErrServiceGone, id)
+		}
+		if err != nil {
+			return fmt.Errorf("update heartbeat: %w", err)
+		}
+		// The repository moves the revision itself when the status changes
+		s.changes.notify()
+		s.record(ctx, journal.Entry{Op: journal.OpHeartbeat, ServiceID: id})
+		return nil
+	}
+
+	stored, err := s.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	if stored.IsDeleted() {
+		return fmt.Errorf("%w: %s", ErrServiceGone, id)
+	}
+
+	svc := *stored
+	svc.UpdateHeartbeat(s.config.Clock.Now())
+	err = s.repo.Update(ctx, &svc)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("update heartbeat: %w", err)
+	}
+	if svc.Status != stored.Status {
+		s.changed(ctx)
+	}
+	s.record(ctx, journal.Entry{Op: journal.OpHeartbeat, ServiceID: id, BeforeStatus: stored.Status, AfterStatus: svc.Status})
+	return nil
+}
+
+// Revision returns the registry revision. Listings read at the same revision
+// hold the same services, so it can tag responses for conditional requests.
+func (s *Service) Revision(ctx context.Context) (int64, error) {
+	revision, err := s.repo.GetRevision(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get registry revision: %w", err)
+	}
+	return revision, nil
+}
+
+// changed moves the registry revision forward after a write and wakes
+// WaitForChange. The write already happened, so a failure is logged rather
+// than returned; listings then keep their previous revision until the next
+// change.
+func (s *Service) changed(ctx context.Context) {
+	if _, err := s.repo.BumpRevision(ctx); err != nil {
+		s.logger.Error("failed to bump registry revision", "error", err)
+	}
+	s.changes.notify()
+}
+
+// publish sends an event about svc to the configured publisher and bus, if
+// any. The event carries a copy, so later changes to svc do not leak into it.
+func (s *Service) publish(ctx context.Context, eventType string, svc *service.Service) {
+	if s.config.Events == nil && s.config.Bus == nil {
+		return
+	}
+	copied := *svc
+	e := event.New(eventType, svc.TenantID, &copied)
+	if s.config.Events != nil {
+		s.config.Events.Publish(ctx, e)
+	}
+	if s.config.Bus != nil {
+		s.config.Bus.Publish(ctx, e)
+	}
+}
+
+// record hands a mutation to the configured journal, if any, stamped with
+// the registry's clock. The entry carries a copy of its service.
+func (s *Service) record(ctx context.Context, e journal.Entry) {
+	if s.config.Journal == nil {
+		return
+	}
+	e.Time = s.config.Clock.Now().UTC()
+	if e.Service != nil {
+		copied := *e.Service
+		e.Service = &copied
+	}
+	s.config.Journal.Record(ctx, e)
+}
+
+// visible returns the services within the caller's tenant
+func visible(ctx context.Context, services []*service.Service) []*service.Service {
+	scope := tenant.FromContext(ctx)
+	if scope.All {
+		return services
+	}
+	return slices.DeleteFunc(services, func(svc *service.Service) bool {
+		return !scope.Allows(svc.TenantID)
+	})
+}
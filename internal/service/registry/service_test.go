@@ -0,0 +1,850 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func newRegisterRequest(id, name string) RegisterRequest {
+	return RegisterRequest{
+		ID:           id,
+		Name:         name,
+		Version:      "1.0.0",
+		Endpoints:    []service.Endpoint{{URL: "http://" + id + ":8080"}},
+		Capabilities: []string{"payment"},
+	}
+}
+
+func TestService_Register(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	svc := NewService(memory.NewRegistryRepository(), Config{Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+
+	first, created, err := svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("new id is created", func(t *testing.T) {
+		if !created {
+			t.Error("expected a new registration")
+		}
+		if first.RegisteredAt.IsZero() {
+			t.Error("expected RegisteredAt to be set")
+		}
+		if want := []service.Endpoint{{URL: "http://payment-1:8080", Weight: 1, Healthy: true}}; !slices.Equal(first.Endpoints, want) {
+			t.Errorf("expected endpoints to default to weight 1 and healthy, got %+v", first.Endpoints)
+		}
+	})
+
+	t.Run("same name re-registers and keeps RegisteredAt", func(t *testing.T) {
+		fake.Advance(time.Minute)
+
+		req := newRegisterRequest("payment-1", "payment-service")
+		req.Version = "1.1.0"
+		req.Endpoints = []service.Endpoint{{URL: "http://payment-1b:8080"}}
+
+		again, created, err := svc.Register(ctx, req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created {
+			t.Error("expected re-registration, got new registration")
+		}
+		if !again.RegisteredAt.Equal(first.RegisteredAt) {
+			t.Errorf("expected RegisteredAt %v to be preserved, got %v", first.RegisteredAt, again.RegisteredAt)
+		}
+
+		stored, _ := svc.Get(ctx, "payment-1")
+		if stored.Version != "1.1.0" || stored.Endpoints[0].URL != "http://payment-1b:8080" {
+			t.Errorf("expected updated registration, got %+v", stored)
+		}
+		if !stored.RegisteredAt.Equal(first.RegisteredAt) {
+			t.Errorf("expected stored RegisteredAt %v, got %v", first.RegisteredAt, stored.RegisteredAt)
+		}
+	})
+
+	t.Run("different name conflicts", func(t *testing.T) {
+		_, _, err := svc.Register(ctx, newRegisterRequest("payment-1", "billing-service"))
+		if !errors.Is(err, ErrServiceConflict) {
+			t.Fatalf("expected ErrServiceConflict, got %v", err)
+		}
+
+		stored, _ := svc.Get(ctx, "payment-1")
+		if stored.Name != "payment-service" {
+			t.Errorf("expected original registration to survive, got name %q", stored.Name)
+		}
+	})
+}
+
+func TestService_Heartbeat(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	if err := svc.Heartbeat(ctx, "missing"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+
+	svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+	if err := svc.Heartbeat(ctx, "payment-1"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// readWriteRepository hides the repository's optional interfaces so the
+// service falls back to reading, scanning and rewriting services
+type readWriteRepository struct {
+	service.RegistryRepository
+}
+
+func TestService_Discover(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+
+	repo.Register(ctx, &service.Service{ID: "payment-1", Capabilities: []string{"payment"}})
+	repo.Register(ctx, &service.Service{ID: "payment-2", Capabilities: []string{"payment"}, Status: service.StatusDraining})
+	repo.Register(ctx, &service.Service{ID: "search-1", Capabilities: []string{"search"}})
+
+	tests := []struct {
+		capability string
+		want       []string
+	}{
+		{capability: "payment", want: []string{"payment-1"}},
+		{capability: "", want: []string{"payment-1", "search-1"}},
+		{capability: "unknown"},
+	}
+
+	for name, backend := range map[string]service.RegistryRepository{"index": repo, "scan": readWriteRepository{repo}} {
+		svc := NewService(backend, Config{}, logger.NewNop())
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.capability, func(t *testing.T) {
+				found, err := svc.Discover(ctx, DiscoverOptions{Capability: tt.capability})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				var ids []string
+				for _, s := range found {
+					ids = append(ids, s.ID)
+				}
+				slices.Sort(ids)
+				if !slices.Equal(ids, tt.want) {
+					t.Errorf("expected %v, got %v", tt.want, ids)
+				}
+			})
+		}
+	}
+}
+
+func TestService_DiscoverHealthyInstances(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	now := fake.Now()
+
+	repo.Register(ctx, &service.Service{ID: "payment-a", Name: "payment", InstanceID: "a", Capabilities: []string{"payment"}, Status: service.StatusHealthy, LastHeartbeat: now})
+	repo.Register(ctx, &service.Service{ID: "payment-b", Name: "payment", InstanceID: "b", Capabilities: []string{"payment"}, Status: service.StatusUnhealthy, LastHeartbeat: now})
+	repo.Register(ctx, &service.Service{ID: "payment-c", Name: "payment", InstanceID: "c", Capabilities: []string{"payment"}, Status: service.StatusHealthy, LastHeartbeat: now.Add(-time.Minute)})
+	repo.Register(ctx, &service.Service{ID: "payment-legacy", Name: "payment", Capabilities: []string{"payment"}, Status: service.StatusHealthy, LastHeartbeat: now})
+
+	svc := NewService(repo, Config{Clock: fake, HeartbeatTimeout: 30 * time.Second}, logger.NewNop())
+	found, err := svc.Discover(ctx, DiscoverOptions{Capability: "payment", HealthyOnly: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var ids []string
+	for _, s := range found {
+		ids = append(ids, s.ID)
+	}
+	slices.Sort(ids)
+	// payment-c's heartbeat expired although the health loop hasn't stored it yet
+	if want := []string{"payment-a", "payment-legacy"}; !slices.Equal(ids, want) {
+		t.Errorf("expected %v, got %v", want, ids)
+	}
+}
+
+func TestService_ListGroups(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	for _, req := range []RegisterRequest{
+		newRegisterRequest("search", "search"),
+		newRegisterRequest("payment-b", "payment"),
+		newRegisterRequest("payment-a", "payment"),
+		newRegisterRequest("auth-1", "auth"),
+	} {
+		if strings.HasPrefix(req.ID, "payment-") {
+			req.InstanceID = strings.TrimPrefix(req.ID, "payment-")
+		}
+		if _, _, err := svc.Register(ctx, req); err != nil {
+			t.Fatalf("register %s: %v", req.ID, err)
+		}
+	}
+	if err := svc.Deregister(ctx, "search"); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     pagination.ListOptions
+		want     []string // group keys with their instance IDs
+		wantNext int      // 0 on the last page
+	}{
+		{name: "all", opts: pagination.ListOptions{}, want: []string{"auth-1:auth-1", "payment:payment-a,payment-b"}},
+		{name: "first page", opts: pagination.ListOptions{Limit: 1}, want: []string{"auth-1:auth-1"}, wantNext: 1},
+		{name: "last page", opts: pagination.ListOptions{Limit: 1, Offset: 1}, want: []string{"payment:payment-a,payment-b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := svc.ListGroups(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			var got []string
+			for _, g := range page.Items {
+				var ids []string
+				for _, instance := range g.Instances {
+					ids = append(ids, instance.ID)
+				}
+				got = append(got, g.Key+":"+strings.Join(ids, ","))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			if page.Total != 2 {
+				t.Errorf("expected 2 groups in total, got %d", page.Total)
+			}
+			switch {
+			case tt.wantNext == 0 && page.NextOffset != nil:
+				t.Errorf("expected no next offset, got %d", *page.NextOffset)
+			case tt.wantNext > 0 && (page.NextOffset == nil || *page.NextOffset != tt.wantNext):
+				t.Errorf("expected next offset %d, got %v", tt.wantNext, page.NextOffset)
+			}
+		})
+	}
+}
+
+func BenchmarkService_Discover(b *testing.B) {
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	for i := range 10000 {
+		repo.Register(ctx, &service.Service{
+			ID:           fmt.Sprintf("svc-%d", i),
+			Capabilities: []string{fmt.Sprintf("capability-%d", i%100)},
+		})
+	}
+
+	for name, backend := range map[string]service.RegistryRepository{"index": repo, "scan": readWriteRepository{repo}} {
+		svc := NewService(backend, Config{}, logger.NewNop())
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				svc.Discover(ctx, DiscoverOptions{Capability: "capability-7"})
+			}
+		})
+	}
+}
+
+func TestService_HeartbeatWithoutUpdater(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	svc := NewService(readWriteRepository{repo}, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	if err := svc.Heartbeat(ctx, "missing"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+
+	repo.Register(ctx, &service.Service{ID: "payment-1", Status: service.StatusUnhealthy})
+	if err := svc.Heartbeat(ctx, "payment-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	stored, _ := repo.Get(ctx, "payment-1")
+	if stored.Status != service.StatusHealthy || stored.LastHeartbeat.IsZero() {
+		t.Errorf("expected healthy with a heartbeat, got %s at %v", stored.Status, stored.LastHeartbeat)
+	}
+}
+
+func TestService_RevisionMovesOnChanges(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{HeartbeatTimeout: time.Minute}, logger.NewNop())
+	fallback := NewService(readWriteRepository{repo}, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	// markUnhealthy stores a status change behind the service's back, as a
+	// replica that crashed before bumping the revision would
+	markUnhealthy := func() {
+		stored, _ := repo.Get(ctx, "payment-1")
+		updated := *stored
+		updated.Status = service.StatusUnhealthy
+		repo.Update(ctx, &updated)
+	}
+	doc := &Export{SchemaVersion: ExportSchemaVersion, Services: []*service.Service{
+		{ID: "search-1", Name: "search", Endpoints: []service.Endpoint{{URL: "http://search-1:8080"}}},
+	}}
+
+	steps := []struct {
+		name    string
+		change  func() error
+		changed bool
+	}{
+		{name: "register", changed: true, change: func() error {
+			_, _, err := svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+			return err
+		}},
+		{name: "re-register", changed: true, change: func() error {
+			_, _, err := svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+			return err
+		}},
+		{name: "heartbeat keeping the status", changed: false, change: func() error {
+			return svc.Heartbeat(ctx, "payment-1")
+		}},
+		{name: "drain", changed: true, change: func() error {
+			_, err := svc.SetStatus(ctx, "payment-1", service.StatusDraining)
+			return err
+		}},
+		{name: "heartbeat while draining", changed: false, change: func() error {
+			return svc.Heartbeat(ctx, "payment-1")
+		}},
+		{name: "undrain", changed: true, change: func() error {
+			_, err := svc.SetStatus(ctx, "payment-1", service.StatusHealthy)
+			return err
+		}},
+		{name: "heartbeat recovering in place", changed: true, change: func() error {
+			markUnhealthy()
+			return svc.Heartbeat(ctx, "payment-1")
+		}},
+		{name: "heartbeat recovering by rewrite", changed: true, change: func() error {
+			markUnhealthy()
+			return fallback.Heartbeat(ctx, "payment-1")
+		}},
+		{name: "heartbeat recovered by rewrite", changed: false, change: func() error {
+			return fallback.Heartbeat(ctx, "payment-1")
+		}},
+		{name: "heartbeat expiry", changed: true, change: func() error {
+			stored, _ := repo.Get(ctx, "payment-1")
+			updated := *stored
+			updated.LastHeartbeat = time.Now().Add(-2 * time.Minute)
+			repo.Update(ctx, &updated)
+			svc.checkAll(ctx)
+			return nil
+		}},
+		{name: "health check pass without transitions", changed: false, change: func() error {
+			svc.checkAll(ctx)
+			return nil
+		}},
+		{name: "import creating services", changed: true, change: func() error {
+			_, err := svc.Import(ctx, doc, ImportMerge)
+			return err
+		}},
+		{name: "import skipping every service", changed: false, change: func() error {
+			_, err := svc.Import(ctx, doc, ImportMerge)
+			return err
+		}},
+		{name: "deregister", changed: true, change: func() error {
+			return svc.Deregister(ctx, "payment-1")
+		}},
+		{name: "deregister again", changed: false, change: func() error {
+			return svc.Deregister(ctx, "payment-1")
+		}},
+		{name: "restore", changed: true, change: func() error {
+			_, err := svc.Restore(ctx, "payment-1")
+			return err
+		}},
+		{name: "deregister after restoring", changed: true, change: func() error {
+			return svc.Deregister(ctx, "payment-1")
+		}},
+		{name: "purge within retention", changed: false, change: func() error {
+			svc.purge(ctx, time.Now())
+			return nil
+		}},
+		{name: "purge after retention", changed: true, change: func() error {
+			svc.purge(ctx, time.Now().Add(defaultDeletedRetention+time.Minute))
+			return nil
+		}},
+	}
+
+	for _, step := range steps {
+		before, err := svc.Revision(ctx)
+		if err != nil {
+			t.Fatalf("revision: %v", err)
+		}
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		after, _ := svc.Revision(ctx)
+		if changed := after != before; changed != step.changed {
+			t.Errorf("%s: expected revision changed %v, went from %d to %d", step.name, step.changed, before, after)
+		}
+	}
+}
+
+// failingRepository fails every lookup with a storage error
+type failingRepository struct {
+	service.RegistryRepository
+}
+
+var errStorage = errors.New("connection refused")
+
+func (failingRepository) Get(ctx context.Context, id string) (*service.Service, error) {
+	return nil, errStorage
+}
+
+func TestService_GetStorageError(t *testing.T) {
+	svc := NewService(failingRepository{memory.NewRegistryRepository()}, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	if _, err := svc.Get(ctx, "payment-1"); errors.Is(err, ErrServiceNotFound) || !errors.Is(err, errStorage) {
+		t.Errorf("expected the storage error from Get, got %v", err)
+	}
+	if err := svc.Heartbeat(ctx, "payment-1"); errors.Is(err, ErrServiceNotFound) || !errors.Is(err, errStorage) {
+		t.Errorf("expected the storage error from Heartbeat, got %v", err)
+	}
+}
+
+func TestService_HeartbeatConcurrentWithHealthChecks(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer target.Close()
+
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{HealthCheckTimeout: time.Second}, logger.NewNop())
+	ctx := context.Background()
+
+	ids := []string{"payment-1", "payment-2", "payment-3"}
+	for _, id := range ids {
+		repo.Register(ctx, &service.Service{ID: id, Status: service.StatusHealthy, HealthCheckURL: target.URL})
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				if err := svc.Heartbeat(ctx, id); err != nil {
+					t.Errorf("heartbeat %s: %v", id, err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				listed, _ := repo.Get(ctx, id)
+				checkAndStore(ctx, svc, listed)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if stored, _ := repo.Get(ctx, id); stored.LastHeartbeat.IsZero() {
+			t.Errorf("expected heartbeat recorded for %s", id)
+		}
+	}
+}
+
+func BenchmarkService_Heartbeat(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		wrap func(service.RegistryRepository) service.RegistryRepository
+	}{
+		{name: "in place", wrap: func(r service.RegistryRepository) service.RegistryRepository { return r }},
+		{name: "read modify write", wrap: func(r service.RegistryRepository) service.RegistryRepository { return readWriteRepository{r} }},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			repo := memory.NewRegistryRepository()
+			svc := NewService(bm.wrap(repo), Config{}, logger.NewNop())
+			ctx := context.Background()
+			for i := range 100 {
+				repo.Register(ctx, &service.Service{ID: fmt.Sprintf("svc-%d", i)})
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					svc.Heartbeat(ctx, fmt.Sprintf("svc-%d", i%100))
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestService_SetStatus(t *testing.T) {
+	svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+	svc.Register(ctx, newRegisterRequest("payment-2", "payment-service"))
+
+	if _, err := svc.SetStatus(ctx, "payment-1", service.StatusDraining); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("draining is hidden from discovery but listed", func(t *testing.T) {
+		discovered, _ := svc.Discover(ctx, DiscoverOptions{Capability: "payment"})
+		if len(discovered) != 1 || discovered[0].ID != "payment-2" {
+			t.Errorf("expected only payment-2 discovered, got %v", discovered)
+		}
+
+		listed, _ := svc.List(ctx)
+		if len(listed) != 2 {
+			t.Errorf("expected both services listed, got %d", len(listed))
+		}
+	})
+
+	t.Run("heartbeat and re-registration keep the override", func(t *testing.T) {
+		svc.Heartbeat(ctx, "payment-1")
+		svc.Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+
+		stored, _ := svc.Get(ctx, "payment-1")
+		if stored.Status != service.StatusDraining || !stored.OverrideStatus {
+			t.Errorf("expected draining override, got %s (override %v)", stored.Status, stored.OverrideStatus)
+		}
+	})
+
+	t.Run("healthy clears the override", func(t *testing.T) {
+		restored, err := svc.SetStatus(ctx, "payment-1", service.StatusHealthy)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if restored.OverrideStatus {
+			t.Error("expected override to be cleared")
+		}
+
+		discovered, _ := svc.Discover(ctx, DiscoverOptions{})
+		if len(discovered) != 2 {
+			t.Errorf("expected both services discovered, got %d", len(discovered))
+		}
+	})
+
+	t.Run("rejects other statuses", func(t *testing.T) {
+		_, err := svc.SetStatus(ctx, "payment-1", service.StatusUnhealthy)
+
+		var invalid validation.Errors
+		if !errors.As(err, &invalid) || invalid[0].Field != "status" {
+			t.Errorf("expected status validation error, got %v", err)
+		}
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		if _, err := svc.SetStatus(ctx, "missing", service.StatusDraining); !errors.Is(err, ErrServiceNotFound) {
+			t.Errorf("expected ErrServiceNotFound, got %v", err)
+		}
+	})
+}
+
+// failingUpdateRepository fails every update with a storage error
+type failingUpdateRepository struct {
+	service.RegistryRepository
+}
+
+func (failingUpdateRepository) Update(ctx context.Context, svc *service.Service) error {
+	return errStorage
+}
+
+func TestService_SetStatusLeavesStoredServiceAlone(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	ctx := context.Background()
+	NewService(repo, Config{}, logger.NewNop()).Register(ctx, newRegisterRequest("payment-1", "payment-service"))
+
+	t.Run("failed update", func(t *testing.T) {
+		svc := NewService(failingUpdateRepository{repo}, Config{}, logger.NewNop())
+		if _, err := svc.SetStatus(ctx, "payment-1", service.StatusDraining); !errors.Is(err, errStorage) {
+			t.Fatalf("expected the storage error, got %v", err)
+		}
+		if stored, _ := repo.Get(ctx, "payment-1"); stored.Status == service.StatusDraining || stored.OverrideStatus {
+			t.Errorf("expected the stored service unchanged, got %s (override %v)", stored.Status, stored.OverrideStatus)
+		}
+	})
+
+	// Run with -race: readers of the stored service must not see it written
+	t.Run("concurrent with list", func(t *testing.T) {
+		svc := NewService(repo, Config{}, logger.NewNop())
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				status := service.StatusDraining
+				if i%2 == 1 {
+					status = service.StatusHealthy
+				}
+				if _, err := svc.SetStatus(ctx, "payment-1", status); err != nil {
+					t.Errorf("set status: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				listed, _ := svc.List(ctx)
+				for _, s := range listed {
+					_ = s.Status == service.StatusDraining && s.OverrideStatus
+				}
+			}
+		}()
+		wg.Wait()
+	})
+}
+
+func TestRegisterRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(r *RegisterRequest)
+		wantFields []string
+	}{
+		{name: "valid request", modify: func(r *RegisterRequest) {}},
+		{name: "valid with health check and metadata", modify: func(r *RegisterRequest) {
+			r.HealthCheckURL = "https://payment-1:8443/health"
+			r.Metadata = map[string]string{"region": "us-east-1"}
+		}},
+		{name: "empty id", modify: func(r *RegisterRequest) { r.ID = "" }, wantFields: []string{"id"}},
+		{name: "id with slash", modify: func(r *RegisterRequest) { r.ID = "payment/1" }, wantFields: []string{"id"}},
+		{name: "id too long", modify: func(r *RegisterRequest) { r.ID = strings.Repeat("a", validation.MaxIDLength+1) }, wantFields: []string{"id"}},
+		{name: "empty name", modify: func(r *RegisterRequest) { r.Name = "" }, wantFields: []string{"name"}},
+		{name: "instance id", modify: func(r *RegisterRequest) { r.InstanceID = "eu-1" }},
+		{name: "instance id with slash", modify: func(r *RegisterRequest) { r.InstanceID = "eu/1" }, wantFields: []string{"instance_id"}},
+		{name: "no endpoints", modify: func(r *RegisterRequest) { r.Endpoints = nil }, wantFields: []string{"endpoints"}},
+		{name: "relative endpoint", modify: func(r *RegisterRequest) {
+			r.Endpoints = []service.Endpoint{{URL: "http://payment-1:8080"}, {URL: "/payments"}}
+		}, wantFields: []string{"endpoints[1].url"}},
+		{name: "non-http endpoint", modify: func(r *RegisterRequest) { r.Endpoints = []service.Endpoint{{URL: "tcp://payment-1:8080"}} }, wantFields: []string{"endpoints[0].url"}},
+		{name: "negative weight", modify: func(r *RegisterRequest) {
+			r.Endpoints = []service.Endpoint{{URL: "http://payment-1:8080", Weight: -1}}
+		}, wantFields: []string{"endpoints[0].weight"}},
+		{name: "invalid health check url", modify: func(r *RegisterRequest) { r.HealthCheckURL = "not a url" }, wantFields: []string{"health_check_url"}},
+		{name: "negative check interval", modify: func(r *RegisterRequest) { r.CheckIntervalSeconds = -1 }, wantFields: []string{"check_interval_seconds"}},
+		{name: "templated health check url", modify: func(r *RegisterRequest) { r.HealthCheckURL = "{endpoint}/health" }},
+		{name: "templated health check url expanding to relative url", modify: func(r *RegisterRequest) {
+			r.HealthCheckURL = "/health?target={endpoint}"
+		}, wantFields: []string{"health_check_url"}},
+		{name: "tcp health check", modify: func(r *RegisterRequest) {
+			r.HealthCheck = &service.HealthCheck{Type: service.HealthCheckTCP, URL: "payment-1:9090", TimeoutSeconds: 2}
+		}},
+		{name: "http health check with expectations", modify: func(r *RegisterRequest) {
+			r.HealthCheck = &service.HealthCheck{URL: "{endpoint}/ready", ExpectedStatusCodes: []int{200, 204}, ExpectedBodySubstring: "SERVING"}
+		}},
+		{name: "health check url matching the health check", modify: func(r *RegisterRequest) {
+			r.HealthCheckURL = "http://payment-1:8080/health"
+			r.HealthCheck = &service.HealthCheck{Type: service.HealthCheckHTTP, URL: "http://payment-1:8080/health"}
+		}},
+		{name: "health check url contradicting the health check", modify: func(r *RegisterRequest) {
+			r.HealthCheckURL = "http://payment-1:8080/health"
+			r.HealthCheck = &service.HealthCheck{Type: service.HealthCheckTCP, URL: "payment-1:9090"}
+		}, wantFields: []string{"health_check_url"}},
+		{name: "invalid http health check", modify: func(r *RegisterRequest) {
+			r.HealthCheck = &service.HealthCheck{URL: "payment-1:8080", ExpectedStatusCodes: []int{200, 42}, TimeoutSeconds: -1}
+		}, wantFields: []string{"health_check.expected_status_codes[1]", "health_check.timeout_seconds", "health_check.url"}},
+		{name: "tcp health check with http expectations", modify: func(r *RegisterRequest) {
+			r.HealthCheck = &service.HealthCheck{Type: service.HealthCheckTCP, URL: "http://payment-1:9090", ExpectedStatusCodes: []int{200}, ExpectedBodySubstring: "ok"}
+		}, wantFields: []string{"health_check.url", "health_check.expected_status_codes", "health_check.expected_body_substring"}},
+		{name: "unknown health check type", modify: func(r *RegisterRequest) {
+			r.HealthCheck = &service.HealthCheck{Type: "grpc", URL: "payment-1:9090"}
+		}, wantFields: []string{"health_check.type"}},
+		{name: "dependencies", modify: func(r *RegisterRequest) { r.DependsOn = []string{"inventory", "fraud-check"} }},
+		{name: "invalid dependency", modify: func(r *RegisterRequest) { r.DependsOn = []string{"inventory", "Fraud Check"} }, wantFields: []string{"depends_on[1]"}},
+		{name: "metadata key too long", modify: func(r *RegisterRequest) {
+			r.Metadata = map[string]string{strings.Repeat("k", validation.MaxMetadataKeyLength+1): "v"}
+		}, wantFields: []string{"metadata"}},
+		{name: "empty metadata key", modify: func(r *RegisterRequest) { r.Metadata = map[string]string{"": "v"} }, wantFields: []string{"metadata"}},
+		{name: "metadata value too long", modify: func(r *RegisterRequest) {
+			r.Metadata = map[string]string{"region": strings.Repeat("v", validation.MaxMetadataValueLength+1)}
+		}, wantFields: []string{"metadata.region"}},
+		{name: "metadata at limits", modify: func(r *RegisterRequest) {
+			r.Metadata = map[string]string{
+				strings.Repeat("k", validation.MaxMetadataKeyLength): strings.Repeat("v", validation.MaxMetadataValueLength),
+			}
+		}},
+		{name: "callback url", modify: func(r *RegisterRequest) {
+			r.Metadata = map[string]string{service.MetadataCallbackURL: "https://payment-1:8443/sessions/ended"}
+		}},
+		{name: "relative callback url", modify: func(r *RegisterRequest) {
+			r.Metadata = map[string]string{service.MetadataCallbackURL: "/sessions/ended"}
+		}, wantFields: []string{"metadata.callback_url"}},
+		{name: "uppercase capability", modify: func(r *RegisterRequest) { r.Capabilities = []string{"payment", "Refund"} }, wantFields: []string{"capabilities[1]"}},
+		{name: "capability with underscore", modify: func(r *RegisterRequest) { r.Capabilities = []string{"bulk_refund"} }, wantFields: []string{"capabilities[0]"}},
+		{name: "every field reported", modify: func(r *RegisterRequest) {
+			*r = RegisterRequest{HealthCheckURL: "nope"}
+		}, wantFields: []string{"id", "name", "endpoints", "health_check_url"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRegisterRequest("payment-1", "payment-service")
+			tt.modify(&req)
+
+			err := req.Validate()
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var errs validation.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			fields := make([]string, len(errs))
+			for i, fe := range errs {
+				fields[i] = fe.Field
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestService_RegisterHealthCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(r *RegisterRequest)
+		wantCheck     *service.HealthCheck
+		wantLegacyURL string
+	}{
+		{name: "none", modify: func(r *RegisterRequest) {}},
+		{
+			name:          "legacy url",
+			modify:        func(r *RegisterRequest) { r.HealthCheckURL = "http://payment-1:8080/health" },
+			wantCheck:     &service.HealthCheck{Type: service.HealthCheckHTTP, URL: "http://payment-1:8080/health"},
+			wantLegacyURL: "http://payment-1:8080/health",
+		},
+		{
+			name: "http without a type",
+			modify: func(r *RegisterRequest) {
+				r.HealthCheck = &service.HealthCheck{URL: "http://payment-1:8080/health", ExpectedStatusCodes: []int{204}}
+			},
+			wantCheck:     &service.HealthCheck{Type: service.HealthCheckHTTP, URL: "http://payment-1:8080/health", ExpectedStatusCodes: []int{204}},
+			wantLegacyURL: "http://payment-1:8080/health",
+		},
+		{
+			name: "tcp",
+			modify: func(r *RegisterRequest) {
+				r.HealthCheck = &service.HealthCheck{Type: service.HealthCheckTCP, URL: "payment-1:9090"}
+			},
+			wantCheck: &service.HealthCheck{Type: service.HealthCheckTCP, URL: "payment-1:9090"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(memory.NewRegistryRepository(), Config{}, logger.NewNop())
+			req := newRegisterRequest("payment-1", "payment-service")
+			tt.modify(&req)
+
+			registered, _, err := svc.Register(context.Background(), req)
+			if err != nil {
+				t.Fatalf("register: %v", err)
+			}
+			if registered.HealthCheckURL != tt.wantLegacyURL {
+				t.Errorf("expected health_check_url %q, got %q", tt.wantLegacyURL, registered.HealthCheckURL)
+			}
+			got := registered.HealthCheck
+			if (got == nil) != (tt.wantCheck == nil) {
+				t.Fatalf("expected health check %+v, got %+v", tt.wantCheck, got)
+			}
+			if got != nil && (got.Type != tt.wantCheck.Type || got.URL != tt.wantCheck.URL || !slices.Equal(got.ExpectedStatusCodes, tt.wantCheck.ExpectedStatusCodes)) {
+				t.Errorf("expected health check %+v, got %+v", tt.wantCheck, got)
+			}
+		})
+	}
+}
+
+func TestService_RegisterRejectsInvalidRequest(t *testing.T) {
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{}, logger.NewNop())
+
+	req := newRegisterRequest("payment-1", "payment-service")
+	req.HealthCheckURL = "not a url"
+
+	var errs validation.Errors
+	if _, _, err := svc.Register(context.Background(), req); !errors.As(err, &errs) {
+		t.Fatalf("expected validation.Errors, got %v", err)
+	}
+	if services, _ := repo.List(context.Background()); len(services) != 0 {
+		t.Errorf("expected nothing stored, got %d services", len(services))
+	}
+}
+
+// recordingPublisher remembers the type and service of every published event
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []event.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, e event.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, e)
+}
+
+// published returns "type id status" for every event so far
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]string, len(p.events))
+	for i, e := range p.events {
+		svc := e.Data.(*service.Service)
+		out[i] = fmt.Sprintf("%s %s %s", e.Type, svc.ID, svc.Status)
+	}
+	return out
+}
+
+func TestService_PublishesEvents(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer target.Close()
+
+	events := &recordingPublisher{}
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{HealthCheckTimeout: time.Second, Events: events}, logger.NewNop())
+	ctx := context.Background()
+
+	req := newRegisterRequest("payment-1", "payment-service")
+	req.HealthCheckURL = target.URL
+	svc.Register(ctx, req)
+	svc.Register(ctx, req)
+	svc.checkAll(ctx) // healthy -> unhealthy
+	svc.checkAll(ctx) // no change, no event
+	svc.SetStatus(ctx, "payment-1", service.StatusDraining)
+	svc.Deregister(ctx, "payment-1")
+	svc.Deregister(ctx, "payment-1") // already gone, no event
+	svc.Restore(ctx, "payment-1")
+
+	want := []string{
+		"service.registered payment-1 healthy",
+		"service.registered payment-1 healthy",
+		"service.status_changed payment-1 unhealthy",
+		"service.status_changed payment-1 draining",
+		"service.deregistered payment-1 draining",
+		"service.registered payment-1 draining",
+	}
+	if got := events.published(); !slices.Equal(got, want) {
+		t.Errorf("expected events\n%v\ngot\n%v", want, got)
+	}
+}
@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aq189/bin/internal/domain/service"
+)
+
+// Counts summarizes the registered services of every tenant
+type Counts struct {
+	Total int `json:"total"`
+	// ByStatus counts services by their effective status, leaving out
+	// statuses no service has
+	ByStatus map[service.Status]int `json:"by_status"`
+	// RegisteredLastHour counts new registrations over the last hour, as
+	// counted by Config.Registered; re-registrations aren't counted
+	RegisteredLastHour int64 `json:"registered_last_hour"`
+}
+
+// Counts counts the registered services of every tenant by the status
+// EffectiveStatus gives them now. Deregistered services aren't counted.
+func (s *Service) Counts(ctx context.Context) (Counts, error) {
+	services, err := s.repo.List(ctx)
+	if err != nil {
+		return Counts{}, fmt.Errorf("list services: %w", err)
+	}
+
+	now := s.config.Clock.Now()
+	counts := Counts{
+		Total:              len(services),
+		ByStatus:           make(map[service.Status]int),
+		RegisteredLastHour: s.config.Registered.LastHour(now),
+	}
+	for _, svc := range services {
+		counts.ByStatus[EffectiveStatus(svc, s.config.HeartbeatTimeout, now)]++
+	}
+	return counts, nil
+}
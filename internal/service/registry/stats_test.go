@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/stats"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestService_Counts(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	fake := clock.NewFake(start)
+	svc := NewService(memory.NewRegistryRepository(), Config{
+		HeartbeatTimeout: 30 * time.Second,
+		Registered:       new(stats.Counter),
+		Clock:            fake,
+	}, logger.NewNop())
+	ctx := context.Background()
+	acme := token.NewContext(ctx, &token.Claims{Subject: "acme-deployer", TenantID: "acme"})
+
+	register := func(ctx context.Context, id string) {
+		t.Helper()
+		if _, _, err := svc.Register(ctx, newRegisterRequest(id, id)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	register(ctx, "payment")
+	register(ctx, "payment") // re-registration, not counted
+	register(acme, "billing")
+	register(ctx, "gone")
+	if err := svc.Deregister(ctx, "gone"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fake.Advance(10 * time.Minute)
+	register(ctx, "search")
+	if _, err := svc.SetStatus(ctx, "search", service.StatusDraining); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Duration
+		want Counts
+	}{
+		{
+			name: "heartbeats expired",
+			at:   10 * time.Minute,
+			want: Counts{Total: 3, ByStatus: map[service.Status]int{service.StatusUnhealthy: 2, service.StatusDraining: 1}, RegisteredLastHour: 4},
+		},
+		{
+			name: "first registrations an hour old",
+			at:   time.Hour,
+			want: Counts{Total: 3, ByStatus: map[service.Status]int{service.StatusUnhealthy: 2, service.StatusDraining: 1}, RegisteredLastHour: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Set(start.Add(tt.at))
+			// Counts covers every tenant, whoever asks
+			got, err := svc.Counts(acme)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got.Total != tt.want.Total || got.RegisteredLastHour != tt.want.RegisteredLastHour || !maps.Equal(got.ByStatus, tt.want.ByStatus) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("fresh heartbeat", func(t *testing.T) {
+		fake.Set(start.Add(time.Hour))
+		if err := svc.Heartbeat(ctx, "payment"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		got, err := svc.Counts(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if want := map[service.Status]int{service.StatusHealthy: 1, service.StatusUnhealthy: 1, service.StatusDraining: 1}; !maps.Equal(got.ByStatus, want) {
+			t.Errorf("expected %v, got %v", want, got.ByStatus)
+		}
+	})
+}
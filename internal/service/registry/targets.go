@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// maxProbeRedirects is how many redirects an http probe follows
+const maxProbeRedirects = 10
+
+// ErrTargetNotAllowed is returned when a health check would reach an address
+// its TargetPolicy refuses
+var ErrTargetNotAllowed = errors.New("policy violation: health check target not allowed")
+
+// internalRanges are the internal ranges netip has no predicate for
+var internalRanges = []struct {
+	prefix netip.Prefix
+	class  string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), "this-network"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "shared"},
+}
+
+// TargetPolicy decides which addresses health checks may reach, so that
+// registrants can't make the registry probe its own network. Loopback,
+// private, link-local, shared and unspecified addresses are refused unless
+// they are within an allowed range. A nil policy allows every address.
+type TargetPolicy struct {
+	allowed  []netip.Prefix
+	resolver *net.Resolver
+}
+
+// NewTargetPolicy returns a policy allowing the internal addresses within
+// allowedCIDRs, e.g. "10.0.0.0/8"
+func NewTargetPolicy(allowedCIDRs []string) (*TargetPolicy, error) {
+	p := &TargetPolicy{resolver: net.DefaultResolver}
+	for _, cidr := range allowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("allowed cidr: %w", err)
+		}
+		p.allowed = append(p.allowed, prefix.Masked())
+	}
+	return p, nil
+}
+
+// Transport returns an HTTP transport that refuses to connect to addresses
+// the policy refuses, whatever a host resolves to when it is dialed. It
+// connects directly, ignoring proxy settings, so the addresses checked are
+// the ones reached.
+func (p *TargetPolicy) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: p.control}
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// addressClass returns the kind of internal address ip is, or "" for public addresses
+func addressClass(ip netip.Addr) string {
+	switch {
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsPrivate():
+		return "private"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast(), ip.IsInterfaceLocalMulticast():
+		return "link-local"
+	case ip.IsUnspecified():
+		return "unspecified"
+	}
+	for _, r := range internalRanges {
+		if r.prefix.Contains(ip) {
+			return r.class
+		}
+	}
+	return ""
+}
+
+// checkAddr returns ErrTargetNotAllowed when the policy refuses ip
+func (p *TargetPolicy) checkAddr(ip netip.Addr) error {
+	ip = ip.Unmap().WithZone("")
+	class := addressClass(ip)
+	if class == "" || slices.ContainsFunc(p.allowed, func(prefix netip.Prefix) bool { return prefix.Contains(ip) }) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is a %s address", ErrTargetNotAllowed, ip, class)
+}
+
+// checkHost checks every address host resolves to. Hosts that don't resolve
+// pass, since connecting to them fails anyway.
+func (p *TargetPolicy) checkHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(ip)
+	}
+	addrs, err := p.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range addrs {
+		if err := p.checkAddr(ip); err != nil {
+			return fmt.Errorf("%s resolves to an address not allowed: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// checkTarget checks the URL of an http check or the host:port of a tcp
+// check before it is probed or registered. A nil policy allows every target.
+func (p *TargetPolicy) checkTarget(ctx context.Context, checkType, target string) error {
+	if p == nil {
+		return nil
+	}
+	if checkType == service.HealthCheckTCP {
+		host, _, err := net.SplitHostPort(target)
+		if err != nil {
+			return fmt.Errorf("parse target: %w", err)
+		}
+		return p.checkHost(ctx, host)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("parse target: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not http or https", ErrTargetNotAllowed, u.Scheme)
+	}
+	return p.checkHost(ctx, u.Hostname())
+}
+
+// control refuses connections to addresses the policy refuses, as the last
+// check before a probe connects
+func (p *TargetPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	return p.checkAddr(ip)
+}
+
+// checkRedirect stops an http probe following more than maxProbeRedirects
+// redirects or a redirect to a target the policy refuses
+func (p *TargetPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxProbeRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxProbeRedirects)
+	}
+	return p.checkTarget(req.Context(), service.HealthCheckHTTP, req.URL.String())
+}
+
+// validateTargets returns validation.Errors naming the health check field of
+// req when the target policy refuses what its check would reach, every
+// endpoint's URL for checks templated with service.EndpointPlaceholder
+func (s *Service) validateTargets(ctx context.Context, req RegisterRequest) error {
+	check := req.healthCheck()
+	if check == nil || s.config.TargetPolicy == nil {
+		return nil
+	}
+	field := "health_check.url"
+	if req.HealthCheck == nil {
+		field = "health_check_url"
+	}
+
+	targets := []string{check.URL}
+	if check.Type == service.HealthCheckHTTP && strings.Contains(check.URL, service.EndpointPlaceholder) {
+		targets = targets[:0]
+		for _, endpoint := range req.Endpoints {
+			targets = append(targets, endpoint.HealthCheckURL(check.URL))
+		}
+	}
+
+	var errs validation.Errors
+	for _, target := range targets {
+		if err := s.config.TargetPolicy.checkTarget(ctx, check.Type, target); err != nil {
+			errs.Add(field, err.Error())
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func TestTargetPolicy_CheckTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkType string
+		target    string
+		allowed   []string
+		wantErr   string // part of the error, empty when the target is allowed
+	}{
+		{name: "public address", target: "http://93.184.216.34/health"},
+		{name: "public tcp address", checkType: service.HealthCheckTCP, target: "8.8.8.8:53"},
+		{name: "cloud metadata", target: "http://169.254.169.254/latest/meta-data/", wantErr: "169.254.169.254 is a link-local address"},
+		{name: "rfc1918 10/8", target: "http://10.0.0.5:8080/health", wantErr: "10.0.0.5 is a private address"},
+		{name: "rfc1918 172.16/12", target: "https://172.16.3.4/health", wantErr: "private address"},
+		{name: "rfc1918 192.168/16", target: "http://192.168.1.1/admin", wantErr: "private address"},
+		{name: "loopback", target: "http://127.0.0.1:2019/config/", wantErr: "127.0.0.1 is a loopback address"},
+		{name: "loopback by name", target: "http://localhost:8080/health", wantErr: "localhost resolves to an address not allowed"},
+		{name: "ipv6 loopback", target: "http://[::1]:8080/health", wantErr: "::1 is a loopback address"},
+		{name: "ipv4-mapped loopback", target: "http://[::ffff:127.0.0.1]/health", wantErr: "127.0.0.1 is a loopback address"},
+		{name: "ipv6 link-local with zone", target: "http://[fe80::1%25eth0]/health", wantErr: "fe80::1 is a link-local address"},
+		{name: "ipv6 unique local", target: "http://[fd00::1]/health", wantErr: "private address"},
+		{name: "unspecified", target: "http://0.0.0.0:8080/", wantErr: "unspecified address"},
+		{name: "this network", target: "http://0.1.2.3/", wantErr: "this-network address"},
+		{name: "shared address space", target: "http://100.100.100.200/latest/meta-data/", wantErr: "shared address"},
+		{name: "file scheme", target: "file:///etc/passwd", wantErr: `scheme "file"`},
+		{name: "gopher scheme", target: "gopher://10.0.0.5:70/", wantErr: `scheme "gopher"`},
+		{name: "tcp loopback", checkType: service.HealthCheckTCP, target: "127.0.0.1:6379", wantErr: "loopback address"},
+		{name: "tcp private", checkType: service.HealthCheckTCP, target: "10.0.0.7:5432", wantErr: "private address"},
+		{name: "allow-listed range", target: "http://10.0.0.5:8080/health", allowed: []string{"10.0.0.0/8"}},
+		{name: "allow-listed loopback", checkType: service.HealthCheckTCP, target: "127.0.0.1:6379", allowed: []string{"127.0.0.0/8"}},
+		{name: "outside the allow-list", target: "http://192.168.1.1/", allowed: []string{"10.0.0.0/8"}, wantErr: "private address"},
+		{name: "allow everything", target: "http://169.254.169.254/", allowed: []string{"0.0.0.0/0", "::/0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewTargetPolicy(tt.allowed)
+			if err != nil {
+				t.Fatalf("new policy: %v", err)
+			}
+			err = policy.checkTarget(context.Background(), cmp.Or(tt.checkType, service.HealthCheckHTTP), tt.target)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected %s to be allowed, got %v", tt.target, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrTargetNotAllowed) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected ErrTargetNotAllowed mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("dial control", func(t *testing.T) {
+		policy, _ := NewTargetPolicy([]string{"10.1.0.0/16"})
+		if err := policy.control("tcp4", "169.254.169.254:80", nil); !errors.Is(err, ErrTargetNotAllowed) {
+			t.Errorf("expected the dialer to refuse a link-local address, got %v", err)
+		}
+		if err := policy.control("tcp4", "10.1.2.3:80", nil); err != nil {
+			t.Errorf("expected the dialer to allow an allow-listed address, got %v", err)
+		}
+	})
+
+	t.Run("invalid cidr", func(t *testing.T) {
+		if _, err := NewTargetPolicy([]string{"10.0.0.1"}); err == nil {
+			t.Error("expected an address without a prefix length to be refused")
+		}
+	})
+}
+
+func TestService_RegisterRefusesInternalTargets(t *testing.T) {
+	policy, _ := NewTargetPolicy([]string{"10.1.0.0/16"})
+	svc := NewService(memory.NewRegistryRepository(), Config{TargetPolicy: policy}, logger.NewNop())
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		modify    func(r *RegisterRequest)
+		wantField string
+	}{
+		{name: "metadata url", modify: func(r *RegisterRequest) { r.HealthCheckURL = "http://169.254.169.254/latest/meta-data/" }, wantField: "health_check_url"},
+		{name: "tcp check", modify: func(r *RegisterRequest) {
+			r.HealthCheck = &service.HealthCheck{Type: service.HealthCheckTCP, URL: "127.0.0.1:6379"}
+		}, wantField: "health_check.url"},
+		{name: "templated url", modify: func(r *RegisterRequest) {
+			r.Endpoints = []service.Endpoint{{URL: "http://10.1.0.4:8080"}, {URL: "http://192.168.0.4:8080"}}
+			r.HealthCheck = &service.HealthCheck{URL: service.EndpointPlaceholder + "/health"}
+		}, wantField: "health_check.url"},
+		{name: "allow-listed range", modify: func(r *RegisterRequest) { r.HealthCheckURL = "http://10.1.0.4:8080/health" }},
+		{name: "public address", modify: func(r *RegisterRequest) { r.HealthCheckURL = "http://93.184.216.34/health" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRegisterRequest("payment-1", "payment")
+			tt.modify(&req)
+			_, _, err := svc.Register(ctx, req)
+
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("expected registration, got %v", err)
+				}
+				return
+			}
+			var invalid validation.Errors
+			if !errors.As(err, &invalid) || len(invalid) != 1 || invalid[0].Field != tt.wantField || !strings.Contains(invalid[0].Message, "policy violation") {
+				t.Errorf("expected a policy violation of %s, got %v", tt.wantField, err)
+			}
+		})
+	}
+}
+
+func TestService_HealthCheckTargetPolicy(t *testing.T) {
+	var probes atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		}
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		allowed    []string
+		wantStatus service.Status
+		wantProbes int64
+		wantErr    string
+	}{
+		{name: "loopback refused", path: "/health", wantStatus: service.StatusUnhealthy, wantErr: "loopback address"},
+		{name: "loopback allowed", path: "/health", allowed: []string{"127.0.0.0/8"}, wantStatus: service.StatusHealthy, wantProbes: 1},
+		{name: "redirect to metadata refused", path: "/redirect", allowed: []string{"127.0.0.0/8"}, wantStatus: service.StatusUnhealthy, wantProbes: 1, wantErr: "link-local address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes.Store(0)
+			policy, _ := NewTargetPolicy(tt.allowed)
+			repo := memory.NewRegistryRepository()
+			svc := NewService(repo, Config{HealthCheckTimeout: time.Second, TargetPolicy: policy}, logger.NewNop())
+			ctx := context.Background()
+
+			// Stored directly, as if registered before the policy refused the address
+			repo.Register(ctx, &service.Service{ID: "payment-1", Name: "payment", Status: service.StatusUnknown, HealthCheckURL: target.URL + tt.path})
+			svc.checkAll(ctx)
+
+			stored, _ := repo.Get(ctx, "payment-1")
+			if stored.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, stored.Status)
+			}
+			if got := probes.Load(); got != tt.wantProbes {
+				t.Errorf("expected %d requests to reach the target, got %d", tt.wantProbes, got)
+			}
+			results := svc.history.list("payment-1")
+			if len(results) != 1 {
+				t.Fatalf("expected one recorded result, got %v", results)
+			}
+			if tt.wantErr != "" && (!strings.Contains(results[0].Error, "policy violation") || !strings.Contains(results[0].Error, tt.wantErr)) {
+				t.Errorf("expected a policy violation mentioning %q, got %q", tt.wantErr, results[0].Error)
+			}
+		})
+	}
+}
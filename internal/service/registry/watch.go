@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+)
+
+// Defaults applied when the configuration leaves long polling unset
+const (
+	defaultMaxDiscoverWait = time.Minute
+	// changeRecheckInterval is how often WaitForChange reads the revision
+	// again, to notice changes made by other servers sharing the storage
+	changeRecheckInterval = 5 * time.Second
+)
+
+// changeNotifier wakes the goroutines waiting for the registry to change. Each
+// change closes the current channel and replaces it, so every waiter holding
+// it is woken at once.
+type changeNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{ch: make(chan struct{})}
+}
+
+// wait returns a channel closed by the next notify
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+// notify wakes every waiter
+func (n *changeNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// observe wakes WaitForChange when the bus brings a registry event, which
+// other instances publish after changing the storage this one shares
+func (s *Service) observe(e event.Event) {
+	switch e.Type {
+	case event.ServiceRegistered, event.ServiceDeregistered, event.ServiceStatusChanged:
+		s.changes.notify()
+	}
+}
+
+// MaxDiscoverWait returns the longest a discovery request may wait for a change
+func (s *Service) MaxDiscoverWait() time.Duration {
+	return s.config.MaxDiscoverWait
+}
+
+// WaitForChange blocks until the registry revision exceeds after and returns
+// the new revision. Changes made through this service, and changes other
+// servers announce on Config.Bus, wake it at once; other changes made by
+// servers sharing the storage are noticed within a few seconds. When ctx is done first it returns the last revision read with
+// ctx's error.
+func (s *Service) WaitForChange(ctx context.Context, after int64) (int64, error) {
+	recheck := s.config.Clock.NewTicker(changeRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		// Taken before reading the revision so a change in between still wakes us
+		changed := s.changes.wait()
+		revision, err := s.Revision(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if revision > after {
+			return revision, nil
+		}
+
+		select {
+		case <-changed:
+		case <-recheck.C():
+		case <-ctx.Done():
+			return revision, ctx.Err()
+		}
+	}
+}
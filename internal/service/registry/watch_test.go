@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/eventbus"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func TestService_WaitForChange(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	repo := memory.NewRegistryRepository()
+	svc := NewService(repo, Config{Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+
+	// wait runs WaitForChange in the background and returns its outcome
+	wait := func(ctx context.Context, after int64) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			revision, err := svc.WaitForChange(ctx, after)
+			if err == nil && revision <= after {
+				err = errors.New("returned without a change")
+			}
+			done <- err
+		}()
+		return done
+	}
+	blocked := func(done <-chan error) {
+		t.Helper()
+		select {
+		case err := <-done:
+			t.Fatalf("expected the wait to block, got %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	unblocked := func(done <-chan error) {
+		t.Helper()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("wait: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the wait to return")
+		}
+	}
+
+	t.Run("past revision", func(t *testing.T) {
+		revision, _ := svc.Revision(ctx)
+		unblocked(wait(ctx, revision-1))
+	})
+
+	t.Run("registration", func(t *testing.T) {
+		revision, _ := svc.Revision(ctx)
+		done := wait(ctx, revision)
+		blocked(done)
+		if _, _, err := svc.Register(ctx, newRegisterRequest("payment-1", "payment")); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+		unblocked(done)
+	})
+
+	t.Run("heartbeat changing the status", func(t *testing.T) {
+		stored, _ := repo.Get(ctx, "payment-1")
+		unhealthy := *stored
+		unhealthy.Status = service.StatusUnhealthy
+		if err := repo.Update(ctx, &unhealthy); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		revision, _ := svc.Revision(ctx)
+		done := wait(ctx, revision)
+		blocked(done)
+		if err := svc.Heartbeat(ctx, "payment-1"); err != nil {
+			t.Fatalf("heartbeat: %v", err)
+		}
+		unblocked(done)
+	})
+
+	t.Run("change made by another server", func(t *testing.T) {
+		revision, _ := svc.Revision(ctx)
+		done := wait(ctx, revision)
+		blocked(done)
+		repo.BumpRevision(ctx)
+		blocked(done)
+		fake.Advance(changeRecheckInterval)
+		unblocked(done)
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		revision, _ := svc.Revision(ctx)
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		got, err := svc.WaitForChange(waitCtx, revision)
+		if !errors.Is(err, context.DeadlineExceeded) || got != revision {
+			t.Errorf("expected revision %d with a deadline error, got %d and %v", revision, got, err)
+		}
+	})
+}
+
+func TestService_WaitForChangeAnnouncedOnBus(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	repo := memory.NewRegistryRepository()
+	bus := eventbus.NewLocal()
+	// Two servers sharing the storage and the bus
+	first := NewService(repo, Config{Clock: fake, Bus: bus}, logger.NewNop())
+	second := NewService(repo, Config{Clock: fake, Bus: bus}, logger.NewNop())
+	ctx := context.Background()
+
+	revision, _ := second.Revision(ctx)
+	done := make(chan error, 1)
+	go func() {
+		_, err := second.WaitForChange(ctx, revision)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected the wait to block, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if _, _, err := first.Register(ctx, newRegisterRequest("payment-1", "payment")); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the other server's registration to wake the wait without a recheck")
+	}
+}
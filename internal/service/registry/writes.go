@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/journal"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/tracing"
+)
+
+// Names of the counters of health check writes
+const (
+	WritesQueuedMetric   = "registry.health.writes.queued"
+	WritesFlushedMetric  = "registry.health.writes.flushed"
+	WritesDeferredMetric = "registry.health.writes.deferred"
+)
+
+// healthWrite is a change a health check decided on. It is applied to the
+// service as stored when it is flushed, so a registration, heartbeat or
+// override stored while it waited is kept.
+type healthWrite struct {
+	serviceID string
+	// apply returns the service to store, or nil when current no longer
+	// calls for the change, and the status transition the change makes, if any
+	apply func(current *service.Service) (*service.Service, *transition)
+}
+
+// writeCoalescer holds the writes of health check passes until they are
+// flushed, and meters them out with a token bucket. A newer write for a
+// service replaces the one waiting. Foreground calls, like Register and
+// Heartbeat, write directly and are never held back by it.
+type writeCoalescer struct {
+	mu      sync.Mutex
+	pending map[string]*healthWrite // by service ID
+	order   []string                // service IDs in the order first queued
+
+	rate   float64 // writes per second, 0 for no limit
+	tokens float64 // writes that may be flushed now, at most rate
+	filled time.Time
+
+	queued   metric.Int64Counter
+	flushed  metric.Int64Counter
+	deferred metric.Int64Counter
+}
+
+func newWriteCoalescer(rate float64, provider metric.MeterProvider) *writeCoalescer {
+	if provider == nil {
+		provider = noop.NewMeterProvider()
+	}
+	meter := provider.Meter(tracing.InstrumentationName)
+	// The counters returned alongside an error still work; the provider
+	// only reports the problem
+	queued, _ := meter.Int64Counter(WritesQueuedMetric, metric.WithDescription("Health check writes queued"))
+	flushed, _ := meter.Int64Counter(WritesFlushedMetric, metric.WithDescription("Health check writes stored"))
+	deferred, _ := meter.Int64Counter(WritesDeferredMetric,
+		metric.WithDescription("Health check writes left for the next pass by the write rate or a failed flush"))
+
+	return &writeCoalescer{
+		pending:  make(map[string]*healthWrite),
+		rate:     rate,
+		tokens:   rate,
+		queued:   queued,
+		flushed:  flushed,
+		deferred: deferred,
+	}
+}
+
+// queue adds the writes, skipping nil ones
+func (c *writeCoalescer) queue(ctx context.Context, writes []*healthWrite) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	for _, w := range writes {
+		if w == nil {
+			continue
+		}
+		if _, ok := c.pending[w.serviceID]; !ok {
+			c.order = append(c.order, w.serviceID)
+		}
+		c.pending[w.serviceID] = w
+		n++
+	}
+	c.queued.Add(ctx, n)
+}
+
+// take returns how many of n writes the rate allows at now and spends their
+// tokens. Tokens refill at rate per second up to a second's worth.
+func (c *writeCoalescer) take(now time.Time, n int) int {
+	if c.rate <= 0 {
+		return n
+	}
+	if !c.filled.IsZero() {
+		c.tokens = min(c.rate, c.tokens+now.Sub(c.filled).Seconds()*c.rate)
+	}
+	c.filled = now
+
+	allowed := min(n, int(c.tokens))
+	c.tokens -= float64(allowed)
+	return allowed
+}
+
+// flushHealthWrites stores the waiting writes the write rate allows, in
+// chunks of HealthWriteBatch with HealthWriteDelay between them,
+// and returns the status transitions they made. Writes over the rate wait
+// for the next call, as do those of a chunk that failed, which are applied
+// to the services as stored then.
+func (s *Service) flushHealthWrites(ctx context.Context) []*transition {
+	c := s.writes
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.order) == 0 {
+		return nil
+	}
+
+	var transitions []*transition
+	allowed := c.take(s.config.Clock.Now(), len(c.order))
+	flushed := 0
+	for flushed < allowed {
+		if flushed > 0 && !sleep(ctx, s.config.HealthWriteDelay) {
+			break
+		}
+		end := min(flushed+s.config.HealthWriteBatch, allowed)
+		writes := make([]*healthWrite, 0, end-flushed)
+		for _, id := range c.order[flushed:end] {
+			writes = append(writes, c.pending[id])
+		}
+
+		stored, done, err := s.storeHealthWrites(ctx, writes)
+		transitions = append(transitions, stored...)
+		for _, id := range c.order[flushed : flushed+done] {
+			delete(c.pending, id)
+		}
+		c.flushed.Add(ctx, int64(done))
+		flushed += done
+		if err != nil {
+			s.logger.Error("store health check writes failed", "count", len(writes)-done, "error", err)
+			break
+		}
+	}
+	c.order = c.order[flushed:]
+	c.deferred.Add(ctx, int64(len(c.order)))
+	return transitions
+}
+
+// storeHealthWrites applies the writes to the services as stored and stores
+// those still calling for a change, in one batch when the repository
+// implements service.BatchUpdater and one by one otherwise. Services purged
+// meanwhile are skipped. The stored changes are journaled and published, and
+// their status transitions returned along with how many writes, from the
+// first, are done; the others failed and can be retried.
+func (s *Service) storeHealthWrites(ctx context.Context, writes []*healthWrite) ([]*transition, int, error) {
+	var changes []healthChange
+	for i, w := range writes {
+		current, err := s.repo.Get(ctx, w.serviceID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("reload service %s: %w", w.serviceID, err)
+		}
+		if updated, t := w.apply(current); updated != nil {
+			changes = append(changes, healthChange{write: i, updated: updated, transition: t})
+		}
+	}
+
+	if batch, ok := s.repo.(service.BatchUpdater); ok && len(changes) > 0 {
+		updates := make([]*service.Service, len(changes))
+		for i, change := range changes {
+			updates[i] = change.updated
+		}
+		if err := batch.BatchUpdate(ctx, updates); err != nil {
+			return nil, 0, fmt.Errorf("update services: %w", err)
+		}
+		return s.reportHealthChanges(ctx, changes), len(writes), nil
+	}
+
+	for i, change := range changes {
+		err := s.repo.Update(ctx, change.updated)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return s.reportHealthChanges(ctx, changes[:i]), change.write, fmt.Errorf("update service %s: %w", change.updated.ID, err)
+		}
+	}
+	return s.reportHealthChanges(ctx, changes), len(writes), nil
+}
+
+// healthChange is a service a health check write stores
+type healthChange struct {
+	write      int // index of the write among those flushed together
+	updated    *service.Service
+	transition *transition // nil when the status is unchanged
+}
+
+// reportHealthChanges moves the registry revision forward for the stored
+// changes, journals and publishes their status transitions and returns them
+func (s *Service) reportHealthChanges(ctx context.Context, changes []healthChange) []*transition {
+	if len(changes) == 0 {
+		return nil
+	}
+	s.changed(ctx)
+
+	var transitions []*transition
+	for _, change := range changes {
+		t := change.transition
+		if t == nil {
+			continue
+		}
+		s.record(ctx, journal.Entry{Op: journal.OpHealth, ServiceID: t.serviceID, RequestID: t.requestID, BeforeStatus: t.before, AfterStatus: t.status})
+		s.publish(ctx, event.ServiceStatusChanged, change.updated)
+		transitions = append(transitions, t)
+	}
+	return transitions
+}
+
+// sleep waits for d unless ctx is done first, reporting whether it waited
+// the whole time. The pause between chunks is real time, whatever the clock.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,223 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// batchingRepository records the size of every BatchUpdate and fails the
+// next fail of them
+type batchingRepository struct {
+	*memory.RegistryRepository
+	mu      sync.Mutex
+	batches []int
+	fail    int
+}
+
+func (r *batchingRepository) BatchUpdate(ctx context.Context, services []*service.Service) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("connection reset")
+	}
+	r.batches = append(r.batches, len(services))
+	for _, svc := range services {
+		if err := r.RegistryRepository.Update(ctx, svc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *batchingRepository) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.batches)
+}
+
+// registerStale registers n services whose last heartbeat is an hour before now
+func registerStale(t *testing.T, repo service.RegistryRepository, n int, now time.Time) {
+	t.Helper()
+	for i := range n {
+		svc := &service.Service{ID: fmt.Sprintf("worker-%03d", i), Status: service.StatusHealthy, LastHeartbeat: now.Add(-time.Hour)}
+		if err := repo.Register(context.Background(), svc); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+	}
+}
+
+// countUnhealthy returns how many stored services are unhealthy
+func countUnhealthy(t *testing.T, repo service.RegistryRepository) int {
+	t.Helper()
+	services, err := repo.List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	n := 0
+	for _, svc := range services {
+		if svc.Status == service.StatusUnhealthy {
+			n++
+		}
+	}
+	return n
+}
+
+// writeCounts returns the health check write counters by metric name
+func writeCounts(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	counts := make(map[string]int64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, point := range sum.DataPoints {
+				counts[m.Name] += point.Value
+			}
+		}
+	}
+	return counts
+}
+
+func TestService_HealthWritesFlushInChunks(t *testing.T) {
+	repo := &batchingRepository{RegistryRepository: memory.NewRegistryRepository()}
+	reader := sdkmetric.NewManualReader()
+	fake := clock.NewFake(time.Now())
+	svc := NewService(repo, Config{
+		HeartbeatTimeout: time.Minute,
+		HealthWriteBatch: 100,
+		HealthWriteDelay: time.Millisecond,
+		MeterProvider:    sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		Clock:            fake,
+	}, logger.NewNop())
+	registerStale(t, repo, 250, fake.Now())
+
+	svc.checkAll(context.Background())
+
+	if got := repo.sizes(); !slices.Equal(got, []int{100, 100, 50}) {
+		t.Errorf("expected batches of 100, 100 and 50, got %v", got)
+	}
+	if n := countUnhealthy(t, repo); n != 250 {
+		t.Errorf("expected 250 services marked unhealthy, got %d", n)
+	}
+	want := map[string]int64{WritesQueuedMetric: 250, WritesFlushedMetric: 250}
+	for name, n := range want {
+		if got := writeCounts(t, reader)[name]; got != n {
+			t.Errorf("expected %s %d, got %d", name, n, got)
+		}
+	}
+}
+
+func TestService_HealthWriteRate(t *testing.T) {
+	repo := &batchingRepository{RegistryRepository: memory.NewRegistryRepository()}
+	reader := sdkmetric.NewManualReader()
+	fake := clock.NewFake(time.Now())
+	svc := NewService(repo, Config{
+		HeartbeatTimeout: time.Minute,
+		HealthWriteRate:  10,
+		HealthWriteBatch: 4,
+		MeterProvider:    sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		Clock:            fake,
+	}, logger.NewNop())
+	ctx := context.Background()
+	registerStale(t, repo, 25, fake.Now())
+
+	// A full bucket holds a second's worth of writes; the rest wait
+	svc.checkAll(ctx)
+	if n := countUnhealthy(t, repo); n != 10 {
+		t.Fatalf("expected 10 writes in the first pass, got %d", n)
+	}
+	if got := repo.sizes(); !slices.Equal(got, []int{4, 4, 2}) {
+		t.Errorf("expected batches of 4, 4 and 2, got %v", got)
+	}
+	if got := writeCounts(t, reader)[WritesDeferredMetric]; got != 15 {
+		t.Errorf("expected 15 deferred writes, got %d", got)
+	}
+
+	// Heartbeats are stored directly whatever the bucket holds, even for a
+	// service whose write is waiting
+	waiting := svc.writes.order[len(svc.writes.order)-1]
+	if err := svc.Heartbeat(ctx, waiting); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if stored, _ := repo.Get(ctx, waiting); stored.LastHeartbeat != fake.Now() {
+		t.Errorf("expected the heartbeat stored at once, got %v", stored.LastHeartbeat)
+	}
+
+	svc.checkAll(ctx)
+	if n := countUnhealthy(t, repo); n != 10 {
+		t.Errorf("expected no writes before the bucket refills, got %d", n-10)
+	}
+
+	fake.Advance(500 * time.Millisecond)
+	svc.checkAll(ctx)
+	if n := countUnhealthy(t, repo); n != 15 {
+		t.Errorf("expected 5 more writes half a second later, got %d", n-10)
+	}
+
+	// The bucket never holds more than a second's worth
+	fake.Advance(10 * time.Second)
+	svc.checkAll(ctx)
+	if n := countUnhealthy(t, repo); n != 24 {
+		t.Errorf("expected all but the service that sent a heartbeat unhealthy, got %d", n)
+	}
+	if stored, _ := repo.Get(ctx, waiting); stored.Status != service.StatusHealthy {
+		t.Errorf("expected the waiting write not to overwrite the heartbeat, got %s", stored.Status)
+	}
+}
+
+func TestService_HealthWritesRetryFailedFlush(t *testing.T) {
+	repo := &batchingRepository{RegistryRepository: memory.NewRegistryRepository(), fail: 1}
+	events := &recordingPublisher{}
+	fake := clock.NewFake(time.Now())
+	svc := NewService(repo, Config{HeartbeatTimeout: time.Minute, HealthWriteBatch: 2, Events: events, Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+	registerStale(t, repo, 3, fake.Now())
+
+	svc.checkAll(ctx)
+	if n := countUnhealthy(t, repo); n != 0 {
+		t.Fatalf("expected the failed flush to store nothing, got %d", n)
+	}
+	if got := events.published(); len(got) != 0 {
+		t.Errorf("expected no events for a failed flush, got %v", got)
+	}
+
+	// The writes left waiting are stored without another pass finding them
+	svc.flushHealthWrites(ctx)
+
+	if n := countUnhealthy(t, repo); n != 3 {
+		t.Errorf("expected all 3 services marked unhealthy on retry, got %d", n)
+	}
+	if got := repo.sizes(); !slices.Equal(got, []int{2, 1}) {
+		t.Errorf("expected batches of 2 and 1 on retry, got %v", got)
+	}
+	want := []string{
+		"service.status_changed worker-000 unhealthy",
+		"service.status_changed worker-001 unhealthy",
+		"service.status_changed worker-002 unhealthy",
+	}
+	got := events.published()
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
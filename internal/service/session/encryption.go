@@ -0,0 +1,73 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aq189/bin/internal/domain/session"
+)
+
+// encryptedDataKey marks session data sealed by the service. Encrypted data
+// is stored as {"$encrypted": {"key_id": ..., "ciphertext": ...}}; data
+// without the marker was written in plaintext and is returned unchanged.
+const encryptedDataKey = "$encrypted"
+
+// sealData returns a copy of sess whose data is encrypted, or sess itself
+// when encryption is disabled. The session ID is bound to the ciphertext so
+// data cannot be moved between sessions.
+func (s *Service) sealData(sess *session.Session) (*session.Session, error) {
+	if s.config.Keyring == nil {
+		return sess, nil
+	}
+
+	plaintext, err := json.Marshal(sess.Data)
+	if err != nil {
+		return nil, fmt.Errorf("encode session data: %w", err)
+	}
+	keyID, sealed, err := s.config.Keyring.Seal(plaintext, []byte(sess.ID))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt session data: %w", err)
+	}
+
+	stored := *sess
+	stored.Data = map[string]any{
+		encryptedDataKey: map[string]any{
+			"key_id":     keyID,
+			"ciphertext": base64.StdEncoding.EncodeToString(sealed),
+		},
+	}
+	return &stored, nil
+}
+
+// openData returns a copy of sess with its data decrypted, or sess itself
+// when the data was stored in plaintext
+func (s *Service) openData(sess *session.Session) (*session.Session, error) {
+	envelope, ok := sess.Data[encryptedDataKey].(map[string]any)
+	if !ok || len(sess.Data) != 1 {
+		return sess, nil
+	}
+	if s.config.Keyring == nil {
+		return nil, fmt.Errorf("session %s is encrypted but encryption is not configured", sess.ID)
+	}
+
+	keyID, _ := envelope["key_id"].(string)
+	encoded, _ := envelope["ciphertext"].(string)
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode session %s ciphertext: %w", sess.ID, err)
+	}
+	plaintext, err := s.config.Keyring.Open(keyID, sealed, []byte(sess.ID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt session %s: %w", sess.ID, err)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, fmt.Errorf("decode session %s data: %w", sess.ID, err)
+	}
+
+	opened := *sess
+	opened.Data = data
+	return &opened, nil
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/encryption"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+func newKeyring(t *testing.T, primary byte, previous ...byte) *encryption.Keyring {
+	t.Helper()
+
+	key := func(b byte) encryption.Key {
+		return encryption.Key{ID: "key-" + string('0'+rune(b)), Secret: bytes.Repeat([]byte{b}, encryption.KeySize)}
+	}
+	var old []encryption.Key
+	for _, b := range previous {
+		old = append(old, key(b))
+	}
+	keyring, err := encryption.NewKeyring(key(primary), old...)
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	return keyring
+}
+
+func TestService_Encryption(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{Keyring: newKeyring(t, 1)}, logger.NewNop())
+	ctx := context.Background()
+
+	created, err := svc.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "web", Data: map[string]any{"email": "ann@example.com"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Data["email"] != "ann@example.com" {
+		t.Errorf("expected plaintext data returned to the caller, got %v", created.Data)
+	}
+
+	stored, _ := repo.Get(ctx, created.ID)
+	envelope, ok := stored.Data[encryptedDataKey].(map[string]any)
+	if !ok || len(stored.Data) != 1 || envelope["key_id"] != "key-1" {
+		t.Fatalf("expected an encrypted envelope under key-1, got %v", stored.Data)
+	}
+	if strings.Contains(envelope["ciphertext"].(string), "ann@example.com") {
+		t.Error("expected data to be stored encrypted")
+	}
+
+	t.Run("get and list decrypt", func(t *testing.T) {
+		got, err := svc.Get(ctx, created.ID)
+		if err != nil || got.Data["email"] != "ann@example.com" {
+			t.Fatalf("expected decrypted data, got %v (%v)", got, err)
+		}
+
+		page, err := svc.ListByUser(ctx, "user-1", pagination.ListOptions{Limit: 10})
+		if err != nil || len(page.Items) != 1 || page.Items[0].Data["email"] != "ann@example.com" {
+			t.Errorf("expected decrypted list, got %+v (%v)", page.Items, err)
+		}
+	})
+
+	t.Run("update re-encrypts", func(t *testing.T) {
+		if err := svc.Update(ctx, created.ID, map[string]any{"email": "bob@example.com"}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if stored, _ := repo.Get(ctx, created.ID); stored.Data[encryptedDataKey] == nil {
+			t.Errorf("expected updated data to be encrypted, got %v", stored.Data)
+		}
+		if got, _ := svc.Get(ctx, created.ID); got.Data["email"] != "bob@example.com" {
+			t.Errorf("expected updated data, got %v", got.Data)
+		}
+	})
+
+	t.Run("rotation keeps older sessions readable", func(t *testing.T) {
+		rotated := NewService(repo, Config{Keyring: newKeyring(t, 2, 1)}, logger.NewNop())
+		if got, err := rotated.Get(ctx, created.ID); err != nil || got.Data["email"] != "bob@example.com" {
+			t.Fatalf("expected session under the previous key to load, got %v", err)
+		}
+
+		fresh, _ := rotated.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "web", Data: map[string]any{"n": 1}})
+		stored, _ := repo.Get(ctx, fresh.ID)
+		if stored.Data[encryptedDataKey].(map[string]any)["key_id"] != "key-2" {
+			t.Errorf("expected new sessions under the primary key, got %v", stored.Data)
+		}
+	})
+
+	t.Run("wrong key fails", func(t *testing.T) {
+		other := NewService(repo, Config{Keyring: newKeyring(t, 3)}, logger.NewNop())
+		_, err := other.Get(ctx, created.ID)
+		if !errors.Is(err, encryption.ErrUnknownKey) {
+			t.Errorf("expected ErrUnknownKey, got %v", err)
+		}
+	})
+}
+
+func TestService_EncryptionReadsPlaintextSessions(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	ctx := context.Background()
+
+	// Written before encryption was enabled
+	repo.Create(ctx, &session.Session{
+		ID:        "sess-old",
+		UserID:    "user-1",
+		Data:      map[string]any{"theme": "dark"},
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	svc := NewService(repo, Config{Keyring: newKeyring(t, 1)}, logger.NewNop())
+	svc.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "web", Data: map[string]any{"theme": "light"}})
+
+	page, err := svc.ListByUser(ctx, "user-1", pagination.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	themes := make(map[string]bool)
+	for _, sess := range page.Items {
+		themes[sess.Data["theme"].(string)] = true
+	}
+	if !themes["dark"] || !themes["light"] {
+		t.Errorf("expected plaintext and encrypted sessions to load, got %v", themes)
+	}
+
+	if err := svc.Update(ctx, "sess-old", map[string]any{"theme": "blue"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if stored, _ := repo.Get(ctx, "sess-old"); stored.Data[encryptedDataKey] == nil {
+		t.Errorf("expected the old session to be encrypted on its next update, got %v", stored.Data)
+	}
+}
@@ -1 +1,592 @@
 package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	mathrand "math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/encryption"
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/internal/stats"
+	"github.com/aq189/bin/internal/validate"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+var (
+	// ErrSessionNotFound is returned when a session doesn't exist or has expired
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrTooManySessions is returned when a user already holds MaxSessionsPerUser active sessions
+	ErrTooManySessions = errors.New("too many sessions")
+)
+
+const (
+	// defaultTTL and defaultCleanupPeriod apply when the configuration leaves them unset
+	defaultTTL           = 60 * time.Minute
+	defaultCleanupPeriod = 10 * time.Minute
+	// cleanupJitter spreads cleanup passes by ±10% of the period so instances
+	// sharing a backend don't all fire together
+	cleanupJitter = 0.1
+	// defaultCleanupTimeout caps a single cleanup pass when none is configured
+	defaultCleanupTimeout = 30 * time.Second
+	// defaultMaxTTL and defaultMaxDataBytes bound new sessions when the
+	// configuration leaves them unset
+	defaultMaxTTL       = 24 * time.Hour
+	defaultMaxDataBytes = 64 << 10
+	// ownerLockStripes is how many locks GetOrCreate spreads user and
+	// service pairs over
+	ownerLockStripes = 64
+	// sessionIDPrefix starts every session ID, whatever the ID format
+	sessionIDPrefix = "sess_"
+)
+
+// Config holds session service settings
+type Config struct {
+	DefaultTTL     time.Duration
+	CleanupPeriod  time.Duration
+	CleanupTimeout time.Duration // per pass; zero uses defaultCleanupTimeout
+	MaxTTL         time.Duration // longest TTL a caller may request
+	MaxDataBytes   int           // largest session data, measured as JSON
+	// MaxSessionsPerUser caps a user's active sessions within a tenant; 0
+	// disables the cap. Concurrent creates may briefly exceed it.
+	MaxSessionsPerUser int
+	// Keyring encrypts session data before it reaches the repository; nil
+	// stores it in plaintext. Sessions stored in plaintext still load.
+	Keyring *encryption.Keyring
+	// Events receives session creations and deletions, and a session.ended
+	// event for every session deleted or cleaned up; nil publishes nothing.
+	// Expired sessions are only announced by repositories implementing
+	// session.ExpiredRemover.
+	Events event.Publisher
+	// Created and Expired count the sessions created and the expired ones
+	// cleanup passes remove, for Activity; nil counts nothing
+	Created *stats.Counter
+	Expired *stats.Counter
+	// IDs generates session IDs after their "sess_" prefix; nil uses random hex
+	IDs idgen.IDGenerator
+	// Clock decides when sessions expire and times the cleanup passes; nil
+	// uses the system clock
+	Clock clock.Clock
+}
+
+// Service manages user sessions
+type Service struct {
+	repo   session.SessionRepository
+	config Config
+	logger logger.ILogger
+	ids    idgen.IDGenerator // of full session IDs, prefix included
+
+	// ownerLocks serialize GetOrCreate calls for the same tenant, user and
+	// service, so concurrent calls on this instance create one session
+	ownerLocks [ownerLockStripes]sync.Mutex
+}
+
+// CreateRequest represents a session creation request
+type CreateRequest struct {
+	UserID    string         `json:"user_id" validate:"required,max=128"` // validation.MaxIDLength
+	ServiceID string         `json:"service_id" validate:"required,serviceid"`
+	Data      map[string]any `json:"data"`
+	TTL       int            `json:"ttl" validate:"min=0"` // minutes, 0 uses the default
+}
+
+// GetOrCreateRequest asks for a user's active session on a service, creating
+// one from the embedded CreateRequest when there is none
+type GetOrCreateRequest struct {
+	CreateRequest
+	// MergeData adds Data to an existing session's data, replacing the keys
+	// both hold; without it an existing session is returned unchanged
+	MergeData bool `json:"merge_data"`
+}
+
+// NewService creates a new session service
+func NewService(repo session.SessionRepository, cfg Config, log logger.ILogger) *Service {
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = defaultTTL
+	}
+	if cfg.CleanupPeriod <= 0 {
+		cfg.CleanupPeriod = defaultCleanupPeriod
+	}
+	if cfg.CleanupTimeout <= 0 {
+		cfg.CleanupTimeout = defaultCleanupTimeout
+	}
+	if cfg.MaxTTL <= 0 {
+		cfg.MaxTTL = defaultMaxTTL
+	}
+	if cfg.MaxDataBytes <= 0 {
+		cfg.MaxDataBytes = defaultMaxDataBytes
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+
+	return &Service{
+		repo:   repo,
+		config: cfg,
+		logger: log,
+		ids:    idgen.Prefixed(sessionIDPrefix, cfg.IDs),
+	}
+}
+
+// validateCreate checks a creation request against its validate tags and the
+// configured limits and returns validation.Errors listing every invalid field
+func (s *Service) validateCreate(req CreateRequest) error {
+	var errs validation.Errors
+	if err := validate.Validate(req); err != nil && !errors.As(err, &errs) {
+		return err
+	}
+
+	maxTTL := int(s.config.MaxTTL / time.Minute)
+	if req.TTL > maxTTL {
+		errs.Add("ttl", fmt.Sprintf("must be from 0 to %d minutes", maxTTL))
+	}
+
+	if msg := s.checkData(req.Data); msg != "" {
+		errs.Add("data", msg)
+	}
+
+	return errs.Err()
+}
+
+// checkUserLimit fails with ErrTooManySessions when the user already holds
+// MaxSessionsPerUser active sessions in the caller's tenant
+func (s *Service) checkUserLimit(ctx context.Context, userID string) error {
+	if s.config.MaxSessionsPerUser <= 0 {
+		return nil
+	}
+
+	_, active, err := s.repo.ListByUser(ctx, tenant.FromContext(ctx), userID, pagination.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("count sessions: %w", err)
+	}
+	if active >= s.config.MaxSessionsPerUser {
+		return fmt.Errorf("%w: user has %d of %d", ErrTooManySessions, active, s.config.MaxSessionsPerUser)
+	}
+	return nil
+}
+
+// checkData returns why data may not be stored, or "" if it fits within MaxDataBytes
+func (s *Service) checkData(data map[string]any) string {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "must be serializable as JSON"
+	}
+	if len(encoded) > s.config.MaxDataBytes {
+		return fmt.Sprintf("must be at most %d bytes as JSON, got %d", s.config.MaxDataBytes, len(encoded))
+	}
+	return ""
+}
+
+// Create creates a new session owned by the caller's tenant. Invalid requests
+// fail with validation.Errors and users at their session cap with
+// ErrTooManySessions.
+func (s *Service) Create(ctx context.Context, req CreateRequest) (*session.Session, error) {
+	if err := s.validateCreate(req); err != nil {
+		return nil, err
+	}
+	return s.create(ctx, req)
+}
+
+// create creates a session for a validated request
+func (s *Service) create(ctx context.Context, req CreateRequest) (*session.Session, error) {
+	if err := s.checkUserLimit(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+
+	ttl := s.config.DefaultTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Minute
+	}
+
+	data := req.Data
+	if data == nil {
+		data = make(map[string]any)
+	}
+
+	now := s.config.Clock.Now()
+	sess := &session.Session{
+		ID:        s.ids.NewID(),
+		UserID:    req.UserID,
+		ServiceID: req.ServiceID,
+		TenantID:  tenant.FromContext(ctx).ID,
+		Data:      data,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	stored, err := s.sealData(sess)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, stored); err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	s.config.Created.Add(now, 1)
+
+	s.logger.Debug("session created", append([]any{"session_id", sess.ID, "user_id", sess.UserID, "service_id", sess.ServiceID, "tenant", sess.TenantID},
+		dataFields(data)...)...)
+	s.publish(ctx, event.SessionCreated, sess)
+	return sess, nil
+}
+
+// GetOrCreate returns the newest active session the user holds on the
+// service in the caller's own tenant, merging the request's data into it when
+// MergeData is set, or creates one as Create does. It reports whether the
+// session was created. Calls for the same user and service are serialized on
+// this instance; instances sharing a backend may still both create one.
+func (s *Service) GetOrCreate(ctx context.Context, req GetOrCreateRequest) (*session.Session, bool, error) {
+	if err := s.validateCreate(req.CreateRequest); err != nil {
+		return nil, false, err
+	}
+
+	// Only the tenant a new session would belong to is searched, even for
+	// callers allowed to see every tenant
+	tenantID := tenant.FromContext(ctx).ID
+	lock := s.ownerLock(tenantID, req.UserID, req.ServiceID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	existing, err := s.repo.GetByUserService(ctx, tenant.Only(tenantID), req.UserID, req.ServiceID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+	case err != nil:
+		return nil, false, fmt.Errorf("get session: %w", err)
+	case !s.expired(existing.ExpiresAt):
+		sess, err := s.openData(existing)
+		if err != nil {
+			return nil, false, err
+		}
+		if req.MergeData && len(req.Data) > 0 {
+			if sess, err = s.mergeData(ctx, sess, req.Data); err != nil {
+				return nil, false, err
+			}
+		}
+		return sess, false, nil
+	}
+
+	sess, err := s.create(ctx, req.CreateRequest)
+	if err != nil {
+		return nil, false, err
+	}
+	return sess, true, nil
+}
+
+// ownerLock returns the lock serializing GetOrCreate for a tenant, user and service
+func (s *Service) ownerLock(tenantID, userID, serviceID string) *sync.Mutex {
+	h := fnv.New32a()
+	for _, part := range []string{tenantID, userID, serviceID} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return &s.ownerLocks[h.Sum32()%ownerLockStripes]
+}
+
+// mergeData stores a copy of the open session sess with data added to its
+// own and returns it. Merged data larger than MaxDataBytes fails with
+// validation.Errors.
+func (s *Service) mergeData(ctx context.Context, sess *session.Session, data map[string]any) (*session.Session, error) {
+	merged := make(map[string]any, len(sess.Data)+len(data))
+	maps.Copy(merged, sess.Data)
+	maps.Copy(merged, data)
+	if msg := s.checkData(merged); msg != "" {
+		var errs validation.Errors
+		errs.Add("data", msg)
+		return nil, errs.Err()
+	}
+
+	updated := *sess
+	updated.Data = merged
+	updated.Touch(s.config.Clock.Now())
+	stored, err := s.sealData(&updated)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.Update(ctx, stored)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sess.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update session: %w", err)
+	}
+	s.logger.Debug("session data merged", append([]any{"session_id", sess.ID}, dataFields(data)...)...)
+	return &updated, nil
+}
+
+// Get retrieves an active session, decrypting its data. Sessions of other
+// tenants are reported as not found.
+func (s *Service) Get(ctx context.Context, id string) (*session.Session, error) {
+	sess, err := s.repo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	if s.expired(sess.ExpiresAt) || !tenant.FromContext(ctx).Allows(sess.TenantID) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return s.openData(sess)
+}
+
+// Validate reports whether a session is active and when it expires without
+// decrypting or returning its data. Missing, expired and other tenants'
+// sessions are all reported as not valid with a nil error. Repositories that
+// implement session.ExpiryReader answer unscoped callers without loading the
+// session at all.
+func (s *Service) Validate(ctx context.Context, id string) (bool, time.Time, error) {
+	scope := tenant.FromContext(ctx)
+	if reader, ok := s.repo.(session.ExpiryReader); ok && scope.All {
+		expiresAt, err := reader.Expiry(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, time.Time{}, nil
+		}
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("get session expiry: %w", err)
+		}
+		if s.expired(expiresAt) {
+			return false, time.Time{}, nil
+		}
+		return true, expiresAt, nil
+	}
+
+	sess, err := s.repo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, time.Time{}, nil
+	}
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("get session: %w", err)
+	}
+	if s.expired(sess.ExpiresAt) || !scope.Allows(sess.TenantID) {
+		return false, time.Time{}, nil
+	}
+	return true, sess.ExpiresAt, nil
+}
+
+// expired reports whether a session expiring at expiresAt has expired by the
+// configured clock
+func (s *Service) expired(expiresAt time.Time) bool {
+	return session.Expired(expiresAt, s.config.Clock.Now())
+}
+
+// Update replaces the data of an active session. Data larger than MaxDataBytes
+// fails with validation.Errors.
+func (s *Service) Update(ctx context.Context, id string, data map[string]any) error {
+	if msg := s.checkData(data); msg != "" {
+		var errs validation.Errors
+		errs.Add("data", msg)
+		return errs.Err()
+	}
+
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	sess.Data = data
+	sess.Touch(s.config.Clock.Now())
+	stored, err := s.sealData(sess)
+	if err != nil {
+		return err
+	}
+	err = s.repo.Update(ctx, stored)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Expired or deleted since it was read
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	s.logger.Debug("session updated", append([]any{"session_id", id}, dataFields(data)...)...)
+	return nil
+}
+
+// dataFields describes session data for logs by its key names and encoded
+// size; the values themselves are never logged
+func dataFields(data map[string]any) []any {
+	encoded, _ := json.Marshal(data)
+	return []any{"data_keys", slices.Sorted(maps.Keys(data)), "data_bytes", len(encoded)}
+}
+
+// Delete removes a session. Sessions of other tenants are left alone, as if
+// they did not exist.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	// The session is read first to check its tenant and to publish it
+	var existing *session.Session
+	if scope := tenant.FromContext(ctx); !scope.All || s.config.Events != nil {
+		sess, err := s.repo.Get(ctx, id)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			// Nothing to check or publish
+		case err != nil:
+			return fmt.Errorf("get session: %w", err)
+		case !scope.Allows(sess.TenantID):
+			return nil
+		default:
+			existing = sess
+		}
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if existing != nil {
+		s.publish(ctx, event.SessionDeleted, existing)
+		s.publishEnded(ctx, existing, session.EndedDeleted)
+	}
+	return nil
+}
+
+// sessionEvent is the data of session events. It leaves out the session's
+// data, which may be sensitive and is encrypted at rest.
+type sessionEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	ServiceID string    `json:"service_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// publish sends an event about sess to the configured publisher, if any
+func (s *Service) publish(ctx context.Context, eventType string, sess *session.Session) {
+	if s.config.Events == nil {
+		return
+	}
+	s.config.Events.Publish(ctx, event.New(eventType, sess.TenantID, sessionEvent{
+		ID:        sess.ID,
+		UserID:    sess.UserID,
+		ServiceID: sess.ServiceID,
+		CreatedAt: sess.CreatedAt,
+		ExpiresAt: sess.ExpiresAt,
+	}))
+}
+
+// publishEnded sends a session.ended event about sess to the configured
+// publisher, if any
+func (s *Service) publishEnded(ctx context.Context, sess *session.Session, reason string) {
+	if s.config.Events == nil {
+		return
+	}
+	s.config.Events.Publish(ctx, event.New(event.SessionEnded, sess.TenantID, session.Ended{
+		SessionID: sess.ID,
+		UserID:    sess.UserID,
+		ServiceID: sess.ServiceID,
+		Reason:    reason,
+	}))
+}
+
+// ListByUser returns one page of a user's active sessions within the caller's
+// tenant, decrypting their data
+func (s *Service) ListByUser(ctx context.Context, userID string, opts pagination.ListOptions) (pagination.Page[*session.Session], error) {
+	sessions, total, err := s.repo.ListByUser(ctx, tenant.FromContext(ctx), userID, opts)
+	if err != nil {
+		return pagination.Page[*session.Session]{}, fmt.Errorf("list sessions: %w", err)
+	}
+	for i, sess := range sessions {
+		if sessions[i], err = s.openData(sess); err != nil {
+			return pagination.Page[*session.Session]{}, err
+		}
+	}
+	return pagination.NewPage(sessions, total, opts), nil
+}
+
+// CleanupNow deletes expired sessions and returns how many were removed
+func (s *Service) CleanupNow(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.CleanupTimeout)
+	defer cancel()
+
+	count, err := s.deleteExpired(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	s.config.Expired.Add(s.config.Clock.Now(), count)
+
+	if count > 0 {
+		s.logger.Info("expired sessions cleaned up", "count", count)
+	}
+	return count, nil
+}
+
+// deleteExpired removes the expired sessions and returns how many were
+// removed. When events are published and the repository can return the
+// sessions it removes, each one is announced as ended; those removed before
+// an error are announced too.
+func (s *Service) deleteExpired(ctx context.Context) (int, error) {
+	remover, ok := s.repo.(session.ExpiredRemover)
+	if !ok || s.config.Events == nil {
+		return s.repo.DeleteExpired(ctx)
+	}
+
+	removed, err := remover.RemoveExpired(ctx, s.config.Clock.Now())
+	for _, sess := range removed {
+		s.publishEnded(ctx, sess, session.EndedExpired)
+	}
+	return len(removed), err
+}
+
+// Activity counts the active sessions of every tenant and the sessions
+// created and cleaned up over the last hour
+type Activity struct {
+	// Active is nil when the repository can't count active sessions
+	Active          *int  `json:"active,omitempty"`
+	CreatedLastHour int64 `json:"created_last_hour"`
+	ExpiredLastHour int64 `json:"expired_last_hour"`
+}
+
+// Activity reports the session activity across every tenant. Sessions
+// created and cleaned up are counted by Config.Created and Config.Expired;
+// active sessions are counted by repositories implementing
+// session.ActiveCounter.
+func (s *Service) Activity(ctx context.Context) (Activity, error) {
+	now := s.config.Clock.Now()
+	activity := Activity{
+		CreatedLastHour: s.config.Created.LastHour(now),
+		ExpiredLastHour: s.config.Expired.LastHour(now),
+	}
+	if counter, ok := s.repo.(session.ActiveCounter); ok {
+		active, err := counter.CountActive(ctx, now)
+		if err != nil {
+			return Activity{}, fmt.Errorf("count active sessions: %w", err)
+		}
+		activity.Active = &active
+	}
+	return activity, nil
+}
+
+// StartCleanup runs a cleanup pass immediately and then once per jittered
+// cleanup period, timed by Config.Clock from the start of the previous pass,
+// until ctx is cancelled
+func (s *Service) StartCleanup(ctx context.Context) {
+	for {
+		// The wait starts before the pass, so the next tick is due as soon as
+		// the pass has run
+		wait := s.config.Clock.NewTicker(jitter(s.config.CleanupPeriod))
+		if _, err := s.CleanupNow(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("session cleanup failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return
+		case <-wait.C():
+			wait.Stop()
+		}
+	}
+}
+
+// jitter returns d adjusted by a random amount within ±cleanupJitter
+func jitter(d time.Duration) time.Duration {
+	factor := 1 + cleanupJitter*(2*mathrand.Float64()-1)
+	return time.Duration(float64(d) * factor)
+}
@@ -0,0 +1,652 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/pagination"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/domain/tenant"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/idgen"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/stats"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// countingRepository records cleanup passes
+type countingRepository struct {
+	*memory.SessionRepository
+	passes chan struct{}
+}
+
+func (r *countingRepository) DeleteExpired(ctx context.Context) (int, error) {
+	count, err := r.SessionRepository.DeleteExpired(ctx)
+	r.passes <- struct{}{}
+	return count, err
+}
+
+func waitForPass(t *testing.T, passes <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-passes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a cleanup pass")
+	}
+}
+
+func TestService_StartCleanup(t *testing.T) {
+	repo := &countingRepository{SessionRepository: memory.NewSessionRepository(), passes: make(chan struct{}, 1)}
+	fake := clock.NewFake(time.Now())
+	svc := NewService(repo, Config{CleanupPeriod: time.Hour, Clock: fake}, logger.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.StartCleanup(ctx)
+	}()
+
+	// The first pass runs before any tick; each pass starts after its wait does
+	waitForPass(t, repo.passes)
+	for range 3 {
+		// The period is within ±10% of 1h
+		fake.Advance(54*time.Minute - time.Nanosecond)
+		select {
+		case <-repo.passes:
+			t.Fatal("expected no pass before the jittered period")
+		case <-time.After(20 * time.Millisecond):
+		}
+		fake.Advance(12 * time.Minute)
+		waitForPass(t, repo.passes)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cleanup loop did not stop after cancel")
+	}
+}
+
+func TestService_CleanupNow(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	now := time.Now()
+	repo.Create(ctx, &session.Session{ID: "expired", ExpiresAt: now.Add(-time.Minute)})
+	repo.Create(ctx, &session.Session{ID: "active", ExpiresAt: now.Add(time.Hour)})
+
+	deleted, err := svc.CleanupNow(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted session, got %d", deleted)
+	}
+	if _, err := svc.Get(ctx, "active"); err != nil {
+		t.Errorf("expected active session to remain, got %v", err)
+	}
+}
+
+func TestService_GetExpired(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	svc := NewService(memory.NewSessionRepository(), Config{Clock: fake}, logger.NewNop())
+	ctx := context.Background()
+
+	sess, err := svc.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "svc-1", TTL: 30})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := fake.Now().Add(30 * time.Minute); !sess.ExpiresAt.Equal(want) {
+		t.Errorf("expected expiry %v, got %v", want, sess.ExpiresAt)
+	}
+
+	fake.Advance(30*time.Minute - time.Second)
+	if _, err := svc.Get(ctx, sess.ID); err != nil {
+		t.Errorf("expected the session a second before expiry, got %v", err)
+	}
+
+	fake.Advance(time.Second)
+	if _, err := svc.Get(ctx, sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound at expiry, got %v", err)
+	}
+	if valid, _, err := svc.Validate(ctx, sess.ID); err != nil || valid {
+		t.Errorf("expected an invalid session at expiry, got %v, %v", valid, err)
+	}
+}
+
+func TestService_Activity(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	fake := clock.NewFake(start)
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{Clock: fake, Created: new(stats.Counter), Expired: new(stats.Counter)}, logger.NewNop())
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := svc.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "svc-1"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// Cleanup removes sessions expired by the repository's own clock
+	repo.Create(ctx, &session.Session{ID: "expired-1", ExpiresAt: time.Now().Add(-time.Minute)})
+	repo.Create(ctx, &session.Session{ID: "expired-2", ExpiresAt: time.Now().Add(-time.Minute)})
+	if _, err := svc.CleanupNow(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		at      time.Duration
+		want    Activity
+		wantAll int
+	}{
+		{at: 0, want: Activity{CreatedLastHour: 3, ExpiredLastHour: 2}, wantAll: 3},
+		{at: time.Hour - time.Second, want: Activity{CreatedLastHour: 3, ExpiredLastHour: 2}, wantAll: 3},
+		{at: time.Hour, want: Activity{}, wantAll: 0},
+	}
+	for _, tt := range tests {
+		fake.Set(start.Add(tt.at))
+		got, err := svc.Activity(ctx)
+		if err != nil {
+			t.Fatalf("at %v: expected no error, got %v", tt.at, err)
+		}
+		if got.Active == nil || *got.Active != tt.wantAll {
+			t.Errorf("at %v: expected %d active sessions, got %v", tt.at, tt.wantAll, got.Active)
+		}
+		if got.CreatedLastHour != tt.want.CreatedLastHour || got.ExpiredLastHour != tt.want.ExpiredLastHour {
+			t.Errorf("at %v: expected %d created and %d expired, got %d and %d", tt.at,
+				tt.want.CreatedLastHour, tt.want.ExpiredLastHour, got.CreatedLastHour, got.ExpiredLastHour)
+		}
+	}
+
+	// Repositories that can't count active sessions leave Active out
+	uncounted := NewService(struct{ session.SessionRepository }{repo}, Config{}, logger.NewNop())
+	got, err := uncounted.Activity(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.Active != nil {
+		t.Errorf("expected no active count, got %d", *got.Active)
+	}
+}
+
+// failingRepository fails every lookup with a storage error
+type failingRepository struct {
+	*memory.SessionRepository
+}
+
+var errStorage = errors.New("connection refused")
+
+func (failingRepository) Get(ctx context.Context, id string) (*session.Session, error) {
+	return nil, errStorage
+}
+
+func TestService_GetStorageError(t *testing.T) {
+	svc := NewService(failingRepository{memory.NewSessionRepository()}, Config{}, logger.NewNop())
+
+	_, err := svc.Get(context.Background(), "sess-1")
+	if errors.Is(err, ErrSessionNotFound) || !errors.Is(err, errStorage) {
+		t.Errorf("expected the storage error, got %v", err)
+	}
+}
+
+func TestService_DeleteStorageError(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(failingRepository{repo}, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	sess := &session.Session{ID: "sess-1", UserID: "user-1", TenantID: "globex", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repo.Create(ctx, sess); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// The tenant can't be checked, so the session must not be deleted
+	acme := token.NewContext(ctx, &token.Claims{Subject: "acme-service", TenantID: "acme"})
+	if err := svc.Delete(acme, "sess-1"); !errors.Is(err, errStorage) {
+		t.Errorf("expected the storage error, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "sess-1"); err != nil {
+		t.Errorf("expected the session kept, got %v", err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		d := jitter(time.Minute)
+		if d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("expected jitter within ±10%%, got %v", d)
+		}
+	}
+}
+
+func TestService_CreateValidation(t *testing.T) {
+	svc := NewService(memory.NewSessionRepository(), Config{MaxTTL: 2 * time.Hour, MaxDataBytes: 32}, logger.NewNop())
+
+	// {"k":"…"} is 8 bytes of JSON around the value
+	data := func(n int) map[string]any {
+		return map[string]any{"k": strings.Repeat("x", n)}
+	}
+
+	tests := []struct {
+		name       string
+		req        CreateRequest
+		wantFields []string
+	}{
+		{name: "valid", req: CreateRequest{UserID: "user-1", ServiceID: "web", TTL: 30}},
+		{name: "default ttl", req: CreateRequest{UserID: "user-1", ServiceID: "web"}},
+		{name: "ttl at max", req: CreateRequest{UserID: "user-1", ServiceID: "web", TTL: 120}},
+		{name: "data at limit", req: CreateRequest{UserID: "user-1", ServiceID: "web", Data: data(24)}},
+		{name: "missing ids", req: CreateRequest{}, wantFields: []string{"user_id", "service_id"}},
+		{name: "invalid service id", req: CreateRequest{UserID: "user-1", ServiceID: "web app"}, wantFields: []string{"service_id"}},
+		{name: "long user id", req: CreateRequest{UserID: strings.Repeat("u", validation.MaxIDLength+1), ServiceID: "web"}, wantFields: []string{"user_id"}},
+		{name: "negative ttl", req: CreateRequest{UserID: "user-1", ServiceID: "web", TTL: -5}, wantFields: []string{"ttl"}},
+		{name: "ttl over max", req: CreateRequest{UserID: "user-1", ServiceID: "web", TTL: 121}, wantFields: []string{"ttl"}},
+		{name: "data over limit", req: CreateRequest{UserID: "user-1", ServiceID: "web", Data: data(25)}, wantFields: []string{"data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess, err := svc.Create(context.Background(), tt.req)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if sess.ID == "" {
+					t.Error("expected a session ID")
+				}
+				return
+			}
+
+			var errs validation.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			var fields []string
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+
+	t.Run("update enforces the data limit", func(t *testing.T) {
+		sess, _ := svc.Create(context.Background(), CreateRequest{UserID: "user-1", ServiceID: "web"})
+
+		var errs validation.Errors
+		if err := svc.Update(context.Background(), sess.ID, data(25)); !errors.As(err, &errs) {
+			t.Errorf("expected validation.Errors, got %v", err)
+		}
+		if err := svc.Update(context.Background(), sess.ID, data(24)); err != nil {
+			t.Errorf("expected no error at the limit, got %v", err)
+		}
+	})
+}
+
+func TestService_CreatePerUserLimit(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{MaxSessionsPerUser: 2}, logger.NewNop())
+	ctx := context.Background()
+	acme := token.NewContext(ctx, &token.Claims{Subject: "acme-service", TenantID: "acme"})
+
+	create := func(ctx context.Context, userID string) error {
+		_, err := svc.Create(ctx, CreateRequest{UserID: userID, ServiceID: "web"})
+		return err
+	}
+
+	for range 2 {
+		if err := create(ctx, "user-1"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := create(ctx, "user-1"); !errors.Is(err, ErrTooManySessions) {
+		t.Errorf("expected ErrTooManySessions, got %v", err)
+	}
+	if err := create(ctx, "user-2"); err != nil {
+		t.Errorf("expected other users to be unaffected, got %v", err)
+	}
+	if err := create(acme, "user-1"); err != nil {
+		t.Errorf("expected the cap to apply per tenant, got %v", err)
+	}
+
+	repo.Create(ctx, &session.Session{ID: "expired", UserID: "user-3", ExpiresAt: time.Now().Add(-time.Minute)})
+	repo.Create(ctx, &session.Session{ID: "also-expired", UserID: "user-3", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err := create(ctx, "user-3"); err != nil {
+		t.Errorf("expected expired sessions not to count, got %v", err)
+	}
+}
+
+func TestService_GetOrCreate(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{}, logger.NewNop())
+	ctx := context.Background()
+	acme := token.NewContext(ctx, &token.Claims{Subject: "acme-service", TenantID: "acme"})
+
+	getOrCreate := func(ctx context.Context, req GetOrCreateRequest) (*session.Session, bool) {
+		t.Helper()
+		sess, created, err := svc.GetOrCreate(ctx, req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return sess, created
+	}
+	request := func(serviceID string, data map[string]any, merge bool) GetOrCreateRequest {
+		return GetOrCreateRequest{CreateRequest: CreateRequest{UserID: "user-1", ServiceID: serviceID, Data: data}, MergeData: merge}
+	}
+
+	first, created := getOrCreate(ctx, request("web", map[string]any{"theme": "dark"}, false))
+	if !created {
+		t.Fatal("expected a new session")
+	}
+
+	again, created := getOrCreate(ctx, request("web", map[string]any{"theme": "light"}, false))
+	if created || again.ID != first.ID || again.Data["theme"] != "dark" {
+		t.Errorf("expected the existing session unchanged, got %+v (created %v)", again, created)
+	}
+
+	merged, created := getOrCreate(ctx, request("web", map[string]any{"cart": "c-1"}, true))
+	if created || merged.ID != first.ID || merged.Data["theme"] != "dark" || merged.Data["cart"] != "c-1" {
+		t.Errorf("expected the data merged into the existing session, got %+v (created %v)", merged, created)
+	}
+	if stored, _ := svc.Get(ctx, first.ID); stored.Data["cart"] != "c-1" {
+		t.Errorf("expected the merged data stored, got %v", stored.Data)
+	}
+
+	if other, created := getOrCreate(ctx, request("api", nil, false)); !created || other.ID == first.ID {
+		t.Errorf("expected a new session for another service, got %s", other.ID)
+	}
+	if other, created := getOrCreate(acme, request("web", nil, false)); !created || other.ID == first.ID {
+		t.Errorf("expected a new session in another tenant, got %s", other.ID)
+	}
+
+	svc.Delete(ctx, first.ID)
+	if replaced, created := getOrCreate(ctx, request("web", nil, false)); !created || replaced.ID == first.ID {
+		t.Errorf("expected a new session once the old one is gone, got %s", replaced.ID)
+	}
+
+	var invalid validation.Errors
+	if _, _, err := svc.GetOrCreate(ctx, request("", nil, false)); !errors.As(err, &invalid) {
+		t.Errorf("expected validation errors, got %v", err)
+	}
+	small := NewService(repo, Config{MaxDataBytes: 40}, logger.NewNop())
+	if _, _, err := small.GetOrCreate(ctx, request("api", map[string]any{"note": strings.Repeat("x", 20)}, true)); err != nil {
+		t.Fatalf("expected data within the limit merged, got %v", err)
+	}
+	if _, _, err := small.GetOrCreate(ctx, request("api", map[string]any{"more": strings.Repeat("x", 20)}, true)); !errors.As(err, &invalid) {
+		t.Errorf("expected merged data over the limit to be rejected, got %v", err)
+	}
+}
+
+func TestService_GetOrCreateConcurrent(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{}, logger.NewNop())
+	ctx := context.Background()
+	req := GetOrCreateRequest{CreateRequest: CreateRequest{UserID: "user-1", ServiceID: "web"}}
+
+	const callers = 50
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+		ids     = make([]string, callers)
+		start   = make(chan struct{})
+	)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			sess, isNew, err := svc.GetOrCreate(ctx, req)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			if isNew {
+				created.Add(1)
+			}
+			ids[i] = sess.ID
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if created.Load() != 1 {
+		t.Errorf("expected exactly one session created, got %d", created.Load())
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatalf("expected every caller to get the same session, got %s and %s", ids[0], id)
+		}
+	}
+	if _, total, _ := repo.ListByUser(ctx, tenant.Unrestricted, "user-1", pagination.ListOptions{Limit: 10}); total != 1 {
+		t.Errorf("expected one stored session, got %d", total)
+	}
+}
+
+// recordingPublisher remembers every published event
+type recordingPublisher struct {
+	events []event.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, e event.Event) {
+	p.events = append(p.events, e)
+}
+
+func TestService_PublishesEvents(t *testing.T) {
+	events := &recordingPublisher{}
+	svc := NewService(memory.NewSessionRepository(), Config{Events: events}, logger.NewNop())
+	ctx := token.NewContext(context.Background(), &token.Claims{Subject: "acme-service", TenantID: "acme"})
+
+	sess, err := svc.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "web", Data: map[string]any{"card": "4242"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	svc.Delete(ctx, sess.ID)
+	svc.Delete(ctx, sess.ID) // already gone, no event
+
+	if len(events.events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events.events))
+	}
+	for i, wantType := range []string{event.SessionCreated, event.SessionDeleted} {
+		e := events.events[i]
+		data, ok := e.Data.(sessionEvent)
+		if e.Type != wantType || e.TenantID != "acme" || !ok || data.ID != sess.ID || data.UserID != "user-1" {
+			t.Errorf("expected %s for %s in tenant acme, got %+v", wantType, sess.ID, e)
+		}
+	}
+	want := session.Ended{SessionID: sess.ID, UserID: "user-1", ServiceID: "web", Reason: session.EndedDeleted}
+	if e := events.events[2]; e.Type != event.SessionEnded || e.TenantID != "acme" || e.Data != want {
+		t.Errorf("expected %s with %+v, got %+v", event.SessionEnded, want, e)
+	}
+}
+
+func TestService_CleanupPublishesEndedSessions(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	events := &recordingPublisher{}
+	clk := clock.NewFake(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	svc := NewService(repo, Config{Events: events, Clock: clk}, logger.NewNop())
+	ctx := context.Background()
+
+	for _, sess := range []*session.Session{
+		{ID: "sess-expired", UserID: "user-1", ServiceID: "web", TenantID: "acme", ExpiresAt: clk.Now().Add(-time.Minute)},
+		{ID: "sess-active", UserID: "user-2", ServiceID: "web", ExpiresAt: clk.Now().Add(time.Hour)},
+	} {
+		if err := repo.Create(ctx, sess); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	count, err := svc.CleanupNow(ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("expected one session cleaned up, got %d, %v", count, err)
+	}
+	want := session.Ended{SessionID: "sess-expired", UserID: "user-1", ServiceID: "web", Reason: session.EndedExpired}
+	if len(events.events) != 1 || events.events[0].Type != event.SessionEnded || events.events[0].TenantID != "acme" || events.events[0].Data != want {
+		t.Fatalf("expected %s with %+v, got %+v", event.SessionEnded, want, events.events)
+	}
+
+	// Expiry is decided by the service's clock
+	clk.Advance(2 * time.Hour)
+	if count, err := svc.CleanupNow(ctx); err != nil || count != 1 || len(events.events) != 2 {
+		t.Errorf("expected the other session cleaned up and announced, got %d, %v, %d events", count, err, len(events.events))
+	}
+}
+
+// expiryRepository answers Expiry itself and counts how often sessions are loaded
+type expiryRepository struct {
+	*memory.SessionRepository
+	expiries map[string]time.Time
+	gets     int
+}
+
+func (r *expiryRepository) Get(ctx context.Context, id string) (*session.Session, error) {
+	r.gets++
+	return r.SessionRepository.Get(ctx, id)
+}
+
+func (r *expiryRepository) Expiry(ctx context.Context, id string) (time.Time, error) {
+	expiresAt, ok := r.expiries[id]
+	if !ok {
+		return time.Time{}, session.ErrSessionNotFound
+	}
+	return expiresAt, nil
+}
+
+func TestService_Validate(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	svc := NewService(repo, Config{}, logger.NewNop())
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(time.Hour)
+	repo.Create(ctx, &session.Session{ID: "valid", TenantID: "acme", Data: map[string]any{"cart": "secret"}, ExpiresAt: expiresAt})
+	repo.Create(ctx, &session.Session{ID: "expired", TenantID: "acme", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	acme := token.NewContext(ctx, &token.Claims{Subject: "svc", TenantID: "acme"})
+	globex := token.NewContext(ctx, &token.Claims{Subject: "svc", TenantID: "globex"})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		id        string
+		wantValid bool
+	}{
+		{name: "valid", ctx: acme, id: "valid", wantValid: true},
+		{name: "unscoped", ctx: ctx, id: "valid", wantValid: true},
+		{name: "expired", ctx: acme, id: "expired"},
+		{name: "missing", ctx: acme, id: "missing"},
+		{name: "other tenant", ctx: globex, id: "valid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, gotExpiry, err := svc.Validate(tt.ctx, tt.id)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if valid != tt.wantValid {
+				t.Fatalf("expected valid %v, got %v", tt.wantValid, valid)
+			}
+			if valid && !gotExpiry.Equal(expiresAt) {
+				t.Errorf("expected expiry %v, got %v", expiresAt, gotExpiry)
+			}
+			if !valid && !gotExpiry.IsZero() {
+				t.Errorf("expected no expiry for an invalid session, got %v", gotExpiry)
+			}
+		})
+	}
+}
+
+func TestService_ValidateExpiryReader(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	repo := &expiryRepository{
+		SessionRepository: memory.NewSessionRepository(),
+		expiries:          map[string]time.Time{"valid": expiresAt, "expired": time.Now().Add(-time.Second)},
+	}
+	repo.SessionRepository.Create(context.Background(), &session.Session{ID: "valid", ExpiresAt: expiresAt})
+	svc := NewService(repo, Config{}, logger.NewNop())
+
+	for id, want := range map[string]bool{"valid": true, "expired": false, "missing": false} {
+		valid, _, err := svc.Validate(context.Background(), id)
+		if err != nil || valid != want {
+			t.Errorf("%s: expected valid %v, got %v, %v", id, want, valid, err)
+		}
+	}
+	if repo.gets != 0 {
+		t.Errorf("expected unscoped validation not to load sessions, got %d loads", repo.gets)
+	}
+
+	// The reader doesn't know tenants, so scoped callers still load the session
+	scoped := token.NewContext(context.Background(), &token.Claims{Subject: "svc"})
+	if valid, _, _ := svc.Validate(scoped, "valid"); !valid || repo.gets != 1 {
+		t.Errorf("expected a scoped caller to load the session, got valid %v after %d loads", valid, repo.gets)
+	}
+}
+
+func TestService_ValidateStorageError(t *testing.T) {
+	svc := NewService(failingRepository{memory.NewSessionRepository()}, Config{}, logger.NewNop())
+
+	if _, _, err := svc.Validate(context.Background(), "sess-1"); !errors.Is(err, errStorage) {
+		t.Errorf("expected the storage error, got %v", err)
+	}
+}
+
+func TestService_LogsOmitSessionData(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewLogger(logger.Config{Level: "debug", Output: &buf})
+	svc := NewService(memory.NewSessionRepository(), Config{}, log)
+	ctx := context.Background()
+
+	sess, err := svc.Create(ctx, CreateRequest{UserID: "user-1", ServiceID: "svc-1", Data: map[string]any{"card": "4111-1111-1111-1111"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := svc.Update(ctx, sess.ID, map[string]any{"email": "jane@example.com", "cart": []string{"sku-1"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	out := buf.String()
+	for _, value := range []string{"4111-1111-1111-1111", "jane@example.com", "sku-1"} {
+		if strings.Contains(out, value) {
+			t.Errorf("expected session data values kept out of the logs, found %q in %s", value, out)
+		}
+	}
+	for _, want := range []string{`"data_keys":["card"]`, `"data_keys":["cart","email"]`, `"data_bytes":`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in the logs, got %s", want, out)
+		}
+	}
+}
+
+func TestService_IDFormat(t *testing.T) {
+	for _, format := range idgen.Formats {
+		t.Run(format, func(t *testing.T) {
+			ids, err := idgen.New(format, nil)
+			if err != nil {
+				t.Fatalf("new generator: %v", err)
+			}
+			svc := NewService(memory.NewSessionRepository(), Config{IDs: ids}, logger.NewNop())
+
+			sess, err := svc.Create(context.Background(), CreateRequest{UserID: "user-1", ServiceID: "web"})
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if !strings.HasPrefix(sess.ID, "sess_") || len(sess.ID) <= len("sess_") {
+				t.Errorf("expected a sess_ prefixed ID, got %q", sess.ID)
+			}
+			if _, err := svc.Get(context.Background(), sess.ID); err != nil {
+				t.Errorf("expected the session found by its ID, got %v", err)
+			}
+		})
+	}
+}
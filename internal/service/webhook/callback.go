@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/service/registry"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// ServiceLookup finds the registered services sessions belong to.
+// *registry.Service implements it.
+type ServiceLookup interface {
+	Get(ctx context.Context, id string) (*service.Service, error)
+}
+
+// Callbacks tells services that their sessions ended. It POSTs every
+// session.ended event to the URL the session's service registered under the
+// service.MetadataCallbackURL metadata key, and ignores other event types and
+// services that registered no URL. It implements event.Publisher; events are
+// queued and looked up and sent by the workers Start runs, so publishing
+// never waits on the registry or the network.
+//
+// Deliveries are retried like webhook deliveries but aren't signed, since
+// services register no secret.
+type Callbacks struct {
+	services   ServiceLookup
+	config     Config
+	logger     logger.ILogger
+	httpClient *http.Client
+	queue      chan event.Event
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewCallbacks creates a callback dispatcher looking up services in
+// services. Unset settings default to a queue of 1000 events, 2 workers, 3
+// attempts and 5 seconds per attempt.
+func NewCallbacks(services ServiceLookup, cfg Config, log logger.ILogger) *Callbacks {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultCallbackWorkers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultCallbackMaxAttempts
+	}
+	cfg = cfg.withDefaults()
+
+	return &Callbacks{
+		services:   services,
+		config:     cfg,
+		logger:     log,
+		httpClient: &http.Client{Transport: cfg.Transport, Timeout: cfg.Timeout},
+		queue:      make(chan event.Event, cfg.QueueSize),
+	}
+}
+
+// Publish queues session.ended events. It never blocks: when the queue is
+// full the event is dropped and counted.
+func (c *Callbacks) Publish(ctx context.Context, e event.Event) {
+	if e.Type != event.SessionEnded {
+		return
+	}
+	select {
+	case c.queue <- e:
+	default:
+		c.dropped.Add(1)
+		c.logger.Warn("session callback queue full, event dropped", "event_id", e.ID)
+	}
+}
+
+// Start delivers queued events with the configured number of workers until
+// ctx is cancelled. Events still queued or waiting to be retried then are
+// abandoned.
+func (c *Callbacks) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range c.config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-c.queue:
+					c.deliver(ctx, e)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Stats returns the delivery counts since the dispatcher was created
+func (c *Callbacks) Stats() Stats {
+	return Stats{
+		Queued:    len(c.queue),
+		Capacity:  cap(c.queue),
+		Delivered: c.delivered.Load(),
+		Failed:    c.failed.Load(),
+		Dropped:   c.dropped.Load(),
+	}
+}
+
+// deliver looks up the callback URL of the service the ended session belongs
+// to and sends the event there. Lookups run without a tenant, so services of
+// every tenant are found.
+func (c *Callbacks) deliver(ctx context.Context, e event.Event) {
+	ended, ok := e.Data.(session.Ended)
+	if !ok {
+		c.logger.Error("session callback event without session data", "event_id", e.ID)
+		return
+	}
+
+	svc, err := c.services.Get(ctx, ended.ServiceID)
+	if errors.Is(err, registry.ErrServiceNotFound) {
+		c.logger.Debug("session ended for an unregistered service", "service_id", ended.ServiceID, "event_id", e.ID)
+		return
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			c.failed.Add(1)
+			c.logger.Warn("session callback lookup failed", "service_id", ended.ServiceID, "event_id", e.ID, "error", err)
+		}
+		return
+	}
+	url := svc.Metadata[service.MetadataCallbackURL]
+	if url == "" {
+		return
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		c.failed.Add(1)
+		c.logger.Error("encode session callback failed", "service_id", ended.ServiceID, "event_id", e.ID, "error", err)
+		return
+	}
+	header := http.Header{}
+	header.Set(EventHeader, e.Type)
+	header.Set(EventIDHeader, e.ID)
+
+	attempts, err := retry(ctx, c.config, func() (bool, error) {
+		return post(ctx, c.httpClient, url, header, body)
+	}, func(attempt int, backoff time.Duration, err error) {
+		c.logger.Debug("session callback will be retried", "service_id", ended.ServiceID, "event_id", e.ID,
+			"attempt", attempt, "backoff", backoff.String(), "error", err)
+	})
+	switch {
+	case err == nil:
+		c.delivered.Add(1)
+		c.logger.Debug("session callback delivered", "service_id", ended.ServiceID, "event_id", e.ID, "attempt", attempts)
+	case ctx.Err() == nil:
+		c.failed.Add(1)
+		c.logger.Warn("session callback failed", "service_id", ended.ServiceID, "event_id", e.ID,
+			"attempts", attempts, "error", err)
+	}
+}
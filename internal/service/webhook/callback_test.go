@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/domain/service"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/internal/service/registry"
+	sessionsvc "github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// endedDelivery is the body of a session callback
+type endedDelivery struct {
+	ID   string        `json:"id"`
+	Type string        `json:"type"`
+	Data session.Ended `json:"data"`
+}
+
+func TestCallbacks_NotifyServicesOfEndedSessions(t *testing.T) {
+	deliveries := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- received{header: r.Header.Clone(), body: body}
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	services := registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop())
+	for _, req := range []registry.RegisterRequest{
+		{ID: "web-1", Name: "web", Endpoints: []service.Endpoint{{URL: "http://web-1:8080"}},
+			Metadata: map[string]string{service.MetadataCallbackURL: receiver.URL + "/sessions/ended"}},
+		{ID: "quiet-1", Name: "quiet", Endpoints: []service.Endpoint{{URL: "http://quiet-1:8080"}}},
+	} {
+		if _, _, err := services.Register(ctx, req); err != nil {
+			t.Fatalf("register %s: %v", req.ID, err)
+		}
+	}
+
+	// One worker delivers in publishing order, so an event for quiet-1 is
+	// handled before the web-1 event published after it arrives
+	callbacks := NewCallbacks(services, Config{Workers: 1}, logger.NewNop())
+	workerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		callbacks.Start(workerCtx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	repo := memory.NewSessionRepository()
+	clk := clock.NewFake(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	sessions := sessionsvc.NewService(repo, sessionsvc.Config{Events: callbacks, Clock: clk}, logger.NewNop())
+
+	create := func(t *testing.T, id, serviceID string, expiresIn time.Duration) {
+		t.Helper()
+		sess := &session.Session{ID: id, UserID: "user-1", ServiceID: serviceID, CreatedAt: clk.Now(), ExpiresAt: clk.Now().Add(expiresIn)}
+		if err := repo.Create(ctx, sess); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	next := func(t *testing.T) endedDelivery {
+		t.Helper()
+		var got received
+		select {
+		case got = <-deliveries:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the callback")
+		}
+		var decoded endedDelivery
+		if err := json.Unmarshal(got.body, &decoded); err != nil {
+			t.Fatalf("decode callback: %v", err)
+		}
+		if got.header.Get(EventHeader) != event.SessionEnded || got.header.Get(EventIDHeader) != decoded.ID {
+			t.Errorf("expected %s headers for %s, got %v", event.SessionEnded, decoded.ID, got.header)
+		}
+		return decoded
+	}
+
+	t.Run("deleted session", func(t *testing.T) {
+		create(t, "sess-deleted", "web-1", time.Hour)
+		if err := sessions.Delete(ctx, "sess-deleted"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+
+		want := session.Ended{SessionID: "sess-deleted", UserID: "user-1", ServiceID: "web-1", Reason: session.EndedDeleted}
+		if got := next(t); got.Type != event.SessionEnded || got.Data != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("expired session", func(t *testing.T) {
+		create(t, "sess-expired", "web-1", time.Minute)
+		create(t, "sess-active", "web-1", time.Hour)
+		clk.Advance(2 * time.Minute)
+		if count, err := sessions.CleanupNow(ctx); err != nil || count != 1 {
+			t.Fatalf("expected one session cleaned up, got %d, %v", count, err)
+		}
+
+		want := session.Ended{SessionID: "sess-expired", UserID: "user-1", ServiceID: "web-1", Reason: session.EndedExpired}
+		if got := next(t); got.Data != want {
+			t.Errorf("expected %+v, got %+v", want, got.Data)
+		}
+	})
+
+	t.Run("service without a callback url", func(t *testing.T) {
+		create(t, "sess-quiet", "quiet-1", time.Hour)
+		create(t, "sess-unregistered", "gone-1", time.Hour)
+		create(t, "sess-web", "web-1", time.Hour)
+		for _, id := range []string{"sess-quiet", "sess-unregistered", "sess-web"} {
+			if err := sessions.Delete(ctx, id); err != nil {
+				t.Fatalf("delete %s: %v", id, err)
+			}
+		}
+
+		if got := next(t); got.Data.SessionID != "sess-web" {
+			t.Errorf("expected only the web-1 session announced, got %+v", got.Data)
+		}
+		// Counted once the receiver has answered
+		deadline := time.Now().Add(5 * time.Second)
+		stats := callbacks.Stats()
+		for stats.Delivered < 3 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+			stats = callbacks.Stats()
+		}
+		if stats.Delivered != 3 || stats.Failed != 0 || stats.Dropped != 0 {
+			t.Errorf("expected 3 delivered and nothing failed, got %+v", stats)
+		}
+	})
+}
+
+func TestCallbacks_FailuresAreCounted(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	services := registry.NewService(memory.NewRegistryRepository(), registry.Config{}, logger.NewNop())
+	_, _, err := services.Register(ctx, registry.RegisterRequest{
+		ID: "web-1", Name: "web", Endpoints: []service.Endpoint{{URL: "http://web-1:8080"}},
+		Metadata: map[string]string{service.MetadataCallbackURL: receiver.URL},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	callbacks := NewCallbacks(services, Config{MaxAttempts: 2, RetryBackoff: time.Millisecond}, logger.NewNop())
+
+	ended := session.Ended{SessionID: "sess-1", UserID: "user-1", ServiceID: "web-1", Reason: session.EndedExpired}
+	callbacks.Publish(ctx, event.New(event.SessionCreated, "", ended))
+	callbacks.Publish(ctx, event.New(event.SessionEnded, "", ended))
+	if stats := callbacks.Stats(); stats.Queued != 1 {
+		t.Fatalf("expected only the session.ended event queued, got %+v", stats)
+	}
+
+	callbacks.deliver(ctx, <-callbacks.queue)
+	if stats := callbacks.Stats(); stats.Failed != 1 || stats.Delivered != 0 {
+		t.Errorf("expected the callback to fail after retrying, got %+v", stats)
+	}
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+)
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body
+	// keyed with the target's secret; see Signature
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event" // the event type
+	EventIDHeader   = "X-Webhook-ID"    // the event ID, the same on every retry
+)
+
+// userAgent identifies deliveries to receivers
+const userAgent = "root-server-webhooks"
+
+// delivery is one event on its way to one target
+type delivery struct {
+	target    Target
+	eventID   string
+	eventType string
+	body      []byte
+}
+
+// Signature returns the SignatureHeader value for a body sent with secret.
+// Receivers recompute it over the raw body and compare with hmac.Equal.
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish queues the event for every target subscribed to its type. It never
+// blocks: when the queue is full the delivery is dropped and counted.
+func (s *Service) Publish(ctx context.Context, e event.Event) {
+	targets, err := s.targets()
+	if err != nil {
+		s.logger.Error("load webhook targets failed", "event_id", e.ID, "event", e.Type, "error", err)
+		return
+	}
+
+	var body []byte
+	for _, target := range targets {
+		if !target.wants(e.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(e); err != nil {
+				s.logger.Error("encode webhook event failed", "event_id", e.ID, "event", e.Type, "error", err)
+				return
+			}
+		}
+
+		select {
+		case s.queue <- delivery{target: target, eventID: e.ID, eventType: e.Type, body: body}:
+		default:
+			s.dropped.Add(1)
+			s.logger.Warn("webhook queue full, delivery dropped", "target_id", target.ID, "event_id", e.ID, "event", e.Type)
+		}
+	}
+}
+
+// Start delivers queued events with the configured number of workers until
+// ctx is cancelled. Deliveries still queued or waiting to be retried then
+// are abandoned.
+func (s *Service) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range s.config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-s.queue:
+					s.deliver(ctx, d)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver sends one delivery, retrying transport errors, 5xx and 429
+// responses with exponential backoff until MaxAttempts is reached
+func (s *Service) deliver(ctx context.Context, d delivery) {
+	header := http.Header{}
+	header.Set(EventHeader, d.eventType)
+	header.Set(EventIDHeader, d.eventID)
+	header.Set(SignatureHeader, Signature(d.target.Secret, d.body))
+
+	attempts, err := retry(ctx, s.config, func() (bool, error) {
+		return post(ctx, s.httpClient, d.target.URL, header, d.body)
+	}, func(attempt int, backoff time.Duration, err error) {
+		s.logger.Debug("webhook delivery will be retried", "target_id", d.target.ID, "event_id", d.eventID,
+			"attempt", attempt, "backoff", backoff.String(), "error", err)
+	})
+	switch {
+	case err == nil:
+		s.delivered.Add(1)
+		s.logger.Debug("webhook delivered", "target_id", d.target.ID, "event_id", d.eventID, "event", d.eventType, "attempt", attempts)
+	case ctx.Err() == nil:
+		s.failed.Add(1)
+		s.logger.Warn("webhook delivery failed", "target_id", d.target.ID, "event_id", d.eventID, "event", d.eventType,
+			"attempts", attempts, "error", err)
+	}
+}
+
+// retry calls send until it succeeds, fails in a way not worth retrying or
+// has been called cfg.MaxAttempts times, waiting cfg.RetryBackoff before the
+// first retry and twice as long before every further one, up to
+// maxRetryBackoff. It returns how often send was called and its last error,
+// or the context's error once ctx is done.
+func retry(ctx context.Context, cfg Config, send func() (retryable bool, err error), onRetry func(attempt int, backoff time.Duration, err error)) (int, error) {
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := send()
+		if err == nil || !retryable || attempt >= cfg.MaxAttempts {
+			return attempt, err
+		}
+
+		onRetry(attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// post POSTs a JSON body to url once with the given headers and reports
+// whether a failure is worth retrying
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10)) // lets the connection be reused
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
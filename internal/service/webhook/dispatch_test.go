@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+)
+
+// received is one request seen by a test receiver
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestService(t *testing.T, cfg Config, targets ...Target) *Service {
+	t.Helper()
+	svc := NewService(memory.NewConfigRepository(), cfg, logger.NewNop())
+	for _, target := range targets {
+		if _, err := svc.AddTarget(target); err != nil {
+			t.Fatalf("add target: %v", err)
+		}
+	}
+	return svc
+}
+
+func TestService_PublishDeliversSignedEvents(t *testing.T) {
+	deliveries := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- received{header: r.Header.Clone(), body: body}
+	}))
+	defer receiver.Close()
+
+	svc := newTestService(t, Config{},
+		Target{ID: "all", URL: receiver.URL + "/all", Secret: "secret-all"},
+		Target{ID: "sessions", URL: receiver.URL + "/sessions", Events: []string{event.SessionCreated}, Secret: "secret-sessions"},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	published := event.New(event.ServiceDeregistered, "acme", map[string]string{"id": "payment-1"})
+	svc.Publish(ctx, published)
+
+	var got received
+	select {
+	case got = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the delivery")
+	}
+
+	if want := Signature("secret-all", got.body); !hmac.Equal([]byte(got.header.Get(SignatureHeader)), []byte(want)) {
+		t.Errorf("expected signature %q, got %q", want, got.header.Get(SignatureHeader))
+	}
+	if got.header.Get(EventHeader) != event.ServiceDeregistered || got.header.Get(EventIDHeader) != published.ID {
+		t.Errorf("expected event headers for %s, got %v", published.ID, got.header)
+	}
+	var decoded event.Event
+	if err := json.Unmarshal(got.body, &decoded); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if decoded.ID != published.ID || decoded.Type != event.ServiceDeregistered || decoded.TenantID != "acme" {
+		t.Errorf("expected the published event, got %+v", decoded)
+	}
+
+	select {
+	case extra := <-deliveries:
+		t.Errorf("expected the sessions target to be skipped, got a delivery with %s", extra.header.Get(EventHeader))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestService_DeliverRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int // responses in order; the last one repeats
+		wantAttempts  int32
+		wantDelivered uint64
+		wantFailed    uint64
+	}{
+		{name: "first attempt succeeds", statuses: []int{http.StatusNoContent}, wantAttempts: 1, wantDelivered: 1},
+		{name: "recovers after 5xx", statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, wantAttempts: 3, wantDelivered: 1},
+		{name: "retries 429", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, wantAttempts: 2, wantDelivered: 1},
+		{name: "gives up after max attempts", statuses: []int{http.StatusInternalServerError}, wantAttempts: 4, wantFailed: 1},
+		{name: "4xx is not retried", statuses: []int{http.StatusBadRequest}, wantAttempts: 1, wantFailed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer receiver.Close()
+
+			target := Target{ID: "cmdb", URL: receiver.URL, Secret: "s"}
+			svc := newTestService(t, Config{MaxAttempts: 4, RetryBackoff: time.Millisecond}, target)
+
+			svc.deliver(context.Background(), delivery{target: target, eventID: "evt_1", eventType: event.ServiceRegistered, body: []byte(`{}`)})
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, got)
+			}
+			stats := svc.Stats()
+			if stats.Delivered != tt.wantDelivered || stats.Failed != tt.wantFailed {
+				t.Errorf("expected %d delivered and %d failed, got %+v", tt.wantDelivered, tt.wantFailed, stats)
+			}
+		})
+	}
+}
+
+func TestService_DeliverRetriesTransportErrors(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := receiver.URL
+	receiver.Close() // nothing listens any more
+
+	target := Target{ID: "gone", URL: url, Secret: "s"}
+	svc := newTestService(t, Config{MaxAttempts: 2, RetryBackoff: time.Millisecond}, target)
+
+	svc.deliver(context.Background(), delivery{target: target, eventID: "evt_1", body: []byte(`{}`)})
+
+	if stats := svc.Stats(); stats.Failed != 1 || stats.Delivered != 0 {
+		t.Errorf("expected the delivery to fail after retrying, got %+v", stats)
+	}
+}
+
+func TestService_PublishDropsWhenQueueFull(t *testing.T) {
+	svc := newTestService(t, Config{QueueSize: 2},
+		Target{ID: "cmdb", URL: "http://cmdb.invalid", Secret: "s"},
+	)
+
+	// No workers run, so nothing leaves the queue
+	for range 5 {
+		svc.Publish(context.Background(), event.New(event.ServiceRegistered, "", nil))
+	}
+
+	want := Stats{Queued: 2, Capacity: 2, Dropped: 3}
+	if got := svc.Stats(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,271 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/repository"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+var (
+	// ErrTargetExists is returned when a target ID is already taken
+	ErrTargetExists = errors.New("webhook target already exists")
+	// ErrTargetNotFound is returned when no target is stored under an ID
+	ErrTargetNotFound = errors.New("webhook target not found")
+)
+
+// targetNamespace is the config repository service ID targets are stored
+// under, one version per target ID. The colon keeps it apart from every
+// valid service ID.
+const targetNamespace = "root:webhooks"
+
+// Defaults applied when the configuration leaves delivery settings unset
+const (
+	defaultQueueSize    = 1000
+	defaultWorkers      = 4
+	defaultMaxAttempts  = 5
+	defaultTimeout      = 5 * time.Second
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = time.Minute
+
+	defaultCallbackWorkers     = 2
+	defaultCallbackMaxAttempts = 3
+)
+
+// Config holds the delivery settings of webhooks and session callbacks
+type Config struct {
+	QueueSize   int           // deliveries waiting for a worker before new ones are dropped
+	Workers     int           // concurrent deliveries
+	MaxAttempts int           // attempts per delivery before it is given up
+	Timeout     time.Duration // per attempt
+	// RetryBackoff is the delay before the first retry, doubled for every
+	// further one up to a minute
+	RetryBackoff time.Duration
+	// Transport sends deliveries; nil uses http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// withDefaults fills in the unset settings Service and Callbacks share
+func (c Config) withDefaults() Config {
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultRetryBackoff
+	}
+	return c
+}
+
+// Target is an HTTP endpoint events are POSTed to
+type Target struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // event types delivered; empty delivers every type
+	// Secret signs every delivery; it is never returned by the API
+	Secret string `json:"secret,omitempty"`
+}
+
+// Validate checks the target and returns validation.Errors listing every invalid field
+func (t Target) Validate() error {
+	var errs validation.Errors
+
+	if t.ID == "" {
+		errs.Add("id", "is required")
+	} else if !validation.IsID(t.ID) {
+		errs.Add("id", fmt.Sprintf("must be at most %d letters, digits, '.', '-' or '_' and start with a letter or digit", validation.MaxIDLength))
+	}
+	if !validation.IsHTTPURL(t.URL) {
+		errs.Add("url", "must be an absolute http or https URL")
+	}
+	for i, eventType := range t.Events {
+		if !slices.Contains(event.Types, eventType) {
+			errs.Add(fmt.Sprintf("events[%d]", i), "must be one of "+strings.Join(event.Types, ", "))
+		}
+	}
+	if t.Secret == "" {
+		errs.Add("secret", "is required")
+	}
+
+	return errs.Err()
+}
+
+// wants reports whether the target subscribes to the event type
+func (t Target) wants(eventType string) bool {
+	return len(t.Events) == 0 || slices.Contains(t.Events, eventType)
+}
+
+// Stats counts deliveries since the service started
+type Stats struct {
+	Queued    int    `json:"queued"`
+	Capacity  int    `json:"capacity"`
+	Delivered uint64 `json:"delivered"`
+	Failed    uint64 `json:"failed"`  // rejected by the target or given up after the last attempt
+	Dropped   uint64 `json:"dropped"` // not queued because the queue was full
+}
+
+// Service stores webhook targets and delivers published events to them. It
+// implements event.Publisher; deliveries are queued and sent by the workers
+// Start runs.
+type Service struct {
+	store      config.ConfigRepository
+	config     Config
+	logger     logger.ILogger
+	httpClient *http.Client
+	queue      chan delivery
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewService creates a webhook service keeping its targets in store
+func NewService(store config.ConfigRepository, cfg Config, log logger.ILogger) *Service {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	cfg = cfg.withDefaults()
+
+	return &Service{
+		store:      store,
+		config:     cfg,
+		logger:     log,
+		httpClient: &http.Client{Transport: cfg.Transport, Timeout: cfg.Timeout},
+		queue:      make(chan delivery, cfg.QueueSize),
+	}
+}
+
+// AddTarget stores a new target. Invalid targets fail with validation.Errors
+// and taken IDs with ErrTargetExists.
+func (s *Service) AddTarget(target Target) (*Target, error) {
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+
+	_, err := s.store.Get(targetNamespace, target.ID)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTargetExists, target.ID)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("get webhook target: %w", err)
+	}
+
+	if err := s.store.Set(targetNamespace, target.ID, targetFields(target)); err != nil {
+		return nil, fmt.Errorf("store webhook target: %w", err)
+	}
+
+	s.logger.Info("webhook target added", "target_id", target.ID, "url", target.URL, "events", target.Events)
+	return &target, nil
+}
+
+// EnsureTarget stores a target unless one with the same ID exists, so targets
+// from the configuration file are seeded once and can then be managed over
+// the API
+func (s *Service) EnsureTarget(target Target) error {
+	if _, err := s.AddTarget(target); err != nil && !errors.Is(err, ErrTargetExists) {
+		return err
+	}
+	return nil
+}
+
+// RemoveTarget deletes a target; unknown IDs fail with ErrTargetNotFound
+func (s *Service) RemoveTarget(id string) error {
+	if _, err := s.store.Get(targetNamespace, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrTargetNotFound, id)
+		}
+		return fmt.Errorf("get webhook target: %w", err)
+	}
+
+	if err := s.store.Delete(targetNamespace, id); err != nil {
+		return fmt.Errorf("delete webhook target: %w", err)
+	}
+
+	s.logger.Info("webhook target removed", "target_id", id)
+	return nil
+}
+
+// ListTargets returns every target ordered by ID, without their secrets
+func (s *Service) ListTargets() ([]Target, error) {
+	targets, err := s.targets()
+	if err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		targets[i].Secret = ""
+	}
+	return targets, nil
+}
+
+// Stats returns the delivery counters and the current queue length
+func (s *Service) Stats() Stats {
+	return Stats{
+		Queued:    len(s.queue),
+		Capacity:  cap(s.queue),
+		Delivered: s.delivered.Load(),
+		Failed:    s.failed.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+}
+
+// targets loads every target, secrets included, ordered by ID
+func (s *Service) targets() ([]Target, error) {
+	ids, err := s.store.List(targetNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook targets: %w", err)
+	}
+	slices.Sort(ids)
+
+	targets := make([]Target, 0, len(ids))
+	for _, id := range ids {
+		fields, err := s.store.Get(targetNamespace, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue // removed since it was listed
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get webhook target: %w", err)
+		}
+		target, err := parseTarget(fields)
+		if err != nil {
+			return nil, fmt.Errorf("decode webhook target %s: %w", id, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// targetFields converts a target into the generic form the config repository stores
+func targetFields(t Target) map[string]any {
+	events := make([]any, len(t.Events))
+	for i, e := range t.Events {
+		events[i] = e
+	}
+	return map[string]any{"id": t.ID, "url": t.URL, "events": events, "secret": t.Secret}
+}
+
+// parseTarget reverses targetFields. It goes through JSON so targets restored
+// from a memory snapshot, whose lists decode as []any, parse the same way.
+func parseTarget(fields map[string]any) (Target, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return Target{}, err
+	}
+	var target Target
+	err = json.Unmarshal(data, &target)
+	return target, err
+}
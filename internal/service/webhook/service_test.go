@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aq189/bin/internal/domain/event"
+	"github.com/aq189/bin/internal/repository/memory"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func TestTarget_Validate(t *testing.T) {
+	valid := Target{ID: "cmdb", URL: "https://cmdb.example.com/hooks", Events: []string{event.ServiceDeregistered}, Secret: "s3cret"}
+
+	tests := []struct {
+		name       string
+		modify     func(t *Target)
+		wantFields []string
+	}{
+		{name: "valid target", modify: func(t *Target) {}},
+		{name: "all events", modify: func(t *Target) { t.Events = nil }},
+		{name: "missing id", modify: func(t *Target) { t.ID = "" }, wantFields: []string{"id"}},
+		{name: "id with slash", modify: func(t *Target) { t.ID = "cmdb/1" }, wantFields: []string{"id"}},
+		{name: "relative url", modify: func(t *Target) { t.URL = "/hooks" }, wantFields: []string{"url"}},
+		{name: "unknown event", modify: func(t *Target) { t.Events = []string{event.ServiceRegistered, "service.exploded"} }, wantFields: []string{"events[1]"}},
+		{name: "missing secret", modify: func(t *Target) { t.Secret = "" }, wantFields: []string{"secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := valid
+			tt.modify(&target)
+
+			err := target.Validate()
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var errs validation.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			fields := make([]string, len(errs))
+			for i, fe := range errs {
+				fields[i] = fe.Field
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestService_Targets(t *testing.T) {
+	store := memory.NewConfigRepository()
+	svc := NewService(store, Config{}, logger.NewNop())
+
+	cmdb := Target{ID: "cmdb", URL: "https://cmdb.example.com/hooks", Events: []string{event.ServiceRegistered}, Secret: "s3cret"}
+	if _, err := svc.AddTarget(cmdb); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := svc.AddTarget(cmdb); !errors.Is(err, ErrTargetExists) {
+		t.Errorf("expected ErrTargetExists, got %v", err)
+	}
+
+	// Seeding leaves an existing target alone
+	if err := svc.EnsureTarget(Target{ID: "cmdb", URL: "https://other.example.com", Secret: "other"}); err != nil {
+		t.Fatalf("ensure existing: %v", err)
+	}
+	if err := svc.EnsureTarget(Target{ID: "alerts", URL: "https://alerts.example.com", Secret: "a"}); err != nil {
+		t.Fatalf("ensure new: %v", err)
+	}
+
+	listed, err := svc.ListTargets()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	want := []Target{
+		{ID: "alerts", URL: "https://alerts.example.com"},
+		{ID: "cmdb", URL: "https://cmdb.example.com/hooks", Events: []string{event.ServiceRegistered}},
+	}
+	if !slices.EqualFunc(listed, want, equalTargets) {
+		t.Errorf("expected %+v without secrets, got %+v", want, listed)
+	}
+
+	stored, _ := svc.targets()
+	if stored[1].Secret != "s3cret" {
+		t.Errorf("expected the secret to be kept for signing, got %q", stored[1].Secret)
+	}
+
+	if err := svc.RemoveTarget("cmdb"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := svc.RemoveTarget("cmdb"); !errors.Is(err, ErrTargetNotFound) {
+		t.Errorf("expected ErrTargetNotFound, got %v", err)
+	}
+	if listed, _ := svc.ListTargets(); len(listed) != 1 || listed[0].ID != "alerts" {
+		t.Errorf("expected only alerts to remain, got %+v", listed)
+	}
+}
+
+func equalTargets(a, b Target) bool {
+	return a.ID == b.ID && a.URL == b.URL && a.Secret == b.Secret && slices.Equal(a.Events, b.Events)
+}
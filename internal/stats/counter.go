@@ -0,0 +1,98 @@
+// Package stats keeps the event counters behind the admin statistics. They
+// are cheap enough to update on every request: adding is a few atomic
+// operations and never takes a lock.
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// bucketCount is how many per-minute buckets a Counter keeps, an hour's worth
+	bucketCount = 60
+	// countBits is the width of the count within a bucket; the minute it
+	// counts takes the bits above
+	countBits = 32
+	countMask = 1<<countBits - 1
+)
+
+// Counter counts events since it was created or last reset, and over the
+// last hour in a ring of per-minute buckets. The last hour is the current
+// minute and the 59 before it. A nil Counter counts nothing and reports 0.
+type Counter struct {
+	total atomic.Int64
+	// buckets hold the Unix minute they count in their upper bits and the
+	// count in the lower countBits, so a bucket moves on to a new minute and
+	// counts its first events in one compare-and-swap
+	buckets [bucketCount]atomic.Uint64
+}
+
+// Add counts n events happening at now
+func (c *Counter) Add(now time.Time, n int) {
+	if c == nil || n <= 0 {
+		return
+	}
+	c.total.Add(int64(n))
+
+	minute := unixMinute(now)
+	bucket := &c.buckets[minute%bucketCount]
+	for {
+		old := bucket.Load()
+		stamp, count := old>>countBits, old&countMask
+		if stamp < minute {
+			// Left over from an hour or more ago
+			stamp, count = minute, 0
+		}
+		// A bucket stamped after now, as when the clock stepped back, keeps
+		// its stamp so its events aren't lost
+		count = min(count+uint64(n), countMask)
+		if bucket.CompareAndSwap(old, stamp<<countBits|count) {
+			return
+		}
+	}
+}
+
+// Total returns the number of events counted since the Counter was created
+// or last reset
+func (c *Counter) Total() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.total.Load()
+}
+
+// LastHour returns the number of events counted in the hour up to now: in
+// now's minute and the 59 minutes before it
+func (c *Counter) LastHour(now time.Time) int64 {
+	if c == nil {
+		return 0
+	}
+
+	minute := unixMinute(now)
+	var sum int64
+	for i := range c.buckets {
+		v := c.buckets[i].Load()
+		if stamp := v >> countBits; stamp <= minute && stamp+bucketCount > minute {
+			sum += int64(v & countMask)
+		}
+	}
+	return sum
+}
+
+// Reset forgets every event counted so far. Events counted while Reset runs
+// may survive it in part.
+func (c *Counter) Reset() {
+	if c == nil {
+		return
+	}
+	for i := range c.buckets {
+		c.buckets[i].Store(0)
+	}
+	c.total.Store(0)
+}
+
+// unixMinute returns the minutes since the Unix epoch at t, 0 for earlier times
+func unixMinute(t time.Time) uint64 {
+	return uint64(max(t.Unix()/60, 0))
+}
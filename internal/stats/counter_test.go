@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounter_LastHour(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		adds  []time.Duration // after start, one event each
+		at    time.Duration
+		want  int64
+		total int64
+	}{
+		{name: "same minute", adds: []time.Duration{0, 10 * time.Second}, at: 20 * time.Second, want: 2, total: 2},
+		{name: "last second of the hour", adds: []time.Duration{0}, at: 59*time.Minute + 29*time.Second, want: 1, total: 1},
+		{name: "hour after the event's minute", adds: []time.Duration{0}, at: 59*time.Minute + 30*time.Second, want: 0, total: 1},
+		{name: "minute boundary", adds: []time.Duration{-30 * time.Second, 29 * time.Second, 30 * time.Second}, at: 60*time.Minute - 30*time.Second, want: 1, total: 3},
+		{name: "bucket reused an hour later", adds: []time.Duration{0, 0, time.Hour}, at: time.Hour, want: 1, total: 3},
+		{name: "stale bucket not counted", adds: []time.Duration{0, 2 * time.Hour}, at: 2*time.Hour + time.Minute, want: 1, total: 2},
+		{name: "events after now", adds: []time.Duration{0, 5 * time.Minute}, at: time.Minute, want: 1, total: 2},
+		{name: "clock stepped back", adds: []time.Duration{time.Hour, 0}, at: time.Hour, want: 2, total: 2},
+		{name: "nothing counted", at: 0, want: 0, total: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Counter
+			for _, d := range tt.adds {
+				c.Add(start.Add(d), 1)
+			}
+			if got := c.LastHour(start.Add(tt.at)); got != tt.want {
+				t.Errorf("LastHour() = %d, want %d", got, tt.want)
+			}
+			if got := c.Total(); got != tt.total {
+				t.Errorf("Total() = %d, want %d", got, tt.total)
+			}
+		})
+	}
+}
+
+func TestCounter_AddMany(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	var c Counter
+	c.Add(now, 5)
+	c.Add(now, 0)
+	c.Add(now, -3)
+	c.Add(now, countMask)
+
+	if got, want := c.LastHour(now), int64(countMask); got != want {
+		t.Errorf("LastHour() = %d, want the bucket to saturate at %d", got, want)
+	}
+	if got, want := c.Total(), int64(5+countMask); got != want {
+		t.Errorf("Total() = %d, want %d", got, want)
+	}
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	var c Counter
+
+	// Each goroutine counts across the same minutes, so buckets move on to
+	// new minutes while others add to them
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				c.Add(start.Add(time.Duration(i)*time.Second), 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	end := start.Add(999 * time.Second)
+	if got := c.LastHour(end); got != 8000 {
+		t.Errorf("LastHour() = %d, want 8000", got)
+	}
+	if got := c.Total(); got != 8000 {
+		t.Errorf("Total() = %d, want 8000", got)
+	}
+}
+
+func TestCounter_Reset(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	var c Counter
+	c.Add(now, 3)
+	c.Reset()
+
+	if got := c.LastHour(now); got != 0 {
+		t.Errorf("LastHour() after Reset = %d, want 0", got)
+	}
+	if got := c.Total(); got != 0 {
+		t.Errorf("Total() after Reset = %d, want 0", got)
+	}
+
+	c.Add(now, 2)
+	if got := c.LastHour(now); got != 2 {
+		t.Errorf("LastHour() after counting again = %d, want 2", got)
+	}
+}
+
+func TestCounter_Nil(t *testing.T) {
+	var c *Counter
+	now := time.Now()
+	c.Add(now, 1)
+	c.Reset()
+	if got := c.LastHour(now); got != 0 {
+		t.Errorf("LastHour() = %d, want 0", got)
+	}
+	if got := c.Total(); got != 0 {
+		t.Errorf("Total() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,142 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// builtin are the rules every validator starts with; omitempty and dive are
+// handled by the parser
+var builtin = map[string]Func{
+	"required":   required,
+	"min":        minimum,
+	"max":        maximum,
+	"oneof":      oneOf,
+	"url":        httpURL,
+	"serviceid":  serviceID,
+	"capability": capability,
+}
+
+// stringRules are the built-in rules that only apply to strings
+var stringRules = []string{"url", "serviceid", "capability"}
+
+// sizes maps the kinds min and max apply to to the unit they are reported in
+var sizes = map[reflect.Kind]string{
+	reflect.String:  "characters",
+	reflect.Slice:   "items",
+	reflect.Array:   "items",
+	reflect.Map:     "items",
+	reflect.Int:     "",
+	reflect.Int8:    "",
+	reflect.Int16:   "",
+	reflect.Int32:   "",
+	reflect.Int64:   "",
+	reflect.Uint:    "",
+	reflect.Uint8:   "",
+	reflect.Uint16:  "",
+	reflect.Uint32:  "",
+	reflect.Uint64:  "",
+	reflect.Float32: "",
+	reflect.Float64: "",
+}
+
+// isEmpty reports whether v is the zero value or has no length
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// size returns what min and max compare: the length in characters of a
+// string, the length of a slice or map, or a number itself
+func size(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// units returns unit, singular when n is 1
+func units(n int, unit string) string {
+	if n == 1 {
+		return strings.TrimSuffix(unit, "s")
+	}
+	return unit
+}
+
+func required(v reflect.Value, _ string) string {
+	if isEmpty(v) {
+		return "is required"
+	}
+	return ""
+}
+
+func minimum(v reflect.Value, param string) string {
+	n, _ := strconv.Atoi(param)
+	if size(v) >= float64(n) {
+		return ""
+	}
+	switch unit := sizes[v.Kind()]; {
+	case unit != "":
+		return fmt.Sprintf("must have at least %d %s", n, units(n, unit))
+	case n == 0:
+		return "must not be negative"
+	}
+	return fmt.Sprintf("must be at least %d", n)
+}
+
+func maximum(v reflect.Value, param string) string {
+	n, _ := strconv.Atoi(param)
+	if size(v) <= float64(n) {
+		return ""
+	}
+	if unit := sizes[v.Kind()]; unit != "" {
+		return fmt.Sprintf("must be at most %d %s", n, units(n, unit))
+	}
+	return fmt.Sprintf("must be at most %d", n)
+}
+
+// oneOf accepts the space-separated values of param
+func oneOf(v reflect.Value, param string) string {
+	allowed := strings.Fields(param)
+	if slices.Contains(allowed, fmt.Sprint(v.Interface())) {
+		return ""
+	}
+	return "must be one of " + strings.Join(allowed, ", ")
+}
+
+func httpURL(v reflect.Value, _ string) string {
+	if validation.IsHTTPURL(v.String()) {
+		return ""
+	}
+	return "must be an absolute http or https URL"
+}
+
+func serviceID(v reflect.Value, _ string) string {
+	if validation.IsID(v.String()) {
+		return ""
+	}
+	return fmt.Sprintf("must be at most %d letters, digits, '.', '-' or '_' and start with a letter or digit", validation.MaxIDLength)
+}
+
+func capability(v reflect.Value, _ string) string {
+	if validation.IsCapability(v.String()) {
+		return ""
+	}
+	return "must be lowercase letters and digits separated by dashes"
+}
@@ -0,0 +1,372 @@
+// Package validate checks request structs against the rules in their
+// validate struct tags:
+//
+//	type createRequest struct {
+//		ID     string            `json:"id" validate:"required,serviceid"`
+//		Status string            `json:"status" validate:"omitempty,oneof=healthy draining"`
+//		Tags   []string          `json:"tags" validate:"max=8,dive,capability"`
+//		Labels map[string]string `json:"labels" validate:"dive,max=64"`
+//	}
+//
+// Rules are separated by commas and applied in order until one fails, so a
+// field is reported at most once. A rule's parameter follows "=". omitempty
+// skips the remaining rules for an empty value, and the rules after dive
+// apply to each element of a slice or value of a map instead of the field
+// itself. A nil pointer only fails required; other rules check what it
+// points to.
+//
+// Fields are reported by their JSON names. Structs nested in a field, by
+// value, pointer or in a slice, are checked too, so paths read like
+// endpoints[0].url and metadata.region. Fields of embedded structs are
+// reported as the JSON encoding promotes them.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// ErrInvalidTag is returned when a validate tag can't be parsed, such as one
+// naming an unknown rule; it is a mistake in the code, not in the request
+var ErrInvalidTag = errors.New("invalid validate tag")
+
+// Func checks a value against a rule, given the rule's parameter, and returns
+// why the value breaks it or "" when it doesn't. Pointers are dereferenced
+// before Func is called.
+type Func func(v reflect.Value, param string) string
+
+// Validator checks structs with the built-in rules and those registered on it
+type Validator struct {
+	mu    sync.RWMutex
+	rules map[string]Func
+
+	types sync.Map // reflect.Type to *structRules, parsed on first use
+}
+
+// New creates a validator knowing the built-in rules: required, omitempty,
+// dive, min, max, oneof, url, serviceid and capability
+func New() *Validator {
+	return &Validator{rules: maps.Clone(builtin)}
+}
+
+// Register adds a rule that tags can name, replacing any rule of that name
+func (v *Validator) Register(name string, fn Func) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules[name] = fn
+	v.types.Clear() // tags naming the rule may have been rejected
+}
+
+// Validate checks s, a struct or a pointer to one, and returns
+// validation.Errors listing every invalid field, or an error matching
+// ErrInvalidTag when its tags are malformed
+func (v *Validator) Validate(s any) error {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", s)
+	}
+
+	var errs validation.Errors
+	if err := v.checkStruct(&errs, "", rv); err != nil {
+		return err
+	}
+	return errs.Err()
+}
+
+// std is the validator behind the package functions
+var std = New()
+
+// Register adds a rule to the validator used by Validate
+func Register(name string, fn Func) {
+	std.Register(name, fn)
+}
+
+// Validate checks s with the built-in rules and those added by Register;
+// see Validator.Validate
+func Validate(s any) error {
+	return std.Validate(s)
+}
+
+// rule is one parsed rule of a tag
+type rule struct {
+	name  string
+	param string
+	fn    Func // nil for omitempty
+}
+
+// fieldRules is a struct field and the rules its tag sets
+type fieldRules struct {
+	index []int  // for reflect.Value.FieldByIndex, through embedded structs
+	name  string // JSON name
+	rules []rule // applied to the field
+	dive  bool
+	elem  []rule // applied to each element when dive is set
+}
+
+// structRules are the fields of a struct type, or why its tags are malformed
+type structRules struct {
+	fields []fieldRules
+	err    error
+}
+
+// checkStruct checks every field of the struct value rv, named path
+func (v *Validator) checkStruct(errs *validation.Errors, path string, rv reflect.Value) error {
+	rules := v.structRules(rv.Type())
+	if rules.err != nil {
+		return rules.err
+	}
+	for _, f := range rules.fields {
+		value, err := rv.FieldByIndexErr(f.index)
+		if err != nil {
+			continue // through a nil embedded pointer
+		}
+		if err := v.checkField(errs, joinPath(path, f.name), value, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkField applies a field's rules, then those of its elements and the
+// rules of structs nested in it
+func (v *Validator) checkField(errs *validation.Errors, path string, value reflect.Value, f fieldRules) error {
+	value, ok := apply(errs, path, value, f.rules)
+	if !ok {
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		if !f.dive && deref(value.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+		for i := range value.Len() {
+			if err := v.checkElem(errs, fmt.Sprintf("%s[%d]", path, i), value.Index(i), f); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !f.dive {
+			return nil
+		}
+		keys := value.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+		})
+		for _, key := range keys {
+			if err := v.checkElem(errs, joinPath(path, fmt.Sprint(key)), value.MapIndex(key), f); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return v.checkStruct(errs, path, value)
+	}
+	return nil
+}
+
+// checkElem checks an element of a slice or map field
+func (v *Validator) checkElem(errs *validation.Errors, path string, elem reflect.Value, f fieldRules) error {
+	if f.dive {
+		var ok bool
+		if elem, ok = apply(errs, path, elem, f.elem); !ok {
+			return nil
+		}
+	}
+	if elem.Kind() == reflect.Pointer && !elem.IsNil() {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Struct {
+		return v.checkStruct(errs, path, elem)
+	}
+	return nil
+}
+
+// apply checks value against rules in order, adding the first failure to
+// errs. It returns the value with pointers dereferenced, and whether the
+// caller should go on to check what the value holds.
+func apply(errs *validation.Errors, path string, value reflect.Value, rules []rule) (reflect.Value, bool) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			if slices.ContainsFunc(rules, func(r rule) bool { return r.name == "required" }) {
+				errs.Add(path, "is required")
+			}
+			return value, false
+		}
+		value = value.Elem()
+	}
+
+	for _, r := range rules {
+		if r.fn == nil {
+			if isEmpty(value) {
+				return value, false
+			}
+			continue
+		}
+		if msg := r.fn(value, r.param); msg != "" {
+			errs.Add(path, msg)
+			return value, false
+		}
+	}
+	return value, true
+}
+
+// structRules returns the parsed tags of a struct type
+func (v *Validator) structRules(t reflect.Type) *structRules {
+	if cached, ok := v.types.Load(t); ok {
+		return cached.(*structRules)
+	}
+
+	v.mu.RLock()
+	fields, err := v.parseStruct(t, nil)
+	v.mu.RUnlock()
+	parsed := &structRules{fields: fields, err: err}
+	v.types.Store(t, parsed)
+	return parsed
+}
+
+// parseStruct parses the tags of t's exported fields, promoting those of
+// embedded structs without a JSON name; index leads to t from the outermost
+// struct
+func (v *Validator) parseStruct(t reflect.Type, index []int) ([]fieldRules, error) {
+	var fields []fieldRules
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name, ok := jsonName(sf)
+		tag := sf.Tag.Get("validate")
+		if !ok || tag == "-" {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), i)
+
+		embedded := sf.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if sf.Anonymous && embedded.Kind() == reflect.Struct && sf.Tag.Get("json") == "" && tag == "" {
+			promoted, err := v.parseStruct(embedded, fieldIndex)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, promoted...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		f, err := v.parseTag(tag, sf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s.%s: %w", ErrInvalidTag, t.Name(), sf.Name, err)
+		}
+		f.index, f.name = fieldIndex, name
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// parseTag parses the rules of a validate tag set on a field of type t. The
+// caller holds v.mu.
+func (v *Validator) parseTag(tag string, t reflect.Type) (fieldRules, error) {
+	var f fieldRules
+	if tag == "" {
+		return f, nil
+	}
+
+	for part := range strings.SplitSeq(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "dive" {
+			if f.dive {
+				return f, errors.New("dive is given twice")
+			}
+			if k := deref(t).Kind(); k != reflect.Slice && k != reflect.Array && k != reflect.Map {
+				return f, fmt.Errorf("dive applies to slices and maps, not %s", k)
+			}
+			f.dive, t = true, deref(t).Elem()
+			continue
+		}
+
+		r, err := v.parseRule(name, param, t)
+		if err != nil {
+			return f, err
+		}
+		if f.dive {
+			f.elem = append(f.elem, r)
+		} else {
+			f.rules = append(f.rules, r)
+		}
+	}
+	return f, nil
+}
+
+// parseRule resolves one rule and checks that its parameter and the type of
+// the field it is set on suit it
+func (v *Validator) parseRule(name, param string, t reflect.Type) (rule, error) {
+	if name == "" {
+		return rule{}, errors.New("empty rule")
+	}
+	if name == "omitempty" {
+		return rule{name: name}, nil
+	}
+	fn, ok := v.rules[name]
+	if !ok {
+		return rule{}, fmt.Errorf("unknown rule %q", name)
+	}
+
+	switch name {
+	case "min", "max":
+		if _, err := strconv.Atoi(param); err != nil {
+			return rule{}, fmt.Errorf("%s needs an integer, got %q", name, param)
+		}
+		if _, ok := sizes[deref(t).Kind()]; !ok {
+			return rule{}, fmt.Errorf("%s applies to strings, numbers, slices and maps, not %s", name, deref(t).Kind())
+		}
+	case "oneof":
+		if len(strings.Fields(param)) == 0 {
+			return rule{}, errors.New("oneof needs the values allowed")
+		}
+	}
+	if slices.Contains(stringRules, name) && deref(t).Kind() != reflect.String {
+		return rule{}, fmt.Errorf("%s applies to strings, not %s", name, deref(t).Kind())
+	}
+	return rule{name: name, param: param, fn: fn}, nil
+}
+
+// jsonName returns the name a struct field is encoded under, and false for
+// fields the JSON encoding leaves out
+func jsonName(sf reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return sf.Name, true
+	}
+	return name, true
+}
+
+// joinPath names a field of the struct at path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// deref returns the type a pointer type points to, or t itself
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,245 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func TestValidator_ParseTag(t *testing.T) {
+	type ruleNames struct{ rules, elem []string }
+	var (
+		str     = reflect.TypeFor[string]()
+		num     = reflect.TypeFor[int]()
+		strs    = reflect.TypeFor[[]string]()
+		labels  = reflect.TypeFor[map[string]string]()
+		pointer = reflect.TypeFor[*string]()
+	)
+
+	tests := []struct {
+		name    string
+		tag     string
+		typ     reflect.Type
+		want    ruleNames
+		wantErr string
+	}{
+		{name: "empty", tag: "", typ: str},
+		{name: "single rule", tag: "required", typ: str, want: ruleNames{rules: []string{"required"}}},
+		{name: "rules in order", tag: "required,max=128,serviceid", typ: str, want: ruleNames{rules: []string{"required", "max=128", "serviceid"}}},
+		{name: "spaces around rules", tag: "required, url", typ: str, want: ruleNames{rules: []string{"required", "url"}}},
+		{name: "oneof values", tag: "oneof=healthy draining", typ: str, want: ruleNames{rules: []string{"oneof=healthy draining"}}},
+		{name: "omitempty", tag: "omitempty,url", typ: str, want: ruleNames{rules: []string{"omitempty", "url"}}},
+		{name: "pointer to string", tag: "required,url", typ: pointer, want: ruleNames{rules: []string{"required", "url"}}},
+		{name: "number range", tag: "min=0,max=65535", typ: num, want: ruleNames{rules: []string{"min=0", "max=65535"}}},
+		{name: "dive into slice", tag: "max=8,dive,capability", typ: strs, want: ruleNames{rules: []string{"max=8"}, elem: []string{"capability"}}},
+		{name: "dive into map", tag: "dive,max=256", typ: labels, want: ruleNames{elem: []string{"max=256"}}},
+		{name: "unknown rule", tag: "required,uuid", typ: str, wantErr: `unknown rule "uuid"`},
+		{name: "empty rule", tag: "required,,url", typ: str, wantErr: "empty rule"},
+		{name: "max without a number", tag: "max", typ: str, wantErr: "max needs an integer"},
+		{name: "min with a word", tag: "min=few", typ: strs, wantErr: "min needs an integer"},
+		{name: "max of a bool", tag: "max=1", typ: reflect.TypeFor[bool](), wantErr: "not bool"},
+		{name: "oneof without values", tag: "oneof=", typ: str, wantErr: "oneof needs the values"},
+		{name: "url of a number", tag: "url", typ: num, wantErr: "url applies to strings"},
+		{name: "dive into a string", tag: "dive,required", typ: str, wantErr: "dive applies to slices and maps"},
+		{name: "dive twice", tag: "dive,dive", typ: reflect.TypeFor[[][]string](), wantErr: "dive is given twice"},
+		{name: "element rule checked against element type", tag: "dive,url", typ: reflect.TypeFor[[]int](), wantErr: "url applies to strings"},
+	}
+
+	v := New()
+	names := func(rules []rule) []string {
+		var out []string
+		for _, r := range rules {
+			if r.param != "" {
+				out = append(out, r.name+"="+r.param)
+			} else {
+				out = append(out, r.name)
+			}
+		}
+		return out
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := v.parseTag(tt.tag, tt.typ)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.tag, err)
+			}
+			if got := names(f.rules); !slices.Equal(got, tt.want.rules) {
+				t.Errorf("expected rules %v, got %v", tt.want.rules, got)
+			}
+			if got := names(f.elem); !slices.Equal(got, tt.want.elem) {
+				t.Errorf("expected element rules %v, got %v", tt.want.elem, got)
+			}
+			if f.dive != (tt.want.elem != nil) {
+				t.Errorf("expected dive %v, got %v", tt.want.elem != nil, f.dive)
+			}
+		})
+	}
+}
+
+type testEndpoint struct {
+	URL    string `json:"url" validate:"url"`
+	Weight int    `json:"weight" validate:"min=0"`
+}
+
+type testCheck struct {
+	Type    string `json:"type" validate:"omitempty,oneof=http tcp"`
+	Timeout int    `json:"timeout_seconds,omitempty" validate:"max=60"`
+}
+
+type testBase struct {
+	UserID string `json:"user_id" validate:"required,max=8"`
+}
+
+type testRequest struct {
+	testBase
+	ID           string            `json:"id" validate:"required,serviceid"`
+	Name         *string           `json:"name" validate:"required"`
+	Status       string            `json:"status,omitempty" validate:"omitempty,oneof=healthy draining"`
+	Endpoints    []testEndpoint    `json:"endpoints" validate:"required"`
+	Capabilities []string          `json:"capabilities" validate:"max=2,dive,capability"`
+	Metadata     map[string]string `json:"metadata" validate:"dive,max=5"`
+	Check        *testCheck        `json:"check,omitempty"`
+	Ignored      string            `json:"-" validate:"required"`
+	Untagged     string            `json:"untagged"`
+}
+
+func TestValidate(t *testing.T) {
+	name := "payment"
+	valid := func() testRequest {
+		return testRequest{
+			testBase:  testBase{UserID: "user-1"},
+			ID:        "payment-1",
+			Name:      &name,
+			Endpoints: []testEndpoint{{URL: "http://payment-1:8080"}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(r *testRequest)
+		wantFields []string
+		wantMsgs   []string
+	}{
+		{name: "valid", modify: func(r *testRequest) {}},
+		{name: "valid with optional fields", modify: func(r *testRequest) {
+			r.Status = "draining"
+			r.Capabilities = []string{"payment", "refund-v2"}
+			r.Metadata = map[string]string{"zone": "eu-1"}
+			r.Check = &testCheck{Type: "tcp", Timeout: 60}
+		}},
+		{name: "required fields", modify: func(r *testRequest) { *r = testRequest{} },
+			wantFields: []string{"user_id", "id", "name", "endpoints"},
+			wantMsgs:   []string{"is required", "is required", "is required", "is required"}},
+		{name: "empty slice is missing", modify: func(r *testRequest) { r.Endpoints = []testEndpoint{} },
+			wantFields: []string{"endpoints"}},
+		{name: "first failing rule only", modify: func(r *testRequest) { r.ID = "" },
+			wantFields: []string{"id"}, wantMsgs: []string{"is required"}},
+		{name: "format rule", modify: func(r *testRequest) { r.ID = "payment/1" },
+			wantFields: []string{"id"}, wantMsgs: []string{"must be at most 128 letters, digits, '.', '-' or '_' and start with a letter or digit"}},
+		{name: "embedded field", modify: func(r *testRequest) { r.UserID = "user-1234" },
+			wantFields: []string{"user_id"}, wantMsgs: []string{"must be at most 8 characters"}},
+		{name: "length counts characters", modify: func(r *testRequest) { r.UserID = "üüüüüüüü" }},
+		{name: "oneof", modify: func(r *testRequest) { r.Status = "down" },
+			wantFields: []string{"status"}, wantMsgs: []string{"must be one of healthy, draining"}},
+		{name: "nested slice of structs", modify: func(r *testRequest) {
+			r.Endpoints = []testEndpoint{{URL: "http://payment-1:8080"}, {URL: "/payments", Weight: -1}}
+		}, wantFields: []string{"endpoints[1].url", "endpoints[1].weight"},
+			wantMsgs: []string{"must be an absolute http or https URL", "must not be negative"}},
+		{name: "slice length", modify: func(r *testRequest) { r.Capabilities = []string{"a", "b", "c"} },
+			wantFields: []string{"capabilities"}, wantMsgs: []string{"must be at most 2 items"}},
+		{name: "slice elements", modify: func(r *testRequest) { r.Capabilities = []string{"payment", "Refund"} },
+			wantFields: []string{"capabilities[1]"}, wantMsgs: []string{"must be lowercase letters and digits separated by dashes"}},
+		{name: "map values in key order", modify: func(r *testRequest) {
+			r.Metadata = map[string]string{"zone": "eu-west-1", "region": "europe", "team": "pay"}
+		}, wantFields: []string{"metadata.region", "metadata.zone"}},
+		{name: "nested pointer struct", modify: func(r *testRequest) { r.Check = &testCheck{Type: "grpc", Timeout: 61} },
+			wantFields: []string{"check.type", "check.timeout_seconds"},
+			wantMsgs:   []string{"must be one of http, tcp", "must be at most 60"}},
+		{name: "every field reported", modify: func(r *testRequest) {
+			r.ID = "-payment"
+			r.Name = nil
+			r.Endpoints[0].URL = "ftp://payment-1"
+			r.Capabilities = []string{"under_score"}
+		}, wantFields: []string{"id", "name", "endpoints[0].url", "capabilities[0]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+
+			err := Validate(&req)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var errs validation.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			var fields, msgs []string
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+				msgs = append(msgs, fe.Message)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+			if tt.wantMsgs != nil && !slices.Equal(msgs, tt.wantMsgs) {
+				t.Errorf("expected messages %q, got %q", tt.wantMsgs, msgs)
+			}
+		})
+	}
+}
+
+func TestValidator_Register(t *testing.T) {
+	type request struct {
+		Region string `json:"region" validate:"required,region"`
+	}
+	v := New()
+
+	if err := v.Validate(request{Region: "eu"}); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("expected ErrInvalidTag before the rule is registered, got %v", err)
+	}
+
+	v.Register("region", func(value reflect.Value, _ string) string {
+		if !slices.Contains([]string{"eu", "us"}, value.String()) {
+			return "must be a known region"
+		}
+		return ""
+	})
+	if err := v.Validate(request{Region: "eu"}); err != nil {
+		t.Errorf("expected a known region accepted, got %v", err)
+	}
+	var errs validation.Errors
+	if err := v.Validate(request{Region: "mars"}); !errors.As(err, &errs) || errs[0].Message != "must be a known region" {
+		t.Errorf("expected the registered rule's message, got %v", err)
+	}
+
+	// Rules registered on one validator are unknown to the others
+	if err := Validate(request{Region: "eu"}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("expected the package validator unchanged, got %v", err)
+	}
+}
+
+func TestValidate_NotAStruct(t *testing.T) {
+	for _, v := range []any{nil, "payment-1", []testEndpoint{}, (*testRequest)(nil)} {
+		if err := Validate(v); err == nil {
+			t.Errorf("Validate(%#v): expected an error", v)
+		}
+	}
+}
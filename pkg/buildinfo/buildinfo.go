@@ -0,0 +1,39 @@
+// Package buildinfo reports the version of the running binary. The values are
+// set at link time:
+//
+//	go build -ldflags "-X github.com/aq189/bin/pkg/buildinfo.Version=v1.2.0 \
+//		-X github.com/aq189/bin/pkg/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/aq189/bin/pkg/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without these flags report "dev" and "unknown".
+package buildinfo
+
+// Set with -ldflags -X; see the package documentation
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"build_date"`
+}
+
+// Get returns the build metadata, substituting defaults for values set empty
+func Get() Info {
+	return Info{
+		Version: valueOr(Version, "dev"),
+		Commit:  valueOr(Commit, "unknown"),
+		Date:    valueOr(Date, "unknown"),
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
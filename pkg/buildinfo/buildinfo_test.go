@@ -0,0 +1,26 @@
+package buildinfo
+
+import "testing"
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name            string
+		version, commit string
+		want            Info
+	}{
+		{name: "unset", version: "dev", commit: "unknown", want: Info{Version: "dev", Commit: "unknown", Date: "unknown"}},
+		{name: "set empty", want: Info{Version: "dev", Commit: "unknown", Date: "unknown"}},
+		{name: "set by ldflags", version: "v1.2.0", commit: "abc1234", want: Info{Version: "v1.2.0", Commit: "abc1234", Date: "unknown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+			Version, Commit = tt.version, tt.commit
+
+			if got := Get(); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -1 +1,303 @@
 package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/idgen"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens or bad signatures
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned when a token's expiry has passed
+	ErrTokenExpired = errors.New("token expired")
+	// ErrSignatureMismatch is the ErrInvalidToken of a well-formed token
+	// signed with another secret
+	ErrSignatureMismatch = fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	// ErrTokenTooLarge is the ErrInvalidToken of a token longer than
+	// Config.MaxTokenBytes. Generate returns it for claims too large to sign.
+	ErrTokenTooLarge = fmt.Errorf("%w: token too large", ErrInvalidToken)
+	// ErrNoSecrets is returned by SetSecrets when given no secret
+	ErrNoSecrets = errors.New("no signing secret")
+)
+
+const (
+	// algorithm is the only signing algorithm accepted
+	algorithm = "HS256"
+	// DefaultMaxTokenBytes is the longest token accepted when
+	// Config.MaxTokenBytes is unset
+	DefaultMaxTokenBytes = 8192
+)
+
+// encoding is the base64 of every token segment. It is strict so each
+// segment has a single encoding; decode also refuses the line breaks the
+// decoder would skip.
+var encoding = base64.RawURLEncoding.Strict()
+
+// Config holds JWT signing settings
+type Config struct {
+	// Secret is shorthand for Secrets holding only it, as the primary
+	// secret without an ID. It is ignored when Secrets is set.
+	Secret string
+	// Secrets are the secrets tokens are accepted under. The primary one
+	// signs new tokens; the others keep tokens they signed valid while a
+	// rotation is rolled out. Only one should be primary: when several are
+	// the first signs, and when none is the first does. SetSecrets refuses both.
+	Secrets []SecretVersion
+	Issuer  string
+	// MaxTokenBytes is the longest token Validate decodes and Generate
+	// signs; 0 uses DefaultMaxTokenBytes
+	MaxTokenBytes int
+	// IDs generates the token IDs (jti) of claims without one; nil uses
+	// random hex
+	IDs idgen.IDGenerator
+	// Clock stamps issue times and decides expiry; nil uses the system clock
+	Clock clock.Clock
+}
+
+// SecretVersion is one HMAC secret. Tokens signed with a secret that has an
+// ID carry it in their kid header.
+type SecretVersion struct {
+	ID      string
+	Value   string
+	Primary bool
+}
+
+// Manager signs and validates HMAC-SHA256 tokens
+type Manager struct {
+	issuer   string
+	maxBytes int
+	ids      idgen.IDGenerator
+	clock    clock.Clock
+
+	mu   sync.RWMutex
+	keys *keyring
+}
+
+// keyring is the secrets a Manager signs and validates with. It is replaced
+// as a whole by SetSecrets, never modified.
+type keyring struct {
+	primary SecretVersion
+	secrets []SecretVersion // in configured order, the primary included
+}
+
+// header is the JOSE header of every token
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+	// Crit lists extensions the token requires understood; none are, so
+	// tokens listing any are refused
+	Crit []string `json:"crit,omitempty"`
+}
+
+// New creates a new JWT manager
+func New(cfg Config) *Manager {
+	secrets := cfg.Secrets
+	if len(secrets) == 0 {
+		secrets = []SecretVersion{{Value: cfg.Secret, Primary: true}}
+	}
+	keys := &keyring{primary: secrets[0], secrets: secrets}
+	if i := slices.IndexFunc(secrets, func(s SecretVersion) bool { return s.Primary }); i >= 0 {
+		keys.primary = secrets[i]
+	}
+
+	maxBytes := cfg.MaxTokenBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxTokenBytes
+	}
+
+	return &Manager{
+		issuer:   cfg.Issuer,
+		maxBytes: maxBytes,
+		ids:      idgen.OrHex(cfg.IDs),
+		clock:    clock.OrReal(cfg.Clock),
+		keys:     keys,
+	}
+}
+
+// SetSecrets replaces the secrets tokens are signed and validated with, so a
+// new primary secret can be introduced, and an old one retired, without a
+// restart. Tokens in flight are validated with either set. The secrets are
+// refused, and the current ones kept, unless exactly one is primary and
+// their IDs are unique.
+func (m *Manager) SetSecrets(secrets []SecretVersion) error {
+	if len(secrets) == 0 {
+		return ErrNoSecrets
+	}
+	keys := &keyring{secrets: slices.Clone(secrets)}
+	primaries := 0
+	for i, secret := range secrets {
+		if secret.Primary {
+			keys.primary = secret
+			primaries++
+		}
+		if slices.ContainsFunc(secrets[:i], func(s SecretVersion) bool { return s.ID == secret.ID }) {
+			return fmt.Errorf("secret ID %q is used twice", secret.ID)
+		}
+	}
+	if primaries != 1 {
+		return fmt.Errorf("%d secrets are primary, want 1", primaries)
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.mu.Unlock()
+	return nil
+}
+
+// keyring returns the secrets in use
+func (m *Manager) keyring() *keyring {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys
+}
+
+// Generate signs the claims, filling in the token ID, issuer and issue time
+// when unset. Claims making a token longer than the size cap are refused
+// with ErrTokenTooLarge, since Validate would refuse the token.
+func (m *Manager) Generate(claims *token.Claims) (string, error) {
+	if claims.ID == "" {
+		claims.ID = m.ids.NewID()
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = m.issuer
+	}
+	if claims.IssuedAt.IsZero() {
+		claims.IssuedAt = m.clock.Now()
+	}
+
+	primary := m.keyring().primary
+	headerJSON, err := json.Marshal(header{Alg: algorithm, Typ: "JWT", Kid: primary.ID})
+	if err != nil {
+		return "", fmt.Errorf("marshal header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshal claims: %w", err)
+	}
+
+	signingInput := encode(headerJSON) + "." + encode(claimsJSON)
+	signed := signingInput + "." + encode(sign(primary.Value, signingInput))
+	if len(signed) > m.maxBytes {
+		return "", fmt.Errorf("%w: %d bytes, at most %d allowed", ErrTokenTooLarge, len(signed), m.maxBytes)
+	}
+	return signed, nil
+}
+
+// Validate verifies the token signature and expiry and returns its claims.
+// The signature is checked against the secret named by the token's kid
+// header only, and fails when no secret has that ID; tokens without a kid,
+// signed before secrets had IDs, are checked against every secret.
+//
+// Tokens over the size cap are refused before anything is decoded, and
+// each segment must be unpadded base64url in its one canonical encoding
+// and decode to valid UTF-8 JSON, so a signed token can't be altered into
+// another accepted string.
+func (m *Manager) Validate(tokenString string) (*token.Claims, error) {
+	if len(tokenString) > m.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d allowed", ErrTokenTooLarge, len(tokenString), m.maxBytes)
+	}
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	headerJSON, err := decode(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode header", ErrInvalidToken)
+	}
+	var h header
+	if err := unmarshal(headerJSON, &h); err != nil {
+		return nil, fmt.Errorf("%w: parse header", ErrInvalidToken)
+	}
+	if h.Alg != algorithm {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Alg)
+	}
+	if h.Typ != "" && !strings.EqualFold(h.Typ, "JWT") {
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidToken, h.Typ)
+	}
+	if h.Crit != nil {
+		return nil, fmt.Errorf("%w: unsupported critical extensions %q", ErrInvalidToken, h.Crit)
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode signature", ErrInvalidToken)
+	}
+	if !m.keyring().verify(h.Kid, parts[0]+"."+parts[1], signature) {
+		return nil, ErrSignatureMismatch
+	}
+
+	claimsJSON, err := decode(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode claims", ErrInvalidToken)
+	}
+	var claims token.Claims
+	if err := unmarshal(claimsJSON, &claims); err != nil {
+		return nil, fmt.Errorf("%w: parse claims", ErrInvalidToken)
+	}
+
+	if m.issuer != "" && claims.Issuer != m.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.IsExpired(m.clock.Now()) {
+		return nil, ErrTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// verify reports whether the secret with ID kid signed signingInput, or any
+// of the secrets when kid is empty
+func (k *keyring) verify(kid, signingInput string, signature []byte) bool {
+	if kid != "" {
+		i := slices.IndexFunc(k.secrets, func(s SecretVersion) bool { return s.ID == kid })
+		return i >= 0 && hmac.Equal(signature, sign(k.secrets[i].Value, signingInput))
+	}
+	for _, secret := range k.secrets {
+		if hmac.Equal(signature, sign(secret.Value, signingInput)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(secret, signingInput string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return encoding.EncodeToString(b)
+}
+
+// decode decodes a token segment, refusing the line breaks the base64
+// decoder would otherwise skip
+func decode(s string) ([]byte, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, errors.New("line break in segment")
+	}
+	return encoding.DecodeString(s)
+}
+
+// unmarshal parses a decoded segment, refusing invalid UTF-8, which
+// encoding/json would otherwise replace
+func unmarshal(data []byte, v any) error {
+	if !utf8.Valid(data) {
+		return errors.New("invalid UTF-8")
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,437 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/internal/idgen"
+)
+
+func generate(t *testing.T, m *Manager) string {
+	t.Helper()
+	signed, err := m.Generate(&token.Claims{Subject: "user-1", Type: token.TypeAccess, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	return signed
+}
+
+// kid returns the kid header of a token
+func kid(t *testing.T, signed string) string {
+	t.Helper()
+	headerJSON, err := decode(strings.Split(signed, ".")[0])
+	if err != nil {
+		t.Fatalf("decode header: %v", err)
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		t.Fatalf("parse header: %v", err)
+	}
+	return h.Kid
+}
+
+func TestManager_Rotation(t *testing.T) {
+	old := SecretVersion{ID: "2026-04", Value: "old-secret", Primary: true}
+	m := New(Config{Secrets: []SecretVersion{old}})
+	before := generate(t, m)
+
+	old.Primary = false
+	current := SecretVersion{ID: "2026-10", Value: "new-secret", Primary: true}
+	if err := m.SetSecrets([]SecretVersion{current, old}); err != nil {
+		t.Fatalf("set secrets: %v", err)
+	}
+	after := generate(t, m)
+
+	if got := kid(t, after); got != "2026-10" {
+		t.Errorf("expected tokens signed under the new primary, got kid %q", got)
+	}
+	for name, signed := range map[string]string{"before": before, "after": after} {
+		if _, err := m.Validate(signed); err != nil {
+			t.Errorf("expected the token signed %s the rotation to validate, got %v", name, err)
+		}
+	}
+
+	// Retiring the old secret ends the tokens it signed
+	if err := m.SetSecrets([]SecretVersion{current}); err != nil {
+		t.Fatalf("set secrets: %v", err)
+	}
+	if _, err := m.Validate(before); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("expected a token signed with a removed secret to fail, got %v", err)
+	}
+	if _, err := m.Validate(after); err != nil {
+		t.Errorf("expected the token signed with the primary to validate, got %v", err)
+	}
+}
+
+func TestManager_KidRouting(t *testing.T) {
+	secrets := []SecretVersion{
+		{ID: "a", Value: "secret-a"},
+		{ID: "b", Value: "secret-b", Primary: true},
+	}
+	m := New(Config{Secrets: secrets})
+
+	tests := []struct {
+		name    string
+		signer  *Manager
+		wantKid string
+		wantErr error
+	}{
+		{name: "kid of the primary", signer: New(Config{Secrets: secrets}), wantKid: "b"},
+		{name: "kid of another secret", signer: New(Config{Secrets: []SecretVersion{{ID: "a", Value: "secret-a", Primary: true}}}), wantKid: "a"},
+		{name: "legacy token without kid", signer: New(Config{Secret: "secret-a"})},
+		{name: "kid naming the wrong secret", signer: New(Config{Secrets: []SecretVersion{{ID: "b", Value: "secret-a", Primary: true}}}), wantKid: "b", wantErr: ErrSignatureMismatch},
+		{name: "kid naming no secret", signer: New(Config{Secrets: []SecretVersion{{ID: "z", Value: "secret-a", Primary: true}}}), wantKid: "z", wantErr: ErrSignatureMismatch},
+		{name: "unknown secret", signer: New(Config{Secrets: []SecretVersion{{ID: "a", Value: "secret-c", Primary: true}}}), wantKid: "a", wantErr: ErrSignatureMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := generate(t, tt.signer)
+			if got := kid(t, signed); got != tt.wantKid {
+				t.Errorf("expected kid %q, got %q", tt.wantKid, got)
+			}
+			if _, err := m.Validate(signed); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_SetSecretsRefusesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []SecretVersion
+	}{
+		{name: "none"},
+		{name: "no primary", secrets: []SecretVersion{{ID: "a", Value: "secret-a"}}},
+		{name: "two primaries", secrets: []SecretVersion{{ID: "a", Value: "secret-a", Primary: true}, {ID: "b", Value: "secret-b", Primary: true}}},
+		{name: "duplicate ID", secrets: []SecretVersion{{ID: "a", Value: "secret-a", Primary: true}, {ID: "a", Value: "secret-b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(Config{Secret: "test-secret"})
+			signed := generate(t, m)
+			if err := m.SetSecrets(tt.secrets); err == nil {
+				t.Fatal("expected the secrets refused")
+			}
+			if _, err := m.Validate(signed); err != nil {
+				t.Errorf("expected the secrets in use kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestManager_SetSecretsDuringValidation(t *testing.T) {
+	stable := SecretVersion{ID: "stable", Value: "stable-secret", Primary: true}
+	m := New(Config{Secrets: []SecretVersion{stable}})
+	signed := generate(t, m)
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				stable := stable
+				stable.Primary = j%2 == 0
+				rotating := SecretVersion{ID: fmt.Sprintf("rotating-%d-%d", i, j), Value: "rotating", Primary: !stable.Primary}
+				if err := m.SetSecrets([]SecretVersion{stable, rotating}); err != nil {
+					t.Errorf("set secrets: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, err := m.Validate(signed); err != nil {
+					t.Errorf("expected the token validated throughout, got %v", err)
+					return
+				}
+				if _, err := m.Generate(&token.Claims{Subject: "user-1"}); err != nil {
+					t.Errorf("generate: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// rawToken signs a token with the given header and claims JSON as they are
+func rawToken(secret, headerJSON, claimsJSON string) string {
+	signingInput := encode([]byte(headerJSON)) + "." + encode([]byte(claimsJSON))
+	return signingInput + "." + encode(sign(secret, signingInput))
+}
+
+// validClaimsJSON is the claims of a token that has not expired
+func validClaimsJSON() string {
+	return fmt.Sprintf(`{"sub":"user-1","exp":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+}
+
+func TestManager_TokenIDs(t *testing.T) {
+	ids, _ := idgen.New(idgen.FormatUUIDv7, nil)
+	m := New(Config{Secret: "test-secret", IDs: ids})
+
+	claims := &token.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := m.Generate(claims); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(claims.ID) != 36 || claims.ID[14] != '7' {
+		t.Errorf("expected a UUIDv7 token ID, got %q", claims.ID)
+	}
+
+	claims = &token.Claims{ID: "chosen", Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour)}
+	m.Generate(claims)
+	if claims.ID != "chosen" {
+		t.Errorf("expected the token ID given kept, got %q", claims.ID)
+	}
+}
+
+func TestManager_SizeCap(t *testing.T) {
+	m := New(Config{Secret: "test-secret", MaxTokenBytes: 512})
+
+	// Claims that fit are signed; the cap applies to the whole token
+	signed, err := m.Generate(&token.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := m.Validate(signed); err != nil {
+		t.Errorf("expected a token under the cap validated, got %v", err)
+	}
+
+	huge := &token.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour), Metadata: map[string]any{"note": strings.Repeat("x", 512)}}
+	if _, err := m.Generate(huge); !errors.Is(err, ErrTokenTooLarge) {
+		t.Errorf("expected claims over the cap refused, got %v", err)
+	}
+
+	// A signed token over the cap is refused before anything is decoded
+	large := New(Config{Secret: "test-secret"})
+	over, err := large.Generate(huge)
+	if err != nil {
+		t.Fatalf("generate under the default cap: %v", err)
+	}
+	for name, tokenString := range map[string]string{
+		"signed token": over,
+		"garbage":      strings.Repeat("!", 513),
+	} {
+		if _, err := m.Validate(tokenString); !errors.Is(err, ErrTokenTooLarge) || !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected the %s refused as too large, got %v", name, err)
+		}
+	}
+
+	if _, err := large.Validate(strings.Repeat("a", DefaultMaxTokenBytes) + ".b.c"); !errors.Is(err, ErrTokenTooLarge) {
+		t.Errorf("expected the default cap applied, got %v", err)
+	}
+}
+
+func TestManager_Malleability(t *testing.T) {
+	const secret = "test-secret"
+	m := New(Config{Secret: secret})
+	signed := generate(t, m)
+	parts := strings.Split(signed, ".")
+
+	// The last character of a 32 byte signature carries 2 unused bits; the
+	// character differing only in them decodes to the same bytes leniently
+	alphabet := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	last := strings.IndexByte(alphabet, parts[2][len(parts[2])-1])
+	sibling := parts[2][:len(parts[2])-1] + string(alphabet[last^1])
+
+	// The standard alphabet spells - and _ as + and /
+	standard := strings.NewReplacer("-", "+", "_", "/")
+
+	tests := []struct {
+		name   string
+		tamper string
+	}{
+		{name: "padded signature", tamper: signed + "="},
+		{name: "padded claims", tamper: parts[0] + "." + parts[1] + "==." + parts[2]},
+		{name: "unused signature bits set", tamper: parts[0] + "." + parts[1] + "." + sibling},
+		{name: "line break in signature", tamper: parts[0] + "." + parts[1] + "." + parts[2][:10] + "\n" + parts[2][10:]},
+		{name: "carriage return in header", tamper: "\r" + signed},
+		{name: "standard alphabet", tamper: standard.Replace(signed) + "+/"},
+		{name: "standard encoding of signature", tamper: parts[0] + "." + parts[1] + "." + base64.StdEncoding.EncodeToString(sign(secret, parts[0]+"."+parts[1]))},
+		{name: "extra segment", tamper: signed + "."},
+		{name: "whitespace", tamper: " " + signed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Validate(tt.tamper); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected %q refused, got %v", tt.tamper, err)
+			}
+		})
+	}
+}
+
+func TestManager_HostileContents(t *testing.T) {
+	const secret = "test-secret"
+	m := New(Config{Secret: secret})
+	claims := validClaimsJSON()
+
+	nested := strings.Repeat(`{"a":`, 100) + "1" + strings.Repeat("}", 100)
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "well formed", token: rawToken(secret, `{"alg":"HS256","typ":"JWT"}`, claims)},
+		{name: "no type", token: rawToken(secret, `{"alg":"HS256"}`, claims)},
+		{name: "type in lower case", token: rawToken(secret, `{"alg":"HS256","typ":"jwt"}`, claims)},
+		{name: "nested metadata", token: rawToken(secret, `{"alg":"HS256"}`, claims[:len(claims)-1]+`,"metadata":`+nested+"}")},
+		{name: "other type", token: rawToken(secret, `{"alg":"HS256","typ":"JWE"}`, claims), wantErr: true},
+		{name: "critical extension", token: rawToken(secret, `{"alg":"HS256","crit":["exp"]}`, claims), wantErr: true},
+		{name: "empty critical extensions", token: rawToken(secret, `{"alg":"HS256","crit":[]}`, claims), wantErr: true},
+		{name: "algorithm none", token: rawToken(secret, `{"alg":"none"}`, claims), wantErr: true},
+		{name: "algorithm in lower case", token: rawToken(secret, `{"alg":"hs256"}`, claims), wantErr: true},
+		{name: "header not an object", token: rawToken(secret, `["HS256"]`, claims), wantErr: true},
+		{name: "invalid UTF-8 in header", token: rawToken(secret, "{\"alg\":\"HS256\",\"kid\":\"\xff\"}", claims), wantErr: true},
+		{name: "invalid UTF-8 in claims", token: rawToken(secret, `{"alg":"HS256"}`, strings.Replace(claims, "user-1", "user-\xc3", 1)), wantErr: true},
+		{name: "claims not an object", token: rawToken(secret, `{"alg":"HS256"}`, `"user-1"`), wantErr: true},
+		{name: "claims of the wrong type", token: rawToken(secret, `{"alg":"HS256"}`, `{"sub":1}`), wantErr: true},
+		{name: "empty", token: "..", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Validate(tt.token)
+			if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected ErrInvalidToken, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected the token validated, got %v", err)
+			}
+		})
+	}
+}
+
+// randomString returns up to n runes of ASCII, JSON metacharacters and
+// multibyte characters
+func randomString(r *rand.Rand, n int) string {
+	const pool = "abcXYZ019 -_.\"\\/<>&\n\t\u0000é日本🔑\u2028"
+	runes := []rune(pool)
+	var b strings.Builder
+	for range r.IntN(n + 1) {
+		b.WriteRune(runes[r.IntN(len(runes))])
+	}
+	return b.String()
+}
+
+// randomMetadata returns metadata of the JSON types claims decode to:
+// strings, booleans, arrays and nested objects
+func randomMetadata(r *rand.Rand, depth int) map[string]any {
+	metadata := make(map[string]any)
+	for range r.IntN(4) {
+		var value any
+		switch r.IntN(4) {
+		case 0:
+			value = randomString(r, 12)
+		case 1:
+			value = r.IntN(2) == 0
+		case 2:
+			value = []any{randomString(r, 4), r.IntN(2) == 0}
+		default:
+			if depth > 0 {
+				value = randomMetadata(r, depth-1)
+			}
+		}
+		metadata[randomString(r, 8)] = value
+	}
+	return metadata
+}
+
+func TestManager_RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(1385, 1))
+	m := New(Config{Secret: "test-secret", Issuer: "root-server"})
+	now := time.Now()
+
+	for i := range 500 {
+		want := &token.Claims{
+			Subject:   randomString(r, 20),
+			Audience:  randomString(r, 10),
+			Type:      []token.Type{token.TypeAccess, token.TypeRefresh}[r.IntN(2)],
+			TenantID:  randomString(r, 10),
+			IssuedAt:  now.Add(-time.Duration(r.IntN(1000)) * time.Second),
+			ExpiresAt: now.Add(time.Duration(1+r.IntN(100000)) * time.Second),
+		}
+		if metadata := randomMetadata(r, 3); len(metadata) > 0 {
+			want.Metadata = metadata
+		}
+		for range r.IntN(3) {
+			want.Roles = append(want.Roles, randomString(r, 8))
+			want.Scopes = append(want.Scopes, randomString(r, 16))
+		}
+
+		signed, err := m.Generate(want)
+		if err != nil {
+			t.Fatalf("claims %d: generate: %v", i, err)
+		}
+		got, err := m.Validate(signed)
+		if err != nil {
+			t.Fatalf("claims %d: expected %+v validated, got %v", i, want, err)
+		}
+
+		if !got.IssuedAt.Equal(want.IssuedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+			t.Errorf("claims %d: expected times %v and %v, got %v and %v", i, want.IssuedAt, want.ExpiresAt, got.IssuedAt, got.ExpiresAt)
+		}
+		got.IssuedAt, got.ExpiresAt = want.IssuedAt, want.ExpiresAt
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("claims %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+// FuzzValidate feeds Validate arbitrary strings. It must never panic, and a
+// token it accepts must be one Generate could have produced: under the cap,
+// and with each segment in its canonical encoding of valid UTF-8.
+func FuzzValidate(f *testing.F) {
+	const secret = "fuzz-secret"
+	m := New(Config{Secret: secret, MaxTokenBytes: 2048})
+	signed, err := m.Generate(&token.Claims{Subject: "user-1", Roles: []string{"admin"}, ExpiresAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		f.Fatalf("generate: %v", err)
+	}
+
+	f.Add(signed)
+	f.Add(signed[:len(signed)/2])
+	f.Add(signed[:strings.LastIndexByte(signed, '.')+1])
+	f.Add(strings.Join(strings.Split(signed, ".")[:2], "."))
+	f.Add(rawToken(secret, `{"alg":"HS256","typ":"JWT","kid":""}`, validClaimsJSON()))
+	f.Add(rawToken(secret, `{"alg":"HS256"}`, `{"metadata":`+strings.Repeat("[", 500)+strings.Repeat("]", 500)+`}`))
+	f.Add("eyJhbGciOiJIUzI1NiJ9.e30.AAAA")
+	f.Add("bm90IGEgdG9rZW4=.Zm9v.YmFy")
+	f.Add("...")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, tokenString string) {
+		claims, err := m.Validate(tokenString)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidToken) && !errors.Is(err, ErrTokenExpired) {
+				t.Fatalf("expected ErrInvalidToken or ErrTokenExpired, got %v", err)
+			}
+			return
+		}
+		if claims == nil {
+			t.Fatal("expected claims for an accepted token")
+		}
+		if len(tokenString) > 2048 {
+			t.Fatalf("accepted a %d byte token over the cap", len(tokenString))
+		}
+		for _, part := range strings.Split(tokenString, ".") {
+			decoded, err := encoding.DecodeString(part)
+			if err != nil || encode(decoded) != part {
+				t.Fatalf("accepted segment %q, which is not canonical", part)
+			}
+			if !utf8.Valid(decoded) && part != strings.Split(tokenString, ".")[2] {
+				t.Fatalf("accepted segment %q of invalid UTF-8", part)
+			}
+		}
+	})
+}
@@ -1,4 +1,11 @@
 package logger
 
+// ILogger is the structured logging interface used across the server.
+// Fields are passed as alternating key/value pairs.
 type ILogger interface {
+	Debug(msg string, fields ...any)
+	Info(msg string, fields ...any)
+	Warn(msg string, fields ...any)
+	Error(msg string, fields ...any)
+	With(fields ...any) ILogger
 }
@@ -1,15 +1,89 @@
 package logger
 
-import "fmt"
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
 
+// Config holds logger settings
+type Config struct {
+	Level  string    // debug, info, warn, error
+	Format string    // json, text
+	Output io.Writer // defaults to os.Stdout
+	// SensitiveKeys are masked like DefaultSensitiveKeys, which always apply
+	SensitiveKeys []string
+	// MaxValueLength truncates longer string and error fields; 0 uses 8192 bytes
+	MaxValueLength int
+}
+
+// Logger is the slog-backed implementation of ILogger
 type Logger struct {
+	logger *slog.Logger
+}
+
+// NewLogger creates a new logger from the given configuration
+func NewLogger(cfg Config) *Logger {
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       parseLevel(cfg.Level),
+		ReplaceAttr: newRedactor(cfg).replaceAttr,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(out, opts)
+	} else {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+
+	return &Logger{logger: slog.New(handler)}
+}
+
+// NewNop creates a logger that discards all output
+func NewNop() *Logger {
+	return NewLogger(Config{Output: io.Discard})
+}
+
+// Debug logs a message at debug level
+func (l *Logger) Debug(msg string, fields ...any) {
+	l.logger.Debug(msg, fields...)
+}
+
+// Info logs a message at info level
+func (l *Logger) Info(msg string, fields ...any) {
+	l.logger.Info(msg, fields...)
+}
+
+// Warn logs a message at warn level
+func (l *Logger) Warn(msg string, fields ...any) {
+	l.logger.Warn(msg, fields...)
+}
+
+// Error logs a message at error level
+func (l *Logger) Error(msg string, fields ...any) {
+	l.logger.Error(msg, fields...)
 }
 
-func NewLogger() *Logger {
-	return &Logger{}
+// With returns a logger that always includes the given fields
+func (l *Logger) With(fields ...any) ILogger {
+	return &Logger{logger: l.logger.With(fields...)}
 }
 
-func (l *Logger) Info(message string) {
-	// Implementation for info level logging
-	fmt.Println("love you bin")
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
 }
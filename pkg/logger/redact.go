@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultSensitiveKeys are masked by every logger. A field is sensitive when
+// its key, ignoring case, is one of these or ends in one after "_" or "-",
+// such as refresh_token or client-secret.
+var DefaultSensitiveKeys = []string{"token", "authorization", "password", "secret"}
+
+// defaultMaxValueLength is the longest string field logged in full
+const defaultMaxValueLength = 8192
+
+// visibleSuffix is how many trailing characters of a masked value are kept
+const visibleSuffix = 4
+
+// masked replaces the hidden part of a sensitive value
+const masked = "****"
+
+// redactor rewrites fields before they are written: values of sensitive
+// keys are masked and long strings and errors are truncated
+type redactor struct {
+	keys           []string // lower case
+	maxValueLength int
+}
+
+func newRedactor(cfg Config) redactor {
+	keys := slices.Concat(DefaultSensitiveKeys, cfg.SensitiveKeys)
+	for i, key := range keys {
+		keys[i] = strings.ToLower(key)
+	}
+
+	maxValueLength := cfg.MaxValueLength
+	if maxValueLength <= 0 {
+		maxValueLength = defaultMaxValueLength
+	}
+	return redactor{keys: keys, maxValueLength: maxValueLength}
+}
+
+// replaceAttr is the slog.HandlerOptions.ReplaceAttr of every logger
+func (r redactor) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch a.Key {
+		case slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey:
+			return a
+		}
+	}
+
+	value := a.Value.Resolve()
+	if r.sensitive(a.Key) {
+		return slog.String(a.Key, mask(valueString(value)))
+	}
+
+	switch value.Kind() {
+	case slog.KindString:
+		if s := value.String(); len(s) > r.maxValueLength {
+			return slog.String(a.Key, truncate(s, r.maxValueLength))
+		}
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			if s := err.Error(); len(s) > r.maxValueLength {
+				return slog.String(a.Key, truncate(s, r.maxValueLength))
+			}
+		}
+	}
+	return a
+}
+
+// sensitive reports whether values logged under key must be masked
+func (r redactor) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range r.keys {
+		if key == sensitive || strings.HasSuffix(key, "_"+sensitive) || strings.HasSuffix(key, "-"+sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueString formats a field value as the text handler would
+func valueString(v slog.Value) string {
+	if v.Kind() == slog.KindAny {
+		return fmt.Sprint(v.Any())
+	}
+	return v.String()
+}
+
+// mask hides all but the last visibleSuffix characters of s. Values too
+// short to keep a suffix without giving most of them away are hidden whole.
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= 2*visibleSuffix {
+		return masked
+	}
+
+	suffix := s
+	for range utf8.RuneCountInString(s) - visibleSuffix {
+		_, size := utf8.DecodeRuneInString(suffix)
+		suffix = suffix[size:]
+	}
+	return masked + suffix
+}
+
+// truncate shortens s to at most limit bytes without splitting a character
+// and notes how much was cut
+func truncate(s string, limit int) string {
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...[truncated %d bytes]", s[:cut], len(s)-cut)
+}
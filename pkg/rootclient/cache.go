@@ -0,0 +1,83 @@
+package rootclient
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// cachedResponse is a response body with the ETag the server tagged it with
+type cachedResponse struct {
+	etag string
+	body []byte
+}
+
+// responseCache holds the last response of each conditional GET, one entry
+// per path and set of call headers
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+func (c *responseCache) get(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[key]
+	return cached, ok
+}
+
+func (c *responseCache) put(key string, cached cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedResponse)
+	}
+	c.entries[key] = cached
+}
+
+// getConditional performs a GET with the ETag of the cached response for
+// path, if any, and returns the cached body when the server answers 304 Not
+// Modified. Tagged responses replace the cached one.
+func (c *Client) getConditional(ctx context.Context, path string, callOpts []CallOption) ([]byte, error) {
+	key := cacheKey(path, callOpts)
+	cached, ok := c.cache.get(key)
+	if ok {
+		callOpts = append(slices.Clone(callOpts), WithHeader("If-None-Match", cached.etag))
+	}
+
+	resp, body, err := c.send(ctx, http.MethodGet, path, nil, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if !ok {
+			return nil, fmt.Errorf("unexpected %s for %s", resp.Status, path)
+		}
+		return cached.body, nil
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.cache.put(key, cachedResponse{etag: etag, body: body})
+	}
+	return body, nil
+}
+
+// cacheKey identifies a conditional GET by its path and call headers, which
+// may select a different tenant's view of the same path
+func cacheKey(path string, callOpts []CallOption) string {
+	var options callOptions
+	for _, opt := range callOpts {
+		opt(&options)
+	}
+
+	var b strings.Builder
+	b.WriteString(path)
+	for _, name := range slices.Sorted(maps.Keys(options.header)) {
+		b.WriteString("\n" + name + ": " + strings.Join(options.header[name], ", "))
+	}
+	return b.String()
+}
@@ -2,41 +2,124 @@ package rootclient
 
 import (
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/aq189/bin/pkg/tracing"
+	"github.com/aq189/bin/pkg/validation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Client is the Root Server client SDK
+// Client is the Root Server client SDK.
+// Failed calls return an APIError: match it with errors.Is against ErrNotFound,
+// ErrUnauthorized, ErrForbidden or ErrConflict, and use errors.As with a
+// *RetryableError to read the backoff hint of a 429 or 503 response.
 type Client struct {
-	baseURL    string
-	apiKey     string
-	httpClient *http.Client
+	hosts         hostSet
+	apiPrefix     string // prepended to every API path, e.g. "/v1"
+	apiKey        string
+	userAgent     string
+	httpClient    *http.Client
+	requestHooks  []func(*http.Request)
+	responseHooks []func(*http.Response, error)
+	cache         responseCache   // listings by ETag, for conditional requests
+	validator     *tokenValidator // set by WithLocalValidation
+	instrumentor  Instrumentor    // nil observes nothing
+	err           error           // configuration error returned by every call
 }
 
+// DefaultAPIVersion is the API version clients call unless Config.APIVersion says otherwise
+const DefaultAPIVersion = "v1"
+
+// UnversionedAPI as Config.APIVersion calls the deprecated routes without a
+// version prefix, for servers that predate versioned routes
+const UnversionedAPI = "none"
+
 // Config holds client configuration
 type Config struct {
 	BaseURL string
 	APIKey  string
-	Timeout time.Duration
+	// BaseURLs lists several root servers to fail over between, the first
+	// one preferred, in place of BaseURL: a request failing with a
+	// connection error or a 5xx response is sent to the next one, and the
+	// client keeps using the one that answered until the first is healthy again
+	BaseURLs []string
+	// FailoverProbeInterval is how often, while failed over, the first URL's
+	// /health is checked to move back to it; zero uses 30 seconds
+	FailoverProbeInterval time.Duration
+	// APIVersion selects the path prefix of API calls; empty uses DefaultAPIVersion
+	APIVersion string
+	Timeout    time.Duration
+	TLS        TLSConfig
+	// TracerProvider, when set, records a client span per request and sends
+	// its W3C traceparent header so server spans join the caller's trace
+	TracerProvider trace.TracerProvider
+	// Instrumentor, when set, observes the latency and outcome of every request
+	Instrumentor Instrumentor
 }
 
-// New creates a new Root Server client
-func New(config Config) *Client {
+// New creates a new Root Server client. Options are applied after config.
+// If the TLS files cannot be loaded, every call returns that error.
+func New(config Config, opts ...Option) *Client {
 	if config.Timeout == 0 {
 		config.Timeout = 10 * time.Second
 	}
 
-	return &Client{
-		baseURL: config.BaseURL,
-		apiKey:  config.APIKey,
+	if config.APIVersion == "" {
+		config.APIVersion = DefaultAPIVersion
+	}
+
+	if config.FailoverProbeInterval <= 0 {
+		config.FailoverProbeInterval = defaultProbeInterval
+	}
+	urls := slices.Clone(config.BaseURLs)
+	if len(urls) == 0 {
+		urls = []string{config.BaseURL}
+	}
+
+	c := &Client{
+		hosts:        hostSet{urls: urls, probeInterval: config.FailoverProbeInterval},
+		apiPrefix:    "/" + config.APIVersion,
+		apiKey:       config.APIKey,
+		instrumentor: config.Instrumentor,
 		httpClient: &http.Client{
 			Timeout: config.Timeout,
 		},
 	}
+	if config.APIVersion == UnversionedAPI {
+		c.apiPrefix = ""
+	}
+
+	if !config.TLS.isZero() {
+		transport, err := config.TLS.transport()
+		if err != nil {
+			c.err = fmt.Errorf("configure tls: %w", err)
+		} else {
+			c.httpClient.Transport = transport
+		}
+	}
+
+	if config.TracerProvider != nil {
+		c.httpClient.Transport = tracing.Transport(c.httpClient.Transport, config.TracerProvider)
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 // Auth returns the authentication service client
@@ -54,43 +137,155 @@ func (c *Client) Registry() *RegistryClient {
 	return &RegistryClient{client: c}
 }
 
-// doRequest performs an HTTP request
-func (c *Client) doRequest(ctx context.Context, method, path string, body any, result any) error {
-	var bodyReader io.Reader
+// doRequest performs an HTTP request tagged with the context's request ID and
+// decodes the response into result
+func (c *Client) doRequest(ctx context.Context, method, path string, body any, result any, callOpts ...CallOption) error {
+	resp, respBody, err := c.send(ctx, method, path, body, callOpts...)
+	if err != nil {
+		return err
+	}
+
+	if result != nil && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// send performs an HTTP request tagged with the context's request ID and
+// returns the response with its body read.
+// Error responses are returned as an APIError; 429 and 503 as *RetryableError.
+// Responses are requested gzipped and decompressed here rather than by the
+// transport, so it works the same through any http.Client.
+// With several base URLs, requests shouldFailOver lets through are sent to
+// the next URL when one fails, and the error of the last one is returned.
+func (c *Client) send(ctx context.Context, method, path string, body any, callOpts ...CallOption) (*http.Response, []byte, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	var options callOptions
+	for _, opt := range callOpts {
+		opt(&options)
+	}
+
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
-		if err != nil {
-			return fmt.Errorf("marshal request body: %w", err)
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, nil, fmt.Errorf("marshal request body: %w", err)
+		}
+	}
+
+	c.probePrimary()
+	requestID := requestIDFromContext(ctx)
+	var (
+		resp     *http.Response
+		respBody []byte
+		err      error
+	)
+	for _, baseURL := range c.hosts.order() {
+		resp, respBody, err = c.attempt(ctx, baseURL, method, path, data, options, requestID)
+		if err == nil {
+			c.hosts.succeeded(baseURL)
+			return resp, respBody, nil
+		}
+		if !shouldFailOver(ctx, err, method, options.header) {
+			break
 		}
+	}
+	return nil, nil, err
+}
+
+// attempt sends a request to one base URL and hands its outcome to the
+// instrumentor
+func (c *Client) attempt(ctx context.Context, baseURL, method, path string, data []byte, options callOptions, requestID string) (*http.Response, []byte, error) {
+	var bodyReader io.Reader
+	if data != nil {
 		bodyReader = bytes.NewReader(data)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	var reused bool
+	if c.instrumentor != nil {
+		ctx = connTrace(ctx, &reused)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+c.apiPrefix+path, bodyReader)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, nil, fmt.Errorf("create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set(RequestIDHeader, requestID)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	for key, values := range options.header {
+		req.Header[key] = values
+	}
+	c.runRequestHooks(req)
+
+	start := time.Now()
+	resp, respBody, err := c.roundTrip(req, requestID)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.observe(method, routeOf(path, options), status, reused, time.Since(start), err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBody, nil
+}
 
+// roundTrip sends req and reads its response. It returns the response along
+// with the error of an error response, so its status can be observed.
+func (c *Client) roundTrip(req *http.Request, requestID string) (*http.Response, []byte, error) {
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+		c.runResponseHooks(nil, nil, err)
+		return nil, nil, fmt.Errorf("do request (request_id %s): %w", requestID, err)
 	}
 	defer resp.Body.Close()
 
+	respBody, err := readBody(resp)
+	c.runResponseHooks(resp, respBody, err)
+	if err != nil {
+		return resp, nil, fmt.Errorf("read response (request_id %s): %w", requestID, err)
+	}
+
 	if resp.StatusCode >= 400 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return resp, nil, newAPIError(resp, respBody, requestID)
 	}
 
-	if result != nil && resp.StatusCode != http.StatusNoContent {
-		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-			return fmt.Errorf("decode response: %w", err)
-		}
+	return resp, respBody, nil
+}
+
+// readBody reads the response body, decompressing a gzipped one. The response
+// headers are then adjusted as the transport does when it decompresses.
+func readBody(resp *http.Response) ([]byte, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return io.ReadAll(resp.Body)
 	}
 
-	return nil
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return body, nil
 }
 
 // AuthClient handles authentication operations
@@ -102,31 +297,61 @@ type AuthClient struct {
 type IssueTokenRequest struct {
 	Subject  string         `json:"subject"`
 	Roles    []string       `json:"roles,omitempty"`
+	Scopes   []string       `json:"scopes,omitempty"` // empty issues an unscoped token
 	Audience string         `json:"audience,omitempty"`
+	Tenant   string         `json:"tenant,omitempty"` // empty inherits the caller's tenant
 	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // TokenResponse represents a token response
 type TokenResponse struct {
-	Token     string    `json:"token"`
-	Type      string    `json:"type"`
-	ExpiresAt time.Time `json:"expires_at"`
-	IssuedAt  time.Time `json:"issued_at"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Type         string    `json:"type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	IssuedAt     time.Time `json:"issued_at"`
 }
 
-// IssueToken requests a new JWT token
-func (a *AuthClient) IssueToken(ctx context.Context, req IssueTokenRequest) (*TokenResponse, error) {
+// IssueToken requests a new JWT token.
+// It returns ErrUnauthorized when the client's API key is rejected, and
+// ErrForbidden when a caller without the admin or issuer role asks for
+// another subject or for roles it does not hold. Servers rejecting unknown
+// audiences fail an Audience naming no registered service with an APIError
+// of status 400.
+func (a *AuthClient) IssueToken(ctx context.Context, req IssueTokenRequest, callOpts ...CallOption) (*TokenResponse, error) {
 	var resp TokenResponse
-	if err := a.client.doRequest(ctx, http.MethodPost, "/auth/token", req, &resp); err != nil {
+	if err := a.client.doRequest(ctx, http.MethodPost, "/auth/token", req, &resp, callOpts...); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-// ValidateToken validates a JWT token
-func (a *AuthClient) ValidateToken(ctx context.Context, token string) error {
-	req := map[string]string{"token": token}
-	return a.client.doRequest(ctx, http.MethodPost, "/auth/validate", req, nil)
+// ValidateOptions narrows what ValidateToken accepts. The zero value accepts
+// any valid access token.
+type ValidateOptions struct {
+	// Audience is the ID of the service the token must have been issued for,
+	// typically the caller's own, so a service can check a token is meant
+	// for it. Tokens issued for another audience or for none are rejected.
+	Audience string
+}
+
+// validateTokenRequest is the body of POST /auth/validate
+type validateTokenRequest struct {
+	Token    string `json:"token"`
+	Audience string `json:"audience,omitempty"`
+}
+
+// ValidateToken validates a JWT token.
+// It returns ErrUnauthorized when the token is invalid, expired or revoked,
+// or wasn't issued for opts.Audience. With WithLocalValidation most calls are
+// answered without the server, and tokens rejected locally fail with an
+// error matching ErrUnauthorized that is not an APIError.
+func (a *AuthClient) ValidateToken(ctx context.Context, token string, opts ValidateOptions, callOpts ...CallOption) error {
+	if v := a.client.validator; v != nil {
+		return v.validate(ctx, token, opts.Audience, a.validateRemote(token, callOpts))
+	}
+	req := validateTokenRequest{Token: token, Audience: opts.Audience}
+	return a.client.doRequest(ctx, http.MethodPost, "/auth/validate", req, nil, callOpts...)
 }
 
 // SessionClient handles session operations
@@ -142,44 +367,120 @@ type CreateSessionRequest struct {
 	TTL       int            `json:"ttl"` // minutes
 }
 
+// Validate applies the server's rules for user and service IDs and rejects
+// negative TTLs. The maximum TTL and data size are configured on the server
+// and checked there. It returns validation.Errors listing every invalid field.
+func (r CreateSessionRequest) Validate() error {
+	var errs validation.Errors
+
+	if r.UserID == "" {
+		errs.Add("user_id", "is required")
+	} else if len(r.UserID) > validation.MaxIDLength {
+		errs.Add("user_id", fmt.Sprintf("must be at most %d characters", validation.MaxIDLength))
+	}
+
+	if r.ServiceID == "" {
+		errs.Add("service_id", "is required")
+	} else if !validation.IsID(r.ServiceID) {
+		errs.Add("service_id", fmt.Sprintf("must be at most %d letters, digits, '.', '-' or '_' and start with a letter or digit", validation.MaxIDLength))
+	}
+
+	if r.TTL < 0 {
+		errs.Add("ttl", "must not be negative")
+	}
+
+	return errs.Err()
+}
+
 // Session represents a session
 type Session struct {
 	ID        string         `json:"id"`
 	UserID    string         `json:"user_id"`
 	ServiceID string         `json:"service_id"`
+	TenantID  string         `json:"tenant_id,omitempty"`
 	Data      map[string]any `json:"data"`
 	CreatedAt time.Time      `json:"created_at"`
 	ExpiresAt time.Time      `json:"expires_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 }
 
-// Create creates a new session
-func (s *SessionClient) Create(ctx context.Context, req CreateSessionRequest) (*Session, error) {
+// Create creates a new session. Invalid requests fail with validation.Errors
+// before anything is sent. It returns ErrConflict when the user already holds
+// the server's per-user session limit. Each call carries an idempotency key,
+// so failing over after the server created the session doesn't create
+// another one.
+func (s *SessionClient) Create(ctx context.Context, req CreateSessionRequest, callOpts ...CallOption) (*Session, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
 	var session Session
-	if err := s.client.doRequest(ctx, http.MethodPost, "/session", req, &session); err != nil {
+	if err := s.client.doRequest(ctx, http.MethodPost, "/session", req, &session, withIdempotencyKey(callOpts)...); err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-// Get retrieves a session by ID
-func (s *SessionClient) Get(ctx context.Context, id string) (*Session, error) {
+// GetOrCreateSessionRequest asks for a user's active session on a service,
+// creating one from CreateSessionRequest when there is none
+type GetOrCreateSessionRequest struct {
+	CreateSessionRequest
+	MergeData bool `json:"merge_data"` // add Data to an existing session's data
+}
+
+// GetOrCreate returns the user's newest active session on the service, or
+// creates one, and reports whether it was created. An existing session keeps
+// its expiry, and its data unless MergeData is set.
+func (s *SessionClient) GetOrCreate(ctx context.Context, req GetOrCreateSessionRequest, callOpts ...CallOption) (*Session, bool, error) {
+	if err := req.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	resp, body, err := s.client.send(ctx, http.MethodPost, "/session/get-or-create", req, callOpts...)
+	if err != nil {
+		return nil, false, err
+	}
+	var session Session
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, false, fmt.Errorf("decode response: %w", err)
+	}
+	return &session, resp.StatusCode == http.StatusCreated, nil
+}
+
+// Get retrieves a session by ID.
+// It returns ErrNotFound when the session does not exist or has expired.
+func (s *SessionClient) Get(ctx context.Context, id string, callOpts ...CallOption) (*Session, error) {
 	var session Session
-	if err := s.client.doRequest(ctx, http.MethodGet, "/session/"+id, nil, &session); err != nil {
+	if err := s.client.doRequest(ctx, http.MethodGet, "/session/"+id, nil, &session, withRoute("/session/:id", callOpts)...); err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-// Update updates a session
-func (s *SessionClient) Update(ctx context.Context, id string, data map[string]any) error {
+// Validate reports whether a session is active and when it expires, without
+// transferring its data. Missing and expired sessions are not valid and
+// return no error.
+func (s *SessionClient) Validate(ctx context.Context, id string, callOpts ...CallOption) (bool, time.Time, error) {
+	var resp struct {
+		Valid     bool      `json:"valid"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := s.client.doRequest(ctx, http.MethodGet, "/session/"+id+"/validate", nil, &resp, withRoute("/session/:id/validate", callOpts)...); err != nil {
+		return false, time.Time{}, err
+	}
+	return resp.Valid, resp.ExpiresAt, nil
+}
+
+// Update updates a session.
+// It returns ErrNotFound when the session does not exist or has expired.
+func (s *SessionClient) Update(ctx context.Context, id string, data map[string]any, callOpts ...CallOption) error {
 	req := map[string]any{"data": data}
-	return s.client.doRequest(ctx, http.MethodPut, "/session/"+id, req, nil)
+	return s.client.doRequest(ctx, http.MethodPut, "/session/"+id, req, nil, withRoute("/session/:id", callOpts)...)
 }
 
 // Delete deletes a session
-func (s *SessionClient) Delete(ctx context.Context, id string) error {
-	return s.client.doRequest(ctx, http.MethodDelete, "/session/"+id, nil, nil)
+func (s *SessionClient) Delete(ctx context.Context, id string, callOpts ...CallOption) error {
+	return s.client.doRequest(ctx, http.MethodDelete, "/session/"+id, nil, nil, withRoute("/session/:id", callOpts)...)
 }
 
 // RegistryClient handles service registry operations
@@ -189,57 +490,569 @@ type RegistryClient struct {
 
 // RegisterRequest represents a service registration request
 type RegisterRequest struct {
-	ID             string            `json:"id"`
-	Name           string            `json:"name"`
-	Version        string            `json:"version"`
-	Endpoints      []string          `json:"endpoints"`
-	Capabilities   []string          `json:"capabilities"`
-	Metadata       map[string]string `json:"metadata,omitempty"`
-	HealthCheckURL string            `json:"health_check_url,omitempty"`
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	InstanceID   string            `json:"instance_id,omitempty"` // registers one instance of service Name
+	Version      string            `json:"version"`
+	Endpoints    []Endpoint        `json:"endpoints"`
+	Capabilities []string          `json:"capabilities"`
+	DependsOn    []string          `json:"depends_on,omitempty"` // capabilities the service needs from others
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	// HealthCheckURL registers an http health check expecting a 2xx. Set
+	// HealthCheck instead for other probes; when both are set they must agree.
+	HealthCheckURL string       `json:"health_check_url,omitempty"`
+	HealthCheck    *HealthCheck `json:"health_check,omitempty"`
+	// CheckIntervalSeconds asks for checks at another interval than the
+	// server's, within the bounds it is configured with; 0 uses its own
+	CheckIntervalSeconds int `json:"check_interval_seconds,omitempty"`
+}
+
+// Validate applies the server's registration rules so callers fail fast.
+// It returns validation.Errors listing every invalid field.
+func (r RegisterRequest) Validate() error {
+	var errs validation.Errors
+
+	if r.ID == "" {
+		errs.Add("id", "is required")
+	} else if !validation.IsID(r.ID) {
+		errs.Add("id", fmt.Sprintf("must be at most %d letters, digits, '.', '-' or '_' and start with a letter or digit", validation.MaxIDLength))
+	}
+
+	if r.Name == "" {
+		errs.Add("name", "is required")
+	}
+	if r.InstanceID != "" && !validation.IsID(r.InstanceID) {
+		errs.Add("instance_id", fmt.Sprintf("must be at most %d letters, digits, '.', '-' or '_' and start with a letter or digit", validation.MaxIDLength))
+	}
+
+	if len(r.Endpoints) == 0 {
+		errs.Add("endpoints", "at least one endpoint is required")
+	}
+	for i, endpoint := range r.Endpoints {
+		if !validation.IsHTTPURL(endpoint.URL) {
+			errs.Add(fmt.Sprintf("endpoints[%d].url", i), "must be an absolute http or https URL")
+		}
+		if endpoint.Weight < 0 {
+			errs.Add(fmt.Sprintf("endpoints[%d].weight", i), "must not be negative")
+		}
+	}
+
+	switch {
+	case r.HealthCheck != nil:
+		validateHealthCheck(&errs, r.HealthCheck, r.Endpoints)
+		if r.HealthCheckURL != "" && (cmp.Or(r.HealthCheck.Type, HealthCheckHTTP) != HealthCheckHTTP || r.HealthCheckURL != r.HealthCheck.URL) {
+			errs.Add("health_check_url", "must be empty or the url of an http health_check")
+		}
+	case r.HealthCheckURL != "" && !validHealthCheckURL(r.HealthCheckURL, r.Endpoints):
+		errs.Add("health_check_url", "must be an absolute http or https URL once "+EndpointPlaceholder+" is replaced by an endpoint")
+	}
+	if r.CheckIntervalSeconds < 0 {
+		errs.Add("check_interval_seconds", "must not be negative")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(r.Metadata)) {
+		value := r.Metadata[key]
+		if key == "" || len(key) > validation.MaxMetadataKeyLength {
+			errs.Add("metadata", fmt.Sprintf("key %q must be 1 to %d characters", key, validation.MaxMetadataKeyLength))
+		}
+		if len(value) > validation.MaxMetadataValueLength {
+			errs.Add("metadata."+key, fmt.Sprintf("must be at most %d characters", validation.MaxMetadataValueLength))
+		}
+	}
+
+	for i, capability := range r.Capabilities {
+		if !validation.IsCapability(capability) {
+			errs.Add(fmt.Sprintf("capabilities[%d]", i), "must be lowercase letters and digits separated by dashes")
+		}
+	}
+	for i, capability := range r.DependsOn {
+		if !validation.IsCapability(capability) {
+			errs.Add(fmt.Sprintf("depends_on[%d]", i), "must be lowercase letters and digits separated by dashes")
+		}
+	}
+
+	return errs.Err()
 }
 
 // Service represents a registered service
 type Service struct {
 	ID             string            `json:"id"`
+	TenantID       string            `json:"tenant_id,omitempty"`
 	Name           string            `json:"name"`
+	InstanceID     string            `json:"instance_id,omitempty"`
 	Version        string            `json:"version"`
-	Endpoints      []string          `json:"endpoints"`
+	Endpoints      []Endpoint        `json:"endpoints"`
 	Capabilities   []string          `json:"capabilities"`
+	DependsOn      []string          `json:"depends_on,omitempty"`
 	Metadata       map[string]string `json:"metadata,omitempty"`
 	Status         string            `json:"status"`
+	OverrideStatus bool              `json:"override_status,omitempty"`
 	RegisteredAt   time.Time         `json:"registered_at"`
 	LastHeartbeat  time.Time         `json:"last_heartbeat"`
 	HealthCheckURL string            `json:"health_check_url,omitempty"`
+	// HealthCheck is nil from servers that predate typed health checks
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	// CheckIntervalSeconds is 0 for services checked at the server's interval
+	CheckIntervalSeconds int `json:"check_interval_seconds,omitempty"`
+	// HeartbeatAgeSeconds and EffectiveStatus are computed by the server when
+	// it answers, so they don't depend on the client's clock.
+	// HeartbeatAgeSeconds is nil for services that never sent a heartbeat.
+	HeartbeatAgeSeconds *float64 `json:"heartbeat_age_seconds,omitempty"`
+	EffectiveStatus     string   `json:"effective_status,omitempty"`
+	// ServiceName is the logical service the registration is an instance
+	// of: Name for registrations with an InstanceID and ID for the others.
+	// It is empty from servers that predate instances.
+	ServiceName string `json:"service_name,omitempty"`
+	// DeletedAt is set on deregistered services, which only appear in
+	// listings made with ListOptions.IncludeDeleted
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
 }
 
-// Register registers a service with the root server
-func (r *RegistryClient) Register(ctx context.Context, req RegisterRequest) (*Service, error) {
+// Register registers a service with the root server. Invalid requests fail
+// with validation.Errors before anything is sent; it returns ErrConflict when
+// the ID is registered under a different name. Each call carries an
+// idempotency key, so it fails over between URLs like other safe requests.
+func (r *RegistryClient) Register(ctx context.Context, req RegisterRequest, callOpts ...CallOption) (*Service, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
 	var service Service
-	if err := r.client.doRequest(ctx, http.MethodPost, "/registry/register", req, &service); err != nil {
+	if err := r.client.doRequest(ctx, http.MethodPost, "/registry/register", req, &service, withIdempotencyKey(callOpts)...); err != nil {
 		return nil, err
 	}
 	return &service, nil
 }
 
-// Deregister removes a service from the registry
-func (r *RegistryClient) Deregister(ctx context.Context, id string) error {
-	return r.client.doRequest(ctx, http.MethodDelete, "/registry/deregister/"+id, nil, nil)
+// Deregister removes a service from the registry. The server keeps it for
+// its retention period, during which Restore brings it back.
+func (r *RegistryClient) Deregister(ctx context.Context, id string, callOpts ...CallOption) error {
+	return r.client.doRequest(ctx, http.MethodDelete, "/registry/deregister/"+id, nil, nil, withRoute("/registry/deregister/:id", callOpts)...)
+}
+
+// ListOptions selects a page of a list endpoint. Zero values use the server
+// defaults: the first 50 items in the default order.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	SortBy string
+	// Descending reverses the order; only ListServices supports it
+	Descending bool
+	// IncludeDeleted also lists deregistered services the server has not
+	// purged yet; only ListServices supports it
+	IncludeDeleted bool
+	// Filter narrows the listing; only ListServices supports it
+	Filter ServiceFilter
+}
+
+// ServiceFilter selects the services matching every field set
+type ServiceFilter struct {
+	// Statuses selects services with any of the stored statuses, such as
+	// "unhealthy" and "unknown"
+	Statuses []string
+	// RegisteredSince selects services registered at or after it
+	RegisteredSince time.Time
+	// RegisteredWithin selects services registered within the duration
+	// before the server answers, such as the last 10 minutes. It takes
+	// precedence over RegisteredSince, and pages listed with it are not
+	// cached since the window moves with the server's clock.
+	RegisteredWithin time.Duration
+	NamePrefix       string
+}
+
+// addTo adds the filter to values as URL query parameters
+func (f ServiceFilter) addTo(values url.Values) {
+	for _, status := range f.Statuses {
+		values.Add("status", status)
+	}
+	switch {
+	case f.RegisteredWithin > 0:
+		values.Set("registered_since", f.RegisteredWithin.String())
+	case !f.RegisteredSince.IsZero():
+		values.Set("registered_since", f.RegisteredSince.Format(time.RFC3339Nano))
+	}
+	if f.NamePrefix != "" {
+		values.Set("name_prefix", f.NamePrefix)
+	}
+}
+
+// query encodes the options as URL query parameters
+func (o ListOptions) query() string {
+	return encodeQuery(o.values())
+}
+
+// values returns the options as URL query parameters
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		values.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.SortBy != "" {
+		values.Set("sort_by", o.SortBy)
+	}
+	if o.Descending {
+		values.Set("order", "desc")
+	}
+	if o.IncludeDeleted {
+		values.Set("include_deleted", "true")
+	}
+	o.Filter.addTo(values)
+	return values
+}
+
+// encodeQuery returns values as a query string including the "?", or
+// nothing when there are none
+func encodeQuery(values url.Values) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// ServicePage is one page of registered services
+type ServicePage struct {
+	Items []*Service `json:"items"`
+	Total int        `json:"total"`
+	// NextOffset is the offset of the following page, nil on the last page
+	NextOffset *int `json:"next_offset"`
+}
+
+// ListServices returns one page of registered services, including draining ones.
+// Servers that predate pagination answer with every service in a single page.
+// The client remembers each page with its ETag and asks the server to only
+// send it again when the registry changed, so polling an unchanged registry
+// transfers no bodies. Pages served from that copy carry the heartbeat ages
+// the server computed when it last sent them.
+func (r *RegistryClient) ListServices(ctx context.Context, opts ListOptions, callOpts ...CallOption) (*ServicePage, error) {
+	raw, err := r.client.getConditional(ctx, "/registry/services"+opts.query(), callOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var services []*Service
+		if err := json.Unmarshal(trimmed, &services); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		return &ServicePage{Items: services, Total: len(services)}, nil
+	}
+
+	var page ServicePage
+	if err := json.Unmarshal(raw, &page); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &page, nil
+}
+
+// ServiceGroup is a logical service with its registered instances
+type ServiceGroup struct {
+	Name string `json:"name"`
+	// Status is healthy when at least one instance is, draining when all
+	// are, unhealthy when any is and unknown otherwise
+	Status    string     `json:"status"`
+	Instances []*Service `json:"instances"`
+}
+
+// ServiceGroupPage is one page of logical services
+type ServiceGroupPage struct {
+	Items []*ServiceGroup `json:"items"`
+	Total int             `json:"total"`
+	// NextOffset is the offset of the following page, nil on the last page
+	NextOffset *int `json:"next_offset"`
+}
+
+// ListServiceGroups returns one page of logical services ordered by name,
+// each with its instances and their aggregate status. Registrations made
+// without an InstanceID are single-instance services named by their ID.
+// opts.SortBy may only be "name", and opts.IncludeDeleted is not supported.
+// Pages are cached with their ETag like ListServices pages.
+func (r *RegistryClient) ListServiceGroups(ctx context.Context, opts ListOptions, callOpts ...CallOption) (*ServiceGroupPage, error) {
+	values := opts.values()
+	values.Set("grouped", "true")
+	raw, err := r.client.getConditional(ctx, "/registry/services"+encodeQuery(values), callOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var page ServiceGroupPage
+	if err := json.Unmarshal(raw, &page); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &page, nil
 }
 
 // Discover finds services by capability
-func (r *RegistryClient) Discover(ctx context.Context, capability string) ([]*Service, error) {
-	var services []*Service
-	path := "/registry/discover"
+func (r *RegistryClient) Discover(ctx context.Context, capability string, callOpts ...CallOption) ([]*Service, error) {
+	return r.discover(ctx, capability, "", callOpts)
+}
+
+// DiscoverHealthy is Discover leaving out services none of whose endpoints
+// passed their last health check
+func (r *RegistryClient) DiscoverHealthy(ctx context.Context, capability string, callOpts ...CallOption) ([]*Service, error) {
+	return r.discover(ctx, capability, "healthy_endpoints", callOpts)
+}
+
+// DiscoverInstances is Discover leaving out instances whose effective status
+// is not healthy. Each names its logical service in ServiceName.
+func (r *RegistryClient) DiscoverInstances(ctx context.Context, capability string, callOpts ...CallOption) ([]*Service, error) {
+	return r.discover(ctx, capability, "healthy", callOpts)
+}
+
+// Strategies DiscoverOne asks the server to pick an instance with
+const (
+	StrategyRandom                = "random"
+	StrategyRoundRobin            = "round_robin"
+	StrategyLeastRecentlyReturned = "least_recently_returned"
+)
+
+// DiscoverOne returns a single healthy instance providing capability, picked
+// by the server with strategy, one of the Strategy constants; empty uses
+// StrategyRandom. Round robin and least recently returned are tracked by
+// each server on its own, so behind a load balancer the spread across
+// instances is best effort. It returns ErrNotFound when no instance is healthy.
+func (r *RegistryClient) DiscoverOne(ctx context.Context, capability, strategy string, callOpts ...CallOption) (*Service, error) {
+	query := url.Values{}
 	if capability != "" {
-		path += "?capability=" + capability
+		query.Set("capability", capability)
 	}
-	if err := r.client.doRequest(ctx, http.MethodGet, path, nil, &services); err != nil {
+	query.Set("healthy", "true")
+	query.Set("select", "one")
+	if strategy != "" {
+		query.Set("strategy", strategy)
+	}
+
+	var service Service
+	if err := r.client.doRequest(ctx, http.MethodGet, "/registry/discover?"+query.Encode(), nil, &service, callOpts...); err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+// discover calls the discovery endpoint with filter, the name of a boolean
+// query parameter to set, unless empty
+func (r *RegistryClient) discover(ctx context.Context, capability string, filter string, callOpts []CallOption) ([]*Service, error) {
+	query := url.Values{}
+	if capability != "" {
+		query.Set("capability", capability)
+	}
+	if filter != "" {
+		query.Set(filter, "true")
+	}
+	path := "/registry/discover" + encodeQuery(query)
+
+	var services []*Service
+	if err := r.client.doRequest(ctx, http.MethodGet, path, nil, &services, callOpts...); err != nil {
 		return nil, err
 	}
 	return services, nil
 }
 
-// Heartbeat sends a heartbeat for a service
-func (r *RegistryClient) Heartbeat(ctx context.Context, id string) error {
-	return r.client.doRequest(ctx, http.MethodPut, "/registry/heartbeat/"+id, nil, nil)
+// discoverWait is how long each DiscoverWait request asks the server to wait
+// for a change, unless the client timeout is shorter
+const discoverWait = 30 * time.Second
+
+// RevisionHeader carries the registry revision a listing was read at
+const RevisionHeader = "X-Registry-Revision"
+
+// DiscoverWait long polls for a change: it blocks until the registry revision
+// exceeds revision, then returns the services providing capability with the
+// new revision to pass to the next call. Pass -1 to read them at once. The
+// revision covers the whole registry, so the services returned may be the
+// ones already known. Waits the server ends unchanged are repeated until ctx
+// is done; each one is kept within the client timeout.
+func (r *RegistryClient) DiscoverWait(ctx context.Context, capability string, revision int64, callOpts ...CallOption) ([]*Service, int64, error) {
+	wait := discoverWait
+	if timeout := r.client.httpClient.Timeout; timeout > 0 {
+		wait = min(wait, timeout*3/4)
+	}
+	query := url.Values{}
+	if capability != "" {
+		query.Set("capability", capability)
+	}
+	query.Set("wait", wait.String())
+	query.Set("revision", strconv.FormatInt(revision, 10))
+	path := "/registry/discover?" + query.Encode()
+
+	for {
+		resp, body, err := r.client.send(ctx, http.MethodGet, path, nil, callOpts...)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			continue
+		}
+
+		current, err := strconv.ParseInt(resp.Header.Get(RevisionHeader), 10, 64)
+		if err != nil {
+			return nil, 0, errors.New("response has no registry revision; the server may predate long polling")
+		}
+		var services []*Service
+		if err := json.Unmarshal(body, &services); err != nil {
+			return nil, 0, fmt.Errorf("decode response: %w", err)
+		}
+		return services, current, nil
+	}
+}
+
+// Heartbeat sends a heartbeat for a service.
+// It returns ErrNotFound when the service is not registered and ErrGone when
+// it was deregistered; the heartbeat does not bring it back.
+func (r *RegistryClient) Heartbeat(ctx context.Context, id string, callOpts ...CallOption) error {
+	return r.client.doRequest(ctx, http.MethodPut, "/registry/heartbeat/"+id, nil, nil, withRoute("/registry/heartbeat/:id", callOpts)...)
+}
+
+// Service statuses an operator can set with SetStatus
+const (
+	StatusHealthy  = "healthy"
+	StatusDraining = "draining"
+)
+
+// SetStatus forces a service's status. StatusDraining removes the instance from
+// discovery without deregistering it; StatusHealthy hands it back to health checks.
+// It returns ErrForbidden without the admin role and ErrNotFound for unknown services.
+func (r *RegistryClient) SetStatus(ctx context.Context, id, status string, callOpts ...CallOption) (*Service, error) {
+	body := map[string]string{"status": status}
+
+	var service Service
+	if err := r.client.doRequest(ctx, http.MethodPut, "/registry/services/"+id+"/status", body, &service, withRoute("/registry/services/:id/status", callOpts)...); err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+// Restore brings back a deregistered service before the server purges it.
+// It returns ErrForbidden without the admin role, ErrNotFound for unknown or
+// purged services and ErrConflict when the service is registered.
+func (r *RegistryClient) Restore(ctx context.Context, id string, callOpts ...CallOption) (*Service, error) {
+	var service Service
+	if err := r.client.doRequest(ctx, http.MethodPost, "/registry/services/"+id+"/restore", nil, &service, withRoute("/registry/services/:id/restore", callOpts)...); err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+// GraphNode is a registered service in the dependency graph
+type GraphNode struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Status       string   `json:"status"`
+	Capabilities []string `json:"capabilities"`
+	DependsOn    []string `json:"depends_on"`
+}
+
+// GraphEdge links a service to one provider of a capability it depends on
+type GraphEdge struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Capability string `json:"capability"`
+}
+
+// MissingDependency is a declared dependency no registered service provides
+type MissingDependency struct {
+	ServiceID  string `json:"service_id"`
+	Capability string `json:"capability"`
+}
+
+// DependencyGraph links every registered service to the providers of the
+// capabilities it depends on
+type DependencyGraph struct {
+	Nodes   []GraphNode         `json:"nodes"`
+	Edges   []GraphEdge         `json:"edges"`
+	Missing []MissingDependency `json:"missing"`
+}
+
+// ImpactedService is a service that would lose every provider of the
+// capability it depends on; Depth is 1 for direct dependents
+type ImpactedService struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Capability string `json:"capability"`
+	Depth      int    `json:"depth"`
+}
+
+// Impact lists the services that would break if a service disappeared,
+// ordered by depth then ID
+type Impact struct {
+	ServiceID string            `json:"service_id"`
+	Affected  []ImpactedService `json:"affected"`
+}
+
+// Graph returns the dependency graph of the registered services, built from
+// the capabilities each declared in RegisterRequest.DependsOn
+func (r *RegistryClient) Graph(ctx context.Context, callOpts ...CallOption) (*DependencyGraph, error) {
+	var graph DependencyGraph
+	if err := r.client.doRequest(ctx, http.MethodGet, "/registry/graph", nil, &graph, callOpts...); err != nil {
+		return nil, err
+	}
+	return &graph, nil
+}
+
+// Impact returns the services that would break, directly or transitively, if
+// the given service disappeared. Dependents of a capability another service
+// still provides are not affected. It returns ErrNotFound for unknown services.
+func (r *RegistryClient) Impact(ctx context.Context, id string, callOpts ...CallOption) (*Impact, error) {
+	var impact Impact
+	if err := r.client.doRequest(ctx, http.MethodGet, "/registry/impact/"+id, nil, &impact, withRoute("/registry/impact/:id", callOpts)...); err != nil {
+		return nil, err
+	}
+	return &impact, nil
+}
+
+// RegistryExport is a snapshot of every registered service, as written by Export
+type RegistryExport struct {
+	SchemaVersion int        `json:"schema_version"`
+	ExportedAt    time.Time  `json:"exported_at"`
+	Services      []*Service `json:"services"`
+}
+
+// ImportMode decides what Import does with services whose ID is already registered
+type ImportMode string
+
+const (
+	// ImportMerge keeps registered services and skips the imported ones
+	ImportMerge ImportMode = "merge"
+	// ImportReplace overwrites registered services with the imported ones
+	ImportReplace ImportMode = "replace"
+)
+
+// ImportResult is the outcome for one service: created, replaced, skipped,
+// invalid or failed, with the reason for the last two
+type ImportResult struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport lists the outcome for every imported service in document order
+type ImportReport struct {
+	Mode ImportMode `json:"mode"`
+	// Atomic reports that the server imported the document in one transaction
+	Atomic  bool           `json:"atomic"`
+	Results []ImportResult `json:"results"`
+}
+
+// Export returns every registered service for backup or migration.
+// It returns ErrForbidden without the admin role.
+func (r *RegistryClient) Export(ctx context.Context, callOpts ...CallOption) (*RegistryExport, error) {
+	var doc RegistryExport
+	if err := r.client.doRequest(ctx, http.MethodGet, "/admin/registry/export", nil, &doc, callOpts...); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Import registers the services of an export. Imported services start with
+// status unknown until health checks or heartbeats report on them. It returns
+// ErrForbidden without the admin role, and an APIError with status 400 when
+// the document as a whole is rejected, e.g. for an unsupported schema version.
+func (r *RegistryClient) Import(ctx context.Context, doc *RegistryExport, mode ImportMode, callOpts ...CallOption) (*ImportReport, error) {
+	var report ImportReport
+	path := "/admin/registry/import?mode=" + url.QueryEscape(string(mode))
+	if err := r.client.doRequest(ctx, http.MethodPost, path, doc, &report, callOpts...); err != nil {
+		return nil, err
+	}
+	return &report, nil
 }
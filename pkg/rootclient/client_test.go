@@ -0,0 +1,841 @@
+package rootclient
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+func TestRegistryClient_RegisterValidatesBeforeSending(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"payment-1"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	ctx := context.Background()
+
+	_, err := client.Registry().Register(ctx, RegisterRequest{
+		ID:             "payment 1",
+		Name:           "payment-service",
+		InstanceID:     "eu/1",
+		Endpoints:      []Endpoint{{URL: "http://payment-1:8080"}},
+		DependsOn:      []string{"Ledger"},
+		HealthCheckURL: "not a url",
+	})
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation.Errors, got %v", err)
+	}
+	if len(errs) != 4 {
+		t.Errorf("expected 4 invalid fields, got %v", errs)
+	}
+	if calls != 0 {
+		t.Errorf("expected no request for an invalid registration, got %d", calls)
+	}
+
+	_, err = client.Registry().Register(ctx, RegisterRequest{
+		ID:           "payment-1",
+		Name:         "payment-service",
+		Endpoints:    []Endpoint{{URL: "http://payment-1:8080"}},
+		Capabilities: []string{"payment"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected one request, got %d", calls)
+	}
+}
+
+func TestRegisterRequest_ValidateHealthCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		check      *HealthCheck
+		legacyURL  string
+		wantFields []string
+	}{
+		{name: "tcp", check: &HealthCheck{Type: HealthCheckTCP, URL: "payment-1:9090", TimeoutSeconds: 2}},
+		{name: "http with expectations", check: &HealthCheck{URL: "{endpoint}/ready", ExpectedStatusCodes: []int{200}, ExpectedBodySubstring: "ok"}},
+		{name: "matching legacy url", check: &HealthCheck{URL: "http://payment-1:8080/health"}, legacyURL: "http://payment-1:8080/health"},
+		{name: "contradicting legacy url", check: &HealthCheck{Type: HealthCheckTCP, URL: "payment-1:9090"}, legacyURL: "http://payment-1:8080/health", wantFields: []string{"health_check_url"}},
+		{name: "tcp with http expectations", check: &HealthCheck{Type: HealthCheckTCP, URL: "payment-1", ExpectedStatusCodes: []int{200}}, wantFields: []string{"health_check.url", "health_check.expected_status_codes"}},
+		{name: "unknown type", check: &HealthCheck{Type: "grpc", URL: "payment-1:9090", TimeoutSeconds: -1}, wantFields: []string{"health_check.type", "health_check.timeout_seconds"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := RegisterRequest{
+				ID:             "payment-1",
+				Name:           "payment-service",
+				Endpoints:      []Endpoint{{URL: "http://payment-1:8080"}},
+				HealthCheckURL: tt.legacyURL,
+				HealthCheck:    tt.check,
+			}
+
+			var errs validation.Errors
+			errors.As(req.Validate(), &errs)
+			fields := make([]string, len(errs))
+			for i, fe := range errs {
+				fields[i] = fe.Field
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("expected invalid fields %v, got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestAuthClient_ValidateToken(t *testing.T) {
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = strings.TrimSpace(string(body))
+
+		var req struct{ Audience string }
+		json.Unmarshal(body, &req)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Audience != "" && req.Audience != "billing-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"token not issued for this audience","code":"UNAUTHORIZED"}`))
+			return
+		}
+		w.Write([]byte(`{"sub":"gateway","aud":"billing-1"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	tests := []struct {
+		name     string
+		opts     ValidateOptions
+		wantBody string
+		wantErr  error
+	}{
+		{name: "any audience", wantBody: `{"token":"jwt"}`},
+		{name: "own audience", opts: ValidateOptions{Audience: "billing-1"}, wantBody: `{"token":"jwt","audience":"billing-1"}`},
+		{name: "other audience", opts: ValidateOptions{Audience: "search-1"}, wantBody: `{"token":"jwt","audience":"search-1"}`, wantErr: ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.Auth().ValidateToken(context.Background(), "jwt", tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if gotBody != tt.wantBody {
+				t.Errorf("expected body %s, got %s", tt.wantBody, gotBody)
+			}
+		})
+	}
+}
+
+func TestSessionClient_CreateValidatesBeforeSending(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"sess_1"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		req        CreateSessionRequest
+		wantFields int
+	}{
+		{name: "missing ids", req: CreateSessionRequest{TTL: 60}, wantFields: 2},
+		{name: "invalid service id", req: CreateSessionRequest{UserID: "user-1", ServiceID: "web app"}, wantFields: 1},
+		{name: "long user id", req: CreateSessionRequest{UserID: strings.Repeat("u", validation.MaxIDLength+1), ServiceID: "web"}, wantFields: 1},
+		{name: "negative ttl", req: CreateSessionRequest{UserID: "user-1", ServiceID: "web", TTL: -5}, wantFields: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Session().Create(ctx, tt.req)
+			var errs validation.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation.Errors, got %v", err)
+			}
+			if len(errs) != tt.wantFields {
+				t.Errorf("expected %d invalid fields, got %v", tt.wantFields, errs)
+			}
+		})
+	}
+	if calls != 0 {
+		t.Errorf("expected no request for invalid sessions, got %d", calls)
+	}
+
+	if _, err := client.Session().Create(ctx, CreateSessionRequest{UserID: "user-1", ServiceID: "web"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected one request, got %d", calls)
+	}
+}
+
+func TestClient_RequestID(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		got = append(got, id)
+
+		w.Header().Set(RequestIDHeader, id)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"session not found","code":"NOT_FOUND","request_id":"` + id + `"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+
+	t.Run("generated when absent", func(t *testing.T) {
+		_, err := client.Session().Get(context.Background(), "missing")
+
+		var apiErr APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected APIError, got %v", err)
+		}
+		sent := got[len(got)-1]
+		if len(sent) != 32 {
+			t.Fatalf("expected generated 32-char request ID, got %q", sent)
+		}
+		if apiErr.RequestID() != sent {
+			t.Errorf("expected error to carry request ID %q, got %q", sent, apiErr.RequestID())
+		}
+	})
+
+	t.Run("taken from context and quoted in errors", func(t *testing.T) {
+		ctx := WithRequestID(context.Background(), "req-abc")
+		_, err := client.Session().Get(ctx, "missing")
+
+		if sent := got[len(got)-1]; sent != "req-abc" {
+			t.Errorf("expected request ID req-abc, got %q", sent)
+		}
+
+		var apiErr APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected APIError, got %v", err)
+		}
+		if apiErr.StatusCode() != http.StatusNotFound || apiErr.Code() != "NOT_FOUND" {
+			t.Errorf("unexpected error %v", apiErr)
+		}
+		if !strings.Contains(err.Error(), "req-abc") {
+			t.Errorf("expected error message to quote request ID, got %q", err.Error())
+		}
+	})
+}
+
+func TestClient_RequestIDOnTransportError(t *testing.T) {
+	client := New(Config{BaseURL: "http://127.0.0.1:1", APIKey: "rk_test"})
+
+	err := client.Session().Delete(WithRequestID(context.Background(), "req-down"), "abc")
+	if err == nil || !strings.Contains(err.Error(), "req-down") {
+		t.Errorf("expected transport error to quote request ID, got %v", err)
+	}
+}
+
+func TestRegistryClient_SetStatus(t *testing.T) {
+	var gotMethod, gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotBody = r.Method, r.URL.Path, string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"payment-1","status":"draining","override_status":true}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	svc, err := client.Registry().SetStatus(context.Background(), "payment-1", StatusDraining)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if gotMethod != http.MethodPut || gotPath != "/v1/registry/services/payment-1/status" {
+		t.Errorf("unexpected request %s %s", gotMethod, gotPath)
+	}
+	if strings.TrimSpace(gotBody) != `{"status":"draining"}` {
+		t.Errorf("unexpected body %s", gotBody)
+	}
+	if svc.Status != StatusDraining || !svc.OverrideStatus {
+		t.Errorf("unexpected service %+v", svc)
+	}
+}
+
+func TestRegistryClient_Restore(t *testing.T) {
+	var gotMethod, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"payment-1","status":"healthy"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	svc, err := client.Registry().Restore(context.Background(), "payment-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotMethod != http.MethodPost || gotPath != "/v1/registry/services/payment-1/restore" {
+		t.Errorf("unexpected request %s %s", gotMethod, gotPath)
+	}
+	if svc.ID != "payment-1" || !svc.DeletedAt.IsZero() {
+		t.Errorf("unexpected service %+v", svc)
+	}
+
+	if _, err := client.Registry().Restore(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRegistryClient_Dependencies(t *testing.T) {
+	var gotPaths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPaths = append(gotPaths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/registry/graph":
+			w.Write([]byte(`{"nodes":[{"id":"checkout-1","depends_on":["payments"]},{"id":"payment-1","capabilities":["payments"]}],` +
+				`"edges":[{"from":"checkout-1","to":"payment-1","capability":"payments"}],"missing":[]}`))
+		case "/v1/registry/impact/payment-1":
+			w.Write([]byte(`{"service_id":"payment-1","affected":[{"id":"checkout-1","name":"checkout","capability":"payments","depth":1}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	ctx := context.Background()
+
+	graph, err := client.Registry().Graph(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(graph.Nodes) != 2 || graph.Edges[0] != (GraphEdge{From: "checkout-1", To: "payment-1", Capability: "payments"}) {
+		t.Errorf("unexpected graph %+v", graph)
+	}
+
+	impact, err := client.Registry().Impact(ctx, "payment-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := (ImpactedService{ID: "checkout-1", Name: "checkout", Capability: "payments", Depth: 1}); len(impact.Affected) != 1 || impact.Affected[0] != want {
+		t.Errorf("unexpected impact %+v", impact)
+	}
+
+	if _, err := client.Registry().Impact(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if want := []string{"/v1/registry/graph", "/v1/registry/impact/payment-1", "/v1/registry/impact/missing"}; !slices.Equal(gotPaths, want) {
+		t.Errorf("expected requests to %v, got %v", want, gotPaths)
+	}
+}
+
+func TestClient_APIVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		wantPath string
+	}{
+		{name: "default", wantPath: "/v1/registry/heartbeat/payment-1"},
+		{name: "explicit", version: "v2", wantPath: "/v2/registry/heartbeat/payment-1"},
+		{name: "unversioned", version: UnversionedAPI, wantPath: "/registry/heartbeat/payment-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+			}))
+			defer srv.Close()
+
+			client := New(Config{BaseURL: srv.URL, APIKey: "rk_test", APIVersion: tt.version})
+			if err := client.Registry().Heartbeat(context.Background(), "payment-1"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("expected path %s, got %s", tt.wantPath, gotPath)
+			}
+		})
+	}
+}
+
+func TestRegistryClient_ListServices(t *testing.T) {
+	t.Run("decodes the envelope", func(t *testing.T) {
+		var gotQuery string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotQuery = r.URL.RawQuery
+			w.Write([]byte(`{"items":[{"id":"svc-2"},{"id":"svc-3"}],"total":5,"next_offset":4}`))
+		}))
+		defer srv.Close()
+
+		client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+		page, err := client.Registry().ListServices(context.Background(), ListOptions{Limit: 2, Offset: 2, SortBy: "name"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if gotQuery != "limit=2&offset=2&sort_by=name" {
+			t.Errorf("unexpected query %q", gotQuery)
+		}
+		if len(page.Items) != 2 || page.Items[0].ID != "svc-2" || page.Total != 5 || page.NextOffset == nil || *page.NextOffset != 4 {
+			t.Errorf("unexpected page %+v", page)
+		}
+	})
+
+	t.Run("encodes the filter", func(t *testing.T) {
+		var gotQuery url.Values
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotQuery = r.URL.Query()
+			w.Write([]byte(`{"items":[],"total":0,"next_offset":null}`))
+		}))
+		defer srv.Close()
+
+		client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+		since := time.Date(2026, 10, 1, 12, 0, 0, 500, time.FixedZone("CEST", 2*60*60))
+		tests := []struct {
+			name string
+			opts ListOptions
+			want url.Values
+		}{
+			{
+				name: "statuses and prefix",
+				opts: ListOptions{SortBy: "last_heartbeat", Descending: true, Filter: ServiceFilter{Statuses: []string{"unhealthy", "unknown"}, NamePrefix: "pay ment"}},
+				want: url.Values{"sort_by": {"last_heartbeat"}, "order": {"desc"}, "status": {"unhealthy", "unknown"}, "name_prefix": {"pay ment"}},
+			},
+			{
+				name: "registered since",
+				opts: ListOptions{Filter: ServiceFilter{RegisteredSince: since}},
+				want: url.Values{"registered_since": {"2026-10-01T12:00:00.0000005+02:00"}},
+			},
+			{
+				name: "registered within",
+				opts: ListOptions{Filter: ServiceFilter{RegisteredSince: since, RegisteredWithin: 10 * time.Minute}},
+				want: url.Values{"registered_since": {"10m0s"}},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := client.Registry().ListServices(context.Background(), tt.opts); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if !reflect.DeepEqual(gotQuery, tt.want) {
+					t.Errorf("expected query %v, got %v", tt.want, gotQuery)
+				}
+			})
+		}
+	})
+
+	t.Run("accepts a plain array from older servers", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(` [{"id":"svc-1"},{"id":"svc-2"}]`))
+		}))
+		defer srv.Close()
+
+		client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+		page, err := client.Registry().ListServices(context.Background(), ListOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Items) != 2 || page.Total != 2 || page.NextOffset != nil {
+			t.Errorf("unexpected page %+v", page)
+		}
+	})
+}
+
+func TestRegistryClient_ServiceInstances(t *testing.T) {
+	var gotPath, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		if r.URL.Path == "/v1/registry/discover" {
+			w.Write([]byte(`[{"id":"payment-a","name":"payment","instance_id":"a","service_name":"payment"}]`))
+			return
+		}
+		w.Write([]byte(`{"items":[{"name":"payment","status":"healthy","instances":[
+			{"id":"payment-a","name":"payment","instance_id":"a","effective_status":"healthy"},
+			{"id":"payment-b","name":"payment","instance_id":"b","effective_status":"unhealthy"}]}],"total":3,"next_offset":2}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	ctx := context.Background()
+
+	t.Run("list groups", func(t *testing.T) {
+		page, err := client.Registry().ListServiceGroups(ctx, ListOptions{Limit: 1, Offset: 1})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if gotPath != "/v1/registry/services" || gotQuery != "grouped=true&limit=1&offset=1" {
+			t.Errorf("unexpected request %s?%s", gotPath, gotQuery)
+		}
+		if len(page.Items) != 1 || page.Total != 3 || page.NextOffset == nil || *page.NextOffset != 2 {
+			t.Fatalf("unexpected page %+v", page)
+		}
+		if g := page.Items[0]; g.Name != "payment" || g.Status != StatusHealthy || len(g.Instances) != 2 || g.Instances[1].InstanceID != "b" {
+			t.Errorf("unexpected group %+v", g)
+		}
+	})
+
+	t.Run("discover healthy instances", func(t *testing.T) {
+		instances, err := client.Registry().DiscoverInstances(ctx, "payments")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if gotQuery != "capability=payments&healthy=true" {
+			t.Errorf("unexpected query %q", gotQuery)
+		}
+		if len(instances) != 1 || instances[0].InstanceID != "a" || instances[0].ServiceName != "payment" {
+			t.Errorf("unexpected instances %+v", instances)
+		}
+	})
+}
+
+func TestRegistryClient_ListServicesConditional(t *testing.T) {
+	var mu sync.Mutex
+	revision := "rev-1"
+	var gotIfNoneMatch []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotIfNoneMatch = append(gotIfNoneMatch, r.Header.Get("If-None-Match"))
+		etag := `"` + revision + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"items":[{"id":"` + revision + `"}],"total":1}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	list := func(opts ListOptions, callOpts ...CallOption) string {
+		t.Helper()
+		page, err := client.Registry().ListServices(context.Background(), opts, callOpts...)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Items) != 1 {
+			t.Fatalf("unexpected page %+v", page)
+		}
+		return page.Items[0].ID
+	}
+
+	steps := []struct {
+		name         string
+		revision     string
+		opts         ListOptions
+		callOpts     []CallOption
+		wantSent     string
+		wantServedID string
+	}{
+		{name: "first call", revision: "rev-1", wantSent: "", wantServedID: "rev-1"},
+		{name: "unchanged", revision: "rev-1", wantSent: `"rev-1"`, wantServedID: "rev-1"},
+		{name: "other page", revision: "rev-1", opts: ListOptions{Limit: 10}, wantSent: "", wantServedID: "rev-1"},
+		{name: "other tenant", revision: "rev-1", callOpts: []CallOption{WithHeader("X-Tenant-ID", "acme")}, wantSent: "", wantServedID: "rev-1"},
+		{name: "changed", revision: "rev-2", wantSent: `"rev-1"`, wantServedID: "rev-2"},
+		{name: "unchanged again", revision: "rev-2", wantSent: `"rev-2"`, wantServedID: "rev-2"},
+	}
+	for _, step := range steps {
+		mu.Lock()
+		revision = step.revision
+		mu.Unlock()
+
+		if got := list(step.opts, step.callOpts...); got != step.wantServedID {
+			t.Errorf("%s: expected items of %s, got %s", step.name, step.wantServedID, got)
+		}
+		mu.Lock()
+		if sent := gotIfNoneMatch[len(gotIfNoneMatch)-1]; sent != step.wantSent {
+			t.Errorf("%s: expected If-None-Match %q, got %q", step.name, step.wantSent, sent)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestRegistryClient_DiscoverWait(t *testing.T) {
+	var mu sync.Mutex
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		polls := len(queries)
+		mu.Unlock()
+
+		// The first poll times out unchanged, the second sees a change
+		if polls == 1 {
+			w.Header().Set(RevisionHeader, "5")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(RevisionHeader, "6")
+		w.Write([]byte(`[{"id":"payment-1","capabilities":["payments"]}]`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test", Timeout: 8 * time.Second})
+	services, revision, err := client.Registry().DiscoverWait(context.Background(), "payments", 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if revision != 6 || len(services) != 1 || services[0].ID != "payment-1" {
+		t.Errorf("expected payment-1 at revision 6, got %d and %+v", revision, services)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(queries) != 2 {
+		t.Fatalf("expected the unchanged poll to be repeated, got %d requests", len(queries))
+	}
+	for _, query := range queries {
+		if query.Get("capability") != "payments" || query.Get("revision") != "5" || query.Get("wait") != "6s" {
+			t.Errorf("expected a wait within the client timeout for revision 5, got %v", query)
+		}
+	}
+}
+
+func TestRegistryClient_DiscoverWaitCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := New(Config{BaseURL: srv.URL, APIKey: "rk_test"}).Registry().DiscoverWait(ctx, "payments", 5)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestRegistryClient_DiscoverOne(t *testing.T) {
+	var gotQuery url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		if gotQuery.Get("capability") == "search" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"NOT_FOUND","message":"no matching instance"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"payment-b","capabilities":["payments"]}`))
+	}))
+	defer srv.Close()
+	registry := New(Config{BaseURL: srv.URL, APIKey: "rk_test"}).Registry()
+
+	svc, err := registry.DiscoverOne(context.Background(), "payments", StrategyRoundRobin)
+	if err != nil || svc.ID != "payment-b" {
+		t.Fatalf("expected payment-b, got %+v, %v", svc, err)
+	}
+	want := url.Values{"capability": {"payments"}, "healthy": {"true"}, "select": {"one"}, "strategy": {"round_robin"}}
+	if !reflect.DeepEqual(gotQuery, want) {
+		t.Errorf("expected query %v, got %v", want, gotQuery)
+	}
+
+	if _, err := registry.DiscoverOne(context.Background(), "search", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound without a healthy instance, got %v", err)
+	}
+	if gotQuery.Has("strategy") {
+		t.Errorf("expected the server's default strategy, got %v", gotQuery)
+	}
+}
+
+func TestRegistryClient_ExportImport(t *testing.T) {
+	var gotMethod, gotURI, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotURI, gotBody = r.Method, r.URL.RequestURI(), string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"schema_version":1,"exported_at":"2025-12-15T09:00:00Z","services":[{"id":"payment-1","name":"payment"}]}`))
+			return
+		}
+		w.Write([]byte(`{"mode":"merge","results":[{"id":"payment-1","result":"skipped"}]}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	ctx := context.Background()
+
+	doc, err := client.Registry().Export(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotURI != "/v1/admin/registry/export" || doc.SchemaVersion != 1 || len(doc.Services) != 1 {
+		t.Errorf("unexpected export %s: %+v", gotURI, doc)
+	}
+
+	report, err := client.Registry().Import(ctx, doc, ImportMerge)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotMethod != http.MethodPost || gotURI != "/v1/admin/registry/import?mode=merge" {
+		t.Errorf("unexpected request %s %s", gotMethod, gotURI)
+	}
+	if !strings.Contains(gotBody, `"schema_version":1`) || !strings.Contains(gotBody, `"id":"payment-1"`) {
+		t.Errorf("expected the export document as body, got %s", gotBody)
+	}
+	if len(report.Results) != 1 || report.Results[0].Result != "skipped" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestClient_Compression(t *testing.T) {
+	gzipped := func(w http.ResponseWriter, status int, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(status)
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, body)
+		zw.Close()
+	}
+
+	var gotEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Accept-Encoding")
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			gzipped(w, http.StatusNotFound, `{"error":"service not found","code":"NOT_FOUND"}`)
+			return
+		}
+		gzipped(w, http.StatusOK, `{"items":[{"id":"svc-1"},{"id":"svc-2"}],"total":2}`)
+	}))
+	defer srv.Close()
+
+	clients := []struct {
+		name   string
+		client *Client
+	}{
+		{name: "default transport", client: New(Config{BaseURL: srv.URL, APIKey: "rk_test"})},
+		{name: "transport without compression", client: New(Config{BaseURL: srv.URL, APIKey: "rk_test"},
+			WithHTTPClient(&http.Client{Transport: &http.Transport{DisableCompression: true}}))},
+	}
+	for _, tt := range clients {
+		t.Run(tt.name, func(t *testing.T) {
+			var hookBody []byte
+			var hookEncoding string
+			WithResponseHook(func(resp *http.Response, err error) {
+				hookBody, _ = io.ReadAll(resp.Body)
+				hookEncoding = resp.Header.Get("Content-Encoding")
+			})(tt.client)
+
+			page, err := tt.client.Registry().ListServices(context.Background(), ListOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if gotEncoding != "gzip" {
+				t.Errorf("expected Accept-Encoding gzip, got %q", gotEncoding)
+			}
+			if len(page.Items) != 2 || page.Items[1].ID != "svc-2" {
+				t.Errorf("unexpected page %+v", page)
+			}
+			if !strings.HasPrefix(string(hookBody), `{"items"`) || hookEncoding != "" {
+				t.Errorf("expected hooks to see the decompressed body, got %q with encoding %q", hookBody, hookEncoding)
+			}
+
+			err = tt.client.Registry().Heartbeat(context.Background(), "missing")
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected a decompressed error body, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionClient_Validate(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var gotMethod, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "/active/") {
+			w.Write([]byte(`{"valid":true,"expires_at":"2026-10-16T12:00:00Z"}`))
+			return
+		}
+		w.Write([]byte(`{"valid":false}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	valid, got, err := client.Session().Validate(context.Background(), "active")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotMethod != http.MethodGet || gotPath != "/v1/session/active/validate" {
+		t.Errorf("unexpected request %s %s", gotMethod, gotPath)
+	}
+	if !valid || !got.Equal(expiresAt) {
+		t.Errorf("expected a valid session expiring at %v, got %v, %v", expiresAt, valid, got)
+	}
+
+	valid, got, err = client.Session().Validate(context.Background(), "expired")
+	if err != nil || valid || !got.IsZero() {
+		t.Errorf("expected an invalid session without error, got %v, %v, %v", valid, got, err)
+	}
+}
+
+func TestSessionClient_GetOrCreate(t *testing.T) {
+	var (
+		gotPath string
+		gotBody map[string]any
+		status  = http.StatusCreated
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id":"sess_1","user_id":"user-1","service_id":"web"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	ctx := context.Background()
+	req := GetOrCreateSessionRequest{
+		CreateSessionRequest: CreateSessionRequest{UserID: "user-1", ServiceID: "web", Data: map[string]any{"cart": "c-1"}},
+		MergeData:            true,
+	}
+
+	sess, created, err := client.Session().GetOrCreate(ctx, req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotPath != "/v1/session/get-or-create" || gotBody["user_id"] != "user-1" || gotBody["merge_data"] != true {
+		t.Errorf("unexpected request to %s with %v", gotPath, gotBody)
+	}
+	if sess.ID != "sess_1" || !created {
+		t.Errorf("expected a created sess_1, got %s (created %v)", sess.ID, created)
+	}
+
+	status = http.StatusOK
+	if sess, created, err = client.Session().GetOrCreate(ctx, req); err != nil || created || sess.ID != "sess_1" {
+		t.Errorf("expected the existing sess_1, got %v (created %v), %v", sess, created, err)
+	}
+
+	var errs validation.Errors
+	if _, _, err := client.Session().GetOrCreate(ctx, GetOrCreateSessionRequest{}); !errors.As(err, &errs) {
+		t.Errorf("expected validation.Errors, got %v", err)
+	}
+}
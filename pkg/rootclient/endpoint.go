@@ -0,0 +1,97 @@
+package rootclient
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// EndpointPlaceholder in RegisterRequest.HealthCheckURL, or the URL of an http
+// HealthCheck, is replaced by each endpoint's URL, so the server checks every
+// endpoint on its own, e.g. "{endpoint}/health"
+const EndpointPlaceholder = "{endpoint}"
+
+// Endpoint is an address a service is reachable at
+type Endpoint struct {
+	URL string `json:"url"`
+	// Weight is the endpoint's relative share of traffic; the server stores 0 as 1
+	Weight int `json:"weight,omitempty"`
+	// Healthy and LastCheckedAt are the server's view of the endpoint, kept up
+	// to date by per-endpoint health checks; they are ignored on registration
+	Healthy       bool      `json:"healthy"`
+	LastCheckedAt time.Time `json:"last_checked_at,omitzero"`
+}
+
+// UnmarshalJSON accepts the object form as well as a plain URL string, which
+// servers that predate weighted endpoints return. A string becomes a healthy
+// endpoint of weight 1, and an object without "healthy" is healthy.
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*e = Endpoint{URL: url, Weight: 1, Healthy: true}
+		return nil
+	}
+
+	var aux struct {
+		URL           string    `json:"url"`
+		Weight        int       `json:"weight"`
+		Healthy       *bool     `json:"healthy"`
+		LastCheckedAt time.Time `json:"last_checked_at"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*e = Endpoint{URL: aux.URL, Weight: aux.Weight, Healthy: aux.Healthy == nil || *aux.Healthy, LastCheckedAt: aux.LastCheckedAt}
+	return nil
+}
+
+// PickEndpoint chooses one of the service's healthy endpoints at random, each
+// in proportion to its weight; a weight below 1 counts as 1. It returns false
+// when no endpoint is healthy.
+func (s *Service) PickEndpoint() (Endpoint, bool) {
+	return pickEndpoint(s.Endpoints, rand.IntN)
+}
+
+// pickEndpoint is PickEndpoint with the random source as a parameter;
+// intN returns a number in [0, n)
+func pickEndpoint(endpoints []Endpoint, intN func(n int) int) (Endpoint, bool) {
+	total := 0
+	for _, e := range endpoints {
+		if e.Healthy {
+			total += max(e.Weight, 1)
+		}
+	}
+	if total == 0 {
+		return Endpoint{}, false
+	}
+
+	n := intN(total)
+	for _, e := range endpoints {
+		if !e.Healthy {
+			continue
+		}
+		n -= max(e.Weight, 1)
+		if n < 0 {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// validHealthCheckURL reports whether the health check URL, or every URL it
+// expands to when templated with EndpointPlaceholder, is absolute http(s)
+func validHealthCheckURL(url string, endpoints []Endpoint) bool {
+	if !strings.Contains(url, EndpointPlaceholder) {
+		return validation.IsHTTPURL(url)
+	}
+	for _, endpoint := range endpoints {
+		expanded := strings.ReplaceAll(url, EndpointPlaceholder, strings.TrimSuffix(endpoint.URL, "/"))
+		if !validation.IsHTTPURL(expanded) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package rootclient
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestEndpoint_JSON(t *testing.T) {
+	t.Run("plain strings from older servers", func(t *testing.T) {
+		var svc Service
+		if err := json.Unmarshal([]byte(`{"id":"payment-1","endpoints":["http://10.0.0.1:8080"]}`), &svc); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if want := []Endpoint{{URL: "http://10.0.0.1:8080", Weight: 1, Healthy: true}}; !slices.Equal(svc.Endpoints, want) {
+			t.Errorf("expected %+v, got %+v", want, svc.Endpoints)
+		}
+	})
+
+	t.Run("objects", func(t *testing.T) {
+		var svc Service
+		data := `{"id":"payment-1","endpoints":[{"url":"http://10.0.0.1:8080","weight":3,"healthy":false},{"url":"http://10.0.0.2:8080"}]}`
+		if err := json.Unmarshal([]byte(data), &svc); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		want := []Endpoint{{URL: "http://10.0.0.1:8080", Weight: 3}, {URL: "http://10.0.0.2:8080", Healthy: true}}
+		if !slices.Equal(svc.Endpoints, want) {
+			t.Errorf("expected %+v, got %+v", want, svc.Endpoints)
+		}
+	})
+
+	t.Run("registration", func(t *testing.T) {
+		data, err := json.Marshal(RegisterRequest{Endpoints: []Endpoint{{URL: "http://10.0.0.1:8080"}, {URL: "http://10.0.0.2:8080", Weight: 2}}})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		var decoded struct {
+			Endpoints []map[string]any `json:"endpoints"`
+		}
+		json.Unmarshal(data, &decoded)
+		if len(decoded.Endpoints) != 2 || decoded.Endpoints[0]["url"] != "http://10.0.0.1:8080" || decoded.Endpoints[1]["weight"] != 2.0 {
+			t.Errorf("expected endpoints sent as objects, got %s", data)
+		}
+		if _, ok := decoded.Endpoints[0]["weight"]; ok {
+			t.Errorf("expected an unset weight to be left for the server to default, got %s", data)
+		}
+	})
+}
+
+func TestPickEndpoint(t *testing.T) {
+	endpoints := []Endpoint{
+		{URL: "http://a", Weight: 1, Healthy: true},
+		{URL: "http://b", Weight: 3, Healthy: true},
+		{URL: "http://down", Weight: 5, Healthy: false},
+		{URL: "http://c", Healthy: true}, // unset weight counts as 1
+	}
+
+	t.Run("distribution follows weights", func(t *testing.T) {
+		// Walk every value the random source can return: each endpoint must be
+		// picked exactly as often as its weight
+		counts := make(map[string]int)
+		for n := range 5 {
+			picked, ok := pickEndpoint(endpoints, func(total int) int {
+				if total != 5 {
+					t.Fatalf("expected total weight 5, got %d", total)
+				}
+				return n
+			})
+			if !ok {
+				t.Fatal("expected an endpoint")
+			}
+			counts[picked.URL]++
+		}
+		want := map[string]int{"http://a": 1, "http://b": 3, "http://c": 1}
+		for url, n := range want {
+			if counts[url] != n {
+				t.Errorf("expected %s picked %d times, got %d", url, n, counts[url])
+			}
+		}
+		if counts["http://down"] != 0 {
+			t.Error("expected unhealthy endpoint never to be picked")
+		}
+	})
+
+	t.Run("random picks approximate weights", func(t *testing.T) {
+		svc := &Service{Endpoints: endpoints}
+		const picks = 10000
+		counts := make(map[string]int)
+		for range picks {
+			picked, _ := svc.PickEndpoint()
+			counts[picked.URL]++
+		}
+		// b carries 3/5 of the weight; allow a generous margin
+		if share := float64(counts["http://b"]) / picks; share < 0.55 || share > 0.65 {
+			t.Errorf("expected http://b to get about 60%% of picks, got %.1f%%", share*100)
+		}
+	})
+
+	t.Run("no healthy endpoint", func(t *testing.T) {
+		svc := &Service{Endpoints: []Endpoint{{URL: "http://down", Weight: 1}}}
+		if _, ok := svc.PickEndpoint(); ok {
+			t.Error("expected no endpoint")
+		}
+		if _, ok := (&Service{}).PickEndpoint(); ok {
+			t.Error("expected no endpoint for a service without endpoints")
+		}
+	})
+}
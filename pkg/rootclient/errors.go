@@ -0,0 +1,140 @@
+package rootclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrUnauthorized matches 401 responses: the API key or token was missing or rejected
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden matches 403 responses: the caller lacks a required role
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound matches 404 responses
+	ErrNotFound = errors.New("not found")
+	// ErrConflict matches 409 responses
+	ErrConflict = errors.New("conflict")
+	// ErrGone matches 410 responses: the service was deregistered
+	ErrGone = errors.New("gone")
+)
+
+// APIError is implemented by every error built from a root server error response.
+// Use errors.As to reach it and errors.Is with the Err* values to test the status.
+type APIError interface {
+	error
+	StatusCode() int
+	// RequestID is the correlation ID of the failed request, taken from the
+	// X-Request-ID response header when the server sent one
+	RequestID() string
+	// Code is the error code from the response envelope, if any
+	Code() string
+}
+
+// responseError is the APIError for responses without a retry hint
+type responseError struct {
+	status    int
+	code      string
+	message   string
+	requestID string
+	kind      error // sentinel matched by errors.Is, nil for unclassified statuses
+}
+
+func (e *responseError) StatusCode() int   { return e.status }
+func (e *responseError) RequestID() string { return e.requestID }
+func (e *responseError) Code() string      { return e.code }
+func (e *responseError) Unwrap() error     { return e.kind }
+
+func (e *responseError) Error() string {
+	msg := fmt.Sprintf("request failed with status %d", e.status)
+	if e.code != "" {
+		msg += " " + e.code
+	}
+	if e.message != "" {
+		msg += ": " + e.message
+	}
+	if e.requestID != "" {
+		msg += " (request_id " + e.requestID + ")"
+	}
+	return msg
+}
+
+// RetryableError is returned for 429 and 503 responses. The request may be
+// retried after RetryAfter.
+type RetryableError struct {
+	*responseError
+	// RetryAfter is the server's Retry-After hint, zero when absent or unparseable
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	if e.RetryAfter > 0 {
+		return e.responseError.Error() + fmt.Sprintf("; retry after %s", e.RetryAfter)
+	}
+	return e.responseError.Error()
+}
+
+// newAPIError builds an APIError from an error response. The body is parsed as
+// the standard envelope, falling back to the raw body when it isn't one.
+func newAPIError(resp *http.Response, body []byte, requestID string) APIError {
+	e := &responseError{status: resp.StatusCode, requestID: requestID}
+
+	var envelope struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != "" {
+		e.code = envelope.Code
+		e.message = envelope.Error
+		if envelope.RequestID != "" {
+			e.requestID = envelope.RequestID
+		}
+	} else {
+		e.message = string(body)
+	}
+	if id := resp.Header.Get(RequestIDHeader); id != "" {
+		e.requestID = id
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		e.kind = ErrUnauthorized
+	case http.StatusForbidden:
+		e.kind = ErrForbidden
+	case http.StatusNotFound:
+		e.kind = ErrNotFound
+	case http.StatusConflict:
+		e.kind = ErrConflict
+	case http.StatusGone:
+		e.kind = ErrGone
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return &RetryableError{
+			responseError: e,
+			RetryAfter:    parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	return e
+}
+
+// parseRetryAfter reads a Retry-After value given either as delay seconds or
+// as an HTTP date. Dates in the past yield zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
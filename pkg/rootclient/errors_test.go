@@ -0,0 +1,185 @@
+package rootclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_ErrorResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		header     map[string]string
+		wantIs     error
+		wantRetry  bool
+		wantCode   string
+		wantReqID  string
+		wantInText string
+	}{
+		{
+			name:     "unauthorized",
+			status:   http.StatusUnauthorized,
+			body:     `{"error":"invalid credentials","code":"UNAUTHORIZED"}`,
+			wantIs:   ErrUnauthorized,
+			wantCode: "UNAUTHORIZED",
+		},
+		{
+			name:     "forbidden",
+			status:   http.StatusForbidden,
+			body:     `{"error":"insufficient role","code":"FORBIDDEN"}`,
+			wantIs:   ErrForbidden,
+			wantCode: "FORBIDDEN",
+		},
+		{
+			name:      "not found with request id header",
+			status:    http.StatusNotFound,
+			body:      `{"error":"session not found","code":"NOT_FOUND","request_id":"from-body"}`,
+			header:    map[string]string{RequestIDHeader: "from-header"},
+			wantIs:    ErrNotFound,
+			wantCode:  "NOT_FOUND",
+			wantReqID: "from-header",
+		},
+		{
+			name:     "conflict",
+			status:   http.StatusConflict,
+			body:     `{"error":"service id already registered","code":"CONFLICT"}`,
+			wantIs:   ErrConflict,
+			wantCode: "CONFLICT",
+		},
+		{
+			name:     "gone",
+			status:   http.StatusGone,
+			body:     `{"error":"service was deregistered; register it again","code":"GONE"}`,
+			wantIs:   ErrGone,
+			wantCode: "GONE",
+		},
+		{
+			name:       "not found without body",
+			status:     http.StatusNotFound,
+			wantIs:     ErrNotFound,
+			wantInText: "status 404",
+		},
+		{
+			name:       "plain text body",
+			status:     http.StatusInternalServerError,
+			body:       "upstream exploded",
+			wantInText: "upstream exploded",
+		},
+		{
+			name:      "rate limited",
+			status:    http.StatusTooManyRequests,
+			body:      `{"error":"slow down","code":"RATE_LIMITED"}`,
+			header:    map[string]string{"Retry-After": "30"},
+			wantRetry: true,
+			wantCode:  "RATE_LIMITED",
+		},
+		{
+			name:      "unavailable without body",
+			status:    http.StatusServiceUnavailable,
+			header:    map[string]string{"Retry-After": "5"},
+			wantRetry: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+			ctx := WithRequestID(context.Background(), "sent-id")
+			_, err := client.Session().Get(ctx, "abc")
+
+			var apiErr APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected APIError, got %v", err)
+			}
+			if apiErr.StatusCode() != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, apiErr.StatusCode())
+			}
+			if apiErr.Code() != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, apiErr.Code())
+			}
+
+			wantReqID := tt.wantReqID
+			if wantReqID == "" {
+				wantReqID = "sent-id"
+			}
+			if apiErr.RequestID() != wantReqID {
+				t.Errorf("expected request ID %q, got %q", wantReqID, apiErr.RequestID())
+			}
+
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("expected errors.Is(%v), got %v", tt.wantIs, err)
+			}
+			for _, sentinel := range []error{ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict, ErrGone} {
+				if sentinel != tt.wantIs && errors.Is(err, sentinel) {
+					t.Errorf("unexpected match for %v", sentinel)
+				}
+			}
+
+			var retryable *RetryableError
+			if errors.As(err, &retryable) != tt.wantRetry {
+				t.Errorf("expected retryable %v, got %v", tt.wantRetry, err)
+			}
+
+			if tt.wantInText != "" && !strings.Contains(err.Error(), tt.wantInText) {
+				t.Errorf("expected %q in %q", tt.wantInText, err.Error())
+			}
+		})
+	}
+}
+
+func TestClient_RetryAfterHTTPDate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", time.Now().Add(2*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	err := client.Registry().Heartbeat(context.Background(), "payment-1")
+
+	var retryable *RetryableError
+	if !errors.As(err, &retryable) {
+		t.Fatalf("expected *RetryableError, got %v", err)
+	}
+	if retryable.RetryAfter < time.Minute || retryable.RetryAfter > 2*time.Minute {
+		t.Errorf("expected roughly 2m retry hint, got %s", retryable.RetryAfter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "0", want: 0},
+		{value: "120", want: 2 * time.Minute},
+		{value: "-5", want: 0},
+		{value: "soon", want: 0},
+		{value: "Thu, 01 Jan 2026 12:00:30 GMT", want: 30 * time.Second},
+		{value: "Thu, 01 Jan 2026 11:59:00 GMT", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package rootclient
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultProbeInterval is how often a client that failed over checks whether
+// its first URL is back, unless Config.FailoverProbeInterval says otherwise
+const defaultProbeInterval = 30 * time.Second
+
+// defaultProbeTimeout bounds a probe when the HTTP client has no timeout
+const defaultProbeTimeout = 10 * time.Second
+
+// IdempotencyKeyHeader marks a POST as safe to send again: passed with
+// WithHeader, it lets the client fail a POST over to another URL. The server
+// answers a repeated key with the first response instead of processing the
+// request again. SessionClient.Create and RegistryClient.Register send a
+// fresh key with every call unless the caller passes one.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// withIdempotencyKey prepends a freshly generated IdempotencyKeyHeader to
+// callOpts, so a key the caller set with WithHeader still wins. The key is
+// generated once per call and reused by every URL the call fails over to.
+func withIdempotencyKey(callOpts []CallOption) []CallOption {
+	return append([]CallOption{WithHeader(IdempotencyKeyHeader, generateRequestID())}, callOpts...)
+}
+
+// hostSet is the root-server URLs a client fails over between. Requests go
+// to the current URL first; the first URL is the primary, probed in the
+// background while another one is current so the client moves back once it
+// recovers.
+type hostSet struct {
+	urls          []string
+	probeInterval time.Duration
+
+	mu        sync.Mutex
+	current   int       // index of the URL requests try first
+	nextProbe time.Time // when the primary may next be probed
+	probing   bool
+}
+
+// order returns the URLs in the order a request tries them: the current one,
+// then the ones after it, wrapping around
+func (h *hostSet) order() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append(h.urls[h.current:len(h.urls):len(h.urls)], h.urls[:h.current]...)
+}
+
+// selected returns the URL requests try first
+func (h *hostSet) selected() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.urls[h.current]
+}
+
+// succeeded makes url, which just answered, the one requests try first
+func (h *hostSet) succeeded(url string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.urls[h.current] == url {
+		return
+	}
+	for i, u := range h.urls {
+		if u == url {
+			h.current = i
+			break
+		}
+	}
+	if h.current != 0 {
+		h.nextProbe = time.Now().Add(h.probeInterval)
+	}
+}
+
+// startProbe reports whether the primary is due to be probed and, if so,
+// claims the probe so only one runs at a time
+func (h *hostSet) startProbe() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.current == 0 || h.probing || time.Now().Before(h.nextProbe) {
+		return false
+	}
+	h.probing = true
+	return true
+}
+
+// endProbe records the result of a probe of the primary, moving back to it
+// when it is healthy
+func (h *hostSet) endProbe(healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probing = false
+	if healthy {
+		h.current = 0
+		return
+	}
+	h.nextProbe = time.Now().Add(h.probeInterval)
+}
+
+// BaseURL returns the root-server URL requests currently go to first: the
+// first configured URL unless the client failed over to another one
+func (c *Client) BaseURL() string {
+	return c.hosts.selected()
+}
+
+// probePrimary checks in the background whether the primary URL is healthy
+// again, once per probe interval while the client is failed over. Probes
+// only run while the client is in use.
+func (c *Client) probePrimary() {
+	if !c.hosts.startProbe() {
+		return
+	}
+
+	go func() {
+		healthy := false
+		defer func() { c.hosts.endProbe(healthy) }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(c.httpClient.Timeout, defaultProbeTimeout))
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.hosts.urls[0]+"/health", nil)
+		if err != nil {
+			return
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		healthy = resp.StatusCode < 300
+	}()
+}
+
+// shouldFailOver reports whether a request that failed with err may be sent
+// to the next URL. Connection errors and 5xx responses fail over, but a
+// request that may have reached the server is only sent again when replaying
+// it is safe: every method but POST and PATCH, or a request carrying an
+// Idempotency-Key. A request whose connection was never made is always safe.
+func shouldFailOver(ctx context.Context, err error, method string, header http.Header) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr APIError
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.StatusCode() < 500 {
+			return false
+		}
+	case neverSent(err):
+		return true
+	}
+	return (method != http.MethodPost && method != http.MethodPatch) || header.Get(IdempotencyKeyHeader) != ""
+}
+
+// neverSent reports whether a transport error happened while connecting, so
+// the server never saw the request
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,244 @@
+package rootclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer answers every request with status and counts them
+func countingServer(t *testing.T, status int, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(countingHandler(status, calls))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func countingHandler(status int, calls *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			calls.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id":"sess-1"}`))
+	})
+}
+
+func TestClient_FailoverAndRecovery(t *testing.T) {
+	var primaryCalls, secondaryCalls atomic.Int32
+	primary := httptest.NewServer(countingHandler(http.StatusOK, &primaryCalls))
+	secondary := countingServer(t, http.StatusOK, &secondaryCalls)
+	primaryURL := primary.URL
+
+	client := New(Config{
+		BaseURLs:              []string{primaryURL, secondary.URL},
+		FailoverProbeInterval: 10 * time.Millisecond,
+		APIKey:                "rk_test",
+	})
+	ctx := context.Background()
+	get := func() {
+		t.Helper()
+		if _, err := client.Session().Get(ctx, "sess-1"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	get()
+	if primaryCalls.Load() != 1 || client.BaseURL() != primaryURL {
+		t.Fatalf("expected the primary to answer first, got %d calls and %s", primaryCalls.Load(), client.BaseURL())
+	}
+
+	addr := primary.Listener.Addr().String()
+	primary.Close()
+	get()
+	if secondaryCalls.Load() != 1 || client.BaseURL() != secondary.URL {
+		t.Fatalf("expected the secondary to answer once the primary is down, got %d calls and %s", secondaryCalls.Load(), client.BaseURL())
+	}
+
+	// Requests stay on the secondary while the primary is down, and the
+	// failed probes of the primary don't move them back
+	for range 3 {
+		time.Sleep(15 * time.Millisecond)
+		get()
+	}
+	if client.BaseURL() != secondary.URL || primaryCalls.Load() != 1 {
+		t.Fatalf("expected requests to stay on the secondary, got %s", client.BaseURL())
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("can't restart the primary on %s: %v", addr, err)
+	}
+	restarted := httptest.NewUnstartedServer(countingHandler(http.StatusOK, &primaryCalls))
+	restarted.Listener.Close()
+	restarted.Listener = listener
+	restarted.Start()
+	defer restarted.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.BaseURL() != primaryURL {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client to move back to the recovered primary")
+		}
+		get()
+		time.Sleep(5 * time.Millisecond)
+	}
+	before := primaryCalls.Load()
+	get()
+	if primaryCalls.Load() != before+1 {
+		t.Error("expected requests to go to the recovered primary")
+	}
+}
+
+func TestClient_FailoverIdempotency(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	tests := []struct {
+		name         string
+		primary      int // status the primary answers, 0 when it is down
+		call         func(c *Client) error
+		wantFailover bool
+	}{
+		{
+			name:         "get on 5xx",
+			primary:      http.StatusBadGateway,
+			call:         func(c *Client) error { _, err := c.Session().Get(context.Background(), "sess-1"); return err },
+			wantFailover: true,
+		},
+		{
+			name:         "put on 503",
+			primary:      http.StatusServiceUnavailable,
+			call:         func(c *Client) error { return c.Session().Update(context.Background(), "sess-1", nil) },
+			wantFailover: true,
+		},
+		{
+			name:    "get on 4xx",
+			primary: http.StatusNotFound,
+			call:    func(c *Client) error { _, err := c.Session().Get(context.Background(), "sess-1"); return err },
+		},
+		{
+			name:    "post on 5xx",
+			primary: http.StatusInternalServerError,
+			call: func(c *Client) error {
+				_, err := c.Auth().IssueToken(context.Background(), IssueTokenRequest{Subject: "user-1"})
+				return err
+			},
+		},
+		{
+			name:    "post with idempotency key on 5xx",
+			primary: http.StatusInternalServerError,
+			call: func(c *Client) error {
+				_, err := c.Auth().IssueToken(context.Background(), IssueTokenRequest{Subject: "user-1"}, WithHeader(IdempotencyKeyHeader, "issue-1"))
+				return err
+			},
+			wantFailover: true,
+		},
+		{
+			name:    "session create on 5xx",
+			primary: http.StatusInternalServerError,
+			call: func(c *Client) error {
+				_, err := c.Session().Create(context.Background(), CreateSessionRequest{UserID: "user-1", ServiceID: "web"})
+				return err
+			},
+			wantFailover: true,
+		},
+		{
+			name: "post to a server that is down",
+			call: func(c *Client) error {
+				_, err := c.Auth().IssueToken(context.Background(), IssueTokenRequest{Subject: "user-1"})
+				return err
+			},
+			wantFailover: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryCalls, secondaryCalls atomic.Int32
+			primaryURL := downURL
+			if tt.primary != 0 {
+				primaryURL = countingServer(t, tt.primary, &primaryCalls).URL
+			}
+			secondary := countingServer(t, http.StatusOK, &secondaryCalls)
+			client := New(Config{BaseURLs: []string{primaryURL, secondary.URL}, APIKey: "rk_test"})
+
+			err := tt.call(client)
+			if tt.wantFailover {
+				if err != nil || secondaryCalls.Load() != 1 {
+					t.Errorf("expected the secondary to answer, got %v after %d calls", err, secondaryCalls.Load())
+				}
+				if client.BaseURL() != secondary.URL {
+					t.Errorf("expected the secondary to become current, got %s", client.BaseURL())
+				}
+				return
+			}
+
+			var apiErr APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode() != tt.primary {
+				t.Errorf("expected the primary's %d, got %v", tt.primary, err)
+			}
+			if secondaryCalls.Load() != 0 || client.BaseURL() != primaryURL {
+				t.Errorf("expected no failover, got %d calls to the secondary", secondaryCalls.Load())
+			}
+		})
+	}
+}
+
+func TestClient_IdempotencyKeys(t *testing.T) {
+	var keys []string
+	record := func(status int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"id":"sess-1"}`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	primary, secondary := record(http.StatusBadGateway), record(http.StatusCreated)
+	client := New(Config{BaseURLs: []string{primary.URL, secondary.URL}, APIKey: "rk_test"})
+	ctx := context.Background()
+
+	if _, err := client.Session().Create(ctx, CreateSessionRequest{UserID: "user-1", ServiceID: "web"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("expected one generated key sent to both URLs, got %q", keys)
+	}
+
+	keys = nil
+	client.Session().Create(ctx, CreateSessionRequest{UserID: "user-1", ServiceID: "web"})
+	client.Registry().Register(ctx, RegisterRequest{ID: "svc-1", Name: "svc", Endpoints: []Endpoint{{URL: "http://svc-1:8080"}}})
+	client.Session().Create(ctx, CreateSessionRequest{UserID: "user-1", ServiceID: "web"}, WithHeader(IdempotencyKeyHeader, "create-1"))
+	if len(keys) != 3 || keys[0] == "" || keys[1] == "" || keys[0] == keys[1] || keys[2] != "create-1" {
+		t.Errorf("expected a fresh key per call unless the caller passes one, got %q", keys)
+	}
+}
+
+func TestClient_FailoverAllDown(t *testing.T) {
+	var calls atomic.Int32
+	first := countingServer(t, http.StatusServiceUnavailable, &calls)
+	second := countingServer(t, http.StatusBadGateway, &calls)
+	client := New(Config{BaseURLs: []string{first.URL, second.URL}, APIKey: "rk_test"})
+
+	_, err := client.Session().Get(context.Background(), "sess-1")
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode() != http.StatusBadGateway {
+		t.Errorf("expected the last URL's error, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected each URL tried once, got %d calls", calls.Load())
+	}
+	if client.BaseURL() != first.URL {
+		t.Errorf("expected the first URL to stay current, got %s", client.BaseURL())
+	}
+}
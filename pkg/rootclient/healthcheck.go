@@ -0,0 +1,64 @@
+package rootclient
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// Health check probe types
+const (
+	HealthCheckHTTP = "http" // GET the URL and check the response
+	HealthCheckTCP  = "tcp"  // open a TCP connection to a host:port
+)
+
+// HealthCheck describes how the server probes a registered service. It
+// replaces RegisterRequest.HealthCheckURL for services that can't answer an
+// http GET with a 2xx, such as gRPC servers or raw TCP listeners.
+type HealthCheck struct {
+	// Type is HealthCheckHTTP or HealthCheckTCP; empty is HealthCheckHTTP
+	Type string `json:"type"`
+	// URL is the http(s) URL to GET, which may be templated with
+	// EndpointPlaceholder, or the host:port to dial
+	URL string `json:"url"`
+	// ExpectedStatusCodes are the accepted http response codes; empty accepts any 2xx
+	ExpectedStatusCodes []int `json:"expected_status_codes,omitempty"`
+	// ExpectedBodySubstring, when set, must appear in the http response body
+	ExpectedBodySubstring string `json:"expected_body_substring,omitempty"`
+	// TimeoutSeconds bounds each probe; the server's own timeout applies when
+	// it is 0 or shorter
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// validateHealthCheck adds the problems the server would report for a
+// health check to errs
+func validateHealthCheck(errs *validation.Errors, check *HealthCheck, endpoints []Endpoint) {
+	switch cmp.Or(check.Type, HealthCheckHTTP) {
+	case HealthCheckHTTP:
+		if !validHealthCheckURL(check.URL, endpoints) {
+			errs.Add("health_check.url", "must be an absolute http or https URL once "+EndpointPlaceholder+" is replaced by an endpoint")
+		}
+		for i, code := range check.ExpectedStatusCodes {
+			if code < 100 || code > 599 {
+				errs.Add(fmt.Sprintf("health_check.expected_status_codes[%d]", i), "must be an HTTP status code from 100 to 599")
+			}
+		}
+	case HealthCheckTCP:
+		if !validation.IsHostPort(check.URL) {
+			errs.Add("health_check.url", "must be a host:port address")
+		}
+		if len(check.ExpectedStatusCodes) > 0 {
+			errs.Add("health_check.expected_status_codes", "only applies to http health checks")
+		}
+		if check.ExpectedBodySubstring != "" {
+			errs.Add("health_check.expected_body_substring", "only applies to http health checks")
+		}
+	default:
+		errs.Add("health_check.type", "must be one of "+strings.Join([]string{HealthCheckHTTP, HealthCheckTCP}, ", "))
+	}
+	if check.TimeoutSeconds < 0 {
+		errs.Add("health_check.timeout_seconds", "must not be negative")
+	}
+}
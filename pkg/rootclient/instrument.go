@@ -0,0 +1,58 @@
+package rootclient
+
+import (
+	"context"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// Instrumentor observes the requests a client sends, e.g. to export their
+// latency and errors as metrics; see the rootprom package for Prometheus.
+//
+// ObserveRequest is called once per HTTP request, so a call failing over to
+// another URL is observed for each URL tried. Route is the template of the
+// path without its query, such as "/session/:id", so metrics keep a bounded
+// set of values. Status is 0 when no response arrived, and err is the error
+// the attempt failed with, an APIError for error responses. Reused reports
+// whether the request went out on a kept-alive connection rather than a new
+// one. Calls are made on the calling goroutine and should return quickly; a
+// panicking instrumentor is recovered and the call proceeds.
+type Instrumentor interface {
+	ObserveRequest(method, route string, status int, reused bool, duration time.Duration, err error)
+}
+
+// withRoute prepends the route template path was built from to callOpts,
+// for paths carrying IDs
+func withRoute(route string, callOpts []CallOption) []CallOption {
+	return append([]CallOption{func(o *callOptions) { o.route = route }}, callOpts...)
+}
+
+// routeOf returns the route template the request to path is observed under:
+// the one set with withRoute, or else path without its query
+func routeOf(path string, options callOptions) string {
+	if options.route != "" {
+		return options.route
+	}
+	route, _, _ := strings.Cut(path, "?")
+	return route
+}
+
+// connTrace returns ctx with a client trace recording into reused whether
+// the request's connection was kept alive from an earlier request
+func connTrace(ctx context.Context, reused *bool) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*reused = info.Reused
+		},
+	})
+}
+
+// observe hands an attempt to the instrumentor, recovering from panics
+func (c *Client) observe(method, route string, status int, reused bool, duration time.Duration, err error) {
+	if c.instrumentor == nil {
+		return
+	}
+	defer func() { recover() }()
+	c.instrumentor.ObserveRequest(method, route, status, reused, duration, err)
+}
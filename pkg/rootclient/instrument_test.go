@@ -0,0 +1,116 @@
+package rootclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// observation is one ObserveRequest call
+type observation struct {
+	method, route string
+	status        int
+	reused        bool
+	err           error
+}
+
+// recordingInstrumentor records the requests it observes
+type recordingInstrumentor struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (r *recordingInstrumentor) ObserveRequest(method, route string, status int, reused bool, duration time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observations = append(r.observations, observation{method: method, route: route, status: status, reused: reused, err: err})
+}
+
+func (r *recordingInstrumentor) all() []observation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]observation(nil), r.observations...)
+}
+
+type panickingInstrumentor struct{}
+
+func (panickingInstrumentor) ObserveRequest(string, string, int, bool, time.Duration, error) {
+	panic("instrumentor")
+}
+
+func TestClient_Instrumentor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/session/sess-1":
+			w.Write([]byte(`{"id":"sess-1"}`))
+		case "/v1/registry/heartbeat/payment-1":
+			w.WriteHeader(http.StatusNoContent)
+		case "/v1/registry/discover":
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found","code":"NOT_FOUND"}`))
+		}
+	}))
+	defer srv.Close()
+
+	rec := &recordingInstrumentor{}
+	client := New(Config{BaseURL: srv.URL, Instrumentor: rec})
+	ctx := context.Background()
+
+	client.Session().Get(ctx, "sess-1")
+	client.Session().Get(ctx, "sess-2")
+	client.Registry().Heartbeat(ctx, "payment-1")
+	client.Registry().Discover(ctx, "payment")
+
+	want := []observation{
+		{method: http.MethodGet, route: "/session/:id", status: http.StatusOK},
+		{method: http.MethodGet, route: "/session/:id", status: http.StatusNotFound, reused: true},
+		{method: http.MethodPut, route: "/registry/heartbeat/:id", status: http.StatusNoContent, reused: true},
+		{method: http.MethodGet, route: "/registry/discover", status: http.StatusOK, reused: true},
+	}
+	got := rec.all()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d observations, got %+v", len(want), got)
+	}
+	for i, o := range got {
+		w := want[i]
+		if o.method != w.method || o.route != w.route || o.status != w.status || o.reused != w.reused {
+			t.Errorf("observation %d: expected %+v, got %+v", i, w, o)
+		}
+		if (o.status >= 400) != (o.err != nil) {
+			t.Errorf("observation %d: expected an error only for the error response, got %v", i, o.err)
+		}
+	}
+	if !errors.Is(got[1].err, ErrNotFound) {
+		t.Errorf("expected the 404 observed as ErrNotFound, got %v", got[1].err)
+	}
+}
+
+func TestClient_InstrumentorTransportError(t *testing.T) {
+	rec := &recordingInstrumentor{}
+	client := New(Config{BaseURL: "http://127.0.0.1:1", Instrumentor: rec})
+
+	err := client.Registry().Heartbeat(context.Background(), "payment-1")
+	got := rec.all()
+	if len(got) != 1 || got[0].status != 0 || got[0].route != "/registry/heartbeat/:id" || got[0].err == nil || !errors.Is(err, got[0].err) {
+		t.Errorf("expected the transport error observed without a status, got %+v", got)
+	}
+}
+
+func TestClient_PanickingInstrumentor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"sess-1"}`))
+	}))
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, Instrumentor: panickingInstrumentor{}})
+	session, err := client.Session().Get(context.Background(), "sess-1")
+	if err != nil || session.ID != "sess-1" {
+		t.Fatalf("expected the request to succeed, got %+v, %v", session, err)
+	}
+}
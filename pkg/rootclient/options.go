@@ -0,0 +1,92 @@
+package rootclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// Option customizes a Client beyond what Config covers
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc. Config.Timeout, TLS and
+// TracerProvider configure the client New would build and are not applied to hc.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRequestHook registers a function called with every request just before
+// it is sent, after all headers are set. Hooks run in the order they were
+// added and may modify headers; they must not read or replace the body.
+// A panicking hook is recovered and the request proceeds.
+func WithRequestHook(hook func(*http.Request)) Option {
+	return func(c *Client) {
+		c.requestHooks = append(c.requestHooks, hook)
+	}
+}
+
+// WithResponseHook registers a function called after every round trip with
+// the response, or with the transport error and a nil response. The response
+// body has already been read; hooks get their own copy of it, so reading it
+// does not affect the call. Hooks run in the order they were added, after the
+// request hooks; a panicking hook is recovered and the call proceeds.
+func WithResponseHook(hook func(*http.Response, error)) Option {
+	return func(c *Client) {
+		c.responseHooks = append(c.responseHooks, hook)
+	}
+}
+
+// CallOption customizes a single call
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	header http.Header
+	route  string // template the path was built from, for the Instrumentor
+}
+
+// WithHeader sets a header on the request of one call, e.g. a tenant ID.
+// It is applied after the client's own headers and may override them.
+func WithHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Set(key, value)
+	}
+}
+
+// runRequestHooks calls each request hook, recovering from panics
+func (c *Client) runRequestHooks(req *http.Request) {
+	for _, hook := range c.requestHooks {
+		func() {
+			defer func() { recover() }()
+			hook(req)
+		}()
+	}
+}
+
+// runResponseHooks calls each response hook with a copy of the response whose
+// body reads from the already buffered body, recovering from panics
+func (c *Client) runResponseHooks(resp *http.Response, body []byte, err error) {
+	for _, hook := range c.responseHooks {
+		func() {
+			defer func() { recover() }()
+			if resp == nil {
+				hook(nil, err)
+				return
+			}
+			copied := *resp
+			copied.Body = io.NopCloser(bytes.NewReader(body))
+			hook(&copied, err)
+		}()
+	}
+}
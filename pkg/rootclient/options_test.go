@@ -0,0 +1,126 @@
+package rootclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestClient_Hooks(t *testing.T) {
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		w.Write([]byte(`{"id":"sess-1","user_id":"user-1"}`))
+	}))
+	defer srv.Close()
+
+	var calls []string
+	var hookBody string
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"},
+		WithUserAgent("billing/1.4"),
+		WithRequestHook(func(r *http.Request) {
+			calls = append(calls, "request 1:"+r.Header.Get("X-Tenant"))
+		}),
+		WithRequestHook(func(r *http.Request) {
+			calls = append(calls, "request 2")
+			r.Header.Set("X-Hooked", "yes")
+		}),
+		WithResponseHook(func(resp *http.Response, err error) {
+			calls = append(calls, "response 1")
+			body, _ := io.ReadAll(resp.Body)
+			hookBody = string(body)
+		}),
+		WithResponseHook(func(resp *http.Response, err error) {
+			calls = append(calls, "response 2")
+		}),
+	)
+
+	session, err := client.Session().Get(context.Background(), "sess-1", WithHeader("X-Tenant", "acme"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("hooks run in order", func(t *testing.T) {
+		want := []string{"request 1:acme", "request 2", "response 1", "response 2"}
+		if !slices.Equal(calls, want) {
+			t.Errorf("expected %v, got %v", want, calls)
+		}
+	})
+
+	t.Run("headers are sent", func(t *testing.T) {
+		if gotHeader.Get("User-Agent") != "billing/1.4" || gotHeader.Get("X-Tenant") != "acme" || gotHeader.Get("X-Hooked") != "yes" {
+			t.Errorf("expected user agent, call and hook headers, got %v", gotHeader)
+		}
+	})
+
+	t.Run("reading the body in a hook does not consume it", func(t *testing.T) {
+		if hookBody == "" || session.ID != "sess-1" {
+			t.Errorf("expected both hook and caller to see the body, got %q and %+v", hookBody, session)
+		}
+	})
+}
+
+func TestClient_PanickingHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"sess-1"}`))
+	}))
+	defer srv.Close()
+
+	var later bool
+	client := New(Config{BaseURL: srv.URL},
+		WithRequestHook(func(*http.Request) { panic("request hook") }),
+		WithResponseHook(func(*http.Response, error) { panic("response hook") }),
+		WithResponseHook(func(*http.Response, error) { later = true }),
+	)
+
+	if _, err := client.Session().Get(context.Background(), "sess-1"); err != nil {
+		t.Fatalf("expected the request to succeed, got %v", err)
+	}
+	if !later {
+		t.Error("expected hooks after a panicking one to run")
+	}
+}
+
+func TestClient_ResponseHookOnTransportError(t *testing.T) {
+	var hookErr error
+	client := New(Config{BaseURL: "http://127.0.0.1:1"},
+		WithResponseHook(func(resp *http.Response, err error) {
+			if resp != nil {
+				t.Error("expected no response on transport error")
+			}
+			hookErr = err
+		}),
+	)
+
+	err := client.Registry().Heartbeat(context.Background(), "payment-1")
+	if err == nil || hookErr == nil || !errors.Is(err, hookErr) {
+		t.Errorf("expected the hook to see the transport error, got %v and %v", hookErr, err)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	var used bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	hc := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		used = true
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	client := New(Config{BaseURL: srv.URL}, WithHTTPClient(hc))
+
+	if err := client.Registry().Heartbeat(context.Background(), "payment-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !used {
+		t.Error("expected the provided http.Client to send the request")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,230 @@
+package rootclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/pkg/validation"
+)
+
+// RegistrarState describes where a Registrar's service stands with the registry
+type RegistrarState string
+
+const (
+	// StateUnregistered is the state before Start succeeds
+	StateUnregistered RegistrarState = "unregistered"
+	// StateRegistered means the last registration or heartbeat succeeded
+	StateRegistered RegistrarState = "registered"
+	// StateDegraded means heartbeats or re-registration are failing; the
+	// registrar keeps retrying
+	StateDegraded RegistrarState = "degraded"
+	// StateDeregistered is the state after Stop
+	StateDeregistered RegistrarState = "deregistered"
+)
+
+// RegistrarOptions configures a Registrar. Zero values use the defaults.
+type RegistrarOptions struct {
+	// HeartbeatInterval is the time between heartbeats, 10s by default
+	HeartbeatInterval time.Duration
+	// RetryInterval is the first delay between registration attempts; it
+	// doubles up to MaxRetryInterval. Defaults to 1s and 30s.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// DeregisterTimeout bounds the deregistration made by Stop, 5s by default
+	DeregisterTimeout time.Duration
+	// OnStateChange is called from the registrar's goroutine on every state
+	// transition. It must not block.
+	OnStateChange func(RegistrarState)
+}
+
+// Registrar keeps a service registered for the lifetime of the process: it
+// registers on Start, heartbeats in the background, registers again when the
+// root server has forgotten the service, and deregisters on Stop.
+type Registrar struct {
+	registry *RegistryClient
+	req      RegisterRequest
+	opts     RegistrarOptions
+
+	mu     sync.Mutex
+	state  RegistrarState
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRegistrar creates a registrar for the service described by req
+func NewRegistrar(client *Client, req RegisterRequest, opts RegistrarOptions) *Registrar {
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = 10 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.MaxRetryInterval <= 0 {
+		opts.MaxRetryInterval = 30 * time.Second
+	}
+	opts.MaxRetryInterval = max(opts.MaxRetryInterval, opts.RetryInterval)
+	if opts.DeregisterTimeout <= 0 {
+		opts.DeregisterTimeout = 5 * time.Second
+	}
+
+	return &Registrar{
+		registry: client.Registry(),
+		req:      req,
+		opts:     opts,
+		state:    StateUnregistered,
+	}
+}
+
+// State returns the current registration state, e.g. for a health endpoint
+func (r *Registrar) State() RegistrarState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// Start registers the service, retrying transient failures until ctx is done,
+// then starts the heartbeat loop, which runs until ctx is cancelled or Stop is
+// called. Validation errors and 4xx responses such as ErrConflict are returned
+// without retrying.
+func (r *Registrar) Start(ctx context.Context) error {
+	r.mu.Lock()
+	if r.done != nil {
+		r.mu.Unlock()
+		return errors.New("registrar already started")
+	}
+	r.done = make(chan struct{})
+	r.mu.Unlock()
+
+	if err := r.register(ctx); err != nil {
+		r.mu.Lock()
+		r.done = nil
+		r.mu.Unlock()
+		return err
+	}
+	r.setState(StateRegistered)
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.cancel = cancel
+	done := r.done
+	r.mu.Unlock()
+
+	go r.heartbeatLoop(loopCtx, done)
+	return nil
+}
+
+// Stop ends the heartbeat loop and deregisters the service, giving up after
+// DeregisterTimeout or when ctx is done, whichever comes first. Calling Stop
+// on a registrar that is not running does nothing; it may be started again.
+func (r *Registrar) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+
+	ctx, stop := context.WithTimeout(ctx, r.opts.DeregisterTimeout)
+	defer stop()
+
+	err := r.registry.Deregister(ctx, r.req.ID)
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	r.setState(StateDeregistered)
+	return err
+}
+
+// heartbeatLoop sends heartbeats until ctx is done, registering again when
+// the root server answers that the service is unknown. A service deregistered
+// by someone else answers with ErrGone and is left deregistered, reported as
+// StateDegraded. It closes done on return.
+func (r *Registrar) heartbeatLoop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(r.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.registry.Heartbeat(ctx, r.req.ID)
+		if errors.Is(err, ErrNotFound) {
+			_, err = r.registry.Register(ctx, r.req)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			r.setState(StateDegraded)
+		} else {
+			r.setState(StateRegistered)
+		}
+	}
+}
+
+// register attempts registration with exponential backoff, honoring the
+// server's Retry-After hint
+func (r *Registrar) register(ctx context.Context) error {
+	delay := r.opts.RetryInterval
+	for {
+		_, err := r.registry.Register(ctx, r.req)
+		if err == nil || !retryable(err) {
+			return err
+		}
+
+		wait := delay
+		var retryErr *RetryableError
+		if errors.As(err, &retryErr) && retryErr.RetryAfter > wait {
+			wait = retryErr.RetryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay = min(delay*2, r.opts.MaxRetryInterval)
+	}
+}
+
+// setState records a state and notifies OnStateChange if it changed
+func (r *Registrar) setState(state RegistrarState) {
+	r.mu.Lock()
+	changed := r.state != state
+	r.state = state
+	r.mu.Unlock()
+
+	if changed && r.opts.OnStateChange != nil {
+		r.opts.OnStateChange(state)
+	}
+}
+
+// retryable reports whether a failed registration may succeed if repeated:
+// transport errors and 429 or 5xx responses are, invalid requests are not
+func retryable(err error) bool {
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		return false
+	}
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		status := apiErr.StatusCode()
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package rootclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry is a root server that keeps registrations in memory and can be
+// restarted, forgetting them, or made to fail
+type fakeRegistry struct {
+	mu          sync.Mutex
+	services    map[string]bool
+	registers   int
+	deregisters int
+	failWith    int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failWith != 0 {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(f.failWith)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/registry/register":
+		f.registers++
+		f.services["payment-1"] = true
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"payment-1"}`))
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/registry/heartbeat/"):
+		if !f.services[strings.TrimPrefix(r.URL.Path, "/v1/registry/heartbeat/")] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/registry/deregister/"):
+		f.deregisters++
+		delete(f.services, strings.TrimPrefix(r.URL.Path, "/v1/registry/deregister/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeRegistry) restart() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services = map[string]bool{}
+}
+
+func (f *fakeRegistry) fail(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failWith = status
+}
+
+func (f *fakeRegistry) counts() (registered bool, registers, deregisters int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.services["payment-1"], f.registers, f.deregisters
+}
+
+func newTestRegistrar(t *testing.T, states chan RegistrarState) (*Registrar, *fakeRegistry) {
+	t.Helper()
+
+	fake := &fakeRegistry{services: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	registrar := NewRegistrar(client, RegisterRequest{
+		ID:           "payment-1",
+		Name:         "payment-service",
+		Endpoints:    []Endpoint{{URL: "http://payment-1:8080"}},
+		Capabilities: []string{"payment"},
+	}, RegistrarOptions{
+		HeartbeatInterval: 10 * time.Millisecond,
+		RetryInterval:     time.Millisecond,
+		MaxRetryInterval:  5 * time.Millisecond,
+		OnStateChange:     func(s RegistrarState) { states <- s },
+	})
+
+	return registrar, fake
+}
+
+func waitForState(t *testing.T, states <-chan RegistrarState, want RegistrarState) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case got := <-states:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %s", want)
+		}
+	}
+}
+
+func TestRegistrar_Lifecycle(t *testing.T) {
+	states := make(chan RegistrarState, 16)
+	registrar, fake := newTestRegistrar(t, states)
+	ctx := context.Background()
+
+	if err := registrar.Start(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitForState(t, states, StateRegistered)
+	if registrar.State() != StateRegistered {
+		t.Errorf("expected state registered, got %s", registrar.State())
+	}
+
+	t.Run("re-registers after a server restart", func(t *testing.T) {
+		fake.restart()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			registered, registers, _ := fake.counts()
+			if registered && registers == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected re-registration, got %d registrations", registers)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("degraded while the server is failing", func(t *testing.T) {
+		fake.fail(http.StatusServiceUnavailable)
+		waitForState(t, states, StateDegraded)
+
+		fake.fail(0)
+		waitForState(t, states, StateRegistered)
+	})
+
+	t.Run("stop deregisters", func(t *testing.T) {
+		if err := registrar.Stop(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForState(t, states, StateDeregistered)
+
+		registered, _, deregisters := fake.counts()
+		if registered || deregisters != 1 {
+			t.Errorf("expected one clean deregistration, got registered=%v deregisters=%d", registered, deregisters)
+		}
+
+		if err := registrar.Stop(ctx); err != nil {
+			t.Errorf("expected second stop to do nothing, got %v", err)
+		}
+		if _, _, deregisters := fake.counts(); deregisters != 1 {
+			t.Errorf("expected no further deregistration, got %d", deregisters)
+		}
+	})
+}
+
+func TestRegistrar_StartRetries(t *testing.T) {
+	states := make(chan RegistrarState, 16)
+	registrar, fake := newTestRegistrar(t, states)
+	fake.fail(http.StatusServiceUnavailable)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fake.fail(0)
+	}()
+
+	if err := registrar.Start(context.Background()); err != nil {
+		t.Fatalf("expected registration to succeed after retries, got %v", err)
+	}
+	defer registrar.Stop(context.Background())
+
+	if registered, _, _ := fake.counts(); !registered {
+		t.Error("expected service to be registered")
+	}
+}
+
+func TestRegistrar_StartFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		ctx    func() (context.Context, context.CancelFunc)
+		want   error
+	}{
+		{
+			name:   "conflict is not retried",
+			status: http.StatusConflict,
+			ctx:    func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			want:   ErrConflict,
+		},
+		{
+			name:   "gives up when the context ends",
+			status: http.StatusServiceUnavailable,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 30*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registrar, fake := newTestRegistrar(t, make(chan RegistrarState, 16))
+			fake.fail(tt.status)
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			err := registrar.Start(ctx)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+			if registrar.State() != StateUnregistered {
+				t.Errorf("expected state unregistered, got %s", registrar.State())
+			}
+		})
+	}
+}
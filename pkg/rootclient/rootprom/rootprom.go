@@ -0,0 +1,66 @@
+// Package rootprom exports the requests of a rootclient.Client as Prometheus
+// metrics. It is kept apart from rootclient so only programs using it depend
+// on the Prometheus client library.
+package rootprom
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aq189/bin/pkg/rootclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statusError labels requests that got no response
+const statusError = "error"
+
+// PrometheusInstrumentor is a rootclient.Instrumentor recording
+//
+//   - rootclient_request_duration_seconds, a histogram of request latency
+//   - rootclient_request_errors_total, a counter of failed requests
+//
+// both labeled by method, route, status ("error" without a response) and
+// reused, whether the connection was kept alive from an earlier request.
+type PrometheusInstrumentor struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewPrometheusInstrumentor creates the metrics and registers them with reg.
+// It fails when reg already has them, e.g. from another client; share one
+// instrumentor between clients instead.
+func NewPrometheusInstrumentor(reg prometheus.Registerer) (*PrometheusInstrumentor, error) {
+	labels := []string{"method", "route", "status", "reused"}
+	p := &PrometheusInstrumentor{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rootclient_request_duration_seconds",
+			Help:    "Latency of requests to the root server.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rootclient_request_errors_total",
+			Help: "Requests to the root server that failed, with an error response or none.",
+		}, labels),
+	}
+	if err := errors.Join(reg.Register(p.duration), reg.Register(p.errors)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ObserveRequest implements rootclient.Instrumentor
+func (p *PrometheusInstrumentor) ObserveRequest(method, route string, status int, reused bool, duration time.Duration, err error) {
+	code := statusError
+	if status > 0 {
+		code = strconv.Itoa(status)
+	}
+	labels := prometheus.Labels{"method": method, "route": route, "status": code, "reused": strconv.FormatBool(reused)}
+
+	p.duration.With(labels).Observe(duration.Seconds())
+	if err != nil {
+		p.errors.With(labels).Inc()
+	}
+}
+
+var _ rootclient.Instrumentor = (*PrometheusInstrumentor)(nil)
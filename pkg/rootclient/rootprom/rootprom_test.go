@@ -0,0 +1,49 @@
+package rootprom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aq189/bin/pkg/rootclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusInstrumentor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/session/sess-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":"sess-1"}`))
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	instrumentor, err := NewPrometheusInstrumentor(reg)
+	if err != nil {
+		t.Fatalf("new instrumentor: %v", err)
+	}
+	client := rootclient.New(rootclient.Config{BaseURL: srv.URL, Instrumentor: instrumentor})
+	client.Session().Get(context.Background(), "sess-1")
+	client.Session().Get(context.Background(), "sess-2")
+
+	if n := testutil.CollectAndCount(reg, "rootclient_request_duration_seconds"); n != 2 {
+		t.Errorf("expected a series per status and reuse, got %d", n)
+	}
+	want := `
+# HELP rootclient_request_errors_total Requests to the root server that failed, with an error response or none.
+# TYPE rootclient_request_errors_total counter
+rootclient_request_errors_total{method="GET",reused="true",route="/session/:id",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "rootclient_request_errors_total"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewPrometheusInstrumentor(reg); err == nil {
+		t.Error("expected registering the metrics twice to fail")
+	}
+}
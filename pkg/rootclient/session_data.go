@@ -0,0 +1,175 @@
+package rootclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// maxExactInt is the largest integer magnitude a JSON number keeps exactly
+// once the server has decoded it into a float64
+const maxExactInt = 1 << 53
+
+// ErrInexactValue is returned when a session data value would not survive
+// the round trip through the server unchanged
+var ErrInexactValue = errors.New("value does not round-trip through session data")
+
+// GetString returns a string Data value
+func (s *Session) GetString(key string) (string, bool) {
+	v, ok := s.Data[key].(string)
+	return v, ok
+}
+
+// GetInt returns an integral Data value. Numbers arrive from the server as
+// float64, so they count only when they have no fractional part and fit in
+// an int.
+func (s *Session) GetInt(key string) (int, bool) {
+	return intValue(s.Data[key])
+}
+
+// GetBool returns a boolean Data value
+func (s *Session) GetBool(key string) (bool, bool) {
+	v, ok := s.Data[key].(bool)
+	return v, ok
+}
+
+// GetTime returns a Data value holding a time formatted with layout, such as
+// one stored by CreateSessionRequest.SetTime with time.RFC3339Nano
+func (s *Session) GetTime(key, layout string) (time.Time, bool) {
+	return timeValue(s.Data[key], layout)
+}
+
+// UnmarshalData decodes Data into v, as if v had been decoded from the
+// session's JSON data object, so a whole struct can be read at once
+func (s *Session) UnmarshalData(v any) error {
+	data, err := json.Marshal(s.Data)
+	if err != nil {
+		return fmt.Errorf("encode session data: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode session data: %w", err)
+	}
+	return nil
+}
+
+// SetString stores a string in Data
+func (r *CreateSessionRequest) SetString(key, value string) {
+	r.set(key, value)
+}
+
+// SetInt stores an integer in Data. Integers beyond ±2^53 would lose
+// precision on the server and fail with ErrInexactValue.
+func (r *CreateSessionRequest) SetInt(key string, value int) error {
+	if int64(value) > maxExactInt || int64(value) < -maxExactInt {
+		return fmt.Errorf("%w: %s is %d, beyond ±2^53", ErrInexactValue, key, value)
+	}
+	r.set(key, value)
+	return nil
+}
+
+// SetBool stores a boolean in Data
+func (r *CreateSessionRequest) SetBool(key string, value bool) {
+	r.set(key, value)
+}
+
+// SetTime stores a time in Data as an RFC 3339 string in UTC with
+// nanoseconds, read back with Session.GetTime and time.RFC3339Nano. The
+// monotonic clock reading and location are dropped.
+func (r *CreateSessionRequest) SetTime(key string, value time.Time) {
+	r.set(key, value.UTC().Format(time.RFC3339Nano))
+}
+
+// SetValue stores value in Data as the server will hold it: encoded to JSON
+// and decoded again, so structs become objects read back with
+// Session.UnmarshalData. Values that can't be encoded, and integers beyond
+// ±2^53 anywhere within them, fail with ErrInexactValue.
+func (r *CreateSessionRequest) SetValue(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInexactValue, key, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInexactValue, key, err)
+	}
+	decoded, ok := toFloats(decoded)
+	if !ok {
+		return fmt.Errorf("%w: %s holds an integer beyond ±2^53", ErrInexactValue, key)
+	}
+	r.set(key, decoded)
+	return nil
+}
+
+// set stores a Data value, creating the map on first use
+func (r *CreateSessionRequest) set(key string, value any) {
+	if r.Data == nil {
+		r.Data = make(map[string]any)
+	}
+	r.Data[key] = value
+}
+
+// intValue converts a decoded JSON number to an int
+func intValue(v any) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt || v >= math.MaxInt {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// timeValue parses a time string with layout
+func timeValue(v any, layout string) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, s)
+	return t, err == nil
+}
+
+// toFloats replaces the json.Number values within a decoded JSON value with
+// the float64 the server decodes them into. It reports false when an integer
+// beyond ±2^53 would not survive that.
+func toFloats(v any) (any, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			// An integer, kept exactly only within ±2^53
+			i, err := v.Int64()
+			if err != nil || i > maxExactInt || i < -maxExactInt {
+				return nil, false
+			}
+		}
+		f, err := v.Float64()
+		return f, err == nil
+	case map[string]any:
+		for key, item := range v {
+			converted, ok := toFloats(item)
+			if !ok {
+				return nil, false
+			}
+			v[key] = converted
+		}
+	case []any:
+		for i, item := range v {
+			converted, ok := toFloats(item)
+			if !ok {
+				return nil, false
+			}
+			v[i] = converted
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,163 @@
+package rootclient
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// throughServer returns the session the server answers for req: the data is
+// decoded into a map as the server stores it, then encoded back to the client
+func throughServer(t *testing.T, req CreateSessionRequest) *Session {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("encode request: %v", err)
+	}
+	var stored struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &stored); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	resp, _ := json.Marshal(stored)
+	var sess Session
+	if err := json.Unmarshal(resp, &sess); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return &sess
+}
+
+func TestSession_TypedData(t *testing.T) {
+	loggedIn := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.FixedZone("", 2*60*60))
+
+	var req CreateSessionRequest
+	req.SetString("theme", "dark")
+	req.SetBool("mfa", true)
+	req.SetTime("logged_in_at", loggedIn)
+	for key, value := range map[string]int{"cart_items": 3, "negative": -42, "largest": 1 << 53} {
+		if err := req.SetInt(key, value); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+	sess := throughServer(t, req)
+
+	if v, ok := sess.GetString("theme"); !ok || v != "dark" {
+		t.Errorf("expected theme dark, got %q, %v", v, ok)
+	}
+	if v, ok := sess.GetBool("mfa"); !ok || !v {
+		t.Errorf("expected mfa true, got %v, %v", v, ok)
+	}
+	for key, want := range map[string]int{"cart_items": 3, "negative": -42, "largest": 1 << 53} {
+		if v, ok := sess.GetInt(key); !ok || v != want {
+			t.Errorf("expected %s %d, got %d, %v", key, want, v, ok)
+		}
+	}
+	if v, ok := sess.GetTime("logged_in_at", time.RFC3339Nano); !ok || !v.Equal(loggedIn) {
+		t.Errorf("expected logged_in_at %v, got %v, %v", loggedIn, v, ok)
+	}
+
+	t.Run("wrong types and missing keys", func(t *testing.T) {
+		if _, ok := sess.GetString("mfa"); ok {
+			t.Error("expected a bool not to read as a string")
+		}
+		if _, ok := sess.GetInt("theme"); ok {
+			t.Error("expected a string not to read as an int")
+		}
+		if _, ok := sess.GetBool("missing"); ok {
+			t.Error("expected a missing key not to read as a bool")
+		}
+		if _, ok := sess.GetTime("theme", time.RFC3339Nano); ok {
+			t.Error("expected a non-time string not to read as a time")
+		}
+		if _, ok := (&Session{}).GetString("theme"); ok {
+			t.Error("expected a session without data to have no values")
+		}
+	})
+
+	t.Run("fractional and huge numbers", func(t *testing.T) {
+		sess := &Session{Data: map[string]any{"ratio": 0.5, "huge": 1e300, "whole": 7.0}}
+		for _, key := range []string{"ratio", "huge"} {
+			if v, ok := sess.GetInt(key); ok {
+				t.Errorf("expected %s not to read as an int, got %d", key, v)
+			}
+		}
+		if v, ok := sess.GetInt("whole"); !ok || v != 7 {
+			t.Errorf("expected whole 7, got %d, %v", v, ok)
+		}
+	})
+}
+
+func TestSession_UnmarshalData(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip"`
+	}
+	type profile struct {
+		Name      string    `json:"name"`
+		Age       int       `json:"age"`
+		Tags      []string  `json:"tags"`
+		Address   address   `json:"address"`
+		Verified  time.Time `json:"verified"`
+		Missing   string    `json:"missing"`
+		Remaining *int      `json:"remaining"`
+	}
+	verified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	var req CreateSessionRequest
+	req.SetString("name", "Ada")
+	req.SetInt("age", 36)
+	req.SetTime("verified", verified)
+	if err := req.SetValue("tags", []string{"admin", "beta"}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+	if err := req.SetValue("address", address{City: "London", Zip: "N1"}); err != nil {
+		t.Fatalf("set address: %v", err)
+	}
+	sess := throughServer(t, req)
+
+	var got profile
+	if err := sess.UnmarshalData(&got); err != nil {
+		t.Fatalf("unmarshal data: %v", err)
+	}
+	want := profile{Name: "Ada", Age: 36, Tags: []string{"admin", "beta"}, Address: address{City: "London", Zip: "N1"}, Verified: verified}
+	if got.Name != want.Name || got.Age != want.Age || len(got.Tags) != 2 || got.Address != want.Address || !got.Verified.Equal(verified) || got.Missing != "" || got.Remaining != nil {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	var wrong struct {
+		Age string `json:"age"`
+	}
+	if err := sess.UnmarshalData(&wrong); err == nil {
+		t.Error("expected a number not to decode into a string")
+	}
+}
+
+func TestCreateSessionRequest_InexactValues(t *testing.T) {
+	var req CreateSessionRequest
+	if err := req.SetInt("id", 1<<53+1); !errors.Is(err, ErrInexactValue) {
+		t.Errorf("expected ErrInexactValue for an int beyond 2^53, got %v", err)
+	}
+	if err := req.SetInt("id", math.MinInt64); !errors.Is(err, ErrInexactValue) {
+		t.Errorf("expected ErrInexactValue for the smallest int, got %v", err)
+	}
+	nested := map[string]any{"ids": []int64{1, 1<<53 + 1}}
+	if err := req.SetValue("nested", nested); !errors.Is(err, ErrInexactValue) {
+		t.Errorf("expected ErrInexactValue for a nested int beyond 2^53, got %v", err)
+	}
+	if err := req.SetValue("channel", make(chan int)); !errors.Is(err, ErrInexactValue) {
+		t.Errorf("expected ErrInexactValue for a value JSON can't encode, got %v", err)
+	}
+	if len(req.Data) != 0 {
+		t.Errorf("expected rejected values not to be stored, got %v", req.Data)
+	}
+
+	if err := req.SetValue("limits", map[string]any{"max": 1 << 53, "ratio": 0.25, "big": 1e300}); err != nil {
+		t.Fatalf("expected exact values to be stored, got %v", err)
+	}
+	if limits, _ := req.Data["limits"].(map[string]any); limits["max"] != float64(1<<53) || limits["ratio"] != 0.25 || limits["big"] != 1e300 {
+		t.Errorf("expected the values as the server holds them, got %v", req.Data["limits"])
+	}
+}
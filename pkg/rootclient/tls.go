@@ -0,0 +1,64 @@
+package rootclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSConfig configures how the client verifies the server and identifies itself
+type TLSConfig struct {
+	// CAFile or CAPEM add a private CA bundle to trust instead of the system roots
+	CAFile string
+	CAPEM  []byte
+	// ClientCertFile and ClientKeyFile hold the certificate presented for mutual TLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// InsecureSkipVerify disables server certificate verification; for local testing only
+	InsecureSkipVerify bool
+}
+
+// isZero reports whether no TLS option is set, in which case the default transport is used
+func (c TLSConfig) isZero() bool {
+	return c.CAFile == "" && len(c.CAPEM) == 0 && c.ClientCertFile == "" && c.ClientKeyFile == "" && !c.InsecureSkipVerify
+}
+
+// transport builds an http.Transport applying the TLS options
+func (c TLSConfig) transport() (*http.Transport, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" || len(c.CAPEM) > 0 {
+		pem := c.CAPEM
+		if c.CAFile != "" {
+			data, err := os.ReadFile(c.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read CA file: %w", err)
+			}
+			pem = data
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return transport, nil
+}
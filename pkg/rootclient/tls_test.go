@@ -0,0 +1,221 @@
+package rootclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/server"
+)
+
+// testPKI holds PEM files for a CA, a server and clients signed by it, and a
+// client signed by an unrelated CA
+type testPKI struct {
+	caPath, serverCert, serverKey string
+	caPEM                         []byte
+	clientCert, clientKey         string
+	untrustedCert, untrustedKey   string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		return key
+	}
+	serial := int64(0)
+	sign := func(tmpl, parent *x509.Certificate, key *ecdsa.PrivateKey, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+		serial++
+		tmpl.SerialNumber = big.NewInt(serial)
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatalf("create certificate: %v", err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return cert
+	}
+	write := func(name string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+		certPath := filepath.Join(dir, name+".crt")
+		os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600)
+		if key == nil {
+			return certPath, ""
+		}
+		der, _ := x509.MarshalECPrivateKey(key)
+		keyPath := filepath.Join(dir, name+".key")
+		os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+		return certPath, keyPath
+	}
+	newCA := func(name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key := newKey()
+		return sign(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: name},
+			IsCA:                  true,
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+		}, nil, key, nil), key
+	}
+	newLeaf := func(cn string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key := newKey()
+		return sign(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: cn},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{usage},
+		}, ca, key, caKey), key
+	}
+
+	ca, caKey := newCA("test-ca")
+	rogue, rogueKey := newCA("rogue-ca")
+
+	var pki testPKI
+	pki.caPath, _ = write("ca", ca, nil)
+	pki.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	cert, key := newLeaf("root-server", ca, caKey, x509.ExtKeyUsageServerAuth)
+	pki.serverCert, pki.serverKey = write("server", cert, key)
+	cert, key = newLeaf("payment-service", ca, caKey, x509.ExtKeyUsageClientAuth)
+	pki.clientCert, pki.clientKey = write("client", cert, key)
+	cert, key = newLeaf("intruder", rogue, rogueKey, x509.ExtKeyUsageClientAuth)
+	pki.untrustedCert, pki.untrustedKey = write("untrusted", cert, key)
+
+	return pki
+}
+
+// startMTLSServer runs a server requiring client certificates signed by the
+// test CA, answering /whoami with the verified client common name
+func startMTLSServer(t *testing.T, pki testPKI) string {
+	t.Helper()
+
+	srv, err := server.New(server.Config{
+		Addr: "127.0.0.1:0",
+		TLS: server.TLSConfig{
+			Enabled:      true,
+			CertFile:     pki.serverCert,
+			KeyFile:      pki.serverKey,
+			ClientCAFile: pki.caPath,
+			ClientAuth:   server.ClientAuthRequire,
+		},
+		Middlewares: []server.Middleware{middleware.ClientCertificate()},
+	})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.GET("/v1/whoami", func(w http.ResponseWriter, r *http.Request) {
+		cn, _ := middleware.ClientCNFromContext(r.Context())
+		json.NewEncoder(w).Encode(map[string]string{"cn": cn})
+	})
+
+	errChan := make(chan error, 1)
+	go func() { errChan <- srv.Start() }()
+	select {
+	case <-srv.Ready():
+		if err := srv.ListenErr(); err != nil {
+			t.Fatalf("server failed to start: %v", err)
+		}
+	case err := <-errChan:
+		t.Fatalf("server failed to start: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	return "https://" + srv.Addr()
+}
+
+func TestClient_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	baseURL := startMTLSServer(t, pki)
+
+	whoami := func(cfg TLSConfig) (string, error) {
+		client := New(Config{BaseURL: baseURL, APIKey: "rk_test", TLS: cfg})
+		var resp map[string]string
+		err := client.doRequest(context.Background(), http.MethodGet, "/whoami", nil, &resp)
+		return resp["cn"], err
+	}
+
+	t.Run("trusted client certificate", func(t *testing.T) {
+		for name, cfg := range map[string]TLSConfig{
+			"ca file": {CAFile: pki.caPath, ClientCertFile: pki.clientCert, ClientKeyFile: pki.clientKey},
+			"ca pem":  {CAPEM: pki.caPEM, ClientCertFile: pki.clientCert, ClientKeyFile: pki.clientKey},
+		} {
+			cn, err := whoami(cfg)
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", name, err)
+			}
+			if cn != "payment-service" {
+				t.Errorf("%s: expected client CN payment-service, got %q", name, cn)
+			}
+		}
+	})
+
+	t.Run("untrusted client certificate is rejected", func(t *testing.T) {
+		if _, err := whoami(TLSConfig{CAFile: pki.caPath, ClientCertFile: pki.untrustedCert, ClientKeyFile: pki.untrustedKey}); err == nil {
+			t.Error("expected handshake failure for a certificate from an unknown CA")
+		}
+	})
+
+	t.Run("missing client certificate is rejected", func(t *testing.T) {
+		if _, err := whoami(TLSConfig{CAFile: pki.caPath}); err == nil {
+			t.Error("expected handshake failure without a client certificate")
+		}
+	})
+
+	t.Run("server is verified against the CA", func(t *testing.T) {
+		_, err := whoami(TLSConfig{ClientCertFile: pki.clientCert, ClientKeyFile: pki.clientKey})
+		if err == nil || !strings.Contains(err.Error(), "certificate") {
+			t.Errorf("expected unknown authority error, got %v", err)
+		}
+
+		cn, err := whoami(TLSConfig{InsecureSkipVerify: true, ClientCertFile: pki.clientCert, ClientKeyFile: pki.clientKey})
+		if err != nil || cn != "payment-service" {
+			t.Errorf("expected InsecureSkipVerify to connect, got %q, %v", cn, err)
+		}
+	})
+}
+
+func TestClient_TLSConfigErrors(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	os.WriteFile(garbage, []byte("not a certificate"), 0o600)
+
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+		want string
+	}{
+		{name: "missing CA file", cfg: TLSConfig{CAFile: "/nonexistent/ca.pem"}, want: "read CA file"},
+		{name: "CA file without certificates", cfg: TLSConfig{CAFile: garbage}, want: "no certificates"},
+		{name: "missing client key", cfg: TLSConfig{ClientCertFile: garbage}, want: "load client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New(Config{BaseURL: "https://127.0.0.1:1", TLS: tt.cfg})
+			err := client.Registry().Heartbeat(context.Background(), "svc")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package rootclient
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/pkg/jwt"
+)
+
+// Defaults applied when LocalValidation leaves the cache unset
+const (
+	defaultMaxCacheAge         = time.Minute
+	defaultValidationCacheSize = 1000
+)
+
+// LocalValidation lets ValidateToken answer without a round trip to the root
+// server for most calls. Tokens are verified locally when Secret is set and
+// the server's verdicts are cached otherwise.
+type LocalValidation struct {
+	// Secret is the server's jwt.secret. Tokens are then verified with it by
+	// the server's rules: an HS256 signature, the issuer, the expiry and the
+	// access token type. Tokens it doesn't verify, such as tokens signed after
+	// the server's secret was rotated, are sent to the server. The server
+	// signs with this shared secret only and publishes no JWKS.
+	Secret string
+	// Issuer, when set, must match the iss claim of locally verified tokens,
+	// as the server's jwt.issuer does
+	Issuer string
+	// MaxCacheAge is how long a token is accepted or rejected before the
+	// server is asked again, which bounds how long a revoked token stays
+	// accepted; zero uses one minute. Accepted tokens are never cached past
+	// their expiry.
+	MaxCacheAge time.Duration
+	// CacheSize is how many tokens' verdicts are kept; zero uses 1000. A
+	// token evicted while revoked may be accepted locally once more.
+	CacheSize int
+}
+
+// WithLocalValidation makes ValidateToken verify tokens locally and cache
+// verdicts as configured by lv; see LocalValidation
+func WithLocalValidation(lv LocalValidation) Option {
+	return func(c *Client) {
+		c.validator = newTokenValidator(lv, clock.Real{})
+	}
+}
+
+// tokenValidator verifies tokens locally and caches verdicts for ValidateToken
+type tokenValidator struct {
+	jwt         *jwt.Manager // nil without a secret
+	maxCacheAge time.Duration
+	clock       clock.Clock
+	cache       *verdictCache
+}
+
+func newTokenValidator(lv LocalValidation, clk clock.Clock) *tokenValidator {
+	if lv.MaxCacheAge <= 0 {
+		lv.MaxCacheAge = defaultMaxCacheAge
+	}
+	if lv.CacheSize <= 0 {
+		lv.CacheSize = defaultValidationCacheSize
+	}
+
+	v := &tokenValidator{maxCacheAge: lv.MaxCacheAge, clock: clk, cache: newVerdictCache(lv.CacheSize)}
+	if lv.Secret != "" {
+		v.jwt = jwt.New(jwt.Config{Secret: lv.Secret, Issuer: lv.Issuer, Clock: clk})
+	}
+	return v
+}
+
+// validate returns nil when tokenString is a valid access token issued for
+// audience, or for any audience when it is empty. A token seen for the first
+// time is verified locally when possible; its verdict is then reused until
+// it is the maximum cache age old and remote, which also knows about
+// revocations, is asked again. Only acceptances and rejections are cached,
+// not failures to reach the server.
+func (v *tokenValidator) validate(ctx context.Context, tokenString, audience string, remote func(ctx context.Context) (*token.Claims, error)) error {
+	key := sha256.Sum256([]byte(tokenString))
+	now := v.clock.Now()
+
+	checked, found := v.cache.get(key, now)
+	if !found || now.Sub(checked.checkedAt) >= v.maxCacheAge {
+		var claims *token.Claims
+		var err error
+		if found {
+			claims, err = v.confirm(ctx, remote)
+		} else {
+			claims, err = v.verify(ctx, tokenString, remote)
+		}
+		if err != nil && !errors.Is(err, ErrUnauthorized) {
+			return err
+		}
+		checked = verdict{claims: claims, err: err, checkedAt: now}
+		v.cache.add(key, checked)
+	}
+
+	if checked.err != nil {
+		return checked.err
+	}
+	if audience != "" && checked.claims.Audience != audience {
+		return fmt.Errorf("%w: token was not issued for audience %q", ErrUnauthorized, audience)
+	}
+	return nil
+}
+
+// verify checks a token locally when a secret is configured, and with remote
+// otherwise, when the secret doesn't verify its signature or when the token
+// is over the default size cap, which the server may have raised
+func (v *tokenValidator) verify(ctx context.Context, tokenString string, remote func(ctx context.Context) (*token.Claims, error)) (*token.Claims, error) {
+	if v.jwt == nil {
+		return v.confirm(ctx, remote)
+	}
+
+	claims, err := v.jwt.Validate(tokenString)
+	switch {
+	case errors.Is(err, jwt.ErrSignatureMismatch), errors.Is(err, jwt.ErrTokenTooLarge):
+		return v.confirm(ctx, remote)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case claims.Type != token.TypeAccess:
+		return nil, fmt.Errorf("%w: not an access token", ErrUnauthorized)
+	}
+	return claims, nil
+}
+
+// confirm asks the server through remote
+func (v *tokenValidator) confirm(ctx context.Context, remote func(ctx context.Context) (*token.Claims, error)) (*token.Claims, error) {
+	claims, err := remote(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IsExpired(v.clock.Now()) {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, jwt.ErrTokenExpired)
+	}
+	return claims, nil
+}
+
+// validateRemote asks the server to validate a token for any audience and
+// returns its claims; the audience is checked by the caller so one verdict
+// serves every audience
+func (a *AuthClient) validateRemote(tokenString string, callOpts []CallOption) func(ctx context.Context) (*token.Claims, error) {
+	return func(ctx context.Context) (*token.Claims, error) {
+		var claims token.Claims
+		if err := a.client.doRequest(ctx, http.MethodPost, "/auth/validate", validateTokenRequest{Token: tokenString}, &claims, callOpts...); err != nil {
+			return nil, err
+		}
+		return &claims, nil
+	}
+}
+
+// verdict is the outcome of validating a token: its claims when accepted,
+// the rejection otherwise, and when it was reached
+type verdict struct {
+	claims    *token.Claims
+	err       error
+	checkedAt time.Time
+}
+
+// verdictEntry is a cached verdict and the key it is stored under
+type verdictEntry struct {
+	key tokenKey
+	verdict
+}
+
+// tokenKey is the SHA-256 of a token string, so the cache holds no bearer credentials
+type tokenKey [sha256.Size]byte
+
+// verdictCache is a least-recently-used cache of token verdicts. Acceptances
+// are dropped when their token expires.
+type verdictCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries map[tokenKey]*list.Element
+	order   *list.List // of *verdictEntry, most recently used first
+}
+
+func newVerdictCache(capacity int) *verdictCache {
+	return &verdictCache{
+		capacity: capacity,
+		entries:  make(map[tokenKey]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// get returns the verdict cached for a token, unless it accepted a token
+// that has expired since
+func (c *verdictCache) get(key tokenKey, now time.Time) (verdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return verdict{}, false
+	}
+	entry := elem.Value.(*verdictEntry)
+	if entry.claims != nil && entry.claims.IsExpired(now) {
+		delete(c.entries, key)
+		c.order.Remove(elem)
+		return verdict{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.verdict, true
+}
+
+// add caches a verdict, replacing the token's previous one and evicting the
+// least recently used entry when full
+func (c *verdictCache) add(key tokenKey, v verdict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*verdictEntry).verdict = v
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		delete(c.entries, oldest.Value.(*verdictEntry).key)
+		c.order.Remove(oldest)
+	}
+	c.entries[key] = c.order.PushFront(&verdictEntry{key: key, verdict: v})
+}
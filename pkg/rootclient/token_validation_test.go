@@ -0,0 +1,187 @@
+package rootclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+	"github.com/aq189/bin/internal/domain/token"
+	"github.com/aq189/bin/pkg/jwt"
+)
+
+// tokenServer validates tokens like the root server does, accepting those
+// signed with any of its secrets, and counts the validation requests
+type tokenServer struct {
+	managers []*jwt.Manager
+
+	mu      sync.Mutex
+	revoked map[string]bool // token IDs
+	calls   int
+}
+
+func newTokenServer(clk clock.Clock, secrets ...string) *tokenServer {
+	s := &tokenServer{revoked: make(map[string]bool)}
+	for _, secret := range secrets {
+		s.managers = append(s.managers, jwt.New(jwt.Config{Secret: secret, Clock: clk}))
+	}
+	return s
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+
+	var req validateTokenRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	var claims *token.Claims
+	err := errors.New("invalid token")
+	for _, m := range s.managers {
+		if claims, err = m.Validate(req.Token); err == nil {
+			break
+		}
+	}
+	if err == nil && s.revoked[claims.ID] {
+		err = errors.New("token revoked")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "code": "UNAUTHORIZED"})
+		return
+	}
+	json.NewEncoder(w).Encode(claims)
+}
+
+func (s *tokenServer) revoke(tokenString string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims, _ := s.managers[0].Validate(tokenString)
+	s.revoked[claims.ID] = true
+}
+
+func (s *tokenServer) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// issueToken signs an access token for billing-1 expiring after ttl
+func issueToken(t *testing.T, clk clock.Clock, secret string, typ token.Type, ttl time.Duration) string {
+	t.Helper()
+	tok, err := jwt.New(jwt.Config{Secret: secret, Clock: clk}).Generate(&token.Claims{
+		Subject:   "gateway",
+		Audience:  "billing-1",
+		Type:      typ,
+		ExpiresAt: clk.Now().Add(ttl),
+	})
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return tok
+}
+
+func TestAuthClient_LocalValidation(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	root := newTokenServer(fake, "server-secret", "rotated-secret")
+	srv := httptest.NewServer(root)
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	client.validator = newTokenValidator(LocalValidation{Secret: "server-secret", MaxCacheAge: time.Minute}, fake)
+	valid := issueToken(t, fake, "server-secret", token.TypeAccess, time.Hour)
+
+	tests := []struct {
+		name      string
+		token     string
+		audience  string
+		wantErr   error
+		wantCalls int // requests to the server
+	}{
+		{name: "valid token", token: valid},
+		{name: "own audience", token: valid, audience: "billing-1"},
+		{name: "other audience", token: valid, audience: "search-1", wantErr: ErrUnauthorized},
+		{name: "expired token", token: issueToken(t, fake, "server-secret", token.TypeAccess, -time.Minute), wantErr: ErrUnauthorized},
+		{name: "refresh token", token: issueToken(t, fake, "server-secret", token.TypeRefresh, time.Hour), wantErr: ErrUnauthorized},
+		{name: "malformed token", token: "not-a-token", wantErr: ErrUnauthorized},
+		{name: "unknown secret falls back to the server", token: issueToken(t, fake, "rotated-secret", token.TypeAccess, time.Hour), wantCalls: 1},
+		{name: "forged token rejected by the server", token: issueToken(t, fake, "forged-secret", token.TypeAccess, time.Hour), wantErr: ErrUnauthorized, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := root.callCount()
+			err := client.Auth().ValidateToken(context.Background(), tt.token, ValidateOptions{Audience: tt.audience})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got := root.callCount() - calls; got != tt.wantCalls {
+				t.Errorf("expected %d requests to the server, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+
+	// A revoked token is rejected once its local acceptance is too old
+	root.revoke(valid)
+	ctx := context.Background()
+	if err := client.Auth().ValidateToken(ctx, valid, ValidateOptions{}); err != nil {
+		t.Fatalf("expected the revocation unnoticed within the cache age, got %v", err)
+	}
+	fake.Advance(time.Minute)
+	if err := client.Auth().ValidateToken(ctx, valid, ValidateOptions{}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected the revoked token rejected after the cache age, got %v", err)
+	}
+}
+
+func TestAuthClient_ValidationCache(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	root := newTokenServer(fake, "server-secret")
+	srv := httptest.NewServer(root)
+	defer srv.Close()
+
+	client := New(Config{BaseURL: srv.URL, APIKey: "rk_test"})
+	client.validator = newTokenValidator(LocalValidation{MaxCacheAge: time.Minute}, fake)
+	ctx := context.Background()
+	long := issueToken(t, fake, "server-secret", token.TypeAccess, time.Hour)
+	short := issueToken(t, fake, "server-secret", token.TypeAccess, 90*time.Second) // expires 30s after its first use
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		revoke    bool
+		token     string
+		audience  string
+		wantErr   error
+		wantCalls int // requests to the server so far
+	}{
+		{name: "first validation asks the server", token: long, wantCalls: 1},
+		{name: "acceptance is cached", token: long, wantCalls: 1},
+		{name: "audience checked against cached claims", token: long, audience: "search-1", wantErr: ErrUnauthorized, wantCalls: 1},
+		{name: "revocation unnoticed within the cache age", revoke: true, advance: 59 * time.Second, token: long, wantCalls: 1},
+		{name: "revocation noticed after the cache age", advance: time.Second, token: long, wantErr: ErrUnauthorized, wantCalls: 2},
+		{name: "rejection is cached", token: long, wantErr: ErrUnauthorized, wantCalls: 2},
+		{name: "short-lived token", token: short, wantCalls: 3},
+		{name: "acceptance not cached past expiry", advance: 31 * time.Second, token: short, wantErr: ErrUnauthorized, wantCalls: 4},
+	}
+
+	for _, step := range steps {
+		if step.revoke {
+			root.revoke(step.token)
+		}
+		fake.Advance(step.advance)
+		err := client.Auth().ValidateToken(ctx, step.token, ValidateOptions{Audience: step.audience})
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: expected %v, got %v", step.name, step.wantErr, err)
+		}
+		if got := root.callCount(); got != step.wantCalls {
+			t.Errorf("%s: expected %d requests to the server, got %d", step.name, step.wantCalls, got)
+		}
+	}
+}
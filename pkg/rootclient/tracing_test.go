@@ -0,0 +1,69 @@
+package rootclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/aq189/bin/internal/middleware"
+	"github.com/aq189/bin/internal/server"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestClient_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	srv, err := server.New(server.Config{
+		Addr:        "127.0.0.1:0",
+		Middlewares: []server.Middleware{middleware.Tracing(tp)},
+	})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.GET("/v1/session/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"sess_1"}`))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	httpServer := &http.Server{Handler: srv.Handler()}
+	go httpServer.Serve(ln)
+
+	client := New(Config{BaseURL: "http://" + ln.Addr().String(), APIKey: "rk_test", TracerProvider: tp})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "checkout")
+	if _, err := client.Session().Get(ctx, "sess_1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	parent.End()
+
+	// Shutdown waits for the handler, and so the server span, to finish
+	httpServer.Shutdown(context.Background())
+
+	spans := make(map[trace.SpanKind]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.SpanKind] = span
+	}
+	root, clientSpan, serverSpan := spans[trace.SpanKindInternal], spans[trace.SpanKindClient], spans[trace.SpanKindServer]
+
+	if clientSpan.Name != http.MethodGet || serverSpan.Name != "GET /v1/session/" {
+		t.Fatalf("expected client and server spans, got %d spans: %+v", len(exporter.GetSpans()), spans)
+	}
+
+	traceID := root.SpanContext.TraceID()
+	if clientSpan.SpanContext.TraceID() != traceID || serverSpan.SpanContext.TraceID() != traceID {
+		t.Errorf("expected all spans in trace %s", traceID)
+	}
+	if clientSpan.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("expected client span under the caller's span, got parent %s", clientSpan.Parent.SpanID())
+	}
+	if serverSpan.Parent.SpanID() != clientSpan.SpanContext.SpanID() || !serverSpan.Parent.IsRemote() {
+		t.Errorf("expected server span under the client span, got parent %s", serverSpan.Parent.SpanID())
+	}
+}
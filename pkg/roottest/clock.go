@@ -0,0 +1,40 @@
+package roottest
+
+import (
+	"time"
+
+	"github.com/aq189/bin/internal/clock"
+)
+
+// Clock is a clock that only moves when told to. It starts at the time it
+// was created. Periodic server work such as health checks and purges runs
+// as Advance carries the clock past each interval.
+type Clock struct {
+	fake *clock.Fake
+}
+
+// NewClock returns a clock stopped at the current time
+func NewClock() *Clock {
+	return &Clock{fake: clock.NewFake(time.Now())}
+}
+
+// Now returns the clock's time
+func (c *Clock) Now() time.Time {
+	return c.fake.Now()
+}
+
+// NewTicker returns a ticker firing as the clock advances; it is how the
+// server schedules work on this clock
+func (c *Clock) NewTicker(d time.Duration) clock.Ticker {
+	return c.fake.NewTicker(d)
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.fake.Advance(d)
+}
+
+// Set moves the clock to t
+func (c *Clock) Set(t time.Time) {
+	c.fake.Set(t)
+}
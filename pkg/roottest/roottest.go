@@ -0,0 +1,231 @@
+// Package roottest runs an in-process root server for tests of code built on
+// pkg/rootclient. The fake serves the real routes, middleware and handlers on
+// top of memory storage, so requests are validated and answered the way the
+// real server answers them.
+//
+//	fake := roottest.NewFakeServer()
+//	defer fake.Close()
+//	client := fake.Client()
+package roottest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aq189/bin/internal/bootstrap"
+	"github.com/aq189/bin/internal/domain/config"
+	"github.com/aq189/bin/internal/domain/session"
+	"github.com/aq189/bin/internal/service/registry"
+	sessionsvc "github.com/aq189/bin/internal/service/session"
+	"github.com/aq189/bin/pkg/logger"
+	"github.com/aq189/bin/pkg/rootclient"
+)
+
+// APIKey is the admin API key the fake server accepts
+const APIKey = "rk_roottest_admin"
+
+// jwtSecret signs the tokens the fake server issues
+const jwtSecret = "roottest-jwt-secret-not-for-production-use"
+
+// FakeServer is a root server listening on a local loopback address
+type FakeServer struct {
+	// URL is the base URL of the server, for rootclient.Config.BaseURL
+	URL string
+	// Clock is the server's clock: tokens, sessions and heartbeats expire and
+	// health checks and purges run by it. Advance it instead of sleeping.
+	Clock *Clock
+
+	server *httptest.Server
+	app    *bootstrap.Application
+
+	mu       sync.Mutex
+	failures []failure
+}
+
+// failure is a response queued by FailNext
+type failure struct {
+	method string
+	path   string // a trailing slash matches every path below it
+	status int
+}
+
+// NewFakeServer starts a fake root server with empty memory storage. Callers
+// should Close it when finished. Like httptest.NewServer it panics when the
+// server cannot start.
+func NewFakeServer() *FakeServer {
+	cfg := &config.Config{
+		Server:  config.ServerConfig{Addr: "127.0.0.1:0"},
+		JWT:     config.JWTConfig{Secret: jwtSecret},
+		Auth:    config.AuthConfig{BootstrapAPIKey: APIKey},
+		Storage: config.StorageConfig{Type: config.StorageMemory},
+	}
+
+	fake := &FakeServer{Clock: NewClock()}
+	app, err := bootstrap.NewApplication(context.Background(), cfg, logger.NewNop(), bootstrap.WithClock(fake.Clock))
+	if err != nil {
+		panic(fmt.Sprintf("roottest: start fake server: %v", err))
+	}
+	fake.app = app
+	fake.server = httptest.NewServer(fake.inject(app.Handler()))
+	fake.URL = fake.server.URL
+	return fake
+}
+
+// Close shuts the server down and stops the application's background work
+func (f *FakeServer) Close() {
+	f.server.Close()
+	f.app.Stop(context.Background())
+}
+
+// Client returns a client of the server authenticated with APIKey
+func (f *FakeServer) Client(opts ...rootclient.Option) *rootclient.Client {
+	return rootclient.New(rootclient.Config{BaseURL: f.URL, APIKey: APIKey}, opts...)
+}
+
+// FailNext makes the next request matching route fail with status instead of
+// reaching the handler. route is a method and path such as "POST /session";
+// a path ending in a slash, such as "PUT /registry/heartbeat/", matches every
+// path below it. Paths match with or without the /v1 prefix. Queued failures
+// are used up in order, one request each.
+func (f *FakeServer) FailNext(route string, status int) {
+	method, path, ok := strings.Cut(route, " ")
+	if !ok {
+		panic(fmt.Sprintf("roottest: route %q is not \"METHOD /path\"", route))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, failure{method: method, path: unversioned(path), status: status})
+}
+
+// inject answers requests matching a queued failure and passes the rest to next
+func (f *FakeServer) inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := f.takeFailure(r); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "roottest: injected failure",
+				"code":  strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// takeFailure removes and returns the first queued failure matching r
+func (f *FakeServer) takeFailure(r *http.Request) (int, bool) {
+	path := unversioned(r.URL.Path)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, queued := range f.failures {
+		if queued.method != r.Method {
+			continue
+		}
+		if path == queued.path || (strings.HasSuffix(queued.path, "/") && strings.HasPrefix(path, queued.path)) {
+			f.failures = slices.Delete(f.failures, i, i+1)
+			return queued.status, true
+		}
+	}
+	return 0, false
+}
+
+// unversioned strips the /v1 prefix the API is also served under
+func unversioned(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/v1"); ok && strings.HasPrefix(rest, "/") {
+		return rest
+	}
+	return path
+}
+
+// SeedService registers a service directly, bypassing FailNext, and returns
+// it as the API would
+func (f *FakeServer) SeedService(req rootclient.RegisterRequest) (*rootclient.Service, error) {
+	var internal registry.RegisterRequest
+	if err := convert(req, &internal); err != nil {
+		return nil, err
+	}
+	svc, _, err := f.app.RegistryService().Register(context.Background(), internal)
+	if err != nil {
+		return nil, fmt.Errorf("roottest: seed service %s: %w", req.ID, err)
+	}
+
+	var seeded rootclient.Service
+	return &seeded, convert(svc, &seeded)
+}
+
+// SeedSession creates a session directly, bypassing FailNext. It expires
+// by Clock.
+func (f *FakeServer) SeedSession(req rootclient.CreateSessionRequest) (*rootclient.Session, error) {
+	var internal sessionsvc.CreateRequest
+	if err := convert(req, &internal); err != nil {
+		return nil, err
+	}
+	sess, err := f.app.SessionService().Create(context.Background(), internal)
+	if err != nil {
+		return nil, fmt.Errorf("roottest: seed session for %s: %w", req.UserID, err)
+	}
+
+	var seeded rootclient.Session
+	return &seeded, convert(sess, &seeded)
+}
+
+// Services returns the registered services ordered by ID
+func (f *FakeServer) Services() []*rootclient.Service {
+	stored, err := f.app.RegistryService().List(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("roottest: list services: %v", err))
+	}
+
+	var services []*rootclient.Service
+	if err := convert(stored, &services); err != nil {
+		panic(err.Error())
+	}
+	slices.SortFunc(services, func(a, b *rootclient.Service) int { return strings.Compare(a.ID, b.ID) })
+	return services
+}
+
+// Sessions returns every stored session ordered by ID, including expired ones
+// the cleanup has not removed yet
+func (f *FakeServer) Sessions() []*rootclient.Session {
+	// The application instruments the repository it stores sessions in
+	type instrumented interface {
+		Unwrap() session.SessionRepository
+	}
+	repo := f.app.SessionRepository()
+	if wrapper, ok := repo.(instrumented); ok {
+		repo = wrapper.Unwrap()
+	}
+	exporter, ok := repo.(interface{ Export() []*session.Session })
+	if !ok {
+		panic("roottest: session storage cannot be listed")
+	}
+
+	var sessions []*rootclient.Session
+	if err := convert(exporter.Export(), &sessions); err != nil {
+		panic(err.Error())
+	}
+	slices.SortFunc(sessions, func(a, b *rootclient.Session) int { return strings.Compare(a.ID, b.ID) })
+	return sessions
+}
+
+// convert copies in to out through their JSON encoding, which is the
+// contract between the client and server types
+func convert(in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("roottest: encode %T: %w", in, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("roottest: decode %T: %w", out, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package roottest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aq189/bin/pkg/rootclient"
+)
+
+func testService(id string) rootclient.RegisterRequest {
+	return rootclient.RegisterRequest{
+		ID:           id,
+		Name:         "orders",
+		Version:      "1.0.0",
+		Endpoints:    []rootclient.Endpoint{{URL: "http://orders.internal:8080", Weight: 1}},
+		Capabilities: []string{"orders"},
+	}
+}
+
+func TestFakeServer_Registry(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+	ctx := context.Background()
+	client := fake.Client()
+
+	if _, err := client.Registry().Register(ctx, testService("orders-1")); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := fake.SeedService(testService("orders-2")); err != nil {
+		t.Fatalf("SeedService() error = %v", err)
+	}
+	if err := client.Registry().Heartbeat(ctx, "orders-2"); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	found, err := client.Registry().Discover(ctx, "orders")
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(found) != 2 {
+		t.Errorf("Discover() found %d services, want 2", len(found))
+	}
+
+	services := fake.Services()
+	if len(services) != 2 || services[0].ID != "orders-1" || services[1].ID != "orders-2" {
+		t.Fatalf("Services() = %v, want orders-1 and orders-2", services)
+	}
+
+	if err := client.Registry().Deregister(ctx, "orders-1"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	if services := fake.Services(); len(services) != 1 {
+		t.Errorf("Services() after deregister has %d services, want 1", len(services))
+	}
+	if err := client.Registry().Heartbeat(ctx, "orders-1"); !errors.Is(err, rootclient.ErrGone) {
+		t.Errorf("Heartbeat() after deregister error = %v, want ErrGone", err)
+	}
+}
+
+func TestFakeServer_SessionExpiry(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+	ctx := context.Background()
+	client := fake.Client()
+
+	created, err := client.Session().Create(ctx, rootclient.CreateSessionRequest{
+		UserID:    "user-1",
+		ServiceID: "orders-1",
+		Data:      map[string]any{"cart": "c-1"},
+		TTL:       30,
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if want := fake.Clock.Now().Add(30 * time.Minute); !created.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", created.ExpiresAt, want)
+	}
+
+	fake.Clock.Advance(29 * time.Minute)
+	if valid, _, err := client.Session().Validate(ctx, created.ID); err != nil || !valid {
+		t.Fatalf("Validate() before expiry = %v, %v; want valid", valid, err)
+	}
+
+	fake.Clock.Advance(time.Minute)
+	if valid, _, err := client.Session().Validate(ctx, created.ID); err != nil || valid {
+		t.Errorf("Validate() at expiry = %v, %v; want invalid", valid, err)
+	}
+	if _, err := client.Session().Get(ctx, created.ID); !errors.Is(err, rootclient.ErrNotFound) {
+		t.Errorf("Get() after expiry error = %v, want ErrNotFound", err)
+	}
+
+	sessions := fake.Sessions()
+	if len(sessions) != 1 || sessions[0].ID != created.ID {
+		t.Errorf("Sessions() = %v, want the expired session until cleanup", sessions)
+	}
+}
+
+func TestFakeServer_SeedSession(t *testing.T) {
+	fake := NewFakeServer()
+	defer fake.Close()
+
+	seeded, err := fake.SeedSession(rootclient.CreateSessionRequest{UserID: "user-1", ServiceID: "orders-1"})
+	if err != nil {
+		t.Fatalf("SeedSession() error = %v", err)
+	}
+
+	got, err := fake.Client().Session().Get(context.Background(), seeded.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.UserID != "user-1" {
+		t.Errorf("UserID = %q, want user-1", got.UserID)
+	}
+}
+
+func TestFakeServer_FailNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		status  int
+		wantErr error
+	}{
+		{name: "exact path", route: "POST /session", status: http.StatusInternalServerError},
+		{name: "versioned path", route: "POST /v1/session", status: http.StatusConflict, wantErr: rootclient.ErrConflict},
+		{name: "prefix", route: "POST /", status: http.StatusUnauthorized, wantErr: rootclient.ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeServer()
+			defer fake.Close()
+			ctx := context.Background()
+			client := fake.Client()
+			req := rootclient.CreateSessionRequest{UserID: "user-1", ServiceID: "orders-1"}
+
+			fake.FailNext("GET /session/", http.StatusInternalServerError)
+			fake.FailNext(tt.route, tt.status)
+
+			_, err := client.Session().Create(ctx, req)
+			var apiErr rootclient.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode() != tt.status {
+				t.Fatalf("Create() error = %v, want status %d", err, tt.status)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+			if sessions := fake.Sessions(); len(sessions) != 0 {
+				t.Errorf("failed Create() stored %d sessions", len(sessions))
+			}
+
+			if _, err := client.Session().Create(ctx, req); err != nil {
+				t.Errorf("second Create() error = %v, want the failure used up", err)
+			}
+			if len(fake.failures) != 1 {
+				t.Errorf("%d failures queued, want the unmatched GET left", len(fake.failures))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Package tracing carries OpenTelemetry trace context across HTTP calls
+// between the root server and its clients. Callers pass a
+// trace.TracerProvider; nothing is recorded unless they install an SDK
+// provider, so code built with tracing disabled only pays for the API.
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies spans created by this module
+const InstrumentationName = "github.com/aq189/bin"
+
+// Propagator reads and writes W3C traceparent and tracestate headers
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Transport returns a RoundTripper that records a client span per request
+// and injects its traceparent header. A nil base uses http.DefaultTransport.
+func Transport(base http.RoundTripper, tp trace.TracerProvider) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, tracer: tp.Tracer(InstrumentationName)}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	tracer trace.Tracer
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		),
+	)
+	defer span.End()
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(ctx)
+	Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	RecordStatus(span, resp.StatusCode, trace.SpanKindClient)
+	return resp, nil
+}
+
+// RecordStatus sets the response status attribute and marks the span as
+// failed for 5xx responses, and for 4xx responses on client spans
+func RecordStatus(span trace.Span, status int, kind trace.SpanKind) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError || (kind == trace.SpanKindClient && status >= http.StatusBadRequest) {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+	}
+}
@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Limits shared by the server and the client SDK
+const (
+	MaxIDLength            = 128
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 256
+)
+
+var (
+	idPattern         = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	capabilityPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// FieldError describes why a single field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects field errors. A non-empty Errors is an error.
+type Errors []FieldError
+
+// Add records an invalid field
+func (e *Errors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Err returns e as an error, or nil when no field is invalid
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error joins the field errors into a single message
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// IsID reports whether s is safe to use as an identifier in a URL path:
+// letters, digits, dots, dashes and underscores, starting with a letter or digit
+func IsID(s string) bool {
+	return len(s) <= MaxIDLength && idPattern.MatchString(s)
+}
+
+// IsCapability reports whether s is lowercase alphanumerics separated by single dashes
+func IsCapability(s string) bool {
+	return capabilityPattern.MatchString(s)
+}
+
+// IsHTTPURL reports whether s is an absolute http or https URL with a host
+func IsHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// IsHostPort reports whether s is a host and a port from 1 to 65535 joined
+// as net.JoinHostPort does
+func IsHostPort(s string) bool {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || host == "" {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIsID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"payment-svc-1", true},
+		{"svc_1.eu", true},
+		{"A1", true},
+		{"", false},
+		{"-leading-dash", false},
+		{"has/slash", false},
+		{"has space", false},
+		{"percent%2F", false},
+		{strings.Repeat("a", MaxIDLength), true},
+		{strings.Repeat("a", MaxIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsID(tt.id); got != tt.want {
+			t.Errorf("IsID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestIsCapability(t *testing.T) {
+	tests := []struct {
+		capability string
+		want       bool
+	}{
+		{"payment", true},
+		{"refund-v2", true},
+		{"", false},
+		{"Payment", false},
+		{"double--dash", false},
+		{"-leading", false},
+		{"trailing-", false},
+		{"under_score", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCapability(tt.capability); got != tt.want {
+			t.Errorf("IsCapability(%q) = %v, want %v", tt.capability, got, tt.want)
+		}
+	}
+}
+
+func TestIsHTTPURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://payment-1:8080", true},
+		{"https://payment.internal/health", true},
+		{"not a url", false},
+		{"/health", false},
+		{"ftp://files.internal", false},
+		{"http://", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHTTPURL(tt.url); got != tt.want {
+			t.Errorf("IsHTTPURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestIsHostPort(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"payment-1:9090", true},
+		{"10.0.0.1:5432", true},
+		{"[::1]:8080", true},
+		{"payment-1", false},
+		{":9090", false},
+		{"payment-1:0", false},
+		{"payment-1:70000", false},
+		{"payment-1:grpc", false},
+		{"http://payment-1:9090", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHostPort(tt.addr); got != tt.want {
+			t.Errorf("IsHostPort(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	if errs.Err() != nil {
+		t.Fatal("expected nil error when no field is invalid")
+	}
+
+	errs.Add("id", "is required")
+	errs.Add("name", "is required")
+
+	err := errs.Err()
+	var got Errors
+	if !errors.As(err, &got) || len(got) != 2 {
+		t.Fatalf("expected two field errors, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "id: is required") {
+		t.Errorf("expected message to name the field, got %q", err.Error())
+	}
+}